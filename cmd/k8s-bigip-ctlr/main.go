@@ -18,21 +18,28 @@ package main
 
 import (
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
 	"net/url"
 	"os"
 	"os/signal"
+	"runtime"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/appmanager"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/dnspublisher"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/openshift"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/pollers"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/tracing"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/writer"
 
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	clog "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger/console"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/pflag"
 
 	"k8s.io/client-go/kubernetes"
@@ -52,12 +59,20 @@ type globalSection struct {
 }
 
 type bigIPSection struct {
-	BigIPUsername   string   `json:"username,omitempty"`
-	BigIPPassword   string   `json:"password,omitempty"`
-	BigIPURL        string   `json:"url,omitempty"`
-	BigIPPartitions []string `json:"partitions,omitempty"`
+	BigIPUsername    string   `json:"username,omitempty"`
+	BigIPPassword    string   `json:"password,omitempty"`
+	BigIPURL         string   `json:"url,omitempty"`
+	BigIPPartitions  []string `json:"partitions,omitempty"`
+	TrafficGroup     string   `json:"traffic-group,omitempty"`
+	FailoverInterval int      `json:"failover-interval,omitempty"`
 }
 
+// Set at build time with -ldflags "-X main.version=... -X main.buildInfo=..."
+var (
+	version   = "unknown"
+	buildInfo = "unknown"
+)
+
 var (
 	// Flag sets and supported flags
 	flags             *pflag.FlagSet
@@ -66,34 +81,101 @@ var (
 	kubeFlags         *pflag.FlagSet
 	openshiftSDNFlags *pflag.FlagSet
 	osRouteFlags      *pflag.FlagSet
+	dnsFlags          *pflag.FlagSet
 
 	pythonBaseDir    *string
 	logLevel         *string
 	verifyInterval   *int
 	nodePollInterval *int
+	pprofAddr        *string
+	diagnosticsAddr  *string
+	metricsAddr      *string
+	admissionAddr    *string
+	admissionCert    *string
+	admissionKey     *string
+	admissionSchema  *string
+	freezeAddr       *string
+	changeFreeze     *bool
+	resyncAddr       *string
+	queueDepthWarn   *int
+	initSyncWorkers  *int
+	initSyncDeadline *time.Duration
+	vsQueueKey       *string
+	queueBaseDelay   *time.Duration
+	queueMaxDelay    *time.Duration
+	queueQPS         *float64
+	logConfigDiff    *bool
+	prettyConfig     *bool
+	shardDgs         *bool
+	iruleTemplateDir *string
+	adoptLegacy      *bool
+	eventComponent   *string
+	clusterIdentity  *string
+	otlpEndpoint     *string
+	otlpServiceName  *string
 
 	namespaces      *[]string
 	useNodeInternal *bool
 	poolMemberType  *string
+	poolMemberLimit *int
+	nodeMonInterval *int
+	nodeMonTimeout  *int
+	nodeMonDefault  *bool
+	certMgrTimeout  *time.Duration
+	epDampening     *time.Duration
+	probeMonitors   *bool
+	serviceAddress  *bool
+	ingStatus       *bool
+	cfgMapStatus    *bool
+	appliedConfig   *string
 	inCluster       *bool
 	kubeConfig      *string
+	kubeContext     *string
 	namespaceLabel  *string
+	nsDefaults      *bool
+	nsDeleteGrace   *time.Duration
 	manageRoutes    *bool
-
-	bigIPURL        *string
-	bigIPUsername   *string
-	bigIPPassword   *string
-	bigIPPartitions *[]string
+	shardIndex      *int
+	shardTotal      *int
+	crossNsRefs     *[]string
+	bigipSources    *[]string
+	defaultSecret   *string
+	vipTombstoneCM  *string
+
+	bigIPURL         *string
+	bigIPUsername    *string
+	bigIPPassword    *string
+	bigIPPartitions  *[]string
+	defaultPartition *string
+	trafficGroup     *string
+	failoverInterval *int
 
 	openshiftSDNMode string
 	openshiftSDNName *string
 
 	routeVserverAddr *string
 	routeLabel       *string
+	routeServerCA    *string
+	routeStatusCM    *string
+	routeValidation  *bool
+	routeHttpVs      *bool
+	routeHttpsVs     *bool
+
+	dnsProvider      *string
+	dnsOwnerID       *string
+	dnsTTL           *int
+	dnsZone          *string
+	infobloxURL      *string
+	infobloxUsername *string
+	infobloxPassword *string
+	infobloxView     *string
+	infobloxInsecure *bool
 
 	// package variables
 	isNodePort         bool
 	watchAllNamespaces bool
+	crossNamespaceRefs map[string][]string
+	bigipSourceNets    []*net.IPNet
 )
 
 func _init() {
@@ -103,6 +185,7 @@ func _init() {
 	kubeFlags = pflag.NewFlagSet("Kubernetes", pflag.ContinueOnError)
 	openshiftSDNFlags = pflag.NewFlagSet("Openshift SDN", pflag.ContinueOnError)
 	osRouteFlags = pflag.NewFlagSet("OpenShift Routes", pflag.ContinueOnError)
+	dnsFlags = pflag.NewFlagSet("DNS", pflag.ContinueOnError)
 
 	// Global flags
 	pythonBaseDir = globalFlags.String("python-basedir", "/app/python",
@@ -113,6 +196,97 @@ func _init() {
 		"Optional, interval (in seconds) at which to verify the BIG-IP configuration.")
 	nodePollInterval = globalFlags.Int("node-poll-interval", 30,
 		"Optional, interval (in seconds) at which to poll for cluster nodes.")
+	pprofAddr = globalFlags.String("pprof-address", "",
+		"Optional, address (host:port) on which to serve pprof profiling endpoints. "+
+			"Profiling is disabled if left blank.")
+	diagnosticsAddr = globalFlags.String("diagnostics-address", "",
+		"Optional, loopback address (host:port) on which to serve a "+
+			"diagnostics bundle at /debug/bundle. Disabled if left blank.")
+	metricsAddr = globalFlags.String("metrics-address", "",
+		"Optional, address (host:port) on which to serve Prometheus metrics "+
+			"at /metrics. Disabled if left blank.")
+	admissionAddr = globalFlags.String("admission-address", "",
+		"Optional, address (host:port) on which to serve a validating "+
+			"admission webhook at /validate. Disabled if left blank.")
+	admissionCert = globalFlags.String("admission-tls-cert", "",
+		"Optional, path to the TLS certificate of the admission webhook, "+
+			"required with admission-address.")
+	admissionKey = globalFlags.String("admission-tls-key", "",
+		"Optional, path to the TLS key of the admission webhook, "+
+			"required with admission-address.")
+	admissionSchema = globalFlags.String("admission-schema",
+		appmanager.DefaultAdmissionSchema,
+		"Optional, ConfigMap schema the balance annotation of Ingresses is "+
+			"validated against by the admission webhook.")
+	freezeAddr = globalFlags.String("freeze-address", "",
+		"Optional, loopback address (host:port) on which to serve the "+
+			"change freeze endpoint at /freeze. Disabled if left blank.")
+	changeFreeze = globalFlags.Bool("change-freeze", false,
+		"Optional, start in a change freeze: resources are synced but the "+
+			"BIG-IP configuration is not changed until the freeze is ended at "+
+			"the freeze endpoint.")
+	resyncAddr = globalFlags.String("resync-address", "",
+		"Optional, loopback address (host:port) on which to serve the full "+
+			"resync endpoint at /resync. Disabled if left blank; a resync can "+
+			"also be requested with SIGUSR1.")
+	queueDepthWarn = globalFlags.Int("queue-depth-warning", 0,
+		"Optional, number of keys waiting in a work queue above which a "+
+			"warning is logged with the pending keys. Disabled if 0.")
+	initSyncWorkers = globalFlags.Int("initial-sync-workers", 1,
+		"Optional, number of workers syncing the namespaces in parallel "+
+			"until the initial configuration is written.")
+	initSyncDeadline = globalFlags.Duration("initial-sync-deadline",
+		appmanager.DefaultInitialSyncDeadline,
+		"Optional, time after which the resources still to be synced are "+
+			"logged if the initial configuration has not been written. "+
+			"Disabled if 0.")
+	vsQueueKey = globalFlags.String("vs-queue-key", "service",
+		"Optional, granularity of the virtual server sync: 'service' syncs "+
+			"all the resources of a namespace referencing a service on each "+
+			"change, 'resource' syncs each ConfigMap and Ingress referencing "+
+			"it on its own.")
+	queueBaseDelay = globalFlags.Duration("queue-retry-base-delay",
+		appmanager.DefaultQueueBaseDelay,
+		"Optional, initial delay before retrying a failed resource sync. "+
+			"The delay grows exponentially on each consecutive failure.")
+	queueMaxDelay = globalFlags.Duration("queue-retry-max-delay",
+		appmanager.DefaultQueueMaxDelay,
+		"Optional, maximum delay before retrying a failed resource sync.")
+	queueQPS = globalFlags.Float64("queue-retry-qps", appmanager.DefaultQueueQPS,
+		"Optional, overall rate (per second) at which failed resource syncs "+
+			"are retried.")
+	logConfigDiff = globalFlags.Bool("log-config-diff", false,
+		"Optional, log a summary of the added, removed and changed BIG-IP "+
+			"objects each time the configuration is written.")
+	prettyConfig = globalFlags.Bool("pretty-config", false,
+		"Optional, indent the configuration written for the driver, to ease "+
+			"reading and diffing it.")
+	shardDgs = globalFlags.Bool("shard-data-groups", false,
+		"Optional, split the data groups of the server names of passthrough "+
+			"and reencrypt Routes and Ingresses by first character of the "+
+			"server name, for large numbers of hosts.")
+	iruleTemplateDir = globalFlags.String("irule-template-dir", "",
+		"Optional, directory of files named after the HTTP redirect and "+
+			"passthrough iRules, usually a mounted ConfigMap, whose Go "+
+			"templates override the built-in code of the iRules.")
+	adoptLegacy = globalFlags.Bool("adopt-legacy-names", true,
+		"Optional, let the driver take over the BIG-IP objects created under "+
+			"the names of earlier controller versions.")
+	eventComponent = globalFlags.String("event-source-component",
+		appmanager.DefaultEventSourceComponent,
+		"Optional, component of the source of the Events recorded by the "+
+			"controller.")
+	clusterIdentity = globalFlags.String("cluster-identity", "",
+		"Optional, name of the cluster, recorded as the host of the source "+
+			"of Events and added to the descriptions of the BIG-IP nodes, to "+
+			"tell apart several clusters sharing a BIG-IP.")
+	otlpEndpoint = globalFlags.String("otlp-endpoint", "",
+		"Optional, OTLP/HTTP traces endpoint of an OpenTelemetry collector, "+
+			"e.g. http://otel-collector:4318/v1/traces, to which the sync of "+
+			"each resource is traced. Disabled if left blank.")
+	otlpServiceName = globalFlags.String("otlp-service-name",
+		tracing.DefaultServiceName,
+		"Optional, service name of the traces exported to otlp-endpoint.")
 
 	globalFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "  Global:\n%s\n", globalFlags.FlagUsages())
@@ -127,6 +301,17 @@ func _init() {
 		"Required, password for the Big-IP user account.")
 	bigIPPartitions = bigIPFlags.StringArray("bigip-partition", []string{},
 		"Required, partition(s) for the Big-IP kubernetes objects.")
+	defaultPartition = bigIPFlags.String("bigip-default-partition", "",
+		"Optional, partition for objects that do not specify one and for "+
+			"objects shared by all virtual servers. Must be one of the "+
+			"bigip-partition values. Defaults to the first bigip-partition.")
+	trafficGroup = bigIPFlags.String("bigip-traffic-group", "",
+		"Optional, traffic group of the virtual addresses of virtual servers, "+
+			"for BIG-IP HA pairs. Uses the BIG-IP default if left blank.")
+	failoverInterval = bigIPFlags.Int("failover-interval", 0,
+		"Optional, interval (in seconds) at which to check the failover state "+
+			"of the BIG-IP. The configuration is only applied while the BIG-IP "+
+			"is active, and verified when it becomes active. Disabled if 0.")
 
 	bigIPFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "  BigIP:\n%s\n", bigIPFlags.FlagUsages())
@@ -143,14 +328,86 @@ func _init() {
 			"'nodeport' will use k8s service NodePort. "+
 			"'cluster' will use service endpoints. "+
 			"The BIG-IP must be able access the cluster network")
+	nodeMonInterval = kubeFlags.Int("node-monitor-interval", 0,
+		"Optional, interval (in seconds) of a TCP monitor on each node's "+
+			"NodePort, added to every pool in addition to application monitors. "+
+			"Disabled if 0. Only applicable when pool-member-type is nodeport.")
+	nodeMonTimeout = kubeFlags.Int("node-monitor-timeout", 0,
+		"Optional, timeout (in seconds) of the node monitor. "+
+			"Defaults to three times node-monitor-interval plus one.")
+	nodeMonDefault = kubeFlags.Bool("node-monitor-default-only", false,
+		"Optional, only add the node monitor to pools without health "+
+			"monitors, as their default monitor.")
+	poolMemberLimit = kubeFlags.Int("pool-member-limit", 0,
+		"Optional, maximum number of members of each pool. Larger pools are "+
+			"truncated and an Event is recorded on their service. "+
+			"Disabled if 0.")
+	certMgrTimeout = kubeFlags.Duration("cert-manager-timeout",
+		appmanager.DefaultCertManagerTimeout,
+		"Optional, time to wait for cert-manager to issue the TLS Secret of an "+
+			"Ingress before recording an Event. Disabled if 0.")
+	epDampening = kubeFlags.Duration("endpoints-dampening", 0,
+		"Optional, window in which changes to the endpoints of a service are "+
+			"coalesced into a single sync, such as 500ms. Disabled if 0.")
+	probeMonitors = kubeFlags.Bool("readiness-probe-monitors", false,
+		"Optional, derive health monitors from the readinessProbe of the pods "+
+			"of a service when an Ingress or ConfigMap does not define any.")
+	serviceAddress = kubeFlags.Bool("use-service-address", false,
+		"Optional, use the loadBalancerIP or externalIPs of a service as the "+
+			"virtual address when an Ingress or ConfigMap does not set one.")
+	ingStatus = kubeFlags.Bool("update-ingress-status", true,
+		"Optional, write the virtual address to the status of Ingresses. "+
+			"Also disabled without permission to update ingresses/status.")
+	cfgMapStatus = kubeFlags.Bool("update-configmap-status", true,
+		"Optional, write the virtual address to the status annotation of "+
+			"ConfigMaps. Also disabled without permission to patch configmaps.")
+	appliedConfig = kubeFlags.String("annotate-applied-config", "none",
+		"Optional, annotate the ConfigMaps, Ingresses and Routes with what "+
+			"was last written to the BIG-IP for them: 'hash' writes a hash of "+
+			"their virtual server configs, 'config' also writes the configs, "+
+			"'none' writes nothing.")
 	inCluster = kubeFlags.Bool("running-in-cluster", true,
 		"Optional, if this controller is running in a kubernetes cluster, use the pod secrets for creating a Kubernetes client.")
 	kubeConfig = kubeFlags.String("kubeconfig", "./config",
 		"Optional, absolute path to the kubeconfig file")
+	kubeContext = kubeFlags.String("context", "",
+		"Optional, kubeconfig context to use when running outside the cluster. "+
+			"Defaults to the current context of the kubeconfig file.")
 	namespaceLabel = kubeFlags.String("namespace-label", "",
 		"Optional, used to watch for namespaces with this label")
+	nsDefaults = kubeFlags.Bool("namespace-defaults", false,
+		"Optional, use the annotations of a namespace as defaults for the "+
+			"Ingresses and Routes in it. Requires permission to watch namespaces.")
+	nsDeleteGrace = kubeFlags.Duration("namespace-delete-grace", 0,
+		"Optional, with namespace-label, time during which the virtual "+
+			"servers of a deleted namespace are disabled but kept on the "+
+			"BIG-IP before they are removed. Disabled if 0.")
 	manageRoutes = kubeFlags.Bool("manage-routes", false,
 		"Optional, specify whether or not to manage Route resources")
+	shardIndex = kubeFlags.Int("shard-index", 0,
+		"Optional, index of the namespace shard managed by this controller "+
+			"(0 to shard-total - 1)")
+	shardTotal = kubeFlags.Int("shard-total", 1,
+		"Optional, number of controllers the watched namespaces are split "+
+			"between. Each namespace is managed by exactly one controller.")
+	crossNsRefs = kubeFlags.StringArray("cross-namespace-ref", []string{},
+		"Optional, allow the Ingresses of a namespace to reference services "+
+			"of other watched namespaces, as namespace=target[,target...]. "+
+			"A target of * allows all namespaces.")
+	defaultSecret = kubeFlags.String("default-ssl-secret", "",
+		"Optional, TLS Secret, as namespace/name, such as a wildcard "+
+			"certificate of the cluster domain, converted to a single client "+
+			"SSL profile shared by the Ingresses and Routes serving TLS "+
+			"without a certificate of their own.")
+	vipTombstoneCM = kubeFlags.String("vip-tombstone-configmap", "",
+		"Optional, ConfigMap (namespace/name) keeping the addresses reserved "+
+			"for deleted Ingresses and Routes by the preserve VIP annotation "+
+			"across restarts. Kept in memory only if left blank.")
+	bigipSources = kubeFlags.StringArray("bigip-source-cidr", []string{},
+		"Optional, address range the BIG-IP sends traffic to pods from, "+
+			"such as its self IPs or SNAT pool, as a CIDR. Can be repeated. "+
+			"Warns about pools of endpoints whose pods NetworkPolicies block "+
+			"from these addresses.")
 
 	kubeFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "  Kubernetes:\n%s\n", kubeFlags.FlagUsages())
@@ -175,16 +432,63 @@ func _init() {
 		"Optional, bind address for virtual server for Route objects.")
 	routeLabel = osRouteFlags.String("route-label", "",
 		"Optional, label for which Route objects to watch.")
+	routeServerCA = osRouteFlags.String("route-default-server-ca",
+		appmanager.DefaultServerCAPath,
+		"Optional, path to the CA certificate used for reencrypt Routes "+
+			"that do not specify a destination CA certificate. Reloaded when "+
+			"it changes.")
+	routeStatusCM = osRouteFlags.String("route-status-configmap", "",
+		"Optional, ConfigMap (namespace/name) to which a report of the "+
+			"Routes configured on each virtual server and of the rejected "+
+			"Routes is written. Disabled if left blank.")
+	routeValidation = osRouteFlags.Bool("route-ext-validation", false,
+		"Optional, reject Routes with an invalid host, or with a "+
+			"certificate that does not match its key or CA certificate, like "+
+			"the extended validation of the OpenShift router.")
+	routeHttpVs = osRouteFlags.Bool("route-http-vserver", true,
+		"Optional, create the http virtual servers of Routes. Disable for "+
+			"https-only clusters.")
+	routeHttpsVs = osRouteFlags.Bool("route-https-vserver", true,
+		"Optional, create the https virtual servers of Routes. Disable for "+
+			"plaintext-only clusters.")
 
 	osRouteFlags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "  Openshift Routes:\n%s\n", osRouteFlags.FlagUsages())
 	}
 
+	// DNS flags
+	dnsProvider = dnsFlags.String("dns-provider", "",
+		"Optional, publish the host names of active virtual servers to a DNS "+
+			"provider, 'route53' or 'infoblox'. Route53 credentials are read "+
+			"from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.")
+	dnsOwnerID = dnsFlags.String("dns-owner-id", dnspublisher.DefaultOwnerID,
+		"Optional, owner recorded in the external-dns TXT registry record of "+
+			"each published name. Must be unique for each cluster.")
+	dnsTTL = dnsFlags.Int("dns-ttl", dnspublisher.DefaultTTL,
+		"Optional, TTL (in seconds) of published records.")
+	dnsZone = dnsFlags.String("dns-zone", "",
+		"Required with dns-provider, Route53 hosted zone ID or Infoblox zone name.")
+	infobloxURL = dnsFlags.String("infoblox-url", "",
+		"Required for Infoblox, WAPI URL, e.g. https://infoblox.example.com/wapi/v2.5")
+	infobloxUsername = dnsFlags.String("infoblox-username", "",
+		"Required for Infoblox, WAPI user name.")
+	infobloxPassword = dnsFlags.String("infoblox-password", "",
+		"Required for Infoblox, WAPI password.")
+	infobloxView = dnsFlags.String("infoblox-view", dnspublisher.DefaultInfobloxView,
+		"Optional, Infoblox DNS view of published records.")
+	infobloxInsecure = dnsFlags.Bool("infoblox-ssl-insecure", false,
+		"Optional, do not verify the certificate of the Infoblox WAPI.")
+
+	dnsFlags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "  DNS:\n%s\n", dnsFlags.FlagUsages())
+	}
+
 	flags.AddFlagSet(globalFlags)
 	flags.AddFlagSet(bigIPFlags)
 	flags.AddFlagSet(kubeFlags)
 	flags.AddFlagSet(openshiftSDNFlags)
 	flags.AddFlagSet(osRouteFlags)
+	flags.AddFlagSet(dnsFlags)
 
 	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage of %s\n", os.Args[0])
@@ -193,6 +497,7 @@ func _init() {
 		kubeFlags.Usage()
 		openshiftSDNFlags.Usage()
 		osRouteFlags.Usage()
+		dnsFlags.Usage()
 	}
 }
 
@@ -214,6 +519,14 @@ func init() {
 	_init()
 }
 
+// Label selector of the Routes to watch, from the value of route-label
+func routeLabelSelector(routeLabel string) string {
+	if len(routeLabel) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("f5type in (%s)", routeLabel)
+}
+
 func verifyArgs() error {
 	*logLevel = strings.ToUpper(*logLevel)
 	logErr := initLogger(*logLevel)
@@ -226,6 +539,26 @@ func verifyArgs() error {
 		return fmt.Errorf("Missing required parameter")
 	}
 
+	if len(*defaultPartition) == 0 {
+		*defaultPartition = (*bigIPPartitions)[0]
+	} else {
+		found := false
+		for _, partition := range *bigIPPartitions {
+			if partition == *defaultPartition {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("bigip-default-partition '%s' must be one of "+
+				"the bigip-partition values", *defaultPartition)
+		}
+	}
+
+	if *failoverInterval < 0 {
+		return fmt.Errorf("failover-interval must not be negative")
+	}
+
 	if len(*namespaces) != 0 && len(*namespaceLabel) != 0 {
 		return fmt.Errorf("Can not specify both namespace and namespace-label")
 	}
@@ -259,6 +592,178 @@ func verifyArgs() error {
 			u.Path)
 	}
 
+	if len(*pprofAddr) > 0 {
+		if _, _, err := net.SplitHostPort(*pprofAddr); nil != err {
+			return fmt.Errorf("Invalid pprof-address '%s': %v", *pprofAddr, err)
+		}
+	}
+
+	if len(*diagnosticsAddr) > 0 {
+		if _, _, err := net.SplitHostPort(*diagnosticsAddr); nil != err {
+			return fmt.Errorf("Invalid diagnostics-address '%s': %v",
+				*diagnosticsAddr, err)
+		}
+		if !isLoopbackAddr(*diagnosticsAddr) {
+			return fmt.Errorf("diagnostics-address '%s' must be a loopback "+
+				"address, the endpoint is not authenticated", *diagnosticsAddr)
+		}
+	}
+
+	if len(*metricsAddr) > 0 {
+		if _, _, err := net.SplitHostPort(*metricsAddr); nil != err {
+			return fmt.Errorf("Invalid metrics-address '%s': %v",
+				*metricsAddr, err)
+		}
+	}
+
+	if len(*admissionAddr) > 0 {
+		if _, _, err := net.SplitHostPort(*admissionAddr); nil != err {
+			return fmt.Errorf("Invalid admission-address '%s': %v",
+				*admissionAddr, err)
+		}
+		if len(*admissionCert) == 0 || len(*admissionKey) == 0 {
+			return fmt.Errorf("admission-tls-cert and admission-tls-key are " +
+				"required with admission-address")
+		}
+	}
+
+	if len(*freezeAddr) > 0 {
+		if _, _, err := net.SplitHostPort(*freezeAddr); nil != err {
+			return fmt.Errorf("Invalid freeze-address '%s': %v",
+				*freezeAddr, err)
+		}
+		if !isLoopbackAddr(*freezeAddr) {
+			return fmt.Errorf("freeze-address '%s' must be a loopback "+
+				"address, the endpoint is not authenticated", *freezeAddr)
+		}
+	}
+
+	if len(*resyncAddr) > 0 {
+		if _, _, err := net.SplitHostPort(*resyncAddr); nil != err {
+			return fmt.Errorf("Invalid resync-address '%s': %v",
+				*resyncAddr, err)
+		}
+		if !isLoopbackAddr(*resyncAddr) {
+			return fmt.Errorf("resync-address '%s' must be a loopback "+
+				"address, the endpoint is not authenticated", *resyncAddr)
+		}
+	}
+
+	// The admission webhook is served with TLS by a listener of its own
+	for _, addr := range []string{*pprofAddr, *diagnosticsAddr,
+		*metricsAddr, *freezeAddr, *resyncAddr} {
+		if len(*admissionAddr) > 0 && addr == *admissionAddr {
+			return fmt.Errorf("admission-address '%s' must not be used by "+
+				"other endpoints", *admissionAddr)
+		}
+	}
+
+	if len(*otlpEndpoint) > 0 {
+		u, err := url.Parse(*otlpEndpoint)
+		if nil != err || (u.Scheme != "http" && u.Scheme != "https") ||
+			len(u.Host) == 0 {
+			return fmt.Errorf("Invalid otlp-endpoint '%s', must be an http or "+
+				"https URL", *otlpEndpoint)
+		}
+	}
+
+	if *queueDepthWarn < 0 {
+		return fmt.Errorf("queue-depth-warning must not be negative")
+	}
+
+	if *poolMemberLimit < 0 {
+		return fmt.Errorf("pool-member-limit must not be negative")
+	}
+
+	if *initSyncWorkers < 1 {
+		return fmt.Errorf("initial-sync-workers must be at least 1")
+	}
+	if *initSyncDeadline < 0 {
+		return fmt.Errorf("initial-sync-deadline must not be negative")
+	}
+
+	switch *vsQueueKey {
+	case "service", "resource":
+	default:
+		return fmt.Errorf("'%v' is not a valid vs-queue-key, must be "+
+			"service or resource", *vsQueueKey)
+	}
+
+	if *queueBaseDelay <= 0 || *queueMaxDelay <= 0 || *queueQPS <= 0 {
+		return fmt.Errorf("Queue retry parameters must be greater than zero")
+	}
+	if *queueBaseDelay > *queueMaxDelay {
+		return fmt.Errorf("queue-retry-base-delay (%v) cannot be greater than "+
+			"queue-retry-max-delay (%v)", *queueBaseDelay, *queueMaxDelay)
+	}
+
+	// Providing a kubeconfig or context implies running outside the cluster
+	// unless told otherwise.
+	if (flags.Changed("kubeconfig") || flags.Changed("context")) &&
+		!flags.Changed("running-in-cluster") {
+		*inCluster = false
+	}
+	if *inCluster && flags.Changed("context") {
+		return fmt.Errorf("context cannot be used when running-in-cluster is true")
+	}
+	// The default service CA is only mounted when running in a pod
+	if !*inCluster && !flags.Changed("route-default-server-ca") {
+		*routeServerCA = ""
+	}
+
+	if len(*defaultSecret) > 0 {
+		parts := strings.Split(*defaultSecret, "/")
+		if 2 != len(parts) || 0 == len(parts[0]) || 0 == len(parts[1]) {
+			return fmt.Errorf("Invalid default-ssl-secret '%s', must be "+
+				"namespace/name", *defaultSecret)
+		}
+	}
+
+	if len(*vipTombstoneCM) > 0 {
+		parts := strings.Split(*vipTombstoneCM, "/")
+		if 2 != len(parts) || 0 == len(parts[0]) || 0 == len(parts[1]) {
+			return fmt.Errorf("Invalid vip-tombstone-configmap '%s', must be "+
+				"namespace/name", *vipTombstoneCM)
+		}
+	}
+
+	if !*routeHttpVs && !*routeHttpsVs {
+		return fmt.Errorf("route-http-vserver and route-https-vserver " +
+			"cannot both be disabled")
+	}
+
+	if len(*routeStatusCM) > 0 {
+		parts := strings.Split(*routeStatusCM, "/")
+		if 2 != len(parts) || 0 == len(parts[0]) || 0 == len(parts[1]) {
+			return fmt.Errorf("Invalid route-status-configmap '%s', must be "+
+				"namespace/name", *routeStatusCM)
+		}
+	}
+
+	// Refuse to start rather than watching all Routes
+	if _, err := appmanager.ParseRouteLabel(
+		routeLabelSelector(*routeLabel)); nil != err {
+		return fmt.Errorf("Invalid route-label '%s': %v", *routeLabel, err)
+	}
+
+	if *shardTotal < 1 {
+		return fmt.Errorf("shard-total must be at least 1")
+	}
+	if *shardIndex < 0 || *shardIndex >= *shardTotal {
+		return fmt.Errorf("shard-index (%v) must be between 0 and %v",
+			*shardIndex, *shardTotal-1)
+	}
+
+	crossNamespaceRefs, err = appmanager.ParseCrossNamespaceRefs(*crossNsRefs)
+	if nil != err {
+		return fmt.Errorf("Invalid cross-namespace-ref %v", err)
+	}
+
+	bigipSourceNets, err = appmanager.ParseSourceCIDRs(*bigipSources)
+	if nil != err {
+		return fmt.Errorf("Invalid bigip-source-cidr %v", err)
+	}
+
 	if *poolMemberType == "nodeport" {
 		isNodePort = true
 	} else if *poolMemberType == "cluster" {
@@ -267,6 +772,67 @@ func verifyArgs() error {
 		return fmt.Errorf("'%v' is not a valid Pool Member Type", *poolMemberType)
 	}
 
+	if *nodeMonInterval < 0 || *nodeMonTimeout < 0 {
+		return fmt.Errorf("node-monitor-interval and node-monitor-timeout " +
+			"must not be negative")
+	}
+	if *nodeMonDefault && 0 == *nodeMonInterval {
+		return fmt.Errorf("node-monitor-default-only requires " +
+			"node-monitor-interval")
+	}
+	if *nodeMonInterval > 0 {
+		if !isNodePort {
+			return fmt.Errorf("node-monitor-interval requires " +
+				"pool-member-type nodeport")
+		}
+		if 0 == *nodeMonTimeout {
+			*nodeMonTimeout = 3**nodeMonInterval + 1
+		} else if *nodeMonTimeout <= *nodeMonInterval {
+			return fmt.Errorf("node-monitor-timeout (%v) must be greater than "+
+				"node-monitor-interval (%v)", *nodeMonTimeout, *nodeMonInterval)
+		}
+	}
+
+	if *certMgrTimeout < 0 {
+		return fmt.Errorf("cert-manager-timeout must not be negative")
+	}
+
+	if *epDampening < 0 {
+		return fmt.Errorf("endpoints-dampening must not be negative")
+	}
+
+	if *nsDeleteGrace < 0 {
+		return fmt.Errorf("namespace-delete-grace must not be negative")
+	}
+	if *nsDeleteGrace > 0 && len(*namespaceLabel) == 0 {
+		return fmt.Errorf("namespace-delete-grace requires namespace-label")
+	}
+
+	switch *appliedConfig {
+	case "none", "hash", "config":
+	default:
+		return fmt.Errorf("'%v' is not a valid annotate-applied-config, "+
+			"must be none, hash or config", *appliedConfig)
+	}
+
+	switch *dnsProvider {
+	case "":
+	case "route53", "infoblox":
+		if len(*dnsZone) == 0 {
+			return fmt.Errorf("dns-zone is required with dns-provider")
+		}
+		if *dnsTTL <= 0 {
+			return fmt.Errorf("dns-ttl must be greater than zero")
+		}
+		if *dnsProvider == "infoblox" && (len(*infobloxURL) == 0 ||
+			len(*infobloxUsername) == 0 || len(*infobloxPassword) == 0) {
+			return fmt.Errorf("infoblox-url, infoblox-username and " +
+				"infoblox-password are required for Infoblox")
+		}
+	default:
+		return fmt.Errorf("'%v' is not a valid DNS provider", *dnsProvider)
+	}
+
 	if flags.Changed("openshift-sdn-name") {
 		if len(*openshiftSDNName) == 0 {
 			return fmt.Errorf("Missing required parameter openshift-sdn-name")
@@ -277,6 +843,18 @@ func verifyArgs() error {
 	return nil
 }
 
+// Create the client configuration, either from the pod's service account or
+// from a kubeconfig file and optional context when running outside the cluster
+func getKubeConfig() (*rest.Config, error) {
+	if *inCluster {
+		return rest.InClusterConfig()
+	}
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: *kubeConfig}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: *kubeContext}
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		rules, overrides).ClientConfig()
+}
+
 func setupNodePolling(
 	appMgr *appmanager.Manager,
 	np pollers.Poller,
@@ -311,6 +889,157 @@ func setupNodePolling(
 	return nil
 }
 
+// Muxes of the HTTP endpoints by address. The endpoints given the same
+// address are served from one mux by a single listener, and nothing
+// registered on the default mux is exposed along with them.
+type httpEndpoints map[string]*http.ServeMux
+
+// Mux of the endpoints served at an address
+func (eps httpEndpoints) mux(addr string) *http.ServeMux {
+	mux, ok := eps[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		eps[addr] = mux
+	}
+	return mux
+}
+
+// Start a listener for each address
+func (eps httpEndpoints) serve() {
+	for addr, mux := range eps {
+		go func(addr string, mux *http.ServeMux) {
+			err := http.ListenAndServe(addr, mux)
+			if nil != err {
+				log.Warningf("HTTP listener on %s stopped: %v", addr, err)
+			}
+		}(addr, mux)
+	}
+}
+
+// Whether an address only accepts connections from the controller's host,
+// for the endpoints changing its state without authentication
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if nil != err {
+		return false
+	}
+	if "localhost" == host {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return nil != ip && ip.IsLoopback()
+}
+
+func setupPprof(eps httpEndpoints, addr string) {
+	mux := eps.mux(addr)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	log.Infof("Serving pprof endpoints at %s/debug/pprof/", addr)
+}
+
+// Version and startup settings for the diagnostics bundle, with the BIG-IP
+// password removed
+func diagnosticsInfo() map[string]string {
+	info := map[string]string{
+		"version":   version,
+		"buildInfo": buildInfo,
+		"goVersion": runtime.Version(),
+	}
+	flags.VisitAll(func(f *pflag.Flag) {
+		value := f.Value.String()
+		if ("bigip-password" == f.Name || "infoblox-password" == f.Name) &&
+			"" != value {
+			value = "REDACTED"
+		}
+		info["flag."+f.Name] = value
+	})
+	return info
+}
+
+// Serve a gzipped tarball of the controller's state for support cases
+func setupDiagnostics(
+	eps httpEndpoints,
+	addr string,
+	appMgr *appmanager.Manager,
+) {
+	eps.mux(addr).HandleFunc("/debug/bundle", func(w http.ResponseWriter,
+		r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition",
+			"attachment; filename=\"k8s-bigip-ctlr-diagnostics.tar.gz\"")
+		err := appMgr.WriteDiagnosticsBundle(w, diagnosticsInfo())
+		if nil != err {
+			log.Warningf("Failed to write diagnostics bundle: %v", err)
+		}
+	})
+	log.Infof("Serving diagnostics bundle at %s/debug/bundle", addr)
+}
+
+func setupMetrics(eps httpEndpoints, addr string) {
+	eps.mux(addr).Handle("/metrics", prometheus.Handler())
+	log.Infof("Serving metrics at %s/metrics", addr)
+}
+
+func setupAdmission(addr, cert, key string, appMgr *appmanager.Manager) {
+	mux := http.NewServeMux()
+	mux.Handle("/validate", appMgr.AdmissionHandler())
+	go func() {
+		log.Infof("Serving admission webhook at %s/validate", addr)
+		err := http.ListenAndServeTLS(addr, cert, key, mux)
+		if nil != err {
+			log.Warningf("admission webhook listener on %s stopped: %v",
+				addr, err)
+		}
+	}()
+}
+
+// Serve the change freeze endpoint, to pause and resume the BIG-IP
+// configuration changes
+func setupFreeze(eps httpEndpoints, addr string, appMgr *appmanager.Manager) {
+	eps.mux(addr).Handle("/freeze", appMgr.FreezeHandler())
+	log.Infof("Serving change freeze endpoint at %s/freeze", addr)
+}
+
+// Serve the full resync endpoint, to re-apply the config after manual
+// changes to the BIG-IP
+func setupResync(eps httpEndpoints, addr string, appMgr *appmanager.Manager) {
+	eps.mux(addr).Handle("/resync", appMgr.ResyncHandler())
+	log.Infof("Serving full resync endpoint at %s/resync", addr)
+}
+
+// Create the publisher for the configured DNS provider, nil if none is
+func createDNSPublisher() (*dnspublisher.Publisher, error) {
+	var provider dnspublisher.Provider
+	var err error
+	switch *dnsProvider {
+	case "":
+		return nil, nil
+	case "route53":
+		provider, err = dnspublisher.NewRoute53Provider(dnspublisher.Route53Config{
+			ZoneID:          *dnsZone,
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		})
+	case "infoblox":
+		provider, err = dnspublisher.NewInfobloxProvider(dnspublisher.InfobloxConfig{
+			URL:         *infobloxURL,
+			Username:    *infobloxUsername,
+			Password:    *infobloxPassword,
+			View:        *infobloxView,
+			Zone:        *dnsZone,
+			SSLInsecure: *infobloxInsecure,
+		})
+	}
+	if nil != err {
+		return nil, err
+	}
+	return dnspublisher.NewPublisher(provider, *dnsOwnerID, int64(*dnsTTL)), nil
+}
+
 func createLabel(label string) (labels.Selector, error) {
 	var l labels.Selector
 	var err error
@@ -373,25 +1102,36 @@ func main() {
 		os.Exit(1)
 	}
 
-	appmanager.DEFAULT_PARTITION = (*bigIPPartitions)[0]
+	appmanager.SetPartitions(*defaultPartition, *bigIPPartitions)
+
+	eps := make(httpEndpoints)
+	if len(*pprofAddr) > 0 {
+		setupPprof(eps, *pprofAddr)
+	}
 
 	if _, isSet := os.LookupEnv("SCALE_PERF_ENABLE"); isSet {
 		now := time.Now()
 		log.Infof("SCALE_PERF: Started controller at: %d", now.Unix())
 	}
 
-	configWriter, err := writer.NewConfigWriter()
+	newConfigWriter := writer.NewConfigWriter
+	if *prettyConfig {
+		newConfigWriter = writer.NewIndentedConfigWriter
+	}
+	configWriter, err := newConfigWriter()
 	if nil != err {
 		log.Fatalf("Failed creating ConfigWriter tool: %v", err)
 	}
 	defer configWriter.Stop()
 
-	if len(*routeLabel) > 0 {
-		*routeLabel = fmt.Sprintf("f5type in (%s)", *routeLabel)
-	}
 	var routeConfig = appmanager.RouteConfig{
-		RouteVSAddr: *routeVserverAddr,
-		RouteLabel:  *routeLabel,
+		RouteVSAddr:        *routeVserverAddr,
+		RouteLabel:         routeLabelSelector(*routeLabel),
+		ServerCA:           *routeServerCA,
+		StatusConfigMap:    *routeStatusCM,
+		ExtendedValidation: *routeValidation,
+		DisableHttp:        !*routeHttpVs,
+		DisableHttps:       !*routeHttpsVs,
 	}
 
 	var appMgrParms = appmanager.Params{
@@ -399,6 +1139,47 @@ func main() {
 		UseNodeInternal: *useNodeInternal,
 		IsNodePort:      isNodePort,
 		RouteConfig:     routeConfig,
+		RateLimiter: appmanager.RateLimiterConfig{
+			BaseDelay: *queueBaseDelay,
+			MaxDelay:  *queueMaxDelay,
+			QPS:       *queueQPS,
+		},
+		LogConfigDiff: *logConfigDiff,
+		Shard: appmanager.ShardConfig{
+			Index: *shardIndex,
+			Total: *shardTotal,
+		},
+		NodeMonitor: appmanager.NodeMonitorConfig{
+			Interval:    *nodeMonInterval,
+			Timeout:     *nodeMonTimeout,
+			DefaultOnly: *nodeMonDefault,
+		},
+		CertManagerTimeout:     *certMgrTimeout,
+		ProbeMonitors:          *probeMonitors,
+		ServiceAddress:         *serviceAddress,
+		QueueDepthWarning:      *queueDepthWarn,
+		EndpointsDampening:     *epDampening,
+		ChangeFreeze:           *changeFreeze,
+		NamespaceDefaults:      *nsDefaults,
+		NamespaceDeleteGrace:   *nsDeleteGrace,
+		InitialSyncWorkers:     *initSyncWorkers,
+		InitialSyncDeadline:    *initSyncDeadline,
+		QueueByResource:        *vsQueueKey == "resource",
+		DisableIngressStatus:   !*ingStatus,
+		DisableConfigMapStatus: !*cfgMapStatus,
+		PoolMemberLimit:        *poolMemberLimit,
+		BigIPSourceCIDRs:       bigipSourceNets,
+		DefaultSslSecret:       *defaultSecret,
+		AdmissionSchema:        *admissionSchema,
+		VIPTombstoneConfigMap:  *vipTombstoneCM,
+		ShardDataGroups:        *shardDgs,
+		IRuleTemplateDir:       *iruleTemplateDir,
+		AdoptLegacyNames:       *adoptLegacy,
+		CrossNamespaceRefs:     crossNamespaceRefs,
+		EventSourceComponent:   *eventComponent,
+		ClusterIdentity:        *clusterIdentity,
+		AppliedConfigHash:      *appliedConfig != "none",
+		AppliedConfigBody:      *appliedConfig == "config",
 	}
 
 	gs := globalSection{
@@ -406,10 +1187,12 @@ func main() {
 		VerifyInterval: *verifyInterval,
 	}
 	bs := bigIPSection{
-		BigIPUsername:   *bigIPUsername,
-		BigIPPassword:   *bigIPPassword,
-		BigIPURL:        *bigIPURL,
-		BigIPPartitions: *bigIPPartitions,
+		BigIPUsername:    *bigIPUsername,
+		BigIPPassword:    *bigIPPassword,
+		BigIPURL:         *bigIPURL,
+		BigIPPartitions:  *bigIPPartitions,
+		TrafficGroup:     *trafficGroup,
+		FailoverInterval: *failoverInterval,
 	}
 
 	subPidCh, err := startPythonDriver(configWriter, gs, bs, *pythonBaseDir)
@@ -430,12 +1213,7 @@ func main() {
 		}
 	}(subPid)
 
-	var config *rest.Config
-	if *inCluster {
-		config, err = rest.InClusterConfig()
-	} else {
-		config, err = clientcmd.BuildConfigFromFlags("", *kubeConfig)
-	}
+	config, err := getKubeConfig()
 	if err != nil {
 		log.Fatalf("error creating configuration: %v", err)
 	}
@@ -452,7 +1230,38 @@ func main() {
 		}
 	}
 
+	stopCh := make(chan struct{})
+
+	dnsPublisher, err := createDNSPublisher()
+	if nil != err {
+		log.Fatalf("Failed creating DNS publisher: %v", err)
+	}
+	if nil != dnsPublisher {
+		appMgrParms.DNSPublisher = dnsPublisher
+		go dnsPublisher.Run(stopCh)
+	}
+
+	if len(*otlpEndpoint) > 0 {
+		tracer := tracing.NewTracer(tracing.Config{
+			Endpoint:    *otlpEndpoint,
+			ServiceName: *otlpServiceName,
+		})
+		appMgrParms.Tracer = tracer
+		go tracer.Run(stopCh)
+	}
+
+	if len(*metricsAddr) > 0 {
+		// The queue metrics must be enabled before the queues are created
+		appmanager.EnableQueueMetrics()
+		setupMetrics(eps, *metricsAddr)
+	}
+
 	appMgr := appmanager.NewManager(&appMgrParms)
+	if watchAllNamespaces || 0 != len(*namespaceLabel) {
+		appMgr.CheckStatusPermissions(nil)
+	} else {
+		appMgr.CheckStatusPermissions(*namespaces)
+	}
 
 	if isNodePort || 0 != len(openshiftSDNMode) {
 		intervalFactor := time.Duration(*nodePollInterval)
@@ -469,10 +1278,34 @@ func main() {
 
 	setupWatchers(appMgr, 30*time.Second)
 
-	stopCh := make(chan struct{})
+	if len(*diagnosticsAddr) > 0 {
+		setupDiagnostics(eps, *diagnosticsAddr, appMgr)
+	}
+
+	if len(*admissionAddr) > 0 {
+		setupAdmission(*admissionAddr, *admissionCert, *admissionKey, appMgr)
+	}
+
+	if len(*freezeAddr) > 0 {
+		setupFreeze(eps, *freezeAddr, appMgr)
+	}
+
+	if len(*resyncAddr) > 0 {
+		setupResync(eps, *resyncAddr, appMgr)
+	}
+	eps.serve()
 
 	appMgr.Run(stopCh)
 
+	// SIGUSR1 requests a full resync, like the resync endpoint
+	resyncSigs := make(chan os.Signal, 1)
+	signal.Notify(resyncSigs, syscall.SIGUSR1)
+	go func() {
+		for range resyncSigs {
+			appMgr.Resync()
+		}
+	}()
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 	sig := <-sigs
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/appmanager"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/dnspublisher"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -60,6 +61,8 @@ var _ = Describe("Main Tests", func() {
 					"openshift",
 					"marathon",
 				},
+				TrafficGroup:     "traffic-group-1",
+				FailoverInterval: 5,
 			},
 			Global: globalSection{
 				LogLevel:       "WARNING",
@@ -374,6 +377,742 @@ var _ = Describe("Main Tests", func() {
 		Expect(err).ToNot(BeNil())
 	})
 
+	It("verifies pprof args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--pprof-address=127.0.0.1:6060",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*pprofAddr).To(Equal("127.0.0.1:6060"))
+
+		*pprofAddr = "localhost"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "pprof-address should require a port.")
+
+		*pprofAddr = ""
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+	})
+
+	It("verifies failover args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--bigip-traffic-group=traffic-group-1",
+			"--failover-interval=5",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*trafficGroup).To(Equal("traffic-group-1"))
+		Expect(*failoverInterval).To(Equal(5))
+
+		*failoverInterval = -1
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "failover-interval should not be negative.")
+	})
+
+	It("verifies queue metrics args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--metrics-address=0.0.0.0:9090",
+			"--queue-depth-warning=500",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*metricsAddr).To(Equal("0.0.0.0:9090"))
+		Expect(*queueDepthWarn).To(Equal(500))
+
+		*metricsAddr = "localhost"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "metrics-address should require a port.")
+
+		*metricsAddr = ""
+		*queueDepthWarn = -1
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "queue-depth-warning should not be negative.")
+
+		*queueDepthWarn = 0
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+	})
+
+	It("verifies initial sync args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--initial-sync-workers=8",
+			"--initial-sync-deadline=2m",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*initSyncWorkers).To(Equal(8))
+		Expect(*initSyncDeadline).To(Equal(2 * time.Minute))
+
+		*initSyncWorkers = 0
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "initial-sync-workers should be positive.")
+
+		*initSyncWorkers = 1
+		*initSyncDeadline = -time.Second
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(),
+			"initial-sync-deadline should not be negative.")
+
+		*initSyncDeadline = 0
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+	})
+
+	It("verifies the vs queue key arg", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--vs-queue-key=resource",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*vsQueueKey).To(Equal("resource"))
+
+		*vsQueueKey = "ingress"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "vs-queue-key should be valid.")
+	})
+
+	It("verifies tracing args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--otlp-endpoint=http://otel-collector:4318/v1/traces",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*otlpEndpoint).To(Equal("http://otel-collector:4318/v1/traces"))
+		Expect(*otlpServiceName).To(Equal("k8s-bigip-ctlr"))
+
+		*otlpEndpoint = "otel-collector:4318"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "otlp-endpoint should be an http URL.")
+	})
+
+	It("verifies cross-namespace reference args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=edge",
+			"--namespace=team-a",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--cross-namespace-ref=edge=team-a,team-b",
+			"--cross-namespace-ref=ops=*",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(crossNamespaceRefs).To(Equal(map[string][]string{
+			"edge": []string{"team-a", "team-b"},
+			"ops":  []string{"*"},
+		}))
+
+		*crossNsRefs = []string{"edge"}
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "cross-namespace-ref needs targets.")
+
+		*crossNsRefs = []string{"edge=team-a,"}
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "targets should not be empty.")
+	})
+
+	It("verifies bigip source cidr args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--bigip-source-cidr=10.1.0.0/24",
+			"--bigip-source-cidr=10.2.0.5/32",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(bigipSourceNets).To(HaveLen(2))
+		Expect(bigipSourceNets[0].String()).To(Equal("10.1.0.0/24"))
+		Expect(bigipSourceNets[1].String()).To(Equal("10.2.0.5/32"))
+
+		*bigipSources = []string{"10.2.0.5"}
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "bigip-source-cidr must be a CIDR.")
+	})
+
+	It("verifies default ssl secret args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--default-ssl-secret=kube-system/wildcard",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*defaultSecret).To(Equal("kube-system/wildcard"))
+
+		*defaultSecret = "wildcard"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "default-ssl-secret needs a namespace.")
+	})
+
+	It("verifies admission webhook args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--admission-address=0.0.0.0:8443",
+			"--admission-tls-cert=/etc/webhook/tls.crt",
+			"--admission-tls-key=/etc/webhook/tls.key",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*admissionAddr).To(Equal("0.0.0.0:8443"))
+		Expect(*admissionCert).To(Equal("/etc/webhook/tls.crt"))
+		Expect(*admissionKey).To(Equal("/etc/webhook/tls.key"))
+
+		*admissionAddr = "localhost"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "admission-address should require a port.")
+
+		*admissionAddr = "0.0.0.0:8443"
+		*admissionKey = ""
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "admission-address should require a key.")
+
+		*admissionKey = "/etc/webhook/tls.key"
+		*metricsAddr = "0.0.0.0:8443"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(),
+			"admission-address should not be shared with other endpoints.")
+		*metricsAddr = ""
+
+		*admissionAddr = ""
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+	})
+
+	It("verifies change freeze args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--freeze-address=127.0.0.1:8090",
+			"--change-freeze=true",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*freezeAddr).To(Equal("127.0.0.1:8090"))
+		Expect(*changeFreeze).To(BeTrue())
+
+		*freezeAddr = "localhost"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "freeze-address should require a port.")
+
+		*freezeAddr = "0.0.0.0:8090"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "freeze-address should be a loopback address.")
+
+		*freezeAddr = "[::1]:8090"
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+	})
+
+	It("verifies diagnostics args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--diagnostics-address=127.0.0.1:8092",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*diagnosticsAddr).To(Equal("127.0.0.1:8092"))
+
+		*diagnosticsAddr = "10.0.0.1:8092"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(),
+			"diagnostics-address should be a loopback address.")
+	})
+
+	It("verifies resync args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--resync-address=127.0.0.1:8091",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*resyncAddr).To(Equal("127.0.0.1:8091"))
+
+		*resyncAddr = "localhost"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "resync-address should require a port.")
+
+		*resyncAddr = "10.0.0.1:8091"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "resync-address should be a loopback address.")
+
+		*resyncAddr = "localhost:8091"
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+	})
+
+	It("verifies queue retry args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*queueBaseDelay).To(Equal(appmanager.DefaultQueueBaseDelay))
+		Expect(*queueMaxDelay).To(Equal(appmanager.DefaultQueueMaxDelay))
+		Expect(*queueQPS).To(Equal(appmanager.DefaultQueueQPS))
+
+		os.Args = append(os.Args,
+			"--queue-retry-base-delay=100ms",
+			"--queue-retry-max-delay=30s",
+			"--queue-retry-qps=50",
+		)
+		flags.Parse(os.Args)
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*queueBaseDelay).To(Equal(100 * time.Millisecond))
+		Expect(*queueMaxDelay).To(Equal(30 * time.Second))
+		Expect(*queueQPS).To(Equal(float64(50)))
+
+		*queueBaseDelay = time.Minute
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Base delay should not exceed max delay.")
+
+		*queueBaseDelay = 100 * time.Millisecond
+		*queueQPS = 0
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "QPS must be positive.")
+	})
+
+	It("verifies shard args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--shard-index=1",
+			"--shard-total=3",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*shardIndex).To(Equal(1))
+		Expect(*shardTotal).To(Equal(3))
+
+		*shardIndex = 3
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Shard index must be less than shard total.")
+
+		*shardIndex = 0
+		*shardTotal = 0
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Shard total must be positive.")
+	})
+
+	It("verifies route label args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--route-label=App1,app2",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(routeLabelSelector(*routeLabel)).To(Equal("f5type in (App1,app2)"))
+
+		*routeLabel = "app 1"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Route label must be a valid selector.")
+	})
+
+	It("verifies route virtual server args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--route-http-vserver=false",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*routeHttpVs).To(BeFalse())
+		Expect(*routeHttpsVs).To(BeTrue())
+
+		*routeHttpsVs = false
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "A route virtual server must be enabled.")
+	})
+
+	It("verifies node monitor args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--node-monitor-interval=5",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*nodeMonInterval).To(Equal(5))
+		Expect(*nodeMonTimeout).To(Equal(16))
+
+		*nodeMonTimeout = 5
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Timeout must be greater than interval.")
+
+		*nodeMonTimeout = 0
+		*poolMemberType = "cluster"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Node monitor requires nodeport mode.")
+
+		*poolMemberType = "nodeport"
+		*nodeMonDefault = true
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+		*nodeMonInterval = 0
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Default node monitor requires an interval.")
+	})
+
+	It("verifies default partition args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-partition=velcro2",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*defaultPartition).To(Equal("velcro1"))
+
+		*defaultPartition = "velcro2"
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*defaultPartition).To(Equal("velcro2"))
+
+		*defaultPartition = "velcro3"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Default partition must be managed.")
+	})
+
+	It("verifies cert-manager timeout args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*certMgrTimeout).To(Equal(appmanager.DefaultCertManagerTimeout))
+
+		*certMgrTimeout = -time.Second
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Timeout must not be negative.")
+	})
+
+	It("verifies endpoints dampening args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--endpoints-dampening=500ms",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*epDampening).To(Equal(500 * time.Millisecond))
+
+		*epDampening = -time.Second
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Dampening must not be negative.")
+	})
+
+	It("verifies namespace delete grace args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--namespace-label=watching",
+			"--namespace-delete-grace=1h",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*nsDeleteGrace).To(Equal(time.Hour))
+
+		*nsDeleteGrace = -time.Second
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Grace period must not be negative.")
+
+		*nsDeleteGrace = time.Hour
+		*namespaceLabel = ""
+		*namespaces = []string{"default"}
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Grace period requires namespace-label.")
+	})
+
+	It("verifies the applied config annotations arg", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--namespace=testing",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*appliedConfig).To(Equal("none"))
+
+		*appliedConfig = "config"
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+
+		*appliedConfig = "all"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "annotate-applied-config should be valid.")
+	})
+
+	It("verifies DNS args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--dns-provider=infoblox",
+			"--dns-zone=example.com",
+			"--infoblox-url=https://infoblox.example.com/wapi/v2.5",
+			"--infoblox-username=admin",
+			"--infoblox-password=secret",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*dnsTTL).To(Equal(dnspublisher.DefaultTTL))
+		Expect(*infobloxView).To(Equal(dnspublisher.DefaultInfobloxView))
+		publisher, err := createDNSPublisher()
+		Expect(err).To(BeNil())
+		Expect(publisher).ToNot(BeNil())
+
+		*infobloxPassword = ""
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Infoblox credentials are required.")
+
+		*dnsProvider = "route53"
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+		*dnsZone = ""
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "A zone is required.")
+
+		*dnsZone = "Z1D633PJN98FT9"
+		*dnsTTL = 0
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "TTL must be positive.")
+
+		*dnsTTL = 30
+		*dnsProvider = "bind"
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Provider must be known.")
+
+		*dnsProvider = ""
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+		publisher, err = createDNSPublisher()
+		Expect(err).To(BeNil())
+		Expect(publisher).To(BeNil())
+	})
+
+	It("verifies kubeconfig context args", func() {
+		defer _init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--kubeconfig=/tmp/kubeconfig",
+			"--context=dev",
+		}
+
+		flags.Parse(os.Args)
+		err := verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*inCluster).To(BeFalse())
+		Expect(*kubeContext).To(Equal("dev"))
+		Expect(*routeServerCA).To(Equal(""))
+
+		_init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+			"--running-in-cluster=true",
+			"--context=dev",
+		}
+
+		flags.Parse(os.Args)
+		err = verifyArgs()
+		Expect(err).ToNot(BeNil(), "Context cannot be used in cluster.")
+
+		_init()
+		os.Args = []string{
+			"./bin/k8s-bigip-ctlr",
+			"--bigip-partition=velcro1",
+			"--bigip-password=admin",
+			"--bigip-url=bigip.example.com",
+			"--bigip-username=admin",
+		}
+
+		flags.Parse(os.Args)
+		err = verifyArgs()
+		Expect(err).To(BeNil())
+		Expect(*inCluster).To(BeTrue())
+		Expect(*routeServerCA).To(Equal(appmanager.DefaultServerCAPath))
+	})
+
 	It("sets up the node poller", func() {
 		defer _init()
 		os.Args = []string{
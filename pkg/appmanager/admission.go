@@ -0,0 +1,470 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"github.com/xeipuuv/gojsonschema"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// ConfigMap schema the annotations of Ingresses are validated against by
+// default, the latest one shipped with the controller
+const DefaultAdmissionSchema = "f5schemadb://bigip-virtual-server_v0.1.12.json"
+
+// Schema of the load balancing mode of a pool, from the frontend of a
+// ConfigMap schema
+func balanceSchema(schemaName string) (*gojsonschema.Schema, error) {
+	doc, err := gojsonschema.NewReferenceLoader(
+		schemaReference(schemaName)).LoadJSON()
+	if nil != err {
+		return nil, err
+	}
+	node := doc
+	for _, name := range []string{
+		"definitions", "frontendVSType", "properties", "balance"} {
+		obj, ok := node.(map[string]interface{})
+		if !ok {
+			node = nil
+			break
+		}
+		node = obj[name]
+	}
+	if nil == node {
+		return nil, fmt.Errorf("schema %v has no balance mode", schemaName)
+	}
+	return gojsonschema.NewSchema(gojsonschema.NewGoLoader(node))
+}
+
+// Whether a load balancing mode is valid in the schema of the admission
+// webhook. Modes cannot be checked without the schema, which is logged.
+func (appMgr *Manager) validBalanceMode(mode string) bool {
+	schema, err := balanceSchema(appMgr.admissionSchema)
+	if nil != err {
+		log.Warningf("Unable to load the admission schema '%v': %v",
+			appMgr.admissionSchema, err)
+		return true
+	}
+	result, err := schema.Validate(gojsonschema.NewGoLoader(mode))
+	return nil != err || result.Valid()
+}
+
+// Handler for the requests of a ValidatingAdmissionWebhook. ConfigMaps,
+// Ingresses and Routes with invalid F5 annotations or data are rejected
+// with the problems found, instead of being ignored at sync time.
+// Resources the controller does not manage are always allowed.
+func (appMgr *Manager) AdmissionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var review admissionReview
+		err := json.NewDecoder(r.Body).Decode(&review)
+		if nil != err || nil == review.Request {
+			http.Error(w, fmt.Sprintf("Invalid AdmissionReview: %v", err),
+				http.StatusBadRequest)
+			return
+		}
+		resp := &admissionResponse{UID: review.Request.UID, Allowed: true}
+		problems, err := appMgr.validateAdmission(review.Request)
+		if nil != err {
+			problems = append(problems, err.Error())
+		}
+		if 0 != len(problems) {
+			log.Infof("Rejecting %v %v/%v: %v", review.Request.Kind.Kind,
+				review.Request.Namespace, review.Request.Name,
+				strings.Join(problems, "; "))
+			resp.Allowed = false
+			resp.Result = &metav1.Status{
+				Status:  metav1.StatusFailure,
+				Message: strings.Join(problems, "; "),
+				Reason:  metav1.StatusReasonInvalid,
+				Code:    http.StatusUnprocessableEntity,
+			}
+		}
+		review.Request = nil
+		review.Response = resp
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(review)
+	})
+}
+
+func (appMgr *Manager) validateAdmission(req *admissionRequest) ([]string, error) {
+	if "DELETE" == req.Operation || 0 == len(req.Object) {
+		return nil, nil
+	}
+	appInf, ok := appMgr.getNamespaceInformer(req.Namespace)
+	if !ok {
+		// Not watching this namespace
+		return nil, nil
+	}
+	switch req.Kind.Kind {
+	case "ConfigMap":
+		var cm v1.ConfigMap
+		err := json.Unmarshal(req.Object, &cm)
+		if nil != err {
+			return nil, err
+		}
+		return appMgr.validateConfigMap(appInf, &cm), nil
+	case "Ingress":
+		var ing v1beta1.Ingress
+		err := json.Unmarshal(req.Object, &ing)
+		if nil != err {
+			return nil, err
+		}
+		return appMgr.validateIngress(&ing), nil
+	case "Route":
+		// Only the annotations of a Route are checked, which does not need
+		// the conversion to the internal Route type
+		var route struct {
+			ObjectMeta metav1.ObjectMeta `json:"metadata"`
+		}
+		err := json.Unmarshal(req.Object, &route)
+		if nil != err {
+			return nil, err
+		}
+		problems := validateAnnotations(route.ObjectMeta.Annotations)
+		if val, ok := route.ObjectMeta.Annotations[routeExtraPortsAnnotation]; ok {
+			if _, err := parseRouteExtraPorts(val); nil != err {
+				problems = append(problems, fmt.Sprintf(
+					"annotation %v is not valid: %v", routeExtraPortsAnnotation, err))
+			}
+		}
+		if val, ok := route.ObjectMeta.Annotations[routeProtocolsAnnotation]; ok {
+			if _, err := parseRouteProtocols(val); nil != err {
+				problems = append(problems, fmt.Sprintf(
+					"annotation %v is not valid: %v", routeProtocolsAnnotation, err))
+			}
+		}
+		return problems, nil
+	}
+	return nil, nil
+}
+
+func (appMgr *Manager) validateConfigMap(
+	appInf *appInformer,
+	cm *v1.ConfigMap,
+) []string {
+	if !appInf.cfgMapSelector.Matches(labels.Set(cm.ObjectMeta.Labels)) {
+		return nil
+	}
+	problems := validateAnnotations(cm.ObjectMeta.Annotations)
+	for _, def := range parseConfigMapDefinitions(cm) {
+		if nil != def.Err {
+			problems = append(problems, def.Err.Error())
+			continue
+		}
+		cfg := def.Cfg
+		addr := cfg.Virtual.VirtualAddress
+		if nil == addr || "" == addr.BindAddr {
+			continue
+		}
+		if holder := appMgr.virtualAddressHolder(
+			cfg.Virtual.VirtualServerName, addr.BindAddr, addr.Port); "" != holder {
+			problems = append(problems, fmt.Sprintf(
+				"virtual address %v:%v is already used by %v",
+				addr.BindAddr, addr.Port, holder))
+		}
+	}
+	return problems
+}
+
+func (appMgr *Manager) validateIngress(ing *v1beta1.Ingress) []string {
+	annotations := ing.ObjectMeta.Annotations
+	if class, ok := annotations["kubernetes.io/ingress.class"]; ok && class != "f5" {
+		return nil
+	}
+	problems := validateAnnotations(annotations)
+	bindAddr, ok := annotations["virtual-server.f5.com/ip"]
+	if ok && nil == net.ParseIP(bindAddr) {
+		problems = append(problems, fmt.Sprintf(
+			"annotation virtual-server.f5.com/ip must be an IP address, not '%v'",
+			bindAddr))
+	}
+	for _, name := range []string{
+		"virtual-server.f5.com/http-port", "virtual-server.f5.com/https-port"} {
+		if val, ok := annotations[name]; ok {
+			port, err := strconv.Atoi(val)
+			if nil != err || port < 1 || port > 65535 {
+				problems = append(problems, fmt.Sprintf(
+					"annotation %v must be a port between 1 and 65535, not '%v'",
+					name, val))
+			}
+		}
+	}
+	if val, ok := annotations["virtual-server.f5.com/balance"]; ok && !appMgr.validBalanceMode(val) {
+		problems = append(problems, fmt.Sprintf(
+			"annotation virtual-server.f5.com/balance has invalid mode '%v'", val))
+	}
+	if val, ok := annotations[ingHealthMonitorAnnotation]; ok {
+		var monitors IngressHealthMonitors
+		if err := json.Unmarshal([]byte(val), &monitors); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v", ingHealthMonitorAnnotation, err))
+		}
+		for _, mon := range monitors {
+			if err := validateIngressHealthMonitor(mon); nil != err {
+				problems = append(problems, fmt.Sprintf(
+					"annotation %v is not valid: %v", ingHealthMonitorAnnotation, err))
+				break
+			}
+		}
+	}
+	if val, ok := annotations[ingressHeaderRulesAnnotation]; ok {
+		if _, err := parseIngressHeaderRules(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v", ingressHeaderRulesAnnotation, err))
+		}
+	}
+	if val, ok := annotations[preserveVIPAnnotation]; ok {
+		if _, err := parsePreserveVIP(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v", preserveVIPAnnotation, err))
+		}
+	}
+	if val, ok := annotations[allowedMethodsAnnotation]; ok {
+		if _, err := parseAllowedMethods(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v", allowedMethodsAnnotation, err))
+		}
+	}
+	if 0 != len(problems) || "" == bindAddr {
+		return problems
+	}
+	addresses := appMgr.indexIngressAddresses()
+	for _, ps := range appMgr.virtualPorts(ing) {
+		if other := appMgr.ingressAddressConflict(addresses, ing, bindAddr, ps.port); nil != other {
+			problems = append(problems, fmt.Sprintf(
+				"virtual address %v:%v conflicts with Ingress %v/%v",
+				bindAddr, ps.port, other.ObjectMeta.Namespace, other.ObjectMeta.Name))
+		}
+	}
+	return problems
+}
+
+// Check the annotations that apply to all kinds of resources
+func validateAnnotations(annotations map[string]string) []string {
+	var problems []string
+	if val, ok := annotations[poolServiceDownAnnotation]; ok {
+		switch strings.ToLower(val) {
+		case "none", "reset", "drop", "reselect":
+		default:
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be one of: none, reset, drop, reselect",
+				poolServiceDownAnnotation))
+		}
+	}
+	if val, ok := annotations[poolReselectTriesAnnotation]; ok {
+		t, err := strconv.Atoi(val)
+		if nil != err || t < 0 || t > 65535 {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be an integer between 0 and 65535",
+				poolReselectTriesAnnotation))
+		}
+	}
+	if val, ok := annotations[poolMemberTypeAnnotation]; ok {
+		switch strings.ToLower(val) {
+		case "nodeport", "cluster":
+		default:
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be one of: nodeport, cluster",
+				poolMemberTypeAnnotation))
+		}
+	}
+	if val, ok := annotations[poolMemberLimitAnnotation]; ok {
+		if _, err := parsePoolMemberLimit(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be an integer greater than zero",
+				poolMemberLimitAnnotation))
+		}
+	}
+	if val, ok := annotations[ipv6AddrAnnotation]; ok && !isIPv6(val) {
+		problems = append(problems, fmt.Sprintf(
+			"annotation %v must be an IPv6 address", ipv6AddrAnnotation))
+	}
+	if val, ok := annotations[fallbackPoolAnnotation]; ok {
+		if _, _, ok := splitBigIPPath(val); !ok {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be a full path like /Common/sorry-pool",
+				fallbackPoolAnnotation))
+		}
+	}
+	if val, ok := annotations[activeScheduleAnnotation]; ok {
+		if _, err := parseActiveSchedule(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v",
+				activeScheduleAnnotation, err))
+		}
+	}
+	if val, ok := annotations[maintenanceStatusAnnotation]; ok {
+		if _, err := parseMaintenanceStatus(val); nil != err {
+			problems = append(problems, fmt.Sprintf("annotation %v %v",
+				maintenanceStatusAnnotation, err))
+		}
+	}
+	if val, ok := annotations[circuitBreakerAnnotation]; ok {
+		if _, err := parseCircuitBreaker(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v",
+				circuitBreakerAnnotation, err))
+		}
+	}
+	if val, ok := annotations[analyticsProfileAnnotation]; ok {
+		if _, _, ok := splitBigIPPath(strings.TrimSpace(val)); !ok {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be a full path like /Common/analytics",
+				analyticsProfileAnnotation))
+		}
+	}
+	if val, ok := annotations[dosProfileAnnotation]; ok {
+		if _, _, ok := splitBigIPPath(strings.TrimSpace(val)); !ok {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be a full path like /Common/dos",
+				dosProfileAnnotation))
+		}
+	}
+	if val, ok := annotations[sourcePortAnnotation]; ok {
+		if _, err := parseSourcePort(val); nil != err {
+			problems = append(problems, fmt.Sprintf("annotation %v %v",
+				sourcePortAnnotation, err))
+		}
+	}
+	if val, ok := annotations[vsPreserveFieldsAnnotation]; ok {
+		for _, field := range strings.Split(val, ",") {
+			field = strings.TrimSpace(field)
+			if "" != field && !preservableFields[field] {
+				problems = append(problems, fmt.Sprintf(
+					"annotation %v cannot preserve the field %v",
+					vsPreserveFieldsAnnotation, field))
+			}
+		}
+	}
+	if val, ok := annotations[transparentAnnotation]; ok {
+		if _, err := strconv.ParseBool(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be a boolean", transparentAnnotation))
+		}
+	}
+	if val, ok := annotations[oneConnectProfileAnnotation]; ok {
+		if _, _, ok := splitBigIPPath(val); !ok {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be a full path like /Common/oneconnect",
+				oneConnectProfileAnnotation))
+		}
+	}
+	if val, ok := annotations[oneConnectOptionsAnnotation]; ok {
+		if _, err := parseOneConnectOptions(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v",
+				oneConnectOptionsAnnotation, err))
+		}
+	}
+	if val, ok := annotations[bandwidthPolicyAnnotation]; ok {
+		val = strings.TrimSpace(val)
+		if _, _, ok := splitBigIPPath(val); !ok && val != "none" {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be a full path like /Common/bwc-10mbps "+
+					"or none", bandwidthPolicyAnnotation))
+		}
+	}
+	if val, ok := annotations[clonePoolsAnnotation]; ok {
+		if _, err := parseClonePools(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v", clonePoolsAnnotation, err))
+		}
+	}
+	if val, ok := annotations[iRulesAnnotation]; ok {
+		if _, err := parseIRuleRefs(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v", iRulesAnnotation, err))
+		}
+	}
+	if val, ok := annotations[accessProfileAnnotation]; ok {
+		if _, _, ok := splitBigIPPath(val); !ok {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be a full path like /Common/access",
+				accessProfileAnnotation))
+		}
+	}
+	if val, ok := annotations[perRequestPolicyAnnotation]; ok {
+		val = strings.TrimSpace(val)
+		if _, _, ok := splitBigIPPath(val); !ok && val != "none" {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v must be a full path like /Common/per-request "+
+					"or none", perRequestPolicyAnnotation))
+		}
+	}
+	if val, ok := annotations[hostRedirectsAnnotation]; ok {
+		if _, err := parseHostRedirects(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v", hostRedirectsAnnotation, err))
+		}
+	}
+	if val, ok := annotations[hostRedirectCodeAnnotation]; ok {
+		if _, err := parseHostRedirectCode(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v %v", hostRedirectCodeAnnotation, err))
+		}
+	}
+	if val, ok := annotations[universalPersistenceAnnotation]; ok &&
+		"none" != strings.TrimSpace(val) {
+		if _, _, err := parseUniversalPersistence(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v %v", universalPersistenceAnnotation, err))
+		}
+	}
+	if val, ok := annotations[universalPersistenceTimeoutAnnotation]; ok {
+		if _, err := parseUniversalPersistenceTimeout(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v %v", universalPersistenceTimeoutAnnotation, err))
+		}
+	}
+	if val, ok := annotations[serviceNamespacesAnnotation]; ok {
+		if _, err := parseServiceNamespaces(val); nil != err {
+			problems = append(problems, fmt.Sprintf(
+				"annotation %v is not valid: %v", serviceNamespacesAnnotation,
+				err))
+		}
+	}
+	return problems
+}
+
+// Name of another virtual server using the address and port, empty if none
+func (appMgr *Manager) virtualAddressHolder(
+	vsName, bindAddr string,
+	port int32,
+) string {
+	var holder string
+	appMgr.resources.Lock()
+	defer appMgr.resources.Unlock()
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		addr := cfg.Virtual.VirtualAddress
+		if cfg.Virtual.VirtualServerName != vsName && nil != addr &&
+			addr.BindAddr == bindAddr && addr.Port == port {
+			holder = cfg.Virtual.VirtualServerName
+		}
+	})
+	return holder
+}
@@ -0,0 +1,209 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Kinds of the BIG-IP objects the driver migrates
+const (
+	adoptClientSsl = "clientSsl"
+	adoptServerSsl = "serverSsl"
+)
+
+// Suffixes of the names of the Route profiles of each kind
+var adoptedProfileSuffixes = map[string]string{
+	adoptClientSsl: "-https-cert",
+	adoptServerSsl: "-server-ssl",
+}
+
+// Time an adoption keeps being written after its first successful write.
+// The driver replaces the legacy object in the first apply of the config,
+// the adoption is kept for the configs it skips while newer ones are written
+// and for the applies it retries.
+const adoptionPeriod = 10 * time.Minute
+
+var legacyNameAdoptions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Subsystem: "bigip",
+	Name:      "legacy_name_adoptions",
+	Help: "Number of objects written with the name of an earlier " +
+		"controller version in the last config, by partition.",
+}, []string{"partition"})
+
+// A BIG-IP object an earlier controller version named differently. The
+// driver reports the migration of the object, replaced by its new name
+// before its legacy one is deleted.
+type Adoption struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	LegacyName string `json:"legacyName"`
+}
+
+// Adoptions of the objects of a partition renamed by a naming scheme change
+type legacyNamingScheme func(cfg *BigIPConfig) []Adoption
+
+// Naming scheme changes between controller versions, oldest first
+var legacyNamingSchemes = []legacyNamingScheme{
+	routeProfilesBeforeEscaping,
+}
+
+// Before the parts of the Route rule and profile names were escaped, the
+// profiles of a Route with dots in its name kept them as-is
+func routeProfilesBeforeEscaping(cfg *BigIPConfig) []Adoption {
+	var adoptions []Adoption
+	for _, prof := range cfg.CustomProfiles {
+		kind, namespace, name, ok := routeProfileOwner(prof.Name)
+		if !ok {
+			continue
+		}
+		legacyName := routeRuleNamePrefix + namespace + "_" + name +
+			adoptedProfileSuffixes[kind]
+		if legacyName != prof.Name {
+			adoptions = append(adoptions, Adoption{
+				Kind:       kind,
+				Name:       prof.Name,
+				LegacyName: legacyName,
+			})
+		}
+	}
+	return adoptions
+}
+
+// Kind of a Route profile, and the namespace and name of its Route
+func routeProfileOwner(profile string) (string, string, string, bool) {
+	for kind, suffix := range adoptedProfileSuffixes {
+		if !strings.HasSuffix(profile, suffix) {
+			continue
+		}
+		namespace, name, ok := parseRouteRuleName(
+			strings.TrimSuffix(profile, suffix))
+		return kind, namespace, name, ok
+	}
+	return "", "", "", false
+}
+
+// Add the legacy names of the objects of each partition, so the driver
+// takes over the objects created by an earlier controller version after an
+// upgrade
+func addAdoptions(resources PartitionMap) {
+	for _, cfg := range resources {
+		var adoptions []Adoption
+		for _, scheme := range legacyNamingSchemes {
+			adoptions = append(adoptions, scheme(cfg)...)
+		}
+		sort.Sort(adoptionsByName(adoptions))
+		cfg.Adoptions = adoptions
+	}
+}
+
+type adoptionsByName []Adoption
+
+func (slice adoptionsByName) Len() int {
+	return len(slice)
+}
+
+func (slice adoptionsByName) Less(i, j int) bool {
+	return slice[i].Kind < slice[j].Kind ||
+		(slice[i].Kind == slice[j].Kind && slice[i].Name < slice[j].Name)
+}
+
+func (slice adoptionsByName) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// An adoption in a partition
+type adoptionKey struct {
+	Partition string
+	Adoption
+}
+
+// Add the adoptions of the objects of each partition, leaving out those
+// written for longer than the adoption period, whose legacy objects are
+// gone. The adoptions of removed objects are forgotten.
+func (appMgr *Manager) addPendingAdoptions(
+	resources PartitionMap,
+	now time.Time,
+) {
+	addAdoptions(resources)
+	current := make(map[adoptionKey]bool)
+	for partition, cfg := range resources {
+		var pending []Adoption
+		for _, adoption := range cfg.Adoptions {
+			key := adoptionKey{Partition: partition, Adoption: adoption}
+			current[key] = true
+			written, ok := appMgr.adoptionsWritten[key]
+			if ok && now.Sub(written) > adoptionPeriod {
+				continue
+			}
+			pending = append(pending, adoption)
+		}
+		cfg.Adoptions = pending
+	}
+	for key := range appMgr.adoptionsWritten {
+		if !current[key] {
+			delete(appMgr.adoptionsWritten, key)
+		}
+	}
+}
+
+// Count the adoptions of a successful write, and record an Event on the
+// Route of each adoption written for the first time
+func (appMgr *Manager) recordAdoptions(resources PartitionMap, now time.Time) {
+	legacyNameAdoptions.Reset()
+	for partition, cfg := range resources {
+		legacyNameAdoptions.WithLabelValues(partition).Set(
+			float64(len(cfg.Adoptions)))
+		for _, adoption := range cfg.Adoptions {
+			key := adoptionKey{Partition: partition, Adoption: adoption}
+			if _, ok := appMgr.adoptionsWritten[key]; ok {
+				continue
+			}
+			appMgr.adoptionsWritten[key] = now
+			appMgr.recordAdoptionEvent(adoption)
+		}
+	}
+}
+
+// Record an Event on the Route of an adopted profile, if it is still there
+func (appMgr *Manager) recordAdoptionEvent(adoption Adoption) {
+	_, namespace, name, ok := routeProfileOwner(adoption.Name)
+	if !ok {
+		return
+	}
+	appInf, ok := appMgr.getNamespaceInformer(namespace)
+	if !ok || nil == appInf.routeInformer {
+		return
+	}
+	obj, found, err := appInf.routeInformer.GetIndexer().GetByKey(
+		namespace + "/" + name)
+	if nil != err || !found {
+		return
+	}
+	appMgr.recordRouteEvent(obj.(*routeapi.Route), v1.EventTypeNormal,
+		"LegacyNameAdopted", fmt.Sprintf("Profile '%s' replaces the profile "+
+			"'%s' of an earlier controller version.", adoption.Name,
+			adoption.LegacyName))
+}
@@ -0,0 +1,110 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Parse the allowed methods annotation, a comma-separated list of HTTP
+// methods. Methods are case-sensitive on the wire, they are upper-cased as
+// all standard methods are.
+func parseAllowedMethods(val string) ([]string, error) {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, m := range strings.Split(val, ",") {
+		m = strings.ToUpper(strings.TrimSpace(m))
+		if "" == m {
+			continue
+		}
+		for _, c := range m {
+			if c < 'A' || c > 'Z' {
+				return nil, fmt.Errorf("invalid method '%s'", m)
+			}
+		}
+		if !seen[m] {
+			seen[m] = true
+			methods = append(methods, m)
+		}
+	}
+	if 0 == len(methods) {
+		return nil, fmt.Errorf("no methods listed")
+	}
+	return methods, nil
+}
+
+// Reset the requests of an Ingress whose method is not in its allow-list.
+// The rule is evaluated before all other rules of the Ingress's policy, so
+// requests with other methods never reach a pool.
+func setIngressAllowedMethods(
+	cfg *ResourceConfig,
+	annotations map[string]string,
+	resourceName string,
+) {
+	val, ok := annotations[allowedMethodsAnnotation]
+	if !ok {
+		return
+	}
+	methods, err := parseAllowedMethods(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, allowedMethodsAnnotation, resourceName, err)
+		return
+	}
+	if strings.ToLower(cfg.Virtual.Mode) != "http" {
+		log.Warningf("Annotation %v on '%v' is ignored, it requires an "+
+			"http virtual server", allowedMethodsAnnotation, resourceName)
+		return
+	}
+
+	rules := Rules{createMethodRule(methods)}
+	policyName := cfg.Virtual.VirtualServerName
+	for _, pol := range cfg.Policies {
+		if pol.Name == policyName {
+			rules = append(rules, pol.Rules...)
+			break
+		}
+	}
+	for i, rl := range rules {
+		rl.Ordinal = i
+		rl.Name = strconv.Itoa(i)
+	}
+	cfg.SetPolicy(*createPolicy(rules, policyName, cfg.Virtual.Partition))
+}
+
+func createMethodRule(methods []string) *Rule {
+	return &Rule{
+		Actions: []*action{{
+			Name:    "0",
+			Forward: true,
+			Request: true,
+			Reset:   true,
+		}},
+		Conditions: []*condition{{
+			Name:       "0",
+			Equals:     true,
+			HTTPMethod: true,
+			Not:        true,
+			Request:    true,
+			Values:     methods,
+		}},
+	}
+}
@@ -19,7 +19,9 @@ package appmanager
 import (
 	"encoding/json"
 	"fmt"
+	"hash/fnv"
 	"io/ioutil"
+	"net"
 	"reflect"
 	"sort"
 	"strconv"
@@ -27,6 +29,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/tracing"
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/writer"
 
@@ -37,6 +40,8 @@ import (
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
 	watch "k8s.io/apimachinery/pkg/watch"
@@ -47,14 +52,62 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 
+	"github.com/juju/ratelimit"
 	routeapi "github.com/openshift/origin/pkg/route/api"
 )
 
 const DefaultConfigMapLabel = "f5type in (virtual-server)"
+const DefaultEventSourceComponent = "k8s-bigip-ctlr"
 const vsBindAddrAnnotation = "status.virtual-server.f5.com/ip"
+const appliedHashAnnotation = "status.virtual-server.f5.com/applied-hash"
+const appliedConfigAnnotation = "status.virtual-server.f5.com/applied-config"
 const ingressSslRedirect = "ingress.kubernetes.io/ssl-redirect"
 const ingressAllowHttp = "ingress.kubernetes.io/allow-http"
 const ingHealthMonitorAnnotation = "virtual-server.f5.com/health"
+const poolServiceDownAnnotation = "virtual-server.f5.com/service-down-action"
+const poolReselectTriesAnnotation = "virtual-server.f5.com/reselect-tries"
+const vsDisableAnnotation = "f5.com/disable-vs"
+const serviceIgnoreAnnotation = "f5.com/ignore"
+const activeScheduleAnnotation = "virtual-server.f5.com/active-schedule"
+const sslSessionTicketAnnotation = "virtual-server.f5.com/ssl-session-ticket"
+const sslCacheSizeAnnotation = "virtual-server.f5.com/ssl-cache-size"
+const proxyProtocolAnnotation = "virtual-server.f5.com/proxy-protocol"
+const ingressSslPassthroughAnnotation = "virtual-server.f5.com/ssl-passthrough"
+const vsMergePolicyAnnotation = "virtual-server.f5.com/merge-policy"
+const vsPreserveFieldsAnnotation = "virtual-server.f5.com/preserve-fields"
+const requestLogProfileAnnotation = "virtual-server.f5.com/request-log-profile"
+const analyticsProfileAnnotation = "virtual-server.f5.com/analytics-profile"
+const dosProfileAnnotation = "virtual-server.f5.com/dos-profile"
+const sourcePortAnnotation = "virtual-server.f5.com/source-port"
+const transparentAnnotation = "virtual-server.f5.com/transparent"
+const oneConnectProfileAnnotation = "virtual-server.f5.com/oneconnect-profile"
+const oneConnectOptionsAnnotation = "virtual-server.f5.com/oneconnect-options"
+const securityLoggingAnnotation = "virtual-server.f5.com/security-logging"
+const ingressSharingGroupAnnotation = "virtual-server.f5.com/ip-sharing-group"
+const poolMemberTypeAnnotation = "virtual-server.f5.com/pool-member-type"
+const poolMemberLimitAnnotation = "virtual-server.f5.com/pool-member-limit"
+const ipv6AddrAnnotation = "virtual-server.f5.com/ipv6"
+const ingressHeaderRulesAnnotation = "virtual-server.f5.com/header-rules"
+const allowedMethodsAnnotation = "virtual-server.f5.com/allowed-methods"
+const serverCASecretAnnotation = "virtual-server.f5.com/server-ca-secret"
+const preserveVIPAnnotation = "virtual-server.f5.com/preserve-vip"
+const routeExtraPortsAnnotation = "virtual-server.f5.com/extra-ports"
+const routeProtocolsAnnotation = "virtual-server.f5.com/route-protocols"
+const fallbackPoolAnnotation = "virtual-server.f5.com/fallback-pool"
+const maintenancePageAnnotation = "virtual-server.f5.com/maintenance-page"
+const maintenanceStatusAnnotation = "virtual-server.f5.com/maintenance-status"
+const circuitBreakerAnnotation = "virtual-server.f5.com/circuit-breaker"
+const bandwidthPolicyAnnotation = "virtual-server.f5.com/bandwidth-policy"
+const clonePoolsAnnotation = "virtual-server.f5.com/clone-pools"
+const iRulesAnnotation = "virtual-server.f5.com/irules"
+const accessProfileAnnotation = "virtual-server.f5.com/access-profile"
+const perRequestPolicyAnnotation = "virtual-server.f5.com/per-request-policy"
+const hostRedirectsAnnotation = "virtual-server.f5.com/host-redirects"
+const hostRedirectCodeAnnotation = "virtual-server.f5.com/host-redirect-code"
+const universalPersistenceAnnotation = "virtual-server.f5.com/persistence"
+const universalPersistenceTimeoutAnnotation = "virtual-server.f5.com/persistence-timeout"
+const serviceNamespacesAnnotation = "virtual-server.f5.com/service-namespaces"
+const nodeMonitorName = "k8s_nodeport_health"
 
 type ResourceMap map[int32][]*ResourceConfig
 
@@ -79,12 +132,18 @@ type Manager struct {
 	oldNodesMutex sync.Mutex
 	// Nodes from previous iteration of node polling
 	oldNodes []string
+	// Names of the Nodes by address, to describe the BIG-IP nodes
+	nodeNamesMutex sync.Mutex
+	nodeNames      map[string]string
 	// Mutex for all informers (for informer CRUD)
 	informersMutex sync.Mutex
 	// Mutex for irulesMap
 	irulesMutex sync.Mutex
 	// Mutex for intDgMap
 	intDgMutex sync.Mutex
+	// Data groups of the server names of passthrough and reencrypt Routes
+	// and Ingresses, by shard and namespace
+	hostDgs *hostDataGroups
 	// App informer support
 	vsQueue      workqueue.RateLimitingInterface
 	appInformers map[string]*appInformer
@@ -95,8 +154,121 @@ type Manager struct {
 	broadcaster   record.EventBroadcaster
 	eventRecorder record.EventRecorder
 	eventSource   v1.EventSource
+	// Events and Ingress status updates, made outside of the sync
+	statusQueue workqueue.RateLimitingInterface
 	// Route configurations
 	routeConfig RouteConfig
+	// Addresses of deleted Ingresses reserved by the preserve VIP annotation
+	vipTombstones *vipTombstones
+	// Log a summary of changes each time the config is written
+	logConfigDiff bool
+	// Serializes config writes, and protects lastResources, lastOutputSeq
+	// and initialState
+	outputMutex sync.Mutex
+	// Last config written, used for the change summary and diagnostics
+	lastResources PartitionMap
+	// Sequence number of the last snapshot written
+	lastOutputSeq uint64
+	// Recent sync failures, kept for the diagnostics bundle
+	syncErrorsMutex sync.Mutex
+	syncErrors      []syncError
+	// Subset of namespaces managed by this controller instance
+	shard ShardConfig
+	// Node-level monitor for NodePort pools
+	nodeMonitor NodeMonitorConfig
+	// TLS Secrets of Ingresses still to be issued by cert-manager
+	certWaitsMutex     sync.Mutex
+	certWaits          map[string]*certWait
+	certManagerTimeout time.Duration
+	// Derive health monitors from readinessProbes
+	probeMonitors bool
+	// Use Service addresses for virtual servers without one
+	serviceAddress bool
+	// Publishes the host names of active virtual servers to DNS
+	dnsPublisher DNSPublisher
+	// Depth above which a work queue logs a warning, 0 disables it
+	queueDepthWarning int
+	// Delay of the sync for an endpoints change, 0 syncs right away
+	endpointsDampening time.Duration
+	// Change freeze: while frozen, the config is not written
+	freeze *changeFreeze
+	// Namespaces providing default annotations, nil if disabled
+	nsDefaultsInformer cache.SharedIndexInformer
+	// Informer of the default TLS Secret
+	defaultSslSecretInformer cache.SharedIndexInformer
+	// Traces of the keys in the sync pipeline, nil if disabled
+	traces *syncTraces
+	// Virtual server workers until the initial config is written
+	initialSyncWorkers int
+	// Held while a worker updates the resources for a key, the initial sync
+	// workers run in parallel
+	syncMutex sync.Mutex
+	// Time after which unsynced resources are logged, 0 disables it
+	initialSyncDeadline time.Duration
+	// Time the controller started, for the initial sync metrics
+	startTime time.Time
+	// Key the virtual server queue by resource instead of by service
+	queueByResource bool
+	// Do not write the status of Ingresses or the status annotation of
+	// ConfigMaps, disabled by flag or for lack of permission
+	ingressStatusDisabled bool
+	cfgMapStatusDisabled  bool
+	// Status IP annotations patched on ConfigMaps that the informer cache
+	// does not have yet, by "namespace/name/annotation"
+	bindAddrsMutex   sync.Mutex
+	bindAddrsPatched map[string]string
+	// Limit of the members of each pool, 0 for no limit
+	poolMemberLimitMax int
+	// Admission of the Routes, for the route report
+	routeAdmissions *routeAdmissions
+	// Addresses the BIG-IP sends traffic to pods from, the NetworkPolicies
+	// of the pods of pools are not checked if empty
+	bigipSources []*net.IPNet
+	// Service ports whose pods NetworkPolicies block from the BIG-IP, only
+	// used by the NetworkPolicy check
+	networkPolicyBlocked map[serviceKey]bool
+	// TLS Secret, as "namespace/name", of the client SSL profile of virtual
+	// servers serving TLS without a certificate, none if empty
+	defaultSslSecret string
+	// ConfigMap schema of the admission webhook
+	admissionSchema string
+	// ConfigMap, as "namespace/name", the reserved addresses of deleted
+	// resources are saved to, kept in memory only if empty
+	vipTombstoneConfigMap string
+	// Routes and Ingresses whose host is claimed by an older resource
+	ruleShadows *ruleShadows
+	// Full resyncs requested through the resync endpoint or SIGUSR1
+	resync *resyncState
+	// Write the data groups of server names sharded by first character
+	shardDataGroups bool
+	// Name of the cluster added to the descriptions of the BIG-IP nodes,
+	// none if empty
+	clusterIdentity string
+	// Time the virtual servers of a deleted namespace are kept disabled,
+	// and the time they are removed by namespace, guarded by informersMutex
+	nsDeleteGrace time.Duration
+	nsDeletions   map[string]time.Time
+	// Annotate the resources with the hash, and the body, of the configs
+	// last written for them
+	appliedConfigHash bool
+	appliedConfigBody bool
+	// Configs last written, by owner, for the applied config annotations
+	appliedMutex  sync.Mutex
+	appliedConfig ownedConfigs
+	// Overrides of the built-in iRule templates
+	iRuleTemplates *iRuleTemplates
+	// Write the legacy names of the objects renamed since earlier versions
+	adoptLegacyNames bool
+	// Time of the first successful write of each adoption
+	adoptionsWritten map[adoptionKey]time.Time
+	// Ingresses refused an address by the Ingress holding it
+	addressLosers *addressLosers
+	// Services of other namespaces the Ingresses may reference
+	crossNsRefs crossNamespaceRefs
+	// Virtual servers warned about the nodeport pool member type they set
+	// in cluster mode
+	ignoredMemberTypes      map[string]bool
+	ignoredMemberTypesMutex sync.Mutex
 }
 
 // Struct to allow NewManager to receive all or only specific parameters.
@@ -108,40 +280,255 @@ type Params struct {
 	UseNodeInternal bool
 	IsNodePort      bool
 	RouteConfig     RouteConfig
-	InitialState    bool                 // Unit testing only
-	EventRecorder   record.EventRecorder // Unit testing only
+	RateLimiter     RateLimiterConfig
+	LogConfigDiff   bool
+	Shard           ShardConfig
+	NodeMonitor     NodeMonitorConfig
+	// Time to wait for cert-manager to issue a certificate before recording
+	// an Event, 0 disables the Event
+	CertManagerTimeout time.Duration
+	// Derive health monitors from readinessProbes if none are configured
+	ProbeMonitors bool
+	// Use the externalIPs or loadBalancerIP of a Service as the virtual
+	// address when a ConfigMap or Ingress does not provide one
+	ServiceAddress bool
+	// Publishes the host names of active virtual servers, nil if disabled
+	DNSPublisher DNSPublisher
+	// Depth above which a work queue logs a warning with its pending keys,
+	// 0 disables the warning
+	QueueDepthWarning int
+	// Window in which changes to the endpoints of a service are coalesced
+	// into a single sync, 0 syncs on every change
+	EndpointsDampening time.Duration
+	// Start in a change freeze, without writing the config until unfrozen
+	ChangeFreeze bool
+	// Use the annotations of Namespaces as defaults for their Ingresses and
+	// Routes
+	NamespaceDefaults bool
+	// Traces the sync pipeline of each service key, nil if disabled
+	Tracer *tracing.Tracer
+	// Number of virtual server workers syncing the namespaces in parallel
+	// until the initial config is written, 1 if unset
+	InitialSyncWorkers int
+	// Time after which the resources still to be synced are logged if the
+	// initial config has not been written, 0 disables it
+	InitialSyncDeadline time.Duration
+	// Sync the ConfigMaps and Ingresses referencing a service one at a time
+	// instead of all the resources of its namespace on each change
+	QueueByResource bool
+	// Limit of the members of each pool, 0 for no limit. Resources can
+	// lower it by annotation.
+	PoolMemberLimit int
+	// Addresses the BIG-IP sends traffic to pods from, its self IPs and
+	// SNAT pools. Pools whose pods NetworkPolicies block from these are
+	// reported, nothing is checked if empty.
+	BigIPSourceCIDRs []*net.IPNet
+	// TLS Secret, as "namespace/name", such as a wildcard certificate of
+	// the cluster domain, shared by the Ingresses and Routes serving TLS
+	// without a certificate of their own
+	DefaultSslSecret string
+	// ConfigMap schema the annotations of Ingresses are validated against
+	// by the admission webhook, DefaultAdmissionSchema if empty
+	AdmissionSchema string
+	// ConfigMap, as "namespace/name", keeping the addresses reserved by the
+	// preserve VIP annotation across restarts
+	VIPTombstoneConfigMap string
+	// Split the data groups of the server names of passthrough and
+	// reencrypt Routes and Ingresses by first character of the server name
+	ShardDataGroups bool
+	// Component of the source of the Events recorded,
+	// DefaultEventSourceComponent if empty
+	EventSourceComponent string
+	// Name of the cluster, as the host of the source of the Events and in
+	// the descriptions of the BIG-IP nodes, to tell apart several clusters
+	// sharing a BIG-IP
+	ClusterIdentity string
+	// Time during which the virtual servers of a deleted namespace are
+	// disabled but kept, 0 removes them right away
+	NamespaceDeleteGrace time.Duration
+	// Annotate the ConfigMaps, Ingresses and Routes with the hash of the
+	// configs last written for them, and with the configs themselves
+	AppliedConfigHash bool
+	AppliedConfigBody bool
+	// Directory of the files overriding the built-in iRule templates, named
+	// after the iRules, usually a mounted ConfigMap
+	IRuleTemplateDir string
+	// Write the names earlier controller versions gave to the BIG-IP
+	// objects, for the driver to adopt or migrate them
+	AdoptLegacyNames bool
+	// Namespaces whose Ingresses may reference services of other
+	// namespaces, with the namespaces each may reference
+	CrossNamespaceRefs map[string][]string
+	// Do not write the virtual address to the status of Ingresses or to the
+	// status annotation of ConfigMaps
+	DisableIngressStatus   bool
+	DisableConfigMapStatus bool
+	InitialState           bool                 // Unit testing only
+	EventRecorder          record.EventRecorder // Unit testing only
 }
 
 // Configuration options for Routes in OpenShift
 type RouteConfig struct {
 	RouteVSAddr string
 	RouteLabel  string
+	// CA certificate for reencrypt Routes without a destination CA,
+	// no default server SSL profile is created if empty
+	ServerCA string
+	// ConfigMap, as "namespace/name", to which the route report is
+	// written, not written if empty
+	StatusConfigMap string
+	// Reject Routes with an invalid host, or certificates that do not
+	// match their key or CA certificate
+	ExtendedValidation bool
+	// Do not create the http, or the https, virtual servers of Routes
+	DisableHttp  bool
+	DisableHttps bool
+}
+
+// Parse the label selector of the Routes to watch, all Routes if empty
+func ParseRouteLabel(routeLabel string) (labels.Selector, error) {
+	if len(routeLabel) == 0 {
+		return labels.Everything(), nil
+	}
+	return labels.Parse(routeLabel)
+}
+
+// Service CA mounted in each pod by OpenShift
+const DefaultServerCAPath = "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
+
+// Sharding of namespaces across multiple controller instances. Each
+// namespace is hashed to one of Total shards, and only namespaces that hash
+// to Index are managed. A Total of 0 or 1 disables sharding.
+type ShardConfig struct {
+	Index int
+	Total int
+}
+
+// Node-level health monitor added to every pool in NodePort mode. It checks
+// the NodePort on each node, so that a node whose kube-proxy is down is
+// marked down in all pools regardless of application monitors. An Interval
+// of 0 disables the monitor.
+type NodeMonitorConfig struct {
+	Interval int
+	Timeout  int
+	// Only add the monitor to pools without application monitors, as their
+	// default monitor
+	DefaultOnly bool
+}
+
+// Retry parameters for the work queues. Any value left unset uses the
+// same default as workqueue.DefaultControllerRateLimiter().
+type RateLimiterConfig struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	QPS       float64
+}
+
+const (
+	DefaultQueueBaseDelay = 5 * time.Millisecond
+	DefaultQueueMaxDelay  = 1000 * time.Second
+	DefaultQueueQPS       = 10.0
+	// Bucket size of the overall rate limiter, as in the client-go default.
+	defaultQueueBurst = 100
+)
+
+// Create a rate limiter with both per-item exponential backoff and an overall
+// token bucket, mirroring workqueue.DefaultControllerRateLimiter().
+func newRateLimiter(cfg RateLimiterConfig) workqueue.RateLimiter {
+	baseDelay := cfg.BaseDelay
+	if baseDelay <= 0 {
+		baseDelay = DefaultQueueBaseDelay
+	}
+	maxDelay := cfg.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultQueueMaxDelay
+	}
+	qps := cfg.QPS
+	if qps <= 0 {
+		qps = DefaultQueueQPS
+	}
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{
+			Bucket: ratelimit.NewBucketWithRate(qps, int64(defaultQueueBurst)),
+		},
+	)
 }
 
 // Create and return a new app manager that meets the Manager interface
 func NewManager(params *Params) *Manager {
-	vsQueue := workqueue.NewNamedRateLimitingQueue(
-		workqueue.DefaultControllerRateLimiter(), "virtual-server-controller")
-	nsQueue := workqueue.NewNamedRateLimitingQueue(
-		workqueue.DefaultControllerRateLimiter(), "namespace-controller")
+	// The namespaces share the virtual server worker in turn
+	var vsQueue workqueue.RateLimitingInterface = newFairQueue(
+		newRateLimiter(params.RateLimiter), "virtual-server-controller",
+		serviceKeyNamespace)
+	var traces *syncTraces
+	if nil != params.Tracer {
+		traces = newSyncTraces(params.Tracer)
+		vsQueue = newTracedQueue(vsQueue, traces)
+	}
+	vsQueue = newMonitoredQueue(vsQueue, "virtual-server-controller")
+	nsQueue := newMonitoredQueue(workqueue.NewNamedRateLimitingQueue(
+		newRateLimiter(params.RateLimiter), "namespace-controller"),
+		"namespace-controller")
 	manager := Manager{
-		resources:         NewResources(),
-		customProfiles:    NewCustomProfiles(),
-		irulesMap:         make(IRulesMap),
-		intDgMap:          make(InternalDataGroupMap),
-		kubeClient:        params.KubeClient,
-		restClientv1:      params.restClient,
-		restClientv1beta1: params.restClient,
-		routeClientV1:     params.RouteClientV1,
-		configWriter:      params.ConfigWriter,
-		useNodeInternal:   params.UseNodeInternal,
-		isNodePort:        params.IsNodePort,
-		initialState:      params.InitialState,
-		eventRecorder:     params.EventRecorder,
-		routeConfig:       params.RouteConfig,
-		vsQueue:           vsQueue,
-		nsQueue:           nsQueue,
-		appInformers:      make(map[string]*appInformer),
+		resources:             NewResources(),
+		customProfiles:        NewCustomProfiles(),
+		irulesMap:             make(IRulesMap),
+		intDgMap:              make(InternalDataGroupMap),
+		kubeClient:            params.KubeClient,
+		restClientv1:          params.restClient,
+		restClientv1beta1:     params.restClient,
+		routeClientV1:         params.RouteClientV1,
+		configWriter:          params.ConfigWriter,
+		useNodeInternal:       params.UseNodeInternal,
+		isNodePort:            params.IsNodePort,
+		initialState:          params.InitialState,
+		eventRecorder:         params.EventRecorder,
+		routeConfig:           params.RouteConfig,
+		vipTombstones:         newVIPTombstones(),
+		logConfigDiff:         params.LogConfigDiff,
+		shard:                 params.Shard,
+		nodeMonitor:           params.NodeMonitor,
+		vsQueue:               vsQueue,
+		nsQueue:               nsQueue,
+		statusQueue:           newMonitoredQueue(newStatusQueue(), "status-updates"),
+		appInformers:          make(map[string]*appInformer),
+		certWaits:             make(map[string]*certWait),
+		hostDgs:               newHostDataGroups(),
+		certManagerTimeout:    params.CertManagerTimeout,
+		probeMonitors:         params.ProbeMonitors,
+		serviceAddress:        params.ServiceAddress,
+		dnsPublisher:          params.DNSPublisher,
+		queueDepthWarning:     params.QueueDepthWarning,
+		endpointsDampening:    params.EndpointsDampening,
+		freeze:                newChangeFreeze(params.ChangeFreeze),
+		traces:                traces,
+		initialSyncWorkers:    params.InitialSyncWorkers,
+		initialSyncDeadline:   params.InitialSyncDeadline,
+		queueByResource:       params.QueueByResource,
+		ingressStatusDisabled: params.DisableIngressStatus,
+		cfgMapStatusDisabled:  params.DisableConfigMapStatus,
+		bindAddrsPatched:      make(map[string]string),
+		poolMemberLimitMax:    params.PoolMemberLimit,
+		routeAdmissions:       newRouteAdmissions(),
+		ruleShadows:           newRuleShadows(),
+		resync:                &resyncState{},
+		shardDataGroups:       params.ShardDataGroups,
+		clusterIdentity:       params.ClusterIdentity,
+		nsDeleteGrace:         params.NamespaceDeleteGrace,
+		nsDeletions:           make(map[string]time.Time),
+		appliedConfigHash:     params.AppliedConfigHash,
+		appliedConfigBody:     params.AppliedConfigBody,
+		iRuleTemplates:        newIRuleTemplates(params.IRuleTemplateDir),
+		adoptLegacyNames:      params.AdoptLegacyNames,
+		adoptionsWritten:      make(map[adoptionKey]time.Time),
+		addressLosers:         newAddressLosers(),
+		crossNsRefs:           params.CrossNamespaceRefs,
+		ignoredMemberTypes:    make(map[string]bool),
+		bigipSources:          params.BigIPSourceCIDRs,
+		defaultSslSecret:      params.DefaultSslSecret,
+		admissionSchema:       params.AdmissionSchema,
+		vipTombstoneConfigMap: params.VIPTombstoneConfigMap,
 	}
 	if nil != manager.kubeClient && nil == manager.restClientv1 {
 		// This is the normal production case, but need the checks for unit tests.
@@ -151,8 +538,28 @@ func NewManager(params *Params) *Manager {
 		// This is the normal production case, but need the checks for unit tests.
 		manager.restClientv1beta1 = manager.kubeClient.Extensions().RESTClient()
 	}
-	manager.eventSource = v1.EventSource{Component: "k8s-bigip-ctlr"}
+	if params.NamespaceDefaults {
+		manager.nsDefaultsInformer = manager.newNamespaceDefaultsInformer(0)
+	}
+	if "" == manager.admissionSchema {
+		manager.admissionSchema = DefaultAdmissionSchema
+	}
+	if "" != manager.defaultSslSecret {
+		manager.defaultSslSecretInformer = manager.newDefaultSslSecretInformer(0)
+	}
+	component := params.EventSourceComponent
+	if "" == component {
+		component = DefaultEventSourceComponent
+	}
+	manager.eventSource = v1.EventSource{
+		Component: component,
+		Host:      params.ClusterIdentity,
+	}
 	manager.broadcaster = record.NewBroadcaster()
+	if nil != manager.kubeClient {
+		manager.broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{
+			Interface: manager.kubeClient.Core().Events("")})
+	}
 	if nil == manager.eventRecorder {
 		manager.eventRecorder = manager.broadcaster.NewRecorder(scheme.Scheme, manager.eventSource)
 	}
@@ -161,34 +568,83 @@ func NewManager(params *Params) *Manager {
 }
 
 func (appMgr *Manager) loadDefaultCert(
-	namespace string,
+	owner string,
 ) (*ProfileRef, bool) {
 	// OpenShift will put the default server SSL cert on each pod. We create a
 	// server SSL profile for it and associate it to any reencrypt routes that
 	// have not explicitly set a certificate.
-	profileName := "openshift_route_cluster_default-server-ssl"
-	profile := ProfileRef{
-		Name:      profileName,
-		Partition: DEFAULT_PARTITION,
-		Context:   customProfileServer,
+	path := appMgr.routeConfig.ServerCA
+	if "" == path {
+		log.Debugf("No default server CA configured for reencrypt routes.")
+		return nil, false
 	}
+	profile := defaultServerSslProfile()
 	appMgr.customProfiles.Lock()
 	defer appMgr.customProfiles.Unlock()
-	skey := secretKey{Name: profileName, Namespace: namespace}
-	_, found := appMgr.customProfiles.profs[skey]
+	cp, found := appMgr.customProfiles.Get(
+		profileKey{Partition: profile.Partition, Name: profile.Name})
 	if !found {
-		path := "/var/run/secrets/kubernetes.io/serviceaccount/service-ca.crt"
 		data, err := ioutil.ReadFile(path)
 		if nil != err {
 			log.Errorf("Unable to load default cluster certificate '%v': %v",
 				path, err)
 			return nil, false
 		}
-		appMgr.customProfiles.profs[skey] = NewCustomProfile(profile, string(data))
+		cp = NewCustomProfile(profile, string(data))
 	}
+	appMgr.customProfiles.Add(owner, cp)
 	return &profile, !found
 }
 
+// Server SSL profile of the default server CA. Not in the route profile
+// naming scheme, so no Route can collide with it.
+func defaultServerSslProfile() ProfileRef {
+	return ProfileRef{
+		Name:      "openshift_cluster_default-server-ssl",
+		Partition: DEFAULT_PARTITION,
+		Context:   customProfileServer,
+	}
+}
+
+// Interval of the checks for a rotation of the default server CA
+const serverCAReloadInterval = time.Minute
+
+// Reload the default server CA, and update its profile when the CA was
+// rotated, so reencrypt Routes keep trusting the service certificates
+// signed by the new CA. The profile is only loaded once a Route uses it.
+func (appMgr *Manager) reloadDefaultServerCA() {
+	path := appMgr.routeConfig.ServerCA
+	if "" == path {
+		return
+	}
+	profile := defaultServerSslProfile()
+	key := profileKey{Partition: profile.Partition, Name: profile.Name}
+	appMgr.customProfiles.Lock()
+	cp, found := appMgr.customProfiles.Get(key)
+	appMgr.customProfiles.Unlock()
+	if !found {
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		log.Warningf("Unable to reload default cluster certificate '%v': %v",
+			path, err)
+		return
+	}
+	if cp.Cert == string(data) {
+		return
+	}
+	appMgr.customProfiles.Lock()
+	updated := appMgr.customProfiles.Update(NewCustomProfile(profile,
+		string(data)))
+	appMgr.customProfiles.Unlock()
+	if updated {
+		log.Infof("Default cluster certificate '%v' changed, updating the "+
+			"server SSL profile of reencrypt Routes", path)
+		appMgr.outputConfig()
+	}
+}
+
 func (appMgr *Manager) addIRule(name, partition, rule string) {
 	appMgr.irulesMutex.Lock()
 	defer appMgr.irulesMutex.Unlock()
@@ -244,11 +700,18 @@ func (appMgr *Manager) addNamespaceLocked(
 		return nil, fmt.Errorf(
 			"Cannot watch all namespaces when already watching specific ones.")
 	}
-	var appInf *appInformer
+	if "" != namespace && !appMgr.inShard(namespace) {
+		return nil, fmt.Errorf("Namespace %v is not in shard %v of %v.",
+			namespace, appMgr.shard.Index, appMgr.shard.Total)
+	}
 	if appInf, found := appMgr.appInformers[namespace]; found {
 		return appInf, nil
 	}
-	appInf = appMgr.newAppInformer(namespace, cfgMapSelector, resyncPeriod)
+	appInf, err := appMgr.newAppInformer(namespace, cfgMapSelector,
+		resyncPeriod)
+	if nil != err {
+		return nil, err
+	}
 	appMgr.appInformers[namespace] = appInf
 	return appInf, nil
 }
@@ -340,18 +803,40 @@ func (appMgr *Manager) syncNamespace(nsName string) error {
 		log.Debugf("Finished syncing namespace %+v (%v)",
 			nsName, endTime.Sub(startTime))
 	}()
-	_, exists, err := appMgr.nsInformer.GetIndexer().GetByKey(nsName)
+	if !appMgr.inShard(nsName) {
+		// Managed by another controller instance
+		return nil
+	}
+	obj, exists, err := appMgr.nsInformer.GetIndexer().GetByKey(nsName)
 	if nil != err {
 		log.Warningf("Error looking up namespace '%v': %v\n", nsName, err)
 		return err
 	}
+	if exists && appMgr.nsDeleteGrace > 0 &&
+		nil != obj.(*v1.Namespace).ObjectMeta.DeletionTimestamp {
+		// The resources of a terminating namespace are about to be deleted,
+		// stop watching them to keep its virtual servers
+		exists = false
+	}
 
+	// The config is written once the informers lock is released, since the
+	// writes record the Secrets and annotations of the watched resources
+	write := false
+	defer func() {
+		if write {
+			appMgr.outputConfig()
+		}
+	}()
 	appMgr.informersMutex.Lock()
 	defer appMgr.informersMutex.Unlock()
 	appInf, found := appMgr.getNamespaceInformerLocked(nsName)
 	if exists && found {
 		return nil
 	}
+	if !exists && !found {
+		write = appMgr.endNamespaceGraceLocked(nsName)
+		return nil
+	}
 	if exists {
 		// exists but not found in informers map, add
 		cfgMapSelector, err := labels.Parse(DefaultConfigMapLabel)
@@ -365,29 +850,45 @@ func (appMgr *Manager) syncNamespace(nsName string) error {
 		}
 		appInf.start()
 		appInf.waitForCacheSync()
+		appMgr.cancelNamespaceGraceLocked(nsName)
 	} else {
 		// does not exist but found in informers map, delete
 		// Clean up all resources that reference a removed namespace
 		appInf.stopInformers()
 		appMgr.removeNamespaceLocked(nsName)
-		appMgr.resources.Lock()
-		defer appMgr.resources.Unlock()
-		rsDeleted := 0
-		appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
-			if key.Namespace == nsName {
-				if appMgr.resources.Delete(key, "") {
-					rsDeleted += 1
-				}
-			}
-		})
-		if rsDeleted > 0 {
-			appMgr.outputConfigLocked()
+		if appMgr.nsDeleteGrace > 0 {
+			write = appMgr.startNamespaceGraceLocked(nsName)
+			return nil
 		}
+		write = appMgr.deleteNamespaceResources(nsName)
 	}
 
 	return nil
 }
 
+// Delete the configs of the resources of a namespace, returns whether any
+// was deleted
+func (appMgr *Manager) deleteNamespaceResources(nsName string) bool {
+	appMgr.resources.Lock()
+	defer appMgr.resources.Unlock()
+	rsDeleted := 0
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if key.Namespace == nsName {
+			if appMgr.resources.Delete(key, "") {
+				rsDeleted += 1
+			}
+		}
+	})
+	return rsDeleted > 0
+}
+
+// Whether the initial config has been written
+func (appMgr *Manager) isInitialState() bool {
+	appMgr.outputMutex.Lock()
+	defer appMgr.outputMutex.Unlock()
+	return appMgr.initialState
+}
+
 func (appMgr *Manager) GetWatchedNamespaces() []string {
 	appMgr.informersMutex.Lock()
 	defer appMgr.informersMutex.Unlock()
@@ -405,26 +906,36 @@ func (appMgr *Manager) GetNamespaceLabelInformer() cache.SharedIndexInformer {
 type serviceQueueKey struct {
 	Namespace   string
 	ServiceName string
+	// Kind and "namespace/name" of the resource whose virtual servers are
+	// synced when keying by resource. Without a kind, all the resources of
+	// the service are synced; without a name, all those of the kind.
+	ResourceKind string
+	ResourceName string
 }
 
 type appInformer struct {
 	namespace      string
+	cfgMapSelector labels.Selector
 	cfgMapInformer cache.SharedIndexInformer
 	svcInformer    cache.SharedIndexInformer
 	endptInformer  cache.SharedIndexInformer
 	ingInformer    cache.SharedIndexInformer
 	routeInformer  cache.SharedIndexInformer
-	stopCh         chan struct{}
+	secretInformer cache.SharedIndexInformer
+	// Pods, watched only for the features reading their specs
+	podInformer cache.SharedIndexInformer
+	stopCh      chan struct{}
 }
 
 func (appMgr *Manager) newAppInformer(
 	namespace string,
 	cfgMapSelector labels.Selector,
 	resyncPeriod time.Duration,
-) *appInformer {
+) (*appInformer, error) {
 	appInf := appInformer{
-		namespace: namespace,
-		stopCh:    make(chan struct{}),
+		namespace:      namespace,
+		cfgMapSelector: cfgMapSelector,
+		stopCh:         make(chan struct{}),
 		cfgMapInformer: cache.NewSharedIndexInformer(
 			newListWatchWithLabelSelector(
 				appMgr.restClientv1,
@@ -434,7 +945,11 @@ func (appMgr *Manager) newAppInformer(
 			),
 			&v1.ConfigMap{},
 			resyncPeriod,
-			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+				secretIndex:          configMapSecretIndexFunc,
+				serviceIndex:         configMapServiceIndexFunc,
+			},
 		),
 		svcInformer: cache.NewSharedIndexInformer(
 			newListWatchWithLabelSelector(
@@ -467,19 +982,44 @@ func (appMgr *Manager) newAppInformer(
 			),
 			&v1beta1.Ingress{},
 			resyncPeriod,
-			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+				secretIndex:          ingressSecretIndexFunc,
+				serviceIndex:         ingressServiceIndexFunc,
+			},
+		),
+		secretInformer: cache.NewSharedIndexInformer(
+			newListWatchWithLabelSelector(
+				appMgr.restClientv1,
+				"secrets",
+				namespace,
+				labels.Everything(),
+			),
+			&v1.Secret{},
+			resyncPeriod,
+			cache.Indexers{},
 		),
 	}
+	if appMgr.watchesPods() {
+		appInf.podInformer = cache.NewSharedIndexInformer(
+			newListWatchWithLabelSelector(
+				appMgr.restClientv1,
+				"pods",
+				namespace,
+				labels.Everything(),
+			),
+			&v1.Pod{},
+			resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+		)
+	}
 	if nil != appMgr.routeClientV1 {
-		var label labels.Selector
-		var err error
-		if len(appMgr.routeConfig.RouteLabel) == 0 {
-			label = labels.Everything()
-		} else {
-			label, err = labels.Parse(appMgr.routeConfig.RouteLabel)
-			if err != nil {
-				log.Errorf("Failed to parse Label Selector string: %v", err)
-			}
+		// The label is checked for each namespace added, as an invalid
+		// selector would otherwise watch all the Routes of the namespace
+		label, err := ParseRouteLabel(appMgr.routeConfig.RouteLabel)
+		if nil != err {
+			return nil, fmt.Errorf("Failed to parse Route label selector "+
+				"'%v': %v", appMgr.routeConfig.RouteLabel, err)
 		}
 		appInf.routeInformer = cache.NewSharedIndexInformer(
 			newListWatchWithLabelSelector(
@@ -490,58 +1030,79 @@ func (appMgr *Manager) newAppInformer(
 			),
 			&routeapi.Route{},
 			resyncPeriod,
-			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc},
+			cache.Indexers{
+				cache.NamespaceIndex: cache.MetaNamespaceIndexFunc,
+				secretIndex:          routeSecretIndexFunc,
+				serviceIndex:         routeServiceIndexFunc,
+			},
 		)
 	}
 
 	appInf.cfgMapInformer.AddEventHandlerWithResyncPeriod(
-		&cache.ResourceEventHandlerFuncs{
-			AddFunc:    func(obj interface{}) { appMgr.enqueueConfigMap(obj) },
-			UpdateFunc: func(old, cur interface{}) { appMgr.enqueueConfigMap(cur) },
-			DeleteFunc: func(obj interface{}) { appMgr.enqueueConfigMap(obj) },
-		},
-		resyncPeriod,
-	)
-
+		appMgr.cfgMapEventHandlers(), resyncPeriod)
 	appInf.svcInformer.AddEventHandlerWithResyncPeriod(
-		&cache.ResourceEventHandlerFuncs{
-			AddFunc:    func(obj interface{}) { appMgr.enqueueService(obj) },
-			UpdateFunc: func(old, cur interface{}) { appMgr.enqueueService(cur) },
-			DeleteFunc: func(obj interface{}) { appMgr.enqueueService(obj) },
-		},
-		resyncPeriod,
-	)
-
+		appMgr.svcEventHandlers(), resyncPeriod)
 	appInf.endptInformer.AddEventHandlerWithResyncPeriod(
-		&cache.ResourceEventHandlerFuncs{
-			AddFunc:    func(obj interface{}) { appMgr.enqueueEndpoints(obj) },
-			UpdateFunc: func(old, cur interface{}) { appMgr.enqueueEndpoints(cur) },
-			DeleteFunc: func(obj interface{}) { appMgr.enqueueEndpoints(obj) },
-		},
-		resyncPeriod,
-	)
-
+		appMgr.endptEventHandlers(), resyncPeriod)
 	appInf.ingInformer.AddEventHandlerWithResyncPeriod(
-		&cache.ResourceEventHandlerFuncs{
-			AddFunc:    func(obj interface{}) { appMgr.enqueueIngress(obj) },
-			UpdateFunc: func(old, cur interface{}) { appMgr.enqueueIngress(cur) },
-			DeleteFunc: func(obj interface{}) { appMgr.enqueueIngress(obj) },
-		},
-		resyncPeriod,
-	)
-
+		appMgr.ingEventHandlers(), resyncPeriod)
+	appInf.secretInformer.AddEventHandlerWithResyncPeriod(
+		appMgr.secretEventHandlers(), resyncPeriod)
 	if nil != appMgr.routeClientV1 {
 		appInf.routeInformer.AddEventHandlerWithResyncPeriod(
-			&cache.ResourceEventHandlerFuncs{
-				AddFunc:    func(obj interface{}) { appMgr.enqueueRoute(obj) },
-				UpdateFunc: func(old, cur interface{}) { appMgr.enqueueRoute(cur) },
-				DeleteFunc: func(obj interface{}) { appMgr.enqueueRoute(obj) },
-			},
-			resyncPeriod,
-		)
+			appMgr.routeEventHandlers(), resyncPeriod)
+	}
+
+	return &appInf, nil
+}
+
+func (appMgr *Manager) cfgMapEventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { appMgr.enqueueConfigMap(obj) },
+		UpdateFunc: skipResync(appMgr.enqueueConfigMap),
+		DeleteFunc: func(obj interface{}) { appMgr.enqueueConfigMap(obj) },
+	}
+}
+
+func (appMgr *Manager) svcEventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { appMgr.enqueueService(obj) },
+		UpdateFunc: appMgr.enqueueServiceUpdate,
+		DeleteFunc: func(obj interface{}) { appMgr.enqueueService(obj) },
+	}
+}
+
+func (appMgr *Manager) endptEventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { appMgr.enqueueEndpoints(obj) },
+		UpdateFunc: skipResync(appMgr.enqueueEndpoints),
+		DeleteFunc: func(obj interface{}) { appMgr.enqueueEndpoints(obj) },
+	}
+}
+
+func (appMgr *Manager) ingEventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { appMgr.enqueueIngress(obj) },
+		UpdateFunc: skipResync(appMgr.enqueueIngressChange),
+		DeleteFunc: func(obj interface{}) { appMgr.handleIngressDelete(obj) },
 	}
+}
 
-	return &appInf
+// Rotated certificates are picked up by the resources using them
+func (appMgr *Manager) secretEventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { appMgr.enqueueSecret(obj) },
+		UpdateFunc: skipResync(appMgr.enqueueSecret),
+		DeleteFunc: func(obj interface{}) { appMgr.enqueueSecret(obj) },
+	}
+}
+
+func (appMgr *Manager) routeEventHandlers() cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { appMgr.enqueueRoute(obj) },
+		UpdateFunc: skipResync(appMgr.enqueueRoute),
+		DeleteFunc: func(obj interface{}) { appMgr.handleRouteDelete(obj) },
+	}
 }
 
 func newListWatchWithLabelSelector(
@@ -573,6 +1134,9 @@ func newListWatchWithLabelSelector(
 
 func (appMgr *Manager) enqueueConfigMap(obj interface{}) {
 	if ok, keys := appMgr.checkValidConfigMap(obj); ok {
+		cm := obj.(*v1.ConfigMap)
+		keys = appMgr.scopeKeys(keys, configMapKind, cm.ObjectMeta.Namespace,
+			cm.ObjectMeta.Name, false)
 		for _, key := range keys {
 			appMgr.vsQueue.Add(*key)
 		}
@@ -580,35 +1144,186 @@ func (appMgr *Manager) enqueueConfigMap(obj interface{}) {
 }
 
 func (appMgr *Manager) enqueueService(obj interface{}) {
+	if isIgnoredService(obj.(*v1.Service)) {
+		return
+	}
+	appMgr.enqueueServiceKeys(obj)
+}
+
+// A Service that starts or stops being ignored is synced once more, to
+// remove or add its pool members
+func (appMgr *Manager) enqueueServiceUpdate(old, cur interface{}) {
+	if !resourceChanged(old, cur) {
+		return
+	}
+	if isIgnoredService(old.(*v1.Service)) != isIgnoredService(cur.(*v1.Service)) {
+		appMgr.enqueueServiceKeys(cur)
+		return
+	}
+	appMgr.enqueueService(cur)
+}
+
+func (appMgr *Manager) enqueueServiceKeys(obj interface{}) {
 	if ok, keys := appMgr.checkValidService(obj); ok {
-		for _, key := range keys {
+		for _, key := range appMgr.serviceKeys(keys) {
 			appMgr.vsQueue.Add(*key)
 		}
 	}
 }
 
+// Endpoints change many times during a rolling update. With a dampening
+// window, the sync of a service is delayed by the window after its first
+// change, and the changes made meanwhile are coalesced into that sync as the
+// queue keeps a single entry per key.
 func (appMgr *Manager) enqueueEndpoints(obj interface{}) {
 	if ok, keys := appMgr.checkValidEndpoints(obj); ok {
-		for _, key := range keys {
-			appMgr.vsQueue.Add(*key)
+		for _, key := range appMgr.serviceKeys(keys) {
+			if appMgr.endpointsDampening > 0 {
+				appMgr.vsQueue.AddAfter(*key, appMgr.endpointsDampening)
+			} else {
+				appMgr.vsQueue.Add(*key)
+			}
 		}
 	}
 }
 
 func (appMgr *Manager) enqueueIngress(obj interface{}) {
+	appMgr.enqueueIngressAfter(obj, 0)
+}
+
+// Enqueue the keys of an Ingress once the delay has passed
+func (appMgr *Manager) enqueueIngressAfter(
+	obj interface{},
+	delay time.Duration,
+) {
 	if ok, keys := appMgr.checkValidIngress(obj); ok {
+		ing := obj.(*v1beta1.Ingress)
+		keys = appMgr.scopeKeys(keys, ingressKind, ing.ObjectMeta.Namespace,
+			ing.ObjectMeta.Name,
+			isPassthroughIngress(appMgr.ingressWithDefaults(ing)))
 		for _, key := range keys {
-			appMgr.vsQueue.Add(*key)
+			if delay > 0 {
+				appMgr.vsQueue.AddAfter(*key, delay)
+			} else {
+				appMgr.vsQueue.Add(*key)
+			}
 		}
 	}
 }
 
 func (appMgr *Manager) enqueueRoute(obj interface{}) {
 	if ok, key := appMgr.checkValidRoute(obj); ok {
+		route := obj.(*routeapi.Route)
+		appMgr.scopeKeys([]*serviceQueueKey{key}, routeKind,
+			route.ObjectMeta.Namespace, route.ObjectMeta.Name, false)
 		appMgr.vsQueue.Add(*key)
 	}
 }
 
+// Remove the configs of a deleted Ingress right away. The service keys
+// derived from the Ingress only cover services that still exist, so
+// waiting for the resulting sync can leave stale configs behind.
+func (appMgr *Manager) handleIngressDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ing, ok := obj.(*v1beta1.Ingress)
+	if !ok {
+		log.Warningf("Received unexpected object on Ingress delete: %v", obj)
+		return
+	}
+	namespace := ing.ObjectMeta.Namespace
+	if _, ok := appMgr.getNamespaceInformer(namespace); !ok {
+		return
+	}
+	rsDeleted := 0
+	addr := ing.ObjectMeta.Annotations["virtual-server.f5.com/ip"]
+	appMgr.resources.Lock()
+	for _, ps := range appMgr.virtualPorts(ing) {
+		rsName := formatIngressVSName(ing, ps.protocol)
+		cfgs, keys := appMgr.resources.GetAllWithName(rsName)
+		for _, cfg := range cfgs {
+			if nil != cfg.Virtual.VirtualAddress &&
+				"" != cfg.Virtual.VirtualAddress.BindAddr {
+				addr = cfg.Virtual.VirtualAddress.BindAddr
+			}
+		}
+		for _, key := range keys {
+			if appMgr.resources.Delete(key, rsName) {
+				rsDeleted += 1
+			}
+		}
+	}
+	appMgr.resources.Unlock()
+	appMgr.preserveIngressVIP(ing, addr)
+	appMgr.requeueAddressLosers(ing)
+	appMgr.stopCertificateWaits(ing)
+	if rsDeleted > 0 {
+		appMgr.deleteUnusedProfiles()
+		appMgr.outputConfig()
+	}
+	appMgr.enqueueIngress(ing)
+}
+
+// Remove the pool and rules of a deleted Route right away, unless another
+// Route still targets the same service.
+func (appMgr *Manager) handleRouteDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	route, ok := obj.(*routeapi.Route)
+	if !ok {
+		log.Warningf("Received unexpected object on Route delete: %v", obj)
+		return
+	}
+	appMgr.preserveRouteVIP(route)
+	namespace := route.ObjectMeta.Namespace
+	appInf, ok := appMgr.getNamespaceInformer(namespace)
+	if !ok {
+		return
+	}
+	svcName := route.Spec.To.Name
+	routes, err := appInf.routeInformer.GetIndexer().ByIndex(
+		"namespace", namespace)
+	if nil != err {
+		log.Warningf("Unable to list routes for namespace '%v': %v",
+			namespace, err)
+	} else {
+		for _, obj := range routes {
+			rt := obj.(*routeapi.Route)
+			if rt.ObjectMeta.Name != route.ObjectMeta.Name &&
+				rt.Spec.To.Name == svcName {
+				appMgr.enqueueRoute(route)
+				return
+			}
+		}
+	}
+
+	rsDeleted := 0
+	appMgr.resources.Lock()
+	var keys []serviceKey
+	var names []string
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if cfg.MetaData.ResourceType == "route" &&
+			key.Namespace == namespace && key.ServiceName == svcName {
+			keys = append(keys, key)
+			names = append(names, cfg.Virtual.VirtualServerName)
+		}
+	})
+	for i, key := range keys {
+		if appMgr.resources.Delete(key, names[i]) {
+			rsDeleted += 1
+		}
+	}
+	appMgr.resources.Unlock()
+	if rsDeleted > 0 {
+		appMgr.deleteUnusedRoutes(namespace)
+		appMgr.deleteUnusedProfiles()
+		appMgr.outputConfig()
+	}
+	appMgr.enqueueRoute(route)
+}
+
 func (appMgr *Manager) getNamespaceInformer(
 	ns string,
 ) (*appInformer, bool) {
@@ -621,6 +1336,9 @@ func (appMgr *Manager) getNamespaceInformer(
 func (appMgr *Manager) getNamespaceInformerLocked(
 	ns string,
 ) (*appInformer, bool) {
+	if !appMgr.inShard(ns) {
+		return nil, false
+	}
 	toFind := ns
 	if appMgr.watchingAllNamespacesLocked() {
 		toFind = ""
@@ -629,35 +1347,45 @@ func (appMgr *Manager) getNamespaceInformerLocked(
 	return appInf, found
 }
 
+// Check if a namespace belongs to the shard managed by this controller
+func (appMgr *Manager) inShard(namespace string) bool {
+	if appMgr.shard.Total <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	return int(h.Sum32()%uint32(appMgr.shard.Total)) == appMgr.shard.Index
+}
+
 func (appInf *appInformer) start() {
 	go appInf.cfgMapInformer.Run(appInf.stopCh)
 	go appInf.svcInformer.Run(appInf.stopCh)
 	go appInf.endptInformer.Run(appInf.stopCh)
 	go appInf.ingInformer.Run(appInf.stopCh)
+	go appInf.secretInformer.Run(appInf.stopCh)
 	if nil != appInf.routeInformer {
 		go appInf.routeInformer.Run(appInf.stopCh)
 	}
+	if nil != appInf.podInformer {
+		go appInf.podInformer.Run(appInf.stopCh)
+	}
 }
 
 func (appInf *appInformer) waitForCacheSync() {
+	synced := []cache.InformerSynced{
+		appInf.cfgMapInformer.HasSynced,
+		appInf.svcInformer.HasSynced,
+		appInf.endptInformer.HasSynced,
+		appInf.ingInformer.HasSynced,
+		appInf.secretInformer.HasSynced,
+	}
 	if nil != appInf.routeInformer {
-		cache.WaitForCacheSync(
-			appInf.stopCh,
-			appInf.cfgMapInformer.HasSynced,
-			appInf.svcInformer.HasSynced,
-			appInf.endptInformer.HasSynced,
-			appInf.ingInformer.HasSynced,
-			appInf.routeInformer.HasSynced,
-		)
-	} else {
-		cache.WaitForCacheSync(
-			appInf.stopCh,
-			appInf.cfgMapInformer.HasSynced,
-			appInf.svcInformer.HasSynced,
-			appInf.endptInformer.HasSynced,
-			appInf.ingInformer.HasSynced,
-		)
+		synced = append(synced, appInf.routeInformer.HasSynced)
 	}
+	if nil != appInf.podInformer {
+		synced = append(synced, appInf.podInformer.HasSynced)
+	}
+	cache.WaitForCacheSync(appInf.stopCh, synced...)
 }
 
 func (appInf *appInformer) stopInformers() {
@@ -668,6 +1396,40 @@ func (appMgr *Manager) IsNodePort() bool {
 	return appMgr.isNodePort
 }
 
+// Whether the pool members of a resource are nodes and the NodePort. In
+// nodeport mode a resource may use the endpoints of the service instead, if
+// the BIG-IP has routes to the pods; nodes are not watched in cluster mode.
+func (appMgr *Manager) usesNodePort(rsCfg *ResourceConfig) bool {
+	return appMgr.IsNodePort() && "cluster" != rsCfg.MetaData.PoolMemberType
+}
+
+// In cluster mode the nodes are not watched, so the nodeport pool member
+// type is ignored and the endpoints are used. Warned once per virtual
+// server, and again if the annotation is removed and set anew.
+func (appMgr *Manager) checkPoolMemberType(rsCfg *ResourceConfig) {
+	if appMgr.IsNodePort() {
+		return
+	}
+	name := rsCfg.Virtual.VirtualServerName
+	ignored := "nodeport" == rsCfg.MetaData.PoolMemberType
+	appMgr.ignoredMemberTypesMutex.Lock()
+	warned := appMgr.ignoredMemberTypes[name]
+	if ignored {
+		appMgr.ignoredMemberTypes[name] = true
+	} else {
+		delete(appMgr.ignoredMemberTypes, name)
+	}
+	appMgr.ignoredMemberTypesMutex.Unlock()
+	if !ignored || warned {
+		return
+	}
+	msg := fmt.Sprintf("Annotation %v of virtual server '%v' is ignored: "+
+		"the controller runs in cluster mode, the endpoints of the service "+
+		"are used as pool members.", poolMemberTypeAnnotation, name)
+	log.Warning(msg)
+	appMgr.recordConfigIngressEvent(rsCfg, "PoolMemberTypeIgnored", msg)
+}
+
 func (appMgr *Manager) UseNodeInternal() bool {
 	return appMgr.useNodeInternal
 }
@@ -684,15 +1446,40 @@ func (appMgr *Manager) runImpl(stopCh <-chan struct{}) {
 	defer utilruntime.HandleCrash()
 	defer appMgr.vsQueue.ShutDown()
 	defer appMgr.nsQueue.ShutDown()
+	defer appMgr.statusQueue.ShutDown()
+
+	appMgr.startTime = time.Now()
+	appMgr.loadVIPTombstones()
+	appMgr.persistVIPTombstones()
+	if appMgr.initialSyncDeadline > 0 {
+		go appMgr.checkInitialSyncDeadline(stopCh)
+	}
 
 	appMgr.addIRule(httpRedirectIRuleName, DEFAULT_PARTITION,
-		httpRedirectIRule(DEFAULT_HTTPS_PORT))
+		appMgr.redirectIRule(DEFAULT_HTTPS_PORT))
+	appMgr.addIRule(proxyProtocolV1IRuleName, DEFAULT_PARTITION,
+		proxyProtocolV1IRule())
+	appMgr.addIRule(proxyProtocolV2IRuleName, DEFAULT_PARTITION,
+		proxyProtocolV2IRule())
+	appMgr.addIRule(sorryServerIRuleName, DEFAULT_PARTITION,
+		sorryServerIRule())
+	appMgr.addInternalDataGroup(sorryServerPoolsDgName, DEFAULT_PARTITION)
+	appMgr.addInternalDataGroup(sorryServerPagesDgName, DEFAULT_PARTITION)
+	appMgr.addInternalDataGroup(sorryServerCodesDgName, DEFAULT_PARTITION)
+	appMgr.addIRule(hostRedirectIRuleName, DEFAULT_PARTITION,
+		hostRedirectIRule())
+	appMgr.addInternalDataGroup(hostRedirectsDgName, DEFAULT_PARTITION)
+	appMgr.addIRule(universalPersistenceIRuleName, DEFAULT_PARTITION,
+		universalPersistenceIRule())
+	appMgr.addInternalDataGroup(universalPersistenceDgName, DEFAULT_PARTITION)
 
 	if nil != appMgr.routeClientV1 {
 		appMgr.addIRule(
-			sslPassthroughIRuleName, DEFAULT_PARTITION, sslPassthroughIRule())
-		appMgr.addInternalDataGroup(passthroughHostsDgName, DEFAULT_PARTITION)
-		appMgr.addInternalDataGroup(reencryptHostsDgName, DEFAULT_PARTITION)
+			sslPassthroughIRuleName, DEFAULT_PARTITION, appMgr.passthroughIRule())
+		for _, name := range []string{passthroughHostsDgName,
+			reencryptHostsDgName, passthroughIngressHostsDgName} {
+			appMgr.hostDgs.create(nameRef{Name: name, Partition: DEFAULT_PARTITION})
+		}
 	}
 
 	if nil != appMgr.nsInformer {
@@ -701,10 +1488,42 @@ func (appMgr *Manager) runImpl(stopCh <-chan struct{}) {
 		go wait.Until(appMgr.namespaceWorker, time.Second, stopCh)
 	}
 
-	appMgr.startAndSyncAppInformers()
+	if nil != appMgr.nsDefaultsInformer {
+		go appMgr.nsDefaultsInformer.Run(stopCh)
+		cache.WaitForCacheSync(stopCh, appMgr.nsDefaultsInformer.HasSynced)
+	}
+
+	if nil != appMgr.defaultSslSecretInformer {
+		go appMgr.defaultSslSecretInformer.Run(stopCh)
+		cache.WaitForCacheSync(stopCh,
+			appMgr.defaultSslSecretInformer.HasSynced)
+	}
+
+	appMgr.startAppInformers()
+	appMgr.waitForInitialCacheSync()
 
-	// Using only one virtual server worker currently.
+	// Using only one virtual server worker once the initial config is
+	// written.
 	go wait.Until(appMgr.virtualServerWorker, time.Second, stopCh)
+	for i := 1; i < appMgr.initialSyncWorkers; i++ {
+		go appMgr.initialSyncWorker()
+	}
+	go wait.Until(appMgr.statusWorker, time.Second, stopCh)
+	go wait.Until(appMgr.checkQueues, queueCheckInterval, stopCh)
+	go wait.Until(appMgr.reconcileBindAddrAnnotations,
+		bindAddrReconcileInterval, stopCh)
+	go wait.Until(appMgr.checkSchedules, scheduleCheckInterval, stopCh)
+	go wait.Until(appMgr.reloadIRuleTemplates, iRuleTemplateReloadInterval,
+		stopCh)
+	if nil != appMgr.routeClientV1 {
+		go wait.Until(appMgr.publishRouteReport, routeReportInterval, stopCh)
+		go wait.Until(appMgr.reloadDefaultServerCA, serverCAReloadInterval,
+			stopCh)
+	}
+	if 0 != len(appMgr.bigipSources) && nil != appMgr.restClientv1beta1 {
+		go wait.Until(appMgr.checkNetworkPolicies,
+			networkPolicyCheckInterval, stopCh)
+	}
 
 	<-stopCh
 	appMgr.stopAppInformers()
@@ -717,11 +1536,10 @@ func (appMgr *Manager) startAndSyncNamespaceInformer(stopCh <-chan struct{}) {
 	cache.WaitForCacheSync(stopCh, appMgr.nsInformer.HasSynced)
 }
 
-func (appMgr *Manager) startAndSyncAppInformers() {
+func (appMgr *Manager) startAppInformers() {
 	appMgr.informersMutex.Lock()
 	defer appMgr.informersMutex.Unlock()
 	appMgr.startAppInformersLocked()
-	appMgr.waitForCacheSyncLocked()
 }
 
 func (appMgr *Manager) startAppInformersLocked() {
@@ -763,13 +1581,16 @@ func (appMgr *Manager) processNextVirtualServer() bool {
 	}
 	defer appMgr.vsQueue.Done(key)
 
+	appMgr.traces.started(key.(serviceQueueKey))
 	err := appMgr.syncVirtualServer(key.(serviceQueueKey))
+	appMgr.traces.synced(key.(serviceQueueKey), err)
 	if err == nil {
 		appMgr.vsQueue.Forget(key)
 		return true
 	}
 
 	utilruntime.HandleError(fmt.Errorf("Sync %v failed with %v", key, err))
+	appMgr.recordSyncError(key.(serviceQueueKey), err)
 	appMgr.vsQueue.AddRateLimited(key)
 
 	return true
@@ -816,6 +1637,12 @@ func (appMgr *Manager) syncVirtualServer(sKey serviceQueueKey) error {
 	// looping through the ConfigMaps. The value is not currently used.
 	svcPortMap := make(map[int32]bool)
 	var svc *v1.Service
+	if svcFound && isIgnoredService(obj.(*v1.Service)) {
+		// An ignored service is configured as if it did not exist
+		log.Debugf("Service '%v' is ignored by annotation %v.", svcKey,
+			serviceIgnoreAnnotation)
+		svcFound = false
+	}
 	if svcFound {
 		svc = obj.(*v1.Service)
 		for _, portSpec := range svc.Spec.Ports {
@@ -823,20 +1650,31 @@ func (appMgr *Manager) syncVirtualServer(sKey serviceQueueKey) error {
 		}
 	}
 
+	// The configs, profiles and data groups are built from what the other
+	// keys left in the resources, so the keys are synced one at a time
+	appMgr.syncMutex.Lock()
+	defer appMgr.syncMutex.Unlock()
+
 	// rsMap stores all resources currently in Resources matching sKey, indexed by port
 	rsMap := appMgr.getResourcesForKey(sKey)
 
 	var stats vsSyncStats
-	err = appMgr.syncConfigMaps(&stats, sKey, rsMap, svcPortMap, svc, appInf)
-	if nil != err {
-		return err
+	if sKey.syncsKind(configMapKind) {
+		err = appMgr.syncConfigMaps(&stats, sKey, rsMap, svcPortMap, svc,
+			appInf)
+		if nil != err {
+			return err
+		}
 	}
 
-	err = appMgr.syncIngresses(&stats, sKey, rsMap, svcPortMap, svc, appInf)
-	if nil != err {
-		return err
+	if sKey.syncsKind(ingressKind) {
+		err = appMgr.syncIngresses(&stats, sKey, rsMap, svcPortMap, svc,
+			appInf)
+		if nil != err {
+			return err
+		}
 	}
-	if nil != appInf.routeInformer {
+	if nil != appInf.routeInformer && sKey.syncsKind(routeKind) {
 		err = appMgr.syncRoutes(&stats, sKey, rsMap, svcPortMap, svc, appInf)
 		if nil != err {
 			return err
@@ -851,17 +1689,19 @@ func (appMgr *Manager) syncVirtualServer(sKey serviceQueueKey) error {
 	}
 	log.Debugf("Updated %v of %v virtual server configs, deleted %v",
 		stats.vsUpdated, stats.vsFound, stats.vsDeleted)
+	appMgr.traces.syncStats(sKey, stats)
 
 	// delete any custom profiles that are no longer referenced
-	appMgr.deleteUnusedProfiles(sKey.Namespace)
+	appMgr.deleteUnusedProfiles()
 
 	if stats.vsUpdated > 0 || stats.vsDeleted > 0 || stats.cpUpdated > 0 ||
 		stats.dgUpdated > 0 {
+		appMgr.deferChanges(sKey, appInf)
 		appMgr.outputConfig()
 	} else if appMgr.vsQueue.Len() == 0 && appMgr.nsQueue.Len() == 0 {
 		appMgr.resources.Lock()
 		defer appMgr.resources.Unlock()
-		if !appMgr.initialState {
+		if !appMgr.isInitialState() || appMgr.resyncPending() {
 			appMgr.outputConfigLocked()
 		}
 	}
@@ -888,63 +1728,96 @@ func (appMgr *Manager) syncConfigMaps(
 		// We need to look at all config maps in the store, parse the data blob,
 		// and see if it belongs to the service that has changed.
 		cm := obj.(*v1.ConfigMap)
-		if cm.ObjectMeta.Namespace != sKey.Namespace {
+		if cm.ObjectMeta.Namespace != sKey.Namespace ||
+			!sKey.syncsResource(configMapKind,
+				cm.ObjectMeta.Namespace+"/"+cm.ObjectMeta.Name) {
 			continue
 		}
-		rsCfg, err := parseConfigMap(cm)
-		if nil != err {
-			// Ignore this config map for the time being. When the user updates it
-			// so that it is valid it will be requeued.
-			fmt.Errorf("Error parsing ConfigMap %v_%v",
-				cm.ObjectMeta.Namespace, cm.ObjectMeta.Name)
-			continue
-		}
-
-		// Check if SSLProfile(s) are contained in Secrets
-		for _, profile := range rsCfg.Virtual.GetFrontendSslProfileNames() {
-			// Check if profile is contained in a Secret
-			secret, err := appMgr.kubeClient.Core().Secrets(cm.ObjectMeta.Namespace).
-				Get(profile, metav1.GetOptions{})
-			if err != nil {
-				// No secret, so we assume the profile is a BIG-IP default
-				log.Infof("Couldn't find Secret with name '%s', parsing secretName as path.",
-					profile)
-				continue
-			}
-			err, updated := appMgr.handleSslProfile(rsCfg, secret, cm.ObjectMeta.Namespace)
-			if err != nil {
-				log.Warningf("%v", err)
+		for _, def := range parseConfigMapDefinitions(cm) {
+			if nil != def.Err {
+				// Ignore this definition for the time being. When the user
+				// updates it so that it is valid it will be requeued.
 				continue
 			}
-			if updated {
-				stats.cpUpdated += 1
-			}
-			// Replace the current stored sslProfile with a correctly formatted
-			// profile (since this profile is just a secret name)
-			rsCfg.Virtual.RemoveFrontendSslProfileName(profile)
-			secretName := formatIngressSslProfileName(
-				rsCfg.Virtual.Partition + "/" + profile)
-			rsCfg.Virtual.AddFrontendSslProfileName(secretName)
+			appMgr.syncConfigMapDefinition(stats, sKey, rsMap, svcPortMap,
+				svc, appInf, cm, def.Key, def.Cfg)
 		}
+	}
+	return nil
+}
 
-		rsName := rsCfg.Virtual.VirtualServerName
-		if ok, found, updated := appMgr.handleConfigForType(
-			rsCfg, sKey, rsMap, rsName, svcPortMap, svc, appInf, ""); !ok {
-			stats.vsUpdated += updated
+// Sync the virtual server of a data key of a ConfigMap
+func (appMgr *Manager) syncConfigMapDefinition(
+	stats *vsSyncStats,
+	sKey serviceQueueKey,
+	rsMap ResourceMap,
+	svcPortMap map[int32]bool,
+	svc *v1.Service,
+	appInf *appInformer,
+	cm *v1.ConfigMap,
+	key string,
+	rsCfg *ResourceConfig,
+) {
+	// Check if SSLProfile(s) are contained in Secrets
+	for _, profile := range rsCfg.Virtual.GetFrontendSslProfileNames() {
+		// Check if profile is contained in a Secret
+		secret, err := appMgr.getSecret(cm.ObjectMeta.Namespace, profile)
+		if err != nil {
+			// No secret, so we assume the profile is a BIG-IP default
+			log.Infof("Couldn't find Secret with name '%s', parsing secretName as path.",
+				profile)
 			continue
-		} else {
-			stats.vsFound += found
-			stats.vsUpdated += updated
 		}
+		err, updated := appMgr.handleSslProfile(rsCfg, secret, "",
+			cm.ObjectMeta.Annotations)
+		if err != nil {
+			log.Warningf("%v", err)
+			continue
+		}
+		if updated {
+			stats.cpUpdated += 1
+		}
+		// Replace the current stored sslProfile with a correctly formatted
+		// profile (since this profile is just a secret name)
+		rsCfg.Virtual.RemoveFrontendSslProfileName(profile)
+		secretName := formatIngressSslProfileName(
+			rsCfg.Virtual.Partition + "/" + profile)
+		rsCfg.Virtual.AddFrontendSslProfileName(secretName)
+	}
+	if nil != rsCfg.Virtual.ServerSslProfile {
+		updated, err := appMgr.setConfigMapServerSslProfile(
+			rsCfg, cm.ObjectMeta.Namespace)
+		if nil != err {
+			log.Warningf("%v", err)
+		} else if updated {
+			stats.cpUpdated += 1
+		}
+	}
+
+	if appMgr.serviceAddress {
+		appMgr.setServiceAddress(rsCfg, cm.ObjectMeta.Namespace,
+			appInf.svcInformer.GetIndexer())
+	}
+	setStickyBindAddr(rsCfg, cm, key)
+	if appMgr.probeMonitors && rsCfg.Virtual.IApp == "" {
+		appMgr.setProbeHealthMonitors(rsCfg, cm.ObjectMeta.Namespace,
+			appInf.svcInformer.GetIndexer())
+	}
+
+	rsName := rsCfg.Virtual.VirtualServerName
+	ok, found, updated := appMgr.handleConfigForType(
+		rsCfg, sKey, rsMap, rsName, svcPortMap, svc, appInf, "")
+	stats.vsUpdated += updated
+	if !ok {
+		return
+	}
+	stats.vsFound += found
 
-		// Set a status annotation to contain the virtualAddress bindAddr
-		if rsCfg.Virtual.IApp == "" &&
-			rsCfg.Virtual.VirtualAddress != nil &&
-			rsCfg.Virtual.VirtualAddress.BindAddr != "" {
-			appMgr.setBindAddrAnnotation(cm, sKey, rsCfg)
-		}
+	// Set a status annotation to contain the virtualAddress bindAddr,
+	// or remove it if the definition has no active virtual server
+	if addr, synced := appMgr.configMapBindAddr(cm, key); synced {
+		appMgr.setBindAddrAnnotation(cm, key, addr)
 	}
-	return nil
 }
 
 func (appMgr *Manager) syncIngresses(
@@ -962,26 +1835,93 @@ func (appMgr *Manager) syncIngresses(
 			sKey.Namespace, err)
 		return err
 	}
+	// Ingresses of other namespaces may reference services of this one
+	ingByIndex = append(ingByIndex,
+		appMgr.crossNamespaceIngresses(sKey.Namespace)...)
+	// Rebuild the server names of passthrough Ingresses in the namespace,
+	// each held by the oldest Ingress passing it through
+	passthroughHosts := make(map[string]string)
+	hostHolders, claims := appMgr.passthroughHostClaims()
+	appMgr.recordIngressShadows(hostHolders, claims)
+	addresses := appMgr.indexIngressAddresses()
 	for _, obj := range ingByIndex {
 		// We need to look at all ingresses in the store, parse the data blob,
 		// and see if it belongs to the service that has changed.
 		ing := obj.(*v1beta1.Ingress)
-		if ing.ObjectMeta.Namespace != sKey.Namespace {
+		if !sKey.syncsResource(ingressKind,
+			ing.ObjectMeta.Namespace+"/"+ing.ObjectMeta.Name) {
 			continue
 		}
+		crossNamespace := ing.ObjectMeta.Namespace != sKey.Namespace
+		ingInf := appInf
+		if crossNamespace {
+			var found bool
+			ingInf, found = appMgr.getNamespaceInformer(ing.ObjectMeta.Namespace)
+			if !found {
+				continue
+			}
+		}
+		ing = appMgr.ingressWithDefaults(ing)
+		svcIndexer := appMgr.ingressServiceIndexer(ingInf)
 
 		for _, portStruct := range appMgr.virtualPorts(ing) {
-			rsCfg := createRSConfigFromIngress(ing, sKey.Namespace,
-				appInf.svcInformer.GetIndexer(), portStruct)
+			rsCfg := createRSConfigFromIngress(ing, ing.ObjectMeta.Namespace,
+				appMgr.crossNsRefs, svcIndexer, portStruct)
 			if rsCfg == nil {
 				// Currently, an error is returned only if the Ingress is one we
 				// do not care about
 				continue
 			}
 
+			if appMgr.serviceAddress {
+				appMgr.setServiceAddress(rsCfg, ing.ObjectMeta.Namespace,
+					svcIndexer)
+			}
+			appMgr.setReservedBindAddr(rsCfg, ing)
+			if holder, ok := appMgr.vipTombstones.reservedFor(
+				rsCfg.Virtual.VirtualAddress.BindAddr,
+				ing.ObjectMeta.Namespace, ing.ObjectMeta.Name); ok {
+				msg := fmt.Sprintf("Address %v is reserved for deleted "+
+					"%v until %v, not creating virtual server '%v'.",
+					rsCfg.Virtual.VirtualAddress.BindAddr, holder,
+					holder.Expires.Format(time.RFC3339),
+					rsCfg.Virtual.VirtualServerName)
+				log.Warningf("%s", msg)
+				appMgr.recordIngressEvent(ing, "AddressConflict", msg, "")
+				// Synced again once the reservation expires
+				appMgr.enqueueIngressAfter(ing,
+					holder.Expires.Sub(time.Now())+time.Second)
+				continue
+			}
+
+			if holder := appMgr.ingressAddressConflict(addresses, ing,
+				rsCfg.Virtual.VirtualAddress.BindAddr,
+				rsCfg.Virtual.VirtualAddress.Port); nil != holder {
+				msg := fmt.Sprintf("Address %v:%v is used by Ingress '%v/%v', "+
+					"not creating virtual server '%v'.",
+					rsCfg.Virtual.VirtualAddress.BindAddr,
+					rsCfg.Virtual.VirtualAddress.Port,
+					holder.ObjectMeta.Namespace, holder.ObjectMeta.Name,
+					rsCfg.Virtual.VirtualServerName)
+				log.Warningf("%s", msg)
+				appMgr.recordIngressEvent(ing, "AddressConflict", msg, "")
+				// Synced again when the holder changes or is deleted
+				appMgr.addressLosers.add(holder, ing)
+				continue
+			}
+
 			// Handle TLS configuration
-			updated := appMgr.handleIngressTls(rsCfg, ing)
-			if updated {
+			if isPassthroughIngress(ing) {
+				// The server names of an Ingress are only recorded by the
+				// syncs of its own namespace
+				hosts := passthroughHosts
+				if crossNamespace {
+					hosts = make(map[string]string)
+				}
+				if portStruct.protocol == "https" {
+					setIngressPassthrough(rsCfg, ing, hosts, hostHolders)
+				}
+			} else if appMgr.handleIngressTls(rsCfg, ing) {
 				stats.cpUpdated += 1
 			}
 
@@ -999,13 +1939,21 @@ func (appMgr *Manager) syncIngresses(
 				} else {
 					if nil != ing.Spec.Backend {
 						appMgr.handleSingleServiceHealthMonitors(
-							rsName, rsCfg, ing, monitors)
+							rsName, rsCfg, ing, monitors, svcIndexer)
 					} else {
 						appMgr.handleMultiServiceHealthMonitors(
-							rsName, rsCfg, ing, monitors)
+							rsName, rsCfg, ing, monitors, svcIndexer)
 					}
 				}
 				rsCfg.SortMonitors()
+			} else if appMgr.probeMonitors {
+				appMgr.setProbeHealthMonitors(rsCfg, ing.ObjectMeta.Namespace,
+					svcIndexer)
+				rsCfg.SortMonitors()
+			}
+			if err := setCircuitBreaker(rsCfg, ing.ObjectMeta.Annotations); nil != err {
+				log.Warningf("%s", err)
+				appMgr.recordIngressEvent(ing, "InvalidData", err.Error(), rsName)
 			}
 
 			// make sure all policies across configs for this Ingress match each other
@@ -1044,6 +1992,11 @@ func (appMgr *Manager) syncIngresses(
 			appMgr.setIngressStatus(ing, rsCfg)
 		}
 	}
+	// The server names are only complete when all the Ingresses are synced
+	if "" == sKey.ResourceName {
+		appMgr.updatePassthroughIngressDataGroup(
+			stats, sKey.Namespace, passthroughHosts)
+	}
 	return nil
 }
 
@@ -1062,11 +2015,40 @@ func (appMgr *Manager) syncRoutes(
 		return err
 	}
 
+	// Only the oldest of the Routes sharing a host and path is configured
+	claims := routeShadows(routeByIndex, sKey.Namespace)
+	appMgr.recordRouteShadows(sKey.Namespace, routeByIndex, claims)
+	shadowed := make(map[string]ruleClaim)
+	for _, claim := range claims {
+		shadowed[claim.Resource] = claim
+	}
+
 	// Rebuild all internal data groups for routes as we process each
 	dgMap := make(InternalDataGroupMap)
 	for _, route := range routeByIndex {
 		// We need to look at all routes in the store, parse the data blob,
 		// and see if it belongs to the service that has changed.
+		if claim, ok := shadowed[route.ObjectMeta.Namespace+"/"+
+			route.ObjectMeta.Name]; ok {
+			appMgr.removeShadowedRouteRule(route)
+			if route.Spec.To.Name == sKey.ServiceName {
+				appMgr.routeAdmissions.set(route, routeAdmission{
+					Reason:  "HostAlreadyClaimed",
+					Message: claim.message("Route"),
+				})
+			}
+			continue
+		}
+		if appMgr.routeConfig.ExtendedValidation {
+			if err := validateRoute(route); nil != err {
+				// Removed like a shadowed Route, keeping the other Routes
+				appMgr.removeShadowedRouteRule(route)
+				if route.Spec.To.Name == sKey.ServiceName {
+					appMgr.rejectInvalidRoute(route, err)
+				}
+				continue
+			}
+		}
 		if nil != route.Spec.TLS {
 			// The information stored in the internal data groups can span multiple
 			// namespaces, so we need to keep them updated with all current routes
@@ -1081,14 +2063,22 @@ func (appMgr *Manager) syncRoutes(
 		if route.ObjectMeta.Namespace != sKey.Namespace {
 			continue
 		}
-		pStructs := []portStruct{{protocol: "http", port: DEFAULT_HTTP_PORT},
-			{protocol: "https", port: DEFAULT_HTTPS_PORT}}
+		// A re-created Route serves its host from the shared address again
+		appMgr.vipTombstones.release(routeKind, route.ObjectMeta.Namespace,
+			route.ObjectMeta.Name)
+		route = appMgr.routeWithDefaults(route)
+		// The admission of a Route is found by the syncs of its service
+		var adm routeAdmission
+		ownSvc := route.Spec.To.Name == sKey.ServiceName
+		pStructs, disabled := appMgr.routePorts(route)
+		appMgr.removeDisabledRouteRules(route, disabled)
 		for _, ps := range pStructs {
 			rsCfg, err := createRSConfigFromRoute(route,
 				*appMgr.resources, appMgr.routeConfig, ps)
 			if err != nil {
 				// We return err if there was an error creating a rule
 				log.Warningf("%v", err)
+				adm.Reason, adm.Message = "InvalidRule", err.Error()
 				continue
 			}
 
@@ -1097,20 +2087,30 @@ func (appMgr *Manager) syncRoutes(
 				&rsCfg, sKey, rsMap, rsName, svcPortMap, svc, appInf,
 				route.Spec.To.Name); !ok {
 				stats.vsUpdated += updated
+				if nil == svc {
+					adm.Reason = "ServiceNotFound"
+					adm.Message = fmt.Sprintf("Service '%v' has not been found.",
+						route.Spec.To.Name)
+				}
 				continue
 			} else {
 				stats.vsFound += found
 				stats.vsUpdated += updated
 			}
+			if routeServedBy(route, ps.protocol) {
+				adm.Virtuals = append(adm.Virtuals, rsName)
+			}
 
 			// We store this same config on every route that has the same protocol, but it is only
 			// written to the BIG-IP once. This block guarantees that all of these configs
 			// are in the same state.
 			appMgr.resources.Lock()
 			cfgs, keys := appMgr.resources.GetAllWithName(rsCfg.Virtual.VirtualServerName)
+			rsHash := rsCfg.contentHash()
 			for i, cfg := range cfgs {
 				if cfg.Virtual.Partition == rsCfg.Virtual.Partition &&
-					!reflect.DeepEqual(cfg, rsCfg) {
+					!appMgr.resources.HashMatches(keys[i],
+						cfg.Virtual.VirtualServerName, rsHash) {
 					cfg = &rsCfg
 					appMgr.resources.Assign(keys[i], cfg.Virtual.VirtualServerName, cfg)
 				}
@@ -1118,54 +2118,65 @@ func (appMgr *Manager) syncRoutes(
 			appMgr.resources.Unlock()
 
 			// TLS Cert/Key
-			if nil != route.Spec.TLS &&
-				rsCfg.Virtual.VirtualAddress.Port == DEFAULT_HTTPS_PORT {
+			if nil != route.Spec.TLS && ps.protocol == "https" {
 				switch route.Spec.TLS.Termination {
 				case routeapi.TLSTerminationEdge:
-					appMgr.setClientSslProfile(stats, sKey, &rsCfg, route)
+					appMgr.setClientSslProfile(stats, &rsCfg, route)
 				case routeapi.TLSTerminationReencrypt:
-					appMgr.setClientSslProfile(stats, sKey, &rsCfg, route)
-					appMgr.setServerSslProfile(stats, sKey, &rsCfg, route)
+					appMgr.setClientSslProfile(stats, &rsCfg, route)
+					appMgr.setServerSslProfile(stats, &rsCfg, route)
 				}
 			}
 		}
+		if 0 != len(disabled) && "" == adm.Reason && 0 == len(adm.Virtuals) {
+			adm.Reason = "ProtocolDisabled"
+			adm.Message = "The virtual servers of the protocol of the Route " +
+				"are disabled."
+		}
+		if ownSvc {
+			appMgr.routeAdmissions.set(route, adm)
+		}
 	}
 
 	// Update internal data groups for routes if changed
-	appMgr.updateRouteDataGroups(stats, dgMap)
+	appMgr.updateRouteDataGroups(stats, sKey.Namespace, dgMap)
 
 	return nil
 }
 
 func (appMgr *Manager) setClientSslProfile(
 	stats *vsSyncStats,
-	sKey serviceQueueKey,
 	rsCfg *ResourceConfig,
 	route *routeapi.Route,
 ) {
+	if "" == route.Spec.TLS.Certificate || "" == route.Spec.TLS.Key {
+		// Without a certificate, the Route uses the default TLS Secret or
+		// the BIG-IP default profile
+		updated, found := appMgr.setDefaultClientSslProfile(rsCfg)
+		if updated {
+			stats.cpUpdated += 1
+		}
+		if found {
+			return
+		}
+	}
 	profileName := "Common/clientssl"
 	if "" != route.Spec.TLS.Certificate && "" != route.Spec.TLS.Key {
 		cp := CustomProfile{
-			Name:       route.ObjectMeta.Name + "-https-cert",
+			Name:       formatRouteClientSslProfileName(route),
 			Partition:  rsCfg.Virtual.Partition,
 			Context:    customProfileClient,
 			Cert:       route.Spec.TLS.Certificate,
 			Key:        route.Spec.TLS.Key,
 			ServerName: route.Spec.Host,
 		}
-		skey := secretKey{
-			Name:         cp.Name,
-			Namespace:    sKey.Namespace,
-			ResourceName: rsCfg.Virtual.VirtualServerName,
-		}
+		setSslSessionOptions(&cp, route.ObjectMeta.Annotations,
+			route.ObjectMeta.Name)
 		appMgr.customProfiles.Lock()
 		defer appMgr.customProfiles.Unlock()
-		if prof, ok := appMgr.customProfiles.profs[skey]; ok {
-			if !reflect.DeepEqual(prof, cp) {
-				stats.cpUpdated += 1
-			}
+		if appMgr.customProfiles.Add(profileOwner(rsCfg), cp) {
+			stats.cpUpdated += 1
 		}
-		appMgr.customProfiles.profs[skey] = cp
 		profileName = fmt.Sprintf("%s/%s", cp.Partition, cp.Name)
 	}
 	rsCfg.Virtual.AddFrontendSslProfileName(profileName)
@@ -1173,35 +2184,39 @@ func (appMgr *Manager) setClientSslProfile(
 
 func (appMgr *Manager) setServerSslProfile(
 	stats *vsSyncStats,
-	sKey serviceQueueKey,
 	rsCfg *ResourceConfig,
 	route *routeapi.Route,
 ) {
-	if "" != route.Spec.TLS.DestinationCACertificate {
+	caCert := route.Spec.TLS.DestinationCACertificate
+	secretName, ok := route.ObjectMeta.Annotations[serverCASecretAnnotation]
+	if ok {
+		// A CA bundle shared through a Secret takes precedence, so it can be
+		// rotated without editing the Routes
+		cert, err := appMgr.getSecretCACert(route.ObjectMeta.Namespace,
+			secretName)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+				secretName, serverCASecretAnnotation, route.ObjectMeta.Name, err)
+		} else {
+			caCert = cert
+		}
+	}
+	if "" != caCert {
 		// Create new SSL server profile with the provided CA Certificate.
-		ruleName := formatRouteRuleName(route)
 		profile := ProfileRef{
-			Name:      ruleName + "-server-ssl",
+			Name:      formatRouteServerSslProfileName(route),
 			Partition: rsCfg.Virtual.Partition,
 			Context:   customProfileServer,
 		}
-		cp := NewCustomProfile(profile, route.Spec.TLS.DestinationCACertificate)
-		skey := secretKey{
-			Name:         cp.Name,
-			Namespace:    sKey.Namespace,
-			ResourceName: rsCfg.Virtual.VirtualServerName,
-		}
+		cp := NewCustomProfile(profile, caCert)
 		appMgr.customProfiles.Lock()
 		defer appMgr.customProfiles.Unlock()
-		if prof, ok := appMgr.customProfiles.profs[skey]; ok {
-			if !reflect.DeepEqual(prof, cp) {
-				stats.cpUpdated += 1
-			}
+		if appMgr.customProfiles.Add(profileOwner(rsCfg), cp) {
+			stats.cpUpdated += 1
 		}
-		appMgr.customProfiles.profs[skey] = cp
 		rsCfg.Virtual.AddOrUpdateProfile(profile)
 	} else {
-		profile, added := appMgr.loadDefaultCert(sKey.Namespace)
+		profile, added := appMgr.loadDefaultCert(profileOwner(rsCfg))
 		if nil != profile {
 			rsCfg.Virtual.AddOrUpdateProfile(*profile)
 		}
@@ -1211,6 +2226,60 @@ func (appMgr *Manager) setServerSslProfile(
 	}
 }
 
+// Attach the server SSL profile requested by a ConfigMap to its virtual.
+// A CA Secret results in a custom server SSL profile, in the same way as
+// the destination CA certificate of a reencrypt Route.
+func (appMgr *Manager) setConfigMapServerSslProfile(
+	rsCfg *ResourceConfig,
+	namespace string,
+) (bool, error) {
+	serverSsl := rsCfg.Virtual.ServerSslProfile
+	if "" != serverSsl.F5ProfileName {
+		p := strings.Split(serverSsl.F5ProfileName, "/")
+		if len(p) != 2 {
+			return false, fmt.Errorf(
+				"Could not parse partition and name from server SSL profile: %s",
+				serverSsl.F5ProfileName)
+		}
+		rsCfg.Virtual.AddOrUpdateProfile(ProfileRef{
+			Name:      p[1],
+			Partition: p[0],
+			Context:   customProfileServer,
+		})
+		return false, nil
+	}
+
+	caCert, err := appMgr.getSecretCACert(namespace, serverSsl.CASecret)
+	if nil != err {
+		return false, err
+	}
+	profile := ProfileRef{
+		Name:      rsCfg.Virtual.VirtualServerName + "-server-ssl",
+		Partition: rsCfg.Virtual.Partition,
+		Context:   customProfileServer,
+	}
+	cp := NewCustomProfile(profile, caCert)
+	appMgr.customProfiles.Lock()
+	defer appMgr.customProfiles.Unlock()
+	updated := appMgr.customProfiles.Add(profileOwner(rsCfg), cp)
+	rsCfg.Virtual.AddOrUpdateProfile(profile)
+	return updated, nil
+}
+
+// CA bundle for server-side verification, from the 'ca.crt' field of a Secret
+func (appMgr *Manager) getSecretCACert(namespace, name string) (string, error) {
+	secret, err := appMgr.getSecret(namespace, name)
+	if nil != err {
+		return "", fmt.Errorf("Unable to get CA Secret '%v': %v", name, err)
+	}
+	caCert, ok := secret.Data["ca.crt"]
+	if !ok {
+		return "", fmt.Errorf(
+			"Invalid Secret '%v': 'ca.crt' field not specified.", name)
+	}
+	return string(caCert), nil
+}
+
 func getBooleanAnnotation(
 	annotations map[string]string,
 	key string,
@@ -1228,12 +2297,6 @@ func getBooleanAnnotation(
 	return bVal
 }
 
-type secretKey struct {
-	Name         string
-	Namespace    string
-	ResourceName string
-}
-
 // Return value is whether or not a custom profile was updated
 func (appMgr *Manager) handleIngressTls(
 	rsCfg *ResourceConfig,
@@ -1261,10 +2324,37 @@ func (appMgr *Manager) handleIngressTls(
 	// then we don't need a redirect policy, only profiles
 	if rsCfg.Virtual.VirtualAddress.Port == httpsPort {
 		var cpUpdated, updateState bool
+		// Hosts already claimed by a TLS entry, mapped to its Secret
+		hostSecrets := make(map[string]string)
 		for _, tls := range ing.Spec.TLS {
+			if host, conflict := tlsHostConflict(hostSecrets, tls); conflict {
+				msg := fmt.Sprintf("TLS host '%s' for Secret '%s' is already "+
+					"served by Secret '%s', ignoring Secret '%s'.", host,
+					tls.SecretName, hostSecrets[host], tls.SecretName)
+				log.Warningf("%s", msg)
+				appMgr.recordIngressEvent(ing, "TLSHostConflict", msg,
+					rsCfg.Virtual.VirtualServerName)
+				continue
+			}
+			for _, host := range tls.Hosts {
+				hostSecrets[host] = tls.SecretName
+			}
+			if "" == tls.SecretName {
+				// TLS without a certificate uses the default TLS Secret
+				if cpUpdated, found := appMgr.setDefaultClientSslProfile(
+					rsCfg); found {
+					updateState = updateState || cpUpdated
+					continue
+				}
+			}
 			// Check if profile is contained in a Secret
-			secret, err := appMgr.kubeClient.Core().Secrets(ing.ObjectMeta.Namespace).
-				Get(tls.SecretName, metav1.GetOptions{})
+			secret, err := appMgr.getSecret(ing.ObjectMeta.Namespace,
+				tls.SecretName)
+			if err != nil && isCertManagerIngress(ing) {
+				// The Secret is not a BIG-IP profile, it has yet to be issued
+				appMgr.waitForCertificate(rsCfg, ing, tls.SecretName)
+				continue
+			}
 			if err != nil {
 				// No secret, so we assume the profile is a BIG-IP default
 				log.Infof("Couldn't find Secret with name '%s': %s. Parsing secretName as path.",
@@ -1273,7 +2363,9 @@ func (appMgr *Manager) handleIngressTls(
 				rsCfg.Virtual.AddFrontendSslProfileName(secretName)
 				continue
 			}
-			err, cpUpdated = appMgr.handleSslProfile(rsCfg, secret, ing.ObjectMeta.Namespace)
+			appMgr.certificateIssued(ing.ObjectMeta.Namespace, tls.SecretName)
+			err, cpUpdated = appMgr.handleSslProfile(rsCfg, secret,
+				tlsServerName(tls.Hosts), ing.ObjectMeta.Annotations)
 			if err != nil {
 				log.Warningf("%v", err)
 				continue
@@ -1283,7 +2375,7 @@ func (appMgr *Manager) handleIngressTls(
 				rsCfg.Virtual.Partition + "/" + tls.SecretName)
 			rsCfg.Virtual.AddFrontendSslProfileName(secretName)
 		}
-		return cpUpdated
+		return updateState
 	}
 
 	// sslRedirect defaults to true, allowHttp defaults to false.
@@ -1311,7 +2403,7 @@ func (appMgr *Manager) handleIngressTls(
 		if httpsPort != DEFAULT_HTTPS_PORT {
 			ruleName = fmt.Sprintf("%s_%d", ruleName, httpsPort)
 			appMgr.addIRule(ruleName, DEFAULT_PARTITION,
-				httpRedirectIRule(httpsPort))
+				appMgr.redirectIRule(httpsPort))
 		}
 		rsCfg.Virtual.AddIRule(ruleName)
 	} else if allowHttp {
@@ -1332,10 +2424,52 @@ func (appMgr *Manager) handleIngressTls(
 	return false
 }
 
+// Returns the first host of a TLS entry that an earlier entry already
+// claimed with a different Secret
+func tlsHostConflict(
+	hostSecrets map[string]string,
+	tls v1beta1.IngressTLS,
+) (string, bool) {
+	for _, host := range tls.Hosts {
+		if secret, ok := hostSecrets[host]; ok && secret != tls.SecretName {
+			return host, true
+		}
+	}
+	return "", false
+}
+
+// Server name for the SNI-scoped profile of a TLS entry. A single host is
+// used as is; hosts sharing a parent domain are covered by a wildcard (as
+// served by a wildcard Secret). Otherwise the profile is not SNI-scoped.
+func tlsServerName(hosts []string) string {
+	if 0 == len(hosts) {
+		return ""
+	}
+	if 1 == len(hosts) {
+		return hosts[0]
+	}
+	var parent string
+	for _, host := range hosts {
+		labels := strings.SplitN(host, ".", 2)
+		if 2 != len(labels) || "" == labels[1] {
+			return ""
+		}
+		if "" == parent {
+			parent = labels[1]
+		} else if parent != labels[1] {
+			log.Debugf("TLS hosts %v do not share a domain, not setting a "+
+				"server name.", hosts)
+			return ""
+		}
+	}
+	return "*." + parent
+}
+
 func (appMgr *Manager) handleSslProfile(
 	rsCfg *ResourceConfig,
 	secret *v1.Secret,
-	namespace string) (error, bool) {
+	serverName string,
+	annotations map[string]string) (error, bool) {
 	if _, ok := secret.Data["tls.crt"]; !ok {
 		err := fmt.Errorf("Invalid Secret '%v': 'tls.crt' field not specified.",
 			secret.ObjectMeta.Name)
@@ -1348,29 +2482,17 @@ func (appMgr *Manager) handleSslProfile(
 	}
 
 	cp := CustomProfile{
-		Name:      secret.ObjectMeta.Name,
-		Partition: rsCfg.Virtual.Partition,
-		Context:   customProfileClient,
-		Cert:      string(secret.Data["tls.crt"]),
-		Key:       string(secret.Data["tls.key"]),
-	}
-	skey := secretKey{
-		Name:         cp.Name,
-		Namespace:    namespace,
-		ResourceName: rsCfg.Virtual.VirtualServerName,
-	}
+		Name:       secret.ObjectMeta.Name,
+		Partition:  rsCfg.Virtual.Partition,
+		Context:    customProfileClient,
+		Cert:       string(secret.Data["tls.crt"]),
+		Key:        string(secret.Data["tls.key"]),
+		ServerName: serverName,
+	}
+	setSslSessionOptions(&cp, annotations, secret.ObjectMeta.Name)
 	appMgr.customProfiles.Lock()
 	defer appMgr.customProfiles.Unlock()
-	if prof, ok := appMgr.customProfiles.profs[skey]; ok {
-		if !reflect.DeepEqual(prof, cp) {
-			appMgr.customProfiles.profs[skey] = cp
-			return nil, true
-		} else {
-			return nil, false
-		}
-	}
-	appMgr.customProfiles.profs[skey] = cp
-	return nil, false
+	return nil, appMgr.customProfiles.Add(profileOwner(rsCfg), cp)
 }
 
 type portStruct struct {
@@ -1380,6 +2502,18 @@ type portStruct struct {
 
 // Return the required ports for Ingress VS (depending on sslRedirect/allowHttp vals)
 func (appMgr *Manager) virtualPorts(ing *v1beta1.Ingress) []portStruct {
+	// The namespace may set other defaults for sslRedirect and allowHttp
+	annotations := appMgr.withNamespaceDefaults(ing.ObjectMeta.Namespace,
+		ing.ObjectMeta.Annotations)
+	return ingressVirtualPorts(ing, annotations)
+}
+
+// Ports of the virtual servers of an Ingress, with the annotations that
+// apply to it
+func ingressVirtualPorts(
+	ing *v1beta1.Ingress,
+	annotations map[string]string,
+) []portStruct {
 	var httpPort int32
 	var httpsPort int32
 	if port, ok := ing.ObjectMeta.Annotations["virtual-server.f5.com/http-port"]; ok == true {
@@ -1394,11 +2528,9 @@ func (appMgr *Manager) virtualPorts(ing *v1beta1.Ingress) []portStruct {
 	} else {
 		httpsPort = DEFAULT_HTTPS_PORT
 	}
-	// sslRedirect defaults to true, allowHttp defaults to false.
-	sslRedirect := getBooleanAnnotation(ing.ObjectMeta.Annotations,
-		ingressSslRedirect, true)
-	allowHttp := getBooleanAnnotation(ing.ObjectMeta.Annotations,
-		ingressAllowHttp, false)
+	// sslRedirect defaults to true, allowHttp defaults to false
+	sslRedirect := getBooleanAnnotation(annotations, ingressSslRedirect, true)
+	allowHttp := getBooleanAnnotation(annotations, ingressAllowHttp, false)
 
 	http := portStruct{
 		protocol: "http",
@@ -1409,7 +2541,7 @@ func (appMgr *Manager) virtualPorts(ing *v1beta1.Ingress) []portStruct {
 		port:     httpsPort,
 	}
 	var ports []portStruct
-	if len(ing.Spec.TLS) > 0 {
+	if len(ing.Spec.TLS) > 0 || isPassthroughIngress(ing) {
 		if sslRedirect || allowHttp {
 			// States 2,3; both HTTP and HTTPS
 			// 2 virtual servers needed
@@ -1426,6 +2558,19 @@ func (appMgr *Manager) virtualPorts(ing *v1beta1.Ingress) []portStruct {
 	return ports
 }
 
+// Order Ingresses by creation time, then by namespace and name
+func ingressCreatedBefore(a, b *v1beta1.Ingress) bool {
+	ta := a.ObjectMeta.CreationTimestamp
+	tb := b.ObjectMeta.CreationTimestamp
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	if a.ObjectMeta.Namespace != b.ObjectMeta.Namespace {
+		return a.ObjectMeta.Namespace < b.ObjectMeta.Namespace
+	}
+	return a.ObjectMeta.Name < b.ObjectMeta.Name
+}
+
 // Common handling function for ConfigMaps, Ingresses, and Routes
 func (appMgr *Manager) handleConfigForType(
 	rsCfg *ResourceConfig,
@@ -1440,18 +2585,15 @@ func (appMgr *Manager) handleConfigForType(
 	vsFound := 0
 	vsUpdated := 0
 
-	var pool Pool
-	found := false
-	plIdx := 0
+	// A resource may reference several ports of the same service,
+	// each of which has its own pool.
+	var plIdxs []int
 	for i, pl := range rsCfg.Pools {
-		if pl.ServiceName == sKey.ServiceName {
-			found = true
-			pool = pl
-			plIdx = i
-			break
+		if pl.forService(sKey) {
+			plIdxs = append(plIdxs, i)
 		}
 	}
-	if !found {
+	if len(plIdxs) == 0 {
 		// If the current cfg has no pool for this service,
 		// remove any pools associated with the service,
 		// across all stored keys for the resource
@@ -1460,7 +2602,7 @@ func (appMgr *Manager) handleConfigForType(
 		cfgs, keys := appMgr.resources.GetAllWithName(rsName)
 		for i, cfg := range cfgs {
 			for j, pool := range cfg.Pools {
-				if pool.ServiceName == sKey.ServiceName {
+				if pool.forService(sKey) {
 					copy(cfg.Pools[j:], cfg.Pools[j+1:])
 					cfg.Pools[len(cfg.Pools)-1] = Pool{}
 					cfg.Pools = cfg.Pools[:len(cfg.Pools)-1]
@@ -1470,6 +2612,34 @@ func (appMgr *Manager) handleConfigForType(
 		}
 		return false, vsFound, vsUpdated
 	}
+
+	handled := false
+	for _, plIdx := range plIdxs {
+		ok, found, updated := appMgr.handlePoolForType(rsCfg, sKey, rsMap,
+			rsName, svcPortMap, svc, appInf, currRouteSvc, plIdx)
+		handled = handled || ok
+		vsFound += found
+		vsUpdated += updated
+	}
+	return handled, vsFound, vsUpdated
+}
+
+// Update a single pool of a resource for the service being processed
+func (appMgr *Manager) handlePoolForType(
+	rsCfg *ResourceConfig,
+	sKey serviceQueueKey,
+	rsMap ResourceMap,
+	rsName string,
+	svcPortMap map[int32]bool,
+	svc *v1.Service,
+	appInf *appInformer,
+	currRouteSvc string,
+	plIdx int,
+) (bool, int, int) {
+	vsFound := 0
+	vsUpdated := 0
+
+	pool := rsCfg.Pools[plIdx]
 	svcKey := serviceKey{
 		Namespace:   sKey.Namespace,
 		ServiceName: pool.ServiceName,
@@ -1495,6 +2665,30 @@ func (appMgr *Manager) handleConfigForType(
 		}
 	}
 
+	if nil != pool.Fqdn {
+		// The BIG-IP resolves the members of FQDN pools, they are active
+		// whatever the service
+		rsCfg.MetaData.Active = true
+		rsCfg.Pools[plIdx].Members = nil
+		if appMgr.saveVirtualServer(svcKey, rsName, rsCfg) {
+			vsUpdated += 1
+		}
+		return true, vsFound + 1, vsUpdated
+	}
+
+	if _, ok := svcPortMap[pool.ServicePort]; 0 != len(pool.StaticMembers) &&
+		(nil == svc || !ok) {
+		// Pools with static members keep serving them while their service
+		// or its port is missing, and pools without a service only have them
+		rsCfg.MetaData.Active = true
+		rsCfg.Pools[plIdx].Members =
+			append([]Member(nil), pool.StaticMembers...)
+		if appMgr.saveVirtualServer(svcKey, rsName, rsCfg) {
+			vsUpdated += 1
+		}
+		return true, vsFound + 1, vsUpdated
+	}
+
 	if _, ok := svcPortMap[pool.ServicePort]; !ok {
 		log.Debugf("Process Service delete - name: %v namespace: %v",
 			pool.ServiceName, svcKey.Namespace)
@@ -1510,13 +2704,12 @@ func (appMgr *Manager) handleConfigForType(
 		log.Infof("Service '%v' has not been found.", pool.ServiceName)
 		if appMgr.deactivateVirtualServer(svcKey, rsName, rsCfg, plIdx) {
 			vsUpdated += 1
-		}
 
-		// If this is an Ingress resource, add an event that the service wasn't found
-		if strings.HasSuffix(rsName, "ingress") {
+			// If this is an Ingress resource, add an event that the service
+			// wasn't found
 			msg := fmt.Sprintf("Service '%v' has not been found.",
 				pool.ServiceName)
-			appMgr.recordIngressEvent(nil, "ServiceNotFound", msg, rsName)
+			appMgr.recordConfigIngressEvent(rsCfg, "ServiceNotFound", msg)
 		}
 		return false, vsFound, vsUpdated
 	}
@@ -1526,24 +2719,48 @@ func (appMgr *Manager) handleConfigForType(
 	correctBackend := true
 	var reason string
 	var msg string
-	if appMgr.IsNodePort() {
+	appMgr.checkPoolMemberType(rsCfg)
+	if appMgr.usesNodePort(rsCfg) {
 		correctBackend, reason, msg =
 			appMgr.updatePoolMembersForNodePort(svc, svcKey, rsCfg, plIdx)
 	} else {
 		correctBackend, reason, msg =
 			appMgr.updatePoolMembersForCluster(svc, svcKey, rsCfg, appInf, plIdx)
 	}
+	if 0 != len(pool.StaticMembers) {
+		// The static members are served whatever the state of the service
+		rsCfg.MetaData.Active = true
+		rsCfg.Pools[plIdx].Members = mergeStaticMembers(
+			rsCfg.Pools[plIdx].Members, pool.StaticMembers)
+	}
+	members := appMgr.limitPoolMembers(rsCfg, plIdx)
 
 	// This will only update the config if the vs actually changed.
 	if appMgr.saveVirtualServer(svcKey, rsName, rsCfg) {
 		vsUpdated += 1
 
-		// If this is an Ingress resource, add an event if there was a backend error
+		if 0 != members {
+			msg := fmt.Sprintf("Pool %v has %v members, only the first %v "+
+				"are configured on the BIG-IP.", rsCfg.Pools[plIdx].Name,
+				members, len(rsCfg.Pools[plIdx].Members))
+			log.Warning(msg)
+			appMgr.recordServiceEvent(serviceQueueKey{
+				Namespace:   svcKey.Namespace,
+				ServiceName: svcKey.ServiceName,
+			}, v1.EventTypeWarning, "PoolMemberLimitExceeded", msg)
+		}
+
 		if !correctBackend {
-			if strings.HasSuffix(rsCfg.Virtual.VirtualServerName, "ingress") {
-				appMgr.recordIngressEvent(nil, reason, msg,
-					rsCfg.Virtual.VirtualServerName)
+			// Report why a pool in nodeport mode has no members on its service
+			if "" != rsCfg.Pools[plIdx].NodePortError {
+				log.Warning(msg)
+				appMgr.recordServiceEvent(serviceQueueKey{
+					Namespace:   svcKey.Namespace,
+					ServiceName: svcKey.ServiceName,
+				}, v1.EventTypeWarning, reason, msg)
 			}
+			// If this is an Ingress resource, add an event if there was a backend error
+			appMgr.recordConfigIngressEvent(rsCfg, reason, msg)
 		}
 	}
 
@@ -1559,20 +2776,44 @@ func (appMgr *Manager) updatePoolMembersForNodePort(
 	if svc.Spec.Type == v1.ServiceTypeNodePort {
 		for _, portSpec := range svc.Spec.Ports {
 			if portSpec.Port == svcKey.ServicePort {
+				if 0 == portSpec.NodePort {
+					msg := fmt.Sprintf("Port %v of service '%v/%v' has no node "+
+						"port allocated, pool %v has no members",
+						portSpec.Port, svcKey.Namespace, svcKey.ServiceName,
+						rsCfg.Pools[index].Name)
+					log.Debug(msg)
+					clearNodePortPool(rsCfg, index, nodePortNotAllocated)
+					return false, nodePortNotAllocated, msg
+				}
 				log.Debugf("Service backend matched %+v: using node port %v",
 					svcKey, portSpec.NodePort)
 				rsCfg.MetaData.Active = true
 				rsCfg.MetaData.NodePort = portSpec.NodePort
 				rsCfg.Pools[index].Members =
 					appMgr.getEndpointsForNodePort(portSpec.NodePort)
+				rsCfg.Pools[index].NodePortError = ""
 			}
 		}
 		return true, "", ""
 	} else {
-		msg := fmt.Sprintf("Requested service backend '%+v' not of NodePort type",
-			svcKey.ServiceName)
+		msg := fmt.Sprintf("Requested service backend '%v/%v' not of NodePort "+
+			"type but %v, pool %v has no members", svcKey.Namespace,
+			svcKey.ServiceName, svc.Spec.Type, rsCfg.Pools[index].Name)
 		log.Debug(msg)
-		return false, "IncorrectBackendServiceType", msg
+		clearNodePortPool(rsCfg, index, incorrectBackendServiceType)
+		return false, incorrectBackendServiceType, msg
+	}
+}
+
+// Remove the members of a pool whose service has no node port for it, rather
+// than keep sending traffic to a port since reallocated. The virtual server
+// is deactivated when it has no other pool, Routes and Ingresses sharing it
+// with other services keep being served.
+func clearNodePortPool(rsCfg *ResourceConfig, index int, reason string) {
+	rsCfg.Pools[index].Members = nil
+	rsCfg.Pools[index].NodePortError = reason
+	if 1 == len(rsCfg.Pools) {
+		rsCfg.MetaData.Active = false
 	}
 }
 
@@ -1593,7 +2834,7 @@ func (appMgr *Manager) updatePoolMembersForCluster(
 	eps, _ := item.(*v1.Endpoints)
 	for _, portSpec := range svc.Spec.Ports {
 		if portSpec.Port == sKey.ServicePort {
-			ipPorts := getEndpointsForService(portSpec.Name, eps)
+			ipPorts := getEndpointsForService(portSpec, eps)
 			log.Debugf("Found endpoints for backend %+v: %v", sKey, ipPorts)
 			rsCfg.MetaData.Active = true
 			rsCfg.Pools[index].Members = ipPorts
@@ -1611,10 +2852,10 @@ func (appMgr *Manager) deactivateVirtualServer(
 	updateConfig := false
 	appMgr.resources.Lock()
 	defer appMgr.resources.Unlock()
-	if rs, ok := appMgr.resources.Get(sKey, rsName); ok {
+	if _, ok := appMgr.resources.Get(sKey, rsName); ok {
 		rsCfg.MetaData.Active = false
 		rsCfg.Pools[index].Members = nil
-		if !reflect.DeepEqual(rs, rsCfg) {
+		if !appMgr.resources.HashMatches(sKey, rsName, rsCfg.contentHash()) {
 			log.Debugf("Service delete matching backend %v %v deactivating config",
 				sKey, rsName)
 			updateConfig = true
@@ -1637,8 +2878,8 @@ func (appMgr *Manager) saveVirtualServer(
 ) bool {
 	appMgr.resources.Lock()
 	defer appMgr.resources.Unlock()
-	if oldRsCfg, ok := appMgr.resources.Get(sKey, rsName); ok {
-		if reflect.DeepEqual(oldRsCfg, newRsCfg) {
+	if _, ok := appMgr.resources.Get(sKey, rsName); ok {
+		if appMgr.resources.HashMatches(sKey, rsName, newRsCfg.contentHash()) {
 			// not changed, don't trigger a config write
 			return false
 		}
@@ -1655,7 +2896,7 @@ func (appMgr *Manager) getResourcesForKey(sKey serviceQueueKey) ResourceMap {
 	rsMap := make(ResourceMap)
 	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
 		if key.Namespace == sKey.Namespace &&
-			key.ServiceName == sKey.ServiceName {
+			key.ServiceName == sKey.ServiceName && sKey.owns(cfg) {
 			rsMap[key.ServicePort] =
 				append(rsMap[key.ServicePort], cfg)
 		}
@@ -1702,7 +2943,15 @@ func (appMgr *Manager) deleteUnusedResources(
 func (appMgr *Manager) deleteUnusedRoutes(namespace string) {
 	appMgr.resources.Lock()
 	defer appMgr.resources.Unlock()
-	var routeName string
+	// Only remove the client SSL profile of a rule created for a Route, the
+	// profile is named after the rule. Legacy rule names that cannot be
+	// parsed are still Route rules.
+	removeRuleProfile := func(cfg *ResourceConfig, rule *Rule) {
+		if isRouteRuleName(rule.Name) {
+			cfg.Virtual.RemoveFrontendSslProfileName(fmt.Sprintf(
+				"%s/%s-https-cert", cfg.Virtual.Partition, rule.Name))
+		}
+	}
 	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
 		if cfg.MetaData.ResourceType == "route" {
 			for i, pool := range cfg.Pools {
@@ -1716,6 +2965,10 @@ func (appMgr *Manager) deleteUnusedRoutes(namespace string) {
 					// Delete rule
 					for _, pol := range cfg.Policies {
 						if len(pol.Rules) == 1 {
+							rule := pol.Rules[0]
+							if len(rule.Actions) > 0 && rule.Actions[0].Pool == poolName {
+								removeRuleProfile(cfg, rule)
+							}
 							nr := nameRef{
 								Name:      pol.Name,
 								Partition: pol.Partition,
@@ -1725,7 +2978,7 @@ func (appMgr *Manager) deleteUnusedRoutes(namespace string) {
 						}
 						for i, rule := range pol.Rules {
 							if len(rule.Actions) > 0 && rule.Actions[0].Pool == poolName {
-								routeName = strings.Split(rule.Name, "_")[3]
+								removeRuleProfile(cfg, rule)
 								if i >= len(pol.Rules)-1 {
 									pol.Rules = pol.Rules[:len(pol.Rules)-1]
 								} else {
@@ -1745,12 +2998,6 @@ func (appMgr *Manager) deleteUnusedRoutes(namespace string) {
 						cfg.Pools[len(cfg.Pools)-1] = Pool{}
 						cfg.Pools = cfg.Pools[:len(cfg.Pools)-1]
 					}
-					// Delete profile
-					if routeName != "" {
-						profileName := fmt.Sprintf("%s/%s-https-cert",
-							cfg.Virtual.Partition, routeName)
-						cfg.Virtual.RemoveFrontendSslProfileName(profileName)
-					}
 				}
 			}
 			appMgr.resources.Assign(key, cfg.Virtual.VirtualServerName, cfg)
@@ -1758,113 +3005,239 @@ func (appMgr *Manager) deleteUnusedRoutes(namespace string) {
 	})
 }
 
-func (appMgr *Manager) deleteUnusedProfiles(namespace string) {
-	var found bool
+// Release the references to custom profiles of the virtual servers that were
+// deleted or no longer use them. Profiles still referenced by any virtual
+// server, in any namespace, are kept.
+func (appMgr *Manager) deleteUnusedProfiles() {
+	appMgr.resources.Lock()
+	defer appMgr.resources.Unlock()
+	owners := make(map[string][]*ResourceConfig)
+	appMgr.resources.ForEach(func(key serviceKey, rsCfg *ResourceConfig) {
+		owner := profileOwner(rsCfg)
+		owners[owner] = append(owners[owner], rsCfg)
+	})
 	appMgr.customProfiles.Lock()
 	defer appMgr.customProfiles.Unlock()
-	for key, profile := range appMgr.customProfiles.profs {
-		found = false
-		appMgr.resources.ForEach(func(k serviceKey, rsCfg *ResourceConfig) {
-			if key.ResourceName == rsCfg.Virtual.VirtualServerName &&
-				key.Namespace == namespace {
-				if rsCfg.Virtual.ReferencesProfile(profile) {
-					found = true
-				}
+	appMgr.customProfiles.Release(func(owner string, cp CustomProfile) bool {
+		for _, rsCfg := range owners[owner] {
+			if rsCfg.Virtual.ReferencesProfile(cp) {
+				return true
 			}
-		})
-		if !found {
-			delete(appMgr.customProfiles.profs, key)
 		}
+		return false
+	})
+}
+
+// Re-use the address in the status annotation of a ConfigMap when no other
+// address is set, such as after a restart before the IPAM system has set the
+// ip annotation again, so the virtual address does not change. The status
+// annotation is removed with the virtual server.
+func setStickyBindAddr(rsCfg *ResourceConfig, cm *v1.ConfigMap, key string) {
+	if rsCfg.Virtual.IApp != "" || nil == rsCfg.Virtual.VirtualAddress ||
+		rsCfg.Virtual.VirtualAddress.BindAddr != "" {
+		return
+	}
+	annotation := bindAddrAnnotation(key)
+	if addr, ok := cm.ObjectMeta.Annotations[annotation]; ok && addr != "" {
+		log.Infof("Using the previous address %v of ConfigMap %v/%v from "+
+			"annotation %v", addr, cm.ObjectMeta.Namespace, cm.ObjectMeta.Name,
+			annotation)
+		rsCfg.Virtual.VirtualAddress.BindAddr = addr
+	}
+}
+
+// Status annotation of the virtual server of a data key of a ConfigMap. The
+// annotations of other keys than data are suffixed like their virtual
+// server name.
+func bindAddrAnnotation(key string) string {
+	if configMapDataKey == key {
+		return vsBindAddrAnnotation
 	}
+	return vsBindAddrAnnotation + "-" +
+		strings.TrimPrefix(key, configMapDataPrefix)
 }
 
+// Set the status annotation of a data key of a ConfigMap to the address of
+// its virtual server, or remove it if the address is empty. Only the
+// annotation is patched, so concurrent edits of the ConfigMap do not make
+// the update fail. The ConfigMap, shared with the informer cache, is left
+// as it is: the update event brings the new annotation, until then the
+// address patched is used.
 func (appMgr *Manager) setBindAddrAnnotation(
 	cm *v1.ConfigMap,
-	sKey serviceQueueKey,
-	rsCfg *ResourceConfig,
+	key string,
+	addr string,
 ) {
-	var doUpdate bool
-	if cm.ObjectMeta.Annotations == nil {
-		cm.ObjectMeta.Annotations = make(map[string]string)
-		doUpdate = true
-	} else if cm.ObjectMeta.Annotations[vsBindAddrAnnotation] !=
-		rsCfg.Virtual.VirtualAddress.BindAddr {
-		doUpdate = true
-	}
-	if doUpdate {
-		cm.ObjectMeta.Annotations[vsBindAddrAnnotation] =
-			rsCfg.Virtual.VirtualAddress.BindAddr
-		_, err := appMgr.kubeClient.CoreV1().ConfigMaps(sKey.Namespace).Update(cm)
-		if nil != err {
-			log.Warningf("Error when creating status IP annotation: %s", err)
+	if appMgr.cfgMapStatusDisabled {
+		return
+	}
+	annotation := bindAddrAnnotation(key)
+	current, ok := cm.ObjectMeta.Annotations[annotation]
+	patchedKey := cm.ObjectMeta.Namespace + "/" + cm.ObjectMeta.Name + "/" +
+		annotation
+	appMgr.bindAddrsMutex.Lock()
+	if patched, found := appMgr.bindAddrsPatched[patchedKey]; found {
+		if ok {
+			delete(appMgr.bindAddrsPatched, patchedKey)
 		} else {
-			log.Debugf("Updating ConfigMap %+v annotation - %v: %v",
-				sKey, vsBindAddrAnnotation,
-				rsCfg.Virtual.VirtualAddress.BindAddr)
+			current, ok = patched, true
+		}
+	}
+	appMgr.bindAddrsMutex.Unlock()
+	if (ok && current == addr) || (!ok && "" == addr) {
+		return
+	}
+	// A null value removes the annotation
+	var value interface{}
+	if "" != addr {
+		value = addr
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				annotation: value,
+			},
+		},
+	})
+	if nil != err {
+		log.Warningf("Error when encoding status IP annotation of ConfigMap "+
+			"%v/%v: %s", cm.ObjectMeta.Namespace, cm.ObjectMeta.Name, err)
+		return
+	}
+	_, err = appMgr.kubeClient.CoreV1().ConfigMaps(cm.ObjectMeta.Namespace).
+		Patch(cm.ObjectMeta.Name, types.MergePatchType, patch)
+	if nil != err {
+		log.Warningf("Error when updating status IP annotation of ConfigMap "+
+			"%v/%v: %s", cm.ObjectMeta.Namespace, cm.ObjectMeta.Name, err)
+		return
+	}
+	appMgr.bindAddrsMutex.Lock()
+	if "" == addr {
+		delete(appMgr.bindAddrsPatched, patchedKey)
+	} else {
+		appMgr.bindAddrsPatched[patchedKey] = addr
+	}
+	appMgr.bindAddrsMutex.Unlock()
+	log.Debugf("Updating ConfigMap %v/%v annotation - %v: %v",
+		cm.ObjectMeta.Namespace, cm.ObjectMeta.Name, annotation, addr)
+}
+
+// Address of the virtual server of a data key of a ConfigMap, empty if it
+// has none or if it is not active. Returns false if the definition has not
+// been synced.
+func (appMgr *Manager) configMapBindAddr(
+	cm *v1.ConfigMap,
+	key string,
+) (string, bool) {
+	appMgr.resources.Lock()
+	defer appMgr.resources.Unlock()
+	cfgs, _ := appMgr.resources.GetAllWithName(
+		formatConfigMapDataVSName(cm, key))
+	if 0 == len(cfgs) {
+		return "", false
+	}
+	for _, cfg := range cfgs {
+		if cfg.MetaData.Active && cfg.Virtual.IApp == "" &&
+			nil != cfg.Virtual.VirtualAddress &&
+			"" != cfg.Virtual.VirtualAddress.BindAddr {
+			return cfg.Virtual.VirtualAddress.BindAddr, true
+		}
+	}
+	return "", true
+}
+
+// Interval of the pass fixing stale status annotations of ConfigMaps
+const bindAddrReconcileInterval = 5 * time.Minute
+
+// Status annotations go stale when their update fails, or when the virtual
+// server of a ConfigMap is removed without the ConfigMap changing, such as
+// when its service is deleted. Fix the annotations of all the synced
+// ConfigMaps; the others are left alone, their annotation keeps the address
+// to re-use once they are synced.
+func (appMgr *Manager) reconcileBindAddrAnnotations() {
+	if appMgr.cfgMapStatusDisabled {
+		return
+	}
+	var cfgMaps []*v1.ConfigMap
+	appMgr.informersMutex.Lock()
+	for _, appInf := range appMgr.appInformers {
+		for _, obj := range appInf.cfgMapInformer.GetStore().List() {
+			cfgMaps = append(cfgMaps, obj.(*v1.ConfigMap))
+		}
+	}
+	appMgr.informersMutex.Unlock()
+
+	for _, cm := range cfgMaps {
+		for _, key := range configMapDataKeys(cm) {
+			if addr, synced := appMgr.configMapBindAddr(cm, key); synced {
+				appMgr.setBindAddrAnnotation(cm, key, addr)
+			}
 		}
 	}
 }
 
+// Queue publishing the virtual IP in the Ingress status, the update is made
+// by the status worker so the sync is not blocked by the API call.
 func (appMgr *Manager) setIngressStatus(
 	ing *v1beta1.Ingress,
 	rsCfg *ResourceConfig,
 ) {
-	// Set the ingress status to include the virtual IP
-	lbIngress := v1.LoadBalancerIngress{IP: rsCfg.Virtual.VirtualAddress.BindAddr}
-	if len(ing.Status.LoadBalancer.Ingress) == 0 {
-		ing.Status.LoadBalancer.Ingress = append(ing.Status.LoadBalancer.Ingress, lbIngress)
-	} else if ing.Status.LoadBalancer.Ingress[0].IP != rsCfg.Virtual.VirtualAddress.BindAddr {
-		ing.Status.LoadBalancer.Ingress[0] = lbIngress
-	}
-	_, updateErr := appMgr.kubeClient.ExtensionsV1beta1().
-		Ingresses(ing.ObjectMeta.Namespace).UpdateStatus(ing)
-	if nil != updateErr {
-		// Multi-service causes the controller to try to update the status multiple times
-		// at once. Ignore this error.
-		if strings.Contains(updateErr.Error(), "object has been modified") {
-			return
-		}
-		warning := fmt.Sprintf(
-			"Error when setting Ingress status IP for virtual server %v: %v",
-			rsCfg.Virtual.VirtualServerName, updateErr)
-		log.Warning(warning)
-		appMgr.recordIngressEvent(ing, "StatusIPError", warning, "")
+	if appMgr.ingressStatusDisabled {
+		return
+	}
+	ip := rsCfg.Virtual.VirtualAddress.BindAddr
+	if len(ing.Status.LoadBalancer.Ingress) != 0 &&
+		ing.Status.LoadBalancer.Ingress[0].IP == ip {
+		return
 	}
+	appMgr.statusQueue.Add(ingressStatus{
+		Namespace: ing.ObjectMeta.Namespace,
+		Name:      ing.ObjectMeta.Name,
+		IP:        ip,
+	})
 }
 
-// This function expects either an Ingress resource or the name of a VS for an Ingress
+// This function expects either an Ingress resource or the name of a VS for an Ingress.
+// The Event is recorded by the status worker.
 func (appMgr *Manager) recordIngressEvent(ing *v1beta1.Ingress,
 	reason,
 	message,
 	rsName string) {
-	var namespace string
-	var name string
+	event := ingressEvent{
+		Ingress: ing,
+		Reason:  reason,
+		Message: message,
+	}
 	if ing != nil {
-		namespace = ing.ObjectMeta.Namespace
+		event.Namespace = ing.ObjectMeta.Namespace
+		event.Name = ing.ObjectMeta.Name
 	} else {
-		namespace = strings.Split(rsName, "_")[0]
-		name = rsName[len(namespace)+1 : len(rsName)-len("-ingress")]
+		event.Namespace = strings.Split(rsName, "_")[0]
+		event.Name = rsName[len(event.Namespace)+1 : len(rsName)-len("-ingress")]
 	}
-	appMgr.broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{
-		Interface: appMgr.kubeClient.Core().Events(namespace)})
+	appMgr.statusQueue.Add(event)
+}
 
-	// If we aren't given an Ingress resource, we use the name to find it
-	var err error
-	if ing == nil {
-		ing, err = appMgr.kubeClient.Extensions().Ingresses(namespace).
-			Get(name, metav1.GetOptions{})
-		if nil != err {
-			log.Warningf("Could not find Ingress resource '%v'.", name)
-			return
-		}
+// Record an Event on the Ingress a config was created for, if any
+func (appMgr *Manager) recordConfigIngressEvent(
+	cfg *ResourceConfig,
+	reason,
+	message string,
+) {
+	if "ingress" != cfg.MetaData.ResourceType {
+		return
 	}
-
-	// Create the event
-	appMgr.eventRecorder.Event(ing, v1.EventTypeNormal, reason, message)
+	parts := strings.SplitN(cfg.MetaData.ResourceName, "/", 2)
+	appMgr.statusQueue.Add(ingressEvent{
+		Namespace: parts[0],
+		Name:      parts[1],
+		Reason:    reason,
+		Message:   message,
+	})
 }
 
 func getEndpointsForService(
-	portName string,
+	portSpec v1.ServicePort,
 	eps *v1.Endpoints,
 ) []Member {
 	var members []Member
@@ -1874,22 +3247,61 @@ func getEndpointsForService(
 	}
 
 	for _, subset := range eps.Subsets {
-		for _, p := range subset.Ports {
-			if portName == p.Name {
-				for _, addr := range subset.Addresses {
-					member := Member{
-						Address: addr.IP,
-						Port:    p.Port,
-						Session: "user-enabled",
-					}
-					members = append(members, member)
-				}
+		p, found := matchEndpointPort(portSpec, subset.Ports)
+		if !found {
+			continue
+		}
+		for _, addr := range subset.Addresses {
+			member := Member{
+				Address:     addr.IP,
+				Port:        p.Port,
+				Session:     "user-enabled",
+				Description: describeEndpoint(addr),
 			}
+			members = append(members, member)
 		}
 	}
 	return members
 }
 
+// Find the endpoint port of a service port. The endpoints controller names
+// endpoint ports after the service ports, but Endpoints maintained by hand
+// for services without selectors may name them differently (or not at all),
+// so the target port name or number is also tried.
+func matchEndpointPort(
+	portSpec v1.ServicePort,
+	ports []v1.EndpointPort,
+) (v1.EndpointPort, bool) {
+	for _, p := range ports {
+		if p.Name == portSpec.Name {
+			return p, true
+		}
+	}
+	target := portSpec.TargetPort
+	for _, p := range ports {
+		switch {
+		case target.Type == intstr.String && "" != target.StrVal:
+			if p.Name == target.StrVal {
+				return p, true
+			}
+		case target.Type == intstr.Int && 0 != target.IntVal:
+			if p.Port == target.IntVal {
+				return p, true
+			}
+		default:
+			// The target port defaults to the service port
+			if p.Port == portSpec.Port {
+				return p, true
+			}
+		}
+	}
+	// An unnamed service port is the only port of its service
+	if "" == portSpec.Name && 1 == len(ports) {
+		return ports[0], true
+	}
+	return v1.EndpointPort{}, false
+}
+
 func (appMgr *Manager) getEndpointsForNodePort(
 	nodePort int32,
 ) []Member {
@@ -1910,6 +3322,7 @@ func (appMgr *Manager) getEndpointsForNodePort(
 func handleConfigMapParseFailure(
 	appMgr *Manager,
 	cm *v1.ConfigMap,
+	key string,
 	cfg *ResourceConfig,
 	err error,
 ) bool {
@@ -1927,13 +3340,12 @@ func handleConfigMapParseFailure(
 			servicePort = cfg.Pools[0].ServicePort
 		}
 		sKey := serviceKey{serviceName, servicePort, cm.ObjectMeta.Namespace}
-		rsName := formatConfigMapVSName(cm)
+		rsName := formatConfigMapDataVSName(cm, key)
 		if _, ok := appMgr.resources.Get(sKey, rsName); ok {
 			appMgr.resources.Lock()
 			defer appMgr.resources.Unlock()
 			appMgr.resources.Delete(sKey, rsName)
-			delete(cm.ObjectMeta.Annotations, vsBindAddrAnnotation)
-			appMgr.kubeClient.CoreV1().ConfigMaps(cm.ObjectMeta.Namespace).Update(cm)
+			appMgr.setBindAddrAnnotation(cm, key, "")
 			log.Warningf("Deleted virtual server associated with ConfigMap: %v",
 				cm.ObjectMeta.Name)
 			return true
@@ -1957,6 +3369,7 @@ func (appMgr *Manager) ProcessNodeUpdate(
 		return
 	}
 	sort.Strings(newNodes)
+	appMgr.setNodeNames(obj)
 
 	appMgr.resources.Lock()
 	defer appMgr.resources.Unlock()
@@ -1964,11 +3377,15 @@ func (appMgr *Manager) ProcessNodeUpdate(
 	defer appMgr.oldNodesMutex.Unlock()
 
 	// Only check for updates once we are in our initial state
-	if appMgr.initialState {
+	if appMgr.isInitialState() {
 		// Compare last set of nodes with new one
 		if !reflect.DeepEqual(newNodes, appMgr.oldNodes) {
 			log.Infof("ProcessNodeUpdate: Change in Node state detected")
 			appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+				if !appMgr.usesNodePort(cfg) {
+					// Members are the endpoints of the service
+					return
+				}
 				var members []Member
 				for _, node := range newNodes {
 					member := Member{
@@ -1979,6 +3396,7 @@ func (appMgr *Manager) ProcessNodeUpdate(
 					members = append(members, member)
 				}
 				cfg.Pools[0].Members = members
+				appMgr.resources.Invalidate(key, cfg.Virtual.VirtualServerName)
 			})
 			// Output the Big-IP config
 			appMgr.outputConfigLocked()
@@ -2002,6 +3420,14 @@ func (appMgr *Manager) getNodesFromCache() []string {
 	return nodes
 }
 
+// Type of the Node addresses used for pool members
+func (appMgr *Manager) nodeAddressType() v1.NodeAddressType {
+	if appMgr.UseNodeInternal() {
+		return v1.NodeInternalIP
+	}
+	return v1.NodeExternalIP
+}
+
 // Get a list of Node addresses
 func (appMgr *Manager) getNodeAddresses(
 	obj interface{},
@@ -2013,13 +3439,7 @@ func (appMgr *Manager) getNodeAddresses(
 	}
 
 	addrs := []string{}
-
-	var addrType v1.NodeAddressType
-	if appMgr.UseNodeInternal() {
-		addrType = v1.NodeInternalIP
-	} else {
-		addrType = v1.NodeExternalIP
-	}
+	addrType := appMgr.nodeAddressType()
 
 	for _, node := range nodes {
 		if node.Spec.Unschedulable {
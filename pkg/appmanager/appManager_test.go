@@ -17,30 +17,51 @@
 package appmanager
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/tracing"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	routeapi "github.com/openshift/origin/pkg/route/api"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/fake"
 	"k8s.io/client-go/pkg/api/v1"
+	authv1 "k8s.io/client-go/pkg/apis/authorization/v1"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
 func init() {
 	workingDir, _ := os.Getwd()
-	schemaUrl = "file://" + workingDir + "/../../schemas/bigip-virtual-server_v0.1.4.json"
+	schemaUrl = "file://" + workingDir + "/../../schemas/bigip-virtual-server_v0.1.12.json"
 	DEFAULT_PARTITION = "velcro"
 }
 
@@ -291,6 +312,26 @@ type mockAppManager struct {
 	nsLabel string
 }
 
+type fakeDNSPublisher struct {
+	mutex   sync.Mutex
+	records []map[string]string
+}
+
+func (p *fakeDNSPublisher) Publish(records map[string]string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.records = append(p.records, records)
+}
+
+func (p *fakeDNSPublisher) last() map[string]string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if 0 == len(p.records) {
+		return nil
+	}
+	return p.records[len(p.records)-1]
+}
+
 func newMockAppManager(params *Params) *mockAppManager {
 	return &mockAppManager{
 		appMgr:  NewManager(params),
@@ -335,11 +376,19 @@ func (m *mockAppManager) shutdown() error {
 	return nil
 }
 
+// Run the status worker until the queued Events and status updates are done,
+// retries are left in the queue.
+func (m *mockAppManager) processStatusUpdates() {
+	for m.appMgr.statusQueue.Len() > 0 {
+		m.appMgr.processNextStatusUpdate()
+	}
+}
+
 func (m *mockAppManager) resources() *Resources {
 	return m.appMgr.resources
 }
 
-func (m *mockAppManager) customProfiles() map[secretKey]CustomProfile {
+func (m *mockAppManager) customProfiles() map[profileKey]CustomProfile {
 	return m.appMgr.customProfiles.profs
 }
 
@@ -578,6 +627,21 @@ func (m *mockAppManager) deleteRoute(route *routeapi.Route) bool {
 	return ok
 }
 
+func (m *mockAppManager) addSecret(secret *v1.Secret) {
+	appInf, _ := m.appMgr.getNamespaceInformer(secret.ObjectMeta.Namespace)
+	appInf.secretInformer.GetStore().Add(secret)
+}
+
+func (m *mockAppManager) updateSecret(secret *v1.Secret) {
+	appInf, _ := m.appMgr.getNamespaceInformer(secret.ObjectMeta.Namespace)
+	appInf.secretInformer.GetStore().Update(secret)
+}
+
+func (m *mockAppManager) deleteSecret(secret *v1.Secret) {
+	appInf, _ := m.appMgr.getNamespaceInformer(secret.ObjectMeta.Namespace)
+	appInf.secretInformer.GetStore().Delete(secret)
+}
+
 func (m *mockAppManager) addNamespace(ns *v1.Namespace) bool {
 	if "" == m.nsLabel {
 		return false
@@ -590,6 +654,16 @@ func (m *mockAppManager) addNamespace(ns *v1.Namespace) bool {
 	return found
 }
 
+// Counter, gauge and summary of the work queue metrics, counting the
+// increments
+type fakeQueueMetric struct {
+	count int
+}
+
+func (m *fakeQueueMetric) Inc()            { m.count += 1 }
+func (m *fakeQueueMetric) Dec()            { m.count -= 1 }
+func (m *fakeQueueMetric) Observe(float64) {}
+
 func generateExpectedAddrs(port int32, ips []string) []Member {
 	var ret []Member
 	for _, ip := range ips {
@@ -727,6 +801,655 @@ var _ = Describe("AppManager Tests", func() {
 			Expect(func() { appMgr.outputConfig() }).ToNot(Panic())
 			Expect(mw.WrittenTimes).To(Equal(1))
 		})
+
+		It("computes config diffs", func() {
+			oldRs := PartitionMap{
+				"velcro": &BigIPConfig{
+					Virtuals: Virtuals{
+						{VirtualServerName: "vs1", Destination: "/velcro/1.2.3.4:80"},
+						{VirtualServerName: "vs2"},
+					},
+					Pools: Pools{
+						{Name: "pool1", Members: []Member{
+							{Address: "10.0.0.1", Port: 80},
+							{Address: "10.0.0.2", Port: 80},
+						}},
+					},
+				},
+			}
+			newRs := PartitionMap{
+				"velcro": &BigIPConfig{
+					Virtuals: Virtuals{
+						{VirtualServerName: "vs1", Destination: "/velcro/1.2.3.5:80"},
+						{VirtualServerName: "vs3"},
+					},
+					Pools: Pools{
+						{Name: "pool1", Members: []Member{
+							{Address: "10.0.0.1", Port: 80},
+							{Address: "10.0.0.3", Port: 80},
+						}},
+					},
+					CustomProfiles: []CustomProfile{{Name: "prof1"}},
+				},
+			}
+			Expect(diffResources(oldRs, newRs)).To(Equal([]string{
+				"added member 10.0.0.3:80 to pool /velcro/pool1",
+				"added profile /velcro/prof1",
+				"added virtual server /velcro/vs3",
+				"changed virtual server /velcro/vs1",
+				"removed member 10.0.0.2:80 from pool /velcro/pool1",
+				"removed virtual server /velcro/vs2",
+			}))
+			Expect(diffResources(newRs, snapshotResources(newRs))).To(BeEmpty())
+			Expect(diffResources(nil, PartitionMap{})).To(BeEmpty())
+		})
+
+		It("adds node monitors to pools", func() {
+			rs := PartitionMap{
+				"velcro": &BigIPConfig{
+					Pools: Pools{
+						{Name: "pool1", MonitorNames: []string{"/velcro/pool1_0_http"}},
+						{Name: "pool2"},
+						{Name: "pool3"},
+					},
+					Monitors: Monitors{{Name: "pool1_0_http", Partition: "velcro"}},
+				},
+				"empty": &BigIPConfig{},
+			}
+			appMonitors := rs["velcro"].Pools[0].MonitorNames
+			addNodeMonitor(rs, NodeMonitorConfig{Interval: 5, Timeout: 16},
+				map[string]bool{"velcro/pool3": true})
+			Expect(rs["velcro"].Monitors).To(HaveLen(2))
+			Expect(rs["velcro"].Monitors[1]).To(Equal(Monitor{
+				Name:      nodeMonitorName,
+				Partition: "velcro",
+				Interval:  5,
+				Protocol:  "tcp",
+				Timeout:   16,
+			}))
+			Expect(rs["velcro"].Pools[0].MonitorNames).To(Equal([]string{
+				"/velcro/pool1_0_http", "/velcro/" + nodeMonitorName}))
+			Expect(rs["velcro"].Pools[1].MonitorNames).To(Equal([]string{
+				"/velcro/" + nodeMonitorName}))
+			Expect(rs["velcro"].Pools[2].MonitorNames).To(BeEmpty(),
+				"Pools of endpoints should not use the node monitor.")
+			Expect(appMonitors).To(HaveLen(1), "Stored pool should be unchanged.")
+			Expect(rs["empty"].Monitors).To(BeEmpty())
+
+			// As the default monitor, only pools without monitors use it
+			rs = PartitionMap{
+				"velcro": &BigIPConfig{
+					Pools: Pools{
+						{Name: "pool1", MonitorNames: []string{"/velcro/pool1_0_http"}},
+						{Name: "pool2"},
+					},
+					Monitors: Monitors{{Name: "pool1_0_http", Partition: "velcro"}},
+				},
+				"monitored": &BigIPConfig{
+					Pools: Pools{
+						{Name: "pool1", MonitorNames: []string{"/monitored/pool1_0_http"}},
+					},
+				},
+			}
+			addNodeMonitor(rs, NodeMonitorConfig{Interval: 5, Timeout: 16,
+				DefaultOnly: true}, nil)
+			Expect(rs["velcro"].Monitors).To(HaveLen(2))
+			Expect(rs["velcro"].Pools[0].MonitorNames).To(Equal([]string{
+				"/velcro/pool1_0_http"}))
+			Expect(rs["velcro"].Pools[1].MonitorNames).To(Equal([]string{
+				"/velcro/" + nodeMonitorName}))
+			Expect(rs["monitored"].Monitors).To(BeEmpty())
+		})
+
+		It("sorts the config of a partition", func() {
+			members := []Member{
+				{Address: "10.0.0.2", Port: 80},
+				{Address: "10.0.0.1", Port: 8080},
+				{Address: "10.0.0.1", Port: 80},
+			}
+			profiles := ProfileRefs{
+				{Name: "tcp", Partition: "Common", Context: "all"},
+				{Name: "http", Partition: "Common", Context: "all"},
+			}
+			rules := []*Rule{{Name: "b-rule"}, {Name: "a-rule"}}
+			cfg := &BigIPConfig{
+				Virtuals: Virtuals{
+					{VirtualServerName: "vs-b", Partition: "velcro"},
+					{
+						VirtualServerName: "vs-a",
+						Partition:         "velcro",
+						Profiles:          profiles,
+						IRules:            []string{"/velcro/b", "/velcro/a"},
+					},
+				},
+				Pools: Pools{
+					{Name: "pool-b", Partition: "velcro"},
+					{Name: "pool-a", Partition: "velcro", Members: members},
+				},
+				Monitors: Monitors{
+					{Name: "mon-b", Partition: "velcro"},
+					{Name: "mon-a", Partition: "velcro"},
+				},
+				Policies: []Policy{
+					{Name: "pol-b", Partition: "velcro"},
+					{Name: "pol-a", Partition: "velcro", Rules: rules},
+				},
+				CustomProfiles: []CustomProfile{
+					{Name: "prof-b", Partition: "velcro"},
+					{Name: "prof-a", Partition: "velcro"},
+				},
+				IRules: []IRule{
+					{Name: "irule-b", Partition: "velcro"},
+					{Name: "irule-a", Partition: "velcro"},
+				},
+				IApps: []IApp{{Name: "iapp-b"}, {Name: "iapp-a"}},
+			}
+			sortPartitionConfig(cfg)
+
+			Expect(cfg.Virtuals[0].VirtualServerName).To(Equal("vs-a"))
+			Expect(cfg.Virtuals[0].Profiles[0].Name).To(Equal("http"))
+			Expect(cfg.Virtuals[0].IRules).To(Equal(
+				[]string{"/velcro/b", "/velcro/a"}))
+			Expect(cfg.Pools[0].Name).To(Equal("pool-a"))
+			Expect(cfg.Pools[0].Members).To(Equal([]Member{
+				{Address: "10.0.0.1", Port: 80},
+				{Address: "10.0.0.1", Port: 8080},
+				{Address: "10.0.0.2", Port: 80},
+			}))
+			Expect(cfg.Monitors[0].Name).To(Equal("mon-a"))
+			Expect(cfg.Policies[0].Name).To(Equal("pol-a"))
+			Expect(cfg.Policies[0].Rules[0].Name).To(Equal("b-rule"))
+			Expect(cfg.CustomProfiles[0].Name).To(Equal("prof-a"))
+			Expect(cfg.IRules[0].Name).To(Equal("irule-a"))
+			Expect(cfg.IApps[0].Name).To(Equal("iapp-a"))
+
+			// The slices of the stored configs are left alone
+			Expect(members[0].Address).To(Equal("10.0.0.2"))
+			Expect(profiles[0].Name).To(Equal("tcp"))
+		})
+
+		It("finds the expiry of the certificate of a Secret", func() {
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			Expect(err).To(BeNil())
+			notAfter := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+			template := x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				NotBefore:    notAfter.Add(-24 * time.Hour),
+				NotAfter:     notAfter,
+			}
+			der, err := x509.CreateCertificate(rand.Reader, &template,
+				&template, &key.PublicKey, key)
+			Expect(err).To(BeNil())
+			certPem := pem.EncodeToMemory(&pem.Block{
+				Type: "CERTIFICATE", Bytes: der})
+
+			secret := &v1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "ns"},
+				Data:       map[string][]byte{"tls.crt": certPem},
+			}
+			expiry, err := secretCertificateExpiry(secret)
+			Expect(err).To(BeNil())
+			Expect(expiry.Equal(notAfter)).To(BeTrue())
+
+			// The CA bundle of a server CA Secret
+			secret.Data = map[string][]byte{"ca.crt": certPem}
+			expiry, err = secretCertificateExpiry(secret)
+			Expect(err).To(BeNil())
+			Expect(expiry.Equal(notAfter)).To(BeTrue())
+
+			secret.Data = map[string][]byte{"tls.crt": []byte("not a cert")}
+			_, err = secretCertificateExpiry(secret)
+			Expect(err).ToNot(BeNil())
+			secret.Data = map[string][]byte{}
+			_, err = secretCertificateExpiry(secret)
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("validates the host and certificates of Routes", func() {
+			notBefore := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			// A certificate signed by the parent and its key, in PEM
+			newCert := func(
+				serial int64,
+				isCA bool,
+				parent *x509.Certificate,
+				parentKey *ecdsa.PrivateKey,
+			) (*x509.Certificate, *ecdsa.PrivateKey, string, string) {
+				key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+				Expect(err).To(BeNil())
+				template := &x509.Certificate{
+					SerialNumber:          big.NewInt(serial),
+					NotBefore:             notBefore,
+					NotAfter:              notBefore.Add(24 * time.Hour),
+					IsCA:                  isCA,
+					BasicConstraintsValid: isCA,
+				}
+				if isCA {
+					template.KeyUsage = x509.KeyUsageCertSign
+				}
+				if nil == parent {
+					parent, parentKey = template, key
+				}
+				der, err := x509.CreateCertificate(rand.Reader, template,
+					parent, &key.PublicKey, parentKey)
+				Expect(err).To(BeNil())
+				cert, err := x509.ParseCertificate(der)
+				Expect(err).To(BeNil())
+				keyDer, err := x509.MarshalECPrivateKey(key)
+				Expect(err).To(BeNil())
+				return cert, key, string(pem.EncodeToMemory(&pem.Block{
+						Type: "CERTIFICATE", Bytes: der})),
+					string(pem.EncodeToMemory(&pem.Block{
+						Type: "EC PRIVATE KEY", Bytes: keyDer}))
+			}
+			ca, caKey, caPem, caKeyPem := newCert(1, true, nil, nil)
+			_, _, leafPem, leafKeyPem := newCert(2, false, ca, caKey)
+			_, _, otherCAPem, _ := newCert(3, true, nil, nil)
+
+			route := test.NewRoute("route", "1", "default", routeapi.RouteSpec{
+				Host: "foobar.com",
+				To:   routeapi.RouteTargetReference{Kind: "Service", Name: "foo"},
+				TLS: &routeapi.TLSConfig{
+					Termination:   routeapi.TLSTerminationEdge,
+					Certificate:   leafPem,
+					Key:           leafKeyPem,
+					CACertificate: caPem,
+				},
+			})
+			Expect(validateRoute(route)).To(Succeed())
+
+			// Host names
+			route.Spec.Host = "foo_bar.com"
+			Expect(validateRoute(route)).ToNot(Succeed())
+			route.Spec.Host = strings.Repeat("a", 64) + ".com"
+			Expect(validateRoute(route)).ToNot(Succeed())
+			route.Spec.Host = ""
+			Expect(validateRoute(route)).To(Succeed())
+
+			// Certificate and key
+			route.Spec.TLS.Key = caKeyPem
+			Expect(validateRoute(route)).ToNot(Succeed())
+			route.Spec.TLS.Key = ""
+			Expect(validateRoute(route)).ToNot(Succeed())
+			route.Spec.TLS.Certificate = ""
+			Expect(validateRoute(route)).To(Succeed(),
+				"The default certificate is used.")
+			route.Spec.TLS.Certificate = "cert"
+			route.Spec.TLS.Key = "key"
+			Expect(validateRoute(route)).ToNot(Succeed())
+
+			// CA certificate
+			route.Spec.TLS.Certificate = leafPem
+			route.Spec.TLS.Key = leafKeyPem
+			route.Spec.TLS.CACertificate = otherCAPem
+			Expect(validateRoute(route)).ToNot(Succeed())
+			route.Spec.TLS.CACertificate = ""
+			Expect(validateRoute(route)).To(Succeed())
+
+			// Destination CA certificate of reencrypt Routes
+			route.Spec.TLS.Termination = routeapi.TLSTerminationReencrypt
+			route.Spec.TLS.DestinationCACertificate = "destCaCert"
+			Expect(validateRoute(route)).ToNot(Succeed())
+			route.Spec.TLS.DestinationCACertificate = caPem + otherCAPem
+			Expect(validateRoute(route)).To(Succeed())
+
+			// Passthrough Routes carry no certificates
+			route.Spec.TLS = &routeapi.TLSConfig{
+				Termination: routeapi.TLSTerminationPassthrough,
+				Certificate: "cert",
+			}
+			Expect(validateRoute(route)).To(Succeed())
+		})
+
+		It("renders iRules from templates overriding the built-in ones", func() {
+			Expect(validateIRule(sslPassthroughIRule())).To(Succeed())
+			Expect(validateIRule(shardedSslPassthroughIRule())).To(Succeed())
+			Expect(validateIRule(
+				"when HTTP_REQUEST { set a \\}")).ToNot(Succeed())
+			Expect(validateIRule(
+				"when HTTP_REQUEST { set a [b }]")).ToNot(Succeed())
+			Expect(validateIRule("set a [b]")).ToNot(Succeed())
+			Expect(validateIRule(
+				"when HTTP_REQUEST { set a \\{ }")).To(Succeed())
+
+			dir, err := ioutil.TempDir("", "irule-templates")
+			Expect(err).To(BeNil())
+			defer os.RemoveAll(dir)
+			redirect := httpRedirectIRuleData{Port: 8443}
+			templates := newIRuleTemplates(dir)
+			Expect(templates.render(httpRedirectIRuleName, redirect)).To(
+				Equal(defaultIRule(httpRedirectIRuleName, redirect)))
+			Expect(templates.render(httpRedirectIRuleName, redirect)).To(
+				ContainSubstring(":8443[HTTP::uri]"))
+
+			// Overrides are picked up when reloaded
+			path := filepath.Join(dir, httpRedirectIRuleName)
+			Expect(ioutil.WriteFile(path, []byte("when HTTP_REQUEST {\n"+
+				"\tHTTP::respond 301 Location "+
+				"https://[HTTP::host]:{{.Port}}[HTTP::uri]\n}"),
+				0644)).To(Succeed())
+			Expect(templates.load()).To(BeTrue())
+			Expect(templates.load()).To(BeFalse())
+			Expect(templates.render(httpRedirectIRuleName, redirect)).To(
+				ContainSubstring("HTTP::respond 301 Location " +
+					"https://[HTTP::host]:8443[HTTP::uri]"))
+			Expect(templates.render(sslPassthroughIRuleName,
+				passthroughIRuleParams(false))).To(Equal(sslPassthroughIRule()))
+
+			// Invalid TCL falls back to the built-in template
+			Expect(ioutil.WriteFile(path, []byte("when HTTP_REQUEST {\n"+
+				"\tHTTP::redirect https://[HTTP::host:{{.Port}}\n}"),
+				0644)).To(Succeed())
+			Expect(templates.load()).To(BeTrue())
+			Expect(templates.render(httpRedirectIRuleName, redirect)).To(
+				Equal(defaultIRule(httpRedirectIRuleName, redirect)))
+
+			// So do templates failing to parse or to execute
+			Expect(ioutil.WriteFile(path, []byte("when HTTP_REQUEST {{.Port"),
+				0644)).To(Succeed())
+			Expect(templates.load()).To(BeTrue())
+			Expect(templates.render(httpRedirectIRuleName, redirect)).To(
+				Equal(defaultIRule(httpRedirectIRuleName, redirect)))
+			Expect(ioutil.WriteFile(path, []byte("when HTTP_REQUEST {{.Host}}"),
+				0644)).To(Succeed())
+			Expect(templates.load()).To(BeTrue())
+			Expect(templates.render(httpRedirectIRuleName, redirect)).To(
+				Equal(defaultIRule(httpRedirectIRuleName, redirect)))
+
+			// Removing the override restores the built-in template
+			Expect(os.Remove(path)).To(Succeed())
+			Expect(templates.load()).To(BeTrue())
+			Expect(templates.render(httpRedirectIRuleName, redirect)).To(
+				Equal(defaultIRule(httpRedirectIRuleName, redirect)))
+		})
+
+		It("adds the legacy names of renamed objects", func() {
+			dotted := test.NewRoute("my.route", "1", "default",
+				routeapi.RouteSpec{})
+			plain := test.NewRoute("route", "1", "default",
+				routeapi.RouteSpec{})
+			resources := PartitionMap{
+				DEFAULT_PARTITION: &BigIPConfig{
+					CustomProfiles: []CustomProfile{
+						{Name: formatRouteServerSslProfileName(dotted)},
+						{Name: formatRouteClientSslProfileName(dotted)},
+						{Name: formatRouteClientSslProfileName(plain)},
+						{Name: "default_secret"},
+					},
+				},
+				"k8s": &BigIPConfig{},
+			}
+			addAdoptions(resources)
+			Expect(resources[DEFAULT_PARTITION].Adoptions).To(Equal([]Adoption{
+				{
+					Kind:       adoptClientSsl,
+					Name:       "openshift_route_default_my.2eroute-https-cert",
+					LegacyName: "openshift_route_default_my.route-https-cert",
+				},
+				{
+					Kind:       adoptServerSsl,
+					Name:       "openshift_route_default_my.2eroute-server-ssl",
+					LegacyName: "openshift_route_default_my.route-server-ssl",
+				},
+			}))
+			Expect(resources["k8s"].Adoptions).To(BeEmpty())
+
+			// Adoptions are written until the adoption period after their
+			// first successful write has passed
+			appMgr := NewManager(&Params{})
+			now := time.Now()
+			appMgr.recordAdoptions(resources, now)
+			Expect(appMgr.adoptionsWritten).To(HaveLen(2))
+			appMgr.addPendingAdoptions(resources, now.Add(adoptionPeriod))
+			Expect(resources[DEFAULT_PARTITION].Adoptions).To(HaveLen(2))
+			appMgr.addPendingAdoptions(resources,
+				now.Add(adoptionPeriod+time.Second))
+			Expect(resources[DEFAULT_PARTITION].Adoptions).To(BeEmpty())
+			Expect(appMgr.adoptionsWritten).To(HaveLen(2))
+
+			// The adoptions of removed profiles are forgotten
+			resources[DEFAULT_PARTITION].CustomProfiles = nil
+			appMgr.addPendingAdoptions(resources, now)
+			Expect(appMgr.adoptionsWritten).To(BeEmpty())
+		})
+
+		It("parses static pool members", func() {
+			members, err := parseStaticMembers(
+				[]string{"10.0.0.1:81", "10.0.0.2", "2001:db8::1",
+					"[2001:db8::2]:82"}, 80)
+			Expect(err).To(BeNil())
+			Expect(members).To(Equal([]Member{
+				{Address: "10.0.0.1", Port: 81, Session: "user-enabled"},
+				{Address: "10.0.0.2", Port: 80, Session: "user-enabled"},
+				{Address: "2001:db8::1", Port: 80, Session: "user-enabled"},
+				{Address: "2001:db8::2", Port: 82, Session: "user-enabled"},
+			}))
+			for _, entry := range []string{"10.0.0.1:0", "10.0.0.1:70000",
+				"10.0.0.1:http", "host:80", "[2001:db8::1]"} {
+				_, err = parseStaticMembers([]string{entry}, 80)
+				Expect(err).ToNot(BeNil(), entry)
+			}
+			_, err = parseStaticMembers(
+				[]string{"10.0.0.1:80", "10.0.0.1"}, 80)
+			Expect(err).To(MatchError(ContainSubstring("listed twice")))
+
+			Expect(mergeStaticMembers(
+				[]Member{{Address: "10.0.0.1", Port: 80}},
+				[]Member{{Address: "10.0.0.1", Port: 80},
+					{Address: "10.0.0.2", Port: 80}})).To(Equal([]Member{
+				{Address: "10.0.0.1", Port: 80},
+				{Address: "10.0.0.2", Port: 80},
+			}))
+		})
+
+		It("finds the owner of configs from their metadata", func() {
+			cfg := &ResourceConfig{}
+			cfg.Virtual.VirtualServerName = "default_foo-ingress_http"
+			cfg.MetaData.ResourceType = "configmap"
+			cfg.MetaData.ResourceName = "default/foo-ingress_http"
+			cmKey := serviceQueueKey{
+				Namespace:    "default",
+				ResourceKind: configMapKind,
+				ResourceName: "default/foo-ingress_http",
+			}
+			ingKey := cmKey
+			ingKey.ResourceKind = ingressKind
+			ingKey.ResourceName = "default/foo"
+			Expect(cmKey.owns(cfg)).To(BeTrue())
+			Expect(ingKey.owns(cfg)).To(BeFalse())
+			kind, ns, name := appliedConfigOwner(cfg)
+			Expect([]string{kind, ns, name}).To(Equal(
+				[]string{configMapKind, "default", "foo-ingress_http"}))
+
+			cfg.MetaData.ResourceType = "ingress"
+			cfg.MetaData.ResourceName = "default/foo"
+			Expect(cmKey.owns(cfg)).To(BeFalse())
+			Expect(ingKey.owns(cfg)).To(BeTrue())
+			kind, ns, name = appliedConfigOwner(cfg)
+			Expect([]string{kind, ns, name}).To(Equal(
+				[]string{ingressKind, "default", "foo"}))
+		})
+
+		It("hashes the configs applied for each Route", func() {
+			fooRoute := test.NewRoute("foo", "1", "default", routeapi.RouteSpec{
+				Host: "foo.com",
+				To:   routeapi.RouteTargetReference{Kind: "Service", Name: "foo"},
+			})
+			barRoute := test.NewRoute("bar", "1", "default", routeapi.RouteSpec{
+				Host: "bar.com",
+				To:   routeapi.RouteTargetReference{Kind: "Service", Name: "bar"},
+			})
+			cfg := &ResourceConfig{}
+			cfg.Virtual.VirtualServerName = "openshift_default_http"
+			cfg.Policies = []Policy{{Name: "openshift_secure_routes", Rules: []*Rule{
+				{Name: formatRouteRuleName(fooRoute), FullURI: "foo.com"},
+				{Name: formatRouteRuleName(barRoute), FullURI: "bar.com",
+					Ordinal: 1},
+			}}}
+			cfg.Pools = []Pool{
+				{Name: formatRoutePoolName(fooRoute)},
+				{Name: formatRoutePoolName(barRoute)},
+			}
+			cfgs := map[string]*ResourceConfig{"openshift_default_http": cfg}
+			parts := routeAppliedConfigs(fooRoute, cfgs)
+			Expect(parts).To(HaveLen(1))
+			Expect(parts[0].Rules).To(HaveLen(1))
+			Expect(parts[0].Rules[0].FullURI).To(Equal("foo.com"))
+			Expect(parts[0].Pool.Name).To(Equal("openshift_default_foo"))
+			hash, body := appliedConfigHash(parts)
+			Expect(body).To(ContainSubstring("openshift_default_http"))
+
+			// The changes of other Routes, and of the order of the rules, do
+			// not change the hash
+			cfg.Policies[0].Rules[0].Ordinal = 1
+			cfg.Policies[0].Rules[1].FullURI = "bar.com/api"
+			same, _ := appliedConfigHash(routeAppliedConfigs(fooRoute, cfgs))
+			Expect(same).To(Equal(hash))
+			cfg.Policies[0].Rules[0].FullURI = "foo.com/api"
+			changed, _ := appliedConfigHash(routeAppliedConfigs(fooRoute, cfgs))
+			Expect(changed).ToNot(Equal(hash))
+
+			// Configs too large for an annotation are only hashed
+			cfg.Pools[0].Balance = strings.Repeat("x", appliedConfigMaxSize)
+			hash, body = appliedConfigHash([]*ResourceConfig{cfg})
+			Expect(hash).To(HaveLen(16))
+			Expect(body).To(BeEmpty())
+		})
+
+		It("clears the removed settings of written virtual servers", func() {
+			policy := "velcro/policy"
+			written := PartitionMap{"velcro": &BigIPConfig{
+				Virtuals: []Virtual{{
+					VirtualServerName:   "vs",
+					SecurityLogProfiles: &[]string{"/Common/Log all requests"},
+					BwcPolicy:           &policy,
+					ClonePools: &[]clonePool{
+						{Name: "/Common/ids", Context: "clientside"}},
+					PerRequestPolicy: &policy,
+					Persist:          &policy,
+					SourcePort:       sourcePortChange,
+				}},
+			}}
+			resources := PartitionMap{"velcro": &BigIPConfig{
+				Virtuals: []Virtual{{VirtualServerName: "vs"},
+					{VirtualServerName: "other"}},
+			}}
+			clearRemovedSettings(resources, written)
+			v := resources["velcro"].Virtuals[0]
+			Expect(*v.SecurityLogProfiles).To(BeEmpty())
+			Expect(*v.BwcPolicy).To(BeEmpty())
+			Expect(*v.ClonePools).To(BeEmpty())
+			Expect(*v.PerRequestPolicy).To(BeEmpty())
+			Expect(*v.Persist).To(BeEmpty())
+			Expect(v.SourcePort).To(Equal(sourcePortPreserve))
+			Expect(resources["velcro"].Virtuals[1]).To(Equal(
+				Virtual{VirtualServerName: "other"}))
+
+			// Once cleared, the settings are left unset
+			written = resources
+			resources = PartitionMap{"velcro": &BigIPConfig{
+				Virtuals: []Virtual{{VirtualServerName: "vs"}},
+			}}
+			clearRemovedSettings(resources, written)
+			Expect(resources["velcro"].Virtuals[0]).To(Equal(
+				Virtual{VirtualServerName: "vs"}))
+		})
+
+		It("finds NetworkPolicies blocking the BIG-IP", func() {
+			sources, err := ParseSourceCIDRs([]string{"10.1.0.0/24"})
+			Expect(err).To(BeNil())
+			var policies []networkPolicy
+			err = json.Unmarshal([]byte(`[
+				{"metadata": {"name": "deny-all"},
+				 "spec": {"podSelector": {}}},
+				{"metadata": {"name": "egress-only"},
+				 "spec": {"podSelector": {}, "policyTypes": ["Egress"]}},
+				{"metadata": {"name": "from-bigip"},
+				 "spec": {
+					"podSelector": {"matchLabels": {"app": "web"}},
+					"ingress": [{
+						"ports": [{"port": "http"}],
+						"from": [{"ipBlock": {"cidr": "10.0.0.0/8",
+							"except": ["10.2.0.0/16"]}}]
+					}]
+				 }}
+			]`), &policies)
+			Expect(err).To(BeNil())
+
+			web := map[string]string{"app": "web"}
+			allowed, names := policiesAllow(policies, web, 8080, "http", sources)
+			Expect(allowed).To(BeTrue())
+			Expect(names).To(BeEmpty())
+			allowed, names = policiesAllow(policies, web, 8443, "https", sources)
+			Expect(allowed).To(BeFalse(), "Only the http port is allowed.")
+			Expect(names).To(Equal([]string{"deny-all", "from-bigip"}))
+			allowed, names = policiesAllow(policies, map[string]string{"app": "db"},
+				5432, "", sources)
+			Expect(allowed).To(BeFalse())
+			Expect(names).To(Equal([]string{"deny-all"}))
+
+			// Excepted and uncovered source addresses are blocked
+			for _, cidr := range []string{"10.2.1.0/24", "10.0.0.0/7"} {
+				blocked, _ := ParseSourceCIDRs([]string{"10.1.0.0/24", cidr})
+				allowed, _ = policiesAllow(policies, web, 8080, "http", blocked)
+				Expect(allowed).To(BeFalse(), "%v should be blocked.", cidr)
+			}
+
+			// Pods selected by no policy accept all traffic
+			allowed, names = policiesAllow(policies[1:], map[string]string{
+				"app": "db"}, 5432, "", sources)
+			Expect(allowed).To(BeTrue())
+			Expect(names).To(BeEmpty())
+
+			_, err = ParseSourceCIDRs([]string{"10.1.0.1"})
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("finds Routes shadowed by an older Route", func() {
+			now := time.Now()
+			newRoute := func(name, host, path string, age int) *routeapi.Route {
+				route := test.NewRoute(name, "1", "default", routeapi.RouteSpec{
+					Host: host,
+					Path: path,
+					To:   routeapi.RouteTargetReference{Kind: "Service", Name: "foo"},
+				})
+				route.ObjectMeta.CreationTimestamp = metav1.NewTime(
+					now.Add(-time.Duration(age) * time.Minute))
+				return route
+			}
+			routes := Routes{
+				newRoute("new", "Foo.com", "/bar", 1),
+				newRoute("old", "foo.com", "/bar", 5),
+				newRoute("other-path", "foo.com", "/baz", 1),
+				newRoute("same-age", "foo.com", "/bar", 5),
+			}
+			claims := routeShadows(routes, "default")
+			Expect(claims).To(Equal([]ruleClaim{
+				{Resource: "default/new", Holder: "default/old", Rule: "foo.com/bar"},
+				{Resource: "default/same-age", Holder: "default/old",
+					Rule: "foo.com/bar"},
+			}))
+			Expect(routeShadows(routes, "other")).To(BeEmpty())
+
+			// Conflicts are only reported when they start
+			shadows := newRuleShadows()
+			Expect(shadows.replace("Route", "default", claims)).To(Equal(claims))
+			Expect(shadows.replace("Route", "default", claims)).To(BeEmpty())
+			Expect(shadows.replace("Route", "default", claims[1:])).To(BeEmpty())
+			Expect(shadows.replace("Route", "default", claims)).To(
+				Equal(claims[:1]))
+			shadows.replace("Route", "default", nil)
+			Expect(shadows.claims["Route"]).To(BeEmpty())
+
+			// The rule of a shadowed Route is removed from the shared policy
+			rsCfg, err := createRSConfigFromRoute(routes[0], Resources{},
+				RouteConfig{}, portStruct{protocol: "http", port: 80})
+			Expect(err).To(BeNil())
+			Expect(rsCfg.Policies).To(HaveLen(1))
+			Expect(rsCfg.removeRule(formatRouteRuleName(routes[1]))).To(BeFalse())
+			Expect(rsCfg.removeRule(formatRouteRuleName(routes[0]))).To(BeTrue())
+			Expect(rsCfg.Policies).To(BeEmpty())
+			Expect(rsCfg.Virtual.Policies).To(BeEmpty())
+		})
 	})
 
 	Describe("Using Real Manager", func() {
@@ -1136,6 +1859,100 @@ var _ = Describe("AppManager Tests", func() {
 				Expect(rs.MetaData.Active).To(BeFalse())
 			})
 
+			It("reports services without a node port - NodePort", func() {
+				mockMgr.appMgr.useNodeInternal = true
+				nodeSet := []v1.Node{
+					*test.NewNode("node0", "0", false, []v1.NodeAddress{
+						{Type: "InternalIP", Address: "127.0.0.0"}}),
+				}
+				mockMgr.processNodeUpdate(nodeSet, nil)
+
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo})
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				r := mockMgr.addService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				r = mockMgr.addConfigMap(cfgFoo)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				resources := mockMgr.resources()
+				fooKey := serviceKey{"foo", 80, namespace}
+				rs, ok := resources.Get(fooKey, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeTrue())
+				Expect(rs.Pools[0].Members).To(
+					Equal(generateExpectedAddrs(30001, []string{"127.0.0.0"})))
+				recorder := mockMgr.appMgr.eventRecorder.(*record.FakeRecorder)
+				for len(recorder.Events) > 0 {
+					<-recorder.Events
+				}
+
+				// The node port of the service is not allocated
+				foo = test.NewService("foo", "2", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80}})
+				r = mockMgr.updateService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				rs, ok = resources.Get(fooKey, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeFalse())
+				Expect(rs.Pools[0].Members).To(BeNil())
+				Expect(rs.Pools[0].NodePortError).To(Equal(nodePortNotAllocated))
+				Expect(recorder.Events).To(Receive(ContainSubstring(
+					"NodePortNotAllocated")))
+				// Reported once
+				r = mockMgr.updateService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				Expect(recorder.Events).ToNot(Receive())
+
+				// The service is no longer of type NodePort
+				foo = test.NewService("foo", "3", namespace, v1.ServiceTypeClusterIP,
+					[]v1.ServicePort{{Port: 80}})
+				r = mockMgr.updateService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				rs, ok = resources.Get(fooKey, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeFalse())
+				Expect(rs.Pools[0].NodePortError).To(Equal(
+					incorrectBackendServiceType))
+				Expect(recorder.Events).To(Receive(ContainSubstring(
+					"IncorrectBackendServiceType")))
+
+				// Allocating a node port restores the pool members
+				foo = test.NewService("foo", "4", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30002}})
+				r = mockMgr.updateService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				rs, ok = resources.Get(fooKey, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeTrue())
+				Expect(rs.Pools[0].NodePortError).To(BeEmpty())
+				Expect(rs.Pools[0].Members).To(
+					Equal(generateExpectedAddrs(30002, []string{"127.0.0.0"})))
+			})
+
+			It("diffs against the last config written", func() {
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo})
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				mw.FailStyle = test.ImmediateFail
+				r := mockMgr.addService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				r = mockMgr.addConfigMap(cfgFoo)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				mockMgr.appMgr.outputConfig()
+				Expect(mockMgr.appMgr.lastResources).To(BeEmpty(),
+					"A failed write should be retried with its changes.")
+
+				mw.FailStyle = test.Success
+				mockMgr.appMgr.outputConfig()
+				Expect(mockMgr.appMgr.lastResources).To(HaveKey("velcro"))
+				Expect(mockMgr.appMgr.lastResources["velcro"].Virtuals).To(
+					HaveLen(1))
+			})
+
 			It("handles concurrent updates - NodePort", func() {
 				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
 					"schema": schemaUrl,
@@ -1988,6 +2805,25 @@ var _ = Describe("AppManager Tests", func() {
 				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal(""))
 				Expect(rs.Virtual.VirtualAddress.Port).To(Equal(int32(10000)))
 
+				// The address assigned before a restart is kept until the
+				// ip annotation is set again
+				noBindAddr.ObjectMeta.Annotations = map[string]string{
+					vsBindAddrAnnotation: "10.128.10.50"}
+				r = mockMgr.updateConfigMap(noBindAddr)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok = resources.Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(noBindAddr))
+				Expect(ok).To(BeTrue(), "Config map should be accessible.")
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("10.128.10.50"))
+				noBindAddr.ObjectMeta.Annotations["virtual-server.f5.com/ip"] =
+					"10.128.10.60"
+				r = mockMgr.updateConfigMap(noBindAddr)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok = resources.Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(noBindAddr))
+				Expect(ok).To(BeTrue(), "Config map should be accessible.")
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("10.128.10.60"))
+
 				mockMgr.deleteConfigMap(noBindAddr)
 			}
 
@@ -2033,6 +2869,109 @@ var _ = Describe("AppManager Tests", func() {
 				mockMgr.deleteConfigMap(noVirtualAddress)
 			}
 
+			It("configures L7 policies from ConfigMaps", func() {
+				data := `{
+  "virtualServer": {
+    "backend": {
+      "serviceName": "foo",
+      "servicePort": 80
+    },
+    "frontend": {
+      "mode": "http",
+      "partition": "velcro",
+      "virtualAddress": {
+        "bindAddr": "10.128.10.240",
+        "port": 80
+      }
+    },
+    "policies": [ {
+      "name": "routing",
+      "rules": [ {
+        "name": "api",
+        "conditions": [ {
+          "match": "host",
+          "values": [ "api.example.com" ]
+        }, {
+          "match": "path",
+          "operand": "startsWith",
+          "values": [ "/v1" ]
+        } ],
+        "action": { "type": "forward", "pool": "apimap" }
+      }, {
+        "name": "beta",
+        "conditions": [ {
+          "match": "header",
+          "name": "X-Beta",
+          "caseInsensitive": true,
+          "values": [ "yes" ]
+        } ],
+        "action": { "type": "redirect", "location": "https://beta.example.com" }
+      }, {
+        "name": "admin",
+        "conditions": [ {
+          "match": "path",
+          "operand": "contains",
+          "values": [ "admin" ]
+        } ],
+        "action": { "type": "drop" }
+      } ]
+    } ]
+  }
+}`
+				cm := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   data})
+				cfg, err := parseConfigMap(cm)
+				Expect(err).To(BeNil())
+				Expect(cfg.Virtual.Policies).To(Equal([]nameRef{
+					{Name: "default_foomap_routing", Partition: "velcro"}}))
+				Expect(len(cfg.Policies)).To(Equal(1))
+				policy := cfg.Policies[0]
+				Expect(policy.Strategy).To(Equal("/Common/first-match"))
+				Expect(len(policy.Rules)).To(Equal(3))
+
+				api := policy.Rules[0]
+				Expect(api.Actions[0].Forward).To(BeTrue())
+				Expect(api.Actions[0].Pool).To(Equal("/velcro/default_apimap"))
+				Expect(len(api.Conditions)).To(Equal(2))
+				Expect(api.Conditions[0].HTTPHost).To(BeTrue())
+				Expect(api.Conditions[0].Equals).To(BeTrue())
+				Expect(api.Conditions[1].HTTPURI).To(BeTrue())
+				Expect(api.Conditions[1].Path).To(BeTrue())
+				Expect(api.Conditions[1].StartsWith).To(BeTrue())
+				Expect(api.Conditions[1].Name).To(Equal("1"))
+
+				beta := policy.Rules[1]
+				Expect(beta.Ordinal).To(Equal(1))
+				Expect(beta.Conditions[0].HTTPHeader).To(BeTrue())
+				Expect(beta.Conditions[0].TmName).To(Equal("X-Beta"))
+				Expect(beta.Conditions[0].CaseInsensitive).To(BeTrue())
+				Expect(beta.Actions[0].Redirect).To(BeTrue())
+				Expect(beta.Actions[0].Location).To(Equal("https://beta.example.com"))
+
+				admin := policy.Rules[2]
+				Expect(admin.Conditions[0].Contains).To(BeTrue())
+				Expect(admin.Actions[0].Forward).To(BeTrue())
+				Expect(admin.Actions[0].Reset).To(BeTrue())
+
+				// Header conditions need a header name
+				invalid := strings.Replace(data, `"name": "X-Beta",`, "", 1)
+				cm = test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   invalid})
+				_, err = parseConfigMap(cm)
+				Expect(err).ToNot(BeNil())
+
+				// Policies are ignored in tcp mode
+				tcp := strings.Replace(data, `"mode": "http"`, `"mode": "tcp"`, 1)
+				cm = test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   tcp})
+				cfg, err = parseConfigMap(cm)
+				Expect(err).To(BeNil())
+				Expect(cfg.Policies).To(BeEmpty())
+			})
+
 			It("supports pool only mode", func() {
 				testNoVirtualAddress(true)
 				testNoBindAddr(true)
@@ -2051,51 +2990,377 @@ var _ = Describe("AppManager Tests", func() {
 				DEFAULT_PARTITION = "velcro"
 			})
 
-			It("configures virtual servers without endpoints", func() {
-				mockMgr.appMgr.isNodePort = false
-				svcName := "foo"
-				emptyIps := []string{}
-				readyIps := []string{"10.2.96.0", "10.2.96.1", "10.2.96.2"}
-				notReadyIps := []string{"10.2.96.3", "10.2.96.4", "10.2.96.5", "10.2.96.6"}
-				svcPorts := []v1.ServicePort{
-					newServicePort("port0", 80),
+			It("keeps the Route data groups by namespace", func() {
+				key := nameRef{
+					Name:      passthroughHostsDgName,
+					Partition: DEFAULT_PARTITION,
+				}
+				dgMap := func(host, pool string) InternalDataGroupMap {
+					dg := NewInternalDataGroup(passthroughHostsDgName, DEFAULT_PARTITION)
+					dg.AddOrUpdateRecord(host, pool)
+					return InternalDataGroupMap{key: dg}
+				}
+				var stats vsSyncStats
+				appMgr := mockMgr.appMgr
+				records := func() InternalDataGroupRecords {
+					dg, found := appMgr.hostDgs.dataGroup(key)
+					Expect(found).To(BeTrue())
+					return dg.Records
+				}
+				appMgr.updateRouteDataGroups(&stats, "ns1", dgMap("foo.com", "foo"))
+				appMgr.updateRouteDataGroups(&stats, "ns2", dgMap("bar.com", "bar"))
+				Expect(records()).To(Equal(
+					InternalDataGroupRecords{
+						{Name: "bar.com", Data: "bar"},
+						{Name: "foo.com", Data: "foo"},
+					}))
+
+				// Removing the Routes of a namespace keeps those of the others
+				stats = vsSyncStats{}
+				appMgr.updateRouteDataGroups(&stats, "ns1", InternalDataGroupMap{})
+				Expect(stats.dgUpdated).To(Equal(1))
+				Expect(records()).To(Equal(
+					InternalDataGroupRecords{{Name: "bar.com", Data: "bar"}}))
+				Expect(appMgr.hostDgs.hasNamespace(key, "ns1")).To(BeFalse())
+			})
+
+			It("shards the data groups of server names", func() {
+				Expect(dataGroupShard("Foo.com")).To(Equal("f"))
+				Expect(dataGroupShard("9.example.com")).To(Equal("9"))
+				Expect(dataGroupShard("_acme.example.com")).To(Equal(otherHostsShard))
+				Expect(dataGroupShard("")).To(Equal(otherHostsShard))
+
+				key := nameRef{
+					Name:      passthroughHostsDgName,
+					Partition: DEFAULT_PARTITION,
 				}
+				hdg := newHostDataGroups()
+				changed := hdg.setNamespace("ns1", map[nameRef]map[string]string{
+					key: {"bar.com": "bar", "foo.com": "foo"},
+				})
+				Expect(changed).To(Equal(map[nameRef]bool{key: true}))
+				hdg.setNamespace("ns2", map[nameRef]map[string]string{
+					key: {"baz.com": "baz"},
+				})
+				// The same records change nothing
+				changed = hdg.setNamespace("ns2", map[nameRef]map[string]string{
+					key: {"baz.com": "baz"},
+				})
+				Expect(changed).To(BeEmpty())
+				Expect(hdg.dataGroups(true)).To(Equal([]InternalDataGroup{
+					{
+						Name:      passthroughHostsDgName + "_b",
+						Partition: DEFAULT_PARTITION,
+						Records: InternalDataGroupRecords{
+							{Name: "bar.com", Data: "bar"},
+							{Name: "baz.com", Data: "baz"},
+						},
+					},
+					{
+						Name:      passthroughHostsDgName + "_f",
+						Partition: DEFAULT_PARTITION,
+						Records: InternalDataGroupRecords{
+							{Name: "foo.com", Data: "foo"},
+						},
+					},
+				}))
+
+				Expect(mockMgr.appMgr.passthroughIRule()).To(Equal(sslPassthroughIRule()))
+				mockMgr.appMgr.shardDataGroups = true
+				Expect(mockMgr.appMgr.passthroughIRule()).To(ContainSubstring(
+					"set passthrough_dg " + passthroughHostsDgName + "_$shard"))
+				Expect(mockMgr.appMgr.passthroughIRule()).To(ContainSubstring(
+					"[class exists $reencrypt_dg] && " +
+						"[class match $servername_lower equals $reencrypt_dg]"))
+				Expect(sslPassthroughIRule()).To(ContainSubstring(
+					"[class match $servername_lower equals " +
+						passthroughHostsDgName + "]"))
+			})
 
+			It("ignores annotated services", func() {
+				fooPorts := []v1.ServicePort{{Port: 80, NodePort: 30001}}
+				foo := test.NewService("foo", "1", namespace, "NodePort", fooPorts)
+				foo.ObjectMeta.Annotations = map[string]string{
+					"f5.com/ignore": "true"}
+				mockMgr.addService(foo)
 				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
 					"schema": schemaUrl,
 					"data":   configmapFoo})
+				r := mockMgr.addConfigMap(cfgFoo)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeFalse())
 
-				foo := test.NewService(svcName, "1", namespace, v1.ServiceTypeClusterIP, svcPorts)
-
-				endptPorts := convertSvcPortsToEndpointPorts(svcPorts)
-				goodEndpts := test.NewEndpoints(svcName, "1", namespace, emptyIps, emptyIps,
-					endptPorts)
+				// Changes to the service and its endpoints are not synced
+				mockMgr.appMgr.enqueueService(foo)
+				Expect(mockMgr.appMgr.vsQueue.Len()).To(Equal(0))
+				endpts := test.NewEndpoints("foo", "1", namespace,
+					[]string{"10.2.96.3"}, []string{},
+					convertSvcPortsToEndpointPorts(fooPorts))
+				ok, _ = mockMgr.appMgr.checkValidEndpoints(endpts)
+				Expect(ok).To(BeFalse())
+
+				// Removing the annotation syncs the service again
+				unignored := test.NewService("foo", "2", namespace, "NodePort",
+					fooPorts)
+				mockMgr.appMgr.enqueueServiceUpdate(foo, unignored)
+				Expect(mockMgr.appMgr.vsQueue.Len()).To(Equal(1))
+				r = mockMgr.updateService(unignored)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeTrue())
+			})
 
-				r := mockMgr.addEndpoints(goodEndpts)
-				Expect(r).To(BeTrue(), "Endpoints should be processed.")
-				// this is for another service
-				badEndpts := test.NewEndpoints("wrongSvc", "1", namespace, []string{"10.2.96.7"},
-					[]string{}, endptPorts)
-				r = mockMgr.addEndpoints(badEndpts)
-				Expect(r).To(BeTrue(), "Endpoints should be processed.")
+			It("manages resources in several partitions", func() {
+				SetPartitions("velcro", []string{"velcro", "k8s"})
+				defer SetPartitions("velcro", nil)
 
-				r = mockMgr.addConfigMap(cfgFoo)
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				mockMgr.addService(foo)
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo})
+				r := mockMgr.addConfigMap(cfgFoo)
 				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
-				r = mockMgr.addService(foo)
-				Expect(r).To(BeTrue(), "Service should be processed.")
 
-				resources := mockMgr.resources()
-				Expect(resources.Count()).To(Equal(len(svcPorts)))
-				for _, p := range svcPorts {
-					Expect(resources.CountOf(serviceKey{"foo", p.Port, namespace})).To(Equal(1))
-					rs, ok := resources.Get(
-						serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
-					Expect(ok).To(BeTrue())
-					Expect(rs.Pools[0].Members).To(Equal([]Member(nil)))
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
 				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "k8s",
+					})
+				r = mockMgr.addIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress should be processed.")
+				Expect(mockMgr.resources().CountOf(
+					serviceKey{"foo", 80, namespace})).To(Equal(2))
+
+				mw.Lock()
+				resources := mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				Expect(resources).To(HaveKey("velcro"))
+				Expect(resources).To(HaveKey("k8s"))
+				Expect(len(resources["k8s"].Virtuals)).To(Equal(1))
+
+				// Ingresses in unmanaged partitions are ignored
+				ingress.ObjectMeta.Annotations["virtual-server.f5.com/partition"] = "other"
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				Expect(mockMgr.resources().CountOf(
+					serviceKey{"foo", 80, namespace})).To(Equal(1))
+				Expect(isManagedPartition("other")).To(BeFalse())
+			})
+
+			It("resyncs all the resources", func() {
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				mockMgr.addService(foo)
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo})
+				r := mockMgr.addConfigMap(cfgFoo)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				mw.Lock()
+				_, found := mw.Sections["resync"]
+				mw.Unlock()
+				Expect(found).To(BeFalse())
+
+				Expect(mockMgr.appMgr.Resync()).To(Equal(2))
+				Expect(mockMgr.appMgr.vsQueue.Len()).To(Equal(1))
+				Expect(mockMgr.appMgr.resyncStatus()).To(Equal(resyncStatus{
+					Generation: 1,
+					Pending:    true,
+				}))
+				for mockMgr.appMgr.vsQueue.Len() > 0 {
+					mockMgr.appMgr.processNextVirtualServer()
+				}
+
+				// The config is written with the resync section even though
+				// the resources did not change
+				Expect(mockMgr.appMgr.resyncStatus().Pending).To(BeFalse())
+				mw.Lock()
+				section, found := mw.Sections["resync"]
+				mw.Unlock()
+				Expect(found).To(BeTrue())
+				Expect(section.(resyncSection).Generation).To(Equal(1))
+			})
+
+			It("configures dual-stack virtual servers", func() {
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				mockMgr.addService(foo)
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						ipv6AddrAnnotation:         "2001:db8::4",
+					})
+				r := mockMgr.addIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress should be processed.")
+
+				mw.Lock()
+				resources := mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				virtuals := resources["velcro"].Virtuals
+				Expect(virtuals).To(HaveLen(2))
+				Expect(virtuals[0].Destination).To(Equal("/velcro/1.2.3.4:80"))
+				Expect(virtuals[1].VirtualServerName).To(Equal(
+					virtuals[0].VirtualServerName + ipv6VirtualSuffix))
+				Expect(virtuals[1].Destination).To(Equal(
+					"/velcro/2001:db8::4.80"))
+				Expect(virtuals[1].PoolName).To(Equal(virtuals[0].PoolName))
+				Expect(mockMgr.resources().CountOf(
+					serviceKey{"foo", 80, namespace})).To(Equal(1),
+					"The IPv6 virtual server should not be stored.")
+
+				// Invalid IPv6 addresses are ignored
+				ingress.ObjectMeta.Annotations[ipv6AddrAnnotation] = "1.2.3.5"
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				mw.Lock()
+				resources = mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				Expect(resources["velcro"].Virtuals).To(HaveLen(1))
+			})
+
+			It("describes the BIG-IP nodes of pool members", func() {
+				nodeAddrs := func(addr string) []v1.NodeAddress {
+					return []v1.NodeAddress{
+						{Type: v1.NodeInternalIP, Address: addr},
+						{Type: v1.NodeExternalIP, Address: addr},
+					}
+				}
+				mockMgr.processNodeUpdate([]v1.Node{
+					*test.NewNode("node1", "1", false, nodeAddrs("127.0.0.1")),
+					*test.NewNode("node2", "1", false, nodeAddrs("127.0.0.2")),
+				}, nil)
+
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				mockMgr.addService(foo)
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo})
+				r := mockMgr.addConfigMap(cfgFoo)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+
+				mw.Lock()
+				resources := mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				Expect(resources["velcro"].Nodes).To(Equal([]Node{
+					{Name: "127.0.0.1", Description: "Node node1"},
+					{Name: "127.0.0.2", Description: "Node node2"},
+				}))
+
+				// In cluster mode, the nodes are the pods of the endpoints
+				mockMgr.appMgr.isNodePort = false
+				svcPorts := []v1.ServicePort{newServicePort("port0", 80)}
+				endpts := test.NewEndpoints("foo", "1", namespace,
+					[]string{"10.2.96.0", "10.2.96.1"}, []string{},
+					convertSvcPortsToEndpointPorts(svcPorts))
+				nodeName := "node1"
+				endpts.Subsets[0].Addresses[0].TargetRef = &v1.ObjectReference{
+					Kind:      "Pod",
+					Namespace: namespace,
+					Name:      "foo-1",
+				}
+				endpts.Subsets[0].Addresses[0].NodeName = &nodeName
+				r = mockMgr.addEndpoints(endpts)
+				Expect(r).To(BeTrue(), "Endpoints should be processed.")
+				foo = test.NewService("foo", "2", namespace,
+					v1.ServiceTypeClusterIP, svcPorts)
+				r = mockMgr.updateService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+
+				mw.Lock()
+				resources = mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				Expect(resources["velcro"].Nodes).To(Equal([]Node{{
+					Name:        "10.2.96.0",
+					Description: "Pod " + namespace + "/foo-1 on node node1",
+				}}))
+
+				// The cluster identity tells apart clusters sharing a BIG-IP
+				mockMgr.appMgr.clusterIdentity = "east"
+				mockMgr.appMgr.outputConfig()
+				mw.Lock()
+				resources = mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				Expect(resources["velcro"].Nodes[0].Description).To(Equal(
+					"Pod " + namespace + "/foo-1 on node node1 in cluster east"))
+
+				appMgr := NewManager(&Params{
+					EventSourceComponent: "bigip-ctlr-east",
+					ClusterIdentity:      "east",
+				})
+				Expect(appMgr.eventSource).To(Equal(v1.EventSource{
+					Component: "bigip-ctlr-east",
+					Host:      "east",
+				}))
+				appMgr = NewManager(&Params{})
+				Expect(appMgr.eventSource.Component).To(Equal(
+					DefaultEventSourceComponent))
+			})
+
+			It("configures virtual servers without endpoints", func() {
+				mockMgr.appMgr.isNodePort = false
+				svcName := "foo"
+				emptyIps := []string{}
+				readyIps := []string{"10.2.96.0", "10.2.96.1", "10.2.96.2"}
+				notReadyIps := []string{"10.2.96.3", "10.2.96.4", "10.2.96.5", "10.2.96.6"}
+				svcPorts := []v1.ServicePort{
+					newServicePort("port0", 80),
+				}
+
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo})
+
+				foo := test.NewService(svcName, "1", namespace, v1.ServiceTypeClusterIP, svcPorts)
+
+				endptPorts := convertSvcPortsToEndpointPorts(svcPorts)
+				goodEndpts := test.NewEndpoints(svcName, "1", namespace, emptyIps, emptyIps,
+					endptPorts)
+
+				r := mockMgr.addEndpoints(goodEndpts)
+				Expect(r).To(BeTrue(), "Endpoints should be processed.")
+				// this is for another service
+				badEndpts := test.NewEndpoints("wrongSvc", "1", namespace, []string{"10.2.96.7"},
+					[]string{}, endptPorts)
+				r = mockMgr.addEndpoints(badEndpts)
+				Expect(r).To(BeTrue(), "Endpoints should be processed.")
+
+				r = mockMgr.addConfigMap(cfgFoo)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				r = mockMgr.addService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+
+				resources := mockMgr.resources()
+				Expect(resources.Count()).To(Equal(len(svcPorts)))
+				for _, p := range svcPorts {
+					Expect(resources.CountOf(serviceKey{"foo", p.Port, namespace})).To(Equal(1))
+					rs, ok := resources.Get(
+						serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
+					Expect(ok).To(BeTrue())
+					Expect(rs.Pools[0].Members).To(Equal([]Member(nil)))
+				}
+
+				validateServiceIps(svcName, namespace, svcPorts, nil, resources)
 
-				validateServiceIps(svcName, namespace, svcPorts, nil, resources)
-
 				// Move it back to ready from not ready and make sure it is re-added
 				r = mockMgr.updateEndpoints(test.NewEndpoints(
 					svcName, "2", namespace, readyIps, notReadyIps, endptPorts))
@@ -2115,6 +3380,109 @@ var _ = Describe("AppManager Tests", func() {
 				validateServiceIps(svcName, namespace, svcPorts, readyIps, resources)
 			})
 
+			It("uses endpoints as pool members via annotation in nodeport mode", func() {
+				mockMgr.appMgr.isNodePort = true
+				mockMgr.processNodeUpdate([]v1.Node{
+					*test.NewNode("node0", "0", false, []v1.NodeAddress{
+						{Type: "ExternalIP", Address: "127.0.0.0"}}),
+				}, nil)
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001,
+						TargetPort: intstr.FromInt(8080)}})
+				r := mockMgr.addService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				readyIps := []string{"10.2.96.0", "10.2.96.1"}
+				r = mockMgr.addEndpoints(test.NewEndpoints("foo", "1", namespace,
+					readyIps, []string{}, []v1.EndpointPort{{Port: 8080}}))
+				Expect(r).To(BeTrue(), "Endpoints should be processed.")
+
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				podIng := test.NewIngress("pods", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						poolMemberTypeAnnotation:   "Cluster",
+					})
+				r = mockMgr.addIngress(podIng)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				nodeIng := test.NewIngress("nodes", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.5",
+						poolMemberTypeAnnotation:   "invalid",
+					})
+				r = mockMgr.addIngress(nodeIng)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+
+				resources := mockMgr.resources()
+				fooKey := serviceKey{"foo", 80, namespace}
+				podMembers := []Member{
+					{Address: "10.2.96.0", Port: 8080, Session: "user-enabled"},
+					{Address: "10.2.96.1", Port: 8080, Session: "user-enabled"},
+				}
+				rs, ok := resources.Get(fooKey, formatIngressVSName(podIng, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.PoolMemberType).To(Equal("cluster"))
+				Expect(rs.Pools[0].Members).To(Equal(podMembers))
+				rs, ok = resources.Get(fooKey, formatIngressVSName(nodeIng, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.PoolMemberType).To(BeEmpty())
+				Expect(rs.Pools[0].Members).To(Equal([]Member{
+					{Address: "127.0.0.0", Port: 30001, Session: "user-enabled"}}))
+
+				// Node changes only update the pools of nodes
+				mockMgr.processNodeUpdate([]v1.Node{
+					*test.NewNode("node1", "0", false, []v1.NodeAddress{
+						{Type: "ExternalIP", Address: "127.0.0.1"}}),
+				}, nil)
+				rs, _ = resources.Get(fooKey, formatIngressVSName(podIng, "http"))
+				Expect(rs.Pools[0].Members).To(Equal(podMembers))
+				rs, _ = resources.Get(fooKey, formatIngressVSName(nodeIng, "http"))
+				Expect(rs.Pools[0].Members).To(Equal([]Member{
+					{Address: "127.0.0.1", Port: 30001, Session: "user-enabled"}}))
+			})
+
+			It("warns about the nodeport pool member type in cluster mode", func() {
+				mockMgr.appMgr.isNodePort = false
+				foo := test.NewService("foo", "1", namespace, "ClusterIP",
+					[]v1.ServicePort{{Port: 80, TargetPort: intstr.FromInt(8080)}})
+				r := mockMgr.addService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				r = mockMgr.addEndpoints(test.NewEndpoints("foo", "1", namespace,
+					[]string{"10.2.96.0"}, []string{}, []v1.EndpointPort{{Port: 8080}}))
+				Expect(r).To(BeTrue(), "Endpoints should be processed.")
+
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ing := test.NewIngress("nodes", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						poolMemberTypeAnnotation:   "nodeport",
+					})
+				r = mockMgr.addIngress(ing)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				vsName := formatIngressVSName(ing, "http")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools[0].Members).To(Equal([]Member{
+					{Address: "10.2.96.0", Port: 8080, Session: "user-enabled"}}))
+				Expect(mockMgr.appMgr.ignoredMemberTypes).To(HaveKey(vsName))
+
+				ing = test.NewIngress("nodes", "2", namespace, spec,
+					map[string]string{"virtual-server.f5.com/ip": "1.2.3.4"})
+				r = mockMgr.updateIngress(ing)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				Expect(mockMgr.appMgr.ignoredMemberTypes).ToNot(HaveKey(vsName))
+			})
+
 			It("configures virtual servers when endpoints change", func() {
 				mockMgr.appMgr.isNodePort = false
 				svcName := "foo"
@@ -2407,6 +3775,8 @@ var _ = Describe("AppManager Tests", func() {
 			})
 
 			It("configures virtual servers via Ingress", func() {
+				SetPartitions("velcro", []string{"velcro", "velcro2"})
+				defer SetPartitions("velcro", nil)
 				ingressConfig := v1beta1.IngressSpec{
 					Backend: &v1beta1.IngressBackend{
 						ServiceName: "foo",
@@ -2576,169 +3946,2952 @@ var _ = Describe("AppManager Tests", func() {
 				Expect(len(rs.Policies[0].Rules)).To(Equal(2))
 			})
 
-			It("handles ingress ssl profiles", func() {
-				svcName := "foo"
-				var svcPort int32 = 443
-				svcKey := serviceKey{
-					Namespace:   namespace,
-					ServiceName: svcName,
-					ServicePort: svcPort,
-				}
-				sslProfileName1 := "velcro/theSslProfileName"
-				sslProfileName2 := "common/anotherSslProfileName"
-
-				spec := v1beta1.IngressSpec{
-					TLS: []v1beta1.IngressTLS{
-						{
-							SecretName: sslProfileName1,
-						},
-						{
-							SecretName: sslProfileName2,
-						},
-					},
+			It("shares Ingress addresses on distinct ports", func() {
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				r := mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				ingressConfig := v1beta1.IngressSpec{
 					Backend: &v1beta1.IngressBackend{
-						ServiceName: svcName,
-						ServicePort: intstr.IntOrString{IntVal: svcPort},
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
 					},
 				}
-				fooIng := test.NewIngress("ingress", "1", namespace, spec,
-					map[string]string{
-						"virtual-server.f5.com/ip":        "1.2.3.4",
-						"virtual-server.f5.com/partition": "velcro",
-					})
-				svcPorts := []v1.ServicePort{newServicePort("port0", svcPort)}
-				fooSvc := test.NewService(svcName, "1", namespace, v1.ServiceTypeClusterIP,
-					svcPorts)
-				emptyIps := []string{}
-				readyIps := []string{"10.2.96.0", "10.2.96.1", "10.2.96.2"}
-				endpts := test.NewEndpoints(svcName, "1", namespace, readyIps, emptyIps,
-					convertSvcPortsToEndpointPorts(svcPorts))
-
-				// Add ingress, service, and endpoints objects and make sure the
-				// ssl-profile set in the ingress object shows up in the virtual server.
-				r := mockMgr.addIngress(fooIng)
-				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
-				r = mockMgr.addService(fooSvc)
-				Expect(r).To(BeTrue(), "Service should be processed.")
-				r = mockMgr.addEndpoints(endpts)
-				Expect(r).To(BeTrue(), "Endpoints should be processed.")
+				created := time.Now()
+				newIngress := func(name string, age int, annotations map[string]string) *v1beta1.Ingress {
+					annotations["virtual-server.f5.com/ip"] = "1.2.3.4"
+					ing := test.NewIngress(name, "1", namespace, ingressConfig,
+						annotations)
+					ing.ObjectMeta.CreationTimestamp = metav1.NewTime(
+						created.Add(time.Duration(-age) * time.Minute))
+					return ing
+				}
 				resources := mockMgr.resources()
-				Expect(resources.Count()).To(Equal(2))
-				Expect(resources.CountOf(svcKey)).To(Equal(2))
-				httpCfg, found := resources.Get(svcKey, formatIngressVSName(fooIng, "http"))
-				Expect(found).To(BeTrue())
-				Expect(httpCfg).ToNot(BeNil())
+				fooKey := serviceKey{"foo", 80, namespace}
 
-				httpsCfg, found := resources.Get(svcKey, formatIngressVSName(fooIng, "https"))
-				Expect(found).To(BeTrue())
-				Expect(httpsCfg).ToNot(BeNil())
-				secretArray := []string{
-					formatIngressSslProfileName(sslProfileName1),
-					formatIngressSslProfileName(sslProfileName2),
+				ing1 := newIngress("ing1", 3, map[string]string{})
+				r = mockMgr.addIngress(ing1)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				// The newer Ingress conflicts on port 80
+				ing2 := newIngress("ing2", 2, map[string]string{})
+				r = mockMgr.addIngress(ing2)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				Expect(resources.CountOf(fooKey)).To(Equal(1))
+				_, ok := resources.Get(fooKey, "default_ing2-ingress_http")
+				Expect(ok).To(BeFalse(), "Conflicting Ingress should not be configured.")
+				recorder := mockMgr.appMgr.eventRecorder.(*record.FakeRecorder)
+				mockMgr.processStatusUpdates()
+				var events []string
+				for len(recorder.Events) > 0 {
+					events = append(events, <-recorder.Events)
 				}
-				sort.Strings(secretArray)
-				Expect(httpsCfg.Virtual.GetFrontendSslProfileNames()).To(Equal(secretArray))
-
-				// No annotations were specified to control http redirect, check that
-				// we are in the default state 2.
-				Expect(len(httpCfg.Virtual.IRules)).To(Equal(1))
-				expectedIRuleName := fmt.Sprintf("/%s/%s",
-					DEFAULT_PARTITION, httpRedirectIRuleName)
-				Expect(httpCfg.Virtual.IRules[0]).To(Equal(expectedIRuleName))
+				Expect(events).To(ContainElement(ContainSubstring("AddressConflict")))
 
-				// Set the annotations the same as default and recheck
-				fooIng.ObjectMeta.Annotations[ingressSslRedirect] = "true"
-				fooIng.ObjectMeta.Annotations[ingressAllowHttp] = "false"
-				r = mockMgr.addIngress(fooIng)
-				httpCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "http"))
-				Expect(found).To(BeTrue())
-				Expect(httpCfg).ToNot(BeNil())
+				// A distinct port may share the address
+				ing2 = newIngress("ing2", 2, map[string]string{
+					"virtual-server.f5.com/http-port": "8080",
+				})
+				r = mockMgr.updateIngress(ing2)
 				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
-				Expect(len(httpCfg.Virtual.IRules)).To(Equal(1))
-				expectedIRuleName = fmt.Sprintf("/%s/%s",
-					DEFAULT_PARTITION, httpRedirectIRuleName)
-				Expect(httpCfg.Virtual.IRules[0]).To(Equal(expectedIRuleName))
+				rs, ok := resources.Get(fooKey, "default_ing2-ingress_http")
+				Expect(ok).To(BeTrue(), "Ingress on a distinct port should be configured.")
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("1.2.3.4"))
+				Expect(rs.Virtual.VirtualAddress.Port).To(Equal(int32(8080)))
+				Expect(resources.CountOf(fooKey)).To(Equal(2))
 
-				// Now test state 1.
-				fooIng.ObjectMeta.Annotations[ingressSslRedirect] = "false"
-				fooIng.ObjectMeta.Annotations[ingressAllowHttp] = "false"
-				r = mockMgr.addIngress(fooIng)
-				httpsCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "https"))
-				Expect(found).To(BeTrue())
-				Expect(httpsCfg).ToNot(BeNil())
+				// Only Ingresses of the same sharing group share an address
+				ing3 := newIngress("ing3", 1, map[string]string{
+					"virtual-server.f5.com/http-port":        "8081",
+					"virtual-server.f5.com/ip-sharing-group": "team-a",
+				})
+				r = mockMgr.addIngress(ing3)
 				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
-				Expect(resources.Count()).To(Equal(1))
-				Expect(resources.CountOf(svcKey)).To(Equal(1))
-				Expect(len(httpsCfg.Policies)).To(Equal(0))
-				Expect(httpsCfg.Virtual.GetFrontendSslProfileNames()).To(Equal(secretArray))
+				_, ok = resources.Get(fooKey, "default_ing3-ingress_http")
+				Expect(ok).To(BeFalse(), "Ingress of another group should not be configured.")
 
-				// Now test state 3.
-				fooIng.ObjectMeta.Annotations[ingressSslRedirect] = "false"
-				fooIng.ObjectMeta.Annotations[ingressAllowHttp] = "true"
-				r = mockMgr.addIngress(fooIng)
-				httpCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "http"))
-				Expect(found).To(BeTrue())
-				Expect(httpCfg).ToNot(BeNil())
+				// The older Ingress keeps the address when it is updated
+				ing1 = newIngress("ing1", 3, map[string]string{
+					"virtual-server.f5.com/http-port": "8080",
+				})
+				r = mockMgr.updateIngress(ing1)
 				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
-				Expect(len(httpCfg.Policies)).To(Equal(0))
+				rs, ok = resources.Get(fooKey, "default_ing1-ingress_http")
+				Expect(ok).To(BeTrue(), "Older Ingress should be configured.")
+				Expect(rs.Virtual.VirtualAddress.Port).To(Equal(int32(8080)))
+				_, ok = resources.Get(fooKey, "default_ing2-ingress_http")
+				Expect(ok).To(BeFalse(), "Newer Ingress should be removed.")
+
+				// The Ingresses refused the address are synced again when
+				// the Ingress holding it is deleted
+				Expect(mockMgr.appMgr.addressLosers.losers).To(HaveKeyWithValue(
+					"default/ing1", HaveKey("default/ing2")))
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				appInf.ingInformer.GetStore().Delete(ing1)
+				mockMgr.appMgr.handleIngressDelete(ing1)
+				Expect(mockMgr.appMgr.vsQueue.Len()).To(BeNumerically(">", 0))
+				for mockMgr.appMgr.vsQueue.Len() > 0 {
+					mockMgr.appMgr.processNextVirtualServer()
+				}
+				rs, ok = resources.Get(fooKey, "default_ing2-ingress_http")
+				Expect(ok).To(BeTrue(), "Refused Ingress should be configured.")
+				Expect(rs.Virtual.VirtualAddress.Port).To(Equal(int32(8080)))
+				_, ok = resources.Get(fooKey, "default_ing3-ingress_http")
+				Expect(ok).To(BeFalse(), "Ingress of another group should not be configured.")
+				Expect(mockMgr.appMgr.addressLosers.losers).To(HaveKeyWithValue(
+					"default/ing2", HaveKey("default/ing3")))
+			})
 
-				// Clear out TLS in the ingress, but use default http redirect settings.
-				fooIng.Spec.TLS = nil
-				delete(fooIng.ObjectMeta.Annotations, ingressSslRedirect)
-				delete(fooIng.ObjectMeta.Annotations, ingressAllowHttp)
-				r = mockMgr.addIngress(fooIng)
-				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+			It("routes requests by header via Ingress annotation", func() {
+				for _, name := range []string{"foo", "bar"} {
+					svc := test.NewService(name, "1", namespace, "NodePort",
+						[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+					r := mockMgr.addService(svc)
+					Expect(r).To(BeTrue(), "Service should be processed.")
+				}
+				single := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, single,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						ingressHeaderRulesAnnotation: `[
+							{"header": "X-Env", "values": ["staging"],
+							 "serviceName": "bar", "servicePort": 80},
+							{"cookie": "beta", "operand": "startsWith",
+							 "values": ["1"], "host": "foo.example.com",
+							 "serviceName": "bar", "servicePort": 80},
+							{"header": "X-Env", "values": ["test"],
+							 "serviceName": "missing", "servicePort": 80}]`,
+					})
+				r := mockMgr.addIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				vsName := formatIngressVSName(ingress, "http")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"bar", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue(), "Header rule service should have a pool.")
+				Expect(rs.Pools).To(HaveLen(2))
+				Expect(rs.Pools[1].Name).To(Equal(vsName + "_header_0"))
+				Expect(rs.Virtual.PoolName).To(Equal("/velcro/" + vsName))
+				Expect(rs.Policies).To(HaveLen(1))
+				rules := rs.Policies[0].Rules
+				Expect(rules).To(HaveLen(2))
+				Expect(rules[0].Name).To(Equal("0"))
+				Expect(*rules[0].Conditions[0]).To(Equal(condition{
+					Name:       "0",
+					Equals:     true,
+					HTTPHeader: true,
+					Request:    true,
+					TmName:     "X-Env",
+					Values:     []string{"staging"},
+				}))
+				Expect(rules[0].Actions[0].Pool).To(Equal(
+					"/velcro/" + vsName + "_header_0"))
+				Expect(rules[1].Conditions).To(HaveLen(2))
+				Expect(rules[1].Conditions[0].HTTPCookie).To(BeTrue())
+				Expect(rules[1].Conditions[0].StartsWith).To(BeTrue())
+				Expect(rules[1].Conditions[1].Values).To(Equal(
+					[]string{"foo.example.com"}))
+
+				// Header rules come before the rules of the Ingress and reuse
+				// its pools
+				multi := v1beta1.IngressSpec{
+					Rules: []v1beta1.IngressRule{
+						{Host: "foo.example.com",
+							IngressRuleValue: v1beta1.IngressRuleValue{
+								HTTP: &v1beta1.HTTPIngressRuleValue{
+									Paths: []v1beta1.HTTPIngressPath{
+										{Path: "/foo",
+											Backend: v1beta1.IngressBackend{
+												ServiceName: "foo",
+												ServicePort: intstr.IntOrString{IntVal: 80},
+											},
+										},
+										{Path: "/bar",
+											Backend: v1beta1.IngressBackend{
+												ServiceName: "bar",
+												ServicePort: intstr.IntOrString{IntVal: 80},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				ingress = test.NewIngress("ingress", "2", namespace, multi,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						ingressHeaderRulesAnnotation: `[{"header": "X-Env",
+							"values": ["staging"], "serviceName": "bar",
+							"servicePort": 80}]`,
+					})
+				r = mockMgr.updateIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				rs, _ = mockMgr.resources().Get(
+					serviceKey{"bar", 80, namespace}, vsName)
+				Expect(rs.Pools).To(HaveLen(2))
+				rules = rs.Policies[0].Rules
+				Expect(rules).To(HaveLen(3))
+				Expect(rules[0].Conditions[0].HTTPHeader).To(BeTrue())
+				Expect(rules[0].Actions[0].Pool).To(Equal(
+					"/velcro/" + vsName + "_1"))
+				for i, rl := range rules {
+					Expect(rl.Ordinal).To(Equal(i))
+					Expect(rl.Name).To(Equal(fmt.Sprintf("%d", i)))
+				}
+				Expect(rules[1].FullURI).To(Equal("foo.example.com/foo"))
+
+				// Invalid rules are ignored
+				ingress = test.NewIngress("ingress", "3", namespace, single,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						ingressHeaderRulesAnnotation: `[{"header": "X-Env",
+							"cookie": "beta", "values": ["staging"],
+							"serviceName": "bar", "servicePort": 80}]`,
+					})
+				r = mockMgr.updateIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools).To(HaveLen(1))
+				Expect(rs.Policies).To(BeEmpty())
+			})
+
+			It("resets requests with methods not allowed by an Ingress", func() {
+				svc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				r := mockMgr.addService(svc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				single := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, single,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						allowedMethodsAnnotation:   "get, POST,get",
+					})
+				r = mockMgr.addIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				vsName := formatIngressVSName(ingress, "http")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.PoolName).To(Equal("/velcro/" + vsName))
+				Expect(rs.Policies).To(HaveLen(1))
+				rules := rs.Policies[0].Rules
+				Expect(rules).To(HaveLen(1))
+				Expect(*rules[0].Conditions[0]).To(Equal(condition{
+					Name:       "0",
+					Equals:     true,
+					HTTPMethod: true,
+					Not:        true,
+					Request:    true,
+					Values:     []string{"GET", "POST"},
+				}))
+				Expect(*rules[0].Actions[0]).To(Equal(action{
+					Name:    "0",
+					Forward: true,
+					Request: true,
+					Reset:   true,
+				}))
+
+				// The method rule comes before the header rules
+				ingress = test.NewIngress("ingress", "2", namespace, single,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						allowedMethodsAnnotation:   "GET",
+						ingressHeaderRulesAnnotation: `[{"header": "X-Env",
+							"values": ["staging"], "serviceName": "foo",
+							"servicePort": 80}]`,
+					})
+				r = mockMgr.updateIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				rs, _ = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				rules = rs.Policies[0].Rules
+				Expect(rules).To(HaveLen(2))
+				Expect(rules[0].Conditions[0].HTTPMethod).To(BeTrue())
+				Expect(rules[1].Conditions[0].HTTPHeader).To(BeTrue())
+				for i, rl := range rules {
+					Expect(rl.Ordinal).To(Equal(i))
+					Expect(rl.Name).To(Equal(fmt.Sprintf("%d", i)))
+				}
+
+				// Invalid methods are ignored
+				ingress = test.NewIngress("ingress", "3", namespace, single,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						allowedMethodsAnnotation:   "GET,P*ST",
+					})
+				r = mockMgr.updateIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				rs, _ = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(rs.Policies).To(BeEmpty())
+			})
+
+			It("coalesces endpoints changes in the dampening window", func() {
+				mockMgr.appMgr.endpointsDampening = 100 * time.Millisecond
+				queue := mockMgr.appMgr.vsQueue
+				for i := 0; i < 5; i++ {
+					endpts := test.NewEndpoints("foo", fmt.Sprintf("%d", i),
+						namespace, []string{"10.2.96.1"}, []string{},
+						[]v1.EndpointPort{{Port: 8080}})
+					mockMgr.appMgr.enqueueEndpoints(endpts)
+				}
+				Expect(queue.Len()).To(Equal(0), "Sync should be delayed.")
+				Eventually(queue.Len).Should(Equal(1))
+				Consistently(queue.Len, 200*time.Millisecond).Should(Equal(1))
+				key, _ := queue.Get()
+				Expect(key).To(Equal(serviceQueueKey{
+					ServiceName: "foo",
+					Namespace:   namespace,
+				}))
+				queue.Done(key)
+
+				mockMgr.appMgr.endpointsDampening = 0
+				mockMgr.appMgr.enqueueEndpoints(test.NewEndpoints("foo", "6",
+					namespace, []string{}, []string{}, []v1.EndpointPort{}))
+				Expect(queue.Len()).To(Equal(1))
+			})
+
+			It("applies the default annotations of namespaces", func() {
+				mockMgr.appMgr.nsDefaultsInformer =
+					mockMgr.appMgr.newNamespaceDefaultsInformer(0)
+				ns := &v1.Namespace{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: namespace,
+						Annotations: map[string]string{
+							"virtual-server.f5.com/balance": "least-connections-member",
+							"virtual-server.f5.com/ip":      "10.1.1.1",
+						},
+					},
+				}
+				mockMgr.appMgr.nsDefaultsInformer.GetStore().Add(ns)
+
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				mockMgr.addService(foo)
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				defaultIng := test.NewIngress("default", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				r := mockMgr.addIngress(defaultIng)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				ownIng := test.NewIngress("own", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.5",
+						"virtual-server.f5.com/partition": "velcro",
+						"virtual-server.f5.com/balance":   "round-robin",
+					})
+				r = mockMgr.addIngress(ownIng)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+
+				resources := mockMgr.resources()
+				fooKey := serviceKey{"foo", 80, namespace}
+				rs, ok := resources.Get(fooKey, formatIngressVSName(defaultIng, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools[0].Balance).To(Equal("least-connections-member"))
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("1.2.3.4"))
+				// Annotations of the Ingress win over the defaults
+				rs, ok = resources.Get(fooKey, formatIngressVSName(ownIng, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools[0].Balance).To(Equal("round-robin"))
+				// The stored Ingress is left untouched
+				Expect(defaultIng.ObjectMeta.Annotations).ToNot(
+					HaveKey("virtual-server.f5.com/balance"))
+
+				// Only the supported annotations are defaults
+				annotations := mockMgr.appMgr.withNamespaceDefaults(namespace, nil)
+				Expect(annotations).To(Equal(map[string]string{
+					"virtual-server.f5.com/balance": "least-connections-member",
+				}))
+				Expect(mockMgr.appMgr.withNamespaceDefaults("other", nil)).To(BeNil())
+
+				// Changing the defaults syncs the services of the namespace
+				queue := mockMgr.appMgr.vsQueue
+				for queue.Len() > 0 {
+					key, _ := queue.Get()
+					queue.Done(key)
+				}
+				mockMgr.appMgr.enqueueNamespaceServices(ns)
+				Expect(queue.Len()).To(Equal(1))
+			})
+
+			It("indexes the resources referencing Secrets", func() {
+				spec := v1beta1.IngressSpec{
+					TLS: []v1beta1.IngressTLS{
+						{SecretName: "shared"},
+						{SecretName: "/Common/clientssl"},
+					},
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				mockMgr.addIngress(ingress)
+				var configmapSecrets string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "bar",
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "mode": "http",
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.240",
+					        "port": 443
+					      },
+					      "sslProfile": {
+					        "f5ProfileNames": ["shared", "Common/clientssl"]
+					      },
+					      "serverSslProfile": {
+					        "caSecret": "ca"
+					      }
+					    }
+					  }
+					}`)
+				cfg := test.NewConfigMap("secrets", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapSecrets,
+				})
+				mockMgr.addConfigMap(cfg)
+
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				ingresses, err := appInf.ingInformer.GetIndexer().ByIndex(
+					secretIndex, namespace+"/shared")
+				Expect(err).To(BeNil())
+				Expect(ingresses).To(Equal([]interface{}{ingress}))
+				cfgMaps, err := appInf.cfgMapInformer.GetIndexer().ByIndex(
+					secretIndex, namespace+"/ca")
+				Expect(err).To(BeNil())
+				Expect(cfgMaps).To(Equal([]interface{}{cfg}))
+				// BIG-IP profile paths are not Secrets
+				objs, err := appInf.cfgMapInformer.GetIndexer().ByIndex(
+					secretIndex, namespace+"/Common/clientssl")
+				Expect(err).To(BeNil())
+				Expect(objs).To(BeEmpty())
+
+				// Only the services of the resources using the Secret are synced
+				queue := mockMgr.appMgr.vsQueue
+				secret := &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "shared",
+						Namespace: namespace,
+					},
+				}
+				mockMgr.appMgr.enqueueSecret(secret)
+				Expect(queue.Len()).To(Equal(2))
+				for _, service := range []string{"foo", "bar"} {
+					key, _ := queue.Get()
+					Expect(key).To(Equal(serviceQueueKey{
+						ServiceName: service,
+						Namespace:   namespace,
+					}))
+					queue.Done(key)
+				}
+				secret.ObjectMeta.Name = "ca"
+				mockMgr.appMgr.enqueueSecret(secret)
+				Expect(queue.Len()).To(Equal(1))
+				secret.ObjectMeta.Name = "unused"
+				mockMgr.appMgr.enqueueSecret(cache.DeletedFinalStateUnknown{
+					Key: namespace + "/unused", Obj: secret})
+				Expect(queue.Len()).To(Equal(1))
+			})
+
+			It("validates resources in the admission webhook", func() {
+				mockMgr.appMgr.admissionSchema = schemaUrl
+				handler := mockMgr.appMgr.AdmissionHandler()
+				review := func(kind, op string, obj interface{}) *admissionResponse {
+					raw, err := json.Marshal(obj)
+					Expect(err).To(BeNil())
+					body, err := json.Marshal(admissionReview{
+						APIVersion: "admission.k8s.io/v1beta1",
+						Kind:       "AdmissionReview",
+						Request: &admissionRequest{
+							UID:       "uid-1",
+							Kind:      metav1.GroupVersionKind{Kind: kind},
+							Namespace: namespace,
+							Operation: op,
+							Object:    raw,
+						},
+					})
+					Expect(err).To(BeNil())
+					w := httptest.NewRecorder()
+					handler.ServeHTTP(w, httptest.NewRequest(
+						"POST", "/validate", bytes.NewReader(body)))
+					Expect(w.Code).To(Equal(200))
+					var result admissionReview
+					Expect(json.Unmarshal(w.Body.Bytes(), &result)).To(Succeed())
+					Expect(result.Response).ToNot(BeNil())
+					Expect(result.Response.UID).To(Equal("uid-1"))
+					return result.Response
+				}
+
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				good := test.NewIngress("good", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":      "1.2.3.4",
+						"virtual-server.f5.com/balance": "least-connections-node",
+					})
+				Expect(review("Ingress", "CREATE", good).Allowed).To(BeTrue())
+				Expect(mockMgr.addIngress(good)).To(BeTrue())
+
+				bad := test.NewIngress("bad", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":      "1.2.3.4",
+						"virtual-server.f5.com/balance": "fastest",
+						ingHealthMonitorAnnotation:      `[{"path": "foo/",`,
+						poolServiceDownAnnotation:       "bounce",
+						fallbackPoolAnnotation:          "sorry",
+						bandwidthPolicyAnnotation:       "bwc-10mbps",
+					})
+				resp := review("Ingress", "CREATE", bad)
+				Expect(resp.Allowed).To(BeFalse())
+				Expect(resp.Result.Message).To(ContainSubstring("fastest"))
+				Expect(resp.Result.Message).To(ContainSubstring(
+					ingHealthMonitorAnnotation))
+				Expect(resp.Result.Message).To(ContainSubstring(
+					poolServiceDownAnnotation))
+				Expect(resp.Result.Message).To(ContainSubstring(
+					fallbackPoolAnnotation))
+				Expect(resp.Result.Message).To(ContainSubstring(
+					bandwidthPolicyAnnotation))
+				Expect(review("Ingress", "DELETE", bad).Allowed).To(BeTrue())
+
+				// Same address and port as the existing Ingress
+				conflict := test.NewIngress("conflict", "1", namespace, spec,
+					map[string]string{"virtual-server.f5.com/ip": "1.2.3.4"})
+				conflict.ObjectMeta.CreationTimestamp = metav1.Now()
+				resp = review("Ingress", "CREATE", conflict)
+				Expect(resp.Allowed).To(BeFalse())
+				Expect(resp.Result.Message).To(ContainSubstring(
+					"conflicts with Ingress default/good"))
+				// Other Ingress classes are not checked
+				conflict.ObjectMeta.Annotations["kubernetes.io/ingress.class"] = "nginx"
+				Expect(review("Ingress", "CREATE", conflict).Allowed).To(BeTrue())
+
+				f5Labels := map[string]string{"f5type": "virtual-server"}
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace,
+					map[string]string{"schema": schemaUrl, "data": configmapFoo})
+				cfgFoo.ObjectMeta.Labels = f5Labels
+				Expect(review("ConfigMap", "CREATE", cfgFoo).Allowed).To(BeTrue())
+				Expect(mockMgr.addConfigMap(cfgFoo)).To(BeTrue())
+				Expect(review("ConfigMap", "UPDATE", cfgFoo).Allowed).To(BeTrue())
+
+				cfgDup := test.NewConfigMap("foomap2", "1", namespace,
+					map[string]string{"schema": schemaUrl, "data": configmapFoo})
+				cfgDup.ObjectMeta.Labels = f5Labels
+				resp = review("ConfigMap", "CREATE", cfgDup)
+				Expect(resp.Allowed).To(BeFalse())
+				Expect(resp.Result.Message).To(ContainSubstring(
+					"already used by default_foomap"))
+
+				cfgInvalid := test.NewConfigMap("invalid", "1", namespace,
+					map[string]string{"schema": schemaUrl,
+						"data": configmapFooInvalid})
+				cfgInvalid.ObjectMeta.Labels = f5Labels
+				Expect(review("ConfigMap", "CREATE", cfgInvalid).Allowed).To(BeFalse())
+				// ConfigMaps without the label are not managed
+				cfgInvalid.ObjectMeta.Labels = nil
+				Expect(review("ConfigMap", "CREATE", cfgInvalid).Allowed).To(BeTrue())
+				// The label is the one the namespace is watched with
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				appInf.cfgMapSelector = labels.SelectorFromSet(
+					labels.Set{"f5type": "custom"})
+				cfgInvalid.ObjectMeta.Labels = map[string]string{"f5type": "custom"}
+				Expect(review("ConfigMap", "CREATE", cfgInvalid).Allowed).To(BeFalse())
+				cfgInvalid.ObjectMeta.Labels = f5Labels
+				Expect(review("ConfigMap", "CREATE", cfgInvalid).Allowed).To(BeTrue())
+				// Resources of namespaces that are not watched are not managed
+				raw, err := json.Marshal(cfgInvalid)
+				Expect(err).To(BeNil())
+				problems, err := mockMgr.appMgr.validateAdmission(&admissionRequest{
+					Kind:      metav1.GroupVersionKind{Kind: "ConfigMap"},
+					Namespace: "other",
+					Operation: "CREATE",
+					Object:    raw,
+				})
+				Expect(err).To(BeNil())
+				Expect(problems).To(BeEmpty())
+
+				route := map[string]interface{}{
+					"apiVersion": "v1",
+					"kind":       "Route",
+					"metadata": metav1.ObjectMeta{
+						Name:      "route",
+						Namespace: namespace,
+						Annotations: map[string]string{
+							poolReselectTriesAnnotation: "-1"},
+					},
+				}
+				Expect(review("Route", "CREATE", route).Allowed).To(BeFalse())
+			})
+
+			It("cleans up deleted Ingresses and Routes directly", func() {
+				ingressConfig := v1beta1.IngressSpec{
+					Rules: []v1beta1.IngressRule{
+						{Host: "host1",
+							IngressRuleValue: v1beta1.IngressRuleValue{
+								HTTP: &v1beta1.HTTPIngressRuleValue{
+									Paths: []v1beta1.HTTPIngressPath{
+										{Path: "/foo",
+											Backend: v1beta1.IngressBackend{
+												ServiceName: "foo",
+												ServicePort: intstr.IntOrString{IntVal: 80},
+											},
+										},
+										{Path: "/bar",
+											Backend: v1beta1.IngressBackend{
+												ServiceName: "bar",
+												ServicePort: intstr.IntOrString{IntVal: 80},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				barSvc := test.NewService("bar", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37002}})
+				mockMgr.addService(fooSvc)
+				mockMgr.addService(barSvc)
+				ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				r := mockMgr.addIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				resources := mockMgr.resources()
+				Expect(resources.Count()).To(Equal(2))
+
+				// The bar service disappears without its event being processed,
+				// so the Ingress no longer derives a key for it.
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				appInf.svcInformer.GetStore().Delete(barSvc)
+				appInf.ingInformer.GetStore().Delete(ingress)
+				mockMgr.appMgr.handleIngressDelete(
+					cache.DeletedFinalStateUnknown{Key: "ingress", Obj: ingress})
+				Expect(resources.Count()).To(Equal(0))
+
+				spec := routeapi.RouteSpec{
+					Host: "foobar.com",
+					Path: "/foo",
+					To: routeapi.RouteTargetReference{
+						Kind: "Service",
+						Name: "foo",
+					},
+				}
+				route := test.NewRoute("route", "1", namespace, spec)
+				r = mockMgr.addRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(resources.Count()).ToNot(BeZero())
+
+				appInf.svcInformer.GetStore().Delete(fooSvc)
+				appInf.routeInformer.GetStore().Delete(route)
+				mockMgr.appMgr.handleRouteDelete(route)
+				Expect(resources.Count()).To(Equal(0))
+			})
+
+			It("reserves the address of deleted Ingresses and Routes", func() {
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				mockMgr.addService(fooSvc)
+				spec := v1beta1.IngressSpec{
+					Rules: []v1beta1.IngressRule{
+						{Host: "foo.example.com",
+							IngressRuleValue: v1beta1.IngressRuleValue{
+								HTTP: &v1beta1.HTTPIngressRuleValue{
+									Paths: []v1beta1.HTTPIngressPath{
+										{Path: "/",
+											Backend: v1beta1.IngressBackend{
+												ServiceName: "foo",
+												ServicePort: intstr.FromInt(80),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip": "1.2.3.4",
+						preserveVIPAnnotation:      "1h",
+					})
+				r := mockMgr.addIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				resources := mockMgr.resources()
+				Expect(resources.Count()).To(Equal(1))
+
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				appInf.ingInformer.GetStore().Delete(ingress)
+				mockMgr.appMgr.handleIngressDelete(ingress)
+				Expect(resources.Count()).To(Equal(0))
+				tombstones := mockMgr.appMgr.vipTombstones
+				Expect(tombstones.reserved(ingressKind, namespace, "ingress")).To(
+					Equal("1.2.3.4"))
+				records := make(map[string]string)
+				tombstones.addDNSRecords(records)
+				Expect(records).To(Equal(map[string]string{
+					"foo.example.com": "1.2.3.4"}))
+
+				// Other Ingresses cannot use the reserved address
+				other := test.NewIngress("other", "1", namespace, spec,
+					map[string]string{"virtual-server.f5.com/ip": "1.2.3.4"})
+				r = mockMgr.addIngress(other)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				Expect(resources.Count()).To(Equal(0))
+				appInf.ingInformer.GetStore().Delete(other)
+
+				// The reservations are saved and restored
+				saved, err := tombstones.marshal()
+				Expect(err).To(BeNil())
+				restored := newVIPTombstones()
+				Expect(restored.unmarshal(saved)).To(Succeed())
+				Expect(restored.reserved(ingressKind, namespace, "ingress")).To(
+					Equal("1.2.3.4"))
+				Expect(restored.unmarshal("not json")).ToNot(Succeed())
+
+				// The Ingress re-created without an address gets it back
+				ingress = test.NewIngress("ingress", "2", namespace, spec,
+					map[string]string{})
+				r = mockMgr.addIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				rs, ok := resources.Get(serviceKey{"foo", 80, namespace},
+					formatIngressVSName(ingress, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("1.2.3.4"))
+
+				// The reservation ends once it has an address of its own
+				ingress = test.NewIngress("ingress", "3", namespace, spec,
+					map[string]string{"virtual-server.f5.com/ip": "1.2.3.5"})
+				r = mockMgr.updateIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				Expect(tombstones.reserved(ingressKind, namespace, "ingress")).To(BeEmpty())
+
+				// Reservations expire
+				tombstones.add(ingressKind, namespace, "ingress", "1.2.3.5", nil,
+					time.Nanosecond)
+				time.Sleep(time.Millisecond)
+				Expect(tombstones.reserved(ingressKind, namespace, "ingress")).To(BeEmpty())
+				_, err = parsePreserveVIP("0s")
+				Expect(err).ToNot(BeNil())
+
+				// The host of a deleted Route stays published on the shared
+				// address
+				mockMgr.appMgr.routeConfig.RouteVSAddr = "10.0.0.1"
+				route := test.NewRoute("route", "1", namespace,
+					routeapi.RouteSpec{Host: "bar.example.com"})
+				route.ObjectMeta.Annotations = map[string]string{
+					preserveVIPAnnotation: "1h"}
+				mockMgr.appMgr.preserveRouteVIP(route)
+				Expect(tombstones.reserved(routeKind, namespace, "route")).To(
+					Equal("10.0.0.1"))
+				records = make(map[string]string)
+				tombstones.addDNSRecords(records)
+				Expect(records).To(Equal(map[string]string{
+					"bar.example.com": "10.0.0.1"}))
+				holder, ok := tombstones.reservedFor("10.0.0.1", namespace,
+					"ingress")
+				Expect(ok).To(BeTrue())
+				Expect(holder.String()).To(Equal("Route '" + namespace +
+					"/route'"))
+			})
+
+			It("keys the virtual server queue by resource", func() {
+				mockMgr.appMgr.queueByResource = true
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				mockMgr.addService(fooSvc)
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.FromInt(80),
+					},
+				}
+				ingress1 := test.NewIngress("ingress1", "1", namespace, spec,
+					map[string]string{"virtual-server.f5.com/ip": "1.2.3.4"})
+				ingress2 := test.NewIngress("ingress2", "1", namespace, spec,
+					map[string]string{"virtual-server.f5.com/ip": "1.2.3.5"})
+				r := mockMgr.addIngress(ingress1)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				r = mockMgr.addIngress(ingress2)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				resources := mockMgr.resources()
+				Expect(resources.Count()).To(Equal(2))
+
+				// Service events give a key for each Ingress
+				keys := mockMgr.appMgr.serviceKeys([]*serviceQueueKey{
+					{Namespace: namespace, ServiceName: "foo"}})
+				key1 := serviceQueueKey{
+					Namespace:    namespace,
+					ServiceName:  "foo",
+					ResourceKind: ingressKind,
+					ResourceName: namespace + "/ingress1",
+				}
+				key2 := key1
+				key2.ResourceName = namespace + "/ingress2"
+				Expect(keys).To(ConsistOf(&key1, &key2))
+
+				// A key only syncs its own Ingress
+				ingress1 = test.NewIngress("ingress1", "2", namespace, spec,
+					map[string]string{"virtual-server.f5.com/ip": "1.2.3.6"})
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				appInf.ingInformer.GetStore().Update(ingress1)
+				mockMgr.appMgr.syncVirtualServer(key2)
+				rs, ok := resources.Get(serviceKey{"foo", 80, namespace},
+					formatIngressVSName(ingress1, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("1.2.3.4"))
+				Expect(resources.Count()).To(Equal(2))
+				mockMgr.appMgr.syncVirtualServer(key1)
+				rs, ok = resources.Get(serviceKey{"foo", 80, namespace},
+					formatIngressVSName(ingress1, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("1.2.3.6"))
+				Expect(resources.Count()).To(Equal(2))
+				Expect(key1.owns(rs)).To(BeTrue())
+				Expect(key2.owns(rs)).To(BeFalse())
+				cfgMapKey := key1
+				cfgMapKey.ResourceKind = configMapKind
+				Expect(cfgMapKey.owns(rs)).To(BeFalse())
+				Expect(rs.MetaData.ResourceType).To(Equal("ingress"))
+				Expect(rs.MetaData.ResourceName).To(Equal(namespace + "/ingress1"))
+
+				// Passthrough Ingresses are synced with their namespace
+				keys = mockMgr.appMgr.scopeKeys(
+					[]*serviceQueueKey{{Namespace: namespace, ServiceName: "foo"}},
+					ingressKind, namespace, "ingress1", true)
+				Expect(keys).To(HaveLen(1))
+				Expect(keys[0].ResourceKind).To(Equal(ingressKind))
+				Expect(keys[0].ResourceName).To(BeEmpty())
+			})
+
+			It("configures Ingress pools for multiple service ports", func() {
+				ingressConfig := v1beta1.IngressSpec{
+					Rules: []v1beta1.IngressRule{
+						{Host: "host1",
+							IngressRuleValue: v1beta1.IngressRuleValue{
+								HTTP: &v1beta1.HTTPIngressRuleValue{
+									Paths: []v1beta1.HTTPIngressPath{
+										{Path: "/foo",
+											Backend: v1beta1.IngressBackend{
+												ServiceName: "foo",
+												ServicePort: intstr.FromString("http"),
+											},
+										},
+										{Path: "/admin",
+											Backend: v1beta1.IngressBackend{
+												ServiceName: "foo",
+												ServicePort: intstr.FromInt(8080),
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{
+						{Name: "http", Port: 80, NodePort: 37001},
+						{Name: "admin", Port: 8080, NodePort: 37002},
+					})
+				r := mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				r = mockMgr.addIngress(ingress)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				resources := mockMgr.resources()
+				Expect(resources.Count()).To(Equal(2))
+
+				rs, ok := resources.Get(
+					serviceKey{"foo", 8080, "default"}, "default_ingress-ingress_http")
+				Expect(ok).To(BeTrue(), "Ingress should be accessible.")
+				Expect(len(rs.Pools)).To(Equal(2))
+				Expect(rs.Pools[0].ServicePort).To(Equal(int32(80)))
+				Expect(rs.Pools[1].ServicePort).To(Equal(int32(8080)))
+				Expect(rs.MetaData.Active).To(BeTrue())
+
+				poolForPath := make(map[string]string)
+				for _, rule := range rs.Policies[0].Rules {
+					for _, action := range rule.Actions {
+						if action.Forward {
+							poolForPath[rule.FullURI] = action.Pool
+						}
+					}
+				}
+				Expect(poolForPath["host1/foo"]).To(Equal(
+					"/velcro/" + rs.Pools[0].Name))
+				Expect(poolForPath["host1/admin"]).To(Equal(
+					"/velcro/" + rs.Pools[1].Name))
+
+				// Named port that the service does not define
+				ingressConfig.Rules[0].IngressRuleValue.HTTP.Paths[0].Backend.ServicePort =
+					intstr.FromString("missing")
+				ingress2 := test.NewIngress("ingress", "2", namespace, ingressConfig,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				r = mockMgr.updateIngress(ingress2)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				rs, ok = resources.Get(
+					serviceKey{"foo", 8080, "default"}, "default_ingress-ingress_http")
+				Expect(ok).To(BeTrue(), "Ingress should be accessible.")
+				Expect(rs.Pools[0].ServicePort).To(Equal(int32(0)))
+			})
+
+			It("handles ingress ssl profiles", func() {
+				svcName := "foo"
+				var svcPort int32 = 443
+				svcKey := serviceKey{
+					Namespace:   namespace,
+					ServiceName: svcName,
+					ServicePort: svcPort,
+				}
+				sslProfileName1 := "velcro/theSslProfileName"
+				sslProfileName2 := "common/anotherSslProfileName"
+
+				spec := v1beta1.IngressSpec{
+					TLS: []v1beta1.IngressTLS{
+						{
+							SecretName: sslProfileName1,
+						},
+						{
+							SecretName: sslProfileName2,
+						},
+					},
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: svcName,
+						ServicePort: intstr.IntOrString{IntVal: svcPort},
+					},
+				}
+				fooIng := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				svcPorts := []v1.ServicePort{newServicePort("port0", svcPort)}
+				fooSvc := test.NewService(svcName, "1", namespace, v1.ServiceTypeClusterIP,
+					svcPorts)
+				emptyIps := []string{}
+				readyIps := []string{"10.2.96.0", "10.2.96.1", "10.2.96.2"}
+				endpts := test.NewEndpoints(svcName, "1", namespace, readyIps, emptyIps,
+					convertSvcPortsToEndpointPorts(svcPorts))
+
+				// Add ingress, service, and endpoints objects and make sure the
+				// ssl-profile set in the ingress object shows up in the virtual server.
+				r := mockMgr.addIngress(fooIng)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				r = mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				r = mockMgr.addEndpoints(endpts)
+				Expect(r).To(BeTrue(), "Endpoints should be processed.")
+				resources := mockMgr.resources()
+				Expect(resources.Count()).To(Equal(2))
+				Expect(resources.CountOf(svcKey)).To(Equal(2))
+				httpCfg, found := resources.Get(svcKey, formatIngressVSName(fooIng, "http"))
+				Expect(found).To(BeTrue())
+				Expect(httpCfg).ToNot(BeNil())
+
+				httpsCfg, found := resources.Get(svcKey, formatIngressVSName(fooIng, "https"))
+				Expect(found).To(BeTrue())
+				Expect(httpsCfg).ToNot(BeNil())
+				secretArray := []string{
+					formatIngressSslProfileName(sslProfileName1),
+					formatIngressSslProfileName(sslProfileName2),
+				}
+				sort.Strings(secretArray)
+				Expect(httpsCfg.Virtual.GetFrontendSslProfileNames()).To(Equal(secretArray))
+
+				// No annotations were specified to control http redirect, check that
+				// we are in the default state 2.
+				Expect(len(httpCfg.Virtual.IRules)).To(Equal(1))
+				expectedIRuleName := fmt.Sprintf("/%s/%s",
+					DEFAULT_PARTITION, httpRedirectIRuleName)
+				Expect(httpCfg.Virtual.IRules[0]).To(Equal(expectedIRuleName))
+
+				// Set the annotations the same as default and recheck
+				fooIng.ObjectMeta.Annotations[ingressSslRedirect] = "true"
+				fooIng.ObjectMeta.Annotations[ingressAllowHttp] = "false"
+				r = mockMgr.addIngress(fooIng)
+				httpCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "http"))
+				Expect(found).To(BeTrue())
+				Expect(httpCfg).ToNot(BeNil())
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				Expect(len(httpCfg.Virtual.IRules)).To(Equal(1))
+				expectedIRuleName = fmt.Sprintf("/%s/%s",
+					DEFAULT_PARTITION, httpRedirectIRuleName)
+				Expect(httpCfg.Virtual.IRules[0]).To(Equal(expectedIRuleName))
+
+				// Now test state 1.
+				fooIng.ObjectMeta.Annotations[ingressSslRedirect] = "false"
+				fooIng.ObjectMeta.Annotations[ingressAllowHttp] = "false"
+				r = mockMgr.addIngress(fooIng)
+				httpsCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "https"))
+				Expect(found).To(BeTrue())
+				Expect(httpsCfg).ToNot(BeNil())
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				Expect(resources.Count()).To(Equal(1))
+				Expect(resources.CountOf(svcKey)).To(Equal(1))
+				Expect(len(httpsCfg.Policies)).To(Equal(0))
+				Expect(httpsCfg.Virtual.GetFrontendSslProfileNames()).To(Equal(secretArray))
+
+				// Now test state 3.
+				fooIng.ObjectMeta.Annotations[ingressSslRedirect] = "false"
+				fooIng.ObjectMeta.Annotations[ingressAllowHttp] = "true"
+				r = mockMgr.addIngress(fooIng)
+				httpCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "http"))
+				Expect(found).To(BeTrue())
+				Expect(httpCfg).ToNot(BeNil())
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				Expect(len(httpCfg.Policies)).To(Equal(0))
+
+				// Clear out TLS in the ingress, but use default http redirect settings.
+				fooIng.Spec.TLS = nil
+				delete(fooIng.ObjectMeta.Annotations, ingressSslRedirect)
+				delete(fooIng.ObjectMeta.Annotations, ingressAllowHttp)
+				r = mockMgr.addIngress(fooIng)
+				Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+				Expect(resources.Count()).To(Equal(1))
+				Expect(resources.CountOf(svcKey)).To(Equal(1))
+				httpCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "http"))
+				Expect(found).To(BeTrue())
+				Expect(httpCfg).ToNot(BeNil())
+				Expect(len(httpCfg.Policies)).To(Equal(0))
+
+				httpsCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "https"))
+				Expect(found).To(BeFalse())
+				Expect(httpsCfg).To(BeNil())
+			})
+
+			It("creates ssl profiles from Secrets", func() {
+				// Create a secret
+				secret := &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret",
+						Namespace: namespace,
+					},
+					Data: map[string][]byte{
+						"tls.crt": []byte("testcert"),
+						"tls.key": []byte("testkey"),
+					},
+				}
+				mockMgr.addSecret(secret)
+
+				spec := v1beta1.IngressSpec{
+					TLS: []v1beta1.IngressTLS{
+						{
+							SecretName: secret.ObjectMeta.Name,
+						},
+					},
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				// Test for Ingress
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				mockMgr.addIngress(ingress)
+
+				customProfiles := mockMgr.customProfiles()
+				Expect(len(customProfiles)).To(Equal(1))
+
+				// Test for ConfigMap
+				var configmapSecret string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "foo",
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "virtualAddress": {
+					        "port": 10000
+					      },
+					      "sslProfile": {
+					        "f5ProfileName": "secret"
+					      }
+					    }
+					  }
+					}`)
+				secretCfg := test.NewConfigMap("secretCfg", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapSecret,
+				})
+				mockMgr.addConfigMap(secretCfg)
+				// Both virtual servers share the profile of the Secret
+				Expect(len(customProfiles)).To(Equal(1))
+				key := profileKey{Partition: "velcro", Name: "secret"}
+				Expect(mockMgr.appMgr.customProfiles.RefCount(key)).To(Equal(2))
+				mockMgr.deleteConfigMap(secretCfg)
+				Expect(len(customProfiles)).To(Equal(1))
+				Expect(mockMgr.appMgr.customProfiles.RefCount(key)).To(Equal(1))
+				mockMgr.deleteIngress(ingress)
+				Expect(len(customProfiles)).To(Equal(0))
+			})
+
+			It("shares the ssl profile of the default TLS Secret", func() {
+				secret := &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "wildcard",
+						Namespace: "kube-system",
+					},
+					Data: map[string][]byte{
+						"tls.crt": []byte("testcert"),
+						"tls.key": []byte("testkey"),
+					},
+				}
+				mockMgr.appMgr.defaultSslSecret = "kube-system/wildcard"
+				mockMgr.appMgr.defaultSslSecretInformer =
+					mockMgr.appMgr.newDefaultSslSecretInformer(0)
+				err := mockMgr.appMgr.defaultSslSecretInformer.GetStore().Add(secret)
+				Expect(err).To(BeNil())
+
+				var ingresses []*v1beta1.Ingress
+				for i, host := range []string{"a.example.com", "b.example.com"} {
+					spec := v1beta1.IngressSpec{
+						TLS: []v1beta1.IngressTLS{{Hosts: []string{host}}},
+						Backend: &v1beta1.IngressBackend{
+							ServiceName: "foo",
+							ServicePort: intstr.IntOrString{IntVal: 80},
+						},
+					}
+					ing := test.NewIngress(fmt.Sprintf("ingress%d", i), "1",
+						namespace, spec, map[string]string{
+							"virtual-server.f5.com/ip": fmt.Sprintf("1.2.3.%d", i),
+						})
+					mockMgr.addIngress(ing)
+					ingresses = append(ingresses, ing)
+				}
+
+				customProfiles := mockMgr.customProfiles()
+				Expect(customProfiles).To(HaveLen(1))
+				key := profileKey{Partition: "velcro",
+					Name: defaultClientSslProfileName}
+				Expect(customProfiles).To(HaveKey(key))
+				Expect(customProfiles[key].Cert).To(Equal("testcert"))
+				Expect(customProfiles[key].ServerName).To(BeEmpty())
+				Expect(mockMgr.appMgr.customProfiles.RefCount(key)).To(Equal(2))
+				svcKey := serviceKey{ServiceName: "foo", ServicePort: 80,
+					Namespace: namespace}
+				httpsCfg, found := mockMgr.resources().Get(svcKey,
+					formatIngressVSName(ingresses[0], "https"))
+				Expect(found).To(BeTrue())
+				Expect(httpsCfg.Virtual.GetFrontendSslProfileNames()).To(Equal(
+					[]string{"velcro/" + defaultClientSslProfileName}))
+
+				// A renewed certificate updates the shared profile
+				secret.Data["tls.crt"] = []byte("renewedcert")
+				mockMgr.appMgr.updateDefaultClientSslProfiles(secret)
+				Expect(customProfiles[key].Cert).To(Equal("renewedcert"))
+
+				for _, ing := range ingresses {
+					mockMgr.deleteIngress(ing)
+				}
+				Expect(customProfiles).To(BeEmpty())
+			})
+
+			It("scopes Ingress ssl profiles to TLS hosts", func() {
+				for _, name := range []string{"wildcard", "other"} {
+					secret := &v1.Secret{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      name,
+							Namespace: namespace,
+						},
+						Data: map[string][]byte{
+							"tls.crt": []byte("testcert"),
+							"tls.key": []byte("testkey"),
+						},
+					}
+					mockMgr.addSecret(secret)
+				}
+
+				spec := v1beta1.IngressSpec{
+					TLS: []v1beta1.IngressTLS{
+						{
+							Hosts:      []string{"foo.example.com", "bar.example.com"},
+							SecretName: "wildcard",
+						},
+						{
+							Hosts:      []string{"bar.example.com"},
+							SecretName: "other",
+						},
+					},
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				mockMgr.addIngress(ingress)
+
+				customProfiles := mockMgr.customProfiles()
+				Expect(len(customProfiles)).To(Equal(1),
+					"Conflicting TLS entry should be ignored.")
+				for _, prof := range customProfiles {
+					Expect(prof.Name).To(Equal("wildcard"))
+					Expect(prof.ServerName).To(Equal("*.example.com"))
+				}
+
+				Expect(tlsServerName([]string{"foo.example.com"})).To(
+					Equal("foo.example.com"))
+				Expect(tlsServerName([]string{"foo.example.com", "foo.test.com"})).To(
+					BeEmpty())
+				Expect(tlsServerName([]string{"*.example.com", "foo.example.com"})).To(
+					Equal("*.example.com"))
+				Expect(tlsServerName(nil)).To(BeEmpty())
+			})
+
+			It("configures ssl passthrough for Ingresses", func() {
+				for _, name := range []string{"foo", "bar"} {
+					mockMgr.addService(test.NewService(name, "1", namespace, "NodePort",
+						[]v1.ServicePort{{Port: 80, NodePort: 30001}}))
+				}
+				rule := func(host, svc string) v1beta1.IngressRule {
+					return v1beta1.IngressRule{
+						Host: host,
+						IngressRuleValue: v1beta1.IngressRuleValue{
+							HTTP: &v1beta1.HTTPIngressRuleValue{
+								Paths: []v1beta1.HTTPIngressPath{{
+									Path: "/",
+									Backend: v1beta1.IngressBackend{
+										ServiceName: svc,
+										ServicePort: intstr.IntOrString{IntVal: 80},
+									},
+								}},
+							},
+						},
+					}
+				}
+				spec := v1beta1.IngressSpec{
+					Rules: []v1beta1.IngressRule{
+						rule("Foo.example.com", "foo"),
+						rule("bar.example.com", "bar"),
+						rule("*.example.com", "bar"),
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+						ingressSslPassthroughAnnotation:   "true",
+					})
+				mockMgr.addIngress(ingress)
+
+				// An https virtual server is created without TLS Secrets
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "https"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.IRules).To(ContainElement(
+					"/velcro/" + sslPassthroughIRuleName))
+				Expect(rs.Virtual.GetFrontendSslProfileNames()).To(BeEmpty())
+				pools := make(map[string]string)
+				for _, pool := range rs.Pools {
+					pools[pool.ServiceName] = "/velcro/" + pool.Name
+				}
+				key := nameRef{
+					Name:      passthroughIngressHostsDgName,
+					Partition: DEFAULT_PARTITION,
+				}
+				hostDgs := mockMgr.appMgr.hostDgs
+				dg, found := hostDgs.dataGroup(key)
+				Expect(found).To(BeTrue())
+				Expect(dg.Records).To(Equal(
+					InternalDataGroupRecords{
+						{Name: "bar.example.com", Data: pools["bar"]},
+						{Name: "foo.example.com", Data: pools["foo"]},
+					}))
+				Expect(hostDgs.exists(nameRef{
+					Name:      passthroughHostsDgName,
+					Partition: DEFAULT_PARTITION,
+				})).To(BeTrue())
+				Expect(mockMgr.appMgr.irulesMap).To(HaveKey(nameRef{
+					Name:      sslPassthroughIRuleName,
+					Partition: DEFAULT_PARTITION,
+				}))
+				Expect(sslPassthroughIRule()).To(ContainSubstring(
+					passthroughIngressHostsDgName))
+
+				// Server names are removed with the annotation
+				delete(ingress.ObjectMeta.Annotations, ingressSslPassthroughAnnotation)
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				dg, _ = hostDgs.dataGroup(key)
+				Expect(dg.Records).To(BeEmpty())
+				_, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "https"))
+				Expect(ok).To(BeFalse())
+			})
+
+			It("configures a fallback pool and maintenance page", func() {
+				// The data groups are created when the controller starts
+				mockMgr.appMgr.addInternalDataGroup(
+					sorryServerPoolsDgName, DEFAULT_PARTITION)
+				mockMgr.appMgr.addInternalDataGroup(
+					sorryServerPagesDgName, DEFAULT_PARTITION)
+				mockMgr.appMgr.addInternalDataGroup(
+					sorryServerCodesDgName, DEFAULT_PARTITION)
+				mockMgr.addService(test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}}))
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				page := "<html><body>Down for maintenance</body></html>"
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+						fallbackPoolAnnotation:            "/Common/sorry",
+						maintenancePageAnnotation:         page,
+					})
+				mockMgr.addIngress(ingress)
+				vsName := formatIngressVSName(ingress, "http")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.IRules).To(ContainElement(
+					"/velcro/" + sorryServerIRuleName))
+
+				records := func(name string) InternalDataGroupRecords {
+					mw.Lock()
+					defer mw.Unlock()
+					resources := mw.Sections["resources"].(PartitionMap)
+					for _, dg := range resources[DEFAULT_PARTITION].InternalDataGroups {
+						if dg.Name == name {
+							return dg.Records
+						}
+					}
+					return nil
+				}
+				vsPath := "/velcro/" + vsName
+				Expect(records(sorryServerPoolsDgName)).To(Equal(
+					InternalDataGroupRecords{{Name: vsPath, Data: "/Common/sorry"}}))
+				Expect(records(sorryServerPagesDgName)).To(Equal(
+					InternalDataGroupRecords{{Name: vsPath, Data: page}}))
+				Expect(sorryServerIRule()).To(ContainSubstring(
+					"/velcro/" + sorryServerPoolsDgName))
+				// The page is served with a 503 by default
+				Expect(records(sorryServerCodesDgName)).To(BeEmpty())
+
+				// Invalid pool paths are ignored, the page is still served
+				ingress.ObjectMeta.Annotations[fallbackPoolAnnotation] = "sorry"
+				ingress.ObjectMeta.Annotations[maintenanceStatusAnnotation] = "200"
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				Expect(records(sorryServerPoolsDgName)).To(BeEmpty())
+				Expect(records(sorryServerPagesDgName)).To(HaveLen(1))
+				Expect(records(sorryServerCodesDgName)).To(Equal(
+					InternalDataGroupRecords{{Name: vsPath, Data: "200"}}))
+
+				// Without the annotations, the iRule is removed
+				delete(ingress.ObjectMeta.Annotations, fallbackPoolAnnotation)
+				delete(ingress.ObjectMeta.Annotations, maintenancePageAnnotation)
+				delete(ingress.ObjectMeta.Annotations, maintenanceStatusAnnotation)
+				ingress.ObjectMeta.ResourceVersion = "3"
+				mockMgr.updateIngress(ingress)
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.IRules).ToNot(ContainElement(
+					"/velcro/" + sorryServerIRuleName))
+				Expect(records(sorryServerPagesDgName)).To(BeEmpty())
+				Expect(records(sorryServerCodesDgName)).To(BeEmpty())
+				// Unused by any virtual server, the data groups of the iRule
+				// are not written
+				mw.Lock()
+				resources := mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				if cfg, ok := resources[DEFAULT_PARTITION]; ok {
+					for _, dg := range cfg.InternalDataGroups {
+						Expect(dg.Name).ToNot(HavePrefix("sorry_server_"))
+					}
+				}
+			})
+
+			It("tunes health monitors for the circuit breaker", func() {
+				mockMgr.addService(test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}}))
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+						ingHealthMonitorAnnotation: `[{"path": "*/", ` +
+							`"send": "GET / HTTP/1.0\r\n\r\n", ` +
+							`"interval": 5, "timeout": 16}]`,
+						circuitBreakerAnnotation: `{"failures": 3, "window": 10}`,
+					})
+				mockMgr.addIngress(ingress)
+				vsName := formatIngressVSName(ingress, "http")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Monitors).To(HaveLen(1))
+				Expect(rs.Monitors[0].Interval).To(Equal(4))
+				Expect(rs.Monitors[0].Timeout).To(Equal(13))
+
+				// Invalid values leave the monitors as annotated
+				ingress.ObjectMeta.Annotations[circuitBreakerAnnotation] =
+					`{"failures": 3, "window": 2}`
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Monitors[0].Interval).To(Equal(5))
+				Expect(rs.Monitors[0].Timeout).To(Equal(16))
+			})
+
+			It("redirects alternate hosts to their canonical host", func() {
+				mockMgr.appMgr.addInternalDataGroup(
+					hostRedirectsDgName, DEFAULT_PARTITION)
+				mockMgr.addService(test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}}))
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+						hostRedirectsAnnotation: `{"www.Foo.com": "foo.com", ` +
+							`"foo.net": "foo.com"}`,
+						hostRedirectCodeAnnotation: "308",
+					})
+				mockMgr.addIngress(ingress)
+				vsName := formatIngressVSName(ingress, "http")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.IRules).To(ContainElement(
+					"/velcro/" + hostRedirectIRuleName))
+
+				records := func() InternalDataGroupRecords {
+					mw.Lock()
+					defer mw.Unlock()
+					resources := mw.Sections["resources"].(PartitionMap)
+					for _, dg := range resources[DEFAULT_PARTITION].InternalDataGroups {
+						if dg.Name == hostRedirectsDgName {
+							return dg.Records
+						}
+					}
+					return nil
+				}
+				vsPath := "/velcro/" + vsName
+				Expect(records()).To(Equal(InternalDataGroupRecords{
+					{Name: vsPath + "/foo.net", Data: "308 foo.com"},
+					{Name: vsPath + "/www.foo.com", Data: "308 foo.com"},
+				}))
+				Expect(hostRedirectIRule()).To(ContainSubstring(
+					"/velcro/" + hostRedirectsDgName))
+
+				// Invalid codes fall back to a permanent redirect
+				ingress.ObjectMeta.Annotations[hostRedirectCodeAnnotation] = "200"
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				Expect(records()).To(ContainElement(InternalDataGroupRecord{
+					Name: vsPath + "/foo.net", Data: "301 foo.com"}))
+
+				// Invalid redirects are ignored as a whole
+				ingress.ObjectMeta.Annotations[hostRedirectsAnnotation] =
+					`{"foo.com": "foo.com"}`
+				ingress.ObjectMeta.ResourceVersion = "3"
+				mockMgr.updateIngress(ingress)
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.IRules).ToNot(ContainElement(
+					"/velcro/" + hostRedirectIRuleName))
+				Expect(records()).To(BeEmpty())
+			})
+
+			It("persists sessions with the universal persistence iRule", func() {
+				mockMgr.appMgr.addInternalDataGroup(
+					universalPersistenceDgName, DEFAULT_PARTITION)
+				mockMgr.addService(test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}}))
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":            "1.2.3.4",
+						"virtual-server.f5.com/partition":     "velcro",
+						universalPersistenceAnnotation:        "cookie:JSESSIONID",
+						universalPersistenceTimeoutAnnotation: "600",
+					})
+				mockMgr.addIngress(ingress)
+				vsName := formatIngressVSName(ingress, "http")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.IRules).To(ContainElement(
+					"/velcro/" + universalPersistenceIRuleName))
+				Expect(rs.Virtual.Persist).ToNot(BeNil())
+				Expect(*rs.Virtual.Persist).To(Equal(universalPersistenceProfile))
+
+				records := func() InternalDataGroupRecords {
+					mw.Lock()
+					defer mw.Unlock()
+					resources := mw.Sections["resources"].(PartitionMap)
+					for _, dg := range resources[DEFAULT_PARTITION].InternalDataGroups {
+						if dg.Name == universalPersistenceDgName {
+							return dg.Records
+						}
+					}
+					return nil
+				}
+				vsPath := "/velcro/" + vsName
+				Expect(records()).To(Equal(InternalDataGroupRecords{
+					{Name: vsPath, Data: "cookie JSESSIONID 600"},
+				}))
+				Expect(universalPersistenceIRule()).To(ContainSubstring(
+					"/velcro/" + universalPersistenceDgName))
+
+				// Invalid timeouts fall back to the default
+				ingress.ObjectMeta.Annotations[universalPersistenceAnnotation] =
+					"header:X-Session-Id"
+				ingress.ObjectMeta.Annotations[universalPersistenceTimeoutAnnotation] =
+					"0"
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				Expect(records()).To(Equal(InternalDataGroupRecords{
+					{Name: vsPath, Data: "header X-Session-Id 1800"},
+				}))
+
+				// none removes the persistence
+				ingress.ObjectMeta.Annotations[universalPersistenceAnnotation] =
+					"none"
+				ingress.ObjectMeta.ResourceVersion = "3"
+				mockMgr.updateIngress(ingress)
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.IRules).ToNot(ContainElement(
+					"/velcro/" + universalPersistenceIRuleName))
+				Expect(rs.Virtual.Persist).ToNot(BeNil())
+				Expect(*rs.Virtual.Persist).To(BeEmpty())
+				Expect(records()).To(BeEmpty())
+
+				_, _, err := parseUniversalPersistence("query:sid")
+				Expect(err).ToNot(BeNil())
+				_, _, err = parseUniversalPersistence("cookie:")
+				Expect(err).ToNot(BeNil())
+			})
+
+			It("references services in other allowed namespaces", func() {
+				mockMgr.appMgr.crossNsRefs = crossNamespaceRefs{
+					namespace: {"team-a"}}
+				err := mockMgr.startNonLabelMode([]string{"team-a"})
+				Expect(err).To(BeNil())
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+						serviceNamespacesAnnotation:       `{"foo": "team-a"}`,
+					})
+				mockMgr.addIngress(ingress)
+				vsName := formatIngressVSName(ingress, "http")
+
+				// The sync of the service's namespace finds the Ingress
+				mockMgr.addService(test.NewService("foo", "1", "team-a",
+					"NodePort", []v1.ServicePort{{Port: 80, NodePort: 30001}}))
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, "team-a"}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools[0].ServiceNamespace).To(Equal("team-a"))
+				Expect(rs.MetaData.Active).To(BeTrue())
+				_, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeFalse())
+
+				// Namespaces not allowed fall back to that of the Ingress
+				ingress.ObjectMeta.Annotations[serviceNamespacesAnnotation] =
+					`{"foo": "team-b"}`
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, vsName)
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools[0].ServiceNamespace).To(Equal(namespace))
+			})
+
+			It("traces keys until their changes are written", func() {
+				traces := newSyncTraces(tracing.NewTracer(tracing.Config{}))
+				queue := newTracedQueue(workqueue.NewRateLimitingQueue(
+					workqueue.DefaultControllerRateLimiter()), traces)
+				defer queue.ShutDown()
+				key := serviceQueueKey{Namespace: namespace, ServiceName: "foo"}
+				other := serviceQueueKey{Namespace: namespace, ServiceName: "bar"}
+
+				queue.Add(key)
+				queue.Add(other)
+				Expect(traces.keys).To(HaveLen(2))
+				root := traces.keys[key].root
+				queued := traces.keys[key].queued
+				Expect(queued).ToNot(BeNil())
+				queue.Add(key)
+				Expect(traces.keys[key].queued).To(BeIdenticalTo(queued))
+
+				// A sync without changes ends the trace
+				traces.started(other)
+				traces.syncStats(other, vsSyncStats{vsFound: 1})
+				traces.synced(other, nil)
+				Expect(traces.keys).ToNot(HaveKey(other))
+
+				// A failed sync keeps the trace for the retry
+				traces.started(key)
+				Expect(traces.keys[key].queued).To(BeNil())
+				traces.synced(key, fmt.Errorf("failed"))
+				Expect(traces.keys).To(HaveKey(key))
+				queue.AddRateLimited(key)
+				traces.started(key)
+				traces.syncStats(key, vsSyncStats{vsFound: 1, vsUpdated: 1})
+				traces.synced(key, nil)
+				Expect(traces.keys[key].root).To(BeIdenticalTo(root))
+
+				// The write of the changes ends the trace
+				traces.written(time.Now(), nil)
+				Expect(traces.keys).To(BeEmpty())
+
+				// Changes written during the sync end the trace with it
+				queue.Add(key)
+				traces.started(key)
+				traces.syncStats(key, vsSyncStats{vsDeleted: 1})
+				traces.written(time.Now(), nil)
+				Expect(traces.keys).To(HaveKey(key))
+				traces.synced(key, nil)
+				Expect(traces.keys).To(BeEmpty())
+
+				// Disabled tracing does nothing
+				var disabled *syncTraces
+				disabled.enqueued(key)
+				disabled.started(key)
+				disabled.synced(key, nil)
+				disabled.written(time.Now(), nil)
+			})
+
+			It("skips informer updates of unchanged resources", func() {
+				var enqueued []interface{}
+				update := skipResync(func(obj interface{}) {
+					enqueued = append(enqueued, obj)
+				})
+				svc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				update(svc, svc)
+				Expect(enqueued).To(BeEmpty())
+
+				svc2 := test.NewService("foo", "2", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30002}})
+				update(svc, svc2)
+				Expect(enqueued).To(Equal([]interface{}{svc2}))
+
+				// Routes and objects without a resourceVersion
+				spec := routeapi.RouteSpec{
+					To: routeapi.RouteTargetReference{Kind: "Service", Name: "foo"},
+				}
+				route := test.NewRoute("route", "1", namespace, spec)
+				Expect(resourceChanged(route, route)).To(BeFalse())
+				route2 := test.NewRoute("route", "2", namespace, spec)
+				Expect(resourceChanged(route, route2)).To(BeTrue())
+				cm := test.NewConfigMap("cm", "", namespace, nil)
+				Expect(resourceChanged(cm, cm)).To(BeTrue())
+			})
+
+			It("defers config writes during a change freeze", func() {
+				recorder := mockMgr.appMgr.eventRecorder.(*record.FakeRecorder)
+				handler := mockMgr.appMgr.FreezeHandler()
+				request := func(method string) freezeStatus {
+					w := httptest.NewRecorder()
+					handler.ServeHTTP(w, httptest.NewRequest(method, "/freeze", nil))
+					Expect(w.Code).To(Equal(http.StatusOK))
+					var status freezeStatus
+					Expect(json.Unmarshal(w.Body.Bytes(), &status)).To(BeNil())
+					return status
+				}
+				status := request("PUT")
+				Expect(status.Frozen).To(BeTrue())
+				Expect(status.Since).ToNot(BeNil())
+
+				mockMgr.addService(test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}}))
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo})
+				Expect(mockMgr.addConfigMap(cfgFoo)).To(BeTrue())
+				// The desired state is tracked, but not written
+				Expect(mockMgr.resources().Count()).To(Equal(1))
+				mw.Lock()
+				Expect(mw.Sections).ToNot(HaveKey("resources"))
+				mw.Unlock()
+				Expect(recorder.Events).To(Receive(ContainSubstring("ChangeDeferred")))
+				Expect(request("GET").DeferredServices).To(Equal(
+					[]string{namespace + "/foo"}))
+
+				// One Event per service and freeze
+				cfgFoo.ObjectMeta.ResourceVersion = "2"
+				cfgFoo.ObjectMeta.Annotations = map[string]string{
+					poolServiceDownAnnotation: "reset"}
+				mockMgr.updateConfigMap(cfgFoo)
+				Expect(recorder.Events).ToNot(Receive())
+
+				status = request("DELETE")
+				Expect(status.Frozen).To(BeFalse())
+				Expect(status.DeferredServices).To(BeEmpty())
+				Expect(recorder.Events).To(Receive(
+					ContainSubstring("DeferredChangeApplied")))
+				mw.Lock()
+				Expect(mw.Sections).To(HaveKey("resources"))
+				resources := mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				Expect(resources["velcro"].Pools).To(HaveLen(1))
+				Expect(resources["velcro"].Pools[0].ServiceDownAction).To(Equal("reset"))
+
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, httptest.NewRequest("PATCH", "/freeze", nil))
+				Expect(w.Code).To(Equal(http.StatusMethodNotAllowed))
+			})
+
+			It("finds endpoints of services with named target ports", func() {
+				mockMgr.appMgr.isNodePort = false
+				ips := []string{"10.2.96.1", "10.2.96.2"}
+				members := func(port int32) []Member {
+					var m []Member
+					for _, ip := range ips {
+						m = append(m, Member{
+							Address: ip, Port: port, Session: "user-enabled"})
+					}
+					return m
+				}
+
+				// Endpoints named after the target port rather than the
+				// service port, as for hand-maintained Endpoints
+				foo := test.NewService("foo", "1", namespace, v1.ServiceTypeClusterIP,
+					[]v1.ServicePort{{
+						Name:       "web",
+						Port:       80,
+						TargetPort: intstr.FromString("http"),
+					}})
+				mockMgr.addService(foo)
+				mockMgr.addEndpoints(test.NewEndpoints("foo", "1", namespace, ips,
+					nil, []v1.EndpointPort{
+						{Name: "metrics", Port: 9090},
+						{Name: "http", Port: 8080},
+					}))
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				mockMgr.addIngress(ingress)
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools[0].Members).To(Equal(members(8080)))
+
+				eps := test.NewEndpoints("foo", "1", namespace, ips, nil,
+					[]v1.EndpointPort{{Name: "other", Port: 8443}})
+				// Numeric target port
+				Expect(getEndpointsForService(v1.ServicePort{
+					Name:       "web",
+					Port:       443,
+					TargetPort: intstr.FromInt(8443),
+				}, eps)).To(Equal(members(8443)))
+				// Target port defaults to the service port
+				Expect(getEndpointsForService(v1.ServicePort{
+					Name: "web",
+					Port: 8443,
+				}, eps)).To(Equal(members(8443)))
+				// Only port of an unnamed service port
+				Expect(getEndpointsForService(v1.ServicePort{
+					Port:       443,
+					TargetPort: intstr.FromInt(9443),
+				}, eps)).To(Equal(members(8443)))
+				// No match
+				Expect(getEndpointsForService(v1.ServicePort{
+					Name:       "web",
+					Port:       443,
+					TargetPort: intstr.FromInt(9443),
+				}, eps)).To(BeEmpty())
+			})
+
+			It("uses service addresses as virtual addresses", func() {
+				mockMgr.appMgr.serviceAddress = true
+				foo := test.NewService("foo", "1", namespace, "LoadBalancer",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				foo.Spec.ExternalIPs = []string{"not-an-ip", "10.2.2.2"}
+				foo.Status.LoadBalancer.Ingress = []v1.LoadBalancerIngress{
+					{IP: "10.1.1.1"}}
+				mockMgr.addService(foo)
+
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data": strings.Replace(configmapFoo,
+						`"bindAddr": "10.128.10.240",`, "", 1)})
+				mockMgr.addConfigMap(cfgFoo)
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("10.2.2.2"))
+
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				mockMgr.addIngress(ingress)
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("10.2.2.2"))
+
+				// A given address takes precedence
+				ingress.ObjectMeta.Annotations["virtual-server.f5.com/ip"] = "1.2.3.4"
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualAddress.BindAddr).To(Equal("1.2.3.4"))
+
+				// Precedence of the service addresses
+				foo.Spec.LoadBalancerIP = "10.3.3.3"
+				Expect(serviceAddress(foo)).To(Equal("10.3.3.3"))
+				foo.Spec.LoadBalancerIP = ""
+				foo.Spec.ExternalIPs = nil
+				Expect(serviceAddress(foo)).To(Equal("10.1.1.1"))
+				foo.Status.LoadBalancer.Ingress = nil
+				Expect(serviceAddress(foo)).To(BeEmpty())
+			})
+
+			It("publishes the host names of active virtual servers", func() {
+				publisher := &fakeDNSPublisher{}
+				mockMgr.appMgr.dnsPublisher = publisher
+				mockMgr.processNodeUpdate([]v1.Node{
+					*test.NewNode("node0", "0", false, []v1.NodeAddress{
+						{Type: "ExternalIP", Address: "127.0.0.0"}}),
+				}, nil)
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				mockMgr.addService(foo)
+
+				spec := v1beta1.IngressSpec{
+					Rules: []v1beta1.IngressRule{
+						{Host: "Host1.example.com",
+							IngressRuleValue: v1beta1.IngressRuleValue{
+								HTTP: &v1beta1.HTTPIngressRuleValue{
+									Paths: []v1beta1.HTTPIngressPath{
+										{Path: "/foo",
+											Backend: v1beta1.IngressBackend{
+												ServiceName: "foo",
+												ServicePort: intstr.IntOrString{IntVal: 80},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				Expect(mockMgr.addIngress(ingress)).To(BeTrue())
+				Expect(publisher.last()).To(Equal(
+					map[string]string{"Host1.example.com": "1.2.3.4"}))
+
+				// Without members the names are withdrawn
+				records := make(map[string]string)
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "http"))
+				Expect(ok).To(BeTrue())
+				rs.Pools[0].Members = nil
+				addDNSRecords(records, rs)
+				Expect(records).To(BeEmpty())
+
+				mockMgr.deleteService(foo)
+				Expect(publisher.last()).To(BeEmpty())
+			})
+
+			It("derives health monitors from readiness probes", func() {
+				// Pods are only watched by the informers of the feature
+				mockMgr.appMgr.probeMonitors = true
+				Expect(mockMgr.appMgr.removeNamespace(namespace)).To(BeNil())
+				Expect(mockMgr.startNonLabelMode([]string{namespace})).To(BeNil())
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{
+						Port:       80,
+						NodePort:   30001,
+						TargetPort: intstr.FromString("http"),
+					}})
+				foo.Spec.Selector = map[string]string{"app": "foo"}
+				mockMgr.addService(foo)
+				pod := &v1.Pod{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo-1",
+						Namespace: namespace,
+						Labels:    map[string]string{"app": "foo"},
+					},
+					Spec: v1.PodSpec{
+						Containers: []v1.Container{{
+							Name: "foo",
+							Ports: []v1.ContainerPort{
+								{Name: "http", ContainerPort: 8080},
+							},
+							ReadinessProbe: &v1.Probe{
+								Handler: v1.Handler{
+									HTTPGet: &v1.HTTPGetAction{
+										Path: "/healthz",
+										Port: intstr.FromInt(8080),
+										HTTPHeaders: []v1.HTTPHeader{
+											{Name: "Host", Value: "foo.example.com"},
+											{Name: "X-Probe", Value: "bigip"},
+										},
+									},
+								},
+								PeriodSeconds: 5,
+							},
+						}},
+					},
+				}
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				Expect(appInf.podInformer).ToNot(BeNil())
+				appInf.podInformer.GetStore().Add(pod)
+
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				mockMgr.addIngress(ingress)
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Monitors).To(Equal(Monitors{{
+					Name:      rs.Pools[0].Name + "_0_http",
+					Partition: "velcro",
+					Protocol:  "http",
+					Interval:  5,
+					Timeout:   16,
+					Send: `GET /healthz HTTP/1.1\r\nHost: foo.example.com\r\n` +
+						`X-Probe: bigip\r\nConnection: Close\r\n\r\n`,
+				}}))
+				Expect(rs.Pools[0].MonitorNames).To(Equal(
+					[]string{"/velcro/" + rs.Pools[0].Name + "_0_http"}))
+
+				// Probes on other ports can not be used
+				pod.Spec.Containers[0].ReadinessProbe.Handler = v1.Handler{
+					TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(9090)},
+				}
+				_, ok = probeToMonitor(rs.Pools[0], pod.Spec.Containers[0], 8080)
+				Expect(ok).To(BeFalse())
+				pod.Spec.Containers[0].ReadinessProbe.Handler.TCPSocket.Port =
+					intstr.FromString("http")
+				mon, ok := probeToMonitor(rs.Pools[0], pod.Spec.Containers[0], 8080)
+				Expect(ok).To(BeTrue())
+				Expect(mon.Protocol).To(Equal("tcp"))
+				Expect(mon.Send).To(BeEmpty())
+
+				// Configured monitors take precedence
+				ingress.ObjectMeta.Annotations[ingHealthMonitorAnnotation] =
+					`[{"path": "*/", "send": "GET /", "interval": 30, "timeout": 91}]`
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "http"))
+				Expect(ok).To(BeTrue())
+				Expect(len(rs.Monitors)).To(Equal(1))
+				Expect(rs.Monitors[0].Interval).To(Equal(30))
+			})
+
+			It("waits for cert-manager to issue Ingress certificates", func() {
+				spec := v1beta1.IngressSpec{
+					TLS: []v1beta1.IngressTLS{
+						{
+							Hosts:      []string{"foo.example.com"},
+							SecretName: "foo-tls",
+						},
+					},
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+						certManagerIssuerAnnotation:       "letsencrypt",
+					})
+				Expect(isCertManagerIngress(ingress)).To(BeTrue())
+				mockMgr.appMgr.certManagerTimeout = time.Minute
+				mockMgr.addIngress(ingress)
+
+				// Missing Secret is not treated as a BIG-IP profile
+				Expect(len(mockMgr.customProfiles())).To(Equal(0))
+				httpsCfg, found := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatIngressVSName(ingress, "https"))
+				Expect(found).To(BeTrue())
+				Expect(httpsCfg.Virtual.GetFrontendSslProfileNames()).To(BeEmpty())
+				key := namespace + "/foo-tls"
+				Expect(mockMgr.appMgr.certWaits).To(HaveKey(key))
+
+				// Event once the timeout has passed
+				recorder := mockMgr.appMgr.eventRecorder.(*record.FakeRecorder)
+				mockMgr.processStatusUpdates()
+				Expect(recorder.Events).To(BeEmpty())
+				mockMgr.appMgr.certWaits[key].since = time.Now().Add(-2 * time.Minute)
+				ingress.ObjectMeta.ResourceVersion = "2"
+				mockMgr.updateIngress(ingress)
+				mockMgr.processStatusUpdates()
+				Expect(recorder.Events).To(Receive(ContainSubstring(
+					"CertificateNotIssued")))
+				ingress.ObjectMeta.ResourceVersion = "3"
+				mockMgr.updateIngress(ingress)
+				mockMgr.processStatusUpdates()
+				Expect(recorder.Events).ToNot(Receive(ContainSubstring(
+					"CertificateNotIssued")), "Event should only be recorded once.")
+
+				// Secret is used once issued
+				secret := &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "foo-tls",
+						Namespace: namespace,
+					},
+					Data: map[string][]byte{
+						"tls.crt": []byte("testcert"),
+						"tls.key": []byte("testkey"),
+					},
+				}
+				mockMgr.addSecret(secret)
+				// The event of the Secret syncs the Ingress
+				queue := mockMgr.appMgr.vsQueue
+				mockMgr.appMgr.enqueueSecret(secret)
+				Expect(queue.Len()).To(Equal(1))
+				ingress.ObjectMeta.ResourceVersion = "4"
+				mockMgr.updateIngress(ingress)
+				Expect(len(mockMgr.customProfiles())).To(Equal(1))
+				Expect(mockMgr.appMgr.certWaits).To(BeEmpty())
+
+				// Deleting the Ingresses waiting for a Secret stops the wait
+				mockMgr.deleteSecret(secret)
+				ingress.ObjectMeta.ResourceVersion = "5"
+				mockMgr.updateIngress(ingress)
+				Expect(mockMgr.appMgr.certWaits).To(HaveKey(key))
+				ingress2 := test.NewIngress("ingress2", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.5",
+						"virtual-server.f5.com/partition": "velcro",
+						certManagerIssuerAnnotation:       "letsencrypt",
+					})
+				mockMgr.addIngress(ingress2)
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				appInf.ingInformer.GetStore().Delete(ingress)
+				mockMgr.appMgr.handleIngressDelete(ingress)
+				Expect(mockMgr.appMgr.certWaits).To(HaveKey(key))
+				appInf.ingInformer.GetStore().Delete(ingress2)
+				mockMgr.appMgr.handleIngressDelete(ingress2)
+				Expect(mockMgr.appMgr.certWaits).To(BeEmpty())
+
+				delete(ingress.ObjectMeta.Annotations, certManagerIssuerAnnotation)
+				Expect(isCertManagerIngress(ingress)).To(BeFalse())
+				ingress.ObjectMeta.Annotations[tlsAcmeAnnotation] = "true"
+				Expect(isCertManagerIngress(ingress)).To(BeTrue())
+			})
+
+			It("records Events and Ingress status outside of the sync", func() {
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+					})
+				ingClient := mockMgr.appMgr.kubeClient.Extensions().Ingresses(namespace)
+				_, err := ingClient.Create(ingress)
+				Expect(err).To(BeNil())
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				mockMgr.addService(fooSvc)
+				mockMgr.addIngress(ingress)
+				Expect(mockMgr.resources().Count()).To(Equal(1))
+
+				// Nothing is sent until the status worker runs
+				recorder := mockMgr.appMgr.eventRecorder.(*record.FakeRecorder)
+				Expect(recorder.Events).To(BeEmpty())
+				Expect(mockMgr.appMgr.statusQueue.Len()).To(Equal(2))
+				ing, err := ingClient.Get("ingress", metav1.GetOptions{})
+				Expect(err).To(BeNil())
+				Expect(ing.Status.LoadBalancer.Ingress).To(BeEmpty())
+
+				mockMgr.processStatusUpdates()
+				Expect(recorder.Events).To(Receive(ContainSubstring(
+					"ResourceConfigured")))
+				ing, err = ingClient.Get("ingress", metav1.GetOptions{})
+				Expect(err).To(BeNil())
+				Expect(ing.Status.LoadBalancer.Ingress).To(Equal(
+					[]v1.LoadBalancerIngress{{IP: "1.2.3.4"}}))
+
+				// Failed updates are retried, then dropped
+				mockMgr.appMgr.statusQueue = workqueue.NewRateLimitingQueue(
+					workqueue.NewItemExponentialFailureRateLimiter(
+						time.Millisecond, time.Millisecond))
+				event := ingressEvent{
+					Namespace: namespace,
+					Name:      "missing",
+					Reason:    "Test",
+					Message:   "Event for a missing Ingress",
+				}
+				mockMgr.appMgr.recordIngressEvent(nil, event.Reason, event.Message,
+					namespace+"_missing-ingress")
+				attempts := 0
+				Eventually(func() int {
+					if mockMgr.appMgr.statusQueue.Len() > 0 {
+						Expect(mockMgr.appMgr.processNextStatusUpdate()).To(BeTrue())
+						attempts++
+					}
+					return attempts
+				}).Should(Equal(maxStatusRetries))
+				Expect(mockMgr.appMgr.statusQueue.NumRequeues(event)).To(Equal(0))
+				Consistently(mockMgr.appMgr.statusQueue.Len,
+					"50ms").Should(Equal(0))
+				Expect(recorder.Events).To(BeEmpty())
+			})
+
+			It("does not write statuses it is not allowed to", func() {
+				fakeClient := mockMgr.appMgr.kubeClient.(*fake.Clientset)
+				var reviewed []string
+				fakeClient.PrependReactor("create", "selfsubjectaccessreviews",
+					func(action k8stesting.Action) (bool, runtime.Object, error) {
+						obj := action.(k8stesting.CreateAction).GetObject()
+						review := obj.(*authv1.SelfSubjectAccessReview)
+						attrs := review.Spec.ResourceAttributes
+						reviewed = append(reviewed, attrs.Namespace+"/"+
+							attrs.Resource+"/"+attrs.Subresource)
+						review.Status.Allowed = "configmaps" == attrs.Resource
+						return true, review, nil
+					})
+				mockMgr.appMgr.CheckStatusPermissions([]string{namespace})
+				Expect(reviewed).To(Equal([]string{
+					namespace + "/ingresses/status",
+					namespace + "/configmaps/",
+				}))
+				Expect(mockMgr.appMgr.ingressStatusDisabled).To(BeTrue())
+				Expect(mockMgr.appMgr.cfgMapStatusDisabled).To(BeFalse())
+
+				spec := v1beta1.IngressSpec{
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{"virtual-server.f5.com/ip": "1.2.3.4"})
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				mockMgr.addService(fooSvc)
+				mockMgr.addIngress(ingress)
+				Expect(mockMgr.resources().Count()).To(Equal(1))
+				// Only the Event is queued
+				Expect(mockMgr.appMgr.statusQueue.Len()).To(Equal(1))
+
+				// Updates disabled by flag are not checked
+				reviewed = nil
+				mockMgr.appMgr.cfgMapStatusDisabled = true
+				mockMgr.appMgr.CheckStatusPermissions(nil)
+				Expect(reviewed).To(BeEmpty())
+				cfg := test.NewConfigMap("addr", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo,
+				})
+				mockMgr.appMgr.setBindAddrAnnotation(cfg, configMapDataKey, "1.2.3.4")
+				for _, action := range fakeClient.Actions() {
+					Expect(action.GetVerb()).ToNot(Equal("patch"))
+				}
+			})
+
+			It("configures several virtual servers from one ConfigMap", func() {
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 9090, NodePort: 37001}})
+				barSvc := test.NewService("bar", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37002}})
+				mockMgr.addService(fooSvc)
+				mockMgr.addService(barSvc)
+
+				fooKey := serviceKey{"foo", 9090, namespace}
+				barKey := serviceKey{"bar", 80, namespace}
+				cfg := test.NewConfigMap("multimap", "1", namespace,
+					map[string]string{
+						"schema":   schemaUrl,
+						"data":     configmapFoo9090,
+						"data-bar": configmapBar,
+					})
+				Expect(mockMgr.addConfigMap(cfg)).To(BeTrue())
+				resources := mockMgr.resources()
+				Expect(resources.Count()).To(Equal(2))
+				_, ok := resources.Get(fooKey, "default_multimap")
+				Expect(ok).To(BeTrue())
+				rs, ok := resources.Get(barKey, "default_multimap_bar")
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualAddress.Port).To(Equal(int32(6051)))
+				Expect(bindAddrAnnotation("data-bar")).To(
+					Equal(vsBindAddrAnnotation + "-bar"))
+
+				// An invalid definition only removes its own virtual server
+				cfg = test.NewConfigMap("multimap", "2", namespace,
+					map[string]string{
+						"schema":   schemaUrl,
+						"data":     configmapFoo9090,
+						"data-bar": configmapFooInvalid,
+					})
+				Expect(mockMgr.updateConfigMap(cfg)).To(BeTrue())
 				Expect(resources.Count()).To(Equal(1))
-				Expect(resources.CountOf(svcKey)).To(Equal(1))
-				httpCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "http"))
-				Expect(found).To(BeTrue())
-				Expect(httpCfg).ToNot(BeNil())
-				Expect(len(httpCfg.Policies)).To(Equal(0))
+				_, ok = resources.Get(fooKey, "default_multimap")
+				Expect(ok).To(BeTrue())
+
+				// Removing a definition removes its virtual server
+				cfg = test.NewConfigMap("multimap", "3", namespace,
+					map[string]string{
+						"schema":   schemaUrl,
+						"data":     configmapFoo9090,
+						"data-bar": configmapBar,
+					})
+				Expect(mockMgr.updateConfigMap(cfg)).To(BeTrue())
+				Expect(resources.Count()).To(Equal(2))
+				cfg = test.NewConfigMap("multimap", "4", namespace,
+					map[string]string{
+						"schema":   schemaUrl,
+						"data-bar": configmapBar,
+					})
+				Expect(mockMgr.updateConfigMap(cfg)).To(BeTrue())
+				Expect(resources.Count()).To(Equal(1))
+				_, ok = resources.Get(barKey, "default_multimap_bar")
+				Expect(ok).To(BeTrue())
+			})
+
+			It("limits the members of pools", func() {
+				recorder := mockMgr.appMgr.eventRecorder.(*record.FakeRecorder)
+				mockMgr.appMgr.useNodeInternal = true
+				mockMgr.appMgr.poolMemberLimitMax = 2
+				nodeSet := []v1.Node{
+					*test.NewNode("node3", "1", false, []v1.NodeAddress{
+						{Type: "InternalIP", Address: "127.0.0.3"}}),
+					*test.NewNode("node1", "1", false, []v1.NodeAddress{
+						{Type: "InternalIP", Address: "127.0.0.1"}}),
+					*test.NewNode("node2", "1", false, []v1.NodeAddress{
+						{Type: "InternalIP", Address: "127.0.0.2"}}),
+				}
+				mockMgr.processNodeUpdate(nodeSet, nil)
+				mockMgr.addService(test.NewService("foo", "1", namespace,
+					"NodePort", []v1.ServicePort{{Port: 80, NodePort: 30001}}))
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace,
+					map[string]string{
+						"schema": schemaUrl,
+						"data":   configmapFoo})
+				Expect(mockMgr.addConfigMap(cfgFoo)).To(BeTrue())
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools[0].Members).To(Equal([]Member{
+					{Address: "127.0.0.1", Port: 30001, Session: "user-enabled"},
+					{Address: "127.0.0.2", Port: 30001, Session: "user-enabled"},
+				}))
+				Expect(recorder.Events).To(Receive(
+					ContainSubstring("PoolMemberLimitExceeded")))
+
+				// Resources can lower the limit, not raise it
+				cfgFoo = test.NewConfigMap("foomap", "2", namespace,
+					map[string]string{
+						"schema": schemaUrl,
+						"data":   configmapFoo})
+				cfgFoo.ObjectMeta.Annotations = map[string]string{
+					poolMemberLimitAnnotation: "1"}
+				mockMgr.updateConfigMap(cfgFoo)
+				rs, _ = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
+				Expect(len(rs.Pools[0].Members)).To(Equal(1))
+				Expect(rs.Pools[0].Members[0].Address).To(Equal("127.0.0.1"))
+				cfgFoo.ObjectMeta.ResourceVersion = "3"
+				cfgFoo.ObjectMeta.Annotations[poolMemberLimitAnnotation] = "5"
+				mockMgr.updateConfigMap(cfgFoo)
+				rs, _ = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
+				Expect(len(rs.Pools[0].Members)).To(Equal(2))
+
+				// No limit
+				mockMgr.appMgr.poolMemberLimitMax = 0
+				cfgFoo.ObjectMeta.ResourceVersion = "4"
+				delete(cfgFoo.ObjectMeta.Annotations, poolMemberLimitAnnotation)
+				mockMgr.updateConfigMap(cfgFoo)
+				rs, _ = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfgFoo))
+				Expect(len(rs.Pools[0].Members)).To(Equal(3))
+			})
+
+			It("sets ssl session options from annotations", func() {
+				secret := &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "secret",
+						Namespace: namespace,
+					},
+					Data: map[string][]byte{
+						"tls.crt": []byte("testcert"),
+						"tls.key": []byte("testkey"),
+					},
+				}
+				mockMgr.addSecret(secret)
+
+				spec := v1beta1.IngressSpec{
+					TLS: []v1beta1.IngressTLS{
+						{
+							SecretName: secret.ObjectMeta.Name,
+						},
+					},
+					Backend: &v1beta1.IngressBackend{
+						ServiceName: "foo",
+						ServicePort: intstr.IntOrString{IntVal: 80},
+					},
+				}
+				ingress := test.NewIngress("ingress", "1", namespace, spec,
+					map[string]string{
+						"virtual-server.f5.com/ip":        "1.2.3.4",
+						"virtual-server.f5.com/partition": "velcro",
+						sslSessionTicketAnnotation:        "false",
+						sslCacheSizeAnnotation:            "0",
+					})
+				mockMgr.addIngress(ingress)
+
+				customProfiles := mockMgr.customProfiles()
+				Expect(len(customProfiles)).To(Equal(1))
+				for _, prof := range customProfiles {
+					Expect(prof.SessionTicket).To(Equal("disabled"))
+					Expect(prof.CacheSize).ToNot(BeNil())
+					Expect(*prof.CacheSize).To(Equal(0))
+				}
+
+				// Invalid values leave the BIG-IP defaults in place
+				cp := CustomProfile{}
+				setSslSessionOptions(&cp, map[string]string{
+					sslSessionTicketAnnotation: "maybe",
+					sslCacheSizeAnnotation:     "-1",
+				}, "test")
+				Expect(cp.SessionTicket).To(BeEmpty())
+				Expect(cp.CacheSize).To(BeNil())
+				setSslSessionOptions(&cp, map[string]string{
+					sslSessionTicketAnnotation: "true",
+				}, "test")
+				Expect(cp.SessionTicket).To(Equal("enabled"))
+			})
+
+			It("configures server ssl profiles for ConfigMaps", func() {
+				secret := &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "backend-ca",
+						Namespace: namespace,
+					},
+					Data: map[string][]byte{
+						"ca.crt": []byte("testcacert"),
+					},
+				}
+				mockMgr.addSecret(secret)
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				r := mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+
+				var configmapCA string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "foo",
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.240",
+					        "port": 443
+					      },
+					      "serverSslProfile": {
+					        "caSecret": "backend-ca"
+					      }
+					    }
+					  }
+					}`)
+				caCfg := test.NewConfigMap("caCfg", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapCA,
+				})
+				r = mockMgr.addConfigMap(caCfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				customProfiles := mockMgr.customProfiles()
+				Expect(len(customProfiles)).To(Equal(1))
+				for _, prof := range customProfiles {
+					Expect(prof.Context).To(Equal(customProfileServer))
+					Expect(prof.Cert).To(Equal("testcacert"))
+				}
+				resources := mockMgr.resources()
+				rs, ok := resources.Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(caCfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.GetProfileCountByContext(customProfileServer)).To(Equal(1))
+
+				// An existing BIG-IP profile is referenced without a custom profile
+				var configmapProfile string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "foo",
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.240",
+					        "port": 443
+					      },
+					      "serverSslProfile": {
+					        "f5ProfileName": "Common/serverssl"
+					      }
+					    }
+					  }
+					}`)
+				profileCfg := test.NewConfigMap("caCfg", "2", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapProfile,
+				})
+				r = mockMgr.updateConfigMap(profileCfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				Expect(len(customProfiles)).To(Equal(0))
+				rs, ok = resources.Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(profileCfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.Profiles).To(ContainElement(ProfileRef{
+					Name:      "serverssl",
+					Partition: "Common",
+					Context:   customProfileServer,
+				}))
+			})
+
+			It("attaches existing profiles from ConfigMaps", func() {
+				r := mockMgr.addService(test.NewService("foo", "1", namespace,
+					"NodePort", []v1.ServicePort{{Port: 80, NodePort: 37001}}))
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				var configmapProfiles string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "foo",
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "mode": "http",
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.240",
+					        "port": 80
+					      },
+					      "profiles": [
+					        {"name": "wan-tcp", "partition": "Common", "context": "clientside"},
+					        {"name": "http", "partition": "Common", "context": "all"},
+					        {"name": "lan-tcp", "partition": "Common", "context": "serverside"}
+					      ]
+					    }
+					  }
+					}`)
+				cfg := test.NewConfigMap("profiles", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapProfiles,
+				})
+				r = mockMgr.addConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				// The profiles keep the order they are declared in, ahead
+				// of those the controller adds
+				Expect(rs.Virtual.Profiles).To(Equal(ProfileRefs{
+					{Name: "wan-tcp", Partition: "Common",
+						Context: customProfileClient, order: 1},
+					{Name: "http", Partition: "Common",
+						Context: customProfileAll, order: 2},
+					{Name: "lan-tcp", Partition: "Common",
+						Context: customProfileServer, order: 3},
+				}))
+				rs.Virtual.AddOrUpdateProfile(ProfileRef{Name: "clientssl",
+					Partition: "Common", Context: customProfileClient})
+				Expect(rs.Virtual.Profiles[3].Name).To(Equal("clientssl"))
+				partitionCfg := &BigIPConfig{Virtuals: Virtuals{rs.Virtual}}
+				sortPartitionConfig(partitionCfg)
+				names := []string{}
+				for _, prof := range partitionCfg.Virtuals[0].Profiles {
+					names = append(names, prof.Name)
+				}
+				Expect(names).To(Equal([]string{
+					"wan-tcp", "http", "lan-tcp", "clientssl"}))
+				Expect(rs.Virtual.GetProfileCountByContext(customProfileClient)).To(Equal(2))
+				// Only the SSL profiles count for ssl passthrough
+				Expect(rs.Virtual.GetSslProfileCountByContext(customProfileClient)).To(Equal(1))
+				Expect(rs.Virtual.GetSslProfileCountByContext(customProfileServer)).To(Equal(0))
+
+				// Contexts other than clientside, serverside and all are
+				// invalid, the service is synced to remove the virtual server
+				cfg = test.NewConfigMap("profiles", "2", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data": strings.Replace(configmapProfiles,
+						`"context": "all"`, `"context": "both"`, 1),
+				})
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				_, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeFalse())
+			})
+
+			It("configures performance and IP forwarding virtual servers", func() {
+				r := mockMgr.addService(test.NewService("foo", "1", namespace,
+					"NodePort", []v1.ServicePort{{Port: 80, NodePort: 37001}}))
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				var configmapL4 string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "foo",
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "mode": "tcp",
+					      "virtualType": "performance-l4",
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.240",
+					        "port": 80
+					      }
+					    }
+					  }
+					}`)
+				cfg := test.NewConfigMap("fastl4", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapL4,
+				})
+				r = mockMgr.addConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualType).To(Equal(virtualTypePerformanceL4))
+
+				// The FastL4 profile replaces the TCP profile
+				resources := PartitionMap{
+					"velcro": &BigIPConfig{Virtuals: Virtuals{rs.Virtual}},
+				}
+				var wg sync.WaitGroup
+				wg.Add(1)
+				reformatVirtuals(resources, "velcro", &wg)
+				virtual := resources["velcro"].Virtuals[0]
+				Expect(virtual.IpProtocol).To(Equal("tcp"))
+				Expect(virtual.Profiles).To(Equal(ProfileRefs{
+					{Name: "fastL4", Partition: "Common", Context: customProfileAll},
+				}))
+				Expect(virtual.IpForward).To(BeFalse())
+				Expect(virtual.PoolName).ToNot(BeEmpty())
+				Expect(virtual.VirtualType).To(BeEmpty())
+
+				// IP forwarding virtual servers have no pool
+				cfg = test.NewConfigMap("fastl4", "2", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data": strings.Replace(configmapL4,
+						`"performance-l4"`, `"ip-forwarding"`, 1),
+				})
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				resources["velcro"].Virtuals = Virtuals{rs.Virtual}
+				wg.Add(1)
+				reformatVirtuals(resources, "velcro", &wg)
+				virtual = resources["velcro"].Virtuals[0]
+				Expect(virtual.IpForward).To(BeTrue())
+				Expect(virtual.PoolName).To(BeEmpty())
+
+				// Features of full proxies are invalid
+				cfg = test.NewConfigMap("fastl4", "3", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data": strings.Replace(configmapL4,
+						`"mode": "tcp"`, `"mode": "http"`, 1),
+				})
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeFalse(), "ConfigMap should not be processed.")
+				cfg.ObjectMeta.Annotations = map[string]string{
+					"virtual-server.f5.com/proxy-protocol": "v1",
+				}
+				cfg.Data["data"] = configmapL4
+				cfg.ObjectMeta.ResourceVersion = "4"
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeFalse(), "ConfigMap should not be processed.")
+			})
+
+			It("keeps the source port and address of the clients", func() {
+				r := mockMgr.addService(test.NewService("foo", "1", namespace,
+					"NodePort", []v1.ServicePort{{Port: 80, NodePort: 37001}}))
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				var configmapL4 string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "foo",
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "mode": "tcp",
+					      "sourcePort": "preserve-strict",
+					      "transparent": true,
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.240",
+					        "port": 80
+					      }
+					    }
+					  }
+					}`)
+				cfg := test.NewConfigMap("legacy", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapL4,
+				})
+				r = mockMgr.addConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.SourcePort).To(Equal(sourcePortPreserveStrict))
+				Expect(rs.Virtual.Transparent).To(BeTrue())
+
+				// Transparent virtual servers do not translate the address
+				resources := PartitionMap{
+					"velcro": &BigIPConfig{Virtuals: Virtuals{rs.Virtual}},
+				}
+				var wg sync.WaitGroup
+				wg.Add(1)
+				reformatVirtuals(resources, "velcro", &wg)
+				virtual := resources["velcro"].Virtuals[0]
+				Expect(virtual.SourceAddrTranslation.Type).To(Equal("none"))
+				Expect(virtual.SourcePort).To(Equal(sourcePortPreserveStrict))
+				Expect(virtual.Transparent).To(BeFalse())
+
+				// The annotations override the frontend
+				cfg.ObjectMeta.Annotations = map[string]string{
+					"virtual-server.f5.com/source-port": "change",
+					"virtual-server.f5.com/transparent": "false",
+				}
+				cfg.ObjectMeta.ResourceVersion = "2"
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.SourcePort).To(Equal(sourcePortChange))
+				Expect(rs.Virtual.Transparent).To(BeFalse())
+				resources["velcro"].Virtuals = Virtuals{rs.Virtual}
+				wg.Add(1)
+				reformatVirtuals(resources, "velcro", &wg)
+				virtual = resources["velcro"].Virtuals[0]
+				Expect(virtual.SourceAddrTranslation.Type).To(Equal("automap"))
+
+				// Invalid values are ignored
+				cfg.ObjectMeta.Annotations = map[string]string{
+					"virtual-server.f5.com/source-port": "keep",
+					"virtual-server.f5.com/transparent": "yes",
+				}
+				cfg.ObjectMeta.ResourceVersion = "3"
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok = mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.SourcePort).To(Equal(sourcePortPreserveStrict))
+				Expect(rs.Virtual.Transparent).To(BeTrue())
+			})
+
+			It("configures FQDN pools from ConfigMaps", func() {
+				var configmapFqdn string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "fqdn": {
+					        "name": "api.example.com",
+					        "interval": 300
+					      },
+					      "servicePort": 443
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "mode": "tcp",
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.240",
+					        "port": 443
+					      }
+					    }
+					  }
+					}`)
+				cfg := test.NewConfigMap("external", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFqdn,
+				})
+				r := mockMgr.addConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+
+				// Active without a service
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"", 443, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeTrue())
+				Expect(rs.Pools[0].Members).To(BeEmpty())
+				autoPopulate := true
+				Expect(rs.Pools[0].Fqdn).To(Equal(&fqdnMember{
+					Name:         "api.example.com",
+					AutoPopulate: &autoPopulate,
+					Interval:     300,
+					Port:         443,
+				}))
 
-				httpsCfg, found = resources.Get(svcKey, formatIngressVSName(fooIng, "https"))
-				Expect(found).To(BeFalse())
-				Expect(httpsCfg).To(BeNil())
+				// The node monitor is not attached to FQDN pools
+				resources := PartitionMap{
+					"velcro": &BigIPConfig{Pools: Pools{rs.Pools[0]}},
+				}
+				addNodeMonitor(resources, NodeMonitorConfig{Interval: 5,
+					Timeout: 16}, nil)
+				Expect(resources["velcro"].Pools[0].MonitorNames).To(BeEmpty())
+
+				// iApps cannot use FQDN backends
+				var configmapIAppFqdn string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "fqdn": {"name": "api.example.com"},
+					      "servicePort": 443
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "iapp": "/Common/f5.http",
+					      "iappPoolMemberTable": {
+					        "name": "pool__members",
+					        "columns": [
+					          {"name": "IPAddress", "kind": "IPAddress"},
+					          {"name": "Port", "kind": "Port"}
+					        ]
+					      },
+					      "iappOptions": {"description": "iApp"},
+					      "iappVariables": {"pool__addr": "127.0.0.1"}
+					    }
+					  }
+					}`)
+				cfg = test.NewConfigMap("external", "2", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapIAppFqdn,
+				})
+				_, err := parseConfigMap(cfg)
+				Expect(err).To(MatchError(ContainSubstring("fqdn")))
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeFalse(), "ConfigMap should not be processed.")
 			})
 
-			It("creates ssl profiles from Secrets", func() {
-				// Create a secret
-				secret := &v1.Secret{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      "secret",
-						Namespace: namespace,
-					},
-					Data: map[string][]byte{
-						"tls.crt": []byte("testcert"),
-						"tls.key": []byte("testkey"),
-					},
+			It("configures static pool members from ConfigMaps", func() {
+				mockMgr.appMgr.useNodeInternal = true
+				nodeSet := []v1.Node{
+					*test.NewNode("node0", "0", false, []v1.NodeAddress{
+						{Type: "InternalIP", Address: "127.0.0.0"}}),
 				}
-				_, err := mockMgr.appMgr.kubeClient.Core().Secrets(namespace).Create(secret)
-				Expect(err).To(BeNil())
+				mockMgr.processNodeUpdate(nodeSet, nil)
 
-				spec := v1beta1.IngressSpec{
-					TLS: []v1beta1.IngressTLS{
-						{
-							SecretName: secret.ObjectMeta.Name,
-						},
-					},
-					Backend: &v1beta1.IngressBackend{
-						ServiceName: "foo",
-						ServicePort: intstr.IntOrString{IntVal: 80},
-					},
+				var configmapStatic string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "staticMembers": ["10.10.0.5:8080", "10.10.0.6",
+					        "[2001:db8::5]:8443"],
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "mode": "tcp",
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.240",
+					        "port": 80
+					      }
+					    }
+					  }
+					}`)
+				cfg := test.NewConfigMap("external", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapStatic,
+				})
+				r := mockMgr.addConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+
+				// Active without a service
+				staticMembers := []Member{
+					{Address: "10.10.0.5", Port: 8080, Session: "user-enabled"},
+					{Address: "10.10.0.6", Port: 80, Session: "user-enabled"},
+					{Address: "2001:db8::5", Port: 8443, Session: "user-enabled"},
 				}
-				// Test for Ingress
-				ingress := test.NewIngress("ingress", "1", namespace, spec,
-					map[string]string{
-						"virtual-server.f5.com/ip":        "1.2.3.4",
-						"virtual-server.f5.com/partition": "velcro",
-					})
-				mockMgr.addIngress(ingress)
+				resources := mockMgr.resources()
+				rs, ok := resources.Get(
+					serviceKey{"", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeTrue())
+				Expect(rs.Pools[0].Members).To(Equal(staticMembers))
 
-				customProfiles := mockMgr.customProfiles()
-				Expect(len(customProfiles)).To(Equal(1))
+				// Added to the members of the service
+				var configmapMixed string = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "foo",
+					      "staticMembers": ["10.10.0.5:8080"],
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "mode": "tcp",
+					      "virtualAddress": {
+					        "bindAddr": "10.128.10.241",
+					        "port": 80
+					      }
+					    }
+					  }
+					}`)
+				mixed := test.NewConfigMap("mixed", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapMixed,
+				})
+				r = mockMgr.addConfigMap(mixed)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				fooKey := serviceKey{"foo", 80, namespace}
+				rs, ok = resources.Get(fooKey, formatConfigMapVSName(mixed))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeTrue(),
+					"Static members are served without the service.")
+				Expect(rs.Pools[0].Members).To(Equal(staticMembers[:1]))
 
-				// Test for ConfigMap
-				var configmapSecret string = string(`{
+				foo := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 30001}})
+				r = mockMgr.addService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				rs, ok = resources.Get(fooKey, formatConfigMapVSName(mixed))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Pools[0].Members).To(Equal(append(
+					generateExpectedAddrs(30001, []string{"127.0.0.0"}),
+					staticMembers[0])))
+				r = mockMgr.updateService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				rs, _ = resources.Get(fooKey, formatConfigMapVSName(mixed))
+				Expect(rs.Pools[0].Members).To(HaveLen(2),
+					"Static members should not be added twice.")
+
+				// Kept when the service is deleted
+				r = mockMgr.deleteService(foo)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				rs, ok = resources.Get(fooKey, formatConfigMapVSName(mixed))
+				Expect(ok).To(BeTrue())
+				Expect(rs.MetaData.Active).To(BeTrue())
+				Expect(rs.Pools[0].Members).To(Equal(staticMembers[:1]))
+
+				// Invalid members are rejected
+				cfg = test.NewConfigMap("external", "2", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data": strings.Replace(configmapStatic, "10.10.0.6",
+						"vm.example.com:80", 1),
+				})
+				_, err := parseConfigMap(cfg)
+				Expect(err).To(MatchError(ContainSubstring("vm.example.com:80")))
+			})
+
+			It("cleans up stale status IP annotations", func() {
+				svc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				r := mockMgr.addService(svc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				var configmapAddr string = string(`{
 					"virtualServer": {
 					    "backend": {
 					      "serviceName": "foo",
@@ -2746,23 +6899,244 @@ var _ = Describe("AppManager Tests", func() {
 					    },
 					    "frontend": {
 					      "partition": "velcro",
+					      "mode": "tcp",
 					      "virtualAddress": {
-					        "port": 10000
-					      },
-					      "sslProfile": {
-					        "f5ProfileName": "secret"
+					        "bindAddr": "10.128.10.240",
+					        "port": 80
 					      }
 					    }
 					  }
 					}`)
-				secretCfg := test.NewConfigMap("secretCfg", "1", namespace, map[string]string{
+				fakeClient := mockMgr.appMgr.kubeClient.(*fake.Clientset)
+				cmClient := fakeClient.CoreV1().ConfigMaps(namespace)
+				// The fake client does not apply patches, use the annotation
+				// of the last patch of the ConfigMap if any
+				statusAddr := func(name string) string {
+					cm, err := cmClient.Get(name, metav1.GetOptions{})
+					Expect(err).To(BeNil())
+					addr := cm.ObjectMeta.Annotations[vsBindAddrAnnotation]
+					for _, action := range fakeClient.Actions() {
+						patch, ok := action.(k8stesting.PatchActionImpl)
+						if !ok || patch.GetName() != name {
+							continue
+						}
+						var patched v1.ConfigMap
+						err = json.Unmarshal(patch.GetPatch(), &patched)
+						Expect(err).To(BeNil())
+						addr = patched.ObjectMeta.Annotations[vsBindAddrAnnotation]
+					}
+					return addr
+				}
+				cfg := test.NewConfigMap("addr", "1", namespace, map[string]string{
 					"schema": schemaUrl,
-					"data":   configmapSecret,
+					"data":   configmapAddr,
 				})
-				mockMgr.addConfigMap(secretCfg)
-				Expect(len(customProfiles)).To(Equal(2))
-				mockMgr.deleteConfigMap(secretCfg)
-				Expect(len(customProfiles)).To(Equal(1))
+				_, err := cmClient.Create(cfg)
+				Expect(err).To(BeNil())
+				r = mockMgr.addConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				Expect(statusAddr("addr")).To(Equal("10.128.10.240"))
+				// The ConfigMap of the informer is left as it is
+				Expect(cfg.ObjectMeta.Annotations).To(BeEmpty())
+
+				// The annotation is removed with the virtual server
+				cfg.Data["data"] = string(`{
+					"virtualServer": {
+					    "backend": {
+					      "serviceName": "foo",
+					      "servicePort": 80
+					    },
+					    "frontend": {
+					      "partition": "velcro",
+					      "mode": "tcp"
+					    }
+					  }
+					}`)
+				cfg.ObjectMeta.ResourceVersion = "2"
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				rs, ok := mockMgr.resources().Get(
+					serviceKey{"foo", 80, namespace}, formatConfigMapVSName(cfg))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.VirtualAddress).To(BeNil())
+				_, ok = cfg.ObjectMeta.Annotations[vsBindAddrAnnotation]
+				Expect(ok).To(BeFalse())
+				Expect(statusAddr("addr")).To(BeEmpty())
+
+				// The reconcile pass fixes annotations that do not match
+				cfg.Data["data"] = configmapAddr
+				cfg.ObjectMeta.ResourceVersion = "3"
+				r = mockMgr.updateConfigMap(cfg)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				cfg.ObjectMeta.Annotations = map[string]string{
+					vsBindAddrAnnotation: "10.128.10.1"}
+				_, err = cmClient.Update(cfg)
+				Expect(err).To(BeNil())
+				mockMgr.appMgr.reconcileBindAddrAnnotations()
+				Expect(statusAddr("addr")).To(Equal("10.128.10.240"))
+
+				// ConfigMaps not synced yet keep their address
+				unsynced := test.NewConfigMap("unsynced", "1", namespace,
+					map[string]string{
+						"schema": schemaUrl,
+						"data": strings.Replace(configmapAddr,
+							`"serviceName": "foo"`, `"serviceName": "bar"`, 1),
+					})
+				unsynced.ObjectMeta.Annotations = map[string]string{
+					vsBindAddrAnnotation: "10.128.10.2"}
+				_, err = cmClient.Create(unsynced)
+				Expect(err).To(BeNil())
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				appInf.cfgMapInformer.GetStore().Add(unsynced)
+				mockMgr.appMgr.reconcileBindAddrAnnotations()
+				Expect(statusAddr("unsynced")).To(Equal("10.128.10.2"))
+
+				// Without its service, the virtual server is removed
+				r = mockMgr.deleteService(svc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				mockMgr.appMgr.reconcileBindAddrAnnotations()
+				Expect(statusAddr("addr")).To(BeEmpty())
+				Expect(statusAddr("unsynced")).To(Equal("10.128.10.2"))
+			})
+
+			It("annotates resources with the configs applied for them", func() {
+				mockMgr.appMgr.appliedConfigHash = true
+				mockMgr.appMgr.appliedConfigBody = true
+				fakeClient := mockMgr.appMgr.kubeClient.(*fake.Clientset)
+				cmClient := fakeClient.CoreV1().ConfigMaps(namespace)
+				// The fake client does not apply patches, use the last patch
+				// of the ConfigMap
+				lastPatch := func() []byte {
+					var last []byte
+					for _, action := range fakeClient.Actions() {
+						patch, ok := action.(k8stesting.PatchActionImpl)
+						if ok && patch.GetName() == "foomap" {
+							last = patch.GetPatch()
+						}
+					}
+					return last
+				}
+				cfg := test.NewConfigMap("foomap", "1", namespace, map[string]string{
+					"schema": schemaUrl,
+					"data":   configmapFoo,
+				})
+				_, err := cmClient.Create(cfg)
+				Expect(err).To(BeNil())
+				Expect(mockMgr.addConfigMap(cfg)).To(BeTrue())
+				mockMgr.processStatusUpdates()
+				Expect(lastPatch()).To(BeNil(), "Inactive configs are not applied.")
+
+				svc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				Expect(mockMgr.addService(svc)).To(BeTrue())
+				mockMgr.processStatusUpdates()
+				var patched v1.ConfigMap
+				Expect(json.Unmarshal(lastPatch(), &patched)).To(BeNil())
+				hash := patched.ObjectMeta.Annotations[appliedHashAnnotation]
+				Expect(hash).To(HaveLen(16))
+				config := patched.ObjectMeta.Annotations[appliedConfigAnnotation]
+				Expect(config).To(ContainSubstring(formatConfigMapVSName(cfg)))
+
+				// Nothing is patched while the annotations are up to date
+				cfg.ObjectMeta.Annotations = patched.ObjectMeta.Annotations
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				appInf.cfgMapInformer.GetStore().Update(cfg)
+				mockMgr.resources().Lock()
+				snapshot := mockMgr.resources().Snapshot()
+				mockMgr.resources().Unlock()
+				owned := mockMgr.appMgr.snapshotOwnedConfigs(snapshot)
+				mockMgr.appMgr.queueAppliedConfigs(owned)
+				Expect(mockMgr.appMgr.appliedConfigUpdates()).To(BeEmpty())
+				patches := len(fakeClient.Actions())
+				mockMgr.processStatusUpdates()
+				Expect(fakeClient.Actions()).To(HaveLen(patches))
+
+				// The hash follows the changes of the config
+				mockMgr.appMgr.appliedConfigBody = false
+				mockMgr.appMgr.queueAppliedConfigs(owned)
+				mockMgr.processStatusUpdates()
+				Expect(string(lastPatch())).To(ContainSubstring(
+					`"` + appliedConfigAnnotation + `":null`))
+				Expect(string(lastPatch())).To(ContainSubstring(hash))
+				cfg.ObjectMeta.Annotations = map[string]string{
+					appliedHashAnnotation: hash}
+				appInf.cfgMapInformer.GetStore().Update(cfg)
+				cfg.Data["data"] = strings.Replace(configmapFoo,
+					`"mode": "http"`, `"mode": "tcp"`, 1)
+				cfg.ObjectMeta.ResourceVersion = "2"
+				Expect(mockMgr.updateConfigMap(cfg)).To(BeTrue())
+				mockMgr.processStatusUpdates()
+				Expect(json.Unmarshal(lastPatch(), &patched)).To(BeNil())
+				Expect(patched.ObjectMeta.Annotations[appliedHashAnnotation]).
+					ToNot(Equal(hash))
+
+				// The annotations are removed with the virtual server
+				Expect(mockMgr.deleteService(svc)).To(BeTrue())
+				mockMgr.processStatusUpdates()
+				Expect(string(lastPatch())).To(ContainSubstring(
+					`"` + appliedHashAnnotation + `":null`))
+			})
+
+			It("reports the admission of Routes", func() {
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				mockMgr.addService(fooSvc)
+				spec := routeapi.RouteSpec{
+					Host: "foobar.com",
+					To: routeapi.RouteTargetReference{
+						Kind: "Service",
+						Name: "foo",
+					},
+					TLS: &routeapi.TLSConfig{
+						Termination:                   "edge",
+						InsecureEdgeTerminationPolicy: "Allow",
+					},
+				}
+				Expect(mockMgr.addRoute(
+					test.NewRoute("route", "1", namespace, spec))).To(BeTrue())
+				spec = routeapi.RouteSpec{
+					Host: "orphan.com",
+					To: routeapi.RouteTargetReference{
+						Kind: "Service",
+						Name: "missing",
+					},
+				}
+				orphan := test.NewRoute("orphan", "1", namespace, spec)
+				Expect(mockMgr.addRoute(orphan)).To(BeTrue())
+
+				report := mockMgr.appMgr.buildRouteReport()
+				Expect(report.Routes).To(Equal(2))
+				Expect(report.Admitted).To(Equal(1))
+				Expect(report.VirtualServers).To(Equal(map[string]int{
+					"openshift_default_http":  1,
+					"openshift_default_https": 1,
+				}))
+				Expect(report.Rejected).To(Equal([]rejectedRoute{{
+					Route:   namespace + "/orphan",
+					Reason:  "ServiceNotFound",
+					Message: "Service 'missing' has not been found.",
+				}}))
+
+				// The report is written to the status ConfigMap once
+				mockMgr.appMgr.routeConfig.StatusConfigMap = namespace + "/routes"
+				mockMgr.appMgr.publishRouteReport()
+				Expect(mockMgr.appMgr.statusQueue.Len()).To(Equal(1))
+				Expect(mockMgr.appMgr.processNextStatusUpdate()).To(BeTrue())
+				cm, err := mockMgr.appMgr.kubeClient.Core().ConfigMaps(namespace).
+					Get("routes", metav1.GetOptions{})
+				Expect(err).To(BeNil())
+				var written routeReport
+				Expect(json.Unmarshal([]byte(cm.Data[routeReportKey]),
+					&written)).To(BeNil())
+				Expect(written).To(Equal(report))
+				mockMgr.appMgr.publishRouteReport()
+				Expect(mockMgr.appMgr.statusQueue.Len()).To(Equal(0))
+
+				// Deleted Routes are dropped from the report
+				mockMgr.deleteRoute(orphan)
+				report = mockMgr.appMgr.buildRouteReport()
+				Expect(report.Routes).To(Equal(1))
+				Expect(report.Rejected).To(BeEmpty())
 			})
 
 			It("configures virtual servers via Routes", func() {
@@ -2806,7 +7180,121 @@ var _ = Describe("AppManager Tests", func() {
 					Path: "/bar",
 					To: routeapi.RouteTargetReference{
 						Kind: "Service",
-						Name: "bar",
+						Name: "bar",
+					},
+					TLS: &routeapi.TLSConfig{
+						Termination: "edge",
+						Certificate: "cert",
+						Key:         "key",
+					},
+				}
+				route2 := test.NewRoute("route2", "1", namespace, spec)
+				r = mockMgr.addRoute(route2)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				resources = mockMgr.resources()
+				// Associate a service
+				barSvc := test.NewService("bar", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				mockMgr.addService(barSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				Expect(resources.Count()).To(Equal(4))
+
+				rs, ok = resources.Get(
+					serviceKey{"bar", 80, "default"}, "openshift_default_https")
+				Expect(ok).To(BeTrue(), "Route should be accessible.")
+				Expect(rs).ToNot(BeNil(), "Route should be object.")
+				Expect(rs.MetaData.Active).To(BeTrue())
+				Expect(len(rs.Policies[0].Rules)).To(Equal(2))
+
+				customProfiles = mockMgr.customProfiles()
+				Expect(len(customProfiles)).To(Equal(2))
+				partition := rs.Virtual.Partition
+				Expect(rs.Virtual.SslProfile.F5ProfileNames).To(Equal([]string{
+					partition + "/openshift_route_default_route-https-cert",
+					partition + "/openshift_route_default_route2-https-cert",
+				}))
+
+				// Delete a Route resource
+				r = mockMgr.deleteRoute(route2)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(resources.Count()).To(Equal(2))
+				rs, ok = resources.Get(
+					serviceKey{"foo", 80, "default"}, "openshift_default_https")
+				Expect(ok).To(BeTrue())
+				Expect(len(rs.Policies[0].Rules)).To(Equal(1))
+				Expect(len(customProfiles)).To(Equal(1))
+				Expect(rs.Virtual.SslProfile.F5ProfileName).To(Equal(
+					partition + "/openshift_route_default_route-https-cert"))
+			})
+
+			It("configures extra listener ports via Route annotation", func() {
+				spec := routeapi.RouteSpec{
+					Host: "foobar.com",
+					Path: "/admin",
+					To: routeapi.RouteTargetReference{
+						Kind: "Service",
+						Name: "foo",
+					},
+					TLS: &routeapi.TLSConfig{
+						Termination: "edge",
+						Certificate: "cert",
+						Key:         "key",
+					},
+				}
+				route := test.NewRoute("route", "1", namespace, spec)
+				route.ObjectMeta.Annotations = map[string]string{
+					routeExtraPortsAnnotation: "8443, 9443",
+				}
+				r := mockMgr.addRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				r = mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+
+				resources := mockMgr.resources()
+				Expect(resources.Count()).To(Equal(4))
+				https, ok := resources.Get(
+					serviceKey{"foo", 80, "default"}, "openshift_default_https")
+				Expect(ok).To(BeTrue())
+				for _, port := range []int32{8443, 9443} {
+					name := fmt.Sprintf("openshift_default_https_%d", port)
+					rs, ok := resources.Get(serviceKey{"foo", 80, "default"}, name)
+					Expect(ok).To(BeTrue(), "Extra port should have a virtual.")
+					Expect(rs.MetaData.Active).To(BeTrue())
+					Expect(rs.Virtual.VirtualAddress.Port).To(Equal(port))
+					Expect(rs.Pools).To(Equal(https.Pools))
+					Expect(rs.Policies).To(HaveLen(1))
+					Expect(rs.Policies[0].Name).To(Equal(
+						fmt.Sprintf("openshift_secure_routes_%d", port)))
+					Expect(rs.Policies[0].Rules).To(Equal(https.Policies[0].Rules))
+					Expect(rs.Virtual.SslProfile.F5ProfileName).To(Equal(
+						https.Virtual.SslProfile.F5ProfileName))
+				}
+
+				// Removing a port removes its virtual server
+				route.ObjectMeta.Annotations[routeExtraPortsAnnotation] = "8443"
+				r = mockMgr.updateRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(resources.Count()).To(Equal(3))
+				_, ok = resources.Get(serviceKey{"foo", 80, "default"},
+					"openshift_default_https_9443")
+				Expect(ok).To(BeFalse())
+
+				// Invalid ports are ignored
+				route.ObjectMeta.Annotations[routeExtraPortsAnnotation] = "443"
+				r = mockMgr.updateRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(resources.Count()).To(Equal(2))
+			})
+
+			It("leaves out the virtual servers of disabled protocols", func() {
+				spec := routeapi.RouteSpec{
+					Host: "foobar.com",
+					Path: "/admin",
+					To: routeapi.RouteTargetReference{
+						Kind: "Service",
+						Name: "foo",
 					},
 					TLS: &routeapi.TLSConfig{
 						Termination: "edge",
@@ -2814,33 +7302,104 @@ var _ = Describe("AppManager Tests", func() {
 						Key:         "key",
 					},
 				}
-				route2 := test.NewRoute("route2", "1", namespace, spec)
-				r = mockMgr.addRoute(route2)
+				route := test.NewRoute("route", "1", namespace, spec)
+				route.ObjectMeta.Annotations = map[string]string{
+					routeExtraPortsAnnotation: "8443",
+				}
+				mockMgr.appMgr.routeConfig.DisableHttp = true
+				r := mockMgr.addRoute(route)
 				Expect(r).To(BeTrue(), "Route resource should be processed.")
-				resources = mockMgr.resources()
-				// Associate a service
-				barSvc := test.NewService("bar", "1", namespace, "NodePort",
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
 					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
-				mockMgr.addService(barSvc)
+				r = mockMgr.addService(fooSvc)
 				Expect(r).To(BeTrue(), "Service should be processed.")
-				Expect(resources.Count()).To(Equal(4))
 
-				rs, ok = resources.Get(
-					serviceKey{"bar", 80, "default"}, "openshift_default_https")
-				Expect(ok).To(BeTrue(), "Route should be accessible.")
-				Expect(rs).ToNot(BeNil(), "Route should be object.")
-				Expect(rs.MetaData.Active).To(BeTrue())
-				Expect(len(rs.Policies[0].Rules)).To(Equal(2))
+				resources := mockMgr.resources()
+				key := serviceKey{"foo", 80, "default"}
+				Expect(resources.Count()).To(Equal(2))
+				_, ok := resources.Get(key, "openshift_default_http")
+				Expect(ok).To(BeFalse())
+				_, ok = resources.Get(key, "openshift_default_https")
+				Expect(ok).To(BeTrue())
+				_, ok = resources.Get(key, "openshift_default_https_8443")
+				Expect(ok).To(BeTrue())
 
-				customProfiles = mockMgr.customProfiles()
-				Expect(len(customProfiles)).To(Equal(2))
+				// The annotation disables the https virtual servers, and
+				// the Route is no longer served
+				mockMgr.appMgr.routeConfig.DisableHttp = false
+				route.ObjectMeta.Annotations[routeProtocolsAnnotation] = "http"
+				r = mockMgr.updateRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(resources.Count()).To(Equal(1))
+				_, ok = resources.Get(key, "openshift_default_http")
+				Expect(ok).To(BeTrue())
+				report := mockMgr.appMgr.buildRouteReport()
+				Expect(report.Rejected).To(HaveLen(1))
+				Expect(report.Rejected[0].Reason).To(Equal("ProtocolDisabled"))
 
-				// Delete a Route resource
-				r = mockMgr.deleteRoute(route2)
+				// Invalid protocols are ignored
+				route.ObjectMeta.Annotations[routeProtocolsAnnotation] = "ftp"
+				r = mockMgr.updateRoute(route)
 				Expect(r).To(BeTrue(), "Route resource should be processed.")
-				Expect(resources.Count()).To(Equal(2))
-				Expect(len(rs.Policies[0].Rules)).To(Equal(1))
-				Expect(len(customProfiles)).To(Equal(1))
+				Expect(resources.Count()).To(Equal(3))
+				report = mockMgr.appMgr.buildRouteReport()
+				Expect(report.Rejected).To(BeEmpty())
+			})
+
+			It("removes Routes from the virtual servers of disabled protocols", func() {
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				r := mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				newRoute := func(name, host string) *routeapi.Route {
+					route := test.NewRoute(name, "1", namespace, routeapi.RouteSpec{
+						Host: host,
+						To: routeapi.RouteTargetReference{
+							Kind: "Service",
+							Name: "foo",
+						},
+						TLS: &routeapi.TLSConfig{
+							Termination: "edge",
+							Certificate: "cert",
+							Key:         "key",
+							InsecureEdgeTerminationPolicy: routeapi.
+								InsecureEdgeTerminationPolicyAllow,
+						},
+					})
+					route.ObjectMeta.Annotations = map[string]string{}
+					return route
+				}
+				route1 := newRoute("route1", "foo.com")
+				route2 := newRoute("route2", "bar.com")
+				r = mockMgr.addRoute(route1)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				r = mockMgr.addRoute(route2)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+
+				resources := mockMgr.resources()
+				key := serviceKey{"foo", 80, namespace}
+				ruleNames := func(rsName string) []string {
+					rs, ok := resources.Get(key, rsName)
+					Expect(ok).To(BeTrue())
+					var names []string
+					for _, pol := range rs.Policies {
+						for _, rule := range pol.Rules {
+							names = append(names, rule.Name)
+						}
+					}
+					return names
+				}
+				Expect(ruleNames("openshift_default_https")).To(ConsistOf(
+					formatRouteRuleName(route1), formatRouteRuleName(route2)))
+
+				// The https virtual server is kept for the other Route
+				route1.ObjectMeta.Annotations[routeProtocolsAnnotation] = "http"
+				r = mockMgr.updateRoute(route1)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(ruleNames("openshift_default_https")).To(ConsistOf(
+					formatRouteRuleName(route2)))
+				Expect(ruleNames("openshift_default_http")).To(ConsistOf(
+					formatRouteRuleName(route1), formatRouteRuleName(route2)))
 			})
 
 			It("configures passthrough routes", func() {
@@ -2909,7 +7468,7 @@ var _ = Describe("AppManager Tests", func() {
 					Name:      passthroughHostsDgName,
 					Partition: DEFAULT_PARTITION,
 				}
-				hostDg, found := mockMgr.appMgr.intDgMap[hostDgKey]
+				hostDg, found := mockMgr.appMgr.hostDgs.dataGroup(hostDgKey)
 				Expect(found).To(BeTrue())
 				Expect(len(hostDg.Records)).To(Equal(2))
 				Expect(hostDg.Records[1].Name).To(Equal(hostName1))
@@ -2929,7 +7488,7 @@ var _ = Describe("AppManager Tests", func() {
 				r = mockMgr.deleteRoute(route2)
 				Expect(r).To(BeTrue(), "Route resource should be processed.")
 				Expect(resources.Count()).To(Equal(2))
-				hostDg, found = mockMgr.appMgr.intDgMap[hostDgKey]
+				hostDg, found = mockMgr.appMgr.hostDgs.dataGroup(hostDgKey)
 				Expect(found).To(BeTrue())
 				Expect(len(hostDg.Records)).To(Equal(1))
 				Expect(hostDg.Records[0].Name).To(Equal(hostName1))
@@ -2978,7 +7537,7 @@ var _ = Describe("AppManager Tests", func() {
 					Name:      reencryptHostsDgName,
 					Partition: DEFAULT_PARTITION,
 				}
-				hostDg, found := mockMgr.appMgr.intDgMap[hostDgKey]
+				hostDg, found := mockMgr.appMgr.hostDgs.dataGroup(hostDgKey)
 				Expect(found).To(BeTrue())
 				Expect(len(hostDg.Records)).To(Equal(1))
 				Expect(hostDg.Records[0].Name).To(Equal(hostName))
@@ -3004,9 +7563,432 @@ var _ = Describe("AppManager Tests", func() {
 				Expect(rs.Virtual.GetProfileCountByContext(customProfileClient)).To(Equal(1))
 				Expect(rs.Virtual.GetProfileCountByContext(customProfileServer)).To(Equal(1))
 			})
+
+			It("configures reencrypt routes with a CA Secret", func() {
+				secret := &v1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "backend-ca",
+						Namespace: namespace,
+					},
+					Data: map[string][]byte{
+						"ca.crt": []byte("bundle-1"),
+					},
+				}
+				mockMgr.addSecret(secret)
+				spec := routeapi.RouteSpec{
+					Host: "foobar.com",
+					Path: "/foo",
+					To: routeapi.RouteTargetReference{
+						Kind: "Service",
+						Name: "foo",
+					},
+					TLS: &routeapi.TLSConfig{
+						Termination: "reencrypt",
+						DestinationCACertificate: "destCaCert",
+					},
+				}
+				route := test.NewRoute("route", "1", namespace, spec)
+				route.ObjectMeta.Annotations = map[string]string{
+					serverCASecretAnnotation: "backend-ca",
+				}
+				r := mockMgr.addRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 443, NodePort: 37001}})
+				r = mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+
+				serverCert := func() string {
+					for _, prof := range mockMgr.customProfiles() {
+						if prof.Context == customProfileServer {
+							return prof.Cert
+						}
+					}
+					return ""
+				}
+				// The Secret takes precedence over the inline certificate
+				Expect(serverCert()).To(Equal("bundle-1"))
+
+				appInf, _ := mockMgr.appMgr.getNamespaceInformer(namespace)
+				routes, err := appInf.routeInformer.GetIndexer().ByIndex(
+					secretIndex, namespace+"/backend-ca")
+				Expect(err).To(BeNil())
+				Expect(routes).To(Equal([]interface{}{route}))
+
+				// Rotating the bundle syncs the Routes using it
+				secret.Data["ca.crt"] = []byte("bundle-2")
+				mockMgr.updateSecret(secret)
+				queue := mockMgr.appMgr.vsQueue
+				mockMgr.appMgr.enqueueSecret(secret)
+				Expect(queue.Len()).To(Equal(1))
+				key, _ := queue.Get()
+				Expect(key).To(Equal(serviceQueueKey{
+					ServiceName: "foo",
+					Namespace:   namespace,
+				}))
+				queue.Done(key)
+				r = mockMgr.updateRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(serverCert()).To(Equal("bundle-2"))
+
+				// The inline certificate is used if the Secret is missing
+				mockMgr.deleteSecret(secret)
+				r = mockMgr.updateRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(serverCert()).To(Equal("destCaCert"))
+			})
+
+			It("reloads the default server CA of reencrypt Routes", func() {
+				caFile, err := ioutil.TempFile("", "service-ca")
+				Expect(err).To(BeNil())
+				defer os.Remove(caFile.Name())
+				Expect(ioutil.WriteFile(caFile.Name(), []byte("ca-1"),
+					0644)).To(Succeed())
+				mockMgr.appMgr.routeConfig.ServerCA = caFile.Name()
+
+				spec := routeapi.RouteSpec{
+					Host: "foobar.com",
+					Path: "/foo",
+					To: routeapi.RouteTargetReference{
+						Kind: "Service",
+						Name: "foo",
+					},
+					TLS: &routeapi.TLSConfig{
+						Termination: "reencrypt",
+					},
+				}
+				route := test.NewRoute("route", "1", namespace, spec)
+				r := mockMgr.addRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 443, NodePort: 37001}})
+				r = mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				key := profileKey{
+					Partition: DEFAULT_PARTITION,
+					Name:      defaultServerSslProfile().Name,
+				}
+				Expect(mockMgr.customProfiles()[key].Cert).To(Equal("ca-1"))
+
+				// Nothing is written while the CA is unchanged
+				mw := mockMgr.appMgr.configWriter.(*test.MockWriter)
+				written := mw.WrittenTimes
+				mockMgr.appMgr.reloadDefaultServerCA()
+				Expect(mw.WrittenTimes).To(Equal(written))
+
+				// The rotated CA updates the profile
+				Expect(ioutil.WriteFile(caFile.Name(), []byte("ca-2"),
+					0644)).To(Succeed())
+				mockMgr.appMgr.reloadDefaultServerCA()
+				Expect(mockMgr.customProfiles()[key].Cert).To(Equal("ca-2"))
+				Expect(mw.WrittenTimes).To(Equal(written + 1))
+			})
+
+			It("rejects Routes failing the extended validation", func() {
+				mockMgr.appMgr.routeConfig.ExtendedValidation = true
+				recorder := mockMgr.appMgr.eventRecorder.(*record.FakeRecorder)
+				spec := routeapi.RouteSpec{
+					Host: "foobar.com",
+					Path: "/foo",
+					To: routeapi.RouteTargetReference{
+						Kind: "Service",
+						Name: "foo",
+					},
+					TLS: &routeapi.TLSConfig{
+						Termination: "edge",
+						Certificate: "cert",
+						Key:         "key",
+					},
+				}
+				route := test.NewRoute("route", "1", namespace, spec)
+				r := mockMgr.addRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				fooSvc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 443, NodePort: 37001}})
+				r = mockMgr.addService(fooSvc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+
+				report := mockMgr.appMgr.buildRouteReport()
+				Expect(report.Admitted).To(Equal(0))
+				Expect(report.Rejected).To(HaveLen(1))
+				Expect(report.Rejected[0].Reason).To(Equal(routeValidationFailed))
+				Expect(report.Rejected[0].Message).To(
+					ContainSubstring("certificate and key do not match"))
+				Expect(recorder.Events).To(Receive(
+					ContainSubstring(routeValidationFailed)))
+				Expect(mockMgr.customProfiles()).To(BeEmpty())
+
+				// The Event is only recorded once
+				route.ObjectMeta.ResourceVersion = "2"
+				r = mockMgr.updateRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				Expect(recorder.Events).ToNot(Receive())
+
+				// A fixed Route is admitted
+				route.Spec.TLS.Certificate = ""
+				route.Spec.TLS.Key = ""
+				route.ObjectMeta.ResourceVersion = "3"
+				r = mockMgr.updateRoute(route)
+				Expect(r).To(BeTrue(), "Route resource should be processed.")
+				report = mockMgr.appMgr.buildRouteReport()
+				Expect(report.Admitted).To(Equal(1))
+				Expect(report.Rejected).To(BeEmpty())
+			})
 		})
 
 		Context("namespace related", func() {
+			It("only manages namespaces in its shard", func() {
+				mockMgr.appMgr.shard = ShardConfig{Index: 0, Total: 2}
+				err := mockMgr.startNonLabelMode([]string{""})
+				Expect(err).To(BeNil())
+
+				var inShard, outOfShard string
+				for i := 0; "" == inShard || "" == outOfShard; i++ {
+					ns := fmt.Sprintf("ns%d", i)
+					if mockMgr.appMgr.inShard(ns) {
+						inShard = ns
+					} else {
+						outOfShard = ns
+					}
+				}
+				svcIn := test.NewService("foo", "1", inShard, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				r := mockMgr.addService(svcIn)
+				Expect(r).To(BeTrue(), "Service in shard should be processed.")
+				svcOut := test.NewService("foo", "1", outOfShard, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37002}})
+				r = mockMgr.addService(svcOut)
+				Expect(r).To(BeFalse(), "Service outside shard should be ignored.")
+
+				mockMgr.appMgr.shard = ShardConfig{}
+				Expect(mockMgr.appMgr.inShard(outOfShard)).To(BeTrue())
+			})
+
+			It("writes a diagnostics bundle", func() {
+				namespace := "default"
+				err := mockMgr.startNonLabelMode([]string{namespace})
+				Expect(err).To(BeNil())
+				svc := test.NewService("foo", "1", namespace, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				r := mockMgr.addService(svc)
+				Expect(r).To(BeTrue(), "Service should be processed.")
+				cfgFoo := test.NewConfigMap("foomap", "1", namespace,
+					map[string]string{
+						"schema": schemaUrl,
+						"data":   configmapFoo,
+					})
+				r = mockMgr.addConfigMap(cfgFoo)
+				Expect(r).To(BeTrue(), "ConfigMap should be processed.")
+				mockMgr.appMgr.customProfiles.profs[profileKey{
+					Partition: "velcro",
+					Name:      "tls-secret",
+				}] = CustomProfile{
+					Name:      "tls-secret",
+					Partition: "velcro",
+					Context:   customProfileClient,
+					Cert:      "CERTIFICATE",
+					Key:       "PRIVATE KEY",
+				}
+				mockMgr.appMgr.recordSyncError(serviceQueueKey{
+					Namespace:   namespace,
+					ServiceName: "foo",
+				}, fmt.Errorf("sync failed"))
+				mockMgr.appMgr.vsQueue.Add(serviceQueueKey{
+					Namespace:   namespace,
+					ServiceName: "pending",
+				})
+
+				var buf bytes.Buffer
+				err = mockMgr.appMgr.WriteDiagnosticsBundle(&buf,
+					map[string]string{"version": "test"})
+				Expect(err).To(BeNil())
+
+				gz, err := gzip.NewReader(&buf)
+				Expect(err).To(BeNil())
+				tr := tar.NewReader(gz)
+				files := make(map[string]string)
+				for {
+					hdr, err := tr.Next()
+					if io.EOF == err {
+						break
+					}
+					Expect(err).To(BeNil())
+					data, err := ioutil.ReadAll(tr)
+					Expect(err).To(BeNil())
+					files[hdr.Name] = string(data)
+				}
+				Expect(files).To(HaveKey("version.json"))
+				Expect(files).To(HaveKey("queues.json"))
+				Expect(files["version.json"]).To(ContainSubstring("test"))
+				Expect(files["resources.json"]).To(ContainSubstring("foo"))
+				Expect(files["informers.json"]).To(ContainSubstring(namespace + "/foomap"))
+				Expect(files["sync_errors.json"]).To(ContainSubstring("sync failed"))
+				Expect(files["queues.json"]).To(ContainSubstring("ServiceName:pending"))
+				Expect(files["profiles.json"]).To(ContainSubstring("CERTIFICATE"))
+				Expect(files["profiles.json"]).To(ContainSubstring("REDACTED"))
+				for name, data := range files {
+					Expect(data).ToNot(ContainSubstring("PRIVATE KEY"),
+						"Private keys should be redacted from %s.", name)
+				}
+			})
+
+			It("tracks pending and running keys of the work queues", func() {
+				q, ok := mockMgr.appMgr.vsQueue.(*monitoredQueue)
+				Expect(ok).To(BeTrue(), "Work queues should be monitored.")
+				keys := []serviceQueueKey{
+					{ServiceName: "foo", Namespace: "default"},
+					{ServiceName: "bar", Namespace: "default"},
+				}
+				for _, key := range keys {
+					q.Add(key)
+				}
+				// Keys already pending are only counted once
+				q.Add(keys[0])
+				Expect(q.Len()).To(Equal(2))
+				Expect(q.pendingKeys(queueDumpSize)).To(HaveLen(2))
+				Expect(q.pendingKeys(1)).To(Equal([]string{
+					fmt.Sprintf("%+v", keys[1])}))
+				Expect(q.addRate()).To(BeNumerically(">", 0))
+				Expect(q.longestRunning()).To(BeZero())
+
+				item, quit := q.Get()
+				Expect(quit).To(BeFalse())
+				Expect(q.pendingKeys(queueDumpSize)).To(HaveLen(1))
+				Expect(q.longestRunning()).To(BeNumerically(">", 0))
+				// A key re-added while processing is pending again
+				q.Add(item)
+				Expect(q.pendingKeys(queueDumpSize)).To(HaveLen(2))
+				q.Done(item)
+				Expect(q.longestRunning()).To(BeZero())
+				Expect(q.Len()).To(Equal(2))
+
+				// Warnings are rate limited
+				q.check(1)
+				warned := q.lastWarning
+				Expect(warned.IsZero()).To(BeFalse())
+				q.check(1)
+				Expect(q.lastWarning).To(Equal(warned))
+				q.lastWarning = time.Time{}
+				q.check(0)
+				Expect(q.lastWarning.IsZero()).To(BeTrue(),
+					"A threshold of 0 should disable the warning.")
+			})
+
+			It("reports the progress of the initial sync", func() {
+				err := mockMgr.startNonLabelMode([]string{"default"})
+				Expect(err).To(BeNil())
+				// The informers of the mock manager are not run
+				Expect(mockMgr.appMgr.unsyncedInformers()).To(Equal([]string{
+					"default/configmaps",
+					"default/endpoints",
+					"default/ingresses",
+					"default/routes",
+					"default/secrets",
+					"default/services",
+				}))
+
+				mockMgr.appMgr.initialSyncDeadline = 10 * time.Millisecond
+				stopCh := make(chan struct{})
+				done := make(chan struct{})
+				go func() {
+					mockMgr.appMgr.checkInitialSyncDeadline(stopCh)
+					close(done)
+				}()
+				Eventually(done).Should(BeClosed())
+				close(stopCh)
+
+				// Extra workers stop once the initial config is written
+				mockMgr.appMgr.startTime = time.Now()
+				mockMgr.appMgr.outputConfig()
+				Expect(mockMgr.appMgr.isInitialState()).To(BeTrue())
+				mockMgr.appMgr.vsQueue.Add(serviceQueueKey{
+					ServiceName: "foo",
+					Namespace:   "default",
+				})
+				mockMgr.appMgr.initialSyncWorker()
+				Expect(mockMgr.appMgr.vsQueue.Len()).To(Equal(1))
+			})
+
+			It("serves the namespaces of the work queue in turn", func() {
+				q := newFairQueue(workqueue.NewItemExponentialFailureRateLimiter(
+					time.Millisecond, time.Second), "test", serviceKeyNamespace)
+				defer q.ShutDown()
+				key := func(ns, name string) serviceQueueKey {
+					return serviceQueueKey{ServiceName: name, Namespace: ns}
+				}
+				// A namespace with a flood of changes
+				for _, name := range []string{"a", "b", "c", "d"} {
+					q.Add(key("busy", name))
+				}
+				q.Add(key("quiet", "a"))
+				q.Add(key("other", "a"))
+				q.Add(key("quiet", "b"))
+				// Keys already pending are only queued once
+				q.Add(key("busy", "a"))
+				Expect(q.Len()).To(Equal(7))
+
+				var order []serviceQueueKey
+				for q.Len() > 0 {
+					item, quit := q.Get()
+					Expect(quit).To(BeFalse())
+					order = append(order, item.(serviceQueueKey))
+					q.Done(item)
+				}
+				Expect(order).To(Equal([]serviceQueueKey{
+					key("busy", "a"),
+					key("quiet", "a"),
+					key("other", "a"),
+					key("busy", "b"),
+					key("quiet", "b"),
+					key("busy", "c"),
+					key("busy", "d"),
+				}))
+
+				// A key added while processing is queued again once done
+				q.Add(key("busy", "a"))
+				item, _ := q.Get()
+				q.Add(item)
+				Expect(q.Len()).To(Equal(0))
+				q.Done(item)
+				Expect(q.Len()).To(Equal(1))
+				item, _ = q.Get()
+				q.Done(item)
+
+				// Delayed keys are coalesced
+				q.AddAfter(key("quiet", "a"), 10*time.Millisecond)
+				q.AddAfter(key("quiet", "a"), 20*time.Millisecond)
+				Expect(q.Len()).To(Equal(0))
+				Eventually(q.Len).Should(Equal(1))
+				item, _ = q.Get()
+				q.Done(item)
+				Consistently(q.Len, 50*time.Millisecond).Should(Equal(0))
+
+				// Only the adds after failed syncs count as retries
+				retries := &fakeQueueMetric{}
+				q.metrics = &fairQueueMetrics{
+					depth:        &fakeQueueMetric{},
+					adds:         &fakeQueueMetric{},
+					latency:      &fakeQueueMetric{},
+					workDuration: &fakeQueueMetric{},
+					retries:      retries,
+				}
+				q.AddAfter(key("quiet", "b"), time.Millisecond)
+				Expect(retries.count).To(Equal(0))
+				q.AddRateLimited(key("quiet", "c"))
+				Expect(retries.count).To(Equal(1))
+				Eventually(q.Len).Should(Equal(2))
+
+				// The pending keys are still served once shut down
+				q.ShutDown()
+				for i := 0; i < 2; i++ {
+					item, quit := q.Get()
+					Expect(quit).To(BeFalse())
+					q.Done(item)
+				}
+				_, quit := q.Get()
+				Expect(quit).To(BeTrue())
+			})
+
 			It("handles multiple namespaces", func() {
 				// Add config maps and services to 3 namespaces and ensure they only
 				// are processed in the 2 namespaces we are configured to watch.
@@ -3113,6 +8095,21 @@ var _ = Describe("AppManager Tests", func() {
 				Expect(err).To(BeNil())
 			})
 
+			It("does not watch namespaces with an invalid route label", func() {
+				cfgMapSelector, err := labels.Parse(DefaultConfigMapLabel)
+				Expect(err).To(BeNil())
+
+				mockMgr.appMgr.routeConfig.RouteLabel = "f5type in (app 1)"
+				err = mockMgr.appMgr.AddNamespace("default", cfgMapSelector, 0)
+				Expect(err).ToNot(BeNil())
+				_, found := mockMgr.appMgr.getNamespaceInformer("default")
+				Expect(found).To(BeFalse())
+
+				mockMgr.appMgr.routeConfig.RouteLabel = "f5type in (app1)"
+				err = mockMgr.appMgr.AddNamespace("default", cfgMapSelector, 0)
+				Expect(err).To(BeNil())
+			})
+
 			It("properly manage a namespace informer", func() {
 				cfgMapSelector, err := labels.Parse(DefaultConfigMapLabel)
 				Expect(err).To(BeNil())
@@ -3273,6 +8270,165 @@ var _ = Describe("AppManager Tests", func() {
 				Expect(ok).To(BeTrue(), "Config map should be accessible.")
 				Expect(rs.MetaData.Active).To(BeTrue())
 			})
+
+			It("disables the virtual servers of deleted namespaces", func() {
+				nsLabel := "watching"
+				err := mockMgr.startLabelMode(nsLabel)
+				Expect(err).To(BeNil())
+				mockMgr.appMgr.nsDeleteGrace = time.Hour
+
+				ns := test.NewNamespace("ns1", "1", map[string]string{nsLabel: "yes"})
+				Expect(mockMgr.addNamespace(ns)).To(BeTrue())
+				cfgFoo := test.NewConfigMap("foomap", "1", ns.ObjectMeta.Name,
+					map[string]string{
+						"schema": schemaUrl,
+						"data":   configmapFoo,
+					})
+				svcFoo := test.NewService("foo", "1", ns.ObjectMeta.Name, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				Expect(mockMgr.addConfigMap(cfgFoo)).To(BeTrue())
+				Expect(mockMgr.addService(svcFoo)).To(BeTrue())
+				resources := mockMgr.resources()
+				key := serviceKey{"foo", 80, ns.ObjectMeta.Name}
+				rs, ok := resources.Get(key, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.Disabled).To(BeFalse())
+
+				// Terminating namespaces keep their virtual servers, disabled
+				terminating := test.NewNamespace("ns1", "2",
+					map[string]string{nsLabel: "yes"})
+				now := metav1.Now()
+				terminating.ObjectMeta.DeletionTimestamp = &now
+				mockMgr.appMgr.nsInformer.GetStore().Update(terminating)
+				Expect(mockMgr.appMgr.syncNamespace("ns1")).To(BeNil())
+				_, found := mockMgr.appMgr.getNamespaceInformer("ns1")
+				Expect(found).To(BeFalse())
+				rs, ok = resources.Get(key, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.Disabled).To(BeTrue())
+
+				// Before the end of the grace period, the namespace is kept
+				mockMgr.appMgr.nsInformer.GetStore().Delete(terminating)
+				Expect(mockMgr.appMgr.syncNamespace("ns1")).To(BeNil())
+				_, ok = resources.Get(key, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+
+				// Recreating the namespace cancels the deletion, keeping the
+				// virtual servers disabled until their keys are synced again
+				Expect(mockMgr.addNamespace(ns)).To(BeTrue())
+				Expect(mockMgr.appMgr.nsDeletions).To(BeEmpty())
+				rs, ok = resources.Get(key, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.Disabled).To(BeTrue())
+				var queued []interface{}
+				for mockMgr.appMgr.vsQueue.Len() > 0 {
+					item, _ := mockMgr.appMgr.vsQueue.Get()
+					queued = append(queued, item)
+					mockMgr.appMgr.vsQueue.Done(item)
+				}
+				Expect(queued).To(ContainElement(serviceQueueKey{
+					Namespace:   "ns1",
+					ServiceName: "foo",
+				}))
+				Expect(mockMgr.addConfigMap(cfgFoo)).To(BeTrue())
+				Expect(mockMgr.addService(svcFoo)).To(BeTrue())
+				rs, ok = resources.Get(key, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.Disabled).To(BeFalse())
+
+				// The virtual servers are removed at the end of the grace period
+				mockMgr.appMgr.nsInformer.GetStore().Delete(ns)
+				Expect(mockMgr.appMgr.syncNamespace("ns1")).To(BeNil())
+				rs, ok = resources.Get(key, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeTrue())
+				Expect(rs.Virtual.Disabled).To(BeTrue())
+				mockMgr.appMgr.nsDeletions["ns1"] = time.Now().Add(-time.Second)
+				Expect(mockMgr.appMgr.syncNamespace("ns1")).To(BeNil())
+				_, ok = resources.Get(key, formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeFalse())
+				Expect(mockMgr.appMgr.nsDeletions).To(BeEmpty())
+			})
+
+			It("removes the virtual servers of deleted namespaces", func() {
+				nsLabel := "watching"
+				err := mockMgr.startLabelMode(nsLabel)
+				Expect(err).To(BeNil())
+
+				ns := test.NewNamespace("ns1", "1", map[string]string{nsLabel: "yes"})
+				Expect(mockMgr.addNamespace(ns)).To(BeTrue())
+				cfgFoo := test.NewConfigMap("foomap", "1", ns.ObjectMeta.Name,
+					map[string]string{
+						"schema": schemaUrl,
+						"data":   configmapFoo,
+					})
+				svcFoo := test.NewService("foo", "1", ns.ObjectMeta.Name, "NodePort",
+					[]v1.ServicePort{{Port: 80, NodePort: 37001}})
+				Expect(mockMgr.addConfigMap(cfgFoo)).To(BeTrue())
+				Expect(mockMgr.addService(svcFoo)).To(BeTrue())
+				mw.Lock()
+				written := mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				Expect(written[DEFAULT_PARTITION].Virtuals).To(HaveLen(1))
+
+				// The config is written without the virtual servers of the
+				// namespace once its informers are removed
+				done := make(chan error)
+				go func() {
+					mockMgr.appMgr.nsInformer.GetStore().Delete(ns)
+					done <- mockMgr.appMgr.syncNamespace("ns1")
+				}()
+				Eventually(done).Should(Receive(BeNil()))
+				_, found := mockMgr.appMgr.getNamespaceInformer("ns1")
+				Expect(found).To(BeFalse())
+				_, ok := mockMgr.resources().Get(serviceKey{"foo", 80, "ns1"},
+					formatConfigMapVSName(cfgFoo))
+				Expect(ok).To(BeFalse())
+				mw.Lock()
+				written = mw.Sections["resources"].(PartitionMap)
+				mw.Unlock()
+				Expect(written).ToNot(HaveKey(DEFAULT_PARTITION))
+			})
+		})
+	})
+
+	Describe("Using the test harness", func() {
+		It("writes the BIG-IP state of the events", func() {
+			fb := test.NewFakeBigIP()
+			h, err := newHarness(&Params{
+				KubeClient:    fake.NewSimpleClientset(),
+				ConfigWriter:  fb,
+				EventRecorder: record.NewFakeRecorder(100),
+			}, "default")
+			Expect(err).To(BeNil())
+			defer h.shutdown()
+
+			cfgFoo := test.NewConfigMap("foomap", "1", "default",
+				map[string]string{"schema": schemaUrl, "data": configmapFoo})
+			Expect(h.addConfigMap(cfgFoo)).To(Succeed())
+			svc := test.NewService("foo", "1", "default", "ClusterIP",
+				[]v1.ServicePort{{Port: 80}})
+			Expect(h.addService(svc)).To(Succeed())
+			endpts := test.NewEndpoints("foo", "1", "default",
+				[]string{"10.2.96.1", "10.2.96.0"}, []string{},
+				[]v1.EndpointPort{{Port: 8080}})
+			Expect(h.addEndpoints(endpts)).To(Succeed())
+
+			Expect(fb.Partitions()).To(Equal([]string{"velcro"}))
+			Expect(fb.Names("velcro", test.VirtualServers)).To(Equal(
+				[]string{"default_foomap"}))
+			vs, ok := fb.Get("velcro", test.VirtualServers, "default_foomap")
+			Expect(ok).To(BeTrue())
+			Expect(vs["destination"]).To(Equal("/velcro/10.128.10.240:5051"))
+			Expect(fb.PoolMembers("velcro", "default_foomap")).To(Equal(
+				[]string{"10.2.96.0:8080", "10.2.96.1:8080"}))
+
+			Expect(h.deleteEndpoints(endpts)).To(Succeed())
+			Expect(fb.PoolMembers("velcro", "default_foomap")).To(BeEmpty())
+			Expect(h.deleteConfigMap(cfgFoo)).To(Succeed())
+			Expect(fb.Names("velcro", test.VirtualServers)).To(BeEmpty())
+
+			Expect(h.addIngress(test.NewIngress("ing", "1", "other",
+				v1beta1.IngressSpec{}, nil))).ToNot(Succeed())
 		})
 	})
 })
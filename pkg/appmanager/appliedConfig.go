@@ -0,0 +1,308 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"sort"
+	"strings"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// The annotations to set on a resource for the configs last written for
+// it. An empty hash removes them.
+type appliedConfigUpdate struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Hash      string
+	Config    string
+}
+
+// Largest config written to the applied config annotation. The annotations
+// of a resource are limited to 256 KiB in total, larger configs are only
+// hashed.
+const appliedConfigMaxSize = 64 * 1024
+
+// Kind, namespace and name of the ConfigMap or Ingress a config was created
+// for, from its metadata
+func appliedConfigOwner(cfg *ResourceConfig) (string, string, string) {
+	kind := configMapKind
+	if "ingress" == cfg.MetaData.ResourceType {
+		kind = ingressKind
+	}
+	parts := strings.SplitN(cfg.MetaData.ResourceName, "/", 2)
+	if len(parts) < 2 {
+		return kind, "", ""
+	}
+	return kind, parts[0], parts[1]
+}
+
+// Part of the config of a virtual server created for one Route: its policy
+// rules, the pool of its service and the profiles named after it
+type routeAppliedConfig struct {
+	Virtual  string       `json:"virtual"`
+	Rules    []Rule       `json:"rules,omitempty"`
+	Pool     *Pool        `json:"pool,omitempty"`
+	Profiles []ProfileRef `json:"profiles,omitempty"`
+}
+
+// Parts of the configs of the virtual servers a namespace's Routes share
+// that were created for one Route. The ordinals of the rules are left out,
+// they change with the other Routes.
+func routeAppliedConfigs(
+	route *routeapi.Route,
+	cfgs map[string]*ResourceConfig,
+) []routeAppliedConfig {
+	ruleName := formatRouteRuleName(route)
+	poolName := formatRoutePoolName(route)
+	var parts []routeAppliedConfig
+	for _, cfg := range orderedConfigs(cfgs) {
+		part := routeAppliedConfig{Virtual: cfg.Virtual.VirtualServerName}
+		for _, pol := range cfg.Policies {
+			for _, rule := range pol.Rules {
+				if rule.Name == ruleName {
+					r := *rule
+					r.Ordinal = 0
+					part.Rules = append(part.Rules, r)
+				}
+			}
+		}
+		for i := range cfg.Pools {
+			if cfg.Pools[i].Name == poolName {
+				part.Pool = &cfg.Pools[i]
+			}
+		}
+		for _, prof := range cfg.Virtual.Profiles {
+			if strings.HasPrefix(prof.Name, ruleName+"-") {
+				part.Profiles = append(part.Profiles, prof)
+			}
+		}
+		if 0 != len(part.Rules) || nil != part.Pool || 0 != len(part.Profiles) {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// Configs ordered by the name of their virtual server
+func orderedConfigs(cfgs map[string]*ResourceConfig) []*ResourceConfig {
+	var names []string
+	for name := range cfgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var ordered []*ResourceConfig
+	for _, name := range names {
+		ordered = append(ordered, cfgs[name])
+	}
+	return ordered
+}
+
+// Hash of the configs applied for a resource, and the configs as JSON,
+// empty if they are too large for an annotation
+func appliedConfigHash(configs interface{}) (string, string) {
+	h := fnv.New64a()
+	hashValue(h, reflect.ValueOf(configs))
+	// Marshalling these types cannot fail, they hold no channels or funcs
+	body, _ := json.Marshal(configs)
+	if len(body) > appliedConfigMaxSize {
+		body = nil
+	}
+	return fmt.Sprintf("%016x", h.Sum64()), string(body)
+}
+
+// Configs by owner and virtual server name. Routes share those of their
+// namespace, owned by "Route/<namespace>".
+type ownedConfigs map[string]map[string]*ResourceConfig
+
+// Copy the active configs of a snapshot by owner, before it is written:
+// the write fills in the snapshot, the hashes are only to change with the
+// configs. None if the annotations are disabled.
+func (appMgr *Manager) snapshotOwnedConfigs(
+	snapshot *ResourceSnapshot,
+) ownedConfigs {
+	if !appMgr.appliedConfigHash {
+		return nil
+	}
+	owned := make(ownedConfigs)
+	snapshot.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if !cfg.MetaData.Active {
+			return
+		}
+		owner := routeKind + "/" + key.Namespace
+		if "route" != cfg.MetaData.ResourceType {
+			kind, namespace, name := appliedConfigOwner(cfg)
+			owner = kind + "/" + namespace + "/" + name
+		}
+		if _, ok := owned[owner]; !ok {
+			owned[owner] = make(map[string]*ResourceConfig)
+		}
+		owned[owner][cfg.Virtual.VirtualServerName] = cfg.copy()
+	})
+	return owned
+}
+
+// Queue the annotation of the ConfigMaps, Ingresses and Routes with the
+// configs written, so users can check with kubectl that their latest
+// changes made it to the BIG-IP. The resources are compared with them by
+// the status worker, outside of the write.
+func (appMgr *Manager) queueAppliedConfigs(owned ownedConfigs) {
+	if !appMgr.appliedConfigHash {
+		return
+	}
+	appMgr.appliedMutex.Lock()
+	appMgr.appliedConfig = owned
+	appMgr.appliedMutex.Unlock()
+	appMgr.statusQueue.Add(appliedConfigsUpdate{})
+}
+
+// The annotations to change on the ConfigMaps, Ingresses and Routes whose
+// configs changed since they were last annotated. Resources with no active
+// config have the annotations removed.
+func (appMgr *Manager) appliedConfigUpdates() []appliedConfigUpdate {
+	appMgr.appliedMutex.Lock()
+	owned := appMgr.appliedConfig
+	appMgr.appliedMutex.Unlock()
+
+	var updates []appliedConfigUpdate
+	addUpdate := func(
+		kind, namespace, name string,
+		annotations map[string]string,
+		configs interface{},
+	) {
+		update := appliedConfigUpdate{
+			Kind:      kind,
+			Namespace: namespace,
+			Name:      name,
+		}
+		if nil != configs {
+			update.Hash, update.Config = appliedConfigHash(configs)
+			if !appMgr.appliedConfigBody {
+				update.Config = ""
+			}
+		}
+		if update.Hash == annotations[appliedHashAnnotation] &&
+			update.Config == annotations[appliedConfigAnnotation] {
+			return
+		}
+		updates = append(updates, update)
+	}
+	configsOf := func(kind, namespace, name string) interface{} {
+		if cfgs, ok := owned[kind+"/"+namespace+"/"+name]; ok {
+			return orderedConfigs(cfgs)
+		}
+		return nil
+	}
+	appMgr.informersMutex.Lock()
+	defer appMgr.informersMutex.Unlock()
+	for _, appInf := range appMgr.appInformers {
+		if !appMgr.cfgMapStatusDisabled {
+			for _, obj := range appInf.cfgMapInformer.GetStore().List() {
+				cm := obj.(*v1.ConfigMap)
+				addUpdate(configMapKind, cm.ObjectMeta.Namespace,
+					cm.ObjectMeta.Name, cm.ObjectMeta.Annotations,
+					configsOf(configMapKind, cm.ObjectMeta.Namespace,
+						cm.ObjectMeta.Name))
+			}
+		}
+		for _, obj := range appInf.ingInformer.GetStore().List() {
+			ing := obj.(*v1beta1.Ingress)
+			addUpdate(ingressKind, ing.ObjectMeta.Namespace,
+				ing.ObjectMeta.Name, ing.ObjectMeta.Annotations,
+				configsOf(ingressKind, ing.ObjectMeta.Namespace,
+					ing.ObjectMeta.Name))
+		}
+		if nil != appInf.routeInformer {
+			for _, obj := range appInf.routeInformer.GetStore().List() {
+				route := obj.(*routeapi.Route)
+				var configs interface{}
+				parts := routeAppliedConfigs(route,
+					owned[routeKind+"/"+route.ObjectMeta.Namespace])
+				if 0 != len(parts) {
+					configs = parts
+				}
+				addUpdate(routeKind, route.ObjectMeta.Namespace,
+					route.ObjectMeta.Name, route.ObjectMeta.Annotations, configs)
+			}
+		}
+	}
+	return updates
+}
+
+// Patch the applied config annotations of the resources whose configs
+// changed. The others are still patched when one fails, the failed ones are
+// retried with the whole update.
+func (appMgr *Manager) setAppliedConfigsNow() error {
+	var failed error
+	for _, update := range appMgr.appliedConfigUpdates() {
+		if err := appMgr.setAppliedConfigNow(update); nil != err {
+			failed = fmt.Errorf("annotating %v %v/%v: %v", update.Kind,
+				update.Namespace, update.Name, err)
+		}
+	}
+	return failed
+}
+
+// Patch the applied config annotations of a resource. A resource deleted
+// since is left alone.
+func (appMgr *Manager) setAppliedConfigNow(update appliedConfigUpdate) error {
+	// A null value removes an annotation
+	var hash, config interface{}
+	if "" != update.Hash {
+		hash = update.Hash
+	}
+	if "" != update.Config {
+		config = update.Config
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{
+				appliedHashAnnotation:   hash,
+				appliedConfigAnnotation: config,
+			},
+		},
+	})
+	if nil != err {
+		return err
+	}
+	switch update.Kind {
+	case configMapKind:
+		_, err = appMgr.kubeClient.CoreV1().ConfigMaps(update.Namespace).
+			Patch(update.Name, types.MergePatchType, patch)
+	case ingressKind:
+		_, err = appMgr.kubeClient.ExtensionsV1beta1().
+			Ingresses(update.Namespace).
+			Patch(update.Name, types.MergePatchType, patch)
+	case routeKind:
+		err = appMgr.routeClientV1.Patch(types.MergePatchType).
+			Namespace(update.Namespace).Resource("routes").
+			Name(update.Name).Body(patch).Do().Error()
+	}
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// Annotations that hand an Ingress' TLS Secrets to cert-manager
+const certManagerIssuerAnnotation = "certmanager.k8s.io/issuer"
+const certManagerClusterIssuerAnnotation = "certmanager.k8s.io/cluster-issuer"
+const tlsAcmeAnnotation = "kubernetes.io/tls-acme"
+
+// Default time to wait for a certificate before recording an Event
+const DefaultCertManagerTimeout = 10 * time.Minute
+
+// A TLS Secret that cert-manager has not created yet
+type certWait struct {
+	since    time.Time
+	reported bool
+}
+
+// Whether the TLS Secrets of an Ingress are issued by cert-manager
+func isCertManagerIngress(ing *v1beta1.Ingress) bool {
+	annotations := ing.ObjectMeta.Annotations
+	if _, ok := annotations[certManagerIssuerAnnotation]; ok {
+		return true
+	}
+	if _, ok := annotations[certManagerClusterIssuerAnnotation]; ok {
+		return true
+	}
+	return "true" == annotations[tlsAcmeAnnotation]
+}
+
+// Wait for cert-manager to create a missing TLS Secret of an Ingress. The
+// Ingress is synced again by the event of the Secret informer once the
+// Secret exists. Its services are requeued once at the timeout, to record an
+// Event if the Secret is still missing.
+func (appMgr *Manager) waitForCertificate(
+	rsCfg *ResourceConfig,
+	ing *v1beta1.Ingress,
+	secretName string,
+) {
+	key := ing.ObjectMeta.Namespace + "/" + secretName
+	appMgr.certWaitsMutex.Lock()
+	wait, ok := appMgr.certWaits[key]
+	if !ok {
+		wait = &certWait{since: time.Now()}
+		appMgr.certWaits[key] = wait
+		log.Infof("Waiting for cert-manager to issue Secret '%s' for Ingress '%s'.",
+			key, ing.ObjectMeta.Name)
+	}
+	report := !wait.reported && appMgr.certManagerTimeout > 0 &&
+		time.Since(wait.since) >= appMgr.certManagerTimeout
+	if report {
+		wait.reported = true
+	}
+	appMgr.certWaitsMutex.Unlock()
+
+	if report {
+		msg := fmt.Sprintf("Certificate Secret '%s' has not been issued after %v.",
+			secretName, appMgr.certManagerTimeout)
+		log.Warningf("%s", msg)
+		appMgr.recordIngressEvent(ing, "CertificateNotIssued", msg,
+			rsCfg.Virtual.VirtualServerName)
+	}
+	if ok || appMgr.certManagerTimeout <= 0 {
+		return
+	}
+
+	queued := make(map[serviceQueueKey]bool)
+	for _, pool := range rsCfg.Pools {
+		key := serviceQueueKey{
+			Namespace:   pool.serviceNamespace(ing.ObjectMeta.Namespace),
+			ServiceName: pool.ServiceName,
+		}
+		if queued[key] {
+			continue
+		}
+		queued[key] = true
+		appMgr.vsQueue.AddAfter(key, appMgr.certManagerTimeout)
+	}
+}
+
+// Stop waiting for a TLS Secret once it exists
+func (appMgr *Manager) certificateIssued(namespace, secretName string) {
+	key := namespace + "/" + secretName
+	appMgr.certWaitsMutex.Lock()
+	defer appMgr.certWaitsMutex.Unlock()
+	if _, ok := appMgr.certWaits[key]; ok {
+		log.Infof("cert-manager issued Secret '%s'.", key)
+		delete(appMgr.certWaits, key)
+	}
+}
+
+// Stop waiting for the TLS Secrets of a deleted Ingress that no other
+// cert-manager Ingress of its namespace uses
+func (appMgr *Manager) stopCertificateWaits(ing *v1beta1.Ingress) {
+	keys, _ := ingressSecretIndexFunc(ing)
+	if 0 == len(keys) {
+		return
+	}
+	appInf, haveInf := appMgr.getNamespaceInformer(ing.ObjectMeta.Namespace)
+	appMgr.certWaitsMutex.Lock()
+	defer appMgr.certWaitsMutex.Unlock()
+	for _, key := range keys {
+		if _, ok := appMgr.certWaits[key]; !ok {
+			continue
+		}
+		used := false
+		if haveInf {
+			objs, _ := appInf.ingInformer.GetIndexer().ByIndex(secretIndex, key)
+			for _, obj := range objs {
+				other := obj.(*v1beta1.Ingress)
+				if other.ObjectMeta.Name != ing.ObjectMeta.Name &&
+					isCertManagerIngress(other) {
+					used = true
+				}
+			}
+		}
+		if !used {
+			delete(appMgr.certWaits, key)
+		}
+	}
+}
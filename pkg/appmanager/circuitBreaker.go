@@ -0,0 +1,81 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Circuit breaker of the pools of an Ingress: a member is marked down after
+// a number of failed health checks within a window, in seconds
+type circuitBreaker struct {
+	Failures int `json:"failures"`
+	Window   int `json:"window"`
+}
+
+func parseCircuitBreaker(val string) (*circuitBreaker, error) {
+	var cb circuitBreaker
+	err := json.Unmarshal([]byte(val), &cb)
+	if nil != err {
+		return nil, err
+	}
+	if cb.Failures < 1 {
+		return nil, fmt.Errorf("failures must be at least 1")
+	}
+	if cb.Window < cb.Failures {
+		return nil, fmt.Errorf("window must be at least %v seconds, one "+
+			"second per failure", cb.Failures)
+	}
+	return &cb, nil
+}
+
+// Interval and timeout of a health monitor marking a member down once the
+// number of failures is reached: the BIG-IP marks a member down when none
+// of the checks within the timeout succeeded.
+func (cb *circuitBreaker) monitorTiming() (int, int) {
+	interval := (cb.Window + cb.Failures - 1) / cb.Failures
+	return interval, interval*cb.Failures + 1
+}
+
+// Tune the health monitors of the pools of a config for the circuit breaker
+// annotation. The monitors come from the health annotation, or from the
+// readiness probes, and the annotation has no effect without them.
+func setCircuitBreaker(
+	cfg *ResourceConfig,
+	annotations map[string]string,
+) error {
+	val, ok := annotations[circuitBreakerAnnotation]
+	if !ok {
+		return nil
+	}
+	cb, err := parseCircuitBreaker(val)
+	if nil != err {
+		return fmt.Errorf("Invalid value '%v' for annotation %v: %v",
+			val, circuitBreakerAnnotation, err)
+	}
+	if 0 == len(cfg.Monitors) {
+		return fmt.Errorf("Annotation %v is ignored, the pools have no "+
+			"health monitors", circuitBreakerAnnotation)
+	}
+	interval, timeout := cb.monitorTiming()
+	for i := range cfg.Monitors {
+		cfg.Monitors[i].Interval = interval
+		cfg.Monitors[i].Timeout = timeout
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+const (
+	clonePoolClientSide = "clientside"
+	clonePoolServerSide = "serverside"
+)
+
+// Parse the clone pools annotation: comma-separated full paths of existing
+// pools, each optionally followed by the side of the traffic it mirrors,
+// like /Common/ids_pool:serverside. The client side is mirrored by default.
+// "none" removes the clone pools.
+func parseClonePools(val string) ([]clonePool, error) {
+	pools := []clonePool{}
+	if "none" == strings.TrimSpace(val) {
+		return pools, nil
+	}
+	for _, entry := range strings.Split(val, ",") {
+		entry = strings.TrimSpace(entry)
+		path, context := entry, clonePoolClientSide
+		if i := strings.LastIndex(entry, ":"); i >= 0 {
+			path, context = entry[:i], entry[i+1:]
+		}
+		if context != clonePoolClientSide && context != clonePoolServerSide {
+			return nil, fmt.Errorf("'%v' is not %v or %v", context,
+				clonePoolClientSide, clonePoolServerSide)
+		}
+		partition, name, ok := splitBigIPPath(path)
+		if !ok {
+			return nil, fmt.Errorf("'%v' is not a full path like "+
+				"/Common/ids_pool", path)
+		}
+		pools = append(pools, clonePool{
+			Name:    fmt.Sprintf("/%s/%s", partition, name),
+			Context: context,
+		})
+	}
+	return pools, nil
+}
+
+// Mirror the traffic of the application to existing pools, such as an IDS
+// or an analytics pool. Like the bandwidth controller policy, the clone
+// pools are set outside of CCCL, and are left alone without the annotation.
+func setVirtualClonePools(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	virtual.ClonePools = nil
+	val, ok := annotations[clonePoolsAnnotation]
+	if !ok {
+		return
+	}
+	pools, err := parseClonePools(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, clonePoolsAnnotation, resourceName, err)
+		return
+	}
+	virtual.ClonePools = &pools
+}
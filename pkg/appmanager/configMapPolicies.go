@@ -0,0 +1,137 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Add the L7 policies defined in a ConfigMap to its virtual server. Policies
+// require an http virtual server, they are ignored for iApps and tcp mode.
+func setConfigMapPolicies(
+	cfg *ResourceConfig,
+	policies []configMapPolicy,
+	namespace string,
+) {
+	if 0 == len(policies) {
+		return
+	}
+	if cfg.Virtual.IApp != "" || cfg.Virtual.Mode != "http" {
+		log.Warningf("Ignoring L7 policies of ConfigMap '%s', they require "+
+			"mode http and are not supported with iApps.",
+			cfg.Virtual.VirtualServerName)
+		return
+	}
+	for _, pol := range policies {
+		strategy := "first-match"
+		if pol.Strategy != "" {
+			strategy = pol.Strategy
+		}
+		var rules Rules
+		for i, rl := range pol.Rules {
+			rule := &Rule{
+				Name:    rl.Name,
+				Ordinal: i,
+				Actions: []*action{
+					createConfigMapAction(cfg, rl.Action, namespace),
+				},
+			}
+			for j, cond := range rl.Conditions {
+				rule.Conditions = append(rule.Conditions,
+					createConfigMapCondition(cond, strconv.Itoa(j)))
+			}
+			rules = append(rules, rule)
+		}
+		policy := createPolicy(rules,
+			fmt.Sprintf("%s_%s", cfg.Virtual.VirtualServerName, pol.Name),
+			cfg.Virtual.Partition)
+		policy.Strategy = fmt.Sprintf("/Common/%s", strategy)
+		cfg.SetPolicy(*policy)
+	}
+}
+
+func createConfigMapCondition(cond configMapCondition, name string) *condition {
+	c := &condition{
+		Name:            name,
+		CaseInsensitive: cond.CaseInsensitive,
+		Request:         true,
+		Values:          cond.Values,
+	}
+	switch cond.Match {
+	case "host":
+		c.HTTPHost = true
+		c.Host = true
+	case "path":
+		c.HTTPURI = true
+		c.Path = true
+	case "header":
+		c.HTTPHeader = true
+		c.TmName = cond.Name
+	}
+	switch cond.Operand {
+	case "startsWith":
+		c.StartsWith = true
+	case "endsWith":
+		c.EndsWith = true
+	case "contains":
+		c.Contains = true
+	default:
+		c.Equals = true
+	}
+	return c
+}
+
+func createConfigMapAction(
+	cfg *ResourceConfig,
+	act configMapAction,
+	namespace string,
+) *action {
+	a := &action{
+		Name:    "0",
+		Request: true,
+	}
+	switch act.Type {
+	case "forward":
+		a.Forward = true
+		a.Pool = configMapPoolPath(cfg, act.Pool, namespace)
+	case "redirect":
+		a.HttpReply = true
+		a.Redirect = true
+		a.Location = act.Location
+	case "drop":
+		a.Forward = true
+		a.Reset = true
+	}
+	return a
+}
+
+// Full path of the pool a ConfigMap policy forwards to. The pool is either
+// the ConfigMap's own, a BIG-IP path, or the name of another ConfigMap in
+// the namespace (which may be a pool-only ConfigMap).
+func configMapPoolPath(cfg *ResourceConfig, pool, namespace string) string {
+	if pool == "" {
+		return cfg.Virtual.PoolName
+	}
+	if strings.HasPrefix(pool, "/") {
+		return pool
+	}
+	return fmt.Sprintf("/%s/%s_%s", cfg.Virtual.Partition, namespace, pool)
+}
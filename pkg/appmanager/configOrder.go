@@ -0,0 +1,110 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"sort"
+)
+
+// The resources are gathered from maps, in no particular order. Sorting
+// them writes the same config for the same resources, so the driver and
+// anything tracking changes of the config only see actual changes.
+func sortPartitionConfig(cfg *BigIPConfig) {
+	sort.Sort(cfg.Virtuals)
+	for i := range cfg.Virtuals {
+		// The profiles may be shared with the stored resource configs
+		profiles := append(ProfileRefs(nil), cfg.Virtuals[i].Profiles...)
+		sort.Sort(profiles)
+		cfg.Virtuals[i].Profiles = profiles
+	}
+	sort.Sort(cfg.Pools)
+	for i := range cfg.Pools {
+		members := append([]Member(nil), cfg.Pools[i].Members...)
+		sort.Sort(membersByAddress(members))
+		cfg.Pools[i].Members = members
+	}
+	sort.Sort(cfg.Monitors)
+	// The rules of a policy, and the policies and iRules of a virtual
+	// server, are applied in order and are left as they are
+	sort.Sort(policiesByName(cfg.Policies))
+	sort.Sort(customProfilesByName(cfg.CustomProfiles))
+	sort.Sort(iRulesByName(cfg.IRules))
+	sort.Sort(dataGroupsByName(cfg.InternalDataGroups))
+	sort.Sort(iAppsByName(cfg.IApps))
+}
+
+type policiesByName []Policy
+
+func (slice policiesByName) Len() int {
+	return len(slice)
+}
+
+func (slice policiesByName) Less(i, j int) bool {
+	return slice[i].Partition < slice[j].Partition ||
+		(slice[i].Partition == slice[j].Partition &&
+			slice[i].Name < slice[j].Name)
+}
+
+func (slice policiesByName) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+type customProfilesByName []CustomProfile
+
+func (slice customProfilesByName) Len() int {
+	return len(slice)
+}
+
+func (slice customProfilesByName) Less(i, j int) bool {
+	return slice[i].Partition < slice[j].Partition ||
+		(slice[i].Partition == slice[j].Partition &&
+			slice[i].Name < slice[j].Name)
+}
+
+func (slice customProfilesByName) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+type iRulesByName []IRule
+
+func (slice iRulesByName) Len() int {
+	return len(slice)
+}
+
+func (slice iRulesByName) Less(i, j int) bool {
+	return slice[i].Partition < slice[j].Partition ||
+		(slice[i].Partition == slice[j].Partition &&
+			slice[i].Name < slice[j].Name)
+}
+
+func (slice iRulesByName) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+type iAppsByName []IApp
+
+func (slice iAppsByName) Len() int {
+	return len(slice)
+}
+
+func (slice iAppsByName) Less(i, j int) bool {
+	return slice[i].Name < slice[j].Name
+}
+
+func (slice iAppsByName) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
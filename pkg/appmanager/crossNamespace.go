@@ -0,0 +1,208 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Namespaces whose Ingresses may reference services of other namespaces,
+// with the namespaces each may reference. A target of "*" allows all.
+// Without any, Ingresses only reference services of their own namespace.
+type crossNamespaceRefs map[string][]string
+
+// Parse the cross-namespace references allowed to Ingresses, each entry of
+// the form source=target[,target...]
+func ParseCrossNamespaceRefs(entries []string) (map[string][]string, error) {
+	refs := make(map[string][]string)
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		source := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || "" == source || "*" == source {
+			return nil, fmt.Errorf("'%s' must be of the form "+
+				"namespace=target[,target...]", entry)
+		}
+		for _, target := range strings.Split(parts[1], ",") {
+			target = strings.TrimSpace(target)
+			if "" == target {
+				return nil, fmt.Errorf("'%s' has an empty target namespace",
+					entry)
+			}
+			refs[source] = append(refs[source], target)
+		}
+	}
+	return refs, nil
+}
+
+// Whether Ingresses of a namespace may reference services of another
+func (refs crossNamespaceRefs) allowed(source, target string) bool {
+	for _, allowed := range refs[source] {
+		if "*" == allowed || target == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Namespaces whose Ingresses may reference services of a namespace
+func (refs crossNamespaceRefs) sources(target string) []string {
+	var sources []string
+	for source := range refs {
+		if source != target && refs.allowed(source, target) {
+			sources = append(sources, source)
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// Parse the service namespaces annotation, a JSON object mapping the names
+// of services to their namespace
+func parseServiceNamespaces(val string) (map[string]string, error) {
+	var refs map[string]string
+	err := json.Unmarshal([]byte(val), &refs)
+	if nil != err {
+		return nil, err
+	}
+	for svcName, ns := range refs {
+		if "" == svcName || "" == ns {
+			return nil, fmt.Errorf("service names and namespaces must not " +
+				"be empty")
+		}
+	}
+	return refs, nil
+}
+
+// Namespaces of the services of an Ingress set by annotation, by service
+// name. References the namespace of the Ingress may not make are ignored.
+func (refs crossNamespaceRefs) ingressServiceNamespaces(
+	ing *v1beta1.Ingress,
+) map[string]string {
+	val, ok := ing.ObjectMeta.Annotations[serviceNamespacesAnnotation]
+	if !ok {
+		return nil
+	}
+	requested, err := parseServiceNamespaces(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, serviceNamespacesAnnotation, ing.ObjectMeta.Name, err)
+		return nil
+	}
+	namespaces := make(map[string]string)
+	for svcName, ns := range requested {
+		if ns == ing.ObjectMeta.Namespace {
+			continue
+		}
+		if !refs.allowed(ing.ObjectMeta.Namespace, ns) {
+			log.Warningf("Ingress '%v/%v' may not reference service '%v' "+
+				"in namespace '%v', using its own namespace.",
+				ing.ObjectMeta.Namespace, ing.ObjectMeta.Name, svcName, ns)
+			continue
+		}
+		namespaces[svcName] = ns
+	}
+	return namespaces
+}
+
+// Namespace of a service an Ingress of namespace ns references
+func backendNamespace(svcNamespaces map[string]string, ns, svcName string) string {
+	if svcNs, ok := svcNamespaces[svcName]; ok {
+		return svcNs
+	}
+	return ns
+}
+
+// Namespace of the service of a pool, that of the resource if unset
+func (pool Pool) serviceNamespace(resourceNamespace string) string {
+	if "" != pool.ServiceNamespace {
+		return pool.ServiceNamespace
+	}
+	return resourceNamespace
+}
+
+// Whether the pool is for the service of a queue key. Pools without a
+// service namespace belong to resources synced with their own namespace.
+func (pool Pool) forService(sKey serviceQueueKey) bool {
+	return pool.ServiceName == sKey.ServiceName &&
+		("" == pool.ServiceNamespace || pool.ServiceNamespace == sKey.Namespace)
+}
+
+// Services of all watched namespaces, looked up in the informer of the
+// namespace of each key. Only lookups by key are supported across
+// namespaces; other methods use the indexer of a single namespace.
+type crossNamespaceServices struct {
+	cache.Indexer
+	appMgr *Manager
+}
+
+func (s crossNamespaceServices) GetByKey(key string) (interface{}, bool, error) {
+	ns := strings.SplitN(key, "/", 2)[0]
+	appInf, ok := s.appMgr.getNamespaceInformer(ns)
+	if !ok {
+		return nil, false, nil
+	}
+	return appInf.svcInformer.GetIndexer().GetByKey(key)
+}
+
+// Indexer of the services an Ingress of a namespace may reference
+func (appMgr *Manager) ingressServiceIndexer(appInf *appInformer) cache.Indexer {
+	if 0 == len(appMgr.crossNsRefs) {
+		return appInf.svcInformer.GetIndexer()
+	}
+	return crossNamespaceServices{
+		Indexer: appInf.svcInformer.GetIndexer(),
+		appMgr:  appMgr,
+	}
+}
+
+// Ingresses of other namespaces that reference services of a namespace
+func (appMgr *Manager) crossNamespaceIngresses(namespace string) []interface{} {
+	var ingresses []interface{}
+	for _, source := range appMgr.crossNsRefs.sources(namespace) {
+		appInf, ok := appMgr.getNamespaceInformer(source)
+		if !ok {
+			continue
+		}
+		objs, err := appInf.ingInformer.GetIndexer().ByIndex(
+			"namespace", source)
+		if nil != err {
+			log.Warningf("Unable to list ingresses for namespace '%v': %v",
+				source, err)
+			continue
+		}
+		for _, obj := range objs {
+			ing := appMgr.ingressWithDefaults(obj.(*v1beta1.Ingress))
+			val := ing.ObjectMeta.Annotations[serviceNamespacesAnnotation]
+			refs, _ := parseServiceNamespaces(val)
+			for _, ns := range refs {
+				if ns == namespace {
+					ingresses = append(ingresses, obj)
+					break
+				}
+			}
+		}
+	}
+	return ingresses
+}
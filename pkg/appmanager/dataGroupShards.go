@@ -0,0 +1,256 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Shard of the server names not starting with a letter or a digit
+const otherHostsShard = "other"
+
+// Shard of a server name, its first character
+func dataGroupShard(host string) string {
+	host = strings.ToLower(host)
+	if "" != host {
+		c := host[0]
+		if ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') {
+			return string(c)
+		}
+	}
+	return otherHostsShard
+}
+
+// Data groups of the server names of passthrough and reencrypt Routes and
+// Ingresses, which grow with the number of hosts, stored by shard of the
+// server names. Each shard has its own lock, so the syncs of namespaces only
+// wait for each other to update the records of the same shard. When
+// sharding, each shard is written as its own data group, so a change to a
+// host only rewrites the records of its shard on the BIG-IP; otherwise the
+// shards are merged when the config is written.
+type hostDataGroups struct {
+	// Protects created
+	mutex sync.Mutex
+	// Data groups written, with or without records
+	created map[nameRef]bool
+	// Shards by name, never changed once created
+	shards map[string]*hostDataGroupShard
+}
+
+type hostDataGroupShard struct {
+	sync.Mutex
+	// Data of the server names of the shard, by data group and namespace
+	hosts map[nameRef]map[string]map[string]string
+}
+
+func newHostDataGroups() *hostDataGroups {
+	hdg := &hostDataGroups{
+		created: make(map[nameRef]bool),
+		shards:  make(map[string]*hostDataGroupShard),
+	}
+	names := []string{otherHostsShard}
+	for c := 'a'; c <= 'z'; c++ {
+		names = append(names, string(c))
+	}
+	for c := '0'; c <= '9'; c++ {
+		names = append(names, string(c))
+	}
+	for _, name := range names {
+		hdg.shards[name] = &hostDataGroupShard{
+			hosts: make(map[nameRef]map[string]map[string]string),
+		}
+	}
+	return hdg
+}
+
+// Create a data group, returning false if it already existed
+func (hdg *hostDataGroups) create(key nameRef) bool {
+	hdg.mutex.Lock()
+	defer hdg.mutex.Unlock()
+	if hdg.created[key] {
+		return false
+	}
+	hdg.created[key] = true
+	return true
+}
+
+func (hdg *hostDataGroups) exists(key nameRef) bool {
+	hdg.mutex.Lock()
+	defer hdg.mutex.Unlock()
+	return hdg.created[key]
+}
+
+// Data groups created, in order
+func (hdg *hostDataGroups) keys() []nameRef {
+	hdg.mutex.Lock()
+	defer hdg.mutex.Unlock()
+	keys := make([]nameRef, 0, len(hdg.created))
+	for key := range hdg.created {
+		keys = append(keys, key)
+	}
+	sort.Sort(nameRefs(keys))
+	return keys
+}
+
+// Replace the server names of a namespace in the data groups given, creating
+// those that get records. Only the shards are locked, one at a time. Returns
+// the data groups that changed.
+func (hdg *hostDataGroups) setNamespace(
+	namespace string,
+	hosts map[nameRef]map[string]string,
+) map[nameRef]bool {
+	byShard := make(map[string]map[nameRef]map[string]string)
+	for key, records := range hosts {
+		if 0 != len(records) {
+			hdg.create(key)
+		}
+		for host, data := range records {
+			shard := dataGroupShard(host)
+			if _, ok := byShard[shard]; !ok {
+				byShard[shard] = make(map[nameRef]map[string]string)
+			}
+			if _, ok := byShard[shard][key]; !ok {
+				byShard[shard][key] = make(map[string]string)
+			}
+			byShard[shard][key][host] = data
+		}
+	}
+
+	changed := make(map[nameRef]bool)
+	for name, shard := range hdg.shards {
+		shard.Lock()
+		for key := range hosts {
+			records := byShard[name][key]
+			if reflect.DeepEqual(shard.hosts[key][namespace], records) ||
+				(0 == len(shard.hosts[key][namespace]) && 0 == len(records)) {
+				continue
+			}
+			changed[key] = true
+			if 0 == len(records) {
+				delete(shard.hosts[key], namespace)
+				if 0 == len(shard.hosts[key]) {
+					delete(shard.hosts, key)
+				}
+				continue
+			}
+			if _, ok := shard.hosts[key]; !ok {
+				shard.hosts[key] = make(map[string]map[string]string)
+			}
+			shard.hosts[key][namespace] = records
+		}
+		shard.Unlock()
+	}
+	return changed
+}
+
+// Whether a namespace has server names in a data group
+func (hdg *hostDataGroups) hasNamespace(key nameRef, namespace string) bool {
+	for _, shard := range hdg.shards {
+		shard.Lock()
+		found := 0 != len(shard.hosts[key][namespace])
+		shard.Unlock()
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// Records of a data group in a shard. When namespaces have the same server
+// name, the last namespace in order wins.
+func (shard *hostDataGroupShard) records(
+	key nameRef,
+	merged map[string]string,
+) {
+	shard.Lock()
+	defer shard.Unlock()
+	for _, ns := range sortedNamespaces(shard.hosts[key]) {
+		for host, data := range shard.hosts[key][ns] {
+			merged[host] = data
+		}
+	}
+}
+
+func dataGroupFromHosts(
+	name, partition string,
+	hosts map[string]string,
+) *InternalDataGroup {
+	dg := NewInternalDataGroup(name, partition)
+	for host, data := range hosts {
+		dg.Records = append(dg.Records,
+			InternalDataGroupRecord{Name: host, Data: data})
+	}
+	sort.Sort(dg.Records)
+	return dg
+}
+
+// A data group merged from its shards
+func (hdg *hostDataGroups) dataGroup(key nameRef) (*InternalDataGroup, bool) {
+	if !hdg.exists(key) {
+		return nil, false
+	}
+	hosts := make(map[string]string)
+	for _, shard := range hdg.shards {
+		shard.records(key, hosts)
+	}
+	return dataGroupFromHosts(key.Name, key.Partition, hosts), true
+}
+
+// Shards of a data group, named after the data group and the shard like
+// ssl_passthrough_servername_dg_a. Shards without records are left out, the
+// iRule checks that they exist.
+func (hdg *hostDataGroups) shardDataGroups(key nameRef) []InternalDataGroup {
+	names := make([]string, 0, len(hdg.shards))
+	for name := range hdg.shards {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var dgs []InternalDataGroup
+	for _, name := range names {
+		hosts := make(map[string]string)
+		hdg.shards[name].records(key, hosts)
+		if 0 == len(hosts) {
+			continue
+		}
+		dgs = append(dgs, *dataGroupFromHosts(
+			key.Name+"_"+name, key.Partition, hosts))
+	}
+	return dgs
+}
+
+// Data groups of server names to write, each merged or split in its shards
+func (hdg *hostDataGroups) dataGroups(sharded bool) []InternalDataGroup {
+	var dgs []InternalDataGroup
+	for _, key := range hdg.keys() {
+		if sharded {
+			dgs = append(dgs, hdg.shardDataGroups(key)...)
+			continue
+		}
+		dg, _ := hdg.dataGroup(key)
+		dgs = append(dgs, *dg)
+	}
+	return dgs
+}
+
+// Passthrough iRule matching the data groups written
+func (appMgr *Manager) passthroughIRule() string {
+	return appMgr.iRuleTemplates.render(sslPassthroughIRuleName,
+		passthroughIRuleParams(appMgr.shardDataGroups))
+}
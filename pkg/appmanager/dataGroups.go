@@ -0,0 +1,92 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// Hash of the records of a data group, whatever their order. Data groups
+// without records, nil or empty, have the same hash.
+func (idg *InternalDataGroup) contentHash() uint64 {
+	records := append(InternalDataGroupRecords{}, idg.Records...)
+	sort.Stable(records)
+	h := fnv.New64a()
+	for _, rec := range records {
+		fmt.Fprintf(h, "%s\x00%s\x00", rec.Name, rec.Data)
+	}
+	return h.Sum64()
+}
+
+// Replace the records of a data group if their contents differ, returning
+// whether the data group changed. The records are stored in order of name,
+// so the data group is written the same way whatever order they were built
+// in.
+func (idg *InternalDataGroup) setRecords(records InternalDataGroupRecords) bool {
+	sorted := append(InternalDataGroupRecords{}, records...)
+	sort.Stable(sorted)
+	if idg.contentHash() == (&InternalDataGroup{Records: sorted}).contentHash() {
+		return false
+	}
+	idg.Records = sorted
+	return true
+}
+
+// Data groups in order of name
+type dataGroupsByName []InternalDataGroup
+
+func (slice dataGroupsByName) Len() int {
+	return len(slice)
+}
+
+func (slice dataGroupsByName) Less(i, j int) bool {
+	return slice[i].Name < slice[j].Name
+}
+
+func (slice dataGroupsByName) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// Names of data groups in order of partition and name
+type nameRefs []nameRef
+
+func (slice nameRefs) Len() int {
+	return len(slice)
+}
+
+func (slice nameRefs) Less(i, j int) bool {
+	return slice[i].Partition < slice[j].Partition ||
+		(slice[i].Partition == slice[j].Partition &&
+			slice[i].Name < slice[j].Name)
+}
+
+func (slice nameRefs) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
+
+// Names of the namespaces of a map, in order, so the records built from
+// them do not depend on the order of the map
+func sortedNamespaces(hosts map[string]map[string]string) []string {
+	namespaces := make([]string, 0, len(hosts))
+	for ns := range hosts {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
@@ -0,0 +1,164 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Name of the client SSL profile of the default TLS Secret. Secret names
+// cannot contain an underscore, so no Ingress profile can collide with it,
+// and Route profiles are prefixed with openshift_route.
+const defaultClientSslProfileName = "cluster_default-client-ssl"
+
+// Watch the default TLS Secret by name, whether its namespace is watched or
+// not, so syncs read it from the cache and a renewed certificate updates
+// its profiles.
+func (appMgr *Manager) newDefaultSslSecretInformer(
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	parts := strings.SplitN(appMgr.defaultSslSecret, "/", 2)
+	informer := cache.NewSharedIndexInformer(
+		cache.NewListWatchFromClient(
+			appMgr.restClientv1,
+			"secrets",
+			parts[0],
+			fields.OneTermEqualSelector("metadata.name", parts[1]),
+		),
+		&v1.Secret{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+	informer.AddEventHandler(
+		&cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				appMgr.updateDefaultClientSslProfiles(obj.(*v1.Secret))
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				appMgr.updateDefaultClientSslProfiles(cur.(*v1.Secret))
+			},
+		},
+	)
+	return informer
+}
+
+// The default TLS Secret, from the cache of its informer
+func (appMgr *Manager) getDefaultSslSecret() (*v1.Secret, error) {
+	if nil == appMgr.defaultSslSecretInformer {
+		return nil, fmt.Errorf("Secret is not watched")
+	}
+	obj, found, err := appMgr.defaultSslSecretInformer.GetIndexer().
+		GetByKey(appMgr.defaultSslSecret)
+	if nil != err {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("Secret not found")
+	}
+	return obj.(*v1.Secret), nil
+}
+
+// Client SSL profile of a default TLS Secret
+func defaultClientSslProfile(secret *v1.Secret, partition string) (
+	CustomProfile,
+	error,
+) {
+	for _, field := range []string{"tls.crt", "tls.key"} {
+		if _, ok := secret.Data[field]; !ok {
+			return CustomProfile{}, fmt.Errorf(
+				"Invalid default TLS Secret '%v': '%v' field not specified.",
+				secret.ObjectMeta.Name, field)
+		}
+	}
+	return CustomProfile{
+		Name:      defaultClientSslProfileName,
+		Partition: partition,
+		Context:   customProfileClient,
+		Cert:      string(secret.Data["tls.crt"]),
+		Key:       string(secret.Data["tls.key"]),
+	}, nil
+}
+
+// Attach the client SSL profile of the default TLS Secret, such as a
+// wildcard certificate of the cluster domain, to a virtual server serving
+// TLS without a certificate of its own. All the virtual servers of a
+// partition share a single profile. Returns whether the stored profile
+// changed, and false if no default Secret is configured.
+func (appMgr *Manager) setDefaultClientSslProfile(
+	rsCfg *ResourceConfig,
+) (bool, bool) {
+	if "" == appMgr.defaultSslSecret {
+		return false, false
+	}
+	secret, err := appMgr.getDefaultSslSecret()
+	if nil != err {
+		log.Warningf("Unable to get the default TLS Secret '%v': %v",
+			appMgr.defaultSslSecret, err)
+		return false, false
+	}
+	cp, err := defaultClientSslProfile(secret, rsCfg.Virtual.Partition)
+	if nil != err {
+		log.Warningf("%v", err)
+		return false, false
+	}
+	appMgr.customProfiles.Lock()
+	updated := appMgr.customProfiles.Add(profileOwner(rsCfg), cp)
+	appMgr.customProfiles.Unlock()
+	rsCfg.Virtual.AddFrontendSslProfileName(
+		rsCfg.Virtual.Partition + "/" + defaultClientSslProfileName)
+	return updated, true
+}
+
+// Update the profiles of the default TLS Secret when it changes, so a
+// renewed certificate is used without waiting for the next sync of their
+// virtual servers
+func (appMgr *Manager) updateDefaultClientSslProfiles(secret *v1.Secret) {
+	if appMgr.defaultSslSecret !=
+		secret.ObjectMeta.Namespace+"/"+secret.ObjectMeta.Name {
+		return
+	}
+	appMgr.customProfiles.Lock()
+	updated := false
+	for key, prof := range appMgr.customProfiles.profs {
+		if defaultClientSslProfileName != key.Name {
+			continue
+		}
+		cp, err := defaultClientSslProfile(secret, key.Partition)
+		if nil != err {
+			log.Warningf("%v", err)
+			break
+		}
+		if cp.Cert != prof.Cert || cp.Key != prof.Key {
+			appMgr.customProfiles.profs[key] = cp
+			updated = true
+		}
+	}
+	appMgr.customProfiles.Unlock()
+	if updated {
+		log.Infof("Updated the client SSL profiles of the default TLS "+
+			"Secret '%v'", appMgr.defaultSslSecret)
+		appMgr.outputConfig()
+	}
+}
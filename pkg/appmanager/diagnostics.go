@@ -0,0 +1,194 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Number of sync errors kept for the diagnostics bundle
+const maxSyncErrors = 50
+
+// Replaces private keys in the diagnostics bundle
+const redactedValue = "REDACTED"
+
+// Number of pending keys of each work queue written to the diagnostics
+// bundle
+const maxDiagnosticsQueueKeys = 1000
+
+type syncError struct {
+	Time  time.Time `json:"time"`
+	Key   string    `json:"key"`
+	Error string    `json:"error"`
+}
+
+// Remember a failed sync, dropping the oldest once the limit is reached
+func (appMgr *Manager) recordSyncError(key serviceQueueKey, err error) {
+	appMgr.syncErrorsMutex.Lock()
+	defer appMgr.syncErrorsMutex.Unlock()
+	appMgr.syncErrors = append(appMgr.syncErrors, syncError{
+		Time:  time.Now(),
+		Key:   fmt.Sprintf("%s/%s", key.Namespace, key.ServiceName),
+		Error: err.Error(),
+	})
+	if len(appMgr.syncErrors) > maxSyncErrors {
+		appMgr.syncErrors = appMgr.syncErrors[len(appMgr.syncErrors)-maxSyncErrors:]
+	}
+}
+
+// Write a gzipped tarball describing the controller's current state for
+// support cases. The info map is written as version.json and should hold
+// version and (sanitized) startup settings. Private keys are redacted.
+func (appMgr *Manager) WriteDiagnosticsBundle(
+	w io.Writer,
+	info map[string]string,
+) error {
+	files := make(map[string]interface{})
+	files["version.json"] = info
+
+	appMgr.resources.Lock()
+	snapshot := appMgr.resources.Snapshot()
+	appMgr.resources.Unlock()
+	var rsCfgs []ResourceConfig
+	snapshot.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		rsCfgs = append(rsCfgs, *cfg)
+	})
+	files["resources.json"] = rsCfgs
+
+	appMgr.outputMutex.Lock()
+	config := PartitionMap{}
+	for partition, cfg := range appMgr.lastResources {
+		cfgCopy := *cfg
+		cfgCopy.CustomProfiles = redactProfiles(cfg.CustomProfiles)
+		config[partition] = &cfgCopy
+	}
+	appMgr.outputMutex.Unlock()
+	files["config.json"] = config
+
+	appMgr.customProfiles.Lock()
+	var profs []CustomProfile
+	for _, prof := range appMgr.customProfiles.profs {
+		profs = append(profs, prof)
+	}
+	appMgr.customProfiles.Unlock()
+	files["profiles.json"] = redactProfiles(profs)
+
+	files["informers.json"] = appMgr.informerCacheKeys()
+	files["queues.json"] = map[string]queueState{
+		"virtualServers": newQueueState(appMgr.vsQueue),
+		"namespaces":     newQueueState(appMgr.nsQueue),
+		"statusUpdates":  newQueueState(appMgr.statusQueue),
+	}
+
+	appMgr.syncErrorsMutex.Lock()
+	files["sync_errors.json"] = append([]syncError{}, appMgr.syncErrors...)
+	appMgr.syncErrorsMutex.Unlock()
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	var names []string
+	for name, _ := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	now := time.Now()
+	for _, name := range names {
+		data, err := json.MarshalIndent(files[name], "", "  ")
+		if nil != err {
+			return fmt.Errorf("failed to marshal %s: %v", name, err)
+		}
+		hdr := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}
+		if err = tw.WriteHeader(hdr); nil != err {
+			return err
+		}
+		if _, err = tw.Write(data); nil != err {
+			return err
+		}
+	}
+	if err := tw.Close(); nil != err {
+		return err
+	}
+	return gz.Close()
+}
+
+// Length and pending keys of a work queue
+type queueState struct {
+	Length  int      `json:"length"`
+	Pending []string `json:"pending"`
+}
+
+func newQueueState(queue workqueue.RateLimitingInterface) queueState {
+	state := queueState{Length: queue.Len()}
+	if q, ok := queue.(*monitoredQueue); ok {
+		state.Pending = q.pendingKeys(maxDiagnosticsQueueKeys)
+	}
+	return state
+}
+
+// Copy profiles with their private keys removed
+func redactProfiles(profs []CustomProfile) []CustomProfile {
+	redacted := make([]CustomProfile, len(profs))
+	for i, prof := range profs {
+		if "" != prof.Key {
+			prof.Key = redactedValue
+		}
+		redacted[i] = prof
+	}
+	return redacted
+}
+
+// Sorted cache keys of each informer, per namespace
+func (appMgr *Manager) informerCacheKeys() map[string]map[string][]string {
+	appMgr.informersMutex.Lock()
+	defer appMgr.informersMutex.Unlock()
+	keys := make(map[string]map[string][]string)
+	for ns, appInf := range appMgr.appInformers {
+		infs := map[string]cache.SharedIndexInformer{
+			"configmaps": appInf.cfgMapInformer,
+			"services":   appInf.svcInformer,
+			"endpoints":  appInf.endptInformer,
+			"ingresses":  appInf.ingInformer,
+			"routes":     appInf.routeInformer,
+			"secrets":    appInf.secretInformer,
+		}
+		nsKeys := make(map[string][]string)
+		for kind, inf := range infs {
+			if nil == inf {
+				continue
+			}
+			list := inf.GetStore().ListKeys()
+			sort.Strings(list)
+			nsKeys[kind] = list
+		}
+		keys[ns] = nsKeys
+	}
+	return keys
+}
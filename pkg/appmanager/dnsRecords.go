@@ -0,0 +1,64 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Receives the host names served by the active virtual servers, with the
+// virtual address of each, every time the config is written
+type DNSPublisher interface {
+	Publish(records map[string]string)
+}
+
+// Add the host names a virtual server matches in its policies. A virtual
+// server without any pool members is not healthy and its names are left
+// out, so DNS can fail over to another cluster.
+func addDNSRecords(records map[string]string, cfg *ResourceConfig) {
+	addr := cfg.Virtual.VirtualAddress.BindAddr
+	healthy := false
+	for _, pool := range cfg.Pools {
+		if 0 != len(pool.Members) {
+			healthy = true
+			break
+		}
+	}
+	if !healthy {
+		return
+	}
+	for _, policy := range cfg.Policies {
+		for _, rule := range policy.Rules {
+			for _, cond := range rule.Conditions {
+				if !cond.HTTPHost || !cond.Host || !cond.Equals {
+					continue
+				}
+				for _, host := range cond.Values {
+					if current, found := records[host]; found && current != addr {
+						// Keep the choice stable between writes
+						log.Debugf("Host '%s' is served by %s and %s, publishing "+
+							"the first.", host, current, addr)
+						if current < addr {
+							continue
+						}
+					}
+					records[host] = addr
+				}
+			}
+		}
+	}
+}
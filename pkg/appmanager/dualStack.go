@@ -0,0 +1,89 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"net"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Suffix of the name of the IPv6 virtual server of a dual-stack pair
+const ipv6VirtualSuffix = "_ipv6"
+
+// Whether an address is an IPv6 address
+func isIPv6(addr string) bool {
+	ip := net.ParseIP(addr)
+	return nil != ip && nil == ip.To4()
+}
+
+// Set the IPv6 address of a dual-stack virtual server from its annotation,
+// unless a ConfigMap already sets bindAddrV6
+func setVirtualIPv6Address(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	if nil == virtual.VirtualAddress ||
+		"" != virtual.VirtualAddress.BindAddrV6 {
+		return
+	}
+	if addr, ok := annotations[ipv6AddrAnnotation]; ok {
+		if !isIPv6(addr) {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v': "+
+				"must be an IPv6 address", addr, ipv6AddrAnnotation,
+				resourceName)
+			return
+		}
+		virtual.VirtualAddress.BindAddrV6 = addr
+	}
+}
+
+// Destination of a virtual server listening on an address and port
+func virtualDestination(partition, addr string, port int32) string {
+	format := "/%s/%s:%d"
+	if isIPv6(addr) {
+		format = "/%s/%s.%d"
+	}
+	return fmt.Sprintf(format, partition, addr, port)
+}
+
+// Configs of the virtual servers of a config: itself and, for dual-stack
+// virtual servers with an IPv4 address and an IPv6 address, a copy listening
+// on the IPv6 address. The copy shares the pools, policies and profiles of
+// the virtual server, so clients of both families reach the same
+// application.
+func dualStackConfigs(cfg *ResourceConfig) []*ResourceConfig {
+	va := cfg.Virtual.VirtualAddress
+	if "" == va.BindAddrV6 {
+		return []*ResourceConfig{cfg}
+	}
+	if ip := net.ParseIP(va.BindAddr); nil == ip || nil == ip.To4() {
+		log.Debugf("Virtual server %v has no IPv4 address, not creating "+
+			"its IPv6 virtual server", cfg.Virtual.VirtualServerName)
+		return []*ResourceConfig{cfg}
+	}
+	pair := *cfg
+	pair.Virtual = cfg.Virtual.copy()
+	pair.Virtual.VirtualServerName += ipv6VirtualSuffix
+	pair.Virtual.VirtualAddress = &virtualAddress{
+		BindAddr: va.BindAddrV6,
+		Port:     va.Port,
+	}
+	return []*ResourceConfig{cfg, &pair}
+}
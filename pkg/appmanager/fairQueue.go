@@ -0,0 +1,255 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Rate limited work queue that serves the namespaces of its keys in turn,
+// so a namespace with a flood of changes cannot starve the others. Each
+// namespace has its own FIFO of keys; Get takes the next key of the first
+// namespace in line and puts the namespace back at the end of the line if it
+// has more. Like the workqueue of client-go, a key is only queued once and
+// is never processed by two workers at the same time.
+type fairQueue struct {
+	name        string
+	namespaceOf func(interface{}) string
+	rateLimiter workqueue.RateLimiter
+
+	mutex *sync.Mutex
+	cond  *sync.Cond
+	// Keys waiting for a worker, by namespace
+	queues map[string][]interface{}
+	// Namespaces with waiting keys, in the order they are served
+	line []string
+	// Number of keys waiting for a worker
+	length int
+	// Keys to process, waiting or being processed, and the time they were
+	// added at
+	dirty      map[interface{}]time.Time
+	processing map[interface{}]time.Time
+	// Time each delayed key is added at
+	waiting      map[interface{}]time.Time
+	shuttingDown bool
+
+	metrics *fairQueueMetrics
+}
+
+// Metrics of the queue, the same as the ones of the client-go workqueues
+type fairQueueMetrics struct {
+	depth        workqueue.GaugeMetric
+	adds         workqueue.CounterMetric
+	latency      workqueue.SummaryMetric
+	workDuration workqueue.SummaryMetric
+	retries      workqueue.CounterMetric
+}
+
+// Set by EnableQueueMetrics, for the queues created afterwards
+var fairQueueMetricsEnabled bool
+
+func newFairQueue(
+	rateLimiter workqueue.RateLimiter,
+	name string,
+	namespaceOf func(interface{}) string,
+) *fairQueue {
+	mutex := &sync.Mutex{}
+	q := &fairQueue{
+		name:        name,
+		namespaceOf: namespaceOf,
+		rateLimiter: rateLimiter,
+		mutex:       mutex,
+		cond:        sync.NewCond(mutex),
+		queues:      make(map[string][]interface{}),
+		dirty:       make(map[interface{}]time.Time),
+		processing:  make(map[interface{}]time.Time),
+		waiting:     make(map[interface{}]time.Time),
+	}
+	if fairQueueMetricsEnabled {
+		var provider queueMetricsProvider
+		q.metrics = &fairQueueMetrics{
+			depth:        provider.NewDepthMetric(name),
+			adds:         provider.NewAddsMetric(name),
+			latency:      provider.NewLatencyMetric(name),
+			workDuration: provider.NewWorkDurationMetric(name),
+			retries:      provider.NewRetriesMetric(name),
+		}
+	}
+	return q
+}
+
+// Namespace of the keys of the virtual server queue
+func serviceKeyNamespace(item interface{}) string {
+	if key, ok := item.(serviceQueueKey); ok {
+		return key.Namespace
+	}
+	return ""
+}
+
+// Put a key in the line of its namespace. Must be called with the lock held.
+func (q *fairQueue) push(item interface{}) {
+	ns := q.namespaceOf(item)
+	if 0 == len(q.queues[ns]) {
+		q.line = append(q.line, ns)
+	}
+	q.queues[ns] = append(q.queues[ns], item)
+	q.length++
+	if nil != q.metrics {
+		q.metrics.depth.Inc()
+	}
+	q.cond.Signal()
+}
+
+func (q *fairQueue) Add(item interface{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	if _, ok := q.dirty[item]; ok {
+		return
+	}
+	if nil != q.metrics {
+		q.metrics.adds.Inc()
+	}
+	q.dirty[item] = time.Now()
+	if _, ok := q.processing[item]; ok {
+		// Queued again once processed
+		return
+	}
+	q.push(item)
+}
+
+// Add a key once the delay has passed. A key already delayed is added at
+// the earliest of the two times, so the changes made meanwhile are
+// coalesced into one sync.
+func (q *fairQueue) AddAfter(item interface{}, duration time.Duration) {
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.shuttingDown {
+		return
+	}
+	readyAt := time.Now().Add(duration)
+	if at, ok := q.waiting[item]; ok && !at.After(readyAt) {
+		return
+	}
+	q.waiting[item] = readyAt
+	time.AfterFunc(duration, func() {
+		q.mutex.Lock()
+		if at, ok := q.waiting[item]; !ok || !at.Equal(readyAt) {
+			// Added earlier by another delay
+			q.mutex.Unlock()
+			return
+		}
+		delete(q.waiting, item)
+		q.mutex.Unlock()
+		q.Add(item)
+	})
+}
+
+// Add a key again after a failed sync, once its backoff has passed. Only
+// these adds count as retries, not the delays of the other adds.
+func (q *fairQueue) AddRateLimited(item interface{}) {
+	q.mutex.Lock()
+	if nil != q.metrics && !q.shuttingDown {
+		q.metrics.retries.Inc()
+	}
+	q.mutex.Unlock()
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+func (q *fairQueue) Forget(item interface{}) {
+	q.rateLimiter.Forget(item)
+}
+
+func (q *fairQueue) NumRequeues(item interface{}) int {
+	return q.rateLimiter.NumRequeues(item)
+}
+
+// Block until a key is waiting and return the next key of the first
+// namespace in line
+func (q *fairQueue) Get() (interface{}, bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for 0 == len(q.line) && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if 0 == len(q.line) {
+		// The queue is shut down and empty
+		return nil, true
+	}
+	ns := q.line[0]
+	q.line = q.line[1:]
+	item := q.queues[ns][0]
+	q.queues[ns] = q.queues[ns][1:]
+	if 0 != len(q.queues[ns]) {
+		q.line = append(q.line, ns)
+	} else {
+		delete(q.queues, ns)
+	}
+	q.length--
+
+	if nil != q.metrics {
+		q.metrics.depth.Dec()
+		q.metrics.latency.Observe(
+			float64(time.Since(q.dirty[item]) / time.Microsecond))
+	}
+	q.processing[item] = time.Now()
+	delete(q.dirty, item)
+	return item, false
+}
+
+func (q *fairQueue) Done(item interface{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if nil != q.metrics {
+		if start, ok := q.processing[item]; ok {
+			q.metrics.workDuration.Observe(
+				float64(time.Since(start) / time.Microsecond))
+		}
+	}
+	delete(q.processing, item)
+	if _, ok := q.dirty[item]; ok {
+		q.push(item)
+	}
+}
+
+func (q *fairQueue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.length
+}
+
+func (q *fairQueue) ShutDown() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.shuttingDown = true
+	q.cond.Broadcast()
+}
+
+func (q *fairQueue) ShuttingDown() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.shuttingDown
+}
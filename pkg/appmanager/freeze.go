@@ -0,0 +1,177 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// During a change freeze the resources are still synced, but the config is
+// not written to the BIG-IP. The services whose configs changed meanwhile
+// are kept to record Events on them.
+type changeFreeze struct {
+	sync.Mutex
+	frozen   bool
+	since    time.Time
+	deferred map[serviceQueueKey]bool
+}
+
+func newChangeFreeze(frozen bool) *changeFreeze {
+	cf := &changeFreeze{
+		frozen:   frozen,
+		deferred: make(map[serviceQueueKey]bool),
+	}
+	if frozen {
+		cf.since = time.Now()
+	}
+	return cf
+}
+
+// State of the change freeze, as returned by the freeze endpoint
+type freezeStatus struct {
+	Frozen           bool       `json:"frozen"`
+	Since            *time.Time `json:"since,omitempty"`
+	DeferredServices []string   `json:"deferredServices"`
+}
+
+func (appMgr *Manager) Frozen() bool {
+	appMgr.freeze.Lock()
+	defer appMgr.freeze.Unlock()
+	return appMgr.freeze.frozen
+}
+
+// Stop writing the config to the BIG-IP until Unfreeze is called
+func (appMgr *Manager) Freeze() {
+	appMgr.freeze.Lock()
+	defer appMgr.freeze.Unlock()
+	if appMgr.freeze.frozen {
+		return
+	}
+	log.Infof("Change freeze started, BIG-IP config changes are deferred.")
+	appMgr.freeze.frozen = true
+	appMgr.freeze.since = time.Now()
+}
+
+// End the change freeze and write the current config, which includes all
+// the changes deferred during the freeze
+func (appMgr *Manager) Unfreeze() {
+	appMgr.freeze.Lock()
+	if !appMgr.freeze.frozen {
+		appMgr.freeze.Unlock()
+		return
+	}
+	deferred := appMgr.freeze.deferred
+	log.Infof("Change freeze ended after %v, applying the changes of %v "+
+		"services.", time.Since(appMgr.freeze.since), len(deferred))
+	appMgr.freeze.frozen = false
+	appMgr.freeze.since = time.Time{}
+	appMgr.freeze.deferred = make(map[serviceQueueKey]bool)
+	appMgr.freeze.Unlock()
+
+	appMgr.outputConfig()
+	for sKey, _ := range deferred {
+		appMgr.recordServiceEvent(sKey, v1.EventTypeNormal,
+			"DeferredChangeApplied", "BIG-IP configuration changes deferred "+
+				"by the change freeze were applied.")
+	}
+}
+
+// Note that the changes of a service are not written to the BIG-IP. An
+// Event is recorded on the service the first time in each freeze.
+func (appMgr *Manager) deferChanges(sKey serviceQueueKey, appInf *appInformer) {
+	// Changes are deferred per service, whatever resource was synced
+	sKey = serviceQueueKey{Namespace: sKey.Namespace, ServiceName: sKey.ServiceName}
+	appMgr.freeze.Lock()
+	if !appMgr.freeze.frozen || appMgr.freeze.deferred[sKey] {
+		appMgr.freeze.Unlock()
+		return
+	}
+	appMgr.freeze.deferred[sKey] = true
+	appMgr.freeze.Unlock()
+
+	log.Infof("Deferring the BIG-IP config changes of service %v/%v "+
+		"during the change freeze.", sKey.Namespace, sKey.ServiceName)
+	appMgr.recordServiceEvent(sKey, v1.EventTypeNormal, "ChangeDeferred",
+		"BIG-IP configuration changes are deferred until the end of the "+
+			"change freeze.")
+}
+
+// Record an Event on a service, if it still exists
+func (appMgr *Manager) recordServiceEvent(
+	sKey serviceQueueKey,
+	eventType, reason, message string,
+) {
+	appInf, ok := appMgr.getNamespaceInformer(sKey.Namespace)
+	if !ok {
+		return
+	}
+	obj, found, err := appInf.svcInformer.GetIndexer().GetByKey(
+		sKey.Namespace + "/" + sKey.ServiceName)
+	if nil != err || !found {
+		return
+	}
+	appMgr.eventRecorder.Event(obj.(*v1.Service), eventType, reason, message)
+}
+
+func (appMgr *Manager) freezeStatus() freezeStatus {
+	appMgr.freeze.Lock()
+	defer appMgr.freeze.Unlock()
+	status := freezeStatus{
+		Frozen:           appMgr.freeze.frozen,
+		DeferredServices: []string{},
+	}
+	if appMgr.freeze.frozen {
+		since := appMgr.freeze.since
+		status.Since = &since
+	}
+	for sKey, _ := range appMgr.freeze.deferred {
+		status.DeferredServices = append(status.DeferredServices,
+			sKey.Namespace+"/"+sKey.ServiceName)
+	}
+	sort.Strings(status.DeferredServices)
+	return status
+}
+
+// Handler to declare change freezes: PUT or POST starts a freeze, DELETE
+// ends it and applies the deferred changes. All methods return the state of
+// the freeze as JSON.
+func (appMgr *Manager) FreezeHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+		case "PUT", "POST":
+			appMgr.Freeze()
+		case "DELETE":
+			appMgr.Unfreeze()
+		default:
+			http.Error(w, fmt.Sprintf("Method %v not allowed", r.Method),
+				http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(appMgr.freezeStatus())
+	})
+}
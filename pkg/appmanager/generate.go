@@ -0,0 +1,85 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Config generation from single resources, without a Manager. These are the
+// entry points of the configgen package, which documents their use. They
+// build for the partitions passed and leave those of the controller, set by
+// SetPartitions, alone.
+
+// Generate the config of the virtual server or iApp of a ConfigMap
+func ConfigMapConfig(
+	partitions Partitions,
+	cm *v1.ConfigMap,
+) (*ResourceConfig, error) {
+	return buildConfigMapData(partitions, cm, configMapDataKey)
+}
+
+// Generate the configs of the virtual servers of an Ingress, one per port.
+// The services resolve the named service ports of the backends. Returns
+// nil if the Ingress is of another class.
+func IngressConfigs(
+	partitions Partitions,
+	ing *v1beta1.Ingress,
+	services []*v1.Service,
+) []*ResourceConfig {
+	svcIndexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc,
+		cache.Indexers{})
+	for _, svc := range services {
+		svcIndexer.Add(svc)
+	}
+	var cfgs []*ResourceConfig
+	for _, ps := range ingressVirtualPorts(ing, ing.ObjectMeta.Annotations) {
+		cfg := buildIngressConfig(partitions, ing, ing.ObjectMeta.Namespace,
+			nil, svcIndexer, ps)
+		if nil == cfg {
+			return nil
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs
+}
+
+// Generate the configs of the virtual servers of a Route, with the Route
+// alone in them. The controller merges the Routes of all namespaces into
+// these virtual servers.
+func RouteConfigs(
+	partitions Partitions,
+	route *routeapi.Route,
+	routeConfig RouteConfig,
+) ([]*ResourceConfig, error) {
+	pStructs := []portStruct{{protocol: "http", port: DEFAULT_HTTP_PORT},
+		{protocol: "https", port: DEFAULT_HTTPS_PORT}}
+	pStructs = append(pStructs, routeExtraPorts(route)...)
+	var cfgs []*ResourceConfig
+	for _, ps := range pStructs {
+		cfg, err := buildRouteConfig(partitions, route, NewResources(),
+			routeConfig, ps)
+		if nil != err {
+			return nil, err
+		}
+		cfgs = append(cfgs, &cfg)
+	}
+	return cfgs, nil
+}
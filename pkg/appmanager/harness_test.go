@@ -0,0 +1,251 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"sync"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// harness drives a Manager with informer events for integration-style
+// tests, without a cluster. The informers are never started: each event
+// updates the informer store and is passed to the event handlers the
+// informers are given, then the keys they queue are synced as the vs worker
+// would, so the config written to the ConfigWriter of the Params (such as
+// test.FakeBigIP) can be checked as soon as the call returns. The Params
+// need a KubeClient, such as the fake clientset of client-go, for the
+// status updates.
+type harness struct {
+	appMgr *Manager
+	mutex  sync.Mutex
+}
+
+// Create a harness watching the given namespaces, with the ConfigMaps
+// selected by DefaultConfigMapLabel
+func newHarness(params *Params, namespaces ...string) (*harness, error) {
+	h := &harness{appMgr: NewManager(params)}
+	ls, err := labels.Parse(DefaultConfigMapLabel)
+	if nil != err {
+		return nil, err
+	}
+	for _, ns := range namespaces {
+		err = h.appMgr.AddNamespace(ns, ls, 0)
+		if nil != err {
+			return nil, fmt.Errorf(
+				"Failed to add informers for namespace %v: %v", ns, err)
+		}
+	}
+	return h, nil
+}
+
+func (h *harness) shutdown() {
+	h.appMgr.stopAppInformers()
+}
+
+// Informer of a kind of resource: its store and its event handlers
+type harnessInformer struct {
+	store    func(*appInformer) cache.Store
+	handlers func(*Manager) cache.ResourceEventHandlerFuncs
+}
+
+var (
+	cfgMapHarness = harnessInformer{
+		store: func(appInf *appInformer) cache.Store {
+			return appInf.cfgMapInformer.GetStore()
+		},
+		handlers: (*Manager).cfgMapEventHandlers,
+	}
+	svcHarness = harnessInformer{
+		store: func(appInf *appInformer) cache.Store {
+			return appInf.svcInformer.GetStore()
+		},
+		handlers: (*Manager).svcEventHandlers,
+	}
+	endptHarness = harnessInformer{
+		store: func(appInf *appInformer) cache.Store {
+			return appInf.endptInformer.GetStore()
+		},
+		handlers: (*Manager).endptEventHandlers,
+	}
+	ingHarness = harnessInformer{
+		store: func(appInf *appInformer) cache.Store {
+			return appInf.ingInformer.GetStore()
+		},
+		handlers: (*Manager).ingEventHandlers,
+	}
+	routeHarness = harnessInformer{
+		store: func(appInf *appInformer) cache.Store {
+			return appInf.routeInformer.GetStore()
+		},
+		handlers: (*Manager).routeEventHandlers,
+	}
+)
+
+type harnessEvent int
+
+const (
+	harnessAdd harnessEvent = iota
+	harnessUpdate
+	harnessDelete
+)
+
+// Apply an event to the store of an informer of the namespace of the
+// object, pass it to the event handlers and sync the keys they queued
+func (h *harness) apply(
+	inf harnessInformer,
+	event harnessEvent,
+	obj interface{},
+) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	objMeta, err := meta.Accessor(obj)
+	if nil != err {
+		return err
+	}
+	appInf, found := h.appMgr.getNamespaceInformer(objMeta.GetNamespace())
+	if !found {
+		return fmt.Errorf("Namespace %v is not watched",
+			objMeta.GetNamespace())
+	}
+	store := inf.store(appInf)
+	handlers := inf.handlers(h.appMgr)
+	switch event {
+	case harnessAdd:
+		err = store.Add(obj)
+		if nil == err {
+			handlers.OnAdd(obj)
+		}
+	case harnessUpdate:
+		var old interface{}
+		var exists bool
+		old, exists, err = store.Get(obj)
+		if nil == err {
+			err = store.Update(obj)
+		}
+		if nil == err && exists {
+			handlers.OnUpdate(old, obj)
+		} else if nil == err {
+			handlers.OnAdd(obj)
+		}
+	case harnessDelete:
+		err = store.Delete(obj)
+		if nil == err {
+			handlers.OnDelete(obj)
+		}
+	}
+	if nil != err {
+		return err
+	}
+	return h.syncQueued()
+}
+
+// Sync the keys queued by the event handlers, returning the first error
+func (h *harness) syncQueued() error {
+	var syncErr error
+	for 0 != h.appMgr.vsQueue.Len() {
+		key, quit := h.appMgr.vsQueue.Get()
+		if quit {
+			break
+		}
+		err := h.appMgr.syncVirtualServer(key.(serviceQueueKey))
+		h.appMgr.vsQueue.Forget(key)
+		h.appMgr.vsQueue.Done(key)
+		if nil != err && nil == syncErr {
+			syncErr = err
+		}
+	}
+	return syncErr
+}
+
+func (h *harness) addConfigMap(cm *v1.ConfigMap) error {
+	return h.apply(cfgMapHarness, harnessAdd, cm)
+}
+
+func (h *harness) updateConfigMap(cm *v1.ConfigMap) error {
+	return h.apply(cfgMapHarness, harnessUpdate, cm)
+}
+
+func (h *harness) deleteConfigMap(cm *v1.ConfigMap) error {
+	return h.apply(cfgMapHarness, harnessDelete, cm)
+}
+
+func (h *harness) addService(svc *v1.Service) error {
+	return h.apply(svcHarness, harnessAdd, svc)
+}
+
+func (h *harness) updateService(svc *v1.Service) error {
+	return h.apply(svcHarness, harnessUpdate, svc)
+}
+
+func (h *harness) deleteService(svc *v1.Service) error {
+	return h.apply(svcHarness, harnessDelete, svc)
+}
+
+func (h *harness) addEndpoints(ep *v1.Endpoints) error {
+	return h.apply(endptHarness, harnessAdd, ep)
+}
+
+func (h *harness) updateEndpoints(ep *v1.Endpoints) error {
+	return h.apply(endptHarness, harnessUpdate, ep)
+}
+
+func (h *harness) deleteEndpoints(ep *v1.Endpoints) error {
+	return h.apply(endptHarness, harnessDelete, ep)
+}
+
+func (h *harness) addIngress(ing *v1beta1.Ingress) error {
+	return h.apply(ingHarness, harnessAdd, ing)
+}
+
+func (h *harness) updateIngress(ing *v1beta1.Ingress) error {
+	return h.apply(ingHarness, harnessUpdate, ing)
+}
+
+func (h *harness) deleteIngress(ing *v1beta1.Ingress) error {
+	return h.apply(ingHarness, harnessDelete, ing)
+}
+
+func (h *harness) route(route *routeapi.Route, event harnessEvent) error {
+	if nil == h.appMgr.routeClientV1 {
+		return fmt.Errorf("Routes are not watched without a RouteClientV1")
+	}
+	return h.apply(routeHarness, event, route)
+}
+
+func (h *harness) addRoute(route *routeapi.Route) error {
+	return h.route(route, harnessAdd)
+}
+
+func (h *harness) updateRoute(route *routeapi.Route) error {
+	return h.route(route, harnessUpdate)
+}
+
+func (h *harness) deleteRoute(route *routeapi.Route) error {
+	return h.route(route, harnessDelete)
+}
+
+// Pass a list of nodes to the Manager, as the node poller would
+func (h *harness) updateNodes(nodes []v1.Node) {
+	h.appMgr.ProcessNodeUpdate(nodes, nil)
+}
@@ -0,0 +1,131 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+const defaultHostRedirectCode = 301
+
+// Parse the host redirects annotation, a JSON object mapping alternate host
+// names to their canonical host name. Host names are compared lower case.
+func parseHostRedirects(val string) (map[string]string, error) {
+	var redirects map[string]string
+	err := json.Unmarshal([]byte(val), &redirects)
+	if nil != err {
+		return nil, err
+	}
+	if 0 == len(redirects) {
+		return nil, fmt.Errorf("no hosts to redirect")
+	}
+	result := make(map[string]string, len(redirects))
+	for from, to := range redirects {
+		from = strings.ToLower(strings.TrimSpace(from))
+		to = strings.ToLower(strings.TrimSpace(to))
+		if "" == from || "" == to {
+			return nil, fmt.Errorf("host names must not be empty")
+		}
+		if strings.ContainsAny(from+to, "/ ") {
+			return nil, fmt.Errorf(
+				"'%s' -> '%s' is not a pair of host names", from, to)
+		}
+		if from == to {
+			return nil, fmt.Errorf("host '%s' redirects to itself", from)
+		}
+		result[from] = to
+	}
+	return result, nil
+}
+
+// Parse the status code annotation of host redirects
+func parseHostRedirectCode(val string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(val))
+	if nil != err {
+		return 0, err
+	}
+	switch code {
+	case 301, 302, 303, 307, 308:
+		return code, nil
+	}
+	return 0, fmt.Errorf("must be one of 301, 302, 303, 307, 308")
+}
+
+// Requests for the alternate hosts of a virtual server are answered with a
+// redirect to the same URI on the canonical host, so domains can be
+// canonicalized without a custom iRule. The redirects are looked up by the
+// host redirect iRule in its data group, which is filled from the MetaData
+// when the config is written.
+func setVirtualHostRedirects(
+	cfg *ResourceConfig,
+	annotations map[string]string,
+	resourceName string,
+	partition string,
+) {
+	cfg.MetaData.HostRedirects = nil
+	cfg.MetaData.HostRedirectCode = defaultHostRedirectCode
+	val, ok := annotations[hostRedirectsAnnotation]
+	if !ok {
+		if _, ok := annotations[hostRedirectCodeAnnotation]; ok {
+			log.Warningf("Annotation %v on '%v' is ignored without %v",
+				hostRedirectCodeAnnotation, resourceName,
+				hostRedirectsAnnotation)
+		}
+		return
+	}
+	redirects, err := parseHostRedirects(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, hostRedirectsAnnotation, resourceName, err)
+		return
+	}
+	if codeVal, ok := annotations[hostRedirectCodeAnnotation]; ok {
+		code, err := parseHostRedirectCode(codeVal)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"using %d: %v", codeVal, hostRedirectCodeAnnotation,
+				resourceName, defaultHostRedirectCode, err)
+		} else {
+			cfg.MetaData.HostRedirectCode = code
+		}
+	}
+	if strings.ToLower(cfg.Virtual.Mode) != "http" {
+		log.Warningf("Annotation %v on '%v' is ignored, it requires an "+
+			"http virtual server", hostRedirectsAnnotation, resourceName)
+		return
+	}
+	cfg.MetaData.HostRedirects = redirects
+	cfg.Virtual.AddIRule(fmt.Sprintf("/%s/%s", partition,
+		hostRedirectIRuleName))
+}
+
+// Add the host redirects of a virtual server to the data group of the host
+// redirect iRule. Records are keyed by the full path of the virtual server
+// and the alternate host, and hold the status code and the canonical host.
+func addHostRedirectRecords(dg *InternalDataGroup, cfg *ResourceConfig) {
+	vsPath := fmt.Sprintf("/%s/%s", cfg.Virtual.Partition,
+		cfg.Virtual.VirtualServerName)
+	for from, to := range cfg.MetaData.HostRedirects {
+		dg.AddOrUpdateRecord(vsPath+"/"+from,
+			fmt.Sprintf("%d %s", cfg.MetaData.HostRedirectCode, to))
+	}
+}
@@ -0,0 +1,361 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Data of the template of the HTTP redirect iRule
+type httpRedirectIRuleData struct {
+	// HTTPS port the requests are redirected to
+	Port int32
+}
+
+// Data of the template of the passthrough iRule
+type passthroughIRuleData struct {
+	// The data groups are split by first character of the server name
+	Sharded bool
+	// Shard of the server names not starting with a letter or a digit
+	OtherShard string
+	// Data groups of the server names, or the variables holding the names
+	// of their shard when sharded
+	PassthroughDg string
+	IngressDg     string
+	ReencryptDg   string
+	// Prefixes of the names of the shards of the data groups
+	PassthroughShards string
+	IngressShards     string
+	ReencryptShards   string
+}
+
+const httpRedirectIRuleTemplate = `
+	when HTTP_REQUEST {
+       HTTP::redirect https://[getfield [HTTP::host] ":" 1]:{{.Port}}[HTTP::uri]
+    }`
+
+const passthroughIRuleTemplate = `
+when CLIENT_ACCEPTED {
+	TCP::collect
+}
+
+when CLIENT_DATA {
+	# Byte 0 is the content type.
+	# Bytes 1-2 are the TLS version.
+	# Bytes 3-4 are the TLS payload length.
+	# Bytes 5-$tls_payload_len are the TLS payload.
+	binary scan [TCP::payload] cSS tls_content_type tls_version tls_payload_len
+
+	switch $tls_version {
+		"769" -
+		"770" -
+		"771" {
+			# Content type of 22 indicates the TLS payload contains a handshake.
+			if { $tls_content_type == 22 } {
+				# Byte 5 (the first byte of the handshake) indicates the handshake
+				# record type, and a value of 1 signifies that the handshake record is
+				# a ClientHello.
+				binary scan [TCP::payload] @5c tls_handshake_record_type
+				if { $tls_handshake_record_type == 1 } {
+					# Bytes 6-8 are the handshake length (which we ignore).
+					# Bytes 9-10 are the TLS version (which we ignore).
+					# Bytes 11-42 are random data (which we ignore).
+
+					# Byte 43 is the session ID length.  Following this are three
+					# variable-length fields which we shall skip over.
+					set record_offset 43
+
+					# Skip the session ID.
+					binary scan [TCP::payload] @${record_offset}c tls_session_id_len
+					incr record_offset [expr {1 + $tls_session_id_len}]
+
+					# Skip the cipher_suites field.
+					binary scan [TCP::payload] @${record_offset}S tls_cipher_suites_len
+					incr record_offset [expr {2 + $tls_cipher_suites_len}]
+
+					# Skip the compression_methods field.
+					binary scan [TCP::payload] @${record_offset}c tls_compression_methods_len
+					incr record_offset [expr {1 + $tls_compression_methods_len}]
+
+					# Get the number of extensions, and store the extensions.
+					binary scan [TCP::payload] @${record_offset}S tls_extensions_len
+					incr record_offset 2
+					binary scan [TCP::payload] @${record_offset}a* tls_extensions
+
+					for { set extension_start 0 }
+							{ $tls_extensions_len - $extension_start == abs($tls_extensions_len - $extension_start) }
+							{ incr extension_start 4 } {
+						# Bytes 0-1 of the extension are the extension type.
+						# Bytes 2-3 of the extension are the extension length.
+						binary scan $tls_extensions @${extension_start}SS extension_type extension_len
+
+						# Extension type 00 is the ServerName extension.
+						if { $extension_type == "00" } {
+							# Bytes 4-5 of the extension are the SNI length (we ignore this).
+
+							# Byte 6 of the extension is the SNI type.
+							set sni_type_offset [expr {$extension_start + 6}]
+							binary scan $tls_extensions @${sni_type_offset}S sni_type
+
+							# Type 0 is host_name.
+							if { $sni_type == "0" } {
+								# Bytes 7-8 of the extension are the SNI data (host_name)
+								# length.
+								set sni_len_offset [expr {$extension_start + 7}]
+								binary scan $tls_extensions @${sni_len_offset}S sni_len
+
+								# Bytes 9-$sni_len are the SNI data (host_name).
+								set sni_start [expr {$extension_start + 9}]
+								binary scan $tls_extensions @${sni_start}A${sni_len} tls_servername
+							}
+						}
+
+						incr extension_start $extension_len
+					}
+
+					if { [info exists tls_servername] } {
+						set servername_lower [string tolower $tls_servername]{{if .Sharded}}
+						set shard [string index $servername_lower 0]
+						if { ![string match {[a-z0-9]} $shard] } {
+							set shard {{.OtherShard}}
+						}
+						set passthrough_dg {{.PassthroughShards}}_$shard
+						set ingress_dg {{.IngressShards}}_$shard
+						set reencrypt_dg {{.ReencryptShards}}_$shard{{end}}
+						SSL::disable serverside
+						if { {{if .Sharded}}[class exists {{.PassthroughDg}}] && {{end}}[class match $servername_lower equals {{.PassthroughDg}}] } {
+							pool [class match -value $servername_lower equals {{.PassthroughDg}}]
+							SSL::disable
+							HTTP::disable
+						}
+						elseif { {{if .Sharded}}[class exists {{.IngressDg}}] && {{end}}[class match $servername_lower equals {{.IngressDg}}] } {
+							pool [class match -value $servername_lower equals {{.IngressDg}}]
+							SSL::disable
+							HTTP::disable
+						}
+						elseif { {{if .Sharded}}[class exists {{.ReencryptDg}}] && {{end}}[class match $servername_lower equals {{.ReencryptDg}}] } {
+							pool [class match -value $servername_lower equals {{.ReencryptDg}}]
+							SSL::enable serverside
+						}
+					}
+				}
+			}
+		}
+	}
+
+	TCP::release
+}
+`
+
+// Built-in templates of the iRules users may override, by iRule name
+var defaultIRuleTemplates = map[string]*template.Template{
+	httpRedirectIRuleName: template.Must(
+		template.New(httpRedirectIRuleName).Parse(httpRedirectIRuleTemplate)),
+	sslPassthroughIRuleName: template.Must(
+		template.New(sslPassthroughIRuleName).Parse(passthroughIRuleTemplate)),
+}
+
+// Code of an iRule from its built-in template. The data always matches the
+// template, so executing it cannot fail.
+func defaultIRule(name string, data interface{}) string {
+	var buf bytes.Buffer
+	defaultIRuleTemplates[name].Execute(&buf, data)
+	return buf.String()
+}
+
+var iRuleEventRE = regexp.MustCompile(`(?m)^\s*when\s+[A-Z][A-Z0-9_]*\b`)
+
+// Check that rendered TCL has balanced braces and brackets and handles an
+// event, so a broken override is caught before the BIG-IP rejects the
+// whole config. Characters escaped with a backslash are skipped.
+func validateIRule(code string) error {
+	var open []rune
+	line := 1
+	escaped := false
+	for _, c := range code {
+		if escaped {
+			escaped = false
+			continue
+		}
+		switch c {
+		case '\\':
+			escaped = true
+		case '\n':
+			line += 1
+		case '{', '[':
+			open = append(open, c)
+		case '}', ']':
+			expected := '{'
+			if ']' == c {
+				expected = '['
+			}
+			if 0 == len(open) || open[len(open)-1] != expected {
+				return fmt.Errorf("unexpected '%c' on line %d", c, line)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if 0 != len(open) {
+		return fmt.Errorf("unclosed '%c'", open[len(open)-1])
+	}
+	if !iRuleEventRE.MatchString(code) {
+		return fmt.Errorf("no 'when EVENT' block")
+	}
+	return nil
+}
+
+// Interval of the checks for changes to the iRule template overrides
+const iRuleTemplateReloadInterval = time.Minute
+
+// Overrides of the built-in iRule templates, read from the files named after
+// the iRules in a directory, usually a mounted ConfigMap. Rendered by the
+// sync workers while reloaded, the overrides are guarded by the mutex.
+type iRuleTemplates struct {
+	sync.RWMutex
+	dir       string
+	sources   map[string]string
+	overrides map[string]*template.Template
+}
+
+func newIRuleTemplates(dir string) *iRuleTemplates {
+	templates := &iRuleTemplates{
+		dir:       dir,
+		sources:   make(map[string]string),
+		overrides: make(map[string]*template.Template),
+	}
+	templates.load()
+	return templates
+}
+
+// Read the overrides again, returns whether they changed. A template that
+// does not parse is left out, the built-in template is used instead.
+func (t *iRuleTemplates) load() bool {
+	if "" == t.dir {
+		return false
+	}
+	sources := make(map[string]string)
+	overrides := make(map[string]*template.Template)
+	for name := range defaultIRuleTemplates {
+		path := filepath.Join(t.dir, name)
+		data, err := ioutil.ReadFile(path)
+		if nil != err {
+			if !os.IsNotExist(err) {
+				log.Warningf("Unable to read iRule template '%v': %v", path, err)
+			}
+			continue
+		}
+		sources[name] = string(data)
+		tmpl, err := template.New(name).Parse(string(data))
+		if nil != err {
+			log.Warningf("Invalid iRule template '%v', using the built-in "+
+				"template: %v", path, err)
+			continue
+		}
+		overrides[name] = tmpl
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	changed := len(sources) != len(t.sources)
+	for name, source := range sources {
+		if t.sources[name] != source {
+			changed = true
+		}
+	}
+	if changed {
+		for name := range overrides {
+			log.Infof("Using iRule template '%v'", filepath.Join(t.dir, name))
+		}
+	}
+	t.sources = sources
+	t.overrides = overrides
+	return changed
+}
+
+// Code of an iRule from its override, or from its built-in template when it
+// has none or the override fails to render valid TCL
+func (t *iRuleTemplates) render(name string, data interface{}) string {
+	t.RLock()
+	tmpl, ok := t.overrides[name]
+	t.RUnlock()
+	if !ok {
+		return defaultIRule(name, data)
+	}
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, data)
+	if nil == err {
+		err = validateIRule(buf.String())
+	}
+	if nil != err {
+		log.Warningf("iRule template '%v' failed to render, using the "+
+			"built-in template: %v", filepath.Join(t.dir, name), err)
+		return defaultIRule(name, data)
+	}
+	return buf.String()
+}
+
+// HTTP redirect iRule to an HTTPS port
+func (appMgr *Manager) redirectIRule(port int32) string {
+	return appMgr.iRuleTemplates.render(httpRedirectIRuleName,
+		httpRedirectIRuleData{Port: port})
+}
+
+// Reload the iRule template overrides, and render the iRules using them
+// again when they changed, so edits to the ConfigMap apply without a
+// restart
+func (appMgr *Manager) reloadIRuleTemplates() {
+	if !appMgr.iRuleTemplates.load() {
+		return
+	}
+	portRulePrefix := fmt.Sprintf("/%s/%s_", DEFAULT_PARTITION,
+		httpRedirectIRuleName)
+	rules := make(map[string]string)
+	appMgr.irulesMutex.Lock()
+	for key := range appMgr.irulesMap {
+		switch {
+		case httpRedirectIRuleName == key.Name:
+			rules[key.Name] = appMgr.redirectIRule(DEFAULT_HTTPS_PORT)
+		case strings.HasPrefix(key.Name, portRulePrefix):
+			port, err := strconv.ParseInt(
+				strings.TrimPrefix(key.Name, portRulePrefix), 10, 32)
+			if nil == err {
+				rules[key.Name] = appMgr.redirectIRule(int32(port))
+			}
+		case sslPassthroughIRuleName == key.Name:
+			rules[key.Name] = appMgr.passthroughIRule()
+		}
+	}
+	appMgr.irulesMutex.Unlock()
+	for name, code := range rules {
+		appMgr.addIRule(name, DEFAULT_PARTITION, code)
+	}
+	if 0 != len(rules) {
+		appMgr.outputConfig()
+	}
+}
@@ -0,0 +1,165 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// The f5 Ingresses of all the watched namespaces by virtual address, indexed
+// once per sync of Ingresses to find those holding an address
+type ingressAddressIndex map[string][]*v1beta1.Ingress
+
+// Index the Ingresses by the address of their ip annotation, or else by the
+// address of their virtual servers, such as one set by IPAM in the status
+// annotation, a reserved address or the address of a service.
+func (appMgr *Manager) indexIngressAddresses() ingressAddressIndex {
+	configured := make(map[string]string)
+	appMgr.resources.Lock()
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if "ingress" == cfg.MetaData.ResourceType &&
+			nil != cfg.Virtual.VirtualAddress &&
+			"" != cfg.Virtual.VirtualAddress.BindAddr {
+			configured[cfg.MetaData.ResourceName] =
+				cfg.Virtual.VirtualAddress.BindAddr
+		}
+	})
+	appMgr.resources.Unlock()
+
+	index := make(ingressAddressIndex)
+	appMgr.informersMutex.Lock()
+	defer appMgr.informersMutex.Unlock()
+	for _, appInf := range appMgr.appInformers {
+		if nil == appInf.ingInformer {
+			continue
+		}
+		for _, obj := range appInf.ingInformer.GetStore().List() {
+			ing := obj.(*v1beta1.Ingress)
+			if class, ok := ing.ObjectMeta.Annotations["kubernetes.io/ingress.class"]; ok && class != "f5" {
+				continue
+			}
+			addr := ing.ObjectMeta.Annotations["virtual-server.f5.com/ip"]
+			if "" == addr {
+				addr = configured[ing.ObjectMeta.Namespace+"/"+
+					ing.ObjectMeta.Name]
+			}
+			if "" != addr {
+				index[addr] = append(index[addr], ing)
+			}
+		}
+	}
+	return index
+}
+
+// Oldest other Ingress holding an address, nil if none. Ingresses can only
+// share an address if they have the same sharing group and different
+// ports; the oldest Ingress keeps it.
+func (appMgr *Manager) ingressAddressConflict(
+	index ingressAddressIndex,
+	ing *v1beta1.Ingress,
+	bindAddr string,
+	port int32,
+) *v1beta1.Ingress {
+	if "" == bindAddr {
+		return nil
+	}
+	group := ing.ObjectMeta.Annotations[ingressSharingGroupAnnotation]
+	var holder *v1beta1.Ingress
+	for _, other := range index[bindAddr] {
+		if other.ObjectMeta.Namespace == ing.ObjectMeta.Namespace &&
+			other.ObjectMeta.Name == ing.ObjectMeta.Name {
+			continue
+		}
+		if !ingressCreatedBefore(other, ing) {
+			continue
+		}
+		conflict := other.ObjectMeta.Annotations[ingressSharingGroupAnnotation] != group
+		for _, ps := range appMgr.virtualPorts(other) {
+			if ps.port == port {
+				conflict = true
+			}
+		}
+		if conflict && (nil == holder || ingressCreatedBefore(other, holder)) {
+			holder = other
+		}
+	}
+	return holder
+}
+
+// Ingresses refused an address, as "namespace/name", by the Ingress
+// holding it
+type addressLosers struct {
+	sync.Mutex
+	losers map[string]map[string]bool
+}
+
+func newAddressLosers() *addressLosers {
+	return &addressLosers{losers: make(map[string]map[string]bool)}
+}
+
+// Record that an Ingress was refused the address of a holder
+func (al *addressLosers) add(holder, loser *v1beta1.Ingress) {
+	holderKey := holder.ObjectMeta.Namespace + "/" + holder.ObjectMeta.Name
+	al.Lock()
+	defer al.Unlock()
+	if nil == al.losers[holderKey] {
+		al.losers[holderKey] = make(map[string]bool)
+	}
+	al.losers[holderKey][loser.ObjectMeta.Namespace+"/"+
+		loser.ObjectMeta.Name] = true
+}
+
+// Take the Ingresses refused the address of a holder
+func (al *addressLosers) take(holder *v1beta1.Ingress) []string {
+	holderKey := holder.ObjectMeta.Namespace + "/" + holder.ObjectMeta.Name
+	al.Lock()
+	defer al.Unlock()
+	var losers []string
+	for key := range al.losers[holderKey] {
+		losers = append(losers, key)
+	}
+	delete(al.losers, holderKey)
+	return losers
+}
+
+// Sync the Ingresses refused the address of an Ingress that changed or was
+// deleted, so they get it if it is free. Those still refused are recorded
+// again by their sync.
+func (appMgr *Manager) requeueAddressLosers(holder *v1beta1.Ingress) {
+	for _, key := range appMgr.addressLosers.take(holder) {
+		appInf, ok := appMgr.getNamespaceInformer(
+			key[:strings.Index(key, "/")])
+		if !ok {
+			continue
+		}
+		obj, found, err := appInf.ingInformer.GetIndexer().GetByKey(key)
+		if nil == err && found {
+			appMgr.enqueueIngress(obj)
+		}
+	}
+}
+
+// Sync a changed Ingress and the Ingresses refused its address
+func (appMgr *Manager) enqueueIngressChange(obj interface{}) {
+	appMgr.enqueueIngress(obj)
+	if ing, ok := obj.(*v1beta1.Ingress); ok {
+		appMgr.requeueAddressLosers(ing)
+	}
+}
@@ -0,0 +1,179 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Parse the header rules annotation of an Ingress. All rules are ignored if
+// any of them is invalid, so traffic is not split partially.
+func parseIngressHeaderRules(val string) ([]ingressHeaderRule, error) {
+	var rules []ingressHeaderRule
+	err := json.Unmarshal([]byte(val), &rules)
+	if nil != err {
+		return nil, err
+	}
+	for i, rl := range rules {
+		if (rl.Header == "") == (rl.Cookie == "") {
+			return nil, fmt.Errorf(
+				"rule %d must have exactly one of header or cookie", i)
+		}
+		if 0 == len(rl.Values) {
+			return nil, fmt.Errorf("rule %d must have values", i)
+		}
+		if rl.ServiceName == "" {
+			return nil, fmt.Errorf("rule %d must have a serviceName", i)
+		}
+		switch rl.Operand {
+		case "", "equals", "startsWith", "endsWith", "contains":
+		default:
+			return nil, fmt.Errorf("rule %d has invalid operand '%s', must "+
+				"be one of: equals, startsWith, endsWith, contains",
+				i, rl.Operand)
+		}
+	}
+	return rules, nil
+}
+
+// Forward requests matching the header rules of an Ingress to their
+// services. The rules are evaluated before the host and path rules of the
+// Ingress; requests matching none of them use those rules or the default
+// backend as before. Rules for services that do not exist are skipped.
+func setIngressHeaderRules(
+	cfg *ResourceConfig,
+	ing *v1beta1.Ingress,
+	ns string,
+	svcNamespaces map[string]string,
+	svcIndexer cache.Indexer,
+	balance string,
+) {
+	val, ok := ing.ObjectMeta.Annotations[ingressHeaderRulesAnnotation]
+	if !ok {
+		return
+	}
+	hdrRules, err := parseIngressHeaderRules(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, ingressHeaderRulesAnnotation, ing.ObjectMeta.Name, err)
+		return
+	}
+
+	var rules Rules
+	for i, hr := range hdrRules {
+		svcNs := backendNamespace(svcNamespaces, ns, hr.ServiceName)
+		if _, found, _ := svcIndexer.GetByKey(svcNs + "/" + hr.ServiceName); !found {
+			continue
+		}
+		backend := v1beta1.IngressBackend{
+			ServiceName: hr.ServiceName,
+			ServicePort: hr.ServicePort,
+		}
+		svcPort := getIngressBackendPort(svcNs, backend, svcIndexer)
+		poolName := ""
+		for _, pool := range cfg.Pools {
+			if pool.ServiceName == hr.ServiceName && pool.ServicePort == svcPort &&
+				pool.serviceNamespace(ns) == svcNs {
+				poolName = pool.Name
+				break
+			}
+		}
+		if poolName == "" {
+			poolName = fmt.Sprintf("%s_header_%d",
+				cfg.Virtual.VirtualServerName, i)
+			cfg.Pools = append(cfg.Pools, Pool{
+				Name:             poolName,
+				Partition:        cfg.Virtual.Partition,
+				Balance:          balance,
+				ServiceName:      hr.ServiceName,
+				ServicePort:      svcPort,
+				ServiceNamespace: svcNs,
+			})
+		}
+		rules = append(rules, createHeaderRule(hr,
+			fmt.Sprintf("/%s/%s", cfg.Virtual.Partition, poolName)))
+	}
+	if 0 == len(rules) {
+		return
+	}
+
+	policyName := cfg.Virtual.VirtualServerName
+	for _, pol := range cfg.Policies {
+		if pol.Name == policyName {
+			rules = append(rules, pol.Rules...)
+			break
+		}
+	}
+	for i, rl := range rules {
+		rl.Ordinal = i
+		rl.Name = strconv.Itoa(i)
+	}
+	cfg.SetPolicy(*createPolicy(rules, policyName, cfg.Virtual.Partition))
+}
+
+func createHeaderRule(hr ingressHeaderRule, pool string) *Rule {
+	c := &condition{
+		Name:    "0",
+		Request: true,
+		Values:  hr.Values,
+	}
+	if hr.Header != "" {
+		c.HTTPHeader = true
+		c.TmName = hr.Header
+	} else {
+		c.HTTPCookie = true
+		c.TmName = hr.Cookie
+	}
+	switch hr.Operand {
+	case "startsWith":
+		c.StartsWith = true
+	case "endsWith":
+		c.EndsWith = true
+	case "contains":
+		c.Contains = true
+	default:
+		c.Equals = true
+	}
+	conditions := []*condition{c}
+	if hr.Host != "" {
+		conditions = append(conditions, &condition{
+			Name:     "1",
+			Index:    0,
+			Equals:   true,
+			Host:     true,
+			HTTPHost: true,
+			Request:  true,
+			Values:   []string{hr.Host},
+		})
+	}
+	return &Rule{
+		Actions: []*action{{
+			Name:    "0",
+			Forward: true,
+			Pool:    pool,
+			Request: true,
+		}},
+		Conditions: conditions,
+	}
+}
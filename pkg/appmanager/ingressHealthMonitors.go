@@ -18,48 +18,154 @@ package appmanager
 
 import (
 	"fmt"
+	"regexp"
 	"strings"
 
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
 )
 
+// A monitor sets the path of the rules it applies to, the service of their
+// backend, or both
+func validateIngressHealthMonitor(mon IngressHealthMonitor) error {
+	if "" == mon.Path && "" == mon.ServiceName {
+		return fmt.Errorf("Health Monitor must set a path or a serviceName.")
+	}
+	if "" != mon.Path && -1 == strings.Index(mon.Path, "/") {
+		return fmt.Errorf("Health Monitor path '%v' is not valid.", mon.Path)
+	}
+	return nil
+}
+
+// Match a host or path against a pattern in which '*' matches any
+// characters, '/' included
+func matchMonitorGlob(pattern, s string) bool {
+	re := strings.Replace(regexp.QuoteMeta(pattern), `\*`, ".*", -1)
+	matched, _ := regexp.MatchString("^"+re+"$", s)
+	return matched
+}
+
+// Whether a monitor applies to the backend of a rule: any backend when it
+// sets no service, else the backends of its service, on its port when set.
+// Port names and numbers are resolved against the ports of the service.
+func monitorMatchesBackend(
+	ns string,
+	mon IngressHealthMonitor,
+	ruleData *ingressRuleData,
+	svcIndexer cache.Indexer,
+) bool {
+	if "" == mon.ServiceName {
+		return true
+	}
+	if mon.ServiceName != ruleData.svcName {
+		return false
+	}
+	if (mon.ServicePort == intstr.IntOrString{}) ||
+		mon.ServicePort == ruleData.svcPort {
+		return true
+	}
+	monPort := getIngressBackendPort(ns, v1beta1.IngressBackend{
+		ServiceName: mon.ServiceName,
+		ServicePort: mon.ServicePort,
+	}, svcIndexer)
+	rulePort := getIngressBackendPort(ns, v1beta1.IngressBackend{
+		ServiceName: ruleData.svcName,
+		ServicePort: ruleData.svcPort,
+	}, svcIndexer)
+	return 0 != monPort && monPort == rulePort
+}
+
+// Describe the rules a monitor applies to, for the Events
+func monitorTarget(mon IngressHealthMonitor) string {
+	var target []string
+	if "" != mon.Path {
+		target = append(target, fmt.Sprintf("path '%v'", mon.Path))
+	}
+	if "" != mon.ServiceName {
+		target = append(target, fmt.Sprintf("service '%v'", mon.ServiceName))
+	}
+	if (mon.ServicePort != intstr.IntOrString{}) {
+		target = append(target, fmt.Sprintf("port '%v'", mon.ServicePort.String()))
+	}
+	return strings.Join(target, " ")
+}
+
 func (appMgr *Manager) assignHealthMonitorsByPath(
 	rsName string,
 	ing *v1beta1.Ingress,
 	rulesMap ingressHostToPathMap,
 	monitors IngressHealthMonitors,
+	svcIndexer cache.Indexer,
 ) error {
 	// The returned error is used for 'fatal' errors only, meaning abandon
 	// any further processing of health monitors for this Ingress.
+	ns := ing.ObjectMeta.Namespace
 	for _, mon := range monitors {
-		slashPos := strings.Index(mon.Path, "/")
-		if slashPos == -1 {
-			return fmt.Errorf("Health Monitor path '%v' is not valid.", mon.Path)
+		if err := validateIngressHealthMonitor(mon); nil != err {
+			return err
 		}
 
-		host := mon.Path[:slashPos]
-		path := mon.Path[slashPos:]
-		pm, found := rulesMap[host]
-		if false == found && host != "*" {
-			pm, found = rulesMap["*"]
+		var host, path string
+		if slashPos := strings.Index(mon.Path, "/"); slashPos != -1 {
+			host = mon.Path[:slashPos]
+			path = mon.Path[slashPos:]
 		}
-		if false == found {
-			msg := fmt.Sprintf("Rule not found for Health Monitor host '%v'", host)
-			log.Warningf("%s", msg)
-			appMgr.recordIngressEvent(ing, "MonitorRuleNotFound", msg, rsName)
+		glob := "" == mon.Path || strings.Contains(path, "*") ||
+			(host != "*" && strings.Contains(host, "*"))
+		if !glob {
+			pm, found := rulesMap[host]
+			if false == found && host != "*" {
+				pm, found = rulesMap["*"]
+			}
+			if false == found {
+				msg := fmt.Sprintf("Rule not found for Health Monitor host '%v'", host)
+				log.Warningf("%s", msg)
+				appMgr.recordIngressEvent(ing, "MonitorRuleNotFound", msg, rsName)
+				continue
+			}
+			ruleData, found := pm[path]
+			if false == found ||
+				!monitorMatchesBackend(ns, mon, ruleData, svcIndexer) {
+				msg := fmt.Sprintf("Rule not found for Health Monitor %v",
+					monitorTarget(mon))
+				log.Warningf("%s", msg)
+				appMgr.recordIngressEvent(ing, "MonitorRuleNotFound", msg, rsName)
+				continue
+			}
+			ruleData.healthMon = mon
 			continue
 		}
-		ruleData, found := pm[path]
-		if false == found {
-			msg := fmt.Sprintf("Rule not found for Health Monitor path '%v'",
-				mon.Path)
+
+		// A glob, or the service alone, may apply the monitor to several
+		// rules. The rules for all hosts match any host.
+		matched := false
+		for ruleHost, pm := range rulesMap {
+			if "" != mon.Path && ruleHost != "*" &&
+				!matchMonitorGlob(host, ruleHost) {
+				continue
+			}
+			for rulePath, ruleData := range pm {
+				if "" != mon.Path && !matchMonitorGlob(path, rulePath) {
+					continue
+				}
+				if !monitorMatchesBackend(ns, mon, ruleData, svcIndexer) {
+					continue
+				}
+				ruleMon := mon
+				ruleMon.Path = ruleHost + rulePath
+				ruleData.healthMon = ruleMon
+				matched = true
+			}
+		}
+		if !matched {
+			msg := fmt.Sprintf("Rule not found for Health Monitor %v",
+				monitorTarget(mon))
 			log.Warningf("%s", msg)
 			appMgr.recordIngressEvent(ing, "MonitorRuleNotFound", msg, rsName)
-			continue
 		}
-		ruleData.healthMon = mon
 	}
 	return nil
 }
@@ -112,18 +218,19 @@ func (appMgr *Manager) handleSingleServiceHealthMonitors(
 	cfg *ResourceConfig,
 	ing *v1beta1.Ingress,
 	monitors IngressHealthMonitors,
+	svcIndexer cache.Indexer,
 ) {
 	// Setup the rule-to-pool map from the ingress
 	ruleItem := make(ingressPathToRuleMap)
 	ruleItem["/"] = &ingressRuleData{
 		svcName: ing.Spec.Backend.ServiceName,
-		svcPort: ing.Spec.Backend.ServicePort.IntVal,
+		svcPort: ing.Spec.Backend.ServicePort,
 	}
 	hostToPathMap := make(ingressHostToPathMap)
 	hostToPathMap["*"] = ruleItem
 
 	err := appMgr.assignHealthMonitorsByPath(
-		rsName, ing, hostToPathMap, monitors)
+		rsName, ing, hostToPathMap, monitors, svcIndexer)
 	if nil != err {
 		log.Errorf("%s", err.Error())
 		appMgr.recordIngressEvent(ing, "MonitorError", err.Error(), rsName)
@@ -146,6 +253,7 @@ func (appMgr *Manager) handleMultiServiceHealthMonitors(
 	cfg *ResourceConfig,
 	ing *v1beta1.Ingress,
 	monitors IngressHealthMonitors,
+	svcIndexer cache.Indexer,
 ) {
 	// Setup the rule-to-pool map from the ingress
 	hostToPathMap := make(ingressHostToPathMap)
@@ -177,7 +285,7 @@ func (appMgr *Manager) handleMultiServiceHealthMonitors(
 			} else {
 				pathItem = &ingressRuleData{
 					svcName: path.Backend.ServiceName,
-					svcPort: path.Backend.ServicePort.IntVal,
+					svcPort: path.Backend.ServicePort,
 				}
 				ruleItem[pathKey] = pathItem
 			}
@@ -197,7 +305,7 @@ func (appMgr *Manager) handleMultiServiceHealthMonitors(
 	}
 
 	err := appMgr.assignHealthMonitorsByPath(
-		rsName, ing, hostToPathMap, monitors)
+		rsName, ing, hostToPathMap, monitors, svcIndexer)
 	if nil != err {
 		log.Errorf("%s", err.Error())
 		appMgr.recordIngressEvent(ing, "MonitorError", err.Error(), rsName)
@@ -866,4 +866,103 @@ var _ = Describe("Ingress Health Monitor Tests", func() {
 		checkMultiServiceHealthMonitor(vsCfgBar, svc2Name, svc2Port, true)
 		checkMultiServiceHealthMonitor(vsCfgBaz, svc3Name, svc3Port, true)
 	})
+
+	It("configures health checks by path glob and service port", func() {
+		hostName := "api.bar.com"
+		backends := []struct {
+			path     string
+			svcName  string
+			svcPort  int
+			portName string
+		}{
+			{"/api/v1", "svc1", 8080, "http"},
+			{"/api/v2", "svc2", 9090, "http"},
+			{"/admin", "svc3", 8888, "admin"},
+		}
+		var paths []v1beta1.HTTPIngressPath
+		for _, b := range backends {
+			paths = append(paths, v1beta1.HTTPIngressPath{
+				Path: b.path,
+				Backend: v1beta1.IngressBackend{
+					ServiceName: b.svcName,
+					ServicePort: intstr.FromInt(b.svcPort),
+				},
+			})
+		}
+		spec := v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{
+				{
+					Host: hostName,
+					IngressRuleValue: v1beta1.IngressRuleValue{
+						HTTP: &v1beta1.HTTPIngressRuleValue{Paths: paths},
+					},
+				},
+			},
+		}
+		ing := test.NewIngress("ingress", "1", namespace, spec,
+			map[string]string{
+				"virtual-server.f5.com/ip":        "1.2.3.4",
+				"virtual-server.f5.com/partition": "velcro",
+				"virtual-server.f5.com/health": `[
+				{
+					"path":     "api.bar.com/api/*",
+					"send":     "HTTP GET /health/api",
+					"interval": 5,
+					"timeout":  10
+				}, {
+					"serviceName": "svc3",
+					"servicePort": "admin",
+					"send":        "HTTP GET /health/admin",
+					"interval":    5,
+					"timeout":     7
+				}, {
+					"serviceName": "svc3",
+					"servicePort": "metrics",
+					"send":        "HTTP GET /metrics",
+					"interval":    5,
+					"timeout":     7
+				}
+			]`,
+			})
+		r := mockMgr.addIngress(ing)
+		Expect(r).To(BeTrue(), "Ingress resource should be processed.")
+
+		emptyIps := []string{}
+		readyIps := []string{"10.2.96.0", "10.2.96.1", "10.2.96.2"}
+		for _, b := range backends {
+			ports := []v1.ServicePort{newServicePort(b.portName, int32(b.svcPort))}
+			svc := test.NewService(b.svcName, "1", namespace,
+				v1.ServiceTypeClusterIP, ports)
+			r = mockMgr.addService(svc)
+			Expect(r).To(BeTrue(), "Service should be processed.")
+			endpts := test.NewEndpoints(b.svcName, "1", namespace, readyIps,
+				emptyIps, convertSvcPortsToEndpointPorts(ports))
+			r = mockMgr.addEndpoints(endpts)
+			Expect(r).To(BeTrue(), "Endpoints should be processed.")
+		}
+		resources := mockMgr.resources()
+		Expect(resources.Count()).To(Equal(3))
+
+		sends := map[string]string{
+			"svc1": "HTTP GET /health/api",
+			"svc2": "HTTP GET /health/api",
+			"svc3": "HTTP GET /health/admin",
+		}
+		for _, b := range backends {
+			key := serviceKey{
+				Namespace:   namespace,
+				ServiceName: b.svcName,
+				ServicePort: int32(b.svcPort),
+			}
+			vsCfg, found := resources.Get(key, formatIngressVSName(ing, "http"))
+			Expect(found).To(BeTrue())
+			checkMultiServiceHealthMonitor(vsCfg, b.svcName, b.svcPort, true)
+			var send []string
+			for _, monitor := range vsCfg.Monitors {
+				send = append(send, monitor.Send)
+			}
+			Expect(send).To(ContainElement(sends[b.svcName]))
+			Expect(send).ToNot(ContainElement("HTTP GET /metrics"))
+		}
+	})
 })
@@ -0,0 +1,130 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// Whether an Ingress passes TLS connections through to its pods
+func isPassthroughIngress(ing *v1beta1.Ingress) bool {
+	return getBooleanAnnotation(ing.ObjectMeta.Annotations,
+		ingressSslPassthroughAnnotation, false)
+}
+
+// Attach the passthrough iRule to the https virtual server of an Ingress
+// and collect the server names it selects pools for. The TLS section of the
+// Ingress only lists additional server names, its Secrets are not used.
+// Server names held by another Ingress are left to it.
+func setIngressPassthrough(
+	rsCfg *ResourceConfig,
+	ing *v1beta1.Ingress,
+	hosts map[string]string,
+	holders map[string]*v1beta1.Ingress,
+) {
+	if nil == rsCfg.Virtual.VirtualAddress ||
+		rsCfg.Virtual.VirtualAddress.BindAddr == "" {
+		// Nothing to do for pool-only mode
+		return
+	}
+	rsCfg.Virtual.AddIRule(fmt.Sprintf("/%s/%s",
+		DEFAULT_PARTITION, sslPassthroughIRuleName))
+
+	poolPath := func(backend v1beta1.IngressBackend) string {
+		for _, pool := range rsCfg.Pools {
+			if pool.ServiceName == backend.ServiceName &&
+				(0 == backend.ServicePort.IntVal ||
+					pool.ServicePort == backend.ServicePort.IntVal) {
+				return fmt.Sprintf("/%s/%s", pool.Partition, pool.Name)
+			}
+		}
+		return ""
+	}
+	addHost := func(host, pool string) {
+		host = strings.ToLower(host)
+		if host == "" || pool == "" {
+			return
+		}
+		if strings.HasPrefix(host, "*.") {
+			log.Warningf("Wildcard host '%s' of Ingress '%s' can not be used "+
+				"for ssl passthrough.", host, ing.ObjectMeta.Name)
+			return
+		}
+		if holder, ok := holders[host]; ok &&
+			(holder.ObjectMeta.Namespace != ing.ObjectMeta.Namespace ||
+				holder.ObjectMeta.Name != ing.ObjectMeta.Name) {
+			return
+		}
+		if _, found := hosts[host]; !found {
+			hosts[host] = pool
+		}
+	}
+
+	// Server names are matched exactly, and the path of a request can not
+	// be seen, so each host uses the backend of its first path.
+	for _, rule := range ing.Spec.Rules {
+		if nil == rule.IngressRuleValue.HTTP {
+			continue
+		}
+		for _, path := range rule.IngressRuleValue.HTTP.Paths {
+			if pool := poolPath(path.Backend); pool != "" {
+				addHost(rule.Host, pool)
+				break
+			}
+		}
+	}
+	if nil != ing.Spec.Backend {
+		pool := poolPath(*ing.Spec.Backend)
+		for _, tls := range ing.Spec.TLS {
+			for _, host := range tls.Hosts {
+				addHost(host, pool)
+			}
+		}
+	}
+}
+
+// Update the data group of passthrough Ingresses with the server names of a
+// namespace. The passthrough iRule and the data groups it uses are created
+// with the first passthrough Ingress if Routes have not done so already.
+func (appMgr *Manager) updatePassthroughIngressDataGroup(
+	stats *vsSyncStats,
+	namespace string,
+	hosts map[string]string,
+) {
+	key := nameRef{
+		Name:      passthroughIngressHostsDgName,
+		Partition: DEFAULT_PARTITION,
+	}
+	if !appMgr.hostDgs.exists(key) {
+		if 0 == len(hosts) {
+			return
+		}
+		for _, name := range []string{passthroughHostsDgName, reencryptHostsDgName} {
+			appMgr.hostDgs.create(nameRef{Name: name, Partition: DEFAULT_PARTITION})
+		}
+		appMgr.addIRule(
+			sslPassthroughIRuleName, DEFAULT_PARTITION, appMgr.passthroughIRule())
+	}
+	changed := appMgr.hostDgs.setNamespace(
+		namespace, map[nameRef]map[string]string{key: hosts})
+	stats.dgUpdated += len(changed)
+}
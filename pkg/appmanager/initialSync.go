@@ -0,0 +1,139 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Time after which the controller logs what is left to sync if the initial
+// config has not been written
+const DefaultInitialSyncDeadline = 5 * time.Minute
+
+var (
+	initialSyncComplete = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "initial_sync_complete",
+		Help:      "1 once the initial config has been written, 0 before.",
+	})
+	initialSyncDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "initial_sync_duration_seconds",
+		Help:      "Time from start until the initial config was written.",
+	})
+)
+
+// Wait for the caches of all namespaces together, without holding the
+// informers mutex, so the initial sync deadline can report the namespaces
+// still loading
+func (appMgr *Manager) waitForInitialCacheSync() {
+	appMgr.informersMutex.Lock()
+	var appInfs []*appInformer
+	for _, appInf := range appMgr.appInformers {
+		appInfs = append(appInfs, appInf)
+	}
+	appMgr.informersMutex.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(appInfs))
+	for _, appInf := range appInfs {
+		go func(appInf *appInformer) {
+			defer wg.Done()
+			appInf.waitForCacheSync()
+		}(appInf)
+	}
+	wg.Wait()
+}
+
+// Additional virtual server worker for the initial sync, so the namespaces
+// are synced in parallel. It stops once the initial config is written, the
+// following changes are synced by the regular worker.
+func (appMgr *Manager) initialSyncWorker() {
+	for !appMgr.isInitialState() && appMgr.processNextVirtualServer() {
+	}
+}
+
+// Record the initial config write, called with the output mutex held
+func (appMgr *Manager) initialSyncDone() {
+	if appMgr.startTime.IsZero() {
+		return
+	}
+	elapsed := time.Since(appMgr.startTime)
+	initialSyncComplete.Set(1)
+	initialSyncDuration.Set(elapsed.Seconds())
+	log.Infof("Initial config written after %v", elapsed)
+}
+
+// Log what remains to be synced if the initial config is not written by
+// the deadline
+func (appMgr *Manager) checkInitialSyncDeadline(stopCh <-chan struct{}) {
+	select {
+	case <-time.After(appMgr.initialSyncDeadline):
+	case <-stopCh:
+		return
+	}
+	if appMgr.isInitialState() {
+		return
+	}
+	msg := fmt.Sprintf("Initial config not written after %v",
+		appMgr.initialSyncDeadline)
+	if unsynced := appMgr.unsyncedInformers(); 0 != len(unsynced) {
+		msg += fmt.Sprintf(", caches still loading: %s",
+			strings.Join(unsynced, ", "))
+	}
+	msg += fmt.Sprintf(", %d virtual server keys waiting",
+		appMgr.vsQueue.Len())
+	if q, ok := appMgr.vsQueue.(*monitoredQueue); ok {
+		if keys := q.pendingKeys(queueDumpSize); 0 != len(keys) {
+			msg += ": " + strings.Join(keys, ", ")
+		}
+	}
+	log.Warningf("%s", msg)
+}
+
+// Sorted informers whose cache has not synced, as "namespace/kind"
+func (appMgr *Manager) unsyncedInformers() []string {
+	appMgr.informersMutex.Lock()
+	defer appMgr.informersMutex.Unlock()
+	var unsynced []string
+	for ns, appInf := range appMgr.appInformers {
+		infs := map[string]cache.SharedIndexInformer{
+			"configmaps": appInf.cfgMapInformer,
+			"services":   appInf.svcInformer,
+			"endpoints":  appInf.endptInformer,
+			"ingresses":  appInf.ingInformer,
+			"routes":     appInf.routeInformer,
+			"secrets":    appInf.secretInformer,
+		}
+		for kind, inf := range infs {
+			if nil != inf && !inf.HasSynced() {
+				unsynced = append(unsynced, ns+"/"+kind)
+			}
+		}
+	}
+	sort.Strings(unsynced)
+	return unsynced
+}
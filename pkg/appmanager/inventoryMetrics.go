@@ -0,0 +1,130 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+var (
+	managedObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "bigip",
+		Name:      "managed_objects",
+		Help: "Number of custom profiles, iRules and data groups in the " +
+			"last config written, by kind and partition.",
+	}, []string{"kind", "partition"})
+	certificateExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "certificates",
+		Name:      "expiry_timestamp_seconds",
+		Help: "Expiry time of the certificate of each Secret used by the " +
+			"resources, in seconds since the epoch.",
+	}, []string{"namespace", "secret"})
+)
+
+// Count the custom profiles, iRules and data groups of a config
+func recordManagedObjects(resources PartitionMap) {
+	managedObjects.Reset()
+	for partition, cfg := range resources {
+		managedObjects.WithLabelValues("custom_profiles", partition).Set(
+			float64(len(cfg.CustomProfiles)))
+		managedObjects.WithLabelValues("irules", partition).Set(
+			float64(len(cfg.IRules)))
+		managedObjects.WithLabelValues("data_groups", partition).Set(
+			float64(len(cfg.InternalDataGroups)))
+	}
+}
+
+// Expiry of the first certificate of a Secret: the TLS certificate, or the
+// CA bundle of a Secret only holding a server CA
+func secretCertificateExpiry(secret *v1.Secret) (time.Time, error) {
+	data, ok := secret.Data["tls.crt"]
+	if !ok {
+		data, ok = secret.Data["ca.crt"]
+	}
+	if !ok {
+		return time.Time{}, fmt.Errorf("no 'tls.crt' or 'ca.crt' field")
+	}
+	block, _ := pem.Decode(data)
+	if nil == block || "CERTIFICATE" != block.Type {
+		return time.Time{}, fmt.Errorf("no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if nil != err {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
+
+// Whether a Secret is the default TLS Secret or is referenced by an Ingress,
+// a ConfigMap or a Route of its namespace
+func (appMgr *Manager) secretInUse(appInf *appInformer, key string) bool {
+	if appMgr.defaultSslSecret == key {
+		return true
+	}
+	for _, inf := range []cache.SharedIndexInformer{
+		appInf.ingInformer, appInf.cfgMapInformer, appInf.routeInformer} {
+		if nil == inf {
+			continue
+		}
+		objs, err := inf.GetIndexer().ByIndex(secretIndex, key)
+		if nil == err && 0 != len(objs) {
+			return true
+		}
+	}
+	return false
+}
+
+// Record the expiry of the certificates of the Secrets used by the
+// resources of all the watched namespaces, for alerting before they expire
+func (appMgr *Manager) recordCertificateExpiry() {
+	appMgr.informersMutex.Lock()
+	var informers []*appInformer
+	for _, appInf := range appMgr.appInformers {
+		informers = append(informers, appInf)
+	}
+	appMgr.informersMutex.Unlock()
+
+	certificateExpiry.Reset()
+	for _, appInf := range informers {
+		for _, obj := range appInf.secretInformer.GetStore().List() {
+			secret := obj.(*v1.Secret)
+			namespace := secret.ObjectMeta.Namespace
+			key := namespace + "/" + secret.ObjectMeta.Name
+			if !appMgr.secretInUse(appInf, key) {
+				continue
+			}
+			expiry, err := secretCertificateExpiry(secret)
+			if nil != err {
+				log.Debugf("No certificate expiry for Secret '%v': %v", key, err)
+				continue
+			}
+			certificateExpiry.WithLabelValues(namespace,
+				secret.ObjectMeta.Name).Set(float64(expiry.Unix()))
+		}
+	}
+}
@@ -0,0 +1,205 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"reflect"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Annotations that can be set on a Namespace as defaults for its Ingresses
+// and Routes. Annotations that identify a single virtual server, such as its
+// address or ports, cannot be shared by a namespace.
+var namespaceDefaultAnnotations = map[string]bool{
+	"virtual-server.f5.com/balance":       true,
+	"virtual-server.f5.com/partition":     true,
+	ingressSslRedirect:                    true,
+	ingressAllowHttp:                      true,
+	poolServiceDownAnnotation:             true,
+	poolReselectTriesAnnotation:           true,
+	poolMemberTypeAnnotation:              true,
+	poolMemberLimitAnnotation:             true,
+	sslSessionTicketAnnotation:            true,
+	sslCacheSizeAnnotation:                true,
+	proxyProtocolAnnotation:               true,
+	vsMergePolicyAnnotation:               true,
+	vsPreserveFieldsAnnotation:            true,
+	requestLogProfileAnnotation:           true,
+	analyticsProfileAnnotation:            true,
+	dosProfileAnnotation:                  true,
+	oneConnectProfileAnnotation:           true,
+	oneConnectOptionsAnnotation:           true,
+	securityLoggingAnnotation:             true,
+	bandwidthPolicyAnnotation:             true,
+	clonePoolsAnnotation:                  true,
+	iRulesAnnotation:                      true,
+	accessProfileAnnotation:               true,
+	perRequestPolicyAnnotation:            true,
+	fallbackPoolAnnotation:                true,
+	maintenancePageAnnotation:             true,
+	maintenanceStatusAnnotation:           true,
+	circuitBreakerAnnotation:              true,
+	preserveVIPAnnotation:                 true,
+	universalPersistenceAnnotation:        true,
+	universalPersistenceTimeoutAnnotation: true,
+	routeProtocolsAnnotation:              true,
+}
+
+// Watch all the Namespaces for their default annotations. Changing them
+// syncs the services of the namespace again.
+func (appMgr *Manager) newNamespaceDefaultsInformer(
+	resyncPeriod time.Duration,
+) cache.SharedIndexInformer {
+	informer := cache.NewSharedIndexInformer(
+		newListWatchWithLabelSelector(
+			appMgr.restClientv1,
+			"namespaces",
+			"",
+			labels.Everything(),
+		),
+		&v1.Namespace{},
+		resyncPeriod,
+		cache.Indexers{},
+	)
+	informer.AddEventHandler(
+		&cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				appMgr.enqueueNamespaceServices(obj)
+			},
+			UpdateFunc: func(old, cur interface{}) {
+				if !reflect.DeepEqual(namespaceDefaults(old),
+					namespaceDefaults(cur)) {
+					appMgr.enqueueNamespaceServices(cur)
+				}
+			},
+			DeleteFunc: func(obj interface{}) {
+				appMgr.enqueueNamespaceServices(obj)
+			},
+		},
+	)
+	return informer
+}
+
+// Default annotations of a Namespace object
+func namespaceDefaults(obj interface{}) map[string]string {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ns, ok := obj.(*v1.Namespace)
+	if !ok {
+		return nil
+	}
+	var defaults map[string]string
+	for key, val := range ns.ObjectMeta.Annotations {
+		if !namespaceDefaultAnnotations[key] {
+			continue
+		}
+		if nil == defaults {
+			defaults = make(map[string]string)
+		}
+		defaults[key] = val
+	}
+	return defaults
+}
+
+// Sync the services of a namespace whose defaults changed
+func (appMgr *Manager) enqueueNamespaceServices(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	ns, ok := obj.(*v1.Namespace)
+	if !ok {
+		return
+	}
+	appInf, ok := appMgr.getNamespaceInformer(ns.ObjectMeta.Name)
+	if !ok {
+		// Not watching this namespace
+		return
+	}
+	services, err := appInf.svcInformer.GetIndexer().ByIndex(
+		cache.NamespaceIndex, ns.ObjectMeta.Name)
+	if nil != err {
+		log.Warningf("Unable to list services of namespace '%v': %v",
+			ns.ObjectMeta.Name, err)
+		return
+	}
+	for _, obj := range services {
+		svc := obj.(*v1.Service)
+		appMgr.vsQueue.Add(serviceQueueKey{
+			Namespace:   svc.ObjectMeta.Namespace,
+			ServiceName: svc.ObjectMeta.Name,
+		})
+	}
+}
+
+// Default annotations of a namespace, nil if it has none
+func (appMgr *Manager) defaultsOfNamespace(namespace string) map[string]string {
+	if nil == appMgr.nsDefaultsInformer {
+		return nil
+	}
+	obj, found, err := appMgr.nsDefaultsInformer.GetIndexer().GetByKey(namespace)
+	if nil != err || !found {
+		return nil
+	}
+	return namespaceDefaults(obj)
+}
+
+// Annotations of a resource completed with the defaults of its namespace.
+// The annotations are returned as is when the namespace has no defaults.
+func (appMgr *Manager) withNamespaceDefaults(
+	namespace string,
+	annotations map[string]string,
+) map[string]string {
+	defaults := appMgr.defaultsOfNamespace(namespace)
+	if 0 == len(defaults) {
+		return annotations
+	}
+	for key, val := range annotations {
+		defaults[key] = val
+	}
+	return defaults
+}
+
+// Copy of an Ingress with the default annotations of its namespace
+func (appMgr *Manager) ingressWithDefaults(ing *v1beta1.Ingress) *v1beta1.Ingress {
+	if 0 == len(appMgr.defaultsOfNamespace(ing.ObjectMeta.Namespace)) {
+		return ing
+	}
+	copy := *ing
+	copy.ObjectMeta.Annotations = appMgr.withNamespaceDefaults(
+		ing.ObjectMeta.Namespace, ing.ObjectMeta.Annotations)
+	return &copy
+}
+
+// Copy of a Route with the default annotations of its namespace
+func (appMgr *Manager) routeWithDefaults(route *routeapi.Route) *routeapi.Route {
+	if 0 == len(appMgr.defaultsOfNamespace(route.ObjectMeta.Namespace)) {
+		return route
+	}
+	copy := *route
+	copy.ObjectMeta.Annotations = appMgr.withNamespaceDefaults(
+		route.ObjectMeta.Namespace, route.ObjectMeta.Annotations)
+	return &copy
+}
@@ -0,0 +1,96 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Disable the virtual servers of a namespace that is deleted or no longer
+// matches the namespace label, and remove them once the grace period ends.
+// Deleting a namespace by mistake then only takes its applications offline
+// until it is recreated. Returns whether any virtual server was disabled, the
+// config is then to be written. Called with informersMutex held.
+func (appMgr *Manager) startNamespaceGraceLocked(nsName string) bool {
+	appMgr.resources.Lock()
+	defer appMgr.resources.Unlock()
+	rsDisabled := 0
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if key.Namespace == nsName && !cfg.Virtual.Disabled {
+			cfg.Virtual.Disabled = true
+			appMgr.resources.Assign(key, cfg.Virtual.VirtualServerName, cfg)
+			rsDisabled += 1
+		}
+	})
+	if 0 == rsDisabled {
+		return false
+	}
+	appMgr.nsDeletions[nsName] = time.Now().Add(appMgr.nsDeleteGrace)
+	appMgr.nsQueue.AddAfter(nsName, appMgr.nsDeleteGrace)
+	log.Infof("Disabled %v virtual servers of deleted namespace '%v', "+
+		"removing them in %v", rsDisabled, nsName, appMgr.nsDeleteGrace)
+	return true
+}
+
+// Keep the namespace when it is back before the end of its grace period.
+// Called once its new informers have synced: the keys of its disabled
+// configs are synced again, which recreates the configs of its resources
+// enabled and removes those of the resources deleted in the meantime. The
+// virtual servers stay on the BIG-IP, disabled, until then.
+// Called with informersMutex held.
+func (appMgr *Manager) cancelNamespaceGraceLocked(nsName string) {
+	if _, ok := appMgr.nsDeletions[nsName]; !ok {
+		return
+	}
+	delete(appMgr.nsDeletions, nsName)
+	keys := make(map[serviceQueueKey]bool)
+	appMgr.resources.Lock()
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if key.Namespace == nsName {
+			keys[serviceQueueKey{
+				Namespace:   key.Namespace,
+				ServiceName: key.ServiceName,
+			}] = true
+		}
+	})
+	appMgr.resources.Unlock()
+	for key := range keys {
+		appMgr.vsQueue.Add(key)
+	}
+	log.Infof("Namespace '%v' is back, no longer removing its virtual servers",
+		nsName)
+}
+
+// Remove the virtual servers of a namespace at the end of its grace period,
+// returns whether the config is then to be written.
+// Called with informersMutex held.
+func (appMgr *Manager) endNamespaceGraceLocked(nsName string) bool {
+	deadline, ok := appMgr.nsDeletions[nsName]
+	if !ok {
+		return false
+	}
+	if remaining := deadline.Sub(time.Now()); remaining > 0 {
+		appMgr.nsQueue.AddAfter(nsName, remaining)
+		return false
+	}
+	delete(appMgr.nsDeletions, nsName)
+	write := appMgr.deleteNamespaceResources(nsName)
+	log.Infof("Removed the virtual servers of deleted namespace '%v'", nsName)
+	return write
+}
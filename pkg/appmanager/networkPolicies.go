@@ -0,0 +1,371 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Interval at which the NetworkPolicies of the pods of pools are checked
+const networkPolicyCheckInterval = time.Minute
+
+// Paths of the NetworkPolicies of a namespace, the networking API first,
+// then the extensions API of older clusters
+var networkPolicyPaths = []string{
+	"/apis/networking.k8s.io/v1/namespaces/%s/networkpolicies",
+	"/apis/extensions/v1beta1/namespaces/%s/networkpolicies",
+}
+
+var networkPolicyBlockedPools = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Subsystem: "network_policy",
+	Name:      "blocked_pools",
+	Help: "Number of pools with pods whose NetworkPolicies block traffic " +
+		"from the BIG-IP source addresses.",
+})
+
+// The parts of a NetworkPolicy that decide whether the BIG-IP reaches a
+// pod. The client API predates ipBlock peers, so policies are decoded here.
+type networkPolicy struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		PodSelector metav1.LabelSelector `json:"podSelector"`
+		Ingress     []networkPolicyRule  `json:"ingress"`
+		PolicyTypes []string             `json:"policyTypes"`
+	} `json:"spec"`
+}
+
+type networkPolicyRule struct {
+	Ports []struct {
+		Port *intstr.IntOrString `json:"port"`
+	} `json:"ports"`
+	From []struct {
+		IPBlock *struct {
+			CIDR   string   `json:"cidr"`
+			Except []string `json:"except"`
+		} `json:"ipBlock"`
+	} `json:"from"`
+}
+
+// Parse the addresses the BIG-IP sends traffic to pods from, its self IPs
+// and SNAT pools, as CIDRs
+func ParseSourceCIDRs(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(entry))
+		if nil != err {
+			return nil, fmt.Errorf("'%s' is not a CIDR", entry)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Whether a network contains all the addresses of another
+func netContains(outer, inner *net.IPNet) bool {
+	outerOnes, outerBits := outer.Mask.Size()
+	innerOnes, innerBits := inner.Mask.Size()
+	return outerBits == innerBits && outerOnes <= innerOnes &&
+		outer.Contains(inner.IP)
+}
+
+// Whether two networks share addresses
+func netsOverlap(a, b *net.IPNet) bool {
+	return a.Contains(b.IP) || b.Contains(a.IP)
+}
+
+// Whether a rule allows traffic to a port of a pod, given by number and by
+// name, whatever the protocol
+func (rule networkPolicyRule) allowsPort(port int32, portName string) bool {
+	if 0 == len(rule.Ports) {
+		return true
+	}
+	for _, p := range rule.Ports {
+		if nil == p.Port ||
+			(intstr.Int == p.Port.Type && port == p.Port.IntVal) ||
+			(intstr.String == p.Port.Type && "" != portName &&
+				portName == p.Port.StrVal) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a rule allows traffic from all the source addresses. Pod and
+// namespace selectors never match the BIG-IP, only ipBlock peers do.
+func (rule networkPolicyRule) allowsSources(sources []*net.IPNet) bool {
+	if 0 == len(rule.From) {
+		return true
+	}
+	for _, src := range sources {
+		allowed := false
+		for _, peer := range rule.From {
+			if nil == peer.IPBlock {
+				continue
+			}
+			_, block, err := net.ParseCIDR(peer.IPBlock.CIDR)
+			if nil != err || !netContains(block, src) {
+				continue
+			}
+			excepted := false
+			for _, except := range peer.IPBlock.Except {
+				_, exceptNet, err := net.ParseCIDR(except)
+				if nil == err && netsOverlap(exceptNet, src) {
+					excepted = true
+					break
+				}
+			}
+			if !excepted {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether a policy isolates the pods it selects from incoming traffic
+func (policy networkPolicy) isolatesIngress() bool {
+	if 0 == len(policy.Spec.PolicyTypes) {
+		return true
+	}
+	for _, policyType := range policy.Spec.PolicyTypes {
+		if "Ingress" == policyType {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the NetworkPolicies of a namespace let the BIG-IP reach a port of
+// a pod. A pod selected by no policy accepts all traffic, otherwise one rule
+// of the policies selecting it must allow the port from all the sources.
+// Returns the names of the policies selecting a blocked pod.
+func policiesAllow(
+	policies []networkPolicy,
+	podLabels map[string]string,
+	port int32,
+	portName string,
+	sources []*net.IPNet,
+) (bool, []string) {
+	var selecting []string
+	for _, policy := range policies {
+		if !policy.isolatesIngress() {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(
+			&policy.Spec.PodSelector)
+		if nil != err || !selector.Matches(labels.Set(podLabels)) {
+			continue
+		}
+		for _, rule := range policy.Spec.Ingress {
+			if rule.allowsPort(port, portName) && rule.allowsSources(sources) {
+				return true, nil
+			}
+		}
+		selecting = append(selecting, policy.Metadata.Name)
+	}
+	return 0 == len(selecting), selecting
+}
+
+// List the NetworkPolicies of a namespace
+func (appMgr *Manager) listNetworkPolicies(
+	namespace string,
+) ([]networkPolicy, error) {
+	var err error
+	for _, path := range networkPolicyPaths {
+		var data []byte
+		data, err = appMgr.restClientv1beta1.Get().AbsPath(
+			fmt.Sprintf(path, namespace)).DoRaw()
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if nil != err {
+			return nil, err
+		}
+		var list struct {
+			Items []networkPolicy `json:"items"`
+		}
+		if err = json.Unmarshal(data, &list); nil != err {
+			return nil, err
+		}
+		return list.Items, nil
+	}
+	return nil, err
+}
+
+// Port of a pod targeted by a service port, by number and by name
+func podTargetPort(
+	pod *v1.Pod,
+	targetPort intstr.IntOrString,
+) (int32, string, bool) {
+	for _, container := range pod.Spec.Containers {
+		port, ok := containerPort(container, targetPort)
+		if !ok {
+			continue
+		}
+		for _, p := range container.Ports {
+			if port == p.ContainerPort {
+				return port, p.Name, true
+			}
+		}
+		return port, "", true
+	}
+	return 0, "", false
+}
+
+// Check whether the NetworkPolicies of the pods of the pools let the BIG-IP
+// in, catching virtual servers that are up but whose connections time out.
+// Only pools of endpoints are checked, the BIG-IP sends their traffic from
+// its own addresses straight to the pods. A Warning Event is recorded on the
+// service when its pool becomes blocked.
+func (appMgr *Manager) checkNetworkPolicies() {
+	keys := make(map[serviceKey]bool)
+	appMgr.resources.Lock()
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if cfg.MetaData.Active && !appMgr.usesNodePort(cfg) {
+			keys[key] = true
+		}
+	})
+	appMgr.resources.Unlock()
+
+	policies := make(map[string][]networkPolicy)
+	blocked := make(map[serviceKey]bool)
+	for key := range keys {
+		nsPolicies, ok := policies[key.Namespace]
+		if !ok {
+			var err error
+			nsPolicies, err = appMgr.listNetworkPolicies(key.Namespace)
+			if nil != err {
+				log.Warningf("Unable to list the NetworkPolicies of "+
+					"namespace '%v': %v", key.Namespace, err)
+			}
+			policies[key.Namespace] = nsPolicies
+		}
+		if 0 == len(nsPolicies) {
+			continue
+		}
+		message, isBlocked := appMgr.poolBlocked(key, nsPolicies)
+		if !isBlocked {
+			continue
+		}
+		blocked[key] = true
+		if !appMgr.networkPolicyBlocked[key] {
+			log.Warningf("%v", message)
+			appMgr.recordServiceEvent(serviceQueueKey{
+				Namespace:   key.Namespace,
+				ServiceName: key.ServiceName,
+			}, v1.EventTypeWarning, "NetworkPolicyBlocksBigIP", message)
+		}
+	}
+	appMgr.networkPolicyBlocked = blocked
+	networkPolicyBlockedPools.Set(float64(len(blocked)))
+}
+
+// Whether NetworkPolicies block the BIG-IP from some pods of the pool of a
+// service port, and why
+func (appMgr *Manager) poolBlocked(
+	key serviceKey,
+	policies []networkPolicy,
+) (string, bool) {
+	appInf, ok := appMgr.getNamespaceInformer(key.Namespace)
+	if !ok {
+		return "", false
+	}
+	obj, found, err := appInf.svcInformer.GetIndexer().GetByKey(
+		key.Namespace + "/" + key.ServiceName)
+	if nil != err || !found {
+		return "", false
+	}
+	svc := obj.(*v1.Service)
+	if 0 == len(svc.Spec.Selector) {
+		return "", false
+	}
+	var targetPort intstr.IntOrString
+	found = false
+	for _, port := range svc.Spec.Ports {
+		if port.Port == key.ServicePort {
+			targetPort = port.TargetPort
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", false
+	}
+	if intstr.Int == targetPort.Type && 0 == targetPort.IntVal {
+		targetPort = intstr.FromInt(int(key.ServicePort))
+	}
+
+	pods, err := appMgr.servicePods(svc)
+	if nil != err {
+		log.Warningf("Unable to list pods of service '%s/%s': %v",
+			key.Namespace, key.ServiceName, err)
+		return "", false
+	}
+	var podCount, blockedCount int
+	blocking := make(map[string]bool)
+	for _, pod := range pods {
+		if "" == pod.Status.PodIP {
+			continue
+		}
+		port, portName, ok := podTargetPort(pod, targetPort)
+		if !ok {
+			continue
+		}
+		podCount++
+		allowed, names := policiesAllow(policies, pod.ObjectMeta.Labels,
+			port, portName, appMgr.bigipSources)
+		if !allowed {
+			blockedCount++
+			for _, name := range names {
+				blocking[name] = true
+			}
+		}
+	}
+	if 0 == blockedCount {
+		return "", false
+	}
+	var names []string
+	for name := range blocking {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("NetworkPolicies %v of namespace '%v' block traffic "+
+		"from the BIG-IP to %v of %v pods of port %v of service '%v'",
+		strings.Join(names, ","), key.Namespace, blockedCount, podCount,
+		key.ServicePort, key.ServiceName), true
+}
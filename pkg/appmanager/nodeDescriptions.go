@@ -0,0 +1,107 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Describe the pod behind an endpoint address, empty if the address does
+// not reference a pod
+func describeEndpoint(addr v1.EndpointAddress) string {
+	if nil == addr.TargetRef || "Pod" != addr.TargetRef.Kind {
+		return ""
+	}
+	desc := fmt.Sprintf("Pod %s/%s", addr.TargetRef.Namespace,
+		addr.TargetRef.Name)
+	if nil != addr.NodeName && "" != *addr.NodeName {
+		desc += " on node " + *addr.NodeName
+	}
+	return desc
+}
+
+// Names of the Nodes by the address used for NodePort pool members
+func (appMgr *Manager) getNodeNames(nodes []v1.Node) map[string]string {
+	addrType := appMgr.nodeAddressType()
+	names := make(map[string]string)
+	for _, node := range nodes {
+		if node.Spec.Unschedulable {
+			continue
+		}
+		for _, addr := range node.Status.Addresses {
+			if addr.Type == addrType {
+				names[addr.Address] = node.ObjectMeta.Name
+			}
+		}
+	}
+	return names
+}
+
+// Remember the names of the Nodes to describe NodePort pool members
+func (appMgr *Manager) setNodeNames(obj interface{}) {
+	nodes, ok := obj.([]v1.Node)
+	if !ok {
+		return
+	}
+	names := appMgr.getNodeNames(nodes)
+	appMgr.nodeNamesMutex.Lock()
+	defer appMgr.nodeNamesMutex.Unlock()
+	appMgr.nodeNames = names
+}
+
+// Add the BIG-IP nodes of the pool members of each partition, described
+// with the pod (cluster mode) or the Node (NodePort mode) behind them so
+// that operators can tell what a member is, and with the identity of the
+// cluster if several clusters share the BIG-IP
+func (appMgr *Manager) addNodes(resources PartitionMap) {
+	appMgr.nodeNamesMutex.Lock()
+	defer appMgr.nodeNamesMutex.Unlock()
+	for _, cfg := range resources {
+		descs := make(map[string]string)
+		for _, pool := range cfg.Pools {
+			for _, member := range pool.Members {
+				desc := member.Description
+				if "" == desc {
+					if name, ok := appMgr.nodeNames[member.Address]; ok {
+						desc = "Node " + name
+					}
+				}
+				if "" != desc && "" != appMgr.clusterIdentity {
+					desc += " in cluster " + appMgr.clusterIdentity
+				}
+				if "" != desc {
+					descs[member.Address] = desc
+				}
+			}
+		}
+		var addrs []string
+		for addr := range descs {
+			addrs = append(addrs, addr)
+		}
+		sort.Strings(addrs)
+		cfg.Nodes = nil
+		for _, addr := range addrs {
+			cfg.Nodes = append(cfg.Nodes, Node{
+				Name:        addr,
+				Description: descs[addr],
+			})
+		}
+	}
+}
@@ -0,0 +1,62 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Reasons a service has no node port for the pool of a virtual server in
+// nodeport mode
+const (
+	// The service is not of type NodePort, e.g. changed to ClusterIP
+	incorrectBackendServiceType = "IncorrectBackendServiceType"
+	// The port of the service has no node port, e.g. allocation failed as
+	// the node port range is exhausted
+	nodePortNotAllocated = "NodePortNotAllocated"
+)
+
+var missingNodePorts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Subsystem: "nodeport",
+	Name:      "missing_node_ports",
+	Help: "Number of pools in nodeport mode left without members as their " +
+		"service has no node port for them, by reason.",
+}, []string{"reason"})
+
+// Count the pools of a snapshot whose service has no node port, whether
+// their virtual server was deactivated or not
+func recordMissingNodePorts(snapshot *ResourceSnapshot) {
+	reasons := make(map[string]string)
+	snapshot.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		for _, pool := range cfg.Pools {
+			if "" != pool.NodePortError {
+				reasons[pool.Partition+"/"+pool.Name] = pool.NodePortError
+			}
+		}
+	})
+	counts := map[string]int{
+		incorrectBackendServiceType: 0,
+		nodePortNotAllocated:        0,
+	}
+	for _, reason := range reasons {
+		counts[reason] += 1
+	}
+	for reason, count := range counts {
+		missingNodePorts.WithLabelValues(reason).Set(float64(count))
+	}
+}
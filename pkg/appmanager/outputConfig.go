@@ -20,6 +20,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -28,23 +31,60 @@ import (
 )
 
 // Dump out the Virtual Server configs to a file
+// The resources lock is only held while taking a snapshot of the configs,
+// not while they are serialized and written.
 func (appMgr *Manager) outputConfig() {
 	appMgr.resources.Lock()
-	appMgr.outputConfigLocked()
+	snapshot := appMgr.resources.Snapshot()
 	appMgr.resources.Unlock()
+	appMgr.writeConfig(snapshot)
 }
 
 // Dump out the Virtual Server configs to a file
 // This function MUST be called with the virtualServers
 // lock held.
 func (appMgr *Manager) outputConfigLocked() {
-	// Initialize the Resources struct as empty
+	appMgr.writeConfig(appMgr.resources.Snapshot())
+}
+
+// Write the configs of a snapshot. Writes are serialized, and a snapshot
+// older than the last one written is dropped.
+func (appMgr *Manager) writeConfig(snapshot *ResourceSnapshot) {
+	appMgr.outputMutex.Lock()
+	defer appMgr.outputMutex.Unlock()
+	if snapshot.seq < appMgr.lastOutputSeq {
+		log.Debugf("Skipping config write of an outdated snapshot.")
+		return
+	}
+	if appMgr.Frozen() {
+		log.Debugf("Skipping config write during the change freeze.")
+		return
+	}
 
 	// Organize the data as a map of arrays of resources (per partition)
 	resources := PartitionMap{}
+	owned := appMgr.snapshotOwnedConfigs(snapshot)
+	// Host names of the virtual servers written, for the DNS publisher
+	dnsRecords := make(map[string]string)
+	// Pools of endpoints in nodeport mode, without the node monitor
+	clusterPools := make(map[string]bool)
+	// Records of the data groups filled from the virtual servers, by data
+	// group name
+	vsDgs := map[string]*InternalDataGroup{
+		sorryServerPoolsDgName: NewInternalDataGroup(
+			sorryServerPoolsDgName, DEFAULT_PARTITION),
+		sorryServerPagesDgName: NewInternalDataGroup(
+			sorryServerPagesDgName, DEFAULT_PARTITION),
+		sorryServerCodesDgName: NewInternalDataGroup(
+			sorryServerCodesDgName, DEFAULT_PARTITION),
+		hostRedirectsDgName: NewInternalDataGroup(
+			hostRedirectsDgName, DEFAULT_PARTITION),
+		universalPersistenceDgName: NewInternalDataGroup(
+			universalPersistenceDgName, DEFAULT_PARTITION),
+	}
 
 	// Filter the configs to only those that have active services
-	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+	snapshot.ForEach(func(key serviceKey, cfg *ResourceConfig) {
 		if cfg.MetaData.Active == true {
 			initPartitionData(resources, cfg.Virtual.Partition)
 
@@ -70,28 +110,31 @@ func (appMgr *Manager) outputConfigLocked() {
 					appendIApp(resources[cfg.Virtual.Partition].IApps, iapp)
 			} else {
 				// If it's not an IApp, then it's a Virtual Server
-				if nil != cfg.Virtual.VirtualAddress {
-					// Validate the IP address, and create the destination
-					addr := net.ParseIP(cfg.Virtual.VirtualAddress.BindAddr)
-					if nil != addr {
-						var format string
-						if nil != addr.To4() {
-							format = "/%s/%s:%d"
-						} else {
-							format = "/%s/%s.%d"
-						}
-						cfg.Virtual.Destination = fmt.Sprintf(
-							format,
-							cfg.Virtual.Partition,
-							cfg.Virtual.VirtualAddress.BindAddr,
-							cfg.Virtual.VirtualAddress.Port)
-						resources[cfg.Virtual.Partition].Virtuals =
-							appendVirtual(resources[cfg.Virtual.Partition].Virtuals, cfg.Virtual)
+				if nil != cfg.Virtual.VirtualAddress &&
+					nil != net.ParseIP(cfg.Virtual.VirtualAddress.BindAddr) {
+					// Create the destination, and the IPv6 virtual server of
+					// dual-stack virtual servers
+					addDNSRecords(dnsRecords, cfg)
+					for _, vsCfg := range dualStackConfigs(cfg) {
+						vsCfg.Virtual.Destination = virtualDestination(
+							vsCfg.Virtual.Partition,
+							vsCfg.Virtual.VirtualAddress.BindAddr,
+							vsCfg.Virtual.VirtualAddress.Port)
+						resources[vsCfg.Virtual.Partition].Virtuals =
+							appendVirtual(resources[vsCfg.Virtual.Partition].Virtuals,
+								vsCfg.Virtual)
+						addSorryServerRecords(vsDgs, vsCfg)
+						addHostRedirectRecords(vsDgs[hostRedirectsDgName], vsCfg)
+						addUniversalPersistenceRecords(
+							vsDgs[universalPersistenceDgName], vsCfg)
 					}
 				}
 			}
 
 			for _, p := range cfg.Pools {
+				if !appMgr.usesNodePort(cfg) {
+					clusterPools[p.Partition+"/"+p.Name] = true
+				}
 				found := false
 				initPartitionData(resources, p.Partition)
 				// Differentiate pools that belong to IApps, don't create the pool
@@ -116,6 +159,11 @@ func (appMgr *Manager) outputConfigLocked() {
 		}
 	})
 
+	if appMgr.isNodePort && appMgr.nodeMonitor.Interval > 0 {
+		addNodeMonitor(resources, appMgr.nodeMonitor, clusterPools)
+	}
+	appMgr.addNodes(resources)
+
 	// To allow the ssl passthrough iRule to be associated with a virtual,
 	// it must have at least one client or server SSL profile associated with
 	// it. If the virtual doesn't have any of either type, we force it to take
@@ -124,8 +172,8 @@ func (appMgr *Manager) outputConfigLocked() {
 		for vKey, virtual := range partitionConfig.Virtuals {
 			for _, irule := range virtual.IRules {
 				if strings.Contains(irule, sslPassthroughIRuleName) {
-					clientProfCt := virtual.GetProfileCountByContext(customProfileClient)
-					serverProfCt := virtual.GetProfileCountByContext(customProfileServer)
+					clientProfCt := virtual.GetSslProfileCountByContext(customProfileClient)
+					serverProfCt := virtual.GetSslProfileCountByContext(customProfileServer)
 					if 0 == clientProfCt && 0 == serverProfCt {
 						sslProf := "Common/clientssl"
 						resources[partition].Virtuals[vKey].AddFrontendSslProfileName(sslProf)
@@ -135,17 +183,52 @@ func (appMgr *Manager) outputConfigLocked() {
 		}
 	}
 
+	appMgr.customProfiles.Lock()
 	for _, profile := range appMgr.customProfiles.profs {
 		initPartitionData(resources, profile.Partition)
-		resources[profile.Partition].CustomProfiles = append(resources[profile.Partition].CustomProfiles, profile)
+		resources[profile.Partition].CustomProfiles = appendCustomProfile(
+			resources[profile.Partition].CustomProfiles, profile)
 	}
-	for _, irule := range appMgr.irulesMap {
+	appMgr.customProfiles.Unlock()
+	usedIRules := virtualIRules(resources)
+	appMgr.irulesMutex.Lock()
+	for key, irule := range appMgr.irulesMap {
+		if !onDemandIRuleUsed(usedIRules, key) {
+			continue
+		}
 		initPartitionData(resources, irule.Partition)
 		resources[irule.Partition].IRules = append(resources[irule.Partition].IRules, *irule)
 	}
-	for _, intDg := range appMgr.intDgMap {
+	appMgr.irulesMutex.Unlock()
+	appMgr.intDgMutex.Lock()
+	for key, intDg := range appMgr.intDgMap {
+		if !onDemandDataGroupUsed(usedIRules, key) {
+			continue
+		}
 		initPartitionData(resources, intDg.Partition)
-		resources[intDg.Partition].InternalDataGroups = append(resources[intDg.Partition].InternalDataGroups, *intDg)
+		dg := *intDg
+		if records, ok := vsDgs[intDg.Name]; ok &&
+			DEFAULT_PARTITION == intDg.Partition {
+			dg.Records = records.Records
+		} else if nil != intDg.Records {
+			dg.Records = append(InternalDataGroupRecords{}, intDg.Records...)
+		}
+		resources[intDg.Partition].InternalDataGroups = append(resources[intDg.Partition].InternalDataGroups, dg)
+	}
+	appMgr.intDgMutex.Unlock()
+	for _, dg := range appMgr.hostDgs.dataGroups(appMgr.shardDataGroups) {
+		initPartitionData(resources, dg.Partition)
+		resources[dg.Partition].InternalDataGroups = append(
+			resources[dg.Partition].InternalDataGroups, dg)
+	}
+	if appMgr.adoptLegacyNames {
+		appMgr.addPendingAdoptions(resources, time.Now())
+	}
+	clearRemovedSettings(resources, appMgr.lastResources)
+	// Write unchanged resources the same way, whatever the order they were
+	// gathered in
+	for _, partitionConfig := range resources {
+		sortPartitionConfig(partitionConfig)
 	}
 
 	// Update resources to conform to the CCCL schema and empty out unneeded fields
@@ -160,12 +243,28 @@ func (appMgr *Manager) outputConfigLocked() {
 
 	if appMgr.vsQueue.Len() == 0 && appMgr.nsQueue.Len() == 0 ||
 		appMgr.initialState == true {
+		if appMgr.logConfigDiff {
+			for _, change := range diffResources(appMgr.lastResources, resources) {
+				log.Infof("Config change: %s", change)
+			}
+		}
+		// Copied before the debug output strips the custom profiles
+		written := snapshotResources(resources)
+		appMgr.lastOutputSeq = snapshot.seq
+		writeStart := time.Now()
 		doneCh, errCh, err := appMgr.ConfigWriter().SendSection("resources", resources)
 		if nil != err {
 			log.Warningf("Failed to write Big-IP config data: %v", err)
 		} else {
 			select {
 			case <-doneCh:
+				recordManagedObjects(resources)
+				if appMgr.adoptLegacyNames {
+					appMgr.recordAdoptions(resources, time.Now())
+				}
+				recordMissingNodePorts(snapshot)
+				appMgr.recordCertificateExpiry()
+				appMgr.queueAppliedConfigs(owned)
 				virtualCount := 0
 				for _, partitionConfig := range resources {
 					virtualCount += len(partitionConfig.Virtuals)
@@ -185,14 +284,318 @@ func (appMgr *Manager) outputConfigLocked() {
 				}
 			case e := <-errCh:
 				log.Warningf("Failed to write Big-IP config data: %v", e)
+				err = e
 			case <-time.After(time.Second):
 				log.Warning("Did not receive config write response in 1s")
+				err = fmt.Errorf("no config write response in 1s")
 			}
 		}
+		appMgr.traces.written(writeStart, err)
+		if nil == err {
+			// Only written resources are diffed against, so the changes of
+			// a failed write are logged again with the next one
+			appMgr.lastResources = written
+			// The resources are written, a pending resync can be applied
+			appMgr.writeResyncSection()
+		}
+		if nil != appMgr.dnsPublisher {
+			appMgr.vipTombstones.addDNSRecords(dnsRecords)
+			appMgr.dnsPublisher.Publish(dnsRecords)
+		}
+		if !appMgr.initialState {
+			appMgr.initialSyncDone()
+		}
 		appMgr.initialState = true
 	}
 }
 
+// Full paths of the iRules of the virtual servers of a config
+func virtualIRules(resources PartitionMap) map[string]bool {
+	used := make(map[string]bool)
+	for _, partitionConfig := range resources {
+		for _, virtual := range partitionConfig.Virtuals {
+			for _, irule := range virtual.IRules {
+				used[irule] = true
+			}
+		}
+	}
+	return used
+}
+
+// Whether an iRule is written: always, unless it is only written while a
+// virtual server uses it
+func onDemandIRuleUsed(used map[string]bool, key nameRef) bool {
+	if _, ok := onDemandIRules[key.Name]; !ok {
+		return true
+	}
+	return used["/"+key.Partition+"/"+key.Name]
+}
+
+// Whether an internal data group is written: always, unless it is read by
+// an iRule written only while a virtual server uses it
+func onDemandDataGroupUsed(used map[string]bool, key nameRef) bool {
+	for rule, dgs := range onDemandIRules {
+		for _, dg := range dgs {
+			if dg == key.Name {
+				return used["/"+key.Partition+"/"+rule]
+			}
+		}
+	}
+	return true
+}
+
+// Add the fallback pool, maintenance page and its status code of a virtual
+// server to the data groups of the sorry server iRule
+func addSorryServerRecords(
+	dgs map[string]*InternalDataGroup,
+	cfg *ResourceConfig,
+) {
+	vsPath := fmt.Sprintf("/%s/%s", cfg.Virtual.Partition,
+		cfg.Virtual.VirtualServerName)
+	if "" != cfg.MetaData.FallbackPool {
+		dgs[sorryServerPoolsDgName].AddOrUpdateRecord(
+			vsPath, cfg.MetaData.FallbackPool)
+	}
+	if "" != cfg.MetaData.MaintenancePage {
+		dgs[sorryServerPagesDgName].AddOrUpdateRecord(
+			vsPath, cfg.MetaData.MaintenancePage)
+		if 0 != cfg.MetaData.MaintenanceStatus {
+			dgs[sorryServerCodesDgName].AddOrUpdateRecord(
+				vsPath, strconv.Itoa(cfg.MetaData.MaintenanceStatus))
+		}
+	}
+}
+
+// Add the node-level monitor to each partition with pools using it and
+// attach it to all of them, alongside any application monitors, or only to
+// the pools without application monitors if it is their default. Pools of
+// endpoints, listed in clusterPools, and FQDN pools do not use the NodePort
+// and are left unchanged.
+func addNodeMonitor(
+	resources PartitionMap,
+	cfg NodeMonitorConfig,
+	clusterPools map[string]bool,
+) {
+	for partition, partitionConfig := range resources {
+		fullName := fmt.Sprintf("/%s/%s", partition, nodeMonitorName)
+		var used bool
+		for i, pool := range partitionConfig.Pools {
+			if clusterPools[partition+"/"+pool.Name] || nil != pool.Fqdn ||
+				(cfg.DefaultOnly && 0 != len(pool.MonitorNames)) {
+				continue
+			}
+			// Copy the names, the slice is shared with the stored config
+			names := append([]string{}, pool.MonitorNames...)
+			partitionConfig.Pools[i].MonitorNames = append(names, fullName)
+			used = true
+		}
+		if !used {
+			continue
+		}
+		monitor := Monitor{
+			Name:      nodeMonitorName,
+			Partition: partition,
+			Interval:  cfg.Interval,
+			Protocol:  "tcp",
+			Timeout:   cfg.Timeout,
+		}
+		partitionConfig.Monitors = appendMonitor(partitionConfig.Monitors, monitor)
+	}
+}
+
+// The driver leaves the security log profiles, bandwidth controller policy,
+// clone pools, per-request policy, persistence and source port of a virtual
+// server alone while they are unset. Once written, their removal is written
+// as an empty value, or the default source port, so they are taken off the
+// BIG-IP virtual server.
+func clearRemovedSettings(resources, written PartitionMap) {
+	for partition, cfg := range resources {
+		last, ok := written[partition]
+		if !ok {
+			continue
+		}
+		applied := make(map[string]*Virtual)
+		for i := range last.Virtuals {
+			applied[last.Virtuals[i].VirtualServerName] = &last.Virtuals[i]
+		}
+		for i := range cfg.Virtuals {
+			v := &cfg.Virtuals[i]
+			prev, ok := applied[v.VirtualServerName]
+			if !ok {
+				continue
+			}
+			if nil == v.SecurityLogProfiles &&
+				nil != prev.SecurityLogProfiles &&
+				0 != len(*prev.SecurityLogProfiles) {
+				v.SecurityLogProfiles = &[]string{}
+			}
+			if nil == v.ClonePools && nil != prev.ClonePools &&
+				0 != len(*prev.ClonePools) {
+				v.ClonePools = &[]clonePool{}
+			}
+			v.BwcPolicy = clearRemovedString(v.BwcPolicy, prev.BwcPolicy)
+			v.PerRequestPolicy = clearRemovedString(v.PerRequestPolicy,
+				prev.PerRequestPolicy)
+			v.Persist = clearRemovedString(v.Persist, prev.Persist)
+			if "" == v.SourcePort && "" != prev.SourcePort &&
+				sourcePortPreserve != prev.SourcePort {
+				v.SourcePort = sourcePortPreserve
+			}
+		}
+	}
+}
+
+// An empty value for a setting written before and now unset
+func clearRemovedString(value, prev *string) *string {
+	if nil == value && nil != prev && "" != *prev {
+		empty := ""
+		return &empty
+	}
+	return value
+}
+
+// Copy the per-partition configs so later changes to the written
+// resources do not alter the stored copy
+func snapshotResources(resources PartitionMap) PartitionMap {
+	snapshot := PartitionMap{}
+	for partition, cfg := range resources {
+		cfgCopy := *cfg
+		snapshot[partition] = &cfgCopy
+	}
+	return snapshot
+}
+
+// Compare two sets of resources and return a human readable, sorted list
+// of the virtual servers, pools, pool members and profiles that were added,
+// removed or changed.
+func diffResources(oldRs, newRs PartitionMap) []string {
+	var changes []string
+	partitions := make(map[string]bool)
+	for partition, _ := range oldRs {
+		partitions[partition] = true
+	}
+	for partition, _ := range newRs {
+		partitions[partition] = true
+	}
+	for partition, _ := range partitions {
+		oldCfg, ok := oldRs[partition]
+		if !ok {
+			oldCfg = &BigIPConfig{}
+		}
+		newCfg, ok := newRs[partition]
+		if !ok {
+			newCfg = &BigIPConfig{}
+		}
+
+		oldVirtuals := make(map[string]Virtual)
+		for _, v := range oldCfg.Virtuals {
+			oldVirtuals[v.VirtualServerName] = v
+		}
+		newVirtuals := make(map[string]Virtual)
+		for _, v := range newCfg.Virtuals {
+			newVirtuals[v.VirtualServerName] = v
+		}
+		for name, v := range newVirtuals {
+			fullName := fmt.Sprintf("/%s/%s", partition, name)
+			oldV, found := oldVirtuals[name]
+			if !found {
+				changes = append(changes, "added virtual server "+fullName)
+			} else if !reflect.DeepEqual(oldV.Profiles, v.Profiles) {
+				changes = append(changes, "changed profiles of virtual server "+fullName)
+			} else if !reflect.DeepEqual(oldV, v) {
+				changes = append(changes, "changed virtual server "+fullName)
+			}
+		}
+		for name, _ := range oldVirtuals {
+			if _, found := newVirtuals[name]; !found {
+				changes = append(changes,
+					fmt.Sprintf("removed virtual server /%s/%s", partition, name))
+			}
+		}
+
+		oldPools := make(map[string]Pool)
+		for _, p := range oldCfg.Pools {
+			oldPools[p.Name] = p
+		}
+		newPools := make(map[string]Pool)
+		for _, p := range newCfg.Pools {
+			newPools[p.Name] = p
+		}
+		for name, p := range newPools {
+			fullName := fmt.Sprintf("/%s/%s", partition, name)
+			oldP, found := oldPools[name]
+			if !found {
+				changes = append(changes, "added pool "+fullName)
+				continue
+			}
+			changes = append(changes, diffPoolMembers(fullName, oldP, p)...)
+			oldP.Members = nil
+			p.Members = nil
+			if !reflect.DeepEqual(oldP, p) {
+				changes = append(changes, "changed pool "+fullName)
+			}
+		}
+		for name, _ := range oldPools {
+			if _, found := newPools[name]; !found {
+				changes = append(changes,
+					fmt.Sprintf("removed pool /%s/%s", partition, name))
+			}
+		}
+
+		oldProfs := make(map[string]CustomProfile)
+		for _, prof := range oldCfg.CustomProfiles {
+			oldProfs[prof.Name] = prof
+		}
+		newProfs := make(map[string]CustomProfile)
+		for _, prof := range newCfg.CustomProfiles {
+			newProfs[prof.Name] = prof
+		}
+		for name, prof := range newProfs {
+			fullName := fmt.Sprintf("/%s/%s", partition, name)
+			oldProf, found := oldProfs[name]
+			if !found {
+				changes = append(changes, "added profile "+fullName)
+			} else if !reflect.DeepEqual(oldProf, prof) {
+				changes = append(changes, "changed profile "+fullName)
+			}
+		}
+		for name, _ := range oldProfs {
+			if _, found := newProfs[name]; !found {
+				changes = append(changes,
+					fmt.Sprintf("removed profile /%s/%s", partition, name))
+			}
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// Return the pool members that were added to or removed from a pool
+func diffPoolMembers(poolName string, oldPool, newPool Pool) []string {
+	var changes []string
+	oldMembers := make(map[string]bool)
+	for _, m := range oldPool.Members {
+		oldMembers[fmt.Sprintf("%s:%d", m.Address, m.Port)] = true
+	}
+	newMembers := make(map[string]bool)
+	for _, m := range newPool.Members {
+		newMembers[fmt.Sprintf("%s:%d", m.Address, m.Port)] = true
+	}
+	for member, _ := range newMembers {
+		if !oldMembers[member] {
+			changes = append(changes,
+				fmt.Sprintf("added member %s to pool %s", member, poolName))
+		}
+	}
+	for member, _ := range oldMembers {
+		if !newMembers[member] {
+			changes = append(changes,
+				fmt.Sprintf("removed member %s from pool %s", member, poolName))
+		}
+	}
+	return changes
+}
+
 // Parse the SSL Profile and append it to the list
 func appendSslProfile(profs []ProfileRef, profile string, context string) []ProfileRef {
 	p := strings.Split(profile, "/")
@@ -269,6 +672,16 @@ func appendPolicy(rsPolicies []Policy, p Policy) []Policy {
 	return append(rsPolicies, p)
 }
 
+func appendCustomProfile(rsProfiles []CustomProfile, p CustomProfile) []CustomProfile {
+	for _, rp := range rsProfiles {
+		if rp.Name == p.Name &&
+			rp.Partition == p.Partition {
+			return rsProfiles
+		}
+	}
+	return append(rsProfiles, p)
+}
+
 // Reformat the resources for a partition to be CCCL-schema compliant
 func reformatPartitionResources(resources PartitionMap, partition string, wgp *sync.WaitGroup) {
 	defer wgp.Done()
@@ -343,6 +756,7 @@ func reformatPools(resources PartitionMap, partition string, wg *sync.WaitGroup)
 		resources[partition].Pools[i].Partition = ""
 		resources[partition].Pools[i].ServicePort = 0
 		resources[partition].Pools[i].ServiceName = ""
+		resources[partition].Pools[i].ServiceNamespace = ""
 	}
 }
 
@@ -350,11 +764,29 @@ func reformatPools(resources PartitionMap, partition string, wg *sync.WaitGroup)
 func reformatVirtuals(resources PartitionMap, partition string, wg *sync.WaitGroup) {
 	defer wg.Done()
 	for i, _ := range resources[partition].Virtuals {
-		resources[partition].Virtuals[i].Enabled = true
+		resources[partition].Virtuals[i].Enabled =
+			!resources[partition].Virtuals[i].Disabled
 
 		// Add the profiles to the Virtual Server
 		mode := strings.ToLower(resources[partition].Virtuals[i].Mode)
-		if mode == "http" {
+		virtualType := resources[partition].Virtuals[i].VirtualType
+		if virtualType == virtualTypePerformanceL4 ||
+			virtualType == virtualTypeIpForwarding {
+			// FastL4 replaces the protocol profiles of full proxies
+			if mode == "udp" {
+				resources[partition].Virtuals[i].IpProtocol = "udp"
+			} else {
+				resources[partition].Virtuals[i].IpProtocol = "tcp"
+			}
+			profile := ProfileRef{Partition: "Common", Name: "fastL4", Context: "all"}
+			resources[partition].Virtuals[i].Profiles =
+				append(resources[partition].Virtuals[i].Profiles, profile)
+			if virtualType == virtualTypeIpForwarding {
+				// Forwards to the destination address, without a pool
+				resources[partition].Virtuals[i].IpForward = true
+				resources[partition].Virtuals[i].PoolName = ""
+			}
+		} else if mode == "http" {
 			resources[partition].Virtuals[i].IpProtocol = "tcp"
 			profile := ProfileRef{Partition: "Common", Name: "http", Context: "all"}
 			resources[partition].Virtuals[i].Profiles =
@@ -374,13 +806,21 @@ func reformatVirtuals(resources PartitionMap, partition string, wg *sync.WaitGro
 				appendSslProfile(resources[partition].Virtuals[i].Profiles, p, customProfileClient)
 		}
 
-		resources[partition].Virtuals[i].SourceAddrTranslation.Type = "automap"
+		if resources[partition].Virtuals[i].Transparent {
+			// The pool members see the address of the clients
+			resources[partition].Virtuals[i].SourceAddrTranslation.Type = "none"
+		} else {
+			resources[partition].Virtuals[i].SourceAddrTranslation.Type = "automap"
+		}
 
 		resources[partition].Virtuals[i].Partition = ""
 		resources[partition].Virtuals[i].VirtualAddress = nil
 		resources[partition].Virtuals[i].Balance = ""
 		resources[partition].Virtuals[i].Mode = ""
+		resources[partition].Virtuals[i].VirtualType = ""
+		resources[partition].Virtuals[i].Transparent = false
 		resources[partition].Virtuals[i].SslProfile = nil
+		resources[partition].Virtuals[i].ServerSslProfile = nil
 		resources[partition].Virtuals[i].IAppPoolMemberTable = nil
 	}
 }
@@ -0,0 +1,98 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	authv1 "k8s.io/client-go/pkg/apis/authorization/v1"
+)
+
+// Whether the controller may perform a verb on a resource in a namespace,
+// all namespaces if empty, as answered by a SelfSubjectAccessReview
+func (appMgr *Manager) canI(
+	verb, group, resource, subresource, namespace string,
+) (bool, error) {
+	review := &authv1.SelfSubjectAccessReview{
+		Spec: authv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &authv1.ResourceAttributes{
+				Namespace:   namespace,
+				Verb:        verb,
+				Group:       group,
+				Resource:    resource,
+				Subresource: subresource,
+			},
+		},
+	}
+	review, err := appMgr.kubeClient.AuthorizationV1().
+		SelfSubjectAccessReviews().Create(review)
+	if nil != err {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+// Whether a status write is permitted in all the namespaces. The write is
+// assumed to be permitted if the permission cannot be checked, such as on
+// clusters without the authorization API.
+func (appMgr *Manager) statusWritePermitted(
+	what string,
+	verb, group, resource, subresource string,
+	namespaces []string,
+) bool {
+	for _, namespace := range namespaces {
+		allowed, err := appMgr.canI(verb, group, resource, subresource,
+			namespace)
+		if nil != err {
+			log.Warningf("Unable to check the permission to update %v: %v",
+				what, err)
+			return true
+		}
+		if !allowed {
+			if "" != subresource {
+				resource += "/" + subresource
+			}
+			if "" == namespace {
+				namespace = "all namespaces"
+			}
+			log.Warningf("Not allowed to %v %v in %v, %v will not be updated",
+				verb, resource, namespace, what)
+			return false
+		}
+	}
+	return true
+}
+
+// Disable the Ingress status and ConfigMap status annotation updates that
+// the controller is not allowed to make in the watched namespaces, empty for
+// all namespaces, so that read-only controllers do not fail each update.
+// Must be called before Run.
+func (appMgr *Manager) CheckStatusPermissions(namespaces []string) {
+	if 0 == len(namespaces) {
+		namespaces = []string{""}
+	}
+	if !appMgr.ingressStatusDisabled {
+		appMgr.ingressStatusDisabled = !appMgr.statusWritePermitted(
+			"the status of Ingresses", "update", "extensions", "ingresses",
+			"status", namespaces)
+	}
+	if !appMgr.cfgMapStatusDisabled {
+		appMgr.cfgMapStatusDisabled = !appMgr.statusWritePermitted(
+			"the status annotation of ConfigMaps", "patch", "", "configmaps",
+			"", namespaces)
+	}
+}
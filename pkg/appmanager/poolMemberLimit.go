@@ -0,0 +1,104 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Parse the annotation limiting the members of the pools of a resource
+func parsePoolMemberLimit(val string) (int, error) {
+	limit, err := strconv.Atoi(strings.TrimSpace(val))
+	if nil != err {
+		return 0, err
+	}
+	if limit <= 0 {
+		return 0, fmt.Errorf("must be greater than zero")
+	}
+	return limit, nil
+}
+
+// Set the limit of the members of the pools of a resource from its
+// annotation, zero if not set
+func setPoolMemberLimit(
+	metaData *metaData,
+	annotations map[string]string,
+	resourceName string,
+) {
+	metaData.PoolMemberLimit = 0
+	if val, ok := annotations[poolMemberLimitAnnotation]; ok {
+		limit, err := parsePoolMemberLimit(val)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+				val, poolMemberLimitAnnotation, resourceName, err)
+			return
+		}
+		metaData.PoolMemberLimit = limit
+	}
+}
+
+// Limit of the members of the pools of a config, the smaller of the limits
+// of the controller and of the resource, so resources can lower the limit
+// of the controller but not raise it. Zero if there is no limit.
+func (appMgr *Manager) poolMemberLimit(rsCfg *ResourceConfig) int {
+	limit := appMgr.poolMemberLimitMax
+	if resLimit := rsCfg.MetaData.PoolMemberLimit; 0 != resLimit &&
+		(0 == limit || resLimit < limit) {
+		limit = resLimit
+	}
+	return limit
+}
+
+// Keep the members of a pool within the limit of its config, protecting the
+// BIG-IP from services with pathological numbers of endpoints, such as a
+// DaemonSet on thousands of Nodes. The members are kept in order of address
+// and port so each sync keeps the same ones. Returns the number of members
+// the pool would have had, zero if it is within the limit.
+func (appMgr *Manager) limitPoolMembers(rsCfg *ResourceConfig, index int) int {
+	limit := appMgr.poolMemberLimit(rsCfg)
+	members := rsCfg.Pools[index].Members
+	if 0 == limit || len(members) <= limit {
+		return 0
+	}
+	sorted := make(membersByAddress, len(members))
+	copy(sorted, members)
+	sort.Sort(sorted)
+	rsCfg.Pools[index].Members = sorted[:limit]
+	return len(members)
+}
+
+// Pool members in order of address and port
+type membersByAddress []Member
+
+func (slice membersByAddress) Len() int {
+	return len(slice)
+}
+
+func (slice membersByAddress) Less(i, j int) bool {
+	return slice[i].Address < slice[j].Address ||
+		(slice[i].Address == slice[j].Address &&
+			slice[i].Port < slice[j].Port)
+}
+
+func (slice membersByAddress) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
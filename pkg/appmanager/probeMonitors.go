@@ -0,0 +1,229 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Kubernetes defaults for unset probe fields
+const defaultProbePeriod = 10
+const defaultProbeTimeout = 1
+const defaultProbeFailureThreshold = 3
+
+// Give each pool of a config that has no health monitors a monitor derived
+// from the readinessProbe of the pods backing its service.
+func (appMgr *Manager) setProbeHealthMonitors(
+	rsCfg *ResourceConfig,
+	namespace string,
+	svcIndexer cache.Indexer,
+) {
+	for i, pool := range rsCfg.Pools {
+		if 0 != len(pool.MonitorNames) {
+			continue
+		}
+		if monitor, ok := appMgr.probeMonitor(pool,
+			pool.serviceNamespace(namespace), svcIndexer); ok {
+			rsCfg.SetMonitor(&rsCfg.Pools[i], monitor)
+		}
+	}
+}
+
+// Find a readinessProbe on the target port of a pool's service. The first
+// pod with such a probe is used, all pods of a service are expected to
+// share their probe definitions.
+func (appMgr *Manager) probeMonitor(
+	pool Pool,
+	namespace string,
+	svcIndexer cache.Indexer,
+) (Monitor, bool) {
+	obj, found, err := svcIndexer.GetByKey(namespace + "/" + pool.ServiceName)
+	if nil != err || !found {
+		return Monitor{}, false
+	}
+	svc := obj.(*v1.Service)
+	if 0 == len(svc.Spec.Selector) {
+		return Monitor{}, false
+	}
+	var targetPort intstr.IntOrString
+	found = false
+	for _, port := range svc.Spec.Ports {
+		if port.Port == pool.ServicePort {
+			targetPort = port.TargetPort
+			found = true
+			break
+		}
+	}
+	if !found {
+		return Monitor{}, false
+	}
+	if targetPort.Type == intstr.Int && 0 == targetPort.IntVal {
+		targetPort = intstr.FromInt(int(pool.ServicePort))
+	}
+
+	pods, err := appMgr.servicePods(svc)
+	if nil != err {
+		log.Warningf("Unable to list pods of service '%s/%s': %v",
+			namespace, pool.ServiceName, err)
+		return Monitor{}, false
+	}
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			if nil == container.ReadinessProbe {
+				continue
+			}
+			port, ok := containerPort(container, targetPort)
+			if !ok {
+				continue
+			}
+			return probeToMonitor(pool, container, port)
+		}
+	}
+	return Monitor{}, false
+}
+
+// Whether the namespace informers watch pods, only done for the features
+// reading their specs as pods are the most numerous objects of a cluster
+func (appMgr *Manager) watchesPods() bool {
+	return appMgr.probeMonitors ||
+		(0 != len(appMgr.bigipSources) && nil != appMgr.restClientv1beta1)
+}
+
+// The pods selected by a service, from the pod informer of its namespace
+func (appMgr *Manager) servicePods(svc *v1.Service) ([]*v1.Pod, error) {
+	namespace := svc.ObjectMeta.Namespace
+	appInf, ok := appMgr.getNamespaceInformer(namespace)
+	if !ok || nil == appInf.podInformer {
+		return nil, fmt.Errorf("pods of namespace '%s' are not watched",
+			namespace)
+	}
+	var pods []*v1.Pod
+	err := cache.ListAllByNamespace(appInf.podInformer.GetIndexer(),
+		namespace, labels.SelectorFromSet(svc.Spec.Selector),
+		func(obj interface{}) {
+			pods = append(pods, obj.(*v1.Pod))
+		})
+	return pods, err
+}
+
+// Resolve a port number or name against the ports of a container
+func containerPort(container v1.Container, port intstr.IntOrString) (int32, bool) {
+	if port.Type == intstr.Int {
+		if 0 == len(container.Ports) {
+			return port.IntVal, true
+		}
+		for _, p := range container.Ports {
+			if p.ContainerPort == port.IntVal {
+				return port.IntVal, true
+			}
+		}
+		return 0, false
+	}
+	for _, p := range container.Ports {
+		if p.Name == port.StrVal {
+			return p.ContainerPort, true
+		}
+	}
+	return 0, false
+}
+
+// Convert the readinessProbe of a container to a monitor. Only probes on the
+// port the pool sends traffic to can be expressed as a BIG-IP monitor.
+func probeToMonitor(
+	pool Pool,
+	container v1.Container,
+	targetPort int32,
+) (Monitor, bool) {
+	probe := container.ReadinessProbe
+	var protocol, send string
+	var probePort intstr.IntOrString
+	if nil != probe.HTTPGet {
+		protocol = "http"
+		if probe.HTTPGet.Scheme == v1.URISchemeHTTPS {
+			protocol = "https"
+		}
+		probePort = probe.HTTPGet.Port
+		send = probeSendString(probe.HTTPGet)
+	} else if nil != probe.TCPSocket {
+		protocol = "tcp"
+		probePort = probe.TCPSocket.Port
+	} else {
+		log.Debugf("Readiness probe of container '%s' for pool '%s' is not an "+
+			"http or tcp probe, not creating a monitor.", container.Name, pool.Name)
+		return Monitor{}, false
+	}
+	if port, ok := containerPort(container, probePort); !ok || port != targetPort {
+		log.Debugf("Readiness probe of container '%s' for pool '%s' does not "+
+			"use the service target port, not creating a monitor.",
+			container.Name, pool.Name)
+		return Monitor{}, false
+	}
+
+	interval := int(probe.PeriodSeconds)
+	if 0 == interval {
+		interval = defaultProbePeriod
+	}
+	timeout := int(probe.TimeoutSeconds)
+	if 0 == timeout {
+		timeout = defaultProbeTimeout
+	}
+	failures := int(probe.FailureThreshold)
+	if 0 == failures {
+		failures = defaultProbeFailureThreshold
+	}
+	return Monitor{
+		Name:      fmt.Sprintf("%s_0_%s", pool.Name, protocol),
+		Partition: pool.Partition,
+		Protocol:  protocol,
+		Interval:  interval,
+		// Mark members down after as many failures as Kubernetes would
+		Timeout: interval*failures + timeout,
+		Send:    send,
+	}, true
+}
+
+// Build the request of an http probe. The line endings are escaped the way
+// the BIG-IP expects them in a monitor send string.
+func probeSendString(get *v1.HTTPGetAction) string {
+	path := get.Path
+	if "" == path {
+		path = "/"
+	}
+	host := get.Host
+	var headers bytes.Buffer
+	for _, header := range get.HTTPHeaders {
+		if strings.EqualFold(header.Name, "Host") {
+			host = header.Value
+			continue
+		}
+		headers.WriteString(fmt.Sprintf(`%s: %s\r\n`, header.Name, header.Value))
+	}
+	if "" == host {
+		return fmt.Sprintf(`GET %s HTTP/1.0\r\n%s\r\n`, path, headers.String())
+	}
+	return fmt.Sprintf(`GET %s HTTP/1.1\r\nHost: %s\r\n%sConnection: Close\r\n\r\n`,
+		path, host, headers.String())
+}
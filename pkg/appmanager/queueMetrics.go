@@ -0,0 +1,274 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Interval at which the queues are checked for the depth warning and the
+// processing time and add rate metrics are updated
+const queueCheckInterval = 10 * time.Second
+
+// Minimum time between two depth warnings for the same queue
+const queueWarningInterval = time.Minute
+
+// Number of pending keys logged with a depth warning
+const queueDumpSize = 20
+
+const metricsNamespace = "k8s_bigip_ctlr"
+
+var (
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "depth",
+		Help:      "Current number of keys waiting in the work queue.",
+	}, []string{"queue"})
+	queueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "adds_total",
+		Help:      "Total number of keys added to the work queue.",
+	}, []string{"queue"})
+	queueAddRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "adds_per_second",
+		Help:      "Keys added per second over the last check interval.",
+	}, []string{"queue"})
+	queueLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "queue_latency_microseconds",
+		Help:      "Time a key waits in the work queue before being processed.",
+	}, []string{"queue"})
+	queueWorkDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "work_duration_microseconds",
+		Help:      "Time taken to process a key from the work queue.",
+	}, []string{"queue"})
+	queueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "retries_total",
+		Help:      "Total number of keys requeued after a failure.",
+	}, []string{"queue"})
+	queueLongestRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "workqueue",
+		Name:      "longest_running_processor_seconds",
+		Help:      "Time the oldest key still being processed has been running.",
+	}, []string{"queue"})
+)
+
+// Feeds the metrics of the named work queues to Prometheus
+type queueMetricsProvider struct{}
+
+func (queueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return queueDepth.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return queueAdds.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return queueLatency.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewWorkDurationMetric(
+	name string,
+) workqueue.SummaryMetric {
+	return queueWorkDuration.WithLabelValues(name)
+}
+
+func (queueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return queueRetries.WithLabelValues(name)
+}
+
+// Register the work queue, initial sync, route and inventory metrics with
+// the default Prometheus registry. Must be called before NewManager, queues
+// created earlier have no metrics.
+func EnableQueueMetrics() {
+	prometheus.MustRegister(queueDepth, queueAdds, queueAddRate, queueLatency,
+		queueWorkDuration, queueRetries, queueLongestRunning,
+		initialSyncComplete, initialSyncDuration, routesAdmitted,
+		routesRejected, networkPolicyBlockedPools, shadowedRules,
+		managedObjects, certificateExpiry, missingNodePorts,
+		legacyNameAdoptions)
+	workqueue.SetProvider(queueMetricsProvider{})
+	fairQueueMetricsEnabled = true
+}
+
+// Work queue that keeps track of its pending keys and of the keys being
+// processed, for the depth warning and the processing time metric
+type monitoredQueue struct {
+	workqueue.RateLimitingInterface
+	name string
+
+	mutex      sync.Mutex
+	pending    map[interface{}]struct{}
+	processing map[interface{}]time.Time
+	adds       int
+	// Adds counted and time of the last check
+	lastAdds  int
+	lastCheck time.Time
+	// Time of the last depth warning
+	lastWarning time.Time
+}
+
+func newMonitoredQueue(
+	queue workqueue.RateLimitingInterface,
+	name string,
+) *monitoredQueue {
+	return &monitoredQueue{
+		RateLimitingInterface: queue,
+		name:                  name,
+		pending:               make(map[interface{}]struct{}),
+		processing:            make(map[interface{}]time.Time),
+		lastCheck:             time.Now(),
+	}
+}
+
+func (q *monitoredQueue) track(item interface{}) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending[item] = struct{}{}
+	q.adds++
+}
+
+func (q *monitoredQueue) Add(item interface{}) {
+	q.track(item)
+	q.RateLimitingInterface.Add(item)
+}
+
+func (q *monitoredQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.track(item)
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+func (q *monitoredQueue) AddRateLimited(item interface{}) {
+	q.track(item)
+	q.RateLimitingInterface.AddRateLimited(item)
+}
+
+func (q *monitoredQueue) Get() (interface{}, bool) {
+	item, quit := q.RateLimitingInterface.Get()
+	if !quit {
+		q.mutex.Lock()
+		delete(q.pending, item)
+		q.processing[item] = time.Now()
+		q.mutex.Unlock()
+	}
+	return item, quit
+}
+
+func (q *monitoredQueue) Done(item interface{}) {
+	q.mutex.Lock()
+	delete(q.processing, item)
+	q.mutex.Unlock()
+	q.RateLimitingInterface.Done(item)
+}
+
+// Time the oldest key still being processed has been running
+func (q *monitoredQueue) longestRunning() time.Duration {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var longest time.Duration
+	for _, start := range q.processing {
+		if running := time.Since(start); running > longest {
+			longest = running
+		}
+	}
+	return longest
+}
+
+// Sorted pending keys, at most limit of them
+func (q *monitoredQueue) pendingKeys(limit int) []string {
+	q.mutex.Lock()
+	var keys []string
+	for item, _ := range q.pending {
+		keys = append(keys, fmt.Sprintf("%+v", item))
+	}
+	q.mutex.Unlock()
+	sort.Strings(keys)
+	if len(keys) > limit {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+// Keys added per second since the previous call
+func (q *monitoredQueue) addRate() float64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(q.lastCheck).Seconds()
+	adds := q.adds - q.lastAdds
+	q.lastAdds = q.adds
+	q.lastCheck = now
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(adds) / elapsed
+}
+
+// Update the processing time and add rate metrics, and log a warning with
+// the pending keys when the depth is above threshold. A threshold of 0
+// disables the warning.
+func (q *monitoredQueue) check(threshold int) {
+	rate := q.addRate()
+	queueAddRate.WithLabelValues(q.name).Set(rate)
+	queueLongestRunning.WithLabelValues(q.name).Set(
+		q.longestRunning().Seconds())
+
+	depth := q.Len()
+	if 0 == threshold || depth <= threshold {
+		return
+	}
+	q.mutex.Lock()
+	if time.Since(q.lastWarning) < queueWarningInterval {
+		q.mutex.Unlock()
+		return
+	}
+	q.lastWarning = time.Now()
+	q.mutex.Unlock()
+	log.Warningf("Work queue %s has %d keys waiting (threshold %d, "+
+		"%.1f adds/s, longest running %v), pending keys: %s",
+		q.name, depth, threshold, rate, q.longestRunning(),
+		strings.Join(q.pendingKeys(queueDumpSize), ", "))
+}
+
+func (appMgr *Manager) checkQueues() {
+	for _, queue := range []workqueue.RateLimitingInterface{
+		appMgr.vsQueue, appMgr.nsQueue, appMgr.statusQueue} {
+		if q, ok := queue.(*monitoredQueue); ok {
+			q.check(appMgr.queueDepthWarning)
+		}
+	}
+}
@@ -17,18 +17,25 @@
 package appmanager
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
+	"net"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
 
 	routeapi "github.com/openshift/origin/pkg/route/api"
 	"github.com/xeipuuv/gojsonschema"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	"k8s.io/client-go/tools/cache"
@@ -45,15 +52,79 @@ const DEFAULT_BALANCE string = "round-robin"
 const DEFAULT_HTTP_PORT int32 = 80
 const DEFAULT_HTTPS_PORT int32 = 443
 
+// Types of BIG-IP virtual servers. Performance (FastL4) and IP forwarding
+// virtual servers do not proxy the connections, so they cannot have HTTP or
+// SSL profiles, L7 policies or iRules.
+const (
+	virtualTypeStandard      = "standard"
+	virtualTypePerformanceL4 = "performance-l4"
+	virtualTypeIpForwarding  = "ip-forwarding"
+)
+
 // FIXME: remove this global variable.
 var DEFAULT_PARTITION string
 
+// Partitions the controller manages, including DEFAULT_PARTITION
+var managedPartitions []string
+
+// Set the partitions the controller may create objects in. Objects that do
+// not specify a partition, and shared objects such as iRules, go into the
+// default partition.
+func SetPartitions(defaultPartition string, partitions []string) {
+	DEFAULT_PARTITION = defaultPartition
+	managedPartitions = partitions
+}
+
+// Partitions configs are built for. Objects that do not specify a
+// partition, and shared objects such as iRules, go into Default; Managed
+// lists the others objects may specify.
+type Partitions struct {
+	Default string
+	Managed []string
+}
+
+// Whether objects may be created in a partition
+func (p Partitions) manages(partition string) bool {
+	if partition == p.Default {
+		return true
+	}
+	for _, managed := range p.Managed {
+		if managed == partition {
+			return true
+		}
+	}
+	return false
+}
+
+// Partitions of the controller, set by SetPartitions
+func controllerPartitions() Partitions {
+	return Partitions{Default: DEFAULT_PARTITION, Managed: managedPartitions}
+}
+
+// Whether the controller may create objects in a partition
+func isManagedPartition(partition string) bool {
+	return controllerPartitions().manages(partition)
+}
+
 // Indicator to use an F5 schema
 const schemaIndicator string = "f5schemadb://"
 
 // Where the schemas reside locally
 const schemaLocal string = "file:///app/vendor/src/f5/schemas/"
 
+// Reference of a schema name
+func schemaReference(schemaName string) string {
+	// FIXME For now, "f5schemadb" means the schema is local
+	// Trim whitespace and embedded quotes
+	schemaName = strings.TrimSpace(schemaName)
+	schemaName = strings.Trim(schemaName, "\"")
+	if strings.HasPrefix(schemaName, schemaIndicator) {
+		schemaName = strings.Replace(
+			schemaName, schemaIndicator, schemaLocal, 1)
+	}
+	return schemaName
+}
+
 // Constants for CustomProfile.Type as defined in CCCL
 const customProfileAll string = "all"
 const customProfileClient string = "clientside"
@@ -167,6 +238,22 @@ func (v *Virtual) GetProfileCountByContext(context string) int {
 	return profCt
 }
 
+// Count the SSL profiles of a context. The profiles the controller attaches
+// are all SSL profiles, while those declared by a ConfigMap may be of any
+// type and are left out.
+func (v *Virtual) GetSslProfileCountByContext(context string) int {
+	profCt := 0
+	for _, prof := range v.Profiles {
+		if prof.Context == context && 0 == prof.order {
+			profCt++
+		}
+	}
+	if context == customProfileClient {
+		profCt += len(v.GetFrontendSslProfileNames())
+	}
+	return profCt
+}
+
 func (v *Virtual) ReferencesProfile(profile CustomProfile) bool {
 	for _, prof := range v.Profiles {
 		if prof.Name == profile.Name &&
@@ -208,10 +295,18 @@ func (v *Virtual) ToString() string {
 	return string(output)
 }
 
+// The profiles declared by a ConfigMap come first, in the order they were
+// declared in. The other profiles follow in order of partition and name.
+func profileBefore(a, b ProfileRef) bool {
+	if 0 != a.order || 0 != b.order {
+		return 0 != a.order && (0 == b.order || a.order < b.order)
+	}
+	return ((a.Partition < b.Partition) ||
+		(a.Partition == b.Partition && a.Name < b.Name))
+}
+
 func (slice ProfileRefs) Less(i, j int) bool {
-	return ((slice[i].Partition < slice[j].Partition) ||
-		(slice[i].Partition == slice[j].Partition &&
-			slice[i].Name < slice[j].Name))
+	return profileBefore(slice[i], slice[j])
 }
 
 func (slice ProfileRefs) Len() int {
@@ -223,48 +318,43 @@ func (slice ProfileRefs) Swap(i, j int) {
 }
 
 func (v *Virtual) AddOrUpdateProfile(prof ProfileRef) bool {
-	// The profiles are maintained as a sorted array.
-	keyFunc := func(i int) bool {
-		return ((v.Profiles[i].Partition > prof.Partition) ||
-			(v.Profiles[i].Partition == prof.Partition &&
-				v.Profiles[i].Name >= prof.Name))
-	}
-	profCt := v.Profiles.Len()
-	i := sort.Search(profCt, keyFunc)
-	if i < profCt && v.Profiles[i].Partition == prof.Partition &&
-		v.Profiles[i].Name == prof.Name {
-		// found, look for data changed
-		if v.Profiles[i] == prof {
-			// unchanged
-			return false
+	// The profiles are maintained in order, a profile keeps its position
+	// when updated.
+	for i := range v.Profiles {
+		if v.Profiles[i].Partition == prof.Partition &&
+			v.Profiles[i].Name == prof.Name {
+			prof.order = v.Profiles[i].order
+			if v.Profiles[i] == prof {
+				// unchanged
+				return false
+			}
+			v.Profiles[i] = prof
+			return true
 		}
-	} else {
-		// Insert into the correct position.
-		v.Profiles = append(v.Profiles, ProfileRef{})
-		copy(v.Profiles[i+1:], v.Profiles[i:])
 	}
+
+	// Insert into the correct position.
+	i := sort.Search(v.Profiles.Len(), func(i int) bool {
+		return !profileBefore(v.Profiles[i], prof)
+	})
+	v.Profiles = append(v.Profiles, ProfileRef{})
+	copy(v.Profiles[i+1:], v.Profiles[i:])
 	v.Profiles[i] = prof
 
 	return true
 }
 
 func (v *Virtual) RemoveProfile(prof ProfileRef) bool {
-	// The profiles are maintained as a sorted array.
-	keyFunc := func(i int) bool {
-		return ((v.Profiles[i].Partition > prof.Partition) ||
-			(v.Profiles[i].Partition == prof.Partition &&
-				v.Profiles[i].Name >= prof.Name))
-	}
-	profCt := v.Profiles.Len()
-	i := sort.Search(profCt, keyFunc)
-	if i < profCt && v.Profiles[i].Partition == prof.Partition &&
-		v.Profiles[i].Name == prof.Name {
-		// found, remove it and adjust the array.
-		profCt -= 1
-		copy(v.Profiles[i:], v.Profiles[i+1:])
-		v.Profiles[profCt] = ProfileRef{}
-		v.Profiles = v.Profiles[:profCt]
-		return true
+	for i := range v.Profiles {
+		if v.Profiles[i].Partition == prof.Partition &&
+			v.Profiles[i].Name == prof.Name {
+			// found, remove it and adjust the array.
+			profCt := v.Profiles.Len() - 1
+			copy(v.Profiles[i:], v.Profiles[i+1:])
+			v.Profiles[profCt] = ProfileRef{}
+			v.Profiles = v.Profiles[:profCt]
+			return true
+		}
 	}
 	return false
 }
@@ -274,6 +364,17 @@ func formatConfigMapVSName(cm *v1.ConfigMap) string {
 	return fmt.Sprintf("%v_%v", cm.ObjectMeta.Namespace, cm.ObjectMeta.Name)
 }
 
+// format the name of the virtual server of a data key of a ConfigMap. The
+// definitions of other keys than data are suffixed with the rest of their
+// key, names of ConfigMaps cannot have an underscore so they cannot clash.
+func formatConfigMapDataVSName(cm *v1.ConfigMap, key string) string {
+	if configMapDataKey == key {
+		return formatConfigMapVSName(cm)
+	}
+	return fmt.Sprintf("%v_%v", formatConfigMapVSName(cm),
+		strings.TrimPrefix(key, configMapDataPrefix))
+}
+
 // format the namespace and name for use in the frontend definition
 func formatIngressVSName(ing *v1beta1.Ingress, protocol string) string {
 	return fmt.Sprintf("%v_%v-ingress_%s",
@@ -286,16 +387,115 @@ func formatRouteVSName(route *routeapi.Route, protocol string) string {
 		route.ObjectMeta.Namespace, protocol)
 }
 
+// Name of the shared virtual server of a Route listener, suffixed by the
+// port of extra listeners
+func formatRoutePortVSName(route *routeapi.Route, pStruct portStruct) string {
+	rsName := formatRouteVSName(route, pStruct.protocol)
+	if pStruct.port != DEFAULT_HTTP_PORT && pStruct.port != DEFAULT_HTTPS_PORT {
+		rsName = fmt.Sprintf("%s_%d", rsName, pStruct.port)
+	}
+	return rsName
+}
+
 // format the namespace and name for use in the backend definition
 func formatRoutePoolName(route *routeapi.Route) string {
 	return fmt.Sprintf("openshift_%s_%s",
 		route.ObjectMeta.Namespace, route.Spec.To.Name)
 }
 
-// format the Rule name for a Route
+const routeRuleNamePrefix = "openshift_route_"
+
+// format the Rule name for a Route. The namespace and name are escaped so
+// the rule name can be parsed back with parseRouteRuleName; names that are
+// valid in Kubernetes only change if they contain dots.
 func formatRouteRuleName(route *routeapi.Route) string {
-	return fmt.Sprintf("openshift_route_%s_%s", route.ObjectMeta.Namespace,
-		route.ObjectMeta.Name)
+	return fmt.Sprintf("%s%s_%s", routeRuleNamePrefix,
+		escapeRouteNamePart(route.ObjectMeta.Namespace),
+		escapeRouteNamePart(route.ObjectMeta.Name))
+}
+
+// Whether a rule was created for a Route. Unlike parseRouteRuleName, it
+// also holds for rules named before escaping was added whose namespace or
+// name had an underscore, which cannot be split back into them.
+func isRouteRuleName(ruleName string) bool {
+	return strings.HasPrefix(ruleName, routeRuleNamePrefix) &&
+		len(ruleName) > len(routeRuleNamePrefix)
+}
+
+// Namespace and name of the Route a rule was created for
+func parseRouteRuleName(ruleName string) (string, string, bool) {
+	if !strings.HasPrefix(ruleName, routeRuleNamePrefix) {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(ruleName, routeRuleNamePrefix), "_")
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	namespace, ok := unescapeRouteNamePart(parts[0])
+	if !ok {
+		return "", "", false
+	}
+	name, ok := unescapeRouteNamePart(parts[1])
+	if !ok {
+		// Rules named before escaping was added kept dots as-is
+		name = parts[1]
+	}
+	return namespace, name, true
+}
+
+// format the client SSL profile name for a Route
+func formatRouteClientSslProfileName(route *routeapi.Route) string {
+	return formatRouteRuleName(route) + "-https-cert"
+}
+
+// format the server SSL profile name for a Route
+func formatRouteServerSslProfileName(route *routeapi.Route) string {
+	return formatRouteRuleName(route) + "-server-ssl"
+}
+
+// Characters kept as-is in the parts of Route rule names
+func isRouteNameChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') || c == '-'
+}
+
+// Escape the characters that are not letters, digits or '-' as '.' followed
+// by their hex code, so '_' can separate the parts of a name.
+func escapeRouteNamePart(part string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(part); i++ {
+		c := part[i]
+		if isRouteNameChar(c) {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, ".%02x", c)
+		}
+	}
+	return buf.String()
+}
+
+// Unescape a part of a Route rule name. Only the escapes
+// escapeRouteNamePart writes are accepted, of printable characters that are
+// not kept as-is, so a legacy name such as 'app.db1' is not mistaken for an
+// escaped one.
+func unescapeRouteNamePart(part string) (string, bool) {
+	var buf bytes.Buffer
+	for i := 0; i < len(part); i++ {
+		if part[i] != '.' {
+			buf.WriteByte(part[i])
+			continue
+		}
+		if i+2 >= len(part) {
+			return "", false
+		}
+		c, err := strconv.ParseUint(part[i+1:i+3], 16, 8)
+		if nil != err || c < 0x20 || c > 0x7e || isRouteNameChar(byte(c)) {
+			return "", false
+		}
+		buf.WriteByte(byte(c))
+		i += 2
+	}
+	return buf.String(), true
 }
 
 func formatIngressSslProfileName(secret string) string {
@@ -316,25 +516,110 @@ func formatIngressSslProfileName(secret string) string {
 	return profName
 }
 
-// Store of CustomProfiles
+// Path of a custom profile on the BIG-IP
+type profileKey struct {
+	Partition string
+	Name      string
+}
+
+// Store of CustomProfiles, keyed by their path on the BIG-IP. Each profile
+// keeps a reference from every virtual server using it, so a profile shared
+// by several virtual servers is only deleted with the last of them. The
+// methods of the store must be called with its lock held.
 type CustomProfileStore struct {
 	sync.Mutex
-	profs map[secretKey]CustomProfile
+	profs map[profileKey]CustomProfile
+	// Virtual servers referencing each profile, as "partition/name"
+	refs map[profileKey]map[string]bool
 }
 
 // Contructor for CustomProfiles
 func NewCustomProfiles() CustomProfileStore {
 	var cps CustomProfileStore
-	cps.profs = make(map[secretKey]CustomProfile)
+	cps.profs = make(map[profileKey]CustomProfile)
+	cps.refs = make(map[profileKey]map[string]bool)
 	return cps
 }
 
+// Name of a virtual server holding references to custom profiles
+func profileOwner(rsCfg *ResourceConfig) string {
+	return rsCfg.Virtual.Partition + "/" + rsCfg.Virtual.VirtualServerName
+}
+
+// Store a profile and reference it from a virtual server. Returns whether
+// an existing profile was changed.
+func (cps *CustomProfileStore) Add(owner string, cp CustomProfile) bool {
+	key := profileKey{Partition: cp.Partition, Name: cp.Name}
+	prof, found := cps.profs[key]
+	cps.profs[key] = cp
+	if _, ok := cps.refs[key]; !ok {
+		cps.refs[key] = make(map[string]bool)
+	}
+	cps.refs[key][owner] = true
+	return found && !reflect.DeepEqual(prof, cp)
+}
+
+// Replace the contents of a stored profile, keeping its references. Returns
+// whether the profile was stored and changed.
+func (cps *CustomProfileStore) Update(cp CustomProfile) bool {
+	key := profileKey{Partition: cp.Partition, Name: cp.Name}
+	prof, found := cps.profs[key]
+	if !found || reflect.DeepEqual(prof, cp) {
+		return false
+	}
+	cps.profs[key] = cp
+	return true
+}
+
+// Get a stored profile
+func (cps *CustomProfileStore) Get(key profileKey) (CustomProfile, bool) {
+	prof, ok := cps.profs[key]
+	return prof, ok
+}
+
+// Number of virtual servers referencing a profile
+func (cps *CustomProfileStore) RefCount(key profileKey) int {
+	return len(cps.refs[key])
+}
+
+// Drop the references for which inUse returns false, and delete the profiles
+// left without references. Returns the number of deleted profiles.
+func (cps *CustomProfileStore) Release(
+	inUse func(owner string, cp CustomProfile) bool,
+) int {
+	deleted := 0
+	for key, owners := range cps.refs {
+		for owner := range owners {
+			if !inUse(owner, cps.profs[key]) {
+				delete(owners, owner)
+			}
+		}
+		if 0 == len(owners) {
+			delete(cps.refs, key)
+			delete(cps.profs, key)
+			deleted++
+		}
+	}
+	return deleted
+}
+
 type ResourceConfigMap map[string]*ResourceConfig
 
 // Map of Resource configs
 type Resources struct {
 	sync.Mutex
 	rm map[serviceKey]ResourceConfigMap
+	// Content hashes of the stored configs, computed on first comparison
+	// and dropped whenever a config is assigned, deleted or invalidated
+	hashes map[serviceKey]map[string]uint64
+	// Number of snapshots taken, used to order them
+	snapshots uint64
+}
+
+// Copy of the stored configs at a point in time, see Resources.Snapshot()
+type ResourceSnapshot struct {
+	rm  map[serviceKey]ResourceConfigMap
+	seq uint64
 }
 
 type ResourceInterface interface {
@@ -347,6 +632,8 @@ type ResourceInterface interface {
 	GetAllWithName(name string) (ResourceConfigs, []serviceKey)
 	Delete(key serviceKey, name string) bool
 	ForEach(f ResourceEnumFunc)
+	HashMatches(key serviceKey, name string, hash uint64) bool
+	Invalidate(key serviceKey, name string)
 }
 
 // Constructor for Resources
@@ -359,6 +646,7 @@ func NewResources() *Resources {
 // Receiver to initialize the object.
 func (rs *Resources) Init() {
 	rs.rm = make(map[serviceKey]ResourceConfigMap)
+	rs.hashes = make(map[serviceKey]map[string]uint64)
 }
 
 // callback type for ForEach()
@@ -372,6 +660,7 @@ func (rs *Resources) Assign(key serviceKey, name string, cfg *ResourceConfig) {
 		rs.rm[key] = rsMap
 	}
 	rsMap[name] = cfg
+	rs.Invalidate(key, name)
 }
 
 // Count of all configurations currently stored.
@@ -399,10 +688,12 @@ func (rs *Resources) Delete(key serviceKey, name string) bool {
 	}
 	if name == "" {
 		delete(rs.rm, key)
+		delete(rs.hashes, key)
 		return true
 	}
 	if _, ok := rsMap[name]; ok {
 		delete(rsMap, name)
+		rs.Invalidate(key, name)
 		if len(rsMap) == 0 {
 			delete(rs.rm, key)
 		}
@@ -436,6 +727,227 @@ func (rs *Resources) GetAll(key serviceKey) (ResourceConfigMap, bool) {
 	return rsMap, ok
 }
 
+// Check whether the config stored for key and name has the given content
+// hash. The stored config's hash is cached, so this only costs hashing the
+// config being compared.
+func (rs *Resources) HashMatches(key serviceKey, name string, hash uint64) bool {
+	cfg, ok := rs.Get(key, name)
+	if !ok {
+		return false
+	}
+	hashes, ok := rs.hashes[key]
+	if !ok {
+		hashes = make(map[string]uint64)
+		rs.hashes[key] = hashes
+	}
+	stored, ok := hashes[name]
+	if !ok {
+		stored = cfg.contentHash()
+		hashes[name] = stored
+	}
+	return stored == hash
+}
+
+// Drop the cached hash of a config. Must be called after changing a stored
+// config in place rather than through Assign.
+func (rs *Resources) Invalidate(key serviceKey, name string) {
+	if hashes, ok := rs.hashes[key]; ok {
+		delete(hashes, name)
+		if 0 == len(hashes) {
+			delete(rs.hashes, key)
+		}
+	}
+}
+
+// Hash of the full contents of a config, every field included whether or
+// not it is marshalled to JSON
+func (rc *ResourceConfig) contentHash() uint64 {
+	h := fnv.New64a()
+	hashValue(h, reflect.ValueOf(rc).Elem())
+	return h.Sum64()
+}
+
+// Write every field of a value to a hash, following pointers. Lengths are
+// written before the contents of strings and slices, so adjacent values
+// cannot run into each other, and equal maps hash the same whatever the
+// order of their keys.
+func hashValue(h hash.Hash64, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			fmt.Fprint(h, "nil;")
+			return
+		}
+		hashValue(h, v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			hashValue(h, v.Field(i))
+		}
+	case reflect.Slice, reflect.Array:
+		fmt.Fprintf(h, "%d[", v.Len())
+		for i := 0; i < v.Len(); i++ {
+			hashValue(h, v.Index(i))
+		}
+	case reflect.Map:
+		var sum uint64
+		for _, key := range v.MapKeys() {
+			entry := fnv.New64a()
+			hashValue(entry, key)
+			hashValue(entry, v.MapIndex(key))
+			sum += entry.Sum64()
+		}
+		fmt.Fprintf(h, "%d{%d;", v.Len(), sum)
+	case reflect.String:
+		fmt.Fprintf(h, "%d:%s", v.Len(), v.String())
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		// Configs hold no behavior
+	default:
+		fmt.Fprintf(h, "%v;", v)
+	}
+}
+
+// Deep copy all stored configs, so they can be read after the lock is
+// released while the store keeps changing. Changes made to the copies are
+// not seen by the store. Must be called with the lock held.
+func (rs *Resources) Snapshot() *ResourceSnapshot {
+	rs.snapshots++
+	snapshot := &ResourceSnapshot{
+		rm:  make(map[serviceKey]ResourceConfigMap),
+		seq: rs.snapshots,
+	}
+	for key, cfgs := range rs.rm {
+		cfgsCopy := make(ResourceConfigMap)
+		for name, cfg := range cfgs {
+			cfgsCopy[name] = cfg.copy()
+		}
+		snapshot.rm[key] = cfgsCopy
+	}
+	return snapshot
+}
+
+// Iterate over all configurations in the snapshot
+func (s *ResourceSnapshot) ForEach(f ResourceEnumFunc) {
+	for key, cfgs := range s.rm {
+		for _, cfg := range cfgs {
+			f(key, cfg)
+		}
+	}
+}
+
+// Count of all configurations in the snapshot
+func (s *ResourceSnapshot) Count() int {
+	var ct int = 0
+	for _, cfgs := range s.rm {
+		ct += len(cfgs)
+	}
+	return ct
+}
+
+// Deep copy of a config, sharing no slices, maps or pointers with it
+func (rc *ResourceConfig) copy() *ResourceConfig {
+	cfg := *rc
+	cfg.Virtual = rc.Virtual.copy()
+	cfg.Pools = nil
+	for _, pool := range rc.Pools {
+		if nil != pool.Members {
+			pool.Members = append([]Member{}, pool.Members...)
+		}
+		pool.MonitorNames = append([]string(nil), pool.MonitorNames...)
+		pool.StaticMembers = append([]Member(nil), pool.StaticMembers...)
+		cfg.Pools = append(cfg.Pools, pool)
+	}
+	cfg.Monitors = append(Monitors(nil), rc.Monitors...)
+	cfg.Policies = nil
+	for _, pol := range rc.Policies {
+		cfg.Policies = append(cfg.Policies, pol.copy())
+	}
+	return &cfg
+}
+
+func (v Virtual) copy() Virtual {
+	if nil != v.VirtualAddress {
+		va := *v.VirtualAddress
+		v.VirtualAddress = &va
+	}
+	if nil != v.SslProfile {
+		ssl := *v.SslProfile
+		ssl.F5ProfileNames = append([]string(nil), ssl.F5ProfileNames...)
+		v.SslProfile = &ssl
+	}
+	if nil != v.ServerSslProfile {
+		ssl := *v.ServerSslProfile
+		v.ServerSslProfile = &ssl
+	}
+	v.Policies = append([]nameRef(nil), v.Policies...)
+	v.IRules = append([]string(nil), v.IRules...)
+	v.Profiles = append(ProfileRefs(nil), v.Profiles...)
+	if nil != v.IAppPoolMemberTable {
+		table := *v.IAppPoolMemberTable
+		if nil != table.Columns {
+			table.Columns = append([]iappPoolMemberColumn{}, table.Columns...)
+		}
+		table.Members = append([]Member(nil), table.Members...)
+		v.IAppPoolMemberTable = &table
+	}
+	v.IAppOptions = copyStringMap(v.IAppOptions)
+	v.IAppVariables = copyStringMap(v.IAppVariables)
+	if nil != v.IAppTables {
+		tables := make(map[string]iappTableEntry)
+		for name, entry := range v.IAppTables {
+			rows := make([][]string, 0, len(entry.Rows))
+			for _, row := range entry.Rows {
+				rows = append(rows, append([]string(nil), row...))
+			}
+			tables[name] = iappTableEntry{
+				Columns: append([]string(nil), entry.Columns...),
+				Rows:    rows,
+			}
+		}
+		v.IAppTables = tables
+	}
+	return v
+}
+
+func (pol Policy) copy() Policy {
+	pol.Controls = append([]string(nil), pol.Controls...)
+	pol.Requires = append([]string(nil), pol.Requires...)
+	rules := pol.Rules
+	pol.Rules = nil
+	for _, rule := range rules {
+		pol.Rules = append(pol.Rules, rule.copy())
+	}
+	return pol
+}
+
+func (rule *Rule) copy() *Rule {
+	ruleCopy := *rule
+	ruleCopy.Actions = nil
+	for _, act := range rule.Actions {
+		actCopy := *act
+		ruleCopy.Actions = append(ruleCopy.Actions, &actCopy)
+	}
+	ruleCopy.Conditions = nil
+	for _, cond := range rule.Conditions {
+		condCopy := *cond
+		if nil != cond.Values {
+			condCopy.Values = append([]string{}, cond.Values...)
+		}
+		ruleCopy.Conditions = append(ruleCopy.Conditions, &condCopy)
+	}
+	return &ruleCopy
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	if nil == m {
+		return nil
+	}
+	mCopy := make(map[string]string)
+	for k, v := range m {
+		mCopy[k] = v
+	}
+	return mCopy
+}
+
 // Get all configurations with a specific name, spanning multiple backends
 // This is for multi-service ingress
 func (rs *Resources) GetAllWithName(name string) (ResourceConfigs, []serviceKey) {
@@ -450,27 +962,96 @@ func (rs *Resources) GetAllWithName(name string) (ResourceConfigs, []serviceKey)
 	return cfgs, keys
 }
 
+// Key of the virtual server definition of a ConfigMap. A ConfigMap can hold
+// more definitions in keys starting with data-, each validated against the
+// schema of the ConfigMap and configured as a virtual server of its own.
+const configMapDataKey = "data"
+const configMapDataPrefix = "data-"
+
+// Keys of the virtual server definitions of a ConfigMap, data first and the
+// others in order
+func configMapDataKeys(cm *v1.ConfigMap) []string {
+	var keys []string
+	for key := range cm.Data {
+		if strings.HasPrefix(key, configMapDataPrefix) &&
+			len(key) > len(configMapDataPrefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := cm.Data[configMapDataKey]; ok {
+		keys = append([]string{configMapDataKey}, keys...)
+	}
+	return keys
+}
+
+// Unmarshal the virtual server definitions of a ConfigMap without validating
+// them, for the informer indexes. Definitions that cannot be read are
+// skipped.
+func readConfigMapDefinitions(cm *v1.ConfigMap) []ConfigMap {
+	var cfgMaps []ConfigMap
+	for _, key := range configMapDataKeys(cm) {
+		var cfgMap ConfigMap
+		if nil == json.Unmarshal([]byte(cm.Data[key]), &cfgMap) {
+			cfgMaps = append(cfgMaps, cfgMap)
+		}
+	}
+	return cfgMaps
+}
+
+// A virtual server definition of a ConfigMap, with the error that made it
+// invalid if any. The config of an invalid definition is nil if its data
+// could not be read.
+type configMapDefinition struct {
+	Key string
+	Cfg *ResourceConfig
+	Err error
+}
+
+// Unmarshal the virtual server definitions of a ConfigMap. Each definition
+// is valid or not on its own, so an error in one does not remove the
+// others. A ConfigMap without definitions reports the missing data key.
+func parseConfigMapDefinitions(cm *v1.ConfigMap) []configMapDefinition {
+	keys := configMapDataKeys(cm)
+	if 0 == len(keys) {
+		keys = []string{configMapDataKey}
+	}
+	var defs []configMapDefinition
+	for _, key := range keys {
+		cfg, err := parseConfigMapData(cm, key)
+		defs = append(defs, configMapDefinition{Key: key, Cfg: cfg, Err: err})
+	}
+	return defs
+}
+
 // Unmarshal an expected ConfigMap object
 func parseConfigMap(cm *v1.ConfigMap) (*ResourceConfig, error) {
+	return parseConfigMapData(cm, configMapDataKey)
+}
+
+// Unmarshal the virtual server definition of a data key of a ConfigMap
+func parseConfigMapData(cm *v1.ConfigMap, key string) (*ResourceConfig, error) {
+	return buildConfigMapData(controllerPartitions(), cm, key)
+}
+
+// Build the config of a data key of a ConfigMap for the partitions
+func buildConfigMapData(
+	partitions Partitions,
+	cm *v1.ConfigMap,
+	key string,
+) (*ResourceConfig, error) {
 	var cfg ResourceConfig
 	var cfgMap ConfigMap
 
-	if data, ok := cm.Data["data"]; ok {
+	if data, ok := cm.Data[key]; ok {
 		err := json.Unmarshal([]byte(data), &cfgMap)
 		if nil != err {
 			return nil, err
 		}
 		if schemaName, ok := cm.Data["schema"]; ok {
-			// FIXME For now, "f5schemadb" means the schema is local
-			// Trim whitespace and embedded quotes
-			schemaName = strings.TrimSpace(schemaName)
-			schemaName = strings.Trim(schemaName, "\"")
-			if strings.HasPrefix(schemaName, schemaIndicator) {
-				schemaName = strings.Replace(
-					schemaName, schemaIndicator, schemaLocal, 1)
-			}
 			// Load the schema
-			schemaLoader := gojsonschema.NewReferenceLoader(schemaName)
+			schemaLoader := gojsonschema.NewReferenceLoader(
+				schemaReference(schemaName))
 			schema, err := gojsonschema.NewSchema(schemaLoader)
 			if err != nil {
 				return &cfg, err
@@ -483,13 +1064,77 @@ func parseConfigMap(cm *v1.ConfigMap) (*ResourceConfig, error) {
 			}
 
 			//Check if we care about the partition specified in the configmap
-			if cfgMap.VirtualServer.Frontend.Partition != DEFAULT_PARTITION {
-				var errStr string = fmt.Sprintf("The partition '%s' in the ConfigMap does not match '%s' that the controller watches for", cfgMap.VirtualServer.Frontend.Partition, DEFAULT_PARTITION)
+			if !partitions.manages(cfgMap.VirtualServer.Frontend.Partition) {
+				var errStr string = fmt.Sprintf("The partition '%s' in the ConfigMap is not one of the partitions the controller manages", cfgMap.VirtualServer.Frontend.Partition)
 				return &cfg, errors.New(errStr)
 			}
 			if result.Valid() {
-				cfg.Virtual.VirtualServerName = formatConfigMapVSName(cm)
+				cfg.MetaData.ResourceType = "configmap"
+				cfg.MetaData.ResourceName = cm.ObjectMeta.Namespace + "/" +
+					cm.ObjectMeta.Name
+				cfg.Virtual.VirtualServerName = formatConfigMapDataVSName(cm, key)
 				copyConfigMap(&cfg, &cfgMap)
+				cfg.Pools[0].StaticMembers, err = parseStaticMembers(
+					cfgMap.VirtualServer.Backend.StaticMembers,
+					cfg.Pools[0].ServicePort)
+				if nil != err {
+					return &cfg, fmt.Errorf("configmap %s is not valid: %v",
+						cm.ObjectMeta.Name, err)
+				}
+				setConfigMapPolicies(&cfg, cfgMap.VirtualServer.Policies,
+					cm.ObjectMeta.Namespace)
+				setPoolServiceDownOptions(cfg.Pools, cm.ObjectMeta.Annotations,
+					cm.ObjectMeta.Name)
+				setPoolMemberType(&cfg.MetaData, cm.ObjectMeta.Annotations,
+					cm.ObjectMeta.Name)
+				setPoolMemberLimit(&cfg.MetaData, cm.ObjectMeta.Annotations,
+					cm.ObjectMeta.Name)
+				if cfg.Virtual.IApp == "" {
+					setVirtualDisabled(&cfg.Virtual, cm.ObjectMeta.Annotations,
+						cm.ObjectMeta.Name)
+					setVirtualSchedule(&cfg, cm.ObjectMeta.Annotations,
+						cm.ObjectMeta.Name, time.Now())
+					setVirtualProxyProtocol(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name,
+						partitions.Default)
+					setVirtualMergePolicy(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualLogProfiles(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualAnalyticsProfile(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualDosProfile(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualSourceTranslation(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualOneConnect(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualBandwidthPolicy(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualClonePools(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualIRules(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualAccessPolicy(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
+					setVirtualSorryServer(&cfg,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name,
+						partitions.Default)
+					setVirtualHostRedirects(&cfg,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name,
+						partitions.Default)
+					setVirtualUniversalPersistence(&cfg,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name,
+						partitions.Default)
+					err = validateVirtualType(&cfg.Virtual)
+					if nil != err {
+						return &cfg, fmt.Errorf("configmap %s is not valid: %v",
+							cm.ObjectMeta.Name, err)
+					}
+				} else if nil != cfg.Pools[0].Fqdn {
+					return &cfg, fmt.Errorf("configmap %s is not valid: "+
+						"iApps do not support fqdn backends", cm.ObjectMeta.Name)
+				}
 
 				// Checking for annotation in VS, not iApp
 				if cfg.Virtual.IApp == "" && cfg.Virtual.VirtualAddress != nil {
@@ -507,6 +1152,8 @@ func parseConfigMap(cm *v1.ConfigMap) (*ResourceConfig, error) {
 							log.Infof("No virtual IP was specified for the virtual server %s creating pool only.", cm.ObjectMeta.Name)
 						}
 					}
+					setVirtualIPv6Address(&cfg.Virtual,
+						cm.ObjectMeta.Annotations, cm.ObjectMeta.Name)
 				}
 			} else {
 				var errors []string
@@ -520,8 +1167,8 @@ func parseConfigMap(cm *v1.ConfigMap) (*ResourceConfig, error) {
 				cm.ObjectMeta.Name)
 		}
 	} else {
-		return nil, fmt.Errorf("configmap %s does not contain data key",
-			cm.ObjectMeta.Name)
+		return nil, fmt.Errorf("configmap %s does not contain %s key",
+			cm.ObjectMeta.Name, key)
 	}
 
 	return &cfg, nil
@@ -534,6 +1181,9 @@ func copyConfigMap(cfg *ResourceConfig, cfgMap *ConfigMap) {
 	} else {
 		cfg.Virtual.Mode = cfgMap.VirtualServer.Frontend.Mode
 	}
+	cfg.Virtual.VirtualType = cfgMap.VirtualServer.Frontend.VirtualType
+	cfg.Virtual.SourcePort = cfgMap.VirtualServer.Frontend.SourcePort
+	cfg.Virtual.Transparent = cfgMap.VirtualServer.Frontend.Transparent
 	// If balance not set, use default
 	var balance string
 	if cfgMap.VirtualServer.Frontend.Balance == "" {
@@ -545,6 +1195,14 @@ func copyConfigMap(cfg *ResourceConfig, cfgMap *ConfigMap) {
 	cfg.Virtual.Partition = cfgMap.VirtualServer.Frontend.Partition
 	cfg.Virtual.VirtualAddress = cfgMap.VirtualServer.Frontend.VirtualAddress
 	cfg.Virtual.SslProfile = cfgMap.VirtualServer.Frontend.SslProfile
+	cfg.Virtual.ServerSslProfile = cfgMap.VirtualServer.Frontend.ServerSslProfile
+	// The declared profiles keep their order, ahead of the profiles the
+	// controller adds
+	cfg.Virtual.Profiles = nil
+	for i, prof := range cfgMap.VirtualServer.Frontend.Profiles {
+		prof.order = i + 1
+		cfg.Virtual.AddOrUpdateProfile(prof)
+	}
 	cfg.Virtual.IApp = cfgMap.VirtualServer.Frontend.IApp
 	cfg.Virtual.IAppPoolMemberTable = cfgMap.VirtualServer.Frontend.IAppPoolMemberTable
 	cfg.Virtual.IAppOptions = cfgMap.VirtualServer.Frontend.IAppOptions
@@ -580,6 +1238,15 @@ func copyConfigMap(cfg *ResourceConfig, cfgMap *ConfigMap) {
 		Members:      nil,
 		MonitorNames: monitorNames,
 	}
+	if fqdn := cfgMap.VirtualServer.Backend.Fqdn; nil != fqdn {
+		member := *fqdn
+		member.Port = pool.ServicePort
+		if nil == member.AutoPopulate {
+			autoPopulate := true
+			member.AutoPopulate = &autoPopulate
+		}
+		pool.Fqdn = &member
+	}
 	cfg.Pools = append(cfg.Pools, pool)
 	cfg.Virtual.PoolName = fmt.Sprintf("/%s/%s", cfg.Virtual.Partition, pool.Name)
 }
@@ -587,6 +1254,21 @@ func copyConfigMap(cfg *ResourceConfig, cfgMap *ConfigMap) {
 // Create a ResourceConfig based on an Ingress resource config
 func createRSConfigFromIngress(ing *v1beta1.Ingress,
 	ns string,
+	crossNsRefs crossNamespaceRefs,
+	svcIndexer cache.Indexer,
+	pStruct portStruct,
+) *ResourceConfig {
+	return buildIngressConfig(controllerPartitions(), ing, ns, crossNsRefs,
+		svcIndexer, pStruct)
+}
+
+// Build the config of the virtual server of an Ingress on a port for the
+// partitions
+func buildIngressConfig(
+	partitions Partitions,
+	ing *v1beta1.Ingress,
+	ns string,
+	crossNsRefs crossNamespaceRefs,
 	svcIndexer cache.Indexer,
 	pStruct portStruct,
 ) *ResourceConfig {
@@ -597,6 +1279,9 @@ func createRSConfigFromIngress(ing *v1beta1.Ingress,
 			return nil
 		}
 	}
+	cfg.MetaData.ResourceType = "ingress"
+	cfg.MetaData.ResourceName = ing.ObjectMeta.Namespace + "/" +
+		ing.ObjectMeta.Name
 	cfg.Virtual.VirtualServerName = formatIngressVSName(ing, pStruct.protocol)
 	cfg.Virtual.Mode = "http"
 	var balance string
@@ -609,9 +1294,15 @@ func createRSConfigFromIngress(ing *v1beta1.Ingress,
 	cfg.Virtual.VirtualAddress.Port = pStruct.port
 
 	if partition, ok := ing.ObjectMeta.Annotations["virtual-server.f5.com/partition"]; ok == true {
+		if !partitions.manages(partition) {
+			log.Warningf("Partition '%s' of Ingress '%s' is not one of the "+
+				"partitions the controller manages, ignoring it.",
+				partition, ing.ObjectMeta.Name)
+			return nil
+		}
 		cfg.Virtual.Partition = partition
 	} else {
-		cfg.Virtual.Partition = DEFAULT_PARTITION
+		cfg.Virtual.Partition = partitions.Default
 	}
 
 	if addr, ok := ing.ObjectMeta.Annotations["virtual-server.f5.com/ip"]; ok == true {
@@ -620,78 +1311,807 @@ func createRSConfigFromIngress(ing *v1beta1.Ingress,
 		log.Infof("No virtual IP was specified for the virtual server %s, creating pool only.",
 			ing.ObjectMeta.Name)
 	}
+	setVirtualIPv6Address(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
 
+	svcNamespaces := crossNsRefs.ingressServiceNamespaces(ing)
 	if nil != ing.Spec.Rules { //multi-service
 		index := 0
 		poolName := cfg.Virtual.VirtualServerName
 		for _, rule := range ing.Spec.Rules {
 			if nil != rule.IngressRuleValue.HTTP {
 				for _, path := range rule.IngressRuleValue.HTTP.Paths {
+					svcNs := backendNamespace(svcNamespaces, ns,
+						path.Backend.ServiceName)
+					// If service doesn't exist or is ignored, don't create a
+					// pool for it
+					sKey := svcNs + "/" + path.Backend.ServiceName
+					obj, svcFound, _ := svcIndexer.GetByKey(sKey)
+					if !svcFound || isIgnoredService(obj.(*v1.Service)) {
+						index++
+						continue
+					}
+					svcPort := getIngressBackendPort(svcNs, path.Backend, svcIndexer)
 					exists := false
 					for _, pl := range cfg.Pools {
 						if pl.ServiceName == path.Backend.ServiceName &&
-							pl.ServicePort == path.Backend.ServicePort.IntVal {
+							pl.ServicePort == svcPort &&
+							pl.serviceNamespace(ns) == svcNs {
 							exists = true
 						}
 					}
 					if exists {
 						continue
 					}
-					// If service doesn't exist, don't create a pool for it
-					sKey := ns + "/" + path.Backend.ServiceName
-					_, svcFound, _ := svcIndexer.GetByKey(sKey)
-					if !svcFound {
-						index++
-						continue
-					}
 					if index > 0 {
 						poolName = fmt.Sprintf("%s_%d", cfg.Virtual.VirtualServerName, index)
 					}
 					pool := Pool{
-						Name:        poolName,
-						Partition:   cfg.Virtual.Partition,
-						Balance:     balance,
-						ServiceName: path.Backend.ServiceName,
-						ServicePort: path.Backend.ServicePort.IntVal,
+						Name:             poolName,
+						Partition:        cfg.Virtual.Partition,
+						Balance:          balance,
+						ServiceName:      path.Backend.ServiceName,
+						ServicePort:      svcPort,
+						ServiceNamespace: svcNs,
 					}
 					cfg.Pools = append(cfg.Pools, pool)
 					index++
 				}
 			}
 		}
-		rules := processIngressRules(&ing.Spec, cfg.Pools, cfg.Virtual.Partition)
+		rules := processIngressRules(&ing.Spec, cfg.Pools, cfg.Virtual.Partition,
+			func(backend v1beta1.IngressBackend) int32 {
+				svcNs := backendNamespace(svcNamespaces, ns, backend.ServiceName)
+				return getIngressBackendPort(svcNs, backend, svcIndexer)
+			})
 		plcy := createPolicy(*rules, cfg.Virtual.VirtualServerName, cfg.Virtual.Partition)
 		cfg.SetPolicy(*plcy)
 	} else { // single-service
+		svcName := ing.Spec.Backend.ServiceName
+		svcNs := backendNamespace(svcNamespaces, ns, svcName)
 		pool := Pool{
-			Name:        cfg.Virtual.VirtualServerName,
-			Partition:   cfg.Virtual.Partition,
-			Balance:     balance,
-			ServiceName: ing.Spec.Backend.ServiceName,
-			ServicePort: ing.Spec.Backend.ServicePort.IntVal,
+			Name:             cfg.Virtual.VirtualServerName,
+			Partition:        cfg.Virtual.Partition,
+			Balance:          balance,
+			ServiceName:      svcName,
+			ServicePort:      getIngressBackendPort(svcNs, *ing.Spec.Backend, svcIndexer),
+			ServiceNamespace: svcNs,
 		}
 		cfg.Pools = append(cfg.Pools, pool)
 		cfg.Virtual.PoolName = fmt.Sprintf("/%s/%s", cfg.Virtual.Partition, pool.Name)
 	}
+	setIngressHeaderRules(&cfg, ing, ns, svcNamespaces, svcIndexer, balance)
+	setIngressAllowedMethods(&cfg, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setPoolServiceDownOptions(cfg.Pools, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setPoolMemberType(&cfg.MetaData, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setPoolMemberLimit(&cfg.MetaData, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualDisabled(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualSchedule(&cfg, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name, time.Now())
+	setVirtualProxyProtocol(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name, partitions.Default)
+	setVirtualMergePolicy(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualLogProfiles(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualAnalyticsProfile(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualDosProfile(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualSourceTranslation(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualOneConnect(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualBandwidthPolicy(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualClonePools(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualIRules(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualAccessPolicy(&cfg.Virtual, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name)
+	setVirtualSorryServer(&cfg, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name, partitions.Default)
+	setVirtualHostRedirects(&cfg, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name, partitions.Default)
+	setVirtualUniversalPersistence(&cfg, ing.ObjectMeta.Annotations,
+		ing.ObjectMeta.Name, partitions.Default)
 
 	return &cfg
 }
 
+// Return the service port referenced by an Ingress backend. Named ports
+// are resolved against the ports of the service; 0 is returned if the
+// service or the named port cannot be found.
+func getIngressBackendPort(
+	ns string,
+	backend v1beta1.IngressBackend,
+	svcIndexer cache.Indexer,
+) int32 {
+	if backend.ServicePort.Type == intstr.Int {
+		return backend.ServicePort.IntVal
+	}
+	if nil == svcIndexer {
+		return 0
+	}
+	obj, found, err := svcIndexer.GetByKey(ns + "/" + backend.ServiceName)
+	if nil != err || !found {
+		return 0
+	}
+	svc := obj.(*v1.Service)
+	for _, portSpec := range svc.Spec.Ports {
+		if portSpec.Name == backend.ServicePort.StrVal {
+			return portSpec.Port
+		}
+	}
+	log.Warningf("Port '%v' was not found on service '%v'.",
+		backend.ServicePort.StrVal, backend.ServiceName)
+	return 0
+}
+
+// Apply the service down action and reselect tries annotations to pools.
+// Invalid values are logged and ignored so the BIG-IP defaults are used.
+func setPoolServiceDownOptions(
+	pools []Pool,
+	annotations map[string]string,
+	resourceName string,
+) {
+	var action string
+	var tries int
+	if val, ok := annotations[poolServiceDownAnnotation]; ok {
+		switch strings.ToLower(val) {
+		case "none", "reset", "drop", "reselect":
+			action = strings.ToLower(val)
+		default:
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be one of: none, reset, drop, reselect",
+				val, poolServiceDownAnnotation, resourceName)
+		}
+	}
+	if val, ok := annotations[poolReselectTriesAnnotation]; ok {
+		t, err := strconv.Atoi(val)
+		if nil != err || t < 0 || t > 65535 {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be an integer between 0 and 65535",
+				val, poolReselectTriesAnnotation, resourceName)
+		} else {
+			tries = t
+		}
+	}
+	for i, _ := range pools {
+		pools[i].ServiceDownAction = action
+		pools[i].ReselectTries = tries
+	}
+}
+
+// Use nodes and the NodePort, or the endpoints of the service, as pool
+// members regardless of the pool-member-type of the controller.
+func setPoolMemberType(
+	metaData *metaData,
+	annotations map[string]string,
+	resourceName string,
+) {
+	metaData.PoolMemberType = ""
+	if val, ok := annotations[poolMemberTypeAnnotation]; ok {
+		switch strings.ToLower(val) {
+		case "nodeport", "cluster":
+			metaData.PoolMemberType = strings.ToLower(val)
+		default:
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be one of: nodeport, cluster",
+				val, poolMemberTypeAnnotation, resourceName)
+		}
+	}
+}
+
+// Administratively disable a virtual server if requested by annotation.
+// The rest of the config is kept so the virtual can be re-enabled as-is.
+func setVirtualDisabled(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	virtual.Disabled = false
+	if val, ok := annotations[vsDisableAnnotation]; ok {
+		disabled, err := strconv.ParseBool(val)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be true or false", val, vsDisableAnnotation, resourceName)
+			return
+		}
+		virtual.Disabled = disabled
+	}
+}
+
+// Attach the iRule sending a PROXY protocol header of the requested version
+// to the pool members, so they see the address of the client.
+func setVirtualProxyProtocol(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+	partition string,
+) {
+	val, ok := annotations[proxyProtocolAnnotation]
+	if !ok {
+		return
+	}
+	var ruleName string
+	switch strings.ToLower(val) {
+	case "v1":
+		ruleName = proxyProtocolV1IRuleName
+	case "v2":
+		ruleName = proxyProtocolV2IRuleName
+	default:
+		log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+			"must be v1 or v2", val, proxyProtocolAnnotation, resourceName)
+		return
+	}
+	virtual.AddIRule(fmt.Sprintf("/%s/%s", partition, ruleName))
+}
+
+// Check that a virtual server only uses the features its type supports
+func validateVirtualType(virtual *Virtual) error {
+	switch virtual.VirtualType {
+	case "", virtualTypeStandard:
+		return nil
+	case virtualTypePerformanceL4, virtualTypeIpForwarding:
+	default:
+		return fmt.Errorf("unknown virtual server type '%v'",
+			virtual.VirtualType)
+	}
+	var unsupported []string
+	if strings.ToLower(virtual.Mode) == "http" {
+		unsupported = append(unsupported, "http mode")
+	}
+	if nil != virtual.SslProfile || nil != virtual.ServerSslProfile {
+		unsupported = append(unsupported, "SSL profiles")
+	}
+	if 0 != len(virtual.Policies) {
+		unsupported = append(unsupported, "policies")
+	}
+	if 0 != len(virtual.IRules) {
+		unsupported = append(unsupported, "iRules")
+	}
+	if 0 != len(unsupported) {
+		return fmt.Errorf("%v virtual servers do not support %v",
+			virtual.VirtualType, strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// Fields of a virtual server kept by the merge policy when none are listed
+var defaultPreserveFields = []string{"connectionLimit", "description"}
+
+// Fields of a virtual server the merge policy can keep: those of the f5-cccl
+// schema the controller never sets itself
+var preservableFields = map[string]bool{
+	"connectionLimit":  true,
+	"description":      true,
+	"source":           true,
+	"translateAddress": true,
+	"translatePort":    true,
+}
+
+// With the merge policy, the fields listed by annotation keep the value
+// manually set on the BIG-IP instead of being overwritten on every sync. The
+// default replace policy always writes the whole virtual server.
+func setVirtualMergePolicy(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	virtual.PreserveFields = nil
+	fields, hasFields := annotations[vsPreserveFieldsAnnotation]
+	policy, ok := annotations[vsMergePolicyAnnotation]
+	if !ok || strings.ToLower(policy) == "replace" {
+		if hasFields {
+			log.Warningf("Annotation %v on '%v' is ignored without the merge "+
+				"policy", vsPreserveFieldsAnnotation, resourceName)
+		}
+		return
+	}
+	if strings.ToLower(policy) != "merge" {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+			"must be replace or merge", policy, vsMergePolicyAnnotation,
+			resourceName)
+		return
+	}
+	if !hasFields {
+		virtual.PreserveFields = append([]string{}, defaultPreserveFields...)
+		return
+	}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if "" == field {
+			continue
+		}
+		if !preservableFields[field] {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"the field cannot be preserved", field,
+				vsPreserveFieldsAnnotation, resourceName)
+			continue
+		}
+		virtual.PreserveFields = append(virtual.PreserveFields, field)
+	}
+	sort.Strings(virtual.PreserveFields)
+}
+
+// Attach the logging profiles named by annotation, which must already exist
+// on the BIG-IP: a request logging profile for access logs of HTTP virtual
+// servers, and security logging profiles for AFM/ASM events. The value
+// "none" (or an empty value) removes the security logging profiles.
+func setVirtualLogProfiles(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	if val, ok := annotations[requestLogProfileAnnotation]; ok {
+		partition, name, ok := splitBigIPPath(val)
+		if !ok {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be a full path like /Common/request-log",
+				val, requestLogProfileAnnotation, resourceName)
+		} else if strings.ToLower(virtual.Mode) != "http" {
+			log.Warningf("Annotation %v on '%v' is ignored, request logging "+
+				"requires an http virtual server",
+				requestLogProfileAnnotation, resourceName)
+		} else {
+			virtual.AddOrUpdateProfile(ProfileRef{
+				Partition: partition,
+				Name:      name,
+				Context:   customProfileAll,
+			})
+		}
+	}
+
+	virtual.SecurityLogProfiles = nil
+	val, ok := annotations[securityLoggingAnnotation]
+	if !ok {
+		return
+	}
+	profiles := []string{}
+	if strings.TrimSpace(val) != "none" {
+		for _, path := range strings.Split(val, ",") {
+			path = strings.TrimSpace(path)
+			if "" == path {
+				continue
+			}
+			partition, name, ok := splitBigIPPath(path)
+			if !ok {
+				log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+					"must be full paths like /Common/Log all requests",
+					path, securityLoggingAnnotation, resourceName)
+				return
+			}
+			profiles = append(profiles, fmt.Sprintf("/%s/%s", partition, name))
+		}
+	}
+	sort.Strings(profiles)
+	virtual.SecurityLogProfiles = &profiles
+}
+
+// Attach an existing Analytics (AVR) profile to collect per-application
+// statistics on the BIG-IP. AVR only reports on HTTP traffic.
+func setVirtualAnalyticsProfile(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	val, ok := annotations[analyticsProfileAnnotation]
+	if !ok {
+		return
+	}
+	partition, name, ok := splitBigIPPath(strings.TrimSpace(val))
+	if !ok {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+			"must be a full path like /Common/analytics",
+			val, analyticsProfileAnnotation, resourceName)
+		return
+	}
+	if strings.ToLower(virtual.Mode) != "http" {
+		log.Warningf("Annotation %v on '%v' is ignored, analytics "+
+			"requires an http virtual server",
+			analyticsProfileAnnotation, resourceName)
+		return
+	}
+	virtual.AddOrUpdateProfile(ProfileRef{
+		Partition: partition,
+		Name:      name,
+		Context:   customProfileAll,
+	})
+}
+
+// Attach an existing DoS profile, so the application is covered by the DDoS
+// protection of the BIG-IP. The AFM or ASM module enforces the network and
+// application (L7) protections of the profile; the latter only apply to
+// http virtual servers.
+func setVirtualDosProfile(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	val, ok := annotations[dosProfileAnnotation]
+	if !ok {
+		return
+	}
+	partition, name, ok := splitBigIPPath(strings.TrimSpace(val))
+	if !ok {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+			"must be a full path like /Common/dos",
+			val, dosProfileAnnotation, resourceName)
+		return
+	}
+	virtual.AddOrUpdateProfile(ProfileRef{
+		Partition: partition,
+		Name:      name,
+		Context:   customProfileAll,
+	})
+}
+
+// Parent of the OneConnect profiles created from the options annotation
+const defaultOneConnectProfile = "/Common/oneconnect"
+
+// Parse the OneConnect options annotation, a JSON object of the connection
+// reuse options of the profile
+func parseOneConnectOptions(val string) (*oneConnectOptions, error) {
+	var opts oneConnectOptions
+	err := json.Unmarshal([]byte(val), &opts)
+	if nil != err {
+		return nil, err
+	}
+	for _, opt := range []struct {
+		name  string
+		value *int
+	}{
+		{"maxSize", opts.MaxSize},
+		{"maxReuse", opts.MaxReuse},
+		{"maxAge", opts.MaxAge},
+		{"idleTimeoutOverride", opts.IdleTimeoutOverride},
+	} {
+		if nil != opt.value && *opt.value < 0 {
+			return nil, fmt.Errorf("%s must not be negative", opt.name)
+		}
+	}
+	if "" != opts.SourceMask && nil == net.ParseIP(opts.SourceMask) {
+		return nil, fmt.Errorf("sourceMask must be an IP address mask")
+	}
+	return &opts, nil
+}
+
+// Attach a OneConnect profile so that the virtual server reuses idle
+// server-side connections for the requests of other clients. The profile
+// annotation attaches an existing profile; with the options annotation, a
+// profile of the virtual server is created from it, or from
+// /Common/oneconnect, with the options set.
+func setVirtualOneConnect(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	virtual.OneConnect = nil
+	profVal, hasProfile := annotations[oneConnectProfileAnnotation]
+	optsVal, hasOptions := annotations[oneConnectOptionsAnnotation]
+	if !hasProfile && !hasOptions {
+		return
+	}
+	if strings.ToLower(virtual.Mode) != "http" {
+		log.Warningf("OneConnect annotations on '%v' are ignored, "+
+			"OneConnect requires an http virtual server", resourceName)
+		return
+	}
+	parent := defaultOneConnectProfile
+	if hasProfile {
+		partition, name, ok := splitBigIPPath(profVal)
+		if !ok {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be a full path like /Common/oneconnect",
+				profVal, oneConnectProfileAnnotation, resourceName)
+			return
+		}
+		parent = fmt.Sprintf("/%s/%s", partition, name)
+	}
+	if !hasOptions {
+		partition, name, _ := splitBigIPPath(parent)
+		virtual.AddOrUpdateProfile(ProfileRef{
+			Partition: partition,
+			Name:      name,
+			Context:   customProfileAll,
+		})
+		return
+	}
+	opts, err := parseOneConnectOptions(optsVal)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			optsVal, oneConnectOptionsAnnotation, resourceName, err)
+		return
+	}
+	virtual.OneConnect = &oneConnectProfile{
+		Name:              virtual.VirtualServerName + "_oneconnect",
+		Partition:         virtual.Partition,
+		DefaultsFrom:      parent,
+		oneConnectOptions: *opts,
+	}
+	virtual.AddOrUpdateProfile(ProfileRef{
+		Partition: virtual.OneConnect.Partition,
+		Name:      virtual.OneConnect.Name,
+		Context:   customProfileAll,
+	})
+}
+
+// Attach an existing bandwidth controller policy to cap the throughput of
+// the application. Like the security logging profiles, the policy is set
+// outside of CCCL, and is left alone without the annotation.
+func setVirtualBandwidthPolicy(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	virtual.BwcPolicy = nil
+	val, ok := annotations[bandwidthPolicyAnnotation]
+	if !ok {
+		return
+	}
+	policy := ""
+	if strings.TrimSpace(val) != "none" {
+		partition, name, ok := splitBigIPPath(strings.TrimSpace(val))
+		if !ok {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be a full path like /Common/bwc-10mbps",
+				val, bandwidthPolicyAnnotation, resourceName)
+			return
+		}
+		policy = fmt.Sprintf("/%s/%s", partition, name)
+	}
+	virtual.BwcPolicy = &policy
+}
+
+// Parse the iRules annotation, comma-separated full paths of existing
+// iRules. Rules of iRulesLX plugins are in a folder named after the plugin,
+// like /Common/my_plugin/my_rule.
+func parseIRuleRefs(val string) ([]string, error) {
+	var rules []string
+	for _, path := range strings.Split(val, ",") {
+		path = strings.TrimSpace(path)
+		parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		valid := strings.HasPrefix(path, "/") &&
+			(2 == len(parts) || 3 == len(parts))
+		for _, part := range parts {
+			valid = valid && "" != part
+		}
+		if !valid {
+			return nil, fmt.Errorf("'%v' is not a full path like "+
+				"/Common/my_rule or /Common/my_plugin/my_rule", path)
+		}
+		rules = append(rules, path)
+	}
+	return rules, nil
+}
+
+// Attach existing iRules, including those of iRulesLX workspaces, after the
+// iRules of the controller
+func setVirtualIRules(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	val, ok := annotations[iRulesAnnotation]
+	if !ok {
+		return
+	}
+	rules, err := parseIRuleRefs(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, iRulesAnnotation, resourceName, err)
+		return
+	}
+	for _, rule := range rules {
+		virtual.AddIRule(rule)
+	}
+}
+
+// Attach an existing APM access profile, and the per-request policy it
+// runs on each request. Like the bandwidth controller policy, the
+// per-request policy is set outside of CCCL, and is left alone without the
+// annotation.
+func setVirtualAccessPolicy(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	virtual.PerRequestPolicy = nil
+	hasProfile := false
+	if val, ok := annotations[accessProfileAnnotation]; ok {
+		partition, name, ok := splitBigIPPath(val)
+		if !ok {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be a full path like /Common/access",
+				val, accessProfileAnnotation, resourceName)
+		} else if strings.ToLower(virtual.Mode) != "http" {
+			log.Warningf("Annotation %v on '%v' is ignored, access "+
+				"profiles require an http virtual server",
+				accessProfileAnnotation, resourceName)
+		} else {
+			virtual.AddOrUpdateProfile(ProfileRef{
+				Partition: partition,
+				Name:      name,
+				Context:   customProfileAll,
+			})
+			hasProfile = true
+		}
+	}
+	val, ok := annotations[perRequestPolicyAnnotation]
+	if !ok {
+		return
+	}
+	policy := ""
+	if strings.TrimSpace(val) != "none" {
+		partition, name, ok := splitBigIPPath(val)
+		if !ok {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be a full path like /Common/per-request",
+				val, perRequestPolicyAnnotation, resourceName)
+			return
+		}
+		if !hasProfile {
+			log.Warningf("Annotation %v on '%v' is ignored, per-request "+
+				"policies require the %v annotation",
+				perRequestPolicyAnnotation, resourceName,
+				accessProfileAnnotation)
+			return
+		}
+		policy = fmt.Sprintf("/%s/%s", partition, name)
+	}
+	virtual.PerRequestPolicy = &policy
+}
+
+// Users get a fallback pool or a maintenance page instead of connection
+// resets when the pool of the virtual server has no active members. Both
+// are looked up by the sorry server iRule in its data groups, which are
+// filled from the MetaData when the config is written.
+func setVirtualSorryServer(
+	cfg *ResourceConfig,
+	annotations map[string]string,
+	resourceName string,
+	partition string,
+) {
+	cfg.MetaData.FallbackPool = ""
+	cfg.MetaData.MaintenancePage = ""
+	cfg.MetaData.MaintenanceStatus = 0
+	if val, ok := annotations[fallbackPoolAnnotation]; ok {
+		partition, name, ok := splitBigIPPath(val)
+		if !ok {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be a full path like /Common/sorry-pool",
+				val, fallbackPoolAnnotation, resourceName)
+		} else {
+			cfg.MetaData.FallbackPool = fmt.Sprintf("/%s/%s", partition, name)
+		}
+	}
+	if val, ok := annotations[maintenancePageAnnotation]; ok {
+		if "" == strings.TrimSpace(val) {
+			log.Warningf("Annotation %v on '%v' is ignored, the page is empty",
+				maintenancePageAnnotation, resourceName)
+		} else {
+			cfg.MetaData.MaintenancePage = val
+		}
+	}
+	if val, ok := annotations[maintenanceStatusAnnotation]; ok {
+		code, err := parseMaintenanceStatus(val)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+				val, maintenanceStatusAnnotation, resourceName, err)
+		} else if "" == cfg.MetaData.MaintenancePage {
+			log.Warningf("Annotation %v on '%v' is ignored, it requires the "+
+				"%v annotation", maintenanceStatusAnnotation, resourceName,
+				maintenancePageAnnotation)
+		} else {
+			cfg.MetaData.MaintenanceStatus = code
+		}
+	}
+	if "" == cfg.MetaData.FallbackPool && "" == cfg.MetaData.MaintenancePage {
+		return
+	}
+	if strings.ToLower(cfg.Virtual.Mode) != "http" {
+		log.Warningf("Annotations %v and %v on '%v' are ignored, they "+
+			"require an http virtual server", fallbackPoolAnnotation,
+			maintenancePageAnnotation, resourceName)
+		cfg.MetaData.FallbackPool = ""
+		cfg.MetaData.MaintenancePage = ""
+		cfg.MetaData.MaintenanceStatus = 0
+		return
+	}
+	cfg.Virtual.AddIRule(fmt.Sprintf("/%s/%s", partition,
+		sorryServerIRuleName))
+}
+
+// Status code of the maintenance page, such as 503 or 200
+func parseMaintenanceStatus(val string) (int, error) {
+	code, err := strconv.Atoi(strings.TrimSpace(val))
+	if nil != err || code < 200 || code > 599 {
+		return 0, fmt.Errorf("must be an HTTP status code from 200 to 599")
+	}
+	return code, nil
+}
+
+// Partition and name of a BIG-IP object from its full path, with or without
+// the leading '/'
+func splitBigIPPath(path string) (string, string, bool) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(path), "/"), "/")
+	if len(parts) != 2 || "" == parts[0] || "" == parts[1] {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// Set the session resumption options of a client SSL profile from the
+// annotations of the resource it is created for. Compliance rules may
+// require session tickets or the session cache to be disabled.
+func setSslSessionOptions(
+	cp *CustomProfile,
+	annotations map[string]string,
+	resourceName string,
+) {
+	if val, ok := annotations[sslSessionTicketAnnotation]; ok {
+		enabled, err := strconv.ParseBool(val)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be true or false", val, sslSessionTicketAnnotation,
+				resourceName)
+		} else if enabled {
+			cp.SessionTicket = "enabled"
+		} else {
+			cp.SessionTicket = "disabled"
+		}
+	}
+	if val, ok := annotations[sslCacheSizeAnnotation]; ok {
+		size, err := strconv.Atoi(val)
+		if nil != err || size < 0 {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"must be a non-negative integer", val, sslCacheSizeAnnotation,
+				resourceName)
+		} else {
+			cp.CacheSize = &size
+		}
+	}
+}
+
 func createRSConfigFromRoute(
 	route *routeapi.Route,
 	resources Resources,
 	routeConfig RouteConfig,
 	pStruct portStruct,
+) (ResourceConfig, error) {
+	return buildRouteConfig(controllerPartitions(), route, &resources,
+		routeConfig, pStruct)
+}
+
+// Build the config of the virtual server of a protocol with a Route for the
+// partitions, adding the Route to the config stored in resources if any
+func buildRouteConfig(
+	partitions Partitions,
+	route *routeapi.Route,
+	resources *Resources,
+	routeConfig RouteConfig,
+	pStruct portStruct,
 ) (ResourceConfig, error) {
 	var rsCfg ResourceConfig
-	var policyName, rsName string
+	var policyName string
 
 	if pStruct.protocol == "http" {
 		policyName = "openshift_insecure_routes"
-		rsName = formatRouteVSName(route, "http")
 	} else {
 		policyName = "openshift_secure_routes"
-		rsName = formatRouteVSName(route, "https")
+	}
+	rsName := formatRoutePortVSName(route, pStruct)
+	if pStruct.port != DEFAULT_HTTP_PORT && pStruct.port != DEFAULT_HTTPS_PORT {
+		// Extra listener port, with its own virtual server and policy for
+		// the Routes that request it
+		policyName = fmt.Sprintf("%s_%d", policyName, pStruct.port)
 	}
 	tls := route.Spec.TLS
 
@@ -712,14 +2132,19 @@ func createRSConfigFromRoute(
 	// Create the pool
 	pool := Pool{
 		Name:        formatRoutePoolName(route),
-		Partition:   DEFAULT_PARTITION,
+		Partition:   partitions.Default,
 		Balance:     DEFAULT_BALANCE,
 		ServiceName: route.Spec.To.Name,
 		ServicePort: backendPort,
 	}
+	pools := []Pool{pool}
+	setPoolServiceDownOptions(pools, route.ObjectMeta.Annotations,
+		route.ObjectMeta.Name)
+	pool = pools[0]
 	// Create the rule
 	uri := route.Spec.Host + route.Spec.Path
-	rule, err := createRule(uri, pool.Name, pool.Partition, formatRouteRuleName(route))
+	rule, err := createRule(uri, pool.Name, pool.Partition,
+		formatRouteRuleName(route))
 	if nil != err {
 		err = fmt.Errorf("Error configuring rule for Route %s: %v", route.ObjectMeta.Name, err)
 		return rsCfg, err
@@ -734,9 +2159,11 @@ func createRSConfigFromRoute(
 		rsCfg = *cfgs[0]
 		// If this pool doesn't already exist, add it
 		var found bool
-		for _, pl := range rsCfg.Pools {
+		for i, pl := range rsCfg.Pools {
 			if pl.Name == pool.Name {
 				found = true
+				rsCfg.Pools[i].ServiceDownAction = pool.ServiceDownAction
+				rsCfg.Pools[i].ReselectTries = pool.ReselectTries
 			}
 		}
 		if !found {
@@ -753,13 +2180,14 @@ func createRSConfigFromRoute(
 			}
 		}
 		if !found {
-			rsCfg.HandleRouteTls(tls, pStruct.protocol, policyName, rule)
+			rsCfg.HandleRouteTls(tls, pStruct.protocol, policyName, rule,
+				partitions.Default)
 		}
 	} else { // This is a new VS for a Route
 		rsCfg.MetaData.ResourceType = "route"
 		rsCfg.Virtual.VirtualServerName = rsName
 		rsCfg.Virtual.Mode = "http"
-		rsCfg.Virtual.Partition = DEFAULT_PARTITION
+		rsCfg.Virtual.Partition = partitions.Default
 		rsCfg.Virtual.VirtualAddress = &virtualAddress{}
 		rsCfg.Virtual.VirtualAddress.Port = pStruct.port
 		if routeConfig.RouteVSAddr != "" {
@@ -767,17 +2195,64 @@ func createRSConfigFromRoute(
 		}
 		rsCfg.Pools = append(rsCfg.Pools, pool)
 
-		rsCfg.HandleRouteTls(tls, pStruct.protocol, policyName, rule)
+		rsCfg.HandleRouteTls(tls, pStruct.protocol, policyName, rule,
+			partitions.Default)
 	}
 
 	return rsCfg, nil
 }
 
+// Parse a comma separated list of extra listener ports. The default ports
+// are always used and cannot be listed.
+func parseRouteExtraPorts(val string) ([]int32, error) {
+	var ports []int32
+	seen := make(map[int32]bool)
+	for _, p := range strings.Split(val, ",") {
+		port, err := strconv.Atoi(strings.TrimSpace(p))
+		if nil != err || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("'%v' is not a port", strings.TrimSpace(p))
+		}
+		if int32(port) == DEFAULT_HTTP_PORT || int32(port) == DEFAULT_HTTPS_PORT {
+			return nil, fmt.Errorf("port %v is always used", port)
+		}
+		if !seen[int32(port)] {
+			seen[int32(port)] = true
+			ports = append(ports, int32(port))
+		}
+	}
+	return ports, nil
+}
+
+// Extra listener ports of a Route from its annotation. The virtual servers
+// on these ports are https if the Route has TLS termination, http otherwise.
+func routeExtraPorts(route *routeapi.Route) []portStruct {
+	val, ok := route.ObjectMeta.Annotations[routeExtraPortsAnnotation]
+	if !ok {
+		return nil
+	}
+	ports, err := parseRouteExtraPorts(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, routeExtraPortsAnnotation, route.ObjectMeta.Name, err)
+		return nil
+	}
+	protocol := "http"
+	if nil != route.Spec.TLS && len(route.Spec.TLS.Termination) != 0 {
+		protocol = "https"
+	}
+	var pStructs []portStruct
+	for _, port := range ports {
+		pStructs = append(pStructs, portStruct{protocol: protocol, port: port})
+	}
+	return pStructs
+}
+
 func (rc *ResourceConfig) HandleRouteTls(
 	tls *routeapi.TLSConfig,
 	protocol string,
 	policyName string,
 	rule *Rule,
+	partition string,
 ) {
 	if protocol == "http" {
 		if nil == tls || len(tls.Termination) == 0 {
@@ -792,7 +2267,7 @@ func (rc *ResourceConfig) HandleRouteTls(
 					rc.AddRuleToPolicy(policyName, rule)
 				case routeapi.InsecureEdgeTerminationPolicyRedirect:
 					redirectIRuleName := fmt.Sprintf("/%s/%s",
-						DEFAULT_PARTITION, httpRedirectIRuleName)
+						partition, httpRedirectIRuleName)
 					rc.Virtual.AddIRule(redirectIRuleName)
 				}
 			}
@@ -801,7 +2276,7 @@ func (rc *ResourceConfig) HandleRouteTls(
 		// https
 		if nil != tls {
 			passThroughRuleName := fmt.Sprintf("/%s/%s",
-				DEFAULT_PARTITION, sslPassthroughIRuleName)
+				partition, sslPassthroughIRuleName)
 			switch tls.Termination {
 			case routeapi.TLSTerminationEdge:
 				rc.AddRuleToPolicy(policyName, rule)
@@ -19,6 +19,8 @@ package appmanager
 import (
 	"fmt"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
 	. "github.com/onsi/ginkgo"
@@ -69,7 +71,7 @@ func newTestMap(nbrBackends, nbrConfigsPer int) *resourceMap {
 		svcKey := newServiceKey(int32(svcPort+i), svcName, namespace)
 		for j := 0; j < nbrConfigsPer; j++ {
 			cfgName := fmt.Sprintf("rs-%d-%d", i, j)
-			addr := virtualAddress{"10.0.0.1", int32(bindPort + j)}
+			addr := virtualAddress{BindAddr: "10.0.0.1", Port: int32(bindPort + j)}
 			rm[svcKey] = append(rm[svcKey], simpleTestConfig{cfgName, addr})
 		}
 	}
@@ -319,6 +321,95 @@ var _ = Describe("Resource Config Tests", func() {
 				Expect(len(rsCfgMap)).To(Equal(nbrCfgsPer))
 			}
 		})
+
+		It("takes independent snapshots", func() {
+			// Test Snapshot() to make sure the copies share nothing with the store.
+			for key, val := range *rm {
+				r, _ := rs.Get(key, val[0].name)
+				r.Pools = []Pool{{Name: "pool", Members: []Member{{Address: "10.0.0.1"}}}}
+				r.Policies = []Policy{{Name: "policy", Rules: []*Rule{
+					{Name: "rule", Conditions: []*condition{{Values: []string{"foo"}}}},
+				}}}
+				r.Virtual.IAppVariables = map[string]string{"var": "value"}
+			}
+			snapshot := rs.Snapshot()
+			Expect(snapshot.Count()).To(Equal(rs.Count()))
+
+			snapshot.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+				r, ok := rs.Get(key, cfg.Virtual.VirtualServerName)
+				Expect(ok).To(BeTrue())
+				Expect(cfg).To(Equal(r))
+				Expect(cfg).ToNot(BeIdenticalTo(r))
+				cfg.Virtual.VirtualAddress.Port += 1
+				if nil != cfg.Virtual.IAppVariables {
+					cfg.Pools[0].Members[0].Address = "10.0.0.2"
+					cfg.Policies[0].Rules[0].Conditions[0].Values[0] = "bar"
+					cfg.Virtual.IAppVariables["var"] = "changed"
+					Expect(r.Pools[0].Members[0].Address).To(Equal("10.0.0.1"))
+					Expect(r.Policies[0].Rules[0].Conditions[0].Values[0]).To(Equal("foo"))
+					Expect(r.Virtual.IAppVariables["var"]).To(Equal("value"))
+				}
+				Expect(cfg.Virtual.VirtualAddress.Port).ToNot(
+					Equal(r.Virtual.VirtualAddress.Port))
+			})
+
+			// Snapshots are ordered
+			Expect(rs.Snapshot().seq).To(BeNumerically(">", snapshot.seq))
+		})
+
+		It("compares configs by content hash", func() {
+			// Test HashMatches() and Invalidate() to make sure cached hashes
+			// track the stored configs.
+			for key, val := range *rm {
+				for _, tf := range val {
+					r, _ := rs.Get(key, tf.name)
+					same := *r
+					Expect(rs.HashMatches(key, tf.name, same.contentHash())).To(BeTrue())
+					Expect(rs.hashes[key]).To(HaveKey(tf.name))
+
+					same.MetaData.Active = !r.MetaData.Active
+					Expect(rs.HashMatches(key, tf.name, same.contentHash())).To(BeFalse())
+
+					// A config changed in place is only seen after Invalidate()
+					r.Virtual.Disabled = !r.Virtual.Disabled
+					changed := *r
+					Expect(rs.HashMatches(key, tf.name, changed.contentHash())).To(BeFalse())
+					rs.Invalidate(key, tf.name)
+					Expect(rs.HashMatches(key, tf.name, changed.contentHash())).To(BeTrue())
+
+					// Assign() drops the cached hash
+					rs.Assign(key, tf.name, &same)
+					Expect(rs.hashes[key]).ToNot(HaveKey(tf.name))
+					Expect(rs.HashMatches(key, tf.name, same.contentHash())).To(BeTrue())
+				}
+			}
+			Expect(rs.HashMatches(serviceKey{ServiceName: "none"}, "none", 0)).To(BeFalse())
+		})
+
+		It("hashes every field of configs", func() {
+			cfg := &ResourceConfig{}
+			cfg.Pools = []Pool{{
+				Name:    "pool",
+				Members: []Member{{Address: "10.2.96.3", Port: 80}},
+			}}
+			hash := cfg.contentHash()
+			Expect(cfg.copy().contentHash()).To(Equal(hash))
+
+			// Fields that are not marshalled are hashed too
+			changed := cfg.copy()
+			changed.Pools[0].Members[0].Description = "Pod default/foo-1"
+			Expect(changed.contentHash()).ToNot(Equal(hash))
+			changed = cfg.copy()
+			changed.Pools[0].StaticMembers = []Member{
+				{Address: "192.168.1.10", Port: 80}}
+			Expect(changed.contentHash()).ToNot(Equal(hash))
+
+			// Values cannot run into each other
+			changed = cfg.copy()
+			changed.Pools[0].Name = "poo"
+			changed.Pools[0].Balance = "l"
+			Expect(changed.contentHash()).ToNot(Equal(hash))
+		})
 	})
 
 	Describe("Config Manipulation", func() {
@@ -435,7 +526,7 @@ var _ = Describe("Resource Config Tests", func() {
 				protocol: "http",
 				port:     80,
 			}
-			cfg := createRSConfigFromIngress(ingress, namespace, nil, ps)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
 			Expect(cfg.Pools[0].Balance).To(Equal("round-robin"))
 			Expect(cfg.Virtual.Mode).To(Equal("http"))
 			Expect(cfg.Virtual.Partition).To(Equal("velcro"))
@@ -454,7 +545,7 @@ var _ = Describe("Resource Config Tests", func() {
 				protocol: "http",
 				port:     100,
 			}
-			cfg = createRSConfigFromIngress(ingress, namespace, nil, ps)
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
 			Expect(cfg.Pools[0].Balance).To(Equal("foobar"))
 			Expect(cfg.Virtual.VirtualAddress.Port).To(Equal(int32(100)))
 
@@ -462,10 +553,614 @@ var _ = Describe("Resource Config Tests", func() {
 				map[string]string{
 					"kubernetes.io/ingress.class": "notf5",
 				})
-			cfg = createRSConfigFromIngress(ingress, namespace, nil, ps)
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
 			Expect(cfg).To(BeNil())
 		})
 
+		It("configures pool service down options", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				map[string]string{
+					"virtual-server.f5.com/ip":                  "1.2.3.4",
+					"virtual-server.f5.com/service-down-action": "Reselect",
+					"virtual-server.f5.com/reselect-tries":      "3",
+				})
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Pools[0].ServiceDownAction).To(Equal("reselect"))
+			Expect(cfg.Pools[0].ReselectTries).To(Equal(3))
+
+			// Invalid values are ignored
+			ingress = test.NewIngress("ingress", "1", namespace, ingressConfig,
+				map[string]string{
+					"virtual-server.f5.com/ip":                  "1.2.3.4",
+					"virtual-server.f5.com/service-down-action": "explode",
+					"virtual-server.f5.com/reselect-tries":      "-1",
+				})
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Pools[0].ServiceDownAction).To(Equal(""))
+			Expect(cfg.Pools[0].ReselectTries).To(Equal(0))
+		})
+
+		It("disables virtual servers via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				map[string]string{
+					"virtual-server.f5.com/ip": "1.2.3.4",
+					"f5.com/disable-vs":        "true",
+				})
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Disabled).To(BeTrue())
+			Expect(len(cfg.Pools)).To(Equal(1))
+
+			resources := PartitionMap{
+				"velcro": &BigIPConfig{Virtuals: Virtuals{cfg.Virtual}},
+			}
+			var wg sync.WaitGroup
+			wg.Add(1)
+			reformatVirtuals(resources, "velcro", &wg)
+			Expect(resources["velcro"].Virtuals[0].Enabled).To(BeFalse())
+
+			// Invalid values leave the virtual server enabled
+			ingress = test.NewIngress("ingress", "1", namespace, ingressConfig,
+				map[string]string{
+					"virtual-server.f5.com/ip": "1.2.3.4",
+					"f5.com/disable-vs":        "maybe",
+				})
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Disabled).To(BeFalse())
+		})
+
+		It("enables proxy protocol via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			for version, ruleName := range map[string]string{
+				"v1": proxyProtocolV1IRuleName,
+				"V2": proxyProtocolV2IRuleName,
+			} {
+				ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+					map[string]string{
+						"virtual-server.f5.com/ip":             "1.2.3.4",
+						"virtual-server.f5.com/proxy-protocol": version,
+					})
+				cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+				Expect(cfg.Virtual.IRules).To(Equal([]string{
+					fmt.Sprintf("/%s/%s", DEFAULT_PARTITION, ruleName)}))
+			}
+
+			// Invalid values add no iRule
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				map[string]string{
+					"virtual-server.f5.com/ip":             "1.2.3.4",
+					"virtual-server.f5.com/proxy-protocol": "v3",
+				})
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.IRules).To(BeEmpty())
+		})
+
+		It("preserves fields with the merge policy", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			annotations := map[string]string{
+				"virtual-server.f5.com/ip":           "1.2.3.4",
+				"virtual-server.f5.com/merge-policy": "merge",
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				annotations)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.PreserveFields).To(Equal(
+				[]string{"connectionLimit", "description"}))
+
+			annotations["virtual-server.f5.com/preserve-fields"] =
+				" translateAddress, description,"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.PreserveFields).To(Equal(
+				[]string{"description", "translateAddress"}))
+
+			// Fields the controller sets, or outside the schema, are dropped
+			annotations["virtual-server.f5.com/preserve-fields"] =
+				"pool,rateLimit,connectionLimit"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.PreserveFields).To(Equal(
+				[]string{"connectionLimit"}))
+
+			// Fields are only preserved with the merge policy
+			annotations["virtual-server.f5.com/merge-policy"] = "replace"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.PreserveFields).To(BeNil())
+			annotations["virtual-server.f5.com/merge-policy"] = "keep"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.PreserveFields).To(BeNil())
+			delete(annotations, "virtual-server.f5.com/merge-policy")
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.PreserveFields).To(BeNil())
+		})
+
+		It("attaches logging profiles via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			annotations := map[string]string{
+				"virtual-server.f5.com/ip":                  "1.2.3.4",
+				"virtual-server.f5.com/request-log-profile": "/Common/request-log",
+				"virtual-server.f5.com/security-logging": "/Common/Log all requests, " +
+					"Common/local-dos",
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				annotations)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Profiles).To(Equal(ProfileRefs{{
+				Partition: "Common",
+				Name:      "request-log",
+				Context:   customProfileAll,
+			}}))
+			Expect(*cfg.Virtual.SecurityLogProfiles).To(Equal(
+				[]string{"/Common/Log all requests", "/Common/local-dos"}))
+
+			// "none" removes the security logging profiles
+			annotations["virtual-server.f5.com/security-logging"] = "none"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.SecurityLogProfiles).ToNot(BeNil())
+			Expect(*cfg.Virtual.SecurityLogProfiles).To(BeEmpty())
+
+			// Invalid paths are ignored
+			annotations["virtual-server.f5.com/request-log-profile"] = "request-log"
+			annotations["virtual-server.f5.com/security-logging"] = "local-dos"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Profiles).To(BeEmpty())
+			Expect(cfg.Virtual.SecurityLogProfiles).To(BeNil())
+
+			// Request logging requires an http virtual server
+			virtual := Virtual{Mode: "tcp"}
+			setVirtualLogProfiles(&virtual, map[string]string{
+				"virtual-server.f5.com/request-log-profile": "/Common/request-log",
+			}, "foomap")
+			Expect(virtual.Profiles).To(BeEmpty())
+			Expect(virtual.SecurityLogProfiles).To(BeNil())
+		})
+
+		It("attaches analytics profiles via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			annotations := map[string]string{
+				"virtual-server.f5.com/ip":                "1.2.3.4",
+				"virtual-server.f5.com/analytics-profile": "/Common/analytics",
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				annotations)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Profiles).To(Equal(ProfileRefs{{
+				Partition: "Common",
+				Name:      "analytics",
+				Context:   customProfileAll,
+			}}))
+
+			// Invalid paths are ignored
+			annotations["virtual-server.f5.com/analytics-profile"] = "analytics"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Profiles).To(BeEmpty())
+
+			// Analytics requires an http virtual server
+			virtual := Virtual{Mode: "tcp"}
+			setVirtualAnalyticsProfile(&virtual, map[string]string{
+				"virtual-server.f5.com/analytics-profile": "/Common/analytics",
+			}, "foomap")
+			Expect(virtual.Profiles).To(BeEmpty())
+		})
+
+		It("enables virtual servers on schedule via annotation", func() {
+			schedule, err := parseActiveSchedule(
+				"Mon-Fri 09:00-17:00; sat,Sun 22:00-02:00")
+			Expect(err).To(BeNil())
+			Expect(schedule).To(HaveLen(2))
+			// 2017-06-05 is a Monday
+			at := func(day, hour, minute int) time.Time {
+				return time.Date(2017, 6, day, hour, minute, 0, 0, time.UTC)
+			}
+			Expect(schedule.activeAt(at(5, 9, 0))).To(BeTrue())
+			Expect(schedule.activeAt(at(5, 16, 59))).To(BeTrue())
+			Expect(schedule.activeAt(at(5, 17, 0))).To(BeFalse())
+			Expect(schedule.activeAt(at(5, 8, 59))).To(BeFalse())
+			Expect(schedule.activeAt(at(10, 12, 0))).To(BeFalse())
+			// Windows ending before their start end on the next day
+			Expect(schedule.activeAt(at(10, 23, 0))).To(BeTrue())
+			Expect(schedule.activeAt(at(12, 1, 0))).To(BeTrue())
+			Expect(schedule.activeAt(at(12, 2, 0))).To(BeFalse())
+			// Times are in UTC
+			est := time.FixedZone("EST", -5*3600)
+			Expect(schedule.activeAt(
+				time.Date(2017, 6, 5, 5, 0, 0, 0, est))).To(BeTrue())
+
+			for _, val := range []string{
+				"", "Mon-Fri", "Mon-Fri 09:00", "Mon-Fru 09:00-17:00",
+				"* 9:00-17:00", "* 09:00-24:30", "* 09:00-09:00",
+			} {
+				_, err = parseActiveSchedule(val)
+				Expect(err).ToNot(BeNil(), val)
+			}
+			schedule, err = parseActiveSchedule("* 00:00-24:00")
+			Expect(err).To(BeNil())
+			Expect(schedule.activeAt(at(11, 23, 59))).To(BeTrue())
+
+			cfg := &ResourceConfig{}
+			annotations := map[string]string{
+				activeScheduleAnnotation: "Mon-Fri 09:00-17:00",
+			}
+			setVirtualSchedule(cfg, annotations, "foomap", at(10, 12, 0))
+			Expect(cfg.MetaData.Schedule).ToNot(BeNil())
+			Expect(cfg.MetaData.ScheduledOff).To(BeTrue())
+			Expect(cfg.Virtual.Disabled).To(BeTrue())
+
+			cfg = &ResourceConfig{}
+			setVirtualSchedule(cfg, annotations, "foomap", at(5, 12, 0))
+			Expect(cfg.MetaData.ScheduledOff).To(BeFalse())
+			Expect(cfg.Virtual.Disabled).To(BeFalse())
+
+			// Invalid schedules are ignored
+			annotations[activeScheduleAnnotation] = "weekdays"
+			setVirtualSchedule(cfg, annotations, "foomap", at(10, 12, 0))
+			Expect(cfg.MetaData.Schedule).To(BeNil())
+			Expect(cfg.Virtual.Disabled).To(BeFalse())
+		})
+
+		It("attaches DoS profiles via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			annotations := map[string]string{
+				"virtual-server.f5.com/ip":          "1.2.3.4",
+				"virtual-server.f5.com/dos-profile": "/Common/dos",
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				annotations)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Profiles).To(Equal(ProfileRefs{{
+				Partition: "Common",
+				Name:      "dos",
+				Context:   customProfileAll,
+			}}))
+
+			// Invalid paths are ignored
+			annotations["virtual-server.f5.com/dos-profile"] = "dos"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Profiles).To(BeEmpty())
+
+			// Network DoS protection applies to any virtual server
+			virtual := Virtual{Mode: "tcp"}
+			setVirtualDosProfile(&virtual, map[string]string{
+				"virtual-server.f5.com/dos-profile": "/Common/dos",
+			}, "foomap")
+			Expect(virtual.Profiles).To(HaveLen(1))
+		})
+
+		It("attaches OneConnect profiles via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			annotations := map[string]string{
+				"virtual-server.f5.com/ip":                 "1.2.3.4",
+				"virtual-server.f5.com/oneconnect-profile": "/Common/oneconnect",
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				annotations)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.OneConnect).To(BeNil())
+			Expect(cfg.Virtual.Profiles).To(Equal(ProfileRefs{{
+				Partition: "Common",
+				Name:      "oneconnect",
+				Context:   customProfileAll,
+			}}))
+
+			// Options create a profile for the virtual server
+			annotations["virtual-server.f5.com/oneconnect-profile"] =
+				"/Common/oneconnect-tuned"
+			annotations["virtual-server.f5.com/oneconnect-options"] =
+				`{"maxSize": 1000, "maxReuse": 100, "sourceMask": "255.255.255.255"}`
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			maxSize, maxReuse := 1000, 100
+			Expect(cfg.Virtual.OneConnect).To(Equal(&oneConnectProfile{
+				Name:         "default_ingress-ingress_http_oneconnect",
+				Partition:    cfg.Virtual.Partition,
+				DefaultsFrom: "/Common/oneconnect-tuned",
+				oneConnectOptions: oneConnectOptions{
+					MaxSize:    &maxSize,
+					MaxReuse:   &maxReuse,
+					SourceMask: "255.255.255.255",
+				},
+			}))
+			Expect(cfg.Virtual.Profiles).To(Equal(ProfileRefs{{
+				Partition: cfg.Virtual.Partition,
+				Name:      "default_ingress-ingress_http_oneconnect",
+				Context:   customProfileAll,
+			}}))
+
+			// Without a profile, the options apply to /Common/oneconnect
+			delete(annotations, "virtual-server.f5.com/oneconnect-profile")
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.OneConnect).ToNot(BeNil())
+			Expect(cfg.Virtual.OneConnect.DefaultsFrom).To(
+				Equal("/Common/oneconnect"))
+
+			// Invalid options are ignored
+			annotations["virtual-server.f5.com/oneconnect-options"] =
+				`{"maxReuse": -1}`
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.OneConnect).To(BeNil())
+			Expect(cfg.Virtual.Profiles).To(BeEmpty())
+
+			// OneConnect requires an http virtual server
+			virtual := Virtual{Mode: "tcp"}
+			setVirtualOneConnect(&virtual, map[string]string{
+				"virtual-server.f5.com/oneconnect-profile": "/Common/oneconnect",
+			}, "foomap")
+			Expect(virtual.Profiles).To(BeEmpty())
+		})
+
+		It("attaches bandwidth controller policies via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			annotations := map[string]string{
+				"virtual-server.f5.com/ip":               "1.2.3.4",
+				"virtual-server.f5.com/bandwidth-policy": "Common/bwc-10mbps",
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				annotations)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.BwcPolicy).ToNot(BeNil())
+			Expect(*cfg.Virtual.BwcPolicy).To(Equal("/Common/bwc-10mbps"))
+
+			// "none" removes the policy
+			annotations["virtual-server.f5.com/bandwidth-policy"] = "none"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.BwcPolicy).ToNot(BeNil())
+			Expect(*cfg.Virtual.BwcPolicy).To(BeEmpty())
+
+			// Invalid paths and missing annotations leave the policy alone
+			annotations["virtual-server.f5.com/bandwidth-policy"] = "bwc-10mbps"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.BwcPolicy).To(BeNil())
+			delete(annotations, "virtual-server.f5.com/bandwidth-policy")
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.BwcPolicy).To(BeNil())
+		})
+
+		It("mirrors traffic to clone pools via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			annotations := map[string]string{
+				"virtual-server.f5.com/ip": "1.2.3.4",
+				"virtual-server.f5.com/clone-pools": "/Common/ids_pool, " +
+					"Common/analytics_pool:serverside",
+			}
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				annotations)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.ClonePools).ToNot(BeNil())
+			Expect(*cfg.Virtual.ClonePools).To(Equal([]clonePool{
+				{Name: "/Common/ids_pool", Context: "clientside"},
+				{Name: "/Common/analytics_pool", Context: "serverside"},
+			}))
+
+			// "none" removes the clone pools
+			annotations["virtual-server.f5.com/clone-pools"] = "none"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.ClonePools).ToNot(BeNil())
+			Expect(*cfg.Virtual.ClonePools).To(BeEmpty())
+
+			// Invalid values and missing annotations leave the pools alone
+			for _, val := range []string{"ids_pool", "/Common/ids_pool:both"} {
+				annotations["virtual-server.f5.com/clone-pools"] = val
+				cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+				Expect(cfg.Virtual.ClonePools).To(BeNil(), val)
+			}
+			delete(annotations, "virtual-server.f5.com/clone-pools")
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.ClonePools).To(BeNil())
+		})
+
+		It("attaches iRules and APM policies via annotation", func() {
+			namespace := "default"
+			ingressConfig := v1beta1.IngressSpec{
+				Backend: &v1beta1.IngressBackend{
+					ServiceName: "foo",
+					ServicePort: intstr.IntOrString{IntVal: 80},
+				},
+			}
+			ps := portStruct{
+				protocol: "http",
+				port:     80,
+			}
+			annotations := map[string]string{
+				"virtual-server.f5.com/ip":                 "1.2.3.4",
+				"virtual-server.f5.com/access-profile":     "/Common/access",
+				"virtual-server.f5.com/per-request-policy": "/Common/per-request",
+			}
+			annotations["virtual-server.f5.com/irules"] =
+				"/Common/my_rule, /Common/my_plugin/my_rule"
+			ingress := test.NewIngress("ingress", "1", namespace, ingressConfig,
+				annotations)
+			cfg := createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.IRules).To(Equal([]string{
+				"/Common/my_rule", "/Common/my_plugin/my_rule"}))
+			Expect(cfg.Virtual.Profiles).To(Equal(ProfileRefs{{
+				Partition: "Common",
+				Name:      "access",
+				Context:   customProfileAll,
+			}}))
+			Expect(cfg.Virtual.PerRequestPolicy).ToNot(BeNil())
+			Expect(*cfg.Virtual.PerRequestPolicy).To(
+				Equal("/Common/per-request"))
+
+			// Invalid iRules are all ignored
+			annotations["virtual-server.f5.com/irules"] = "/Common/my_rule,my_rule"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.IRules).To(BeEmpty())
+
+			// "none" removes the per-request policy
+			annotations["virtual-server.f5.com/per-request-policy"] = "none"
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.PerRequestPolicy).ToNot(BeNil())
+			Expect(*cfg.Virtual.PerRequestPolicy).To(BeEmpty())
+
+			// Per-request policies require an access profile
+			annotations["virtual-server.f5.com/per-request-policy"] =
+				"/Common/per-request"
+			delete(annotations, "virtual-server.f5.com/access-profile")
+			cfg = createRSConfigFromIngress(ingress, namespace, nil, nil, ps)
+			Expect(cfg.Virtual.Profiles).To(BeEmpty())
+			Expect(cfg.Virtual.PerRequestPolicy).To(BeNil())
+
+			// Access profiles require an http virtual server
+			virtual := Virtual{Mode: "tcp"}
+			setVirtualAccessPolicy(&virtual, map[string]string{
+				"virtual-server.f5.com/access-profile": "/Common/access",
+			}, "foomap")
+			Expect(virtual.Profiles).To(BeEmpty())
+		})
+
+		It("names route rules reversibly", func() {
+			for _, names := range [][]string{
+				{"default", "route"},
+				{"my_ns", "route"},
+				{"my", "ns_route"},
+				{"default", "www.example.com"},
+				{"default", "weird.2e_name."},
+			} {
+				route := test.NewRoute(names[1], "1", names[0], routeapi.RouteSpec{})
+				ruleName := formatRouteRuleName(route)
+				namespace, name, ok := parseRouteRuleName(ruleName)
+				Expect(ok).To(BeTrue())
+				Expect(namespace).To(Equal(names[0]))
+				Expect(name).To(Equal(names[1]))
+				Expect(formatRouteClientSslProfileName(route)).To(
+					Equal(ruleName + "-https-cert"))
+				Expect(formatRouteServerSslProfileName(route)).To(
+					Equal(ruleName + "-server-ssl"))
+			}
+			route := test.NewRoute("route", "1", "default", routeapi.RouteSpec{})
+			Expect(formatRouteRuleName(route)).To(
+				Equal("openshift_route_default_route"))
+			route = test.NewRoute("ns_route", "1", "my", routeapi.RouteSpec{})
+			Expect(formatRouteRuleName(route)).To(
+				Equal("openshift_route_my_ns.5froute"))
+
+			// Rules named before escaping was added
+			namespace, name, ok := parseRouteRuleName(
+				"openshift_route_default_www.example.com")
+			Expect(ok).To(BeTrue())
+			Expect(namespace).To(Equal("default"))
+			Expect(name).To(Equal("www.example.com"))
+			// Dots followed by a hex code that escaping would not write
+			for _, legacy := range []string{"app.db1", "app.41", "a.2d"} {
+				namespace, name, ok = parseRouteRuleName(
+					"openshift_route_default_" + legacy)
+				Expect(ok).To(BeTrue(), legacy)
+				Expect(namespace).To(Equal("default"))
+				Expect(name).To(Equal(legacy))
+			}
+			// Underscores cannot be split, the rules are still Route rules
+			Expect(isRouteRuleName("openshift_route_a_b_c")).To(BeTrue())
+			Expect(isRouteRuleName("openshift_route_")).To(BeFalse())
+			Expect(isRouteRuleName("openshift_default_foo")).To(BeFalse())
+
+			for _, ruleName := range []string{
+				"openshift_default_foo",
+				"openshift_route_a_b_c",
+				"openshift_route_a.zz_b",
+			} {
+				_, _, ok = parseRouteRuleName(ruleName)
+				Expect(ok).To(BeFalse(), ruleName)
+			}
+		})
+
 		It("properly configures route resources", func() {
 			namespace := "default"
 			spec := routeapi.RouteSpec{
@@ -560,6 +1255,34 @@ var _ = Describe("Resource Config Tests", func() {
 			}
 		})
 
+		It("replaces internal data group records only when they change", func() {
+			idg := NewInternalDataGroup("test-dg", "test")
+			Expect(idg.setRecords(nil)).To(BeFalse(),
+				"No records should be the same as empty records.")
+
+			records := InternalDataGroupRecords{
+				{Name: "b.com", Data: "pool_b"},
+				{Name: "a.com", Data: "pool_a"},
+			}
+			Expect(idg.setRecords(records)).To(BeTrue())
+			Expect(idg.Records).To(Equal(InternalDataGroupRecords{
+				{Name: "a.com", Data: "pool_a"},
+				{Name: "b.com", Data: "pool_b"},
+			}))
+			Expect(records[0].Name).To(Equal("b.com"),
+				"Records passed in should not be sorted in place.")
+
+			// The same records in another order are unchanged
+			reordered := InternalDataGroupRecords{records[1], records[0]}
+			Expect(idg.setRecords(reordered)).To(BeFalse())
+			Expect(idg.contentHash()).To(Equal(
+				(&InternalDataGroup{Records: reordered}).contentHash()))
+
+			records[1].Data = "pool_c"
+			Expect(idg.setRecords(records)).To(BeTrue())
+			Expect(idg.Records[0].Data).To(Equal("pool_c"))
+		})
+
 		It("sets and removes profiles", func() {
 			virtual := Virtual{}
 			Expect(virtual.Profiles.Len()).To(Equal(0))
@@ -688,5 +1411,44 @@ var _ = Describe("Resource Config Tests", func() {
 				}
 			}
 		})
+
+		It("counts the virtual servers referencing each custom profile", func() {
+			cps := NewCustomProfiles()
+			cps.Lock()
+			defer cps.Unlock()
+			cp := CustomProfile{
+				Name:      "secret",
+				Partition: "velcro",
+				Context:   customProfileClient,
+				Cert:      "cert",
+				Key:       "key",
+			}
+			key := profileKey{Partition: "velcro", Name: "secret"}
+			Expect(cps.Add("velcro/vs1", cp)).To(BeFalse())
+			Expect(cps.Add("velcro/vs2", cp)).To(BeFalse())
+			Expect(cps.RefCount(key)).To(Equal(2))
+			// Re-adding a reference does not count it twice
+			Expect(cps.Add("velcro/vs2", cp)).To(BeFalse())
+			Expect(cps.RefCount(key)).To(Equal(2))
+			cp.Cert = "new cert"
+			Expect(cps.Add("velcro/vs1", cp)).To(BeTrue())
+			prof, ok := cps.Get(key)
+			Expect(ok).To(BeTrue())
+			Expect(prof.Cert).To(Equal("new cert"))
+
+			// The profile is kept while any virtual server references it
+			Expect(cps.Release(func(owner string, _ CustomProfile) bool {
+				return owner == "velcro/vs2"
+			})).To(Equal(0))
+			Expect(cps.RefCount(key)).To(Equal(1))
+			_, ok = cps.Get(key)
+			Expect(ok).To(BeTrue())
+			Expect(cps.Release(func(string, CustomProfile) bool {
+				return false
+			})).To(Equal(1))
+			Expect(cps.RefCount(key)).To(Equal(0))
+			_, ok = cps.Get(key)
+			Expect(ok).To(BeFalse())
+		})
 	})
 })
@@ -0,0 +1,248 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// Name of the informer index from services, as "namespace/name", to the
+// ConfigMaps, Ingresses and Routes referencing them
+const serviceIndex = "services"
+
+// Kinds of the resources owning the virtual servers of a queue key
+const (
+	configMapKind = "ConfigMap"
+	ingressKind   = "Ingress"
+	routeKind     = "Route"
+)
+
+// Services of the definitions of a ConfigMap. Definitions whose data
+// cannot be parsed reference no service.
+func configMapServiceIndexFunc(obj interface{}) ([]string, error) {
+	cm, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		return nil, nil
+	}
+	keys := make(map[string]bool)
+	for _, cfgMap := range readConfigMapDefinitions(cm) {
+		if "" != cfgMap.VirtualServer.Backend.ServiceName {
+			keys[cm.ObjectMeta.Namespace+"/"+
+				cfgMap.VirtualServer.Backend.ServiceName] = true
+		}
+	}
+	var svcKeys []string
+	for key := range keys {
+		svcKeys = append(svcKeys, key)
+	}
+	return svcKeys, nil
+}
+
+// Services of the backends of an Ingress. Services of other namespaces are
+// indexed whether or not the reference is allowed, as extra keys only cost
+// a sync.
+func ingressServiceIndexFunc(obj interface{}) ([]string, error) {
+	ing, ok := obj.(*v1beta1.Ingress)
+	if !ok {
+		return nil, nil
+	}
+	refs, _ := parseServiceNamespaces(
+		ing.ObjectMeta.Annotations[serviceNamespacesAnnotation])
+	keys := make(map[string]bool)
+	addBackend := func(backend v1beta1.IngressBackend) {
+		ns := backendNamespace(refs, ing.ObjectMeta.Namespace,
+			backend.ServiceName)
+		keys[ns+"/"+backend.ServiceName] = true
+	}
+	if nil != ing.Spec.Backend {
+		addBackend(*ing.Spec.Backend)
+	}
+	for _, rule := range ing.Spec.Rules {
+		if nil == rule.IngressRuleValue.HTTP {
+			continue
+		}
+		for _, path := range rule.IngressRuleValue.HTTP.Paths {
+			addBackend(path.Backend)
+		}
+	}
+	var svcKeys []string
+	for key := range keys {
+		svcKeys = append(svcKeys, key)
+	}
+	return svcKeys, nil
+}
+
+// Service of a Route
+func routeServiceIndexFunc(obj interface{}) ([]string, error) {
+	route, ok := obj.(*routeapi.Route)
+	if !ok {
+		return nil, nil
+	}
+	return []string{route.ObjectMeta.Namespace + "/" + route.Spec.To.Name}, nil
+}
+
+// Whether a queue key syncs the resources of a kind. Keys without a kind
+// sync all the resources of their service.
+func (sKey serviceQueueKey) syncsKind(kind string) bool {
+	return "" == sKey.ResourceKind || kind == sKey.ResourceKind
+}
+
+// Whether a queue key syncs a resource, named "namespace/name"
+func (sKey serviceQueueKey) syncsResource(kind, name string) bool {
+	return sKey.syncsKind(kind) &&
+		("" == sKey.ResourceName || name == sKey.ResourceName)
+}
+
+// Whether a config in the resources belongs to the resources synced by a
+// queue key, from the owner recorded when the config was created
+func (sKey serviceQueueKey) owns(cfg *ResourceConfig) bool {
+	if "" == sKey.ResourceKind {
+		return true
+	}
+	switch sKey.ResourceKind {
+	case configMapKind:
+		return "configmap" == cfg.MetaData.ResourceType &&
+			("" == sKey.ResourceName ||
+				sKey.ResourceName == cfg.MetaData.ResourceName)
+	case ingressKind:
+		return "ingress" == cfg.MetaData.ResourceType &&
+			("" == sKey.ResourceName ||
+				sKey.ResourceName == cfg.MetaData.ResourceName)
+	case routeKind:
+		return "route" == cfg.MetaData.ResourceType
+	}
+	return false
+}
+
+// Queue keys of a ConfigMap, Ingress or Route event, scoped to the resource
+// when keying by resource. The server names of passthrough Ingresses are
+// rebuilt from all the Ingresses of a namespace, and Routes share their
+// virtual servers and data groups, so these are synced together.
+func (appMgr *Manager) scopeKeys(
+	keys []*serviceQueueKey,
+	kind string,
+	namespace, name string,
+	passthrough bool,
+) []*serviceQueueKey {
+	if !appMgr.queueByResource {
+		return keys
+	}
+	for _, key := range keys {
+		key.ResourceKind = kind
+		key.ResourceName = namespace + "/" + name
+		if routeKind == kind || (ingressKind == kind &&
+			(passthrough || appMgr.hasPassthroughHosts(key.Namespace))) {
+			key.ResourceName = ""
+		}
+	}
+	return keys
+}
+
+// Whether the Ingresses of a namespace have passthrough server names
+func (appMgr *Manager) hasPassthroughHosts(namespace string) bool {
+	return appMgr.hostDgs.hasNamespace(nameRef{
+		Name:      passthroughIngressHostsDgName,
+		Partition: DEFAULT_PARTITION,
+	}, namespace)
+}
+
+// Queue keys of a service or endpoints event. When keying by resource,
+// there is a key for each resource referencing the service, found with the
+// services index of the informers. A service referenced by no resource is
+// only synced to remove the configs left for it.
+func (appMgr *Manager) serviceKeys(
+	keys []*serviceQueueKey,
+) []*serviceQueueKey {
+	if !appMgr.queueByResource {
+		return keys
+	}
+	var scoped []*serviceQueueKey
+	for _, key := range keys {
+		svcKey := key.Namespace + "/" + key.ServiceName
+		var cfgMaps, ingresses []interface{}
+		var hasRoutes bool
+		appMgr.informersMutex.Lock()
+		for ns, appInf := range appMgr.appInformers {
+			objs, err := appInf.ingInformer.GetIndexer().ByIndex(
+				serviceIndex, svcKey)
+			if nil != err {
+				log.Warningf("Unable to find Ingresses using service '%v': %v",
+					svcKey, err)
+			}
+			ingresses = append(ingresses, objs...)
+			if ns != key.Namespace {
+				continue
+			}
+			cfgMaps, err = appInf.cfgMapInformer.GetIndexer().ByIndex(
+				serviceIndex, svcKey)
+			if nil != err {
+				log.Warningf("Unable to find ConfigMaps using service '%v': %v",
+					svcKey, err)
+			}
+			if nil != appInf.routeInformer {
+				objs, err = appInf.routeInformer.GetIndexer().ByIndex(
+					serviceIndex, svcKey)
+				if nil != err {
+					log.Warningf("Unable to find Routes using service '%v': %v",
+						svcKey, err)
+				}
+				hasRoutes = 0 != len(objs)
+			}
+		}
+		appMgr.informersMutex.Unlock()
+
+		resourceKey := func(kind, name string) *serviceQueueKey {
+			return &serviceQueueKey{
+				Namespace:    key.Namespace,
+				ServiceName:  key.ServiceName,
+				ResourceKind: kind,
+				ResourceName: name,
+			}
+		}
+		var owned []*serviceQueueKey
+		for _, obj := range cfgMaps {
+			cm := obj.(*v1.ConfigMap)
+			owned = append(owned, resourceKey(configMapKind,
+				cm.ObjectMeta.Namespace+"/"+cm.ObjectMeta.Name))
+		}
+		var ingKeys []*serviceQueueKey
+		nsPassthrough := appMgr.hasPassthroughHosts(key.Namespace)
+		for _, obj := range ingresses {
+			ing := obj.(*v1beta1.Ingress)
+			if nsPassthrough ||
+				isPassthroughIngress(appMgr.ingressWithDefaults(ing)) {
+				ingKeys = []*serviceQueueKey{resourceKey(ingressKind, "")}
+				break
+			}
+			ingKeys = append(ingKeys, resourceKey(ingressKind,
+				ing.ObjectMeta.Namespace+"/"+ing.ObjectMeta.Name))
+		}
+		owned = append(owned, ingKeys...)
+		if hasRoutes {
+			owned = append(owned, resourceKey(routeKind, ""))
+		}
+		if 0 == len(owned) && 0 != len(appMgr.getResourcesForKey(*key)) {
+			owned = append(owned, key)
+		}
+		scoped = append(scoped, owned...)
+	}
+	return scoped
+}
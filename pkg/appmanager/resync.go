@@ -0,0 +1,167 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// A full resync re-enqueues all the watched resources. The config is
+// written once they are synced again, along with a new generation in the
+// resync section: the driver only applies a config file that changed, and
+// the resources may not have.
+type resyncState struct {
+	sync.Mutex
+	generation int
+	pending    bool
+}
+
+// Section of the config file written by a resync
+type resyncSection struct {
+	Generation int       `json:"generation"`
+	Requested  time.Time `json:"requested"`
+}
+
+// State of the resyncs, as returned by the resync endpoint
+type resyncStatus struct {
+	Generation int  `json:"generation"`
+	Pending    bool `json:"pending"`
+	Enqueued   int  `json:"enqueued,omitempty"`
+}
+
+// Re-enqueue all the watched resources and apply the full config to the
+// BIG-IP once they are synced, as after a restart of the controller. Use
+// after manual changes to the BIG-IP, such as during maintenance. Returns
+// the number of resources enqueued.
+func (appMgr *Manager) Resync() int {
+	appMgr.resync.Lock()
+	appMgr.resync.generation++
+	appMgr.resync.pending = true
+	generation := appMgr.resync.generation
+	appMgr.resync.Unlock()
+
+	appMgr.informersMutex.Lock()
+	var informers []*appInformer
+	for _, appInf := range appMgr.appInformers {
+		informers = append(informers, appInf)
+	}
+	appMgr.informersMutex.Unlock()
+
+	count := 0
+	for _, appInf := range informers {
+		for _, obj := range appInf.svcInformer.GetStore().List() {
+			appMgr.enqueueService(obj)
+			count++
+		}
+		for _, obj := range appInf.cfgMapInformer.GetStore().List() {
+			appMgr.enqueueConfigMap(obj)
+			count++
+		}
+		if nil != appInf.ingInformer {
+			for _, obj := range appInf.ingInformer.GetStore().List() {
+				appMgr.enqueueIngress(obj)
+				count++
+			}
+		}
+		if nil != appInf.routeInformer {
+			for _, obj := range appInf.routeInformer.GetStore().List() {
+				appMgr.enqueueRoute(obj)
+				count++
+			}
+		}
+	}
+	log.Infof("Full resync %v requested, enqueued %v resources.",
+		generation, count)
+	if 0 == appMgr.vsQueue.Len() {
+		// Nothing to sync, write the config right away
+		appMgr.outputConfig()
+	}
+	return count
+}
+
+// Whether a resync is waiting for the config to be written
+func (appMgr *Manager) resyncPending() bool {
+	appMgr.resync.Lock()
+	defer appMgr.resync.Unlock()
+	return appMgr.resync.pending
+}
+
+// Write the resync section after the resources of a pending resync, so the
+// driver applies the config even if the resources did not change
+func (appMgr *Manager) writeResyncSection() {
+	appMgr.resync.Lock()
+	defer appMgr.resync.Unlock()
+	if !appMgr.resync.pending {
+		return
+	}
+	section := resyncSection{
+		Generation: appMgr.resync.generation,
+		Requested:  time.Now(),
+	}
+	doneCh, errCh, err := appMgr.ConfigWriter().SendSection("resync", section)
+	if nil == err {
+		select {
+		case <-doneCh:
+		case err = <-errCh:
+		case <-time.After(time.Second):
+			err = fmt.Errorf("no config write response in 1s")
+		}
+	}
+	if nil != err {
+		log.Warningf("Failed to write resync %v: %v", section.Generation, err)
+		return
+	}
+	appMgr.resync.pending = false
+	log.Infof("Full resync %v written.", section.Generation)
+}
+
+func (appMgr *Manager) resyncStatus() resyncStatus {
+	appMgr.resync.Lock()
+	defer appMgr.resync.Unlock()
+	return resyncStatus{
+		Generation: appMgr.resync.generation,
+		Pending:    appMgr.resync.pending,
+	}
+}
+
+// Handler to request full resyncs: PUT or POST starts a resync, returning
+// the number of resources enqueued. All methods return the state of the
+// resyncs as JSON.
+func (appMgr *Manager) ResyncHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var enqueued int
+		switch r.Method {
+		case "GET":
+		case "PUT", "POST":
+			enqueued = appMgr.Resync()
+		default:
+			http.Error(w, fmt.Sprintf("Method %v not allowed", r.Method),
+				http.StatusMethodNotAllowed)
+			return
+		}
+		status := appMgr.resyncStatus()
+		status.Enqueued = enqueued
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	})
+}
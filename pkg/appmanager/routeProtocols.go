@@ -0,0 +1,97 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+)
+
+// Parse the protocols annotation of a Route: a comma separated list of the
+// protocols of the shared virtual servers serving it, http and https
+func parseRouteProtocols(val string) (map[string]bool, error) {
+	protocols := make(map[string]bool)
+	for _, p := range strings.Split(val, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if "http" != p && "https" != p {
+			return nil, fmt.Errorf("'%v' is not http or https", p)
+		}
+		protocols[p] = true
+	}
+	return protocols, nil
+}
+
+// Listeners of the shared virtual servers of a Route, default and extra
+// ports. The listeners of a protocol are left out when it is disabled for
+// all the Routes, or by the annotation of the Route or of its namespace, so
+// https-only or plaintext-only clusters have no unused virtual servers.
+// Returns the listeners left out too.
+func (appMgr *Manager) routePorts(
+	route *routeapi.Route,
+) ([]portStruct, []portStruct) {
+	protocols := map[string]bool{
+		"http":  !appMgr.routeConfig.DisableHttp,
+		"https": !appMgr.routeConfig.DisableHttps,
+	}
+	if val, ok := route.ObjectMeta.Annotations[routeProtocolsAnnotation]; ok {
+		allowed, err := parseRouteProtocols(val)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+				val, routeProtocolsAnnotation, route.ObjectMeta.Name, err)
+		} else {
+			for protocol := range protocols {
+				protocols[protocol] = protocols[protocol] && allowed[protocol]
+			}
+		}
+	}
+	pStructs := []portStruct{{protocol: "http", port: DEFAULT_HTTP_PORT},
+		{protocol: "https", port: DEFAULT_HTTPS_PORT}}
+	pStructs = append(pStructs, routeExtraPorts(route)...)
+	var enabled, disabled []portStruct
+	for _, ps := range pStructs {
+		if protocols[ps.protocol] {
+			enabled = append(enabled, ps)
+		} else {
+			disabled = append(disabled, ps)
+		}
+	}
+	return enabled, disabled
+}
+
+// Remove the rule of a Route from the shared virtual servers of the
+// listeners left out for it, which other Routes may still use
+func (appMgr *Manager) removeDisabledRouteRules(
+	route *routeapi.Route,
+	disabled []portStruct,
+) {
+	appMgr.resources.Lock()
+	defer appMgr.resources.Unlock()
+	for _, ps := range disabled {
+		cfgs, keys := appMgr.resources.GetAllWithName(
+			formatRoutePortVSName(route, ps))
+		for i, cfg := range cfgs {
+			if cfg.MetaData.ResourceType == "route" &&
+				keys[i].Namespace == route.ObjectMeta.Namespace {
+				appMgr.removeRouteRuleLocked(route, keys[i], cfg)
+			}
+		}
+	}
+}
@@ -0,0 +1,261 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"github.com/prometheus/client_golang/prometheus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Interval at which the route report is rebuilt
+const routeReportInterval = 30 * time.Second
+
+// Key of the route report in the route status ConfigMap
+const routeReportKey = "routes.json"
+
+var (
+	routesAdmitted = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "routes",
+		Name:      "admitted",
+		Help:      "Number of Routes configured on each shared virtual server.",
+	}, []string{"virtual_server"})
+	routesRejected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "routes",
+		Name:      "rejected",
+		Help:      "Number of Routes not configured, by reason.",
+	}, []string{"reason"})
+)
+
+// Whether a Route is configured, as found by its last sync
+type routeAdmission struct {
+	// Shared virtual servers serving the Route
+	Virtuals []string
+	// Why the Route is not configured, empty if it is
+	Reason  string
+	Message string
+}
+
+// Admission of the Routes by "namespace/name", and the last report written
+// to the route status ConfigMap
+type routeAdmissions struct {
+	sync.Mutex
+	routes  map[string]routeAdmission
+	written string
+}
+
+func newRouteAdmissions() *routeAdmissions {
+	return &routeAdmissions{routes: make(map[string]routeAdmission)}
+}
+
+func (ra *routeAdmissions) set(route *routeapi.Route, adm routeAdmission) {
+	ra.Lock()
+	defer ra.Unlock()
+	ra.routes[route.ObjectMeta.Namespace+"/"+route.ObjectMeta.Name] = adm
+}
+
+// Set the admission of a Route, returns whether it changed
+func (ra *routeAdmissions) replace(
+	route *routeapi.Route,
+	adm routeAdmission,
+) bool {
+	ra.Lock()
+	defer ra.Unlock()
+	key := route.ObjectMeta.Namespace + "/" + route.ObjectMeta.Name
+	prev, found := ra.routes[key]
+	ra.routes[key] = adm
+	return !found || !reflect.DeepEqual(prev, adm)
+}
+
+// Whether a Route is served by the shared virtual servers of a protocol. An
+// insecure request to an edge Route is only served if it is allowed or
+// redirected, and TLS Routes are only served over https.
+func routeServedBy(route *routeapi.Route, protocol string) bool {
+	tls := route.Spec.TLS
+	if "https" == protocol {
+		return nil != tls
+	}
+	if nil == tls || 0 == len(tls.Termination) {
+		return true
+	}
+	return routeapi.TLSTerminationEdge == tls.Termination &&
+		(routeapi.InsecureEdgeTerminationPolicyAllow ==
+			tls.InsecureEdgeTerminationPolicy ||
+			routeapi.InsecureEdgeTerminationPolicyRedirect ==
+				tls.InsecureEdgeTerminationPolicy)
+}
+
+// A Route that is not configured on the BIG-IP
+type rejectedRoute struct {
+	Route   string `json:"route"`
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// Consolidated state of the Routes, like the route status of the OpenShift
+// router: how many Routes share each virtual server and which Routes are
+// not configured and why
+type routeReport struct {
+	Routes         int             `json:"routes"`
+	Admitted       int             `json:"admitted"`
+	VirtualServers map[string]int  `json:"virtualServers"`
+	Rejected       []rejectedRoute `json:"rejected"`
+}
+
+// Build the route report from the Routes in the informers. Routes not synced
+// yet are left out, as are the admissions of deleted Routes, which are
+// dropped.
+func (appMgr *Manager) buildRouteReport() routeReport {
+	report := routeReport{
+		VirtualServers: make(map[string]int),
+		Rejected:       []rejectedRoute{},
+	}
+	current := make(map[string]bool)
+	appMgr.informersMutex.Lock()
+	for _, appInf := range appMgr.appInformers {
+		if nil == appInf.routeInformer {
+			continue
+		}
+		for _, obj := range appInf.routeInformer.GetStore().List() {
+			route := obj.(*routeapi.Route)
+			current[route.ObjectMeta.Namespace+"/"+route.ObjectMeta.Name] = true
+		}
+	}
+	appMgr.informersMutex.Unlock()
+
+	admissions := appMgr.routeAdmissions
+	admissions.Lock()
+	defer admissions.Unlock()
+	for key, adm := range admissions.routes {
+		if !current[key] {
+			delete(admissions.routes, key)
+			continue
+		}
+		report.Routes++
+		if "" != adm.Reason {
+			report.Rejected = append(report.Rejected, rejectedRoute{
+				Route:   key,
+				Reason:  adm.Reason,
+				Message: adm.Message,
+			})
+			continue
+		}
+		report.Admitted++
+		for _, vs := range adm.Virtuals {
+			report.VirtualServers[vs]++
+		}
+	}
+	sort.Sort(rejectedRoutes(report.Rejected))
+	return report
+}
+
+// Update the route metrics from the route report, and queue the update of
+// the route status ConfigMap if the report changed
+func (appMgr *Manager) publishRouteReport() {
+	report := appMgr.buildRouteReport()
+	routesAdmitted.Reset()
+	for vs, count := range report.VirtualServers {
+		routesAdmitted.WithLabelValues(vs).Set(float64(count))
+	}
+	routesRejected.Reset()
+	for _, rejected := range report.Rejected {
+		routesRejected.WithLabelValues(rejected.Reason).Inc()
+	}
+
+	if "" == appMgr.routeConfig.StatusConfigMap {
+		return
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if nil != err {
+		log.Warningf("Unable to encode the route report: %v", err)
+		return
+	}
+	appMgr.routeAdmissions.Lock()
+	written := appMgr.routeAdmissions.written
+	appMgr.routeAdmissions.Unlock()
+	if string(data) != written {
+		appMgr.statusQueue.Add(routeStatusUpdate{Report: string(data)})
+	}
+}
+
+// Write the route report to the route status ConfigMap
+func (appMgr *Manager) writeRouteStatusNow(update routeStatusUpdate) error {
+	err := appMgr.writeConfigMapData(appMgr.routeConfig.StatusConfigMap,
+		routeReportKey, update.Report)
+	if nil != err {
+		return err
+	}
+	appMgr.routeAdmissions.Lock()
+	appMgr.routeAdmissions.written = update.Report
+	appMgr.routeAdmissions.Unlock()
+	return nil
+}
+
+// Set a data key of a ConfigMap, as "namespace/name", creating it if needed
+func (appMgr *Manager) writeConfigMapData(ref, key, value string) error {
+	parts := strings.SplitN(ref, "/", 2)
+	if 2 != len(parts) {
+		return fmt.Errorf("Invalid ConfigMap '%v'", ref)
+	}
+	cmClient := appMgr.kubeClient.Core().ConfigMaps(parts[0])
+	cm, err := cmClient.Get(parts[1], metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = cmClient.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      parts[1],
+				Namespace: parts[0],
+			},
+			Data: map[string]string{key: value},
+		})
+	} else if nil == err && cm.Data[key] != value {
+		if nil == cm.Data {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[key] = value
+		_, err = cmClient.Update(cm)
+	}
+	return err
+}
+
+// Rejected Routes in order of name
+type rejectedRoutes []rejectedRoute
+
+func (slice rejectedRoutes) Len() int {
+	return len(slice)
+}
+
+func (slice rejectedRoutes) Less(i, j int) bool {
+	return slice[i].Route < slice[j].Route
+}
+
+func (slice rejectedRoutes) Swap(i, j int) {
+	slice[i], slice[j] = slice[j], slice[i]
+}
@@ -0,0 +1,163 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// Reason of the admission of a Route failing the extended validation, as
+// reported by the OpenShift router
+const routeValidationFailed = "ExtendedValidationFailed"
+
+// Parse the PEM certificates of a bundle, in order
+func parseCertificates(data string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(data)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if nil == block {
+			break
+		}
+		if "CERTIFICATE" != block.Type {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if nil != err {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if 0 == len(certs) {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return certs, nil
+}
+
+// Host names must be DNS subdomains whose labels fit in 63 characters
+func validateRouteHost(host string) error {
+	if "" == host {
+		return nil
+	}
+	errs := validation.IsDNS1123Subdomain(host)
+	for _, label := range strings.Split(host, ".") {
+		errs = append(errs, validation.IsDNS1123Label(label)...)
+	}
+	if 0 != len(errs) {
+		return fmt.Errorf("host '%v' is invalid: %v", host, errs[0])
+	}
+	return nil
+}
+
+// The certificate and key must be a pair, and the certificate must chain to
+// the CA certificate when one is set. Expiry is not checked, an expired
+// certificate is still served by the BIG-IP.
+func validateRouteCertificate(routeTLS *routeapi.TLSConfig) error {
+	if "" == routeTLS.Certificate && "" == routeTLS.Key {
+		// The default client SSL profile is used
+		return nil
+	}
+	if "" == routeTLS.Certificate || "" == routeTLS.Key {
+		return fmt.Errorf("certificate and key must be set together")
+	}
+	if _, err := tls.X509KeyPair([]byte(routeTLS.Certificate),
+		[]byte(routeTLS.Key)); nil != err {
+		return fmt.Errorf("certificate and key do not match: %v", err)
+	}
+	certs, err := parseCertificates(routeTLS.Certificate)
+	if nil != err {
+		return fmt.Errorf("invalid certificate: %v", err)
+	}
+	if "" == routeTLS.CACertificate {
+		return nil
+	}
+	cas, err := parseCertificates(routeTLS.CACertificate)
+	if nil != err {
+		return fmt.Errorf("invalid caCertificate: %v", err)
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		roots.AddCert(ca)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   certs[0].NotBefore,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if nil != err {
+		return fmt.Errorf("certificate does not chain to caCertificate: %v",
+			err)
+	}
+	return nil
+}
+
+// Check a Route like the extended validation of the OpenShift router, so an
+// invalid Route is rejected instead of breaking the SSL profiles of the
+// virtual servers it shares with the other Routes
+func validateRoute(route *routeapi.Route) error {
+	if err := validateRouteHost(route.Spec.Host); nil != err {
+		return err
+	}
+	routeTLS := route.Spec.TLS
+	if nil == routeTLS {
+		return nil
+	}
+	switch routeTLS.Termination {
+	case routeapi.TLSTerminationEdge:
+		return validateRouteCertificate(routeTLS)
+	case routeapi.TLSTerminationReencrypt:
+		if err := validateRouteCertificate(routeTLS); nil != err {
+			return err
+		}
+		if "" != routeTLS.DestinationCACertificate {
+			if _, err := parseCertificates(
+				routeTLS.DestinationCACertificate); nil != err {
+				return fmt.Errorf("invalid destinationCACertificate: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Reject a Route failing the extended validation. The Event is recorded
+// when the reason the Route is rejected changes.
+func (appMgr *Manager) rejectInvalidRoute(route *routeapi.Route, err error) {
+	adm := routeAdmission{Reason: routeValidationFailed, Message: err.Error()}
+	if !appMgr.routeAdmissions.replace(route, adm) {
+		return
+	}
+	log.Warningf("Route '%v/%v' failed validation: %v",
+		route.ObjectMeta.Namespace, route.ObjectMeta.Name, err)
+	appMgr.recordRouteEvent(route, v1.EventTypeWarning, routeValidationFailed,
+		err.Error())
+}
@@ -20,7 +20,6 @@ import (
 	"bytes"
 	"fmt"
 	"net/url"
-	"reflect"
 	"sort"
 	"strconv"
 	"strings"
@@ -34,10 +33,46 @@ import (
 
 const httpRedirectIRuleName = "http_redirect_irule"
 const sslPassthroughIRuleName = "openshift_passthrough_irule"
+const proxyProtocolV1IRuleName = "proxy_protocol_v1_irule"
+const proxyProtocolV2IRuleName = "proxy_protocol_v2_irule"
+const sorryServerIRuleName = "sorry_server_irule"
+
+// Internal data groups of the sorry server iRule, mapping the full path of
+// virtual servers to their fallback pool, to their maintenance page and to
+// the status code of the page.
+const sorryServerPoolsDgName = "sorry_server_pools_dg"
+const sorryServerPagesDgName = "sorry_server_pages_dg"
+const sorryServerCodesDgName = "sorry_server_codes_dg"
+
+// Internal data group of the host redirect iRule, mapping the full path of
+// virtual servers and an alternate host to a status code and canonical host.
+const hostRedirectIRuleName = "host_redirect_irule"
+const hostRedirectsDgName = "host_redirects_dg"
+
+// Internal data group of the universal persistence iRule, mapping the full
+// path of virtual servers to the type, name and timeout of their session
+// identifier.
+const universalPersistenceIRuleName = "universal_persistence_irule"
+const universalPersistenceDgName = "universal_persistence_dg"
+
+// iRules written only while a virtual server uses them, with the internal
+// data groups they read, so controllers not using the annotations add
+// nothing to the default partition
+var onDemandIRules = map[string][]string{
+	proxyProtocolV1IRuleName: nil,
+	proxyProtocolV2IRuleName: nil,
+	sorryServerIRuleName: {sorryServerPoolsDgName, sorryServerPagesDgName,
+		sorryServerCodesDgName},
+	hostRedirectIRuleName:         {hostRedirectsDgName},
+	universalPersistenceIRuleName: {universalPersistenceDgName},
+}
 
 // Internal data group for passthrough routes to map server names to pools.
 const passthroughHostsDgName = "ssl_passthrough_servername_dg"
 
+// Internal data group for passthrough Ingresses to map server names to pools.
+const passthroughIngressHostsDgName = "ssl_passthrough_ingress_servername_dg"
+
 // Internal data group for reencrypt routes.
 // FIXME: Only used by the iRule below until reencrypt is supported.
 const reencryptHostsDgName = "ssl_reencrypt_servername_dg"
@@ -138,6 +173,7 @@ func processIngressRules(
 	ing *v1beta1.IngressSpec,
 	pools []Pool,
 	partition string,
+	backendPort func(v1beta1.IngressBackend) int32,
 ) *Rules {
 	var err error
 	var uri, poolName string
@@ -148,8 +184,10 @@ func processIngressRules(
 		if nil != rule.IngressRuleValue.HTTP {
 			for _, path := range rule.IngressRuleValue.HTTP.Paths {
 				uri = rule.Host + path.Path
+				svcPort := backendPort(path.Backend)
 				for _, pool := range pools {
-					if path.Backend.ServiceName == pool.ServiceName {
+					if path.Backend.ServiceName == pool.ServiceName &&
+						svcPort == pool.ServicePort {
 						poolName = pool.Name
 					}
 				}
@@ -197,146 +235,174 @@ func processIngressRules(
 	return &rls
 }
 
-func httpRedirectIRule(port int32) string {
+func sorryServerIRule() string {
 	iRuleCode := fmt.Sprintf(`
-	when HTTP_REQUEST {
-       HTTP::redirect https://[getfield [HTTP::host] ":" 1]:%d[HTTP::uri]
-    }`, port)
+when HTTP_REQUEST {
+	set default_pool [LB::server pool]
+	if { $default_pool ne "" && [active_members $default_pool] > 0 } {
+		return
+	}
+	set fallback_pool [class match -value [virtual name] equals /%[1]s/%[2]s]
+	if { $fallback_pool ne "" && [active_members $fallback_pool] > 0 } {
+		pool $fallback_pool
+		return
+	}
+	set page [class match -value [virtual name] equals /%[1]s/%[3]s]
+	if { $page ne "" } {
+		set code [class match -value [virtual name] equals /%[1]s/%[4]s]
+		if { $code eq "" } {
+			set code 503
+		}
+		HTTP::respond $code content $page "Content-Type" "text/html; charset=utf-8" "Connection" "close"
+	}
+}`, DEFAULT_PARTITION, sorryServerPoolsDgName, sorryServerPagesDgName,
+		sorryServerCodesDgName)
 
 	return iRuleCode
 }
 
-func sslPassthroughIRule() string {
-	iRuleCode := `
-when CLIENT_ACCEPTED {
-	TCP::collect
+func hostRedirectIRule() string {
+	iRuleCode := fmt.Sprintf(`
+when HTTP_REQUEST {
+	set host [string tolower [getfield [HTTP::host] ":" 1]]
+	set redirect [class match -value "[virtual name]/$host" equals /%[1]s/%[2]s]
+	if { $redirect eq "" } {
+		return
+	}
+	set scheme "http"
+	if { [PROFILE::exists clientssl] } {
+		set scheme "https"
+	}
+	HTTP::respond [lindex $redirect 0] Location "$scheme://[lindex $redirect 1][HTTP::uri]" "Connection" "close"
+	event disable all
+}`, DEFAULT_PARTITION, hostRedirectsDgName)
+
+	return iRuleCode
 }
 
-when CLIENT_DATA {
-	# Byte 0 is the content type.
-	# Bytes 1-2 are the TLS version.
-	# Bytes 3-4 are the TLS payload length.
-	# Bytes 5-$tls_payload_len are the TLS payload.
-	binary scan [TCP::payload] cSS tls_content_type tls_version tls_payload_len
-
-	switch $tls_version {
-		"769" -
-		"770" -
-		"771" {
-			# Content type of 22 indicates the TLS payload contains a handshake.
-			if { $tls_content_type == 22 } {
-				# Byte 5 (the first byte of the handshake) indicates the handshake
-				# record type, and a value of 1 signifies that the handshake record is
-				# a ClientHello.
-				binary scan [TCP::payload] @5c tls_handshake_record_type
-				if { $tls_handshake_record_type == 1 } {
-					# Bytes 6-8 are the handshake length (which we ignore).
-					# Bytes 9-10 are the TLS version (which we ignore).
-					# Bytes 11-42 are random data (which we ignore).
-
-					# Byte 43 is the session ID length.  Following this are three
-					# variable-length fields which we shall skip over.
-					set record_offset 43
-
-					# Skip the session ID.
-					binary scan [TCP::payload] @${record_offset}c tls_session_id_len
-					incr record_offset [expr {1 + $tls_session_id_len}]
-
-					# Skip the cipher_suites field.
-					binary scan [TCP::payload] @${record_offset}S tls_cipher_suites_len
-					incr record_offset [expr {2 + $tls_cipher_suites_len}]
-
-					# Skip the compression_methods field.
-					binary scan [TCP::payload] @${record_offset}c tls_compression_methods_len
-					incr record_offset [expr {1 + $tls_compression_methods_len}]
-
-					# Get the number of extensions, and store the extensions.
-					binary scan [TCP::payload] @${record_offset}S tls_extensions_len
-					incr record_offset 2
-					binary scan [TCP::payload] @${record_offset}a* tls_extensions
-
-					for { set extension_start 0 }
-							{ $tls_extensions_len - $extension_start == abs($tls_extensions_len - $extension_start) }
-							{ incr extension_start 4 } {
-						# Bytes 0-1 of the extension are the extension type.
-						# Bytes 2-3 of the extension are the extension length.
-						binary scan $tls_extensions @${extension_start}SS extension_type extension_len
-
-						# Extension type 00 is the ServerName extension.
-						if { $extension_type == "00" } {
-							# Bytes 4-5 of the extension are the SNI length (we ignore this).
-
-							# Byte 6 of the extension is the SNI type.
-							set sni_type_offset [expr {$extension_start + 6}]
-							binary scan $tls_extensions @${sni_type_offset}S sni_type
-
-							# Type 0 is host_name.
-							if { $sni_type == "0" } {
-								# Bytes 7-8 of the extension are the SNI data (host_name)
-								# length.
-								set sni_len_offset [expr {$extension_start + 7}]
-								binary scan $tls_extensions @${sni_len_offset}S sni_len
-
-								# Bytes 9-$sni_len are the SNI data (host_name).
-								set sni_start [expr {$extension_start + 9}]
-								binary scan $tls_extensions @${sni_start}A${sni_len} tls_servername
-							}
-						}
-
-						incr extension_start $extension_len
-					}
+func universalPersistenceIRule() string {
+	iRuleCode := fmt.Sprintf(`
+when HTTP_REQUEST {
+	set persist_params [class match -value [virtual name] equals /%[1]s/%[2]s]
+	if { $persist_params eq "" } {
+		return
+	}
+	if { [lindex $persist_params 0] eq "cookie" } {
+		set session [HTTP::cookie value [lindex $persist_params 1]]
+	} else {
+		set session [HTTP::header value [lindex $persist_params 1]]
+	}
+	if { $session ne "" } {
+		persist uie $session [lindex $persist_params 2]
+	}
+}
 
-					if { [info exists tls_servername] } {
-						set servername_lower [string tolower $tls_servername]
-						SSL::disable serverside
-						if { [class match $servername_lower equals ssl_passthrough_servername_dg] } {
-							pool [class match -value $servername_lower equals ssl_passthrough_servername_dg]
-							SSL::disable
-							HTTP::disable
-						}
-						elseif { [class match $servername_lower equals ssl_reencrypt_servername_dg] } {
-							pool [class match -value $servername_lower equals ssl_reencrypt_servername_dg]
-							SSL::enable serverside
-						}
-					}
-				}
-			}
-		}
+when HTTP_RESPONSE {
+	if { $persist_params eq "" } {
+		return
+	}
+	if { [lindex $persist_params 0] eq "cookie" } {
+		set session [HTTP::cookie value [lindex $persist_params 1]]
+	} else {
+		set session [HTTP::header value [lindex $persist_params 1]]
 	}
+	if { $session ne "" } {
+		persist add uie $session [lindex $persist_params 2]
+	}
+}`, DEFAULT_PARTITION, universalPersistenceDgName)
 
-	TCP::release
-}
-`
 	return iRuleCode
 }
 
-// Update a specific datagroup for passthrough routes, indicating if
-// something had changed.
-func (appMgr *Manager) updatePassthroughRouteDataGroups(
-	partition string,
-	poolName string,
-	hostName string,
-) (bool, error) {
+func sslPassthroughIRule() string {
+	return defaultIRule(sslPassthroughIRuleName, passthroughIRuleParams(false))
+}
 
-	changed := false
-	key := nameRef{
-		Name:      passthroughHostsDgName,
-		Partition: partition,
-	}
+// Passthrough iRule looking up the server names in the data groups sharded
+// by their first character
+func shardedSslPassthroughIRule() string {
+	return defaultIRule(sslPassthroughIRuleName, passthroughIRuleParams(true))
+}
 
-	appMgr.intDgMutex.Lock()
-	defer appMgr.intDgMutex.Unlock()
-	hostDg, found := appMgr.intDgMap[key]
-	if false == found {
-		return false, fmt.Errorf("Internal Data-group /%s/%s does not exist.",
-			partition, passthroughHostsDgName)
+func passthroughIRuleParams(sharded bool) passthroughIRuleData {
+	data := passthroughIRuleData{
+		Sharded:           sharded,
+		OtherShard:        otherHostsShard,
+		PassthroughDg:     passthroughHostsDgName,
+		IngressDg:         passthroughIngressHostsDgName,
+		ReencryptDg:       reencryptHostsDgName,
+		PassthroughShards: passthroughHostsDgName,
+		IngressShards:     passthroughIngressHostsDgName,
+		ReencryptShards:   reencryptHostsDgName,
+	}
+	if sharded {
+		data.PassthroughDg = "$passthrough_dg"
+		data.IngressDg = "$ingress_dg"
+		data.ReencryptDg = "$reencrypt_dg"
 	}
+	return data
+}
+
+// Sends a PROXY protocol v1 (text) header to the pool member when the
+// server side connection is established.
+func proxyProtocolV1IRule() string {
+	iRuleCode := `
+when CLIENT_ACCEPTED {
+	set proxy_header "PROXY TCP[IP::version] [getfield [IP::client_addr] "%" 1] [getfield [IP::local_addr] "%" 1] [TCP::client_port] [TCP::local_port]\r\n"
+}
+
+when SERVER_CONNECTED {
+	TCP::respond $proxy_header
+}`
+
+	return iRuleCode
+}
 
-	if hostDg.AddOrUpdateRecord(hostName, poolName) {
-		changed = true
+// Sends a PROXY protocol v2 (binary) header to the pool member when the
+// server side connection is established.
+func proxyProtocolV2IRule() string {
+	iRuleCode := `
+when CLIENT_ACCEPTED {
+	set src [getfield [IP::client_addr] "%" 1]
+	set dst [getfield [IP::local_addr] "%" 1]
+	set addrs ""
+	if { [IP::version] == 4 } {
+		# AF_INET over STREAM
+		set family 17
+		append addrs [binary format c4c4 [split $src "."] [split $dst "."]]
+	} else {
+		# AF_INET6 over STREAM
+		set family 33
+		foreach addr [list $src $dst] {
+			# Expand the "::" of the address to get all eight groups
+			set parts [split [string map {"::" "|"} $addr] "|"]
+			set head [split [lindex $parts 0] ":"]
+			set tail [split [lindex $parts 1] ":"]
+			set groups $head
+			for {set i [expr {[llength $head] + [llength $tail]}]} {$i < 8} {incr i} {
+				lappend groups 0
+			}
+			foreach group $tail {
+				lappend groups $group
+			}
+			foreach group $groups {
+				append addrs [binary format S [expr 0x$group]]
+			}
+		}
 	}
+	append addrs [binary format SS [TCP::client_port] [TCP::local_port]]
 
-	return changed, nil
+	# Signature, then version 2 with the PROXY command
+	set proxy_header "\x0D\x0A\x0D\x0A\x00\x0D\x0A\x51\x55\x49\x54\x0A"
+	append proxy_header [binary format ccS 33 $family [string length $addrs]]
+	append proxy_header $addrs
+}
+
+when SERVER_CONNECTED {
+	TCP::respond $proxy_header
+}`
+
+	return iRuleCode
 }
 
 // Update a data group map based on a passthrough route object.
@@ -390,28 +456,27 @@ func updateDataGroup(
 
 // Update the appMgr datagroup cache for passthrough routes, indicating if
 // something had changed by updating 'stats', which should rewrite the config.
+// A sync only sees the Routes of its namespace, so the records are kept by
+// namespace and the data groups are merged from those of all namespaces.
 func (appMgr *Manager) updateRouteDataGroups(
 	stats *vsSyncStats,
+	namespace string,
 	dgMap InternalDataGroupMap,
 ) {
-	appMgr.intDgMutex.Lock()
-	defer appMgr.intDgMutex.Unlock()
-
-	for _, grp := range dgMap {
-		mapKey := nameRef{
-			Name:      grp.Name,
-			Partition: grp.Partition,
-		}
-		dg, found := appMgr.intDgMap[mapKey]
-		if found {
-			if !reflect.DeepEqual(dg.Records, grp.Records) {
-				dg.Records = grp.Records
-				stats.dgUpdated += 1
-			}
-		} else {
-			appMgr.intDgMap[mapKey] = grp
+	// The data groups of all Routes are replaced, so the removed Routes of
+	// the namespace are removed from them
+	hosts := make(map[nameRef]map[string]string)
+	for _, name := range []string{passthroughHostsDgName, reencryptHostsDgName} {
+		hosts[nameRef{Name: name, Partition: DEFAULT_PARTITION}] = nil
+	}
+	for mapKey, grp := range dgMap {
+		records := make(map[string]string)
+		for _, rec := range grp.Records {
+			records[rec.Name] = rec.Data
 		}
+		hosts[mapKey] = records
 	}
+	stats.dgUpdated += len(appMgr.hostDgs.setNamespace(namespace, hosts))
 }
 
 func (slice Routes) Len() int {
@@ -0,0 +1,217 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Interval at which the schedules of the virtual servers are checked
+const scheduleCheckInterval = 15 * time.Second
+
+var scheduleDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Window in which a virtual server is enabled: from start to end, in
+// minutes since midnight UTC, on some days of the week. A window ending
+// before its start ends on the next day.
+type scheduleWindow struct {
+	Days  [7]bool
+	Start int
+	End   int
+}
+
+type activeSchedule []scheduleWindow
+
+// Parse the days of a window: "*", or comma-separated days and ranges of
+// days like "Mon-Fri,Sun"
+func parseScheduleDays(val string) ([7]bool, error) {
+	var days [7]bool
+	if "*" == val {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, item := range strings.Split(val, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+		first, ok := scheduleDays[strings.ToLower(bounds[0])]
+		if !ok {
+			return days, fmt.Errorf("'%v' is not a day like Mon", bounds[0])
+		}
+		last := first
+		if 2 == len(bounds) {
+			last, ok = scheduleDays[strings.ToLower(bounds[1])]
+			if !ok {
+				return days, fmt.Errorf("'%v' is not a day like Fri", bounds[1])
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// Parse a time of day like 09:30 into minutes since midnight; 24:00 ends a
+// window at midnight
+func parseScheduleTime(val string) (int, error) {
+	parts := strings.Split(val, ":")
+	if 2 == len(parts) && 2 == len(parts[0]) && 2 == len(parts[1]) {
+		hours, hErr := strconv.Atoi(parts[0])
+		minutes, mErr := strconv.Atoi(parts[1])
+		if nil == hErr && nil == mErr && hours >= 0 && minutes >= 0 &&
+			minutes < 60 && (hours < 24 || (24 == hours && 0 == minutes)) {
+			return hours*60 + minutes, nil
+		}
+	}
+	return 0, fmt.Errorf("'%v' is not a time like 09:30", val)
+}
+
+// Parse the active schedule annotation: windows separated by semicolons,
+// each made of days and a time range in UTC, like
+// "Mon-Fri 09:00-17:00; Sat 22:00-02:00"
+func parseActiveSchedule(val string) (activeSchedule, error) {
+	var schedule activeSchedule
+	for _, entry := range strings.Split(val, ";") {
+		fields := strings.Fields(entry)
+		if 0 == len(fields) {
+			continue
+		}
+		if 2 != len(fields) {
+			return nil, fmt.Errorf("'%v' is not a window like "+
+				"Mon-Fri 09:00-17:00", strings.TrimSpace(entry))
+		}
+		days, err := parseScheduleDays(fields[0])
+		if nil != err {
+			return nil, err
+		}
+		times := strings.Split(fields[1], "-")
+		if 2 != len(times) {
+			return nil, fmt.Errorf("'%v' is not a time range like "+
+				"09:00-17:00", fields[1])
+		}
+		start, err := parseScheduleTime(times[0])
+		if nil != err {
+			return nil, err
+		}
+		end, err := parseScheduleTime(times[1])
+		if nil != err {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("the window %v is empty", fields[1])
+		}
+		schedule = append(schedule, scheduleWindow{
+			Days:  days,
+			Start: start,
+			End:   end,
+		})
+	}
+	if 0 == len(schedule) {
+		return nil, fmt.Errorf("no window is given")
+	}
+	return schedule, nil
+}
+
+// Whether a time falls in one of the windows of the schedule
+func (schedule activeSchedule) activeAt(t time.Time) bool {
+	t = t.UTC()
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	yesterday := (day + 6) % 7
+	for _, window := range schedule {
+		if window.Start < window.End {
+			if window.Days[day] && minute >= window.Start &&
+				minute < window.End {
+				return true
+			}
+		} else if (window.Days[day] && minute >= window.Start) ||
+			(window.Days[yesterday] && minute < window.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Disable the virtual server outside of the windows of its schedule, for
+// endpoints only served at set times such as batch jobs or cutovers. The
+// disable-vs annotation still disables it within the windows.
+func setVirtualSchedule(
+	cfg *ResourceConfig,
+	annotations map[string]string,
+	resourceName string,
+	now time.Time,
+) {
+	cfg.MetaData.Schedule = nil
+	cfg.MetaData.ScheduledOff = false
+	val, ok := annotations[activeScheduleAnnotation]
+	if !ok {
+		return
+	}
+	schedule, err := parseActiveSchedule(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, activeScheduleAnnotation, resourceName, err)
+		return
+	}
+	cfg.MetaData.Schedule = schedule
+	if !schedule.activeAt(now) {
+		cfg.MetaData.ScheduledOff = true
+		cfg.Virtual.Disabled = true
+	}
+}
+
+// Sync the services of the virtual servers whose schedule opened or closed
+// since they were synced
+func (appMgr *Manager) checkSchedules() {
+	now := time.Now()
+	keys := make(map[serviceQueueKey]bool)
+	appMgr.resources.Lock()
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if nil == cfg.MetaData.Schedule ||
+			cfg.MetaData.Schedule.activeAt(now) != cfg.MetaData.ScheduledOff {
+			return
+		}
+		keys[serviceQueueKey{
+			Namespace:   key.Namespace,
+			ServiceName: key.ServiceName,
+		}] = true
+	})
+	appMgr.resources.Unlock()
+
+	for key := range keys {
+		log.Infof("Schedule of the virtual servers of service '%v/%v' "+
+			"changed, syncing them.", key.Namespace, key.ServiceName)
+		appMgr.vsQueue.Add(key)
+	}
+}
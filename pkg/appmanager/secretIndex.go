@@ -0,0 +1,154 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Name of the informer index from Secrets, as "namespace/name", to the
+// resources referencing them. Routes carry their certificates inline, only
+// the server CA Secret of a reencrypt Route is indexed.
+const secretIndex = "secrets"
+
+// Names that are BIG-IP profile paths rather than Secrets are skipped, a
+// Secret name cannot contain a slash.
+func appendSecretKey(keys []string, namespace, name string) []string {
+	if "" == name || strings.Contains(name, "/") {
+		return keys
+	}
+	return append(keys, namespace+"/"+name)
+}
+
+// Secrets holding the TLS certificates of an Ingress
+func ingressSecretIndexFunc(obj interface{}) ([]string, error) {
+	ing, ok := obj.(*v1beta1.Ingress)
+	if !ok {
+		return nil, nil
+	}
+	var keys []string
+	for _, tls := range ing.Spec.TLS {
+		keys = appendSecretKey(keys, ing.ObjectMeta.Namespace, tls.SecretName)
+	}
+	return keys, nil
+}
+
+// Secrets of the client SSL profiles and of the server CA of the
+// definitions of a ConfigMap. Definitions whose data cannot be parsed
+// reference no Secrets.
+func configMapSecretIndexFunc(obj interface{}) ([]string, error) {
+	cm, ok := obj.(*v1.ConfigMap)
+	if !ok {
+		return nil, nil
+	}
+	namespace := cm.ObjectMeta.Namespace
+	var keys []string
+	for _, cfgMap := range readConfigMapDefinitions(cm) {
+		frontend := cfgMap.VirtualServer.Frontend
+		if nil != frontend.SslProfile {
+			keys = appendSecretKey(keys, namespace,
+				frontend.SslProfile.F5ProfileName)
+			for _, name := range frontend.SslProfile.F5ProfileNames {
+				keys = appendSecretKey(keys, namespace, name)
+			}
+		}
+		if nil != frontend.ServerSslProfile {
+			keys = appendSecretKey(keys, namespace,
+				frontend.ServerSslProfile.CASecret)
+		}
+	}
+	return keys, nil
+}
+
+// Secret of the server CA bundle of a Route
+func routeSecretIndexFunc(obj interface{}) ([]string, error) {
+	route, ok := obj.(*routeapi.Route)
+	if !ok {
+		return nil, nil
+	}
+	return appendSecretKey(nil, route.ObjectMeta.Namespace,
+		route.ObjectMeta.Annotations[serverCASecretAnnotation]), nil
+}
+
+// Get a Secret from the informer of its namespace
+func (appMgr *Manager) getSecret(namespace, name string) (*v1.Secret, error) {
+	appInf, ok := appMgr.getNamespaceInformer(namespace)
+	if !ok {
+		return nil, fmt.Errorf("Namespace '%v' is not watched", namespace)
+	}
+	key := namespace + "/" + name
+	obj, found, err := appInf.secretInformer.GetIndexer().GetByKey(key)
+	if nil != err {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("Secret '%v' not found", key)
+	}
+	return obj.(*v1.Secret), nil
+}
+
+// Enqueue the resources referencing a Secret, found with the secrets index
+// of their informers instead of a rescan of the namespace
+func (appMgr *Manager) enqueueSecret(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secretMeta, err := meta.Accessor(obj)
+	if nil != err {
+		return
+	}
+	namespace := secretMeta.GetNamespace()
+	appInf, ok := appMgr.getNamespaceInformer(namespace)
+	if !ok {
+		// Not watching this namespace
+		return
+	}
+	key := namespace + "/" + secretMeta.GetName()
+	ingresses, err := appInf.ingInformer.GetIndexer().ByIndex(secretIndex, key)
+	if nil != err {
+		log.Warningf("Unable to find Ingresses using Secret '%v': %v", key, err)
+	}
+	for _, obj := range ingresses {
+		appMgr.enqueueIngress(obj)
+	}
+	cfgMaps, err := appInf.cfgMapInformer.GetIndexer().ByIndex(secretIndex, key)
+	if nil != err {
+		log.Warningf("Unable to find ConfigMaps using Secret '%v': %v", key, err)
+	}
+	for _, obj := range cfgMaps {
+		appMgr.enqueueConfigMap(obj)
+	}
+	if nil == appInf.routeInformer {
+		return
+	}
+	routes, err := appInf.routeInformer.GetIndexer().ByIndex(secretIndex, key)
+	if nil != err {
+		log.Warningf("Unable to find Routes using Secret '%v': %v", key, err)
+	}
+	for _, obj := range routes {
+		appMgr.enqueueRoute(obj)
+	}
+}
@@ -0,0 +1,68 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"net"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Use the address of the first pool's service as the virtual address of a
+// config that was given none, instead of creating its pool only.
+func (appMgr *Manager) setServiceAddress(
+	rsCfg *ResourceConfig,
+	namespace string,
+	svcIndexer cache.Indexer,
+) {
+	if rsCfg.Virtual.IApp != "" || nil == rsCfg.Virtual.VirtualAddress ||
+		rsCfg.Virtual.VirtualAddress.BindAddr != "" || 0 == len(rsCfg.Pools) {
+		return
+	}
+	namespace = rsCfg.Pools[0].serviceNamespace(namespace)
+	obj, found, err := svcIndexer.GetByKey(
+		namespace + "/" + rsCfg.Pools[0].ServiceName)
+	if nil != err || !found {
+		return
+	}
+	svc := obj.(*v1.Service)
+	if addr := serviceAddress(svc); addr != "" {
+		log.Debugf("Using address %s of service '%s/%s' for virtual server %s.",
+			addr, namespace, svc.ObjectMeta.Name, rsCfg.Virtual.VirtualServerName)
+		rsCfg.Virtual.VirtualAddress.BindAddr = addr
+	}
+}
+
+// The address a service is reachable on from outside the cluster. A
+// requested loadBalancerIP takes precedence over externalIPs, and the
+// address assigned by another load balancer is used last.
+func serviceAddress(svc *v1.Service) string {
+	candidates := []string{svc.Spec.LoadBalancerIP}
+	candidates = append(candidates, svc.Spec.ExternalIPs...)
+	for _, lbIngress := range svc.Status.LoadBalancer.Ingress {
+		candidates = append(candidates, lbIngress.IP)
+	}
+	for _, addr := range candidates {
+		if nil != net.ParseIP(addr) {
+			return addr
+		}
+	}
+	return ""
+}
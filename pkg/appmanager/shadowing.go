@@ -0,0 +1,346 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+var shadowedRules = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: metricsNamespace,
+	Subsystem: "rules",
+	Name:      "shadowed",
+	Help: "Number of Route and Ingress hosts not configured because an " +
+		"older resource claims them, by kind.",
+}, []string{"kind"})
+
+// A host, and path, defined by several resources where only one can be
+// configured. The oldest resource holds the claim.
+type ruleClaim struct {
+	// "namespace/name" of the resource that is not configured for the rule
+	Resource string
+	// "namespace/name" of the resource configured for the rule
+	Holder string
+	// Host and path of the rule
+	Rule string
+}
+
+// Claims of shadowed resources by kind and scope: the namespace for Routes,
+// whose rules share the policies of their namespace, and the cluster for
+// passthrough Ingresses, whose server names share a data group
+type ruleShadows struct {
+	sync.Mutex
+	claims map[string]map[string][]ruleClaim
+}
+
+func newRuleShadows() *ruleShadows {
+	return &ruleShadows{claims: make(map[string]map[string][]ruleClaim)}
+}
+
+// Replace the claims of a kind in a scope, returning the resources newly
+// shadowed so their conflict is only reported once
+func (rs *ruleShadows) replace(
+	kind, scope string,
+	claims []ruleClaim,
+) []ruleClaim {
+	rs.Lock()
+	defer rs.Unlock()
+	byScope, ok := rs.claims[kind]
+	if !ok {
+		byScope = make(map[string][]ruleClaim)
+		rs.claims[kind] = byScope
+	}
+	known := make(map[ruleClaim]bool)
+	for _, claim := range byScope[scope] {
+		known[claim] = true
+	}
+	var added []ruleClaim
+	for _, claim := range claims {
+		if !known[claim] {
+			added = append(added, claim)
+		}
+	}
+	if 0 == len(claims) {
+		delete(byScope, scope)
+	} else {
+		byScope[scope] = claims
+	}
+	count := 0
+	for _, scopeClaims := range byScope {
+		count += len(scopeClaims)
+	}
+	shadowedRules.WithLabelValues(kind).Set(float64(count))
+	return added
+}
+
+// Order Routes of a namespace by creation time, then by name
+func routeCreatedBefore(a, b *routeapi.Route) bool {
+	ta := a.ObjectMeta.CreationTimestamp
+	tb := b.ObjectMeta.CreationTimestamp
+	if !ta.Equal(tb) {
+		return ta.Before(tb)
+	}
+	return a.ObjectMeta.Name < b.ObjectMeta.Name
+}
+
+// Find the Routes of a namespace whose host and path are claimed by an older
+// Route. Their rules would share the policies of the namespace, matched in
+// an arbitrary order, so only the oldest Route is configured, as the
+// OpenShift router does.
+func routeShadows(routes Routes, namespace string) []ruleClaim {
+	holders := make(map[string]*routeapi.Route)
+	for _, route := range routes {
+		if route.ObjectMeta.Namespace != namespace || "" == route.Spec.Host {
+			continue
+		}
+		uri := strings.ToLower(route.Spec.Host) + route.Spec.Path
+		if holder, ok := holders[uri]; !ok || routeCreatedBefore(route, holder) {
+			holders[uri] = route
+		}
+	}
+	var claims []ruleClaim
+	for _, route := range routes {
+		if route.ObjectMeta.Namespace != namespace || "" == route.Spec.Host {
+			continue
+		}
+		uri := strings.ToLower(route.Spec.Host) + route.Spec.Path
+		if holder := holders[uri]; holder != route {
+			claims = append(claims, ruleClaim{
+				Resource: namespace + "/" + route.ObjectMeta.Name,
+				Holder:   namespace + "/" + holder.ObjectMeta.Name,
+				Rule:     uri,
+			})
+		}
+	}
+	return claims
+}
+
+func (claim ruleClaim) message(kind string) string {
+	return fmt.Sprintf("Host '%v' is claimed by %v '%v', not configuring "+
+		"it for %v '%v'.", claim.Rule, kind, claim.Holder, kind, claim.Resource)
+}
+
+// Record the shadowed Routes of a namespace, with a Warning Event on both
+// Routes of a new conflict
+func (appMgr *Manager) recordRouteShadows(
+	namespace string,
+	routes Routes,
+	claims []ruleClaim,
+) {
+	added := appMgr.ruleShadows.replace("Route", namespace, claims)
+	if 0 == len(added) {
+		return
+	}
+	byName := make(map[string]*routeapi.Route)
+	for _, route := range routes {
+		byName[route.ObjectMeta.Namespace+"/"+route.ObjectMeta.Name] = route
+	}
+	for _, claim := range added {
+		msg := claim.message("Route")
+		log.Warningf("%s", msg)
+		if route, ok := byName[claim.Resource]; ok {
+			appMgr.recordRouteEvent(route, v1.EventTypeWarning,
+				"HostAlreadyClaimed", msg)
+		}
+		if holder, ok := byName[claim.Holder]; ok {
+			appMgr.recordRouteEvent(holder, v1.EventTypeWarning,
+				"HostClaimConflict", msg)
+		}
+	}
+}
+
+// Record an Event on a Route. Routes are not known to the scheme of the
+// event recorder, so the Event refers to them by reference.
+func (appMgr *Manager) recordRouteEvent(
+	route *routeapi.Route,
+	eventType, reason, message string,
+) {
+	appMgr.eventRecorder.Event(&v1.ObjectReference{
+		Kind:            "Route",
+		APIVersion:      "v1",
+		Namespace:       route.ObjectMeta.Namespace,
+		Name:            route.ObjectMeta.Name,
+		UID:             route.ObjectMeta.UID,
+		ResourceVersion: route.ObjectMeta.ResourceVersion,
+	}, eventType, reason, message)
+}
+
+// Remove the rule of a shadowed Route, added before an older Route claimed
+// its host, from the shared virtual servers of its namespace
+func (appMgr *Manager) removeShadowedRouteRule(route *routeapi.Route) {
+	appMgr.resources.Lock()
+	defer appMgr.resources.Unlock()
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if cfg.MetaData.ResourceType != "route" ||
+			key.Namespace != route.ObjectMeta.Namespace {
+			return
+		}
+		appMgr.removeRouteRuleLocked(route, key, cfg)
+	})
+}
+
+// Remove the rule of a Route from one of the shared virtual servers of its
+// namespace, with its certificate
+func (appMgr *Manager) removeRouteRuleLocked(
+	route *routeapi.Route,
+	key serviceKey,
+	cfg *ResourceConfig,
+) {
+	ruleName := formatRouteRuleName(route)
+	if cfg.removeRule(ruleName) {
+		cfg.Virtual.RemoveFrontendSslProfileName(fmt.Sprintf(
+			"%s/%s-https-cert", cfg.Virtual.Partition, ruleName))
+		appMgr.resources.Assign(key, cfg.Virtual.VirtualServerName, cfg)
+	}
+}
+
+// Remove a rule from the policies of a config, and the policies it leaves
+// empty. Returns whether the rule was found.
+func (rc *ResourceConfig) removeRule(ruleName string) bool {
+	var emptied []nameRef
+	found := false
+	for i := range rc.Policies {
+		pol := &rc.Policies[i]
+		for j, rule := range pol.Rules {
+			if rule.Name != ruleName {
+				continue
+			}
+			pol.Rules = append(pol.Rules[:j], pol.Rules[j+1:]...)
+			found = true
+			if 0 == len(pol.Rules) {
+				emptied = append(emptied,
+					nameRef{Name: pol.Name, Partition: pol.Partition})
+			}
+			break
+		}
+	}
+	for _, nr := range emptied {
+		rc.RemovePolicy(nr)
+	}
+	return found
+}
+
+// Server names of a passthrough Ingress: the hosts of its rules and, with a
+// default backend, the hosts of its TLS section
+func passthroughIngressHosts(ing *v1beta1.Ingress) []string {
+	var hosts []string
+	addHost := func(host string) {
+		host = strings.ToLower(host)
+		if "" != host && !strings.HasPrefix(host, "*.") {
+			hosts = append(hosts, host)
+		}
+	}
+	for _, rule := range ing.Spec.Rules {
+		if nil != rule.IngressRuleValue.HTTP &&
+			0 != len(rule.IngressRuleValue.HTTP.Paths) {
+			addHost(rule.Host)
+		}
+	}
+	if nil != ing.Spec.Backend {
+		for _, tls := range ing.Spec.TLS {
+			for _, host := range tls.Hosts {
+				addHost(host)
+			}
+		}
+	}
+	return hosts
+}
+
+// Find the Ingresses holding the server names of passthrough Ingresses, in
+// all the watched namespaces, and the Ingresses shadowed by them. The path
+// of a passed through request can not be seen, so a server name selects a
+// single pool: the one of the oldest Ingress.
+func (appMgr *Manager) passthroughHostClaims() (
+	map[string]*v1beta1.Ingress,
+	[]ruleClaim,
+) {
+	var ingresses []*v1beta1.Ingress
+	appMgr.informersMutex.Lock()
+	for _, appInf := range appMgr.appInformers {
+		if nil == appInf.ingInformer {
+			continue
+		}
+		for _, obj := range appInf.ingInformer.GetStore().List() {
+			ing := obj.(*v1beta1.Ingress)
+			if class, ok := ing.ObjectMeta.Annotations["kubernetes.io/ingress.class"]; ok && class != "f5" {
+				continue
+			}
+			if isPassthroughIngress(ing) {
+				ingresses = append(ingresses, ing)
+			}
+		}
+	}
+	appMgr.informersMutex.Unlock()
+
+	holders := make(map[string]*v1beta1.Ingress)
+	for _, ing := range ingresses {
+		for _, host := range passthroughIngressHosts(ing) {
+			if holder, ok := holders[host]; !ok || ingressCreatedBefore(ing, holder) {
+				holders[host] = ing
+			}
+		}
+	}
+	var claims []ruleClaim
+	for _, ing := range ingresses {
+		seen := make(map[string]bool)
+		for _, host := range passthroughIngressHosts(ing) {
+			holder := holders[host]
+			if holder == ing || seen[host] {
+				continue
+			}
+			seen[host] = true
+			claims = append(claims, ruleClaim{
+				Resource: ing.ObjectMeta.Namespace + "/" + ing.ObjectMeta.Name,
+				Holder: holder.ObjectMeta.Namespace + "/" +
+					holder.ObjectMeta.Name,
+				Rule: host,
+			})
+		}
+	}
+	return holders, claims
+}
+
+// Record the shadowed passthrough Ingresses, with an Event on both Ingresses
+// of a new conflict
+func (appMgr *Manager) recordIngressShadows(
+	holders map[string]*v1beta1.Ingress,
+	claims []ruleClaim,
+) {
+	for _, claim := range appMgr.ruleShadows.replace("Ingress", "", claims) {
+		msg := claim.message("Ingress")
+		log.Warningf("%s", msg)
+		parts := strings.SplitN(claim.Resource, "/", 2)
+		appMgr.statusQueue.Add(ingressEvent{
+			Namespace: parts[0],
+			Name:      parts[1],
+			Reason:    "HostAlreadyClaimed",
+			Message:   msg,
+		})
+		if holder, ok := holders[claim.Rule]; ok {
+			appMgr.recordIngressEvent(holder, "HostClaimConflict", msg, "")
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Modes of the source port of the connections to the pool members
+const (
+	sourcePortPreserve       = "preserve"
+	sourcePortPreserveStrict = "preserve-strict"
+	sourcePortChange         = "change"
+)
+
+func parseSourcePort(val string) (string, error) {
+	switch val {
+	case sourcePortPreserve, sourcePortPreserveStrict, sourcePortChange:
+		return val, nil
+	}
+	return "", fmt.Errorf("must be %v, %v or %v", sourcePortPreserve,
+		sourcePortPreserveStrict, sourcePortChange)
+}
+
+// Keep the source port and address of the clients on the connections to
+// the pool members, for legacy protocols that authenticate clients by them.
+// preserve-strict fails connections whose port cannot be kept, and a
+// transparent virtual server does not translate the client address, so the
+// pool members must route their replies through the BIG-IP. The annotations
+// override the frontend of ConfigMaps.
+func setVirtualSourceTranslation(
+	virtual *Virtual,
+	annotations map[string]string,
+	resourceName string,
+) {
+	if val, ok := annotations[sourcePortAnnotation]; ok {
+		mode, err := parseSourcePort(val)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+				val, sourcePortAnnotation, resourceName, err)
+		} else {
+			virtual.SourcePort = mode
+		}
+	}
+	if val, ok := annotations[transparentAnnotation]; ok {
+		transparent, err := strconv.ParseBool(val)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+				val, transparentAnnotation, resourceName, err)
+		} else {
+			virtual.Transparent = transparent
+		}
+	}
+}
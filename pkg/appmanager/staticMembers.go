@@ -0,0 +1,80 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// Parse the static members of a ConfigMap backend, "address:port" entries
+// with IPv6 addresses in brackets. An entry with an address only uses the
+// servicePort of the backend.
+func parseStaticMembers(entries []string, defaultPort int32) ([]Member, error) {
+	var members []Member
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		host, portStr, err := net.SplitHostPort(entry)
+		port := defaultPort
+		if nil != err {
+			host = entry
+		} else {
+			p, err := strconv.ParseUint(portStr, 10, 16)
+			if nil != err || 0 == p {
+				return nil, fmt.Errorf("static member '%v' has an invalid port",
+					entry)
+			}
+			port = int32(p)
+		}
+		ip := net.ParseIP(host)
+		if nil == ip {
+			return nil, fmt.Errorf("static member '%v' is not an IP address "+
+				"and port", entry)
+		}
+		member := Member{
+			Address: ip.String(),
+			Port:    port,
+			Session: "user-enabled",
+		}
+		key := net.JoinHostPort(member.Address, strconv.Itoa(int(port)))
+		if seen[key] {
+			return nil, fmt.Errorf("static member '%v' is listed twice", entry)
+		}
+		seen[key] = true
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// Add the static members of a pool to the members of its service, those
+// already present are left as-is
+func mergeStaticMembers(members, static []Member) []Member {
+	for _, sm := range static {
+		found := false
+		for _, m := range members {
+			if m.Address == sm.Address && m.Port == sm.Port {
+				found = true
+				break
+			}
+		}
+		if !found {
+			members = append(members, sm)
+		}
+	}
+	return members
+}
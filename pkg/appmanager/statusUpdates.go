@@ -0,0 +1,172 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Number of attempts made for an Event or status update before dropping it
+const maxStatusRetries = 5
+
+// Backoff between attempts of a failed Event or status update
+const statusRetryBaseDelay = 500 * time.Millisecond
+const statusRetryMaxDelay = 30 * time.Second
+
+// An Event to record on an Ingress. The Ingress is looked up by name when
+// the sync that raised the Event did not have it.
+type ingressEvent struct {
+	Ingress   *v1beta1.Ingress
+	Namespace string
+	Name      string
+	Reason    string
+	Message   string
+}
+
+// The virtual IP to publish in the status of an Ingress
+type ingressStatus struct {
+	Namespace string
+	Name      string
+	IP        string
+}
+
+// The route report to write to the route status ConfigMap
+type routeStatusUpdate struct {
+	Report string
+}
+
+// Write the reserved addresses to the VIP tombstone ConfigMap. The latest
+// are written, so pending updates are merged.
+type vipTombstonesUpdate struct{}
+
+// Set the applied config annotations of the resources to the configs last
+// written. The latest are compared, so pending updates are merged.
+type appliedConfigsUpdate struct{}
+
+func newStatusQueue() workqueue.RateLimitingInterface {
+	return workqueue.NewNamedRateLimitingQueue(
+		workqueue.NewItemExponentialFailureRateLimiter(
+			statusRetryBaseDelay, statusRetryMaxDelay),
+		"status-updates")
+}
+
+func (appMgr *Manager) statusWorker() {
+	for appMgr.processNextStatusUpdate() {
+	}
+}
+
+func (appMgr *Manager) processNextStatusUpdate() bool {
+	item, quit := appMgr.statusQueue.Get()
+	if quit {
+		// The controller is shutting down.
+		return false
+	}
+	defer appMgr.statusQueue.Done(item)
+
+	var err error
+	switch update := item.(type) {
+	case ingressEvent:
+		err = appMgr.recordIngressEventNow(update)
+	case ingressStatus:
+		err = appMgr.setIngressStatusNow(update)
+	case routeStatusUpdate:
+		err = appMgr.writeRouteStatusNow(update)
+	case vipTombstonesUpdate:
+		err = appMgr.writeVIPTombstonesNow()
+	case appliedConfigsUpdate:
+		err = appMgr.setAppliedConfigsNow()
+	}
+	if nil == err {
+		appMgr.statusQueue.Forget(item)
+		return true
+	}
+
+	if appMgr.statusQueue.NumRequeues(item) < maxStatusRetries-1 {
+		log.Debugf("Retrying status update %+v: %v", item, err)
+		appMgr.statusQueue.AddRateLimited(item)
+		return true
+	}
+	appMgr.statusQueue.Forget(item)
+	log.Warningf("Dropping status update after %d attempts: %v",
+		maxStatusRetries, err)
+	if status, ok := item.(ingressStatus); ok {
+		appMgr.statusQueue.Add(ingressEvent{
+			Namespace: status.Namespace,
+			Name:      status.Name,
+			Reason:    "StatusIPError",
+			Message: fmt.Sprintf(
+				"Error when setting Ingress status IP %v: %v", status.IP, err),
+		})
+	}
+	return true
+}
+
+// Find an Ingress in the informer cache, or ask the API server if it is not
+// watched (yet).
+func (appMgr *Manager) getIngress(namespace, name string) (*v1beta1.Ingress, error) {
+	if appInf, ok := appMgr.getNamespaceInformer(namespace); ok {
+		obj, found, err := appInf.ingInformer.GetIndexer().
+			GetByKey(namespace + "/" + name)
+		if nil == err && found {
+			return obj.(*v1beta1.Ingress), nil
+		}
+	}
+	return appMgr.kubeClient.Extensions().Ingresses(namespace).
+		Get(name, metav1.GetOptions{})
+}
+
+func (appMgr *Manager) recordIngressEventNow(event ingressEvent) error {
+	ing := event.Ingress
+	if nil == ing {
+		var err error
+		ing, err = appMgr.getIngress(event.Namespace, event.Name)
+		if nil != err {
+			return fmt.Errorf("Could not find Ingress resource '%v/%v': %v",
+				event.Namespace, event.Name, err)
+		}
+	}
+	appMgr.eventRecorder.Event(ing, v1.EventTypeNormal, event.Reason, event.Message)
+	return nil
+}
+
+// Publish the virtual IP in the Ingress status. The Ingress is read from the
+// API server so the update is made against its latest version.
+func (appMgr *Manager) setIngressStatusNow(status ingressStatus) error {
+	ingClient := appMgr.kubeClient.ExtensionsV1beta1().Ingresses(status.Namespace)
+	ing, err := ingClient.Get(status.Name, metav1.GetOptions{})
+	if nil != err {
+		return err
+	}
+	lbIngress := v1.LoadBalancerIngress{IP: status.IP}
+	if len(ing.Status.LoadBalancer.Ingress) == 0 {
+		ing.Status.LoadBalancer.Ingress = append(ing.Status.LoadBalancer.Ingress, lbIngress)
+	} else if ing.Status.LoadBalancer.Ingress[0].IP != status.IP {
+		ing.Status.LoadBalancer.Ingress[0] = lbIngress
+	} else {
+		return nil
+	}
+	_, err = ingClient.UpdateStatus(ing)
+	return err
+}
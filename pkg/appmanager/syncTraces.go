@@ -0,0 +1,189 @@
+/*-
+ * Copyright (c) 2016,2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/tracing"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Trace of a service key through the sync pipeline. The root span starts
+// when the key is added to the virtual server queue and ends once the
+// changes of its syncs have been written, with a child span for the time
+// spent in the queue, for each sync, and for the config write.
+type keyTrace struct {
+	root   *tracing.Span
+	queued *tracing.Span
+	sync   *tracing.Span
+	// A sync changed the config, and it has not been written yet
+	changed bool
+}
+
+// Traces of the service keys in the sync pipeline. A nil *syncTraces
+// does nothing.
+type syncTraces struct {
+	tracer *tracing.Tracer
+	mutex  sync.Mutex
+	keys   map[serviceQueueKey]*keyTrace
+}
+
+func newSyncTraces(tracer *tracing.Tracer) *syncTraces {
+	return &syncTraces{
+		tracer: tracer,
+		keys:   make(map[serviceQueueKey]*keyTrace),
+	}
+}
+
+// Start the trace of a key added to the queue, or the queued span of a key
+// already traced. A key added again before it is synced stays in the same
+// queued span, as the queue merges the additions.
+func (st *syncTraces) enqueued(item interface{}) {
+	sKey, ok := item.(serviceQueueKey)
+	if nil == st || !ok {
+		return
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	kt, found := st.keys[sKey]
+	if !found {
+		kt = &keyTrace{root: st.tracer.Start("pipeline", nil)}
+		kt.root.SetAttribute("k8s.namespace", sKey.Namespace)
+		kt.root.SetAttribute("k8s.service", sKey.ServiceName)
+		st.keys[sKey] = kt
+	}
+	if nil == kt.queued {
+		kt.queued = st.tracer.Start("queued", kt.root)
+	}
+}
+
+// End the queued span of a key taken from the queue and start its sync span
+func (st *syncTraces) started(sKey serviceQueueKey) {
+	if nil == st {
+		return
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	kt, found := st.keys[sKey]
+	if !found {
+		return
+	}
+	kt.queued.End()
+	kt.queued = nil
+	kt.sync = st.tracer.Start("sync", kt.root)
+}
+
+// Record the outcome of the sync of a key on its span. Changes to the config
+// keep the trace open until they are written.
+func (st *syncTraces) syncStats(sKey serviceQueueKey, stats vsSyncStats) {
+	if nil == st {
+		return
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	kt, found := st.keys[sKey]
+	if !found || nil == kt.sync {
+		return
+	}
+	kt.sync.SetAttribute("vs.found", stats.vsFound)
+	kt.sync.SetAttribute("vs.updated", stats.vsUpdated)
+	kt.sync.SetAttribute("vs.deleted", stats.vsDeleted)
+	kt.sync.SetAttribute("profiles.updated", stats.cpUpdated)
+	kt.sync.SetAttribute("datagroups.updated", stats.dgUpdated)
+	if stats.vsUpdated > 0 || stats.vsDeleted > 0 || stats.cpUpdated > 0 ||
+		stats.dgUpdated > 0 {
+		kt.changed = true
+	}
+}
+
+// End the sync span of a key. The trace ends unless the key is queued
+// again, by a failure or a newer change, or has changes still to write.
+func (st *syncTraces) synced(sKey serviceQueueKey, err error) {
+	if nil == st {
+		return
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	kt, found := st.keys[sKey]
+	if !found {
+		return
+	}
+	kt.sync.SetError(err)
+	kt.sync.End()
+	kt.sync = nil
+	if nil == err && !kt.changed && nil == kt.queued {
+		kt.root.End()
+		delete(st.keys, sKey)
+	}
+}
+
+// Add a span for a config write, started at start, to the traces of all
+// the keys with changes, and end the traces of those no longer syncing.
+func (st *syncTraces) written(start time.Time, err error) {
+	if nil == st {
+		return
+	}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	for sKey, kt := range st.keys {
+		if !kt.changed {
+			continue
+		}
+		span := st.tracer.StartAt("write", kt.root, start)
+		span.SetError(err)
+		span.End()
+		kt.changed = false
+		if nil == kt.sync && nil == kt.queued {
+			kt.root.End()
+			delete(st.keys, sKey)
+		}
+	}
+}
+
+// Work queue that starts a trace for the keys added to it
+type tracedQueue struct {
+	workqueue.RateLimitingInterface
+	traces *syncTraces
+}
+
+func newTracedQueue(
+	queue workqueue.RateLimitingInterface,
+	traces *syncTraces,
+) *tracedQueue {
+	return &tracedQueue{
+		RateLimitingInterface: queue,
+		traces:                traces,
+	}
+}
+
+func (q *tracedQueue) Add(item interface{}) {
+	q.traces.enqueued(item)
+	q.RateLimitingInterface.Add(item)
+}
+
+func (q *tracedQueue) AddAfter(item interface{}, duration time.Duration) {
+	q.traces.enqueued(item)
+	q.RateLimitingInterface.AddAfter(item, duration)
+}
+
+func (q *tracedQueue) AddRateLimited(item interface{}) {
+	q.traces.enqueued(item)
+	q.RateLimitingInterface.AddRateLimited(item)
+}
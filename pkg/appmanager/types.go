@@ -16,6 +16,13 @@
 
 package appmanager
 
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
 type (
 	// Configs for each BIG-IP partition
 	PartitionMap map[string]*BigIPConfig
@@ -30,6 +37,8 @@ type (
 		IRules             []IRule             `json:"iRules,omitempty"`
 		InternalDataGroups []InternalDataGroup `json:"internalDataGroups,omitempty"`
 		IApps              []IApp              `json:"iapps,omitempty"`
+		Nodes              []Node              `json:"nodes,omitempty"`
+		Adoptions          []Adoption          `json:"adoptions,omitempty"`
 	}
 
 	// Config for a single resource (ConfigMap or Ingress)
@@ -43,9 +52,36 @@ type (
 	ResourceConfigs []*ResourceConfig
 
 	metaData struct {
-		Active       bool
-		NodePort     int32
+		Active   bool
+		NodePort int32
+		// Kind of the resource the config was created for: "configmap",
+		// "ingress" or "route"
 		ResourceType string
+		// Namespace and name of the ConfigMap or Ingress, empty for the
+		// configs Routes share
+		ResourceName string
+		// "nodeport" or "cluster" if set by annotation
+		PoolMemberType string
+		// Limit of the members of each pool set by annotation, 0 if unset
+		PoolMemberLimit int
+		// Full path of the pool used when the pool of the virtual server
+		// has no active members
+		FallbackPool string
+		// HTML page served when neither pool has active members, and its
+		// status code, 0 for the default 503
+		MaintenancePage   string
+		MaintenanceStatus int
+		// Canonical host names by alternate host name, and the status code
+		// of the redirects to them
+		HostRedirects    map[string]string
+		HostRedirectCode int
+		// Type, name and timeout of the session identifier of universal
+		// persistence, as "cookie JSESSIONID 1800"
+		UniversalPersistence string
+		// Windows in which the virtual server is enabled, set by annotation,
+		// and whether it was outside of them when synced
+		Schedule     activeSchedule
+		ScheduledOff bool
 	}
 
 	// Reference to pre-existing profiles
@@ -53,6 +89,9 @@ type (
 		Name      string `json:"name"`
 		Partition string `json:"partition"`
 		Context   string `json:"context"` // 'clientside', 'serverside', or 'all'
+		// Position of a profile declared by a ConfigMap, from 1, 0 if not
+		// declared
+		order int
 	}
 	ProfileRefs []ProfileRef
 
@@ -66,16 +105,43 @@ type (
 		// VirtualServer parameters
 		Balance               string                `json:"balance,omitempty"`
 		Mode                  string                `json:"mode,omitempty"`
+		VirtualType           string                `json:"virtualType,omitempty"`
 		VirtualAddress        *virtualAddress       `json:"virtualAddress,omitempty"`
 		Destination           string                `json:"destination,omitempty"`
-		Enabled               bool                  `json:"enabled,omitempty"`
+		Enabled               bool                  `json:"enabled"`
+		Disabled              bool                  `json:"-"`
 		IpProtocol            string                `json:"ipProtocol,omitempty"`
+		IpForward             bool                  `json:"ipForward,omitempty"`
+		SourcePort            string                `json:"sourcePort,omitempty"`
+		Transparent           bool                  `json:"transparent,omitempty"`
 		SourceAddrTranslation sourceAddrTranslation `json:"sourceAddressTranslation,omitempty"`
 		SslProfile            *sslProfile           `json:"sslProfile,omitempty"`
+		ServerSslProfile      *serverSslProfile     `json:"serverSslProfile,omitempty"`
 		Policies              []nameRef             `json:"policies,omitempty"`
 		IRules                []string              `json:"rules,omitempty"`
 		// FIXME: All profiles should reside in Profiles, just server ssl ones now.
 		Profiles              ProfileRefs           `json:"profiles,omitempty"`
+		// Fields kept as manually set on the BIG-IP (merge policy)
+		PreserveFields []string `json:"preserveFields,omitempty"`
+		// Security (AFM/ASM) logging profiles. Nil leaves the profiles of the
+		// BIG-IP virtual server alone, empty removes them.
+		SecurityLogProfiles *[]string `json:"securityLogProfiles,omitempty"`
+		// Bandwidth controller policy. Nil leaves the policy of the BIG-IP
+		// virtual server alone, empty removes it.
+		BwcPolicy *string `json:"bwcPolicy,omitempty"`
+		// Pools receiving a copy of the traffic, such as an IDS. Nil leaves
+		// the clone pools of the BIG-IP virtual server alone, empty removes
+		// them.
+		ClonePools *[]clonePool `json:"clonePools,omitempty"`
+		// APM per-request policy. Nil leaves the policy of the BIG-IP
+		// virtual server alone, empty removes it.
+		PerRequestPolicy *string `json:"perRequestPolicy,omitempty"`
+		// Persistence profile. Nil leaves the persistence of the BIG-IP
+		// virtual server alone, empty removes it.
+		Persist *string `json:"persist,omitempty"`
+		// OneConnect profile created for the virtual server, the driver
+		// creates it before CCCL attaches it from Profiles
+		OneConnect *oneConnectProfile `json:"oneConnect,omitempty"`
 
 		// iApp parameters
 		IApp                string                    `json:"iapp,omitempty"`
@@ -102,6 +168,14 @@ type (
 		Address string `json:"address"`
 		Port    int32  `json:"port"`
 		Session string `json:"session,omitempty"`
+		// Pod or Node behind the member, set on the BIG-IP node
+		Description string `json:"-"`
+	}
+
+	// BIG-IP node of pool members, named after its address
+	Node struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
 	}
 
 	// Pool config
@@ -113,6 +187,21 @@ type (
 		ServicePort  int32    `json:"servicePort,omitempty"`
 		Members      []Member `json:"members"`
 		MonitorNames []string `json:"monitors,omitempty"`
+		// Action to take on existing connections when a member goes down
+		ServiceDownAction string `json:"serviceDownAction,omitempty"`
+		ReselectTries     int    `json:"reselectTries,omitempty"`
+		// Namespace of the service, set for Ingresses which may reference
+		// services of other namespaces
+		ServiceNamespace string `json:"serviceNamespace,omitempty"`
+		// Member resolved by the BIG-IP from DNS instead of the endpoints
+		// of a service
+		Fqdn *fqdnMember `json:"fqdn,omitempty"`
+		// Members outside of the cluster listed by a ConfigMap, added to the
+		// members of the service if it has one
+		StaticMembers []Member `json:"-"`
+		// Reason the service has no node port for the pool in nodeport
+		// mode, leaving it without members
+		NodePortError string `json:"-"`
 	}
 	Pools []Pool
 
@@ -171,18 +260,26 @@ type (
 	condition struct {
 		Name            string   `json:"name"`
 		CaseInsensitive bool     `json:"caseInsensitive,omitempty"`
+		Contains        bool     `json:"contains,omitempty"`
 		Equals          bool     `json:"equals,omitempty"`
 		EndsWith        bool     `json:"endsWith,omitempty"`
 		External        bool     `json:"external,omitempty"`
+		HTTPHeader      bool     `json:"httpHeader,omitempty"`
+		HTTPCookie      bool     `json:"httpCookie,omitempty"`
 		HTTPHost        bool     `json:"httpHost,omitempty"`
 		Host            bool     `json:"host,omitempty"`
+		HTTPMethod      bool     `json:"httpMethod,omitempty"`
 		HTTPURI         bool     `json:"httpUri,omitempty"`
 		Index           int      `json:"index,omitempty"`
+		Not             bool     `json:"not,omitempty"`
+		Path            bool     `json:"path,omitempty"`
 		PathSegment     bool     `json:"pathSegment,omitempty"`
 		Present         bool     `json:"present,omitempty"`
 		Remote          bool     `json:"remote,omitempty"`
 		Request         bool     `json:"request,omitempty"`
 		Scheme          bool     `json:"scheme,omitempty"`
+		StartsWith      bool     `json:"startsWith,omitempty"`
+		TmName          string   `json:"tmName,omitempty"`
 		Values          []string `json:"values"`
 	}
 
@@ -199,6 +296,8 @@ type (
 	virtualAddress struct {
 		BindAddr string `json:"bindAddr,omitempty"`
 		Port     int32  `json:"port,omitempty"`
+		// IPv6 address of the second virtual server of a dual-stack pair
+		BindAddrV6 string `json:"bindAddrV6,omitempty"`
 	}
 
 	// frontend ssl profile
@@ -207,6 +306,12 @@ type (
 		F5ProfileNames []string `json:"f5ProfileNames,omitempty"`
 	}
 
+	// frontend server ssl profile, either a BIG-IP profile or a CA Secret
+	serverSslProfile struct {
+		F5ProfileName string `json:"f5ProfileName,omitempty"`
+		CASecret      string `json:"caSecret,omitempty"`
+	}
+
 	// frontend pool member column definition
 	iappPoolMemberColumn struct {
 		Name  string `json:"name"`
@@ -235,36 +340,145 @@ type (
 		Cert       string `json:"cert"`
 		Key        string `json:"key"`
 		ServerName string `json:"serverName,omitempty"`
+		// Session resumption settings, the BIG-IP defaults apply if unset
+		SessionTicket string `json:"sessionTicket,omitempty"` // 'enabled' or 'disabled'
+		CacheSize     *int   `json:"cacheSize,omitempty"`
+	}
+
+	// Server-side connection reuse options of a OneConnect profile, unset
+	// options take the value of the parent profile
+	oneConnectOptions struct {
+		MaxSize             *int   `json:"maxSize,omitempty"`
+		MaxReuse            *int   `json:"maxReuse,omitempty"`
+		MaxAge              *int   `json:"maxAge,omitempty"`
+		IdleTimeoutOverride *int   `json:"idleTimeoutOverride,omitempty"`
+		SourceMask          string `json:"sourceMask,omitempty"`
+	}
+
+	// Pool mirroring the traffic of a virtual server, on the client or the
+	// server side
+	clonePool struct {
+		Name    string `json:"name"`
+		Context string `json:"context"`
+	}
+
+	// OneConnect profile created for a single virtual server
+	oneConnectProfile struct {
+		Name         string `json:"name"`
+		Partition    string `json:"partition"`
+		DefaultsFrom string `json:"defaultsFrom"`
+		oneConnectOptions
 	}
 
 	// Used to unmarshal ConfigMap data
 	ConfigMap struct {
 		VirtualServer struct {
-			Backend  configMapBackend `json:"backend"`
-			Frontend Virtual          `json:"frontend"`
+			Backend  configMapBackend  `json:"backend"`
+			Frontend Virtual           `json:"frontend"`
+			Policies []configMapPolicy `json:"policies,omitempty"`
 		} `json:"virtualServer"`
 	}
 
 	configMapBackend struct {
-		ServiceName     string    `json:"serviceName"`
-		ServicePort     int32     `json:"servicePort"`
-		PoolMemberAddrs []string  `json:"poolMemberAddrs"`
-		HealthMonitors  []Monitor `json:"healthMonitors,omitempty"`
+		ServiceName     string      `json:"serviceName"`
+		ServicePort     int32       `json:"servicePort"`
+		PoolMemberAddrs []string    `json:"poolMemberAddrs"`
+		HealthMonitors  []Monitor   `json:"healthMonitors,omitempty"`
+		Fqdn            *fqdnMember `json:"fqdn,omitempty"`
+		StaticMembers   []string    `json:"staticMembers,omitempty"`
+	}
+
+	// Pool member of a host name, resolved periodically by the BIG-IP.
+	// With autoPopulate, a member is created for each address of the name.
+	fqdnMember struct {
+		Name         string `json:"name"`
+		AutoPopulate *bool  `json:"autoPopulate,omitempty"`
+		// Seconds between DNS queries, the TTL of the records if 0
+		Interval int `json:"interval,omitempty"`
+		// Port of the members, the servicePort of the backend
+		Port int32 `json:"port,omitempty"`
+	}
+
+	// L7 policy defined in a ConfigMap
+	configMapPolicy struct {
+		Name     string          `json:"name"`
+		Strategy string          `json:"strategy,omitempty"`
+		Rules    []configMapRule `json:"rules"`
+	}
+
+	configMapRule struct {
+		Name       string               `json:"name"`
+		Conditions []configMapCondition `json:"conditions,omitempty"`
+		Action     configMapAction      `json:"action"`
+	}
+
+	// Matches the host, path or a header of a request
+	configMapCondition struct {
+		Match           string   `json:"match"`
+		Name            string   `json:"name,omitempty"`
+		Operand         string   `json:"operand,omitempty"`
+		CaseInsensitive bool     `json:"caseInsensitive,omitempty"`
+		Values          []string `json:"values"`
+	}
+
+	// Forwards to a pool, redirects or drops a request
+	configMapAction struct {
+		Type     string `json:"type"`
+		Pool     string `json:"pool,omitempty"`
+		Location string `json:"location,omitempty"`
+	}
+
+	// Forwards requests with a header or cookie value to a service, from
+	// the header rules annotation of an Ingress
+	ingressHeaderRule struct {
+		Header      string             `json:"header,omitempty"`
+		Cookie      string             `json:"cookie,omitempty"`
+		Operand     string             `json:"operand,omitempty"`
+		Values      []string           `json:"values"`
+		Host        string             `json:"host,omitempty"`
+		ServiceName string             `json:"serviceName"`
+		ServicePort intstr.IntOrString `json:"servicePort"`
+	}
+
+	// AdmissionReview of the admission.k8s.io/v1beta1 API, with only the
+	// fields needed to validate a resource
+	admissionReview struct {
+		APIVersion string             `json:"apiVersion,omitempty"`
+		Kind       string             `json:"kind,omitempty"`
+		Request    *admissionRequest  `json:"request,omitempty"`
+		Response   *admissionResponse `json:"response,omitempty"`
+	}
+	admissionRequest struct {
+		UID       string                  `json:"uid"`
+		Kind      metav1.GroupVersionKind `json:"kind"`
+		Namespace string                  `json:"namespace,omitempty"`
+		Name      string                  `json:"name,omitempty"`
+		Operation string                  `json:"operation"`
+		Object    json.RawMessage         `json:"object,omitempty"`
+	}
+	admissionResponse struct {
+		UID     string         `json:"uid"`
+		Allowed bool           `json:"allowed"`
+		Result  *metav1.Status `json:"status,omitempty"`
 	}
 
 	// This is the format for each item in the health monitor annotation used
-	// in the Ingress object.
+	// in the Ingress object. A monitor applies to the rules matching its path,
+	// which may hold '*' globs, and to the backends of its service and port,
+	// by number or name, when set.
 	IngressHealthMonitor struct {
-		Path     string `json:"path"`
-		Interval int    `json:"interval"`
-		Send     string `json:"send"`
-		Timeout  int    `json:"timeout"`
+		Path        string             `json:"path,omitempty"`
+		ServiceName string             `json:"serviceName,omitempty"`
+		ServicePort intstr.IntOrString `json:"servicePort,omitempty"`
+		Interval    int                `json:"interval"`
+		Send        string             `json:"send"`
+		Timeout     int                `json:"timeout"`
 	}
 	IngressHealthMonitors []IngressHealthMonitor
 
 	ingressRuleData struct {
 		svcName   string
-		svcPort   int32
+		svcPort   intstr.IntOrString
 		healthMon IngressHealthMonitor
 		assigned  bool
 	}
@@ -0,0 +1,135 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Timeout (in seconds) of persistence records, the default session timeout
+// of Java servlet containers
+const defaultUniversalPersistenceTimeout = 1800
+
+// Universal persistence profile the persistence iRule records sessions in
+const universalPersistenceProfile = "/Common/universal"
+
+// Parse the universal persistence annotation, "cookie:<name>" or
+// "header:<name>", into the type and name of the session identifier
+func parseUniversalPersistence(val string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(val), ":", 2)
+	if 2 != len(parts) {
+		return "", "", fmt.Errorf("must be cookie:<name> or header:<name>")
+	}
+	kind := strings.ToLower(strings.TrimSpace(parts[0]))
+	name := strings.TrimSpace(parts[1])
+	if "cookie" != kind && "header" != kind {
+		return "", "", fmt.Errorf("'%s' is not cookie or header", parts[0])
+	}
+	if "" == name || strings.ContainsAny(name, " \t;:\"") {
+		return "", "", fmt.Errorf("'%s' is not a %s name", name, kind)
+	}
+	return kind, name, nil
+}
+
+// Parse the timeout annotation of universal persistence, in seconds
+func parseUniversalPersistenceTimeout(val string) (int, error) {
+	timeout, err := strconv.Atoi(strings.TrimSpace(val))
+	if nil != err {
+		return 0, err
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("must be greater than zero")
+	}
+	return timeout, nil
+}
+
+// Requests carrying the session identifier of a virtual server, such as the
+// JSESSIONID cookie, stick to the pool member that issued it. The
+// identifier is looked up by the universal persistence iRule in its data
+// group, which is filled from the MetaData when the config is written, and
+// recorded in the universal persistence profile.
+func setVirtualUniversalPersistence(
+	cfg *ResourceConfig,
+	annotations map[string]string,
+	resourceName string,
+	partition string,
+) {
+	cfg.MetaData.UniversalPersistence = ""
+	cfg.Virtual.Persist = nil
+	val, ok := annotations[universalPersistenceAnnotation]
+	if !ok {
+		if _, ok := annotations[universalPersistenceTimeoutAnnotation]; ok {
+			log.Warningf("Annotation %v on '%v' is ignored without %v",
+				universalPersistenceTimeoutAnnotation, resourceName,
+				universalPersistenceAnnotation)
+		}
+		return
+	}
+	if "none" == strings.TrimSpace(val) {
+		persist := ""
+		cfg.Virtual.Persist = &persist
+		return
+	}
+	kind, name, err := parseUniversalPersistence(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, universalPersistenceAnnotation, resourceName, err)
+		return
+	}
+	timeout := defaultUniversalPersistenceTimeout
+	if timeoutVal, ok := annotations[universalPersistenceTimeoutAnnotation]; ok {
+		timeout, err = parseUniversalPersistenceTimeout(timeoutVal)
+		if nil != err {
+			log.Warningf("Invalid value '%v' for annotation %v on '%v', "+
+				"using %d: %v", timeoutVal,
+				universalPersistenceTimeoutAnnotation, resourceName,
+				defaultUniversalPersistenceTimeout, err)
+			timeout = defaultUniversalPersistenceTimeout
+		}
+	}
+	if strings.ToLower(cfg.Virtual.Mode) != "http" {
+		log.Warningf("Annotation %v on '%v' is ignored, it requires an "+
+			"http virtual server", universalPersistenceAnnotation,
+			resourceName)
+		return
+	}
+	cfg.MetaData.UniversalPersistence = fmt.Sprintf("%s %s %d",
+		kind, name, timeout)
+	persist := universalPersistenceProfile
+	cfg.Virtual.Persist = &persist
+	cfg.Virtual.AddIRule(fmt.Sprintf("/%s/%s", partition,
+		universalPersistenceIRuleName))
+}
+
+// Add the session identifier of a virtual server to the data group of the
+// universal persistence iRule. Records are keyed by the full path of the
+// virtual server and hold the type, name and timeout of the identifier.
+func addUniversalPersistenceRecords(
+	dg *InternalDataGroup,
+	cfg *ResourceConfig,
+) {
+	if "" == cfg.MetaData.UniversalPersistence {
+		return
+	}
+	vsPath := fmt.Sprintf("/%s/%s", cfg.Virtual.Partition,
+		cfg.Virtual.VirtualServerName)
+	dg.AddOrUpdateRecord(vsPath, cfg.MetaData.UniversalPersistence)
+}
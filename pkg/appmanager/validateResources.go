@@ -17,11 +17,39 @@
 package appmanager
 
 import (
+	"strconv"
+
 	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/pkg/api/v1"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 )
 
+// Informers deliver every object again as an update on each resync. The
+// resourceVersion of an object changes whenever it is modified, so an update
+// with the same version is a resync and the object needs no sync.
+func resourceChanged(old, cur interface{}) bool {
+	oldMeta, err := meta.Accessor(old)
+	if nil != err {
+		return true
+	}
+	curMeta, err := meta.Accessor(cur)
+	if nil != err {
+		return true
+	}
+	version := curMeta.GetResourceVersion()
+	return "" == version || oldMeta.GetResourceVersion() != version
+}
+
+// Informer update handler that only enqueues objects which changed
+func skipResync(enqueue func(interface{})) func(old, cur interface{}) {
+	return func(old, cur interface{}) {
+		if resourceChanged(old, cur) {
+			enqueue(cur)
+		}
+	}
+}
+
 func (appMgr *Manager) checkValidConfigMap(
 	obj interface{},
 ) (bool, []*serviceQueueKey) {
@@ -34,23 +62,54 @@ func (appMgr *Manager) checkValidConfigMap(
 		// Not watching this namespace
 		return false, nil
 	}
-	cfg, err := parseConfigMap(cm)
-	if nil != err {
-		if handleConfigMapParseFailure(appMgr, cm, cfg, err) {
-			// resources is updated if true is returned, write out the config.
-			appMgr.outputConfig()
+	// Each virtual server definition of the ConfigMap is handled on its own
+	services := make(map[string]bool)
+	var updated bool
+	for _, def := range parseConfigMapDefinitions(cm) {
+		if nil != def.Err {
+			updated = handleConfigMapParseFailure(appMgr, cm, def.Key,
+				def.Cfg, def.Err) || updated
+			continue
 		}
-		return false, nil
+		services[def.Cfg.Pools[0].ServiceName] = true
 	}
-	key := &serviceQueueKey{
-		ServiceName: cfg.Pools[0].ServiceName,
-		Namespace:   namespace,
+	if updated {
+		// resources is updated if true is returned, write out the config.
+		appMgr.outputConfig()
+	}
+	// Services of the definitions removed from the ConfigMap, or whose
+	// service changed, are synced to remove their virtual servers
+	for _, name := range appMgr.configMapServices(cm) {
+		services[name] = true
+	}
+	if 0 == len(services) {
+		return false, nil
 	}
 	var keyList []*serviceQueueKey
-	keyList = append(keyList, key)
+	for name := range services {
+		keyList = append(keyList, &serviceQueueKey{
+			ServiceName: name,
+			Namespace:   namespace,
+		})
+	}
 	return true, keyList
 }
 
+// Services of the virtual servers of the definitions of a ConfigMap
+func (appMgr *Manager) configMapServices(cm *v1.ConfigMap) []string {
+	cmName := cm.ObjectMeta.Namespace + "/" + cm.ObjectMeta.Name
+	appMgr.resources.Lock()
+	defer appMgr.resources.Unlock()
+	var services []string
+	appMgr.resources.ForEach(func(key serviceKey, cfg *ResourceConfig) {
+		if "configmap" == cfg.MetaData.ResourceType &&
+			cmName == cfg.MetaData.ResourceName {
+			services = append(services, key.ServiceName)
+		}
+	})
+	return services
+}
+
 func (appMgr *Manager) checkValidService(
 	obj interface{},
 ) (bool, []*serviceQueueKey) {
@@ -71,17 +130,34 @@ func (appMgr *Manager) checkValidService(
 	return true, keyList
 }
 
+// Whether a Service is annotated to be ignored. Ignored Services, such as
+// high-churn monitoring agents, never trigger syncs nor get pool members,
+// even when a resource references them.
+func isIgnoredService(svc *v1.Service) bool {
+	val, ok := svc.ObjectMeta.Annotations[serviceIgnoreAnnotation]
+	if !ok {
+		return false
+	}
+	ignore, err := strconv.ParseBool(val)
+	return nil == err && ignore
+}
+
 func (appMgr *Manager) checkValidEndpoints(
 	obj interface{},
 ) (bool, []*serviceQueueKey) {
 	eps := obj.(*v1.Endpoints)
 	namespace := eps.ObjectMeta.Namespace
 	// Check if the service to see if we care about it.
-	_, ok := appMgr.getNamespaceInformer(namespace)
+	appInf, ok := appMgr.getNamespaceInformer(namespace)
 	if !ok {
 		// Not watching this namespace
 		return false, nil
 	}
+	svcObj, found, _ := appInf.svcInformer.GetIndexer().GetByKey(
+		namespace + "/" + eps.ObjectMeta.Name)
+	if found && isIgnoredService(svcObj.(*v1.Service)) {
+		return false, nil
+	}
 	key := &serviceQueueKey{
 		ServiceName: eps.ObjectMeta.Name,
 		Namespace:   namespace,
@@ -101,19 +177,24 @@ func (appMgr *Manager) checkValidIngress(
 		// Not watching this namespace
 		return false, nil
 	}
+	ing = appMgr.ingressWithDefaults(ing)
 	var allKeys []*serviceQueueKey
 	appMgr.resources.Lock()
 	defer appMgr.resources.Unlock()
 	for _, portStruct := range appMgr.virtualPorts(ing) {
 		var keyList []*serviceQueueKey
-		rsCfg := createRSConfigFromIngress(ing, namespace,
-			appInf.svcInformer.GetIndexer(), portStruct)
-		rsName := rsCfg.Virtual.VirtualServerName
+		rsCfg := createRSConfigFromIngress(ing, namespace, appMgr.crossNsRefs,
+			appMgr.ingressServiceIndexer(appInf), portStruct)
+		rsName := formatIngressVSName(ing, portStruct.protocol)
 		if rsCfg == nil {
 			if nil == ing.Spec.Rules { //single-service
 				serviceName := ing.Spec.Backend.ServiceName
-				servicePort := ing.Spec.Backend.ServicePort.IntVal
-				sKey := serviceKey{serviceName, servicePort, ing.ObjectMeta.Namespace}
+				svcNs := backendNamespace(
+					appMgr.crossNsRefs.ingressServiceNamespaces(ing),
+					namespace, serviceName)
+				servicePort := getIngressBackendPort(svcNs, *ing.Spec.Backend,
+					appMgr.ingressServiceIndexer(appInf))
+				sKey := serviceKey{serviceName, servicePort, svcNs}
 				if _, ok := appMgr.resources.Get(sKey, rsName); ok {
 					appMgr.resources.Delete(sKey, rsName)
 				}
@@ -123,14 +204,26 @@ func (appMgr *Manager) checkValidIngress(
 					appMgr.resources.Delete(key, rsName)
 				}
 			}
-			appMgr.outputConfig()
+			appMgr.outputConfigLocked()
 			return false, nil
 		}
 
 		for _, pool := range rsCfg.Pools {
+			// Several pools may reference different ports of one service
+			var keyFound bool
+			for _, k := range keyList {
+				if k.ServiceName == pool.ServiceName &&
+					k.Namespace == pool.serviceNamespace(namespace) {
+					keyFound = true
+					break
+				}
+			}
+			if keyFound {
+				continue
+			}
 			key := &serviceQueueKey{
 				ServiceName: pool.ServiceName,
-				Namespace:   namespace,
+				Namespace:   pool.serviceNamespace(namespace),
 			}
 			keyList = append(keyList, key)
 		}
@@ -138,11 +231,12 @@ func (appMgr *Manager) checkValidIngress(
 		// being used; if so, delete the config for that key
 		_, keys := appMgr.resources.GetAllWithName(rsName)
 		found := false
-		if len(keys) > len(keyList) {
+		if len(keys) > len(rsCfg.Pools) {
 			for _, key := range keys {
-				for _, sKey := range keyList {
-					if sKey.ServiceName == key.ServiceName &&
-						sKey.Namespace == key.Namespace {
+				for _, pool := range rsCfg.Pools {
+					if pool.ServiceName == key.ServiceName &&
+						pool.ServicePort == key.ServicePort &&
+						pool.serviceNamespace(namespace) == key.Namespace {
 						found = true
 						break
 					}
@@ -0,0 +1,333 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package appmanager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// Key of the reserved addresses in the VIP tombstone ConfigMap
+const vipTombstonesKey = "tombstones.json"
+
+// Parse the preserve VIP annotation, the time the address of a deleted
+// Ingress or Route stays reserved
+func parsePreserveVIP(val string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(strings.TrimSpace(val))
+	if nil != err {
+		return 0, err
+	}
+	if ttl <= 0 {
+		return 0, fmt.Errorf("must be greater than zero")
+	}
+	return ttl, nil
+}
+
+// Address of a deleted Ingress or Route, reserved until it expires
+type vipTombstone struct {
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Addr      string    `json:"address"`
+	Hosts     []string  `json:"hosts,omitempty"`
+	Expires   time.Time `json:"expires"`
+}
+
+func tombstoneKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+func (entry vipTombstone) String() string {
+	return fmt.Sprintf("%s '%s/%s'", entry.Kind, entry.Namespace, entry.Name)
+}
+
+// Addresses of deleted Ingresses and Routes with the preserve VIP
+// annotation, by kind, namespace and name. While reserved, the address is
+// given back to an Ingress re-created with the same name and no address of
+// its own, other Ingresses cannot use it, and the host names of the deleted
+// resource keep being published to DNS. Expired entries are dropped when
+// the list is read. The saved function, if set, is called when the entries
+// change, to persist them.
+type vipTombstones struct {
+	mutex   sync.Mutex
+	entries map[string]vipTombstone
+	saved   func()
+}
+
+func newVIPTombstones() *vipTombstones {
+	return &vipTombstones{entries: make(map[string]vipTombstone)}
+}
+
+func (t *vipTombstones) changedLocked() {
+	if nil != t.saved {
+		t.saved()
+	}
+}
+
+func (t *vipTombstones) pruneLocked() {
+	now := time.Now()
+	pruned := false
+	for key, entry := range t.entries {
+		if now.After(entry.Expires) {
+			log.Infof("Releasing address %v of deleted %v", entry.Addr, entry)
+			delete(t.entries, key)
+			pruned = true
+		}
+	}
+	if pruned {
+		t.changedLocked()
+	}
+}
+
+// Reserve the address of a deleted resource for ttl
+func (t *vipTombstones) add(
+	kind, namespace, name string,
+	addr string,
+	hosts []string,
+	ttl time.Duration,
+) {
+	entry := vipTombstone{
+		Kind:      kind,
+		Namespace: namespace,
+		Name:      name,
+		Addr:      addr,
+		Hosts:     hosts,
+		Expires:   time.Now().Add(ttl),
+	}
+	log.Infof("Reserving address %v of deleted %v for %v", addr, entry, ttl)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.entries[tombstoneKey(kind, namespace, name)] = entry
+	t.changedLocked()
+}
+
+// Address reserved for a resource, empty if none
+func (t *vipTombstones) reserved(kind, namespace, name string) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pruneLocked()
+	return t.entries[tombstoneKey(kind, namespace, name)].Addr
+}
+
+// Drop the reservation of a re-created resource that has an address of its
+// own again
+func (t *vipTombstones) release(kind, namespace, name string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	key := tombstoneKey(kind, namespace, name)
+	if _, ok := t.entries[key]; ok {
+		delete(t.entries, key)
+		t.changedLocked()
+	}
+}
+
+// Deleted resource holding a reserved address. Returns false if the
+// address is free or reserved for the Ingress itself.
+func (t *vipTombstones) reservedFor(
+	addr string,
+	namespace, name string,
+) (vipTombstone, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pruneLocked()
+	self := tombstoneKey(ingressKind, namespace, name)
+	for key, entry := range t.entries {
+		if entry.Addr == addr && key != self {
+			return entry, true
+		}
+	}
+	return vipTombstone{}, false
+}
+
+// Keep publishing the host names of deleted resources that are not served
+// by another virtual server
+func (t *vipTombstones) addDNSRecords(records map[string]string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pruneLocked()
+	for _, entry := range t.entries {
+		for _, host := range entry.Hosts {
+			if _, found := records[host]; !found {
+				records[host] = entry.Addr
+			}
+		}
+	}
+}
+
+// The reservations as JSON, in order of key
+func (t *vipTombstones) marshal() (string, error) {
+	t.mutex.Lock()
+	keys := make([]string, 0, len(t.entries))
+	for key := range t.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	entries := make([]vipTombstone, 0, len(keys))
+	for _, key := range keys {
+		entries = append(entries, t.entries[key])
+	}
+	t.mutex.Unlock()
+	data, err := json.MarshalIndent(entries, "", "  ")
+	return string(data), err
+}
+
+// Restore saved reservations, dropping those that expired meanwhile
+func (t *vipTombstones) unmarshal(data string) error {
+	var entries []vipTombstone
+	if err := json.Unmarshal([]byte(data), &entries); nil != err {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, entry := range entries {
+		t.entries[tombstoneKey(entry.Kind, entry.Namespace, entry.Name)] =
+			entry
+	}
+	t.pruneLocked()
+	return nil
+}
+
+// Reserve the address of a deleted resource if it has the preserve VIP
+// annotation, directly or from its namespace
+func (appMgr *Manager) preserveVIP(
+	kind, namespace, name string,
+	resourceAnnotations map[string]string,
+	addr string,
+	hosts []string,
+) {
+	annotations := appMgr.withNamespaceDefaults(namespace, resourceAnnotations)
+	val, ok := annotations[preserveVIPAnnotation]
+	if !ok || "" == addr {
+		return
+	}
+	ttl, err := parsePreserveVIP(val)
+	if nil != err {
+		log.Warningf("Invalid value '%v' for annotation %v on '%v': %v",
+			val, preserveVIPAnnotation, name, err)
+		return
+	}
+	appMgr.vipTombstones.add(kind, namespace, name, addr, hosts, ttl)
+}
+
+// Reserve the address of a deleted Ingress, see preserveVIP
+func (appMgr *Manager) preserveIngressVIP(ing *v1beta1.Ingress, addr string) {
+	var hosts []string
+	for _, rule := range ing.Spec.Rules {
+		if "" != rule.Host {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	appMgr.preserveVIP(ingressKind, ing.ObjectMeta.Namespace,
+		ing.ObjectMeta.Name, ing.ObjectMeta.Annotations, addr, hosts)
+}
+
+// Reserve the address of the virtual servers of a deleted Route, see
+// preserveVIP. The address is shared by the Routes, so only other
+// Ingresses are kept from it, and the host of the Route stays published.
+func (appMgr *Manager) preserveRouteVIP(route *routeapi.Route) {
+	var hosts []string
+	if "" != route.Spec.Host {
+		hosts = append(hosts, route.Spec.Host)
+	}
+	appMgr.preserveVIP(routeKind, route.ObjectMeta.Namespace,
+		route.ObjectMeta.Name, route.ObjectMeta.Annotations,
+		appMgr.routeConfig.RouteVSAddr, hosts)
+}
+
+// Give the reserved address back to a re-created Ingress without an address
+// of its own. The reservation is dropped once it has one.
+func (appMgr *Manager) setReservedBindAddr(
+	rsCfg *ResourceConfig,
+	ing *v1beta1.Ingress,
+) {
+	namespace := ing.ObjectMeta.Namespace
+	name := ing.ObjectMeta.Name
+	if "" != rsCfg.Virtual.VirtualAddress.BindAddr {
+		appMgr.vipTombstones.release(ingressKind, namespace, name)
+		return
+	}
+	addr := appMgr.vipTombstones.reserved(ingressKind, namespace, name)
+	if "" != addr {
+		log.Infof("Using the reserved address %v of deleted Ingress '%v/%v'",
+			addr, namespace, name)
+		rsCfg.Virtual.VirtualAddress.BindAddr = addr
+	}
+}
+
+// Persist the reservations to the VIP tombstone ConfigMap, if set, when
+// they change
+func (appMgr *Manager) persistVIPTombstones() {
+	if "" == appMgr.vipTombstoneConfigMap {
+		return
+	}
+	appMgr.vipTombstones.saved = func() {
+		appMgr.statusQueue.Add(vipTombstonesUpdate{})
+	}
+}
+
+// Restore the reservations saved in the VIP tombstone ConfigMap before a
+// restart
+func (appMgr *Manager) loadVIPTombstones() {
+	if "" == appMgr.vipTombstoneConfigMap {
+		return
+	}
+	parts := strings.SplitN(appMgr.vipTombstoneConfigMap, "/", 2)
+	if 2 != len(parts) {
+		log.Warningf("Invalid VIP tombstone ConfigMap '%v'",
+			appMgr.vipTombstoneConfigMap)
+		return
+	}
+	cm, err := appMgr.kubeClient.Core().ConfigMaps(parts[0]).
+		Get(parts[1], metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return
+	}
+	if nil != err {
+		log.Warningf("Unable to read the reserved addresses from ConfigMap "+
+			"'%v': %v", appMgr.vipTombstoneConfigMap, err)
+		return
+	}
+	data, ok := cm.Data[vipTombstonesKey]
+	if !ok {
+		return
+	}
+	if err := appMgr.vipTombstones.unmarshal(data); nil != err {
+		log.Warningf("Invalid reserved addresses in ConfigMap '%v': %v",
+			appMgr.vipTombstoneConfigMap, err)
+	}
+}
+
+// Write the current reservations to the VIP tombstone ConfigMap
+func (appMgr *Manager) writeVIPTombstonesNow() error {
+	data, err := appMgr.vipTombstones.marshal()
+	if nil != err {
+		return err
+	}
+	return appMgr.writeConfigMapData(appMgr.vipTombstoneConfigMap,
+		vipTombstonesKey, data)
+}
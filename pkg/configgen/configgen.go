@@ -0,0 +1,91 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package configgen generates the BIG-IP configuration of ConfigMaps,
+// Ingresses and Routes the way the controller does, for tools working on
+// manifests rather than on a cluster, such as linters or an operator. The
+// objects are passed in; no informers or Kubernetes clients are used.
+//
+// Each resource yields the appmanager.ResourceConfig of its virtual servers,
+// with the pools, policies and profile references the controller writes.
+// What depends on the state of a cluster is left out: the members of the
+// pools, the health monitors of Ingresses, the SSL profiles created from
+// Secrets, and the annotations of Namespaces. Set the namespace defaults on
+// the resources themselves to take them into account.
+//
+// A Generator only reads the partitions of its Options, so any number of
+// them can run concurrently, alongside the controller.
+package configgen
+
+import (
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/appmanager"
+
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// Settings of the generation, matching the flags of the controller
+type Options struct {
+	// Partitions resources may use (--bigip-partition)
+	Partitions []string
+	// Partition of the resources that do not set one
+	// (--bigip-default-partition), the first of Partitions if empty
+	DefaultPartition string
+	// Address and certificates of the Route virtual servers
+	RouteConfig appmanager.RouteConfig
+}
+
+type Generator struct {
+	opts       Options
+	partitions appmanager.Partitions
+}
+
+func NewGenerator(opts Options) *Generator {
+	if "" == opts.DefaultPartition && len(opts.Partitions) > 0 {
+		opts.DefaultPartition = opts.Partitions[0]
+	}
+	return &Generator{
+		opts: opts,
+		partitions: appmanager.Partitions{
+			Default: opts.DefaultPartition,
+			Managed: opts.Partitions,
+		},
+	}
+}
+
+// Generate the config of a ConfigMap. Returns an error if the ConfigMap is
+// not valid against its schema or uses a partition that is not managed.
+func (g *Generator) ConfigMap(cm *v1.ConfigMap) (*appmanager.ResourceConfig, error) {
+	return appmanager.ConfigMapConfig(g.partitions, cm)
+}
+
+// Generate the configs of an Ingress, one per virtual server. Services
+// referenced by a named port must be passed to resolve it, pools of other
+// backends with a named port get port 0. Returns nil for Ingresses of
+// another class than f5.
+func (g *Generator) Ingress(
+	ing *v1beta1.Ingress,
+	services ...*v1.Service,
+) []*appmanager.ResourceConfig {
+	return appmanager.IngressConfigs(g.partitions, ing, services)
+}
+
+// Generate the configs of a Route, one per virtual server, holding only
+// the rules and profiles of this Route
+func (g *Generator) Route(route *routeapi.Route) ([]*appmanager.ResourceConfig, error) {
+	return appmanager.RouteConfigs(g.partitions, route, g.opts.RouteConfig)
+}
@@ -0,0 +1,13 @@
+package configgen_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestConfiggen(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Configgen Suite")
+}
@@ -0,0 +1,134 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package configgen_test
+
+import (
+	"os"
+
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/appmanager"
+	. "github.com/F5Networks/k8s-bigip-ctlr/pkg/configgen"
+	"github.com/F5Networks/k8s-bigip-ctlr/pkg/test"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	routeapi "github.com/openshift/origin/pkg/route/api"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+var _ = Describe("Config generation", func() {
+	var gen *Generator
+	BeforeEach(func() {
+		gen = NewGenerator(Options{
+			Partitions: []string{"velcro", "tenant"},
+			RouteConfig: appmanager.RouteConfig{
+				RouteVSAddr: "10.1.1.1",
+			},
+		})
+	})
+
+	It("generates the config of ConfigMaps", func() {
+		workingDir, _ := os.Getwd()
+		schemaUrl := "file://" + workingDir +
+			"/../../schemas/bigip-virtual-server_v0.1.12.json"
+		data := `{
+			"virtualServer": {
+			  "backend": {"serviceName": "foo", "servicePort": 80},
+			  "frontend": {
+			    "partition": "tenant",
+			    "mode": "http",
+			    "virtualAddress": {"bindAddr": "10.2.2.2", "port": 80}
+			  }
+			}
+		}`
+		cm := test.NewConfigMap("foomap", "1", "default", map[string]string{
+			"schema": schemaUrl,
+			"data":   data,
+		})
+		cfg, err := gen.ConfigMap(cm)
+		Expect(err).To(BeNil())
+		Expect(cfg.Virtual.VirtualServerName).To(Equal("default_foomap"))
+		Expect(cfg.Virtual.Partition).To(Equal("tenant"))
+		Expect(cfg.Pools).To(HaveLen(1))
+		Expect(cfg.Pools[0].ServiceName).To(Equal("foo"))
+
+		// Partitions that are not managed are refused
+		gen = NewGenerator(Options{Partitions: []string{"velcro"}})
+		_, err = gen.ConfigMap(cm)
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("generates the configs of Ingresses", func() {
+		spec := v1beta1.IngressSpec{
+			TLS: []v1beta1.IngressTLS{{SecretName: "/Common/clientssl"}},
+			Backend: &v1beta1.IngressBackend{
+				ServiceName: "foo",
+				ServicePort: intstr.FromString("web"),
+			},
+		}
+		ing := test.NewIngress("ing", "1", "default", spec, map[string]string{
+			"virtual-server.f5.com/ip": "10.3.3.3",
+		})
+		svc := test.NewService("foo", "1", "default", "ClusterIP",
+			[]v1.ServicePort{{Name: "web", Port: 8080}})
+
+		// TLS Ingresses redirect HTTP, with a virtual server for each
+		cfgs := gen.Ingress(ing, svc)
+		Expect(cfgs).To(HaveLen(2))
+		Expect(cfgs[0].Virtual.VirtualServerName).To(
+			Equal("default_ing-ingress_http"))
+		Expect(cfgs[1].Virtual.VirtualServerName).To(
+			Equal("default_ing-ingress_https"))
+		for _, cfg := range cfgs {
+			Expect(cfg.Virtual.Partition).To(Equal("velcro"))
+			Expect(cfg.Pools).To(HaveLen(1))
+			Expect(cfg.Pools[0].ServicePort).To(Equal(int32(8080)))
+		}
+
+		// Named ports of services not passed are not resolved
+		cfgs = gen.Ingress(ing)
+		Expect(cfgs).To(HaveLen(2))
+		Expect(cfgs[0].Pools[0].ServicePort).To(Equal(int32(0)))
+
+		// Ingresses of other classes have no config
+		ing.ObjectMeta.Annotations["kubernetes.io/ingress.class"] = "nginx"
+		Expect(gen.Ingress(ing, svc)).To(BeNil())
+	})
+
+	It("generates the configs of Routes", func() {
+		route := test.NewRoute("route", "1", "default", routeapi.RouteSpec{
+			Host: "foo.com",
+			Path: "/foo",
+			To: routeapi.RouteTargetReference{
+				Kind: "Service",
+				Name: "foo",
+			},
+		})
+		cfgs, err := gen.Route(route)
+		Expect(err).To(BeNil())
+		Expect(cfgs).To(HaveLen(2))
+		for _, cfg := range cfgs {
+			Expect(cfg.Virtual.Partition).To(Equal("velcro"))
+			Expect(cfg.Virtual.VirtualAddress.BindAddr).To(Equal("10.1.1.1"))
+			Expect(cfg.Pools).To(HaveLen(1))
+			Expect(cfg.Pools[0].ServiceName).To(Equal("foo"))
+		}
+		Expect(cfgs[0].Virtual.VirtualAddress.Port).To(Equal(int32(80)))
+		Expect(cfgs[1].Virtual.VirtualAddress.Port).To(Equal(int32(443)))
+	})
+})
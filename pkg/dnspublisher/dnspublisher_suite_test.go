@@ -0,0 +1,13 @@
+package dnspublisher_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestDnsPublisher(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "DNS Publisher Suite")
+}
@@ -0,0 +1,299 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnspublisher
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default DNS view of Infoblox records
+const DefaultInfobloxView = "default"
+
+// Records requested per page when listing a zone
+const infobloxPageSize = 1000
+
+type InfobloxConfig struct {
+	// WAPI base URL, e.g. https://infoblox.example.com/wapi/v2.5
+	URL         string
+	Username    string
+	Password    string
+	View        string
+	Zone        string
+	SSLInsecure bool
+}
+
+type infobloxProvider struct {
+	config InfobloxConfig
+	client *http.Client
+	// References of the records found by the last listing
+	refsMutex sync.Mutex
+	refs      map[string]infobloxRefs
+}
+
+type infobloxRefs struct {
+	a   string
+	txt string
+}
+
+type infobloxARecord struct {
+	Ref      string `json:"_ref,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Ipv4Addr string `json:"ipv4addr,omitempty"`
+	View     string `json:"view,omitempty"`
+	TTL      int64  `json:"ttl,omitempty"`
+	UseTTL   bool   `json:"use_ttl,omitempty"`
+}
+
+type infobloxTXTRecord struct {
+	Ref    string `json:"_ref,omitempty"`
+	Name   string `json:"name,omitempty"`
+	Text   string `json:"text,omitempty"`
+	View   string `json:"view,omitempty"`
+	TTL    int64  `json:"ttl,omitempty"`
+	UseTTL bool   `json:"use_ttl,omitempty"`
+}
+
+// Page of a WAPI listing, with the id of the next page if there is one
+type infobloxPage struct {
+	Result     json.RawMessage `json:"result"`
+	NextPageID string          `json:"next_page_id"`
+}
+
+func NewInfobloxProvider(config InfobloxConfig) (Provider, error) {
+	if "" == config.URL || "" == config.Username || "" == config.Password {
+		return nil, fmt.Errorf("the Infoblox URL, username and password are required")
+	}
+	if "" == config.Zone {
+		return nil, fmt.Errorf("a zone is required")
+	}
+	if "" == config.View {
+		config.View = DefaultInfobloxView
+	}
+	config.URL = strings.TrimSuffix(config.URL, "/")
+	return &infobloxProvider{
+		config: config,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					InsecureSkipVerify: config.SSLInsecure,
+				},
+			},
+		},
+		refs: make(map[string]infobloxRefs),
+	}, nil
+}
+
+func (ib *infobloxProvider) Records() ([]Endpoint, error) {
+	var aRecords []infobloxARecord
+	err := ib.list("record:a", "name,ipv4addr,ttl", func(data []byte) error {
+		var page []infobloxARecord
+		err := json.Unmarshal(data, &page)
+		aRecords = append(aRecords, page...)
+		return err
+	})
+	if nil != err {
+		return nil, err
+	}
+	var txtRecords []infobloxTXTRecord
+	err = ib.list("record:txt", "name,text", func(data []byte) error {
+		var page []infobloxTXTRecord
+		err := json.Unmarshal(data, &page)
+		txtRecords = append(txtRecords, page...)
+		return err
+	})
+	if nil != err {
+		return nil, err
+	}
+
+	refs := make(map[string]infobloxRefs)
+	owners := make(map[string]string)
+	for _, txt := range txtRecords {
+		if owner := parseOwner(txt.Text); owner != "" {
+			name := normalizeName(txt.Name)
+			owners[name] = owner
+			r := refs[name]
+			r.txt = txt.Ref
+			refs[name] = r
+		}
+	}
+	var endpoints []Endpoint
+	for _, a := range aRecords {
+		name := normalizeName(a.Name)
+		if r := refs[name]; r.a != "" {
+			// Only single address records are managed
+			continue
+		}
+		r := refs[name]
+		r.a = a.Ref
+		refs[name] = r
+		endpoints = append(endpoints, Endpoint{
+			Name:    name,
+			Address: a.Ipv4Addr,
+			Owner:   owners[name],
+			TTL:     a.TTL,
+		})
+	}
+
+	ib.refsMutex.Lock()
+	ib.refs = refs
+	ib.refsMutex.Unlock()
+	return endpoints, nil
+}
+
+// Records are updated one at a time, WAPI has no transactions for them. A
+// failure leaves the remaining changes to the next sync.
+func (ib *infobloxProvider) ApplyChanges(changes Changes) error {
+	ib.refsMutex.Lock()
+	defer ib.refsMutex.Unlock()
+
+	for _, ep := range changes.Create {
+		err := ib.do("POST", "record:a", nil, infobloxARecord{
+			Name:     ep.Name,
+			Ipv4Addr: ep.Address,
+			View:     ib.config.View,
+			TTL:      ep.TTL,
+			UseTTL:   true,
+		}, nil)
+		if nil != err {
+			return err
+		}
+		err = ib.do("POST", "record:txt", nil, infobloxTXTRecord{
+			Name:   ep.Name,
+			Text:   ownerText(ep.Owner),
+			View:   ib.config.View,
+			TTL:    ep.TTL,
+			UseTTL: true,
+		}, nil)
+		if nil != err {
+			return err
+		}
+	}
+	for _, ep := range changes.Update {
+		ref := ib.refs[ep.Name].a
+		if "" == ref {
+			return fmt.Errorf("no Infoblox record found for '%s'", ep.Name)
+		}
+		err := ib.do("PUT", ref, nil, infobloxARecord{
+			Ipv4Addr: ep.Address,
+			TTL:      ep.TTL,
+			UseTTL:   true,
+		}, nil)
+		if nil != err {
+			return err
+		}
+	}
+	for _, ep := range changes.Delete {
+		r := ib.refs[ep.Name]
+		for _, ref := range []string{r.a, r.txt} {
+			if "" == ref {
+				continue
+			}
+			if err := ib.do("DELETE", ref, nil, nil, nil); nil != err {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List the records of a type in the zone, a page at a time so no zone is
+// truncated by the limit of results of a single request. Each page of
+// results is passed to decode.
+func (ib *infobloxProvider) list(
+	object, fields string,
+	decode func([]byte) error,
+) error {
+	query := url.Values{}
+	query.Set("zone", ib.config.Zone)
+	query.Set("view", ib.config.View)
+	query.Set("_return_fields", fields)
+	query.Set("_paging", "1")
+	query.Set("_return_as_object", "1")
+	query.Set("_max_results", strconv.Itoa(infobloxPageSize))
+	for {
+		var page infobloxPage
+		if err := ib.do("GET", object, query, nil, &page); nil != err {
+			return err
+		}
+		if err := decode(page.Result); nil != err {
+			return err
+		}
+		if "" == page.NextPageID {
+			return nil
+		}
+		query.Set("_page_id", page.NextPageID)
+	}
+}
+
+// Send a WAPI request for an object type or reference and decode the JSON
+// response
+func (ib *infobloxProvider) do(
+	method, object string,
+	query url.Values,
+	body interface{},
+	result interface{},
+) error {
+	u := ib.config.URL + "/" + object
+	if 0 != len(query) {
+		u += "?" + query.Encode()
+	}
+	var data []byte
+	if nil != body {
+		var err error
+		data, err = json.Marshal(body)
+		if nil != err {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(data))
+	if nil != err {
+		return err
+	}
+	req.SetBasicAuth(ib.config.Username, ib.config.Password)
+	if nil != body {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := ib.client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	respData, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("infoblox %s %s failed with %s: %s",
+			method, object, resp.Status, strings.TrimSpace(string(respData)))
+	}
+	if nil != result {
+		return json.Unmarshal(respData, result)
+	}
+	return nil
+}
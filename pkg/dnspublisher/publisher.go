@@ -0,0 +1,218 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package dnspublisher publishes the DNS names of active virtual servers.
+// Ownership of each A record is kept in a TXT record of the same name using
+// the format of the external-dns TXT registry, so controllers in several
+// clusters (and external-dns itself) can share a zone. A record is removed
+// when its virtual server becomes inactive, which lets the controller of
+// another cluster take the name over.
+package dnspublisher
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Owner ID used when none is configured
+const DefaultOwnerID = "k8s-bigip-ctlr"
+
+// Default TTL of published records, in seconds
+const DefaultTTL = 30
+
+// How often published records are compared to the zone, also used to retry
+// failed updates
+const resyncInterval = 30 * time.Second
+
+// An A record of the zone, with the owner taken from its TXT record
+type Endpoint struct {
+	Name    string
+	Address string
+	Owner   string
+	TTL     int64
+}
+
+// Changes to the A records of a zone. Providers create, update and delete
+// the TXT record holding the owner along with each A record.
+type Changes struct {
+	Create []Endpoint
+	Update []Endpoint
+	Delete []Endpoint
+}
+
+func (c Changes) empty() bool {
+	return 0 == len(c.Create) && 0 == len(c.Update) && 0 == len(c.Delete)
+}
+
+type Provider interface {
+	Records() ([]Endpoint, error)
+	ApplyChanges(changes Changes) error
+}
+
+type Publisher struct {
+	provider Provider
+	owner    string
+	ttl      int64
+	mutex    sync.Mutex
+	desired  map[string]string
+	updateCh chan struct{}
+}
+
+func NewPublisher(provider Provider, owner string, ttl int64) *Publisher {
+	return &Publisher{
+		provider: provider,
+		owner:    owner,
+		ttl:      ttl,
+		updateCh: make(chan struct{}, 1),
+	}
+}
+
+// Set the names to publish with the address of each. The zone is updated
+// in the background.
+func (p *Publisher) Publish(records map[string]string) {
+	desired := make(map[string]string)
+	for name, addr := range records {
+		desired[normalizeName(name)] = addr
+	}
+	p.mutex.Lock()
+	if nil != p.desired && reflect.DeepEqual(p.desired, desired) {
+		p.mutex.Unlock()
+		return
+	}
+	p.desired = desired
+	p.mutex.Unlock()
+
+	select {
+	case p.updateCh <- struct{}{}:
+	default:
+		// An update is already pending
+	}
+}
+
+// Update the zone whenever the published names change, and periodically
+// to retry failures and correct changes made by others.
+func (p *Publisher) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(resyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-p.updateCh:
+		case <-ticker.C:
+		}
+		if err := p.Sync(); nil != err {
+			log.Warningf("Failed to publish DNS records: %v", err)
+		}
+	}
+}
+
+// Apply the published names to the zone. Nothing is done until names have
+// been published once, so records are not removed while the controller
+// is starting.
+func (p *Publisher) Sync() error {
+	p.mutex.Lock()
+	desired := p.desired
+	p.mutex.Unlock()
+	if nil == desired {
+		return nil
+	}
+
+	current, err := p.provider.Records()
+	if nil != err {
+		return fmt.Errorf("listing records: %v", err)
+	}
+	changes := p.plan(desired, current)
+	if changes.empty() {
+		return nil
+	}
+	log.Infof("Updating DNS records: %d created, %d updated, %d deleted",
+		len(changes.Create), len(changes.Update), len(changes.Delete))
+	return p.provider.ApplyChanges(changes)
+}
+
+// Compute the changes that make the zone match the published names. Records
+// owned by someone else are never changed.
+func (p *Publisher) plan(desired map[string]string, current []Endpoint) Changes {
+	existing := make(map[string]Endpoint)
+	for _, ep := range current {
+		existing[normalizeName(ep.Name)] = ep
+	}
+
+	var names []string
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var changes Changes
+	for _, name := range names {
+		ep := Endpoint{
+			Name:    name,
+			Address: desired[name],
+			Owner:   p.owner,
+			TTL:     p.ttl,
+		}
+		cur, found := existing[name]
+		if !found {
+			changes.Create = append(changes.Create, ep)
+		} else if cur.Owner != p.owner {
+			log.Debugf("DNS record '%s' is owned by '%s', not publishing it.",
+				name, cur.Owner)
+		} else if cur.Address != ep.Address || cur.TTL != ep.TTL {
+			changes.Update = append(changes.Update, ep)
+		}
+	}
+	for _, ep := range current {
+		if ep.Owner != p.owner {
+			continue
+		}
+		if _, ok := desired[normalizeName(ep.Name)]; !ok {
+			changes.Delete = append(changes.Delete, ep)
+		}
+	}
+	return changes
+}
+
+// Text of the TXT record marking an owner, as written by external-dns
+func ownerText(owner string) string {
+	return fmt.Sprintf("heritage=external-dns,external-dns/owner=%s", owner)
+}
+
+// Owner from the text of a TXT record, empty if it is not a registry record
+func parseOwner(text string) string {
+	text = strings.Trim(text, `"`)
+	fields := strings.Split(text, ",")
+	if fields[0] != "heritage=external-dns" {
+		return ""
+	}
+	for _, field := range fields[1:] {
+		if strings.HasPrefix(field, "external-dns/owner=") {
+			return strings.TrimPrefix(field, "external-dns/owner=")
+		}
+	}
+	return ""
+}
+
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
@@ -0,0 +1,352 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnspublisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type mockProvider struct {
+	mutex   sync.Mutex
+	records map[string]Endpoint
+	applied []Changes
+	err     error
+}
+
+func (m *mockProvider) Records() ([]Endpoint, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if nil != m.err {
+		return nil, m.err
+	}
+	var eps []Endpoint
+	for _, ep := range m.records {
+		eps = append(eps, ep)
+	}
+	return eps, nil
+}
+
+func (m *mockProvider) ApplyChanges(changes Changes) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.applied = append(m.applied, changes)
+	for _, ep := range append(changes.Create, changes.Update...) {
+		m.records[ep.Name] = ep
+	}
+	for _, ep := range changes.Delete {
+		delete(m.records, ep.Name)
+	}
+	return nil
+}
+
+func (m *mockProvider) appliedCount() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return len(m.applied)
+}
+
+var _ = Describe("DNS Publisher Tests", func() {
+	var provider *mockProvider
+	var publisher *Publisher
+	BeforeEach(func() {
+		provider = &mockProvider{
+			records: map[string]Endpoint{
+				"other.example.com": {
+					Name:    "other.example.com",
+					Address: "10.0.0.9",
+					Owner:   "other-cluster",
+					TTL:     30,
+				},
+				"stale.example.com": {
+					Name:    "stale.example.com",
+					Address: "10.0.0.8",
+					Owner:   "cluster-a",
+					TTL:     30,
+				},
+				"manual.example.com": {
+					Name:    "manual.example.com",
+					Address: "10.0.0.7",
+					TTL:     300,
+				},
+			},
+		}
+		publisher = NewPublisher(provider, "cluster-a", 30)
+	})
+
+	It("does nothing until names are published", func() {
+		Expect(publisher.Sync()).To(BeNil())
+		Expect(provider.applied).To(BeEmpty())
+	})
+
+	It("publishes names it owns or that are free", func() {
+		publisher.Publish(map[string]string{
+			"Foo.example.com.":   "10.0.0.1",
+			"other.example.com":  "10.0.0.2",
+			"manual.example.com": "10.0.0.3",
+		})
+		Expect(publisher.Sync()).To(BeNil())
+		Expect(provider.applied).To(HaveLen(1))
+		Expect(provider.applied[0].Create).To(Equal([]Endpoint{{
+			Name:    "foo.example.com",
+			Address: "10.0.0.1",
+			Owner:   "cluster-a",
+			TTL:     30,
+		}}))
+		Expect(provider.applied[0].Update).To(BeEmpty())
+		Expect(provider.applied[0].Delete).To(HaveLen(1))
+		Expect(provider.applied[0].Delete[0].Name).To(Equal("stale.example.com"))
+		Expect(provider.records["other.example.com"].Address).To(Equal("10.0.0.9"))
+		Expect(provider.records["manual.example.com"].Address).To(Equal("10.0.0.7"))
+
+		// Nothing to do once the zone matches
+		Expect(publisher.Sync()).To(BeNil())
+		Expect(provider.applied).To(HaveLen(1))
+
+		publisher.Publish(map[string]string{"foo.example.com": "10.0.0.5"})
+		Expect(publisher.Sync()).To(BeNil())
+		Expect(provider.applied).To(HaveLen(2))
+		Expect(provider.applied[1].Update).To(Equal([]Endpoint{{
+			Name:    "foo.example.com",
+			Address: "10.0.0.5",
+			Owner:   "cluster-a",
+			TTL:     30,
+		}}))
+
+		// Names are removed when their virtual servers are inactive
+		publisher.Publish(map[string]string{})
+		Expect(publisher.Sync()).To(BeNil())
+		Expect(provider.applied[2].Delete).To(HaveLen(1))
+		Expect(provider.records).ToNot(HaveKey("foo.example.com"))
+	})
+
+	It("updates the zone in the background", func() {
+		stopCh := make(chan struct{})
+		defer close(stopCh)
+		go publisher.Run(stopCh)
+		publisher.Publish(map[string]string{"foo.example.com": "10.0.0.1"})
+		Eventually(provider.appliedCount).Should(Equal(1))
+		publisher.Publish(map[string]string{"foo.example.com": "10.0.0.1"})
+		Consistently(provider.appliedCount, "100ms").Should(Equal(1))
+	})
+
+	It("reports provider errors", func() {
+		provider.err = fmt.Errorf("unavailable")
+		publisher.Publish(map[string]string{"foo.example.com": "10.0.0.1"})
+		Expect(publisher.Sync()).To(MatchError(ContainSubstring("unavailable")))
+	})
+
+	It("reads owners from the TXT registry format", func() {
+		text := ownerText("cluster-a")
+		Expect(text).To(Equal("heritage=external-dns,external-dns/owner=cluster-a"))
+		Expect(parseOwner(`"` + text + `"`)).To(Equal("cluster-a"))
+		Expect(parseOwner(text + ",external-dns/resource=ingress/a/b")).To(
+			Equal("cluster-a"))
+		Expect(parseOwner("v=spf1 -all")).To(BeEmpty())
+	})
+
+	It("signs Route53 requests", func() {
+		// get-vanilla from the AWS Signature Version 4 test suite
+		req, err := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+		Expect(err).To(BeNil())
+		now, err := time.Parse("20060102T150405Z", "20150830T123600Z")
+		Expect(err).To(BeNil())
+		signV4(req, nil, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+			"", "us-east-1", "service", now)
+		Expect(req.Header.Get("Authorization")).To(Equal(
+			"AWS4-HMAC-SHA256 " +
+				"Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"))
+	})
+
+	It("manages Route53 record sets", func() {
+		var requests []string
+		var changeBody string
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				Expect(r.Header.Get("Authorization")).To(HavePrefix(
+					"AWS4-HMAC-SHA256 Credential=key/"))
+				requests = append(requests, r.Method+" "+r.URL.String())
+				if r.Method == "POST" {
+					body, _ := ioutil.ReadAll(r.Body)
+					changeBody = string(body)
+					fmt.Fprint(w, `<ChangeResourceRecordSetsResponse/>`)
+					return
+				}
+				if r.URL.Query().Get("name") == "" {
+					fmt.Fprint(w, `<ListResourceRecordSetsResponse>
+<ResourceRecordSets>
+<ResourceRecordSet><Name>foo.example.com.</Name><Type>A</Type><TTL>30</TTL>
+<ResourceRecords><ResourceRecord><Value>10.0.0.1</Value></ResourceRecord></ResourceRecords>
+</ResourceRecordSet>
+</ResourceRecordSets>
+<IsTruncated>true</IsTruncated>
+<NextRecordName>foo.example.com.</NextRecordName><NextRecordType>TXT</NextRecordType>
+</ListResourceRecordSetsResponse>`)
+					return
+				}
+				fmt.Fprint(w, `<ListResourceRecordSetsResponse>
+<ResourceRecordSets>
+<ResourceRecordSet><Name>foo.example.com.</Name><Type>TXT</Type><TTL>30</TTL>
+<ResourceRecords><ResourceRecord><Value>"heritage=external-dns,external-dns/owner=cluster-a"</Value></ResourceRecord></ResourceRecords>
+</ResourceRecordSet>
+</ResourceRecordSets>
+<IsTruncated>false</IsTruncated>
+</ListResourceRecordSetsResponse>`)
+			}))
+		defer server.Close()
+
+		_, err := NewRoute53Provider(Route53Config{ZoneID: "Z1"})
+		Expect(err).ToNot(BeNil())
+		r53, err := NewRoute53Provider(Route53Config{
+			ZoneID:          "/hostedzone/Z1",
+			AccessKeyID:     "key",
+			SecretAccessKey: "secret",
+			Endpoint:        server.URL,
+		})
+		Expect(err).To(BeNil())
+		eps, err := r53.Records()
+		Expect(err).To(BeNil())
+		Expect(eps).To(Equal([]Endpoint{{
+			Name:    "foo.example.com",
+			Address: "10.0.0.1",
+			Owner:   "cluster-a",
+			TTL:     30,
+		}}))
+		Expect(requests).To(Equal([]string{
+			"GET /2013-04-01/hostedzone/Z1/rrset",
+			"GET /2013-04-01/hostedzone/Z1/rrset?name=foo.example.com.&type=TXT",
+		}))
+
+		err = r53.ApplyChanges(Changes{Delete: eps})
+		Expect(err).To(BeNil())
+		Expect(requests[2]).To(Equal("POST /2013-04-01/hostedzone/Z1/rrset/"))
+		Expect(strings.Count(changeBody, "<Action>DELETE</Action>")).To(Equal(2))
+		Expect(changeBody).To(ContainSubstring(
+			`<Value>&#34;heritage=external-dns,external-dns/owner=cluster-a&#34;</Value>`))
+	})
+
+	It("manages Infoblox records", func() {
+		var requests []string
+		var bodies []map[string]interface{}
+		server := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				user, pass, ok := r.BasicAuth()
+				Expect(ok).To(BeTrue())
+				Expect(user + ":" + pass).To(Equal("admin:secret"))
+				requests = append(requests, r.Method+" "+r.URL.Path)
+				if r.Method == "GET" {
+					Expect(r.URL.Query().Get("zone")).To(Equal("example.com"))
+					Expect(r.URL.Query().Get("view")).To(Equal("default"))
+					Expect(r.URL.Query().Get("_paging")).To(Equal("1"))
+					Expect(r.URL.Query().Get("_max_results")).To(Equal("1000"))
+				}
+				switch {
+				case r.Method == "GET" && r.URL.Path == "/wapi/v2.5/record:a":
+					fmt.Fprint(w, `{"result": [{"_ref": "record:a/1",
+						"name": "foo.example.com", "ipv4addr": "10.0.0.1",
+						"ttl": 30}]}`)
+				case r.Method == "GET" && r.URL.Path == "/wapi/v2.5/record:txt":
+					// The records of the zone span two pages
+					if "" == r.URL.Query().Get("_page_id") {
+						fmt.Fprint(w, `{"result": [], "next_page_id": "txt2"}`)
+						return
+					}
+					Expect(r.URL.Query().Get("_page_id")).To(Equal("txt2"))
+					fmt.Fprint(w, `{"result": [{"_ref": "record:txt/1",
+						"name": "foo.example.com",
+						"text": "heritage=external-dns,external-dns/owner=cluster-a"}]}`)
+				default:
+					var body map[string]interface{}
+					json.NewDecoder(r.Body).Decode(&body)
+					bodies = append(bodies, body)
+					fmt.Fprint(w, `"record:a/2"`)
+				}
+			}))
+		defer server.Close()
+
+		_, err := NewInfobloxProvider(InfobloxConfig{URL: server.URL})
+		Expect(err).ToNot(BeNil())
+		ib, err := NewInfobloxProvider(InfobloxConfig{
+			URL:      server.URL + "/wapi/v2.5/",
+			Username: "admin",
+			Password: "secret",
+			Zone:     "example.com",
+		})
+		Expect(err).To(BeNil())
+		eps, err := ib.Records()
+		Expect(err).To(BeNil())
+		Expect(eps).To(Equal([]Endpoint{{
+			Name:    "foo.example.com",
+			Address: "10.0.0.1",
+			Owner:   "cluster-a",
+			TTL:     30,
+		}}))
+
+		err = ib.ApplyChanges(Changes{
+			Create: []Endpoint{{
+				Name:    "bar.example.com",
+				Address: "10.0.0.2",
+				Owner:   "cluster-a",
+				TTL:     30,
+			}},
+			Update: []Endpoint{{
+				Name:    "foo.example.com",
+				Address: "10.0.0.3",
+				Owner:   "cluster-a",
+				TTL:     30,
+			}},
+		})
+		Expect(err).To(BeNil())
+		Expect(requests[:3]).To(Equal([]string{
+			"GET /wapi/v2.5/record:a",
+			"GET /wapi/v2.5/record:txt",
+			"GET /wapi/v2.5/record:txt",
+		}))
+		Expect(requests[3:]).To(Equal([]string{
+			"POST /wapi/v2.5/record:a",
+			"POST /wapi/v2.5/record:txt",
+			"PUT /wapi/v2.5/record:a/1",
+		}))
+		Expect(bodies[0]).To(Equal(map[string]interface{}{
+			"name":     "bar.example.com",
+			"ipv4addr": "10.0.0.2",
+			"view":     "default",
+			"ttl":      float64(30),
+			"use_ttl":  true,
+		}))
+		Expect(bodies[1]["text"]).To(Equal(
+			"heritage=external-dns,external-dns/owner=cluster-a"))
+
+		err = ib.ApplyChanges(Changes{Delete: eps})
+		Expect(err).To(BeNil())
+		Expect(requests[6:]).To(Equal([]string{
+			"DELETE /wapi/v2.5/record:a/1",
+			"DELETE /wapi/v2.5/record:txt/1",
+		}))
+	})
+})
@@ -0,0 +1,297 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dnspublisher
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const route53Endpoint = "https://route53.amazonaws.com"
+const route53Namespace = "https://route53.amazonaws.com/doc/2013-04-01/"
+
+// Route53 is a global service, requests are signed for us-east-1
+const route53Region = "us-east-1"
+
+type Route53Config struct {
+	ZoneID          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Base URL of the API, for testing
+	Endpoint string
+}
+
+type route53Provider struct {
+	config Route53Config
+	client *http.Client
+}
+
+type route53RecordSet struct {
+	Name   string   `xml:"Name"`
+	Type   string   `xml:"Type"`
+	TTL    int64    `xml:"TTL"`
+	Values []string `xml:"ResourceRecords>ResourceRecord>Value"`
+}
+
+type route53ListResponse struct {
+	RecordSets     []route53RecordSet `xml:"ResourceRecordSets>ResourceRecordSet"`
+	IsTruncated    bool               `xml:"IsTruncated"`
+	NextRecordName string             `xml:"NextRecordName"`
+	NextRecordType string             `xml:"NextRecordType"`
+}
+
+type route53Change struct {
+	Action    string           `xml:"Action"`
+	RecordSet route53RecordSet `xml:"ResourceRecordSet"`
+}
+
+type route53ChangeRequest struct {
+	XMLName xml.Name        `xml:"ChangeResourceRecordSetsRequest"`
+	Xmlns   string          `xml:"xmlns,attr"`
+	Comment string          `xml:"ChangeBatch>Comment"`
+	Changes []route53Change `xml:"ChangeBatch>Changes>Change"`
+}
+
+func NewRoute53Provider(config Route53Config) (Provider, error) {
+	if "" == config.ZoneID {
+		return nil, fmt.Errorf("a hosted zone ID is required")
+	}
+	if "" == config.AccessKeyID || "" == config.SecretAccessKey {
+		return nil, fmt.Errorf("AWS credentials are required")
+	}
+	if "" == config.Endpoint {
+		config.Endpoint = route53Endpoint
+	}
+	config.ZoneID = strings.TrimPrefix(config.ZoneID, "/hostedzone/")
+	return &route53Provider{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (r *route53Provider) Records() ([]Endpoint, error) {
+	addrs := make(map[string]route53RecordSet)
+	owners := make(map[string]string)
+	query := url.Values{}
+	for {
+		var resp route53ListResponse
+		err := r.do("GET", "/rrset", query, nil, &resp)
+		if nil != err {
+			return nil, err
+		}
+		for _, rs := range resp.RecordSets {
+			name := normalizeName(rs.Name)
+			switch rs.Type {
+			case "A":
+				if 1 == len(rs.Values) {
+					addrs[name] = rs
+				}
+			case "TXT":
+				for _, value := range rs.Values {
+					if owner := parseOwner(value); owner != "" {
+						owners[name] = owner
+					}
+				}
+			}
+		}
+		if !resp.IsTruncated {
+			break
+		}
+		query.Set("name", resp.NextRecordName)
+		query.Set("type", resp.NextRecordType)
+	}
+
+	var endpoints []Endpoint
+	for name, rs := range addrs {
+		endpoints = append(endpoints, Endpoint{
+			Name:    name,
+			Address: rs.Values[0],
+			Owner:   owners[name],
+			TTL:     rs.TTL,
+		})
+	}
+	return endpoints, nil
+}
+
+func (r *route53Provider) ApplyChanges(changes Changes) error {
+	req := route53ChangeRequest{
+		Xmlns:   route53Namespace,
+		Comment: "Updated by k8s-bigip-ctlr",
+	}
+	add := func(action string, eps []Endpoint) {
+		for _, ep := range eps {
+			req.Changes = append(req.Changes,
+				route53Change{
+					Action: action,
+					RecordSet: route53RecordSet{
+						Name:   ep.Name,
+						Type:   "A",
+						TTL:    ep.TTL,
+						Values: []string{ep.Address},
+					},
+				},
+				route53Change{
+					Action: action,
+					RecordSet: route53RecordSet{
+						Name:   ep.Name,
+						Type:   "TXT",
+						TTL:    ep.TTL,
+						Values: []string{`"` + ownerText(ep.Owner) + `"`},
+					},
+				})
+		}
+	}
+	add("CREATE", changes.Create)
+	add("UPSERT", changes.Update)
+	add("DELETE", changes.Delete)
+
+	body, err := xml.Marshal(req)
+	if nil != err {
+		return err
+	}
+	return r.do("POST", "/rrset/", nil, append([]byte(xml.Header), body...), nil)
+}
+
+// Send a signed request for the hosted zone and decode the XML response
+func (r *route53Provider) do(
+	method, path string,
+	query url.Values,
+	body []byte,
+	result interface{},
+) error {
+	u := fmt.Sprintf("%s/2013-04-01/hostedzone/%s%s",
+		r.config.Endpoint, r.config.ZoneID, path)
+	if 0 != len(query) {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	if nil != body {
+		req.Header.Set("Content-Type", "application/xml")
+	}
+	signV4(req, body, r.config.AccessKeyID, r.config.SecretAccessKey,
+		r.config.SessionToken, route53Region, "route53", time.Now())
+
+	resp, err := r.client.Do(req)
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("route53 %s %s failed with %s: %s",
+			method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if nil != result {
+		return xml.Unmarshal(data, result)
+	}
+	return nil
+}
+
+// Sign a request with AWS Signature Version 4, covering the host and date
+// headers (and the session token if one is used).
+func signV4(
+	req *http.Request,
+	body []byte,
+	accessKey, secretKey, sessionToken, region, service string,
+	now time.Time,
+) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if "" != sessionToken {
+		req.Header.Set("X-Amz-Security-Token", sessionToken)
+	}
+
+	headers := map[string]string{
+		"host":       req.URL.Host,
+		"x-amz-date": amzDate,
+	}
+	if "" != sessionToken {
+		headers["x-amz-security-token"] = sessionToken
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if "" == path {
+		path = "/"
+	}
+	// Query values are encoded with %20 rather than + for spaces
+	query := strings.Replace(req.URL.Query().Encode(), "+", "%20", -1)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		query,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
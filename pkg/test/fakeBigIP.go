@@ -0,0 +1,174 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Kinds of BIG-IP objects in the resources section written by the controller
+const (
+	VirtualServers     = "virtualServers"
+	Pools              = "pools"
+	Monitors           = "monitors"
+	Policies           = "l7Policies"
+	CustomProfiles     = "customProfiles"
+	IRules             = "iRules"
+	InternalDataGroups = "internalDataGroups"
+	IApps              = "iapps"
+)
+
+// BIG-IP object as written by the controller, decoded from its JSON
+type BigIPObject map[string]interface{}
+
+// Objects of a partition, by kind and name
+type BigIPPartition map[string]map[string]BigIPObject
+
+// FakeBigIP is a Writer that keeps the declarative BIG-IP state of the last
+// resources section written to it, the way the python driver would apply it.
+// Every section is kept as written in Sections.
+type FakeBigIP struct {
+	sync.Mutex
+	// Number of sections written
+	Writes int
+	// Error returned by SendSection, nil for success
+	Error    error
+	Sections map[string]interface{}
+	state    map[string]BigIPPartition
+}
+
+func NewFakeBigIP() *FakeBigIP {
+	return &FakeBigIP{
+		Sections: make(map[string]interface{}),
+		state:    make(map[string]BigIPPartition),
+	}
+}
+
+func (fb *FakeBigIP) GetOutputFilename() string {
+	return "fake-bigip"
+}
+
+func (fb *FakeBigIP) Stop() {
+}
+
+func (fb *FakeBigIP) SendSection(
+	name string,
+	obj interface{},
+) (<-chan struct{}, <-chan error, error) {
+	fb.Lock()
+	defer fb.Unlock()
+
+	if nil != fb.Error {
+		return nil, nil, fb.Error
+	}
+	fb.Writes++
+	fb.Sections[name] = obj
+	if "resources" == name {
+		state, err := decodeResources(obj)
+		if nil != err {
+			return nil, nil, err
+		}
+		fb.state = state
+	}
+
+	doneCh := make(chan struct{}, 1)
+	doneCh <- struct{}{}
+	return doneCh, make(chan error), nil
+}
+
+// The resources section is a map of partitions to the lists of each kind
+// of object, as serialized for the python driver.
+func decodeResources(obj interface{}) (map[string]BigIPPartition, error) {
+	output, err := json.Marshal(obj)
+	if nil != err {
+		return nil, err
+	}
+	var sections map[string]map[string][]BigIPObject
+	err = json.Unmarshal(output, &sections)
+	if nil != err {
+		return nil, err
+	}
+	state := make(map[string]BigIPPartition)
+	for partition, kinds := range sections {
+		state[partition] = make(BigIPPartition)
+		for kind, objs := range kinds {
+			byName := make(map[string]BigIPObject)
+			for _, o := range objs {
+				name, ok := o["name"].(string)
+				if !ok {
+					return nil, fmt.Errorf(
+						"%s object without a name in partition %s", kind, partition)
+				}
+				byName[name] = o
+			}
+			state[partition][kind] = byName
+		}
+	}
+	return state, nil
+}
+
+// Partitions with objects in the current state, sorted
+func (fb *FakeBigIP) Partitions() []string {
+	fb.Lock()
+	defer fb.Unlock()
+	var partitions []string
+	for partition := range fb.state {
+		partitions = append(partitions, partition)
+	}
+	sort.Strings(partitions)
+	return partitions
+}
+
+// Names of the objects of a kind in a partition, sorted
+func (fb *FakeBigIP) Names(partition, kind string) []string {
+	fb.Lock()
+	defer fb.Unlock()
+	var names []string
+	for name, _ := range fb.state[partition][kind] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get an object of a kind by partition and name
+func (fb *FakeBigIP) Get(partition, kind, name string) (BigIPObject, bool) {
+	fb.Lock()
+	defer fb.Unlock()
+	obj, ok := fb.state[partition][kind][name]
+	return obj, ok
+}
+
+// Members of a pool as "address:port", sorted
+func (fb *FakeBigIP) PoolMembers(partition, pool string) []string {
+	obj, ok := fb.Get(partition, Pools, pool)
+	if !ok {
+		return nil
+	}
+	members, _ := obj["members"].([]interface{})
+	var addrs []string
+	for _, m := range members {
+		member, _ := m.(map[string]interface{})
+		addrs = append(addrs, fmt.Sprintf("%v:%v",
+			member["address"], member["port"]))
+	}
+	sort.Strings(addrs)
+	return addrs
+}
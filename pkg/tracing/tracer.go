@@ -0,0 +1,355 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package tracing records spans and exports them to an OpenTelemetry
+// collector with the OTLP/HTTP protocol, using its JSON encoding. Only what
+// the controller needs is implemented: spans with string and integer
+// attributes, an error status, and batched export in the background.
+//
+// The OpenTelemetry Go SDK is not used: it needs a far newer Go release than
+// the one the controller is built with, and it cannot be vendored into this
+// tree. The protocol is stable, so any collector accepting OTLP/HTTP with
+// JSON receives these spans.
+//
+// A nil *Tracer and a nil *Span are valid and do nothing, so callers do not
+// need to check whether tracing is enabled.
+package tracing
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/F5Networks/k8s-bigip-ctlr/pkg/vlogger"
+)
+
+// Service name reported when none is configured
+const DefaultServiceName = "k8s-bigip-ctlr"
+
+// Name of the instrumentation scope of all spans
+const scopeName = "github.com/F5Networks/k8s-bigip-ctlr"
+
+const (
+	// Spans waiting for export; spans ended while the buffer is full are
+	// dropped
+	bufferSize = 2048
+	// Spans sent in a single export request
+	batchSize = 256
+	// Time a span waits for a batch to fill before it is exported
+	flushInterval = 5 * time.Second
+	// Timeout of a single export request
+	exportTimeout = 10 * time.Second
+)
+
+type Config struct {
+	// OTLP/HTTP traces endpoint, e.g. http://otel-collector:4318/v1/traces
+	Endpoint string
+	// Value of the service.name resource attribute
+	ServiceName string
+}
+
+type Tracer struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+	spans       chan *Span
+
+	mutex   sync.Mutex
+	dropped int
+}
+
+func NewTracer(cfg Config) *Tracer {
+	serviceName := cfg.ServiceName
+	if "" == serviceName {
+		serviceName = DefaultServiceName
+	}
+	return &Tracer{
+		endpoint:    cfg.Endpoint,
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: exportTimeout},
+		spans:       make(chan *Span, bufferSize),
+	}
+}
+
+// A timed operation. Spans started with a parent belong to its trace.
+type Span struct {
+	tracer  *Tracer
+	traceID string
+	spanID  string
+	parent  string
+	name    string
+	start   time.Time
+
+	mutex      sync.Mutex
+	end        time.Time
+	attributes map[string]interface{}
+	err        string
+}
+
+// Start a span, in a new trace if parent is nil
+func (t *Tracer) Start(name string, parent *Span) *Span {
+	return t.StartAt(name, parent, time.Now())
+}
+
+// Start a span that began at a time in the past
+func (t *Tracer) StartAt(name string, parent *Span, start time.Time) *Span {
+	if nil == t {
+		return nil
+	}
+	s := &Span{
+		tracer:     t,
+		spanID:     newID(8),
+		name:       name,
+		start:      start,
+		attributes: make(map[string]interface{}),
+	}
+	if nil != parent {
+		s.traceID = parent.traceID
+		s.parent = parent.spanID
+	} else {
+		s.traceID = newID(16)
+	}
+	return s
+}
+
+// Set a string or integer attribute of the span
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if nil == s {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.attributes[key] = value
+}
+
+// Mark the span as failed, a nil error leaves it unchanged
+func (s *Span) SetError(err error) {
+	if nil == s || nil == err {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.err = err.Error()
+}
+
+// End the span and queue it for export. Ending a span more than once has
+// no effect.
+func (s *Span) End() {
+	if nil == s {
+		return
+	}
+	s.mutex.Lock()
+	if !s.end.IsZero() {
+		s.mutex.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mutex.Unlock()
+
+	select {
+	case s.tracer.spans <- s:
+	default:
+		s.tracer.mutex.Lock()
+		s.tracer.dropped++
+		s.tracer.mutex.Unlock()
+	}
+}
+
+// Export the ended spans in batches until stopCh is closed, then export the
+// spans still buffered.
+func (t *Tracer) Run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	for {
+		select {
+		case <-stopCh:
+			for {
+				select {
+				case s := <-t.spans:
+					batch = append(batch, s)
+				default:
+					t.export(batch)
+					return
+				}
+			}
+		case s := <-t.spans:
+			batch = append(batch, s)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		t.export(batch)
+		batch = nil
+	}
+}
+
+func (t *Tracer) export(spans []*Span) {
+	t.mutex.Lock()
+	dropped := t.dropped
+	t.dropped = 0
+	t.mutex.Unlock()
+	if dropped > 0 {
+		log.Warningf("Dropped %d trace spans, the export buffer is full",
+			dropped)
+	}
+	if 0 == len(spans) {
+		return
+	}
+	body, err := json.Marshal(t.encode(spans))
+	if nil != err {
+		log.Warningf("Failed to encode trace spans: %v", err)
+		return
+	}
+	err = t.post(body)
+	if nil != err {
+		log.Warningf("Failed to export %d trace spans to %s: %v",
+			len(spans), t.endpoint, err)
+	}
+}
+
+func (t *Tracer) post(body []byte) error {
+	resp, err := t.client.Post(t.endpoint, "application/json",
+		bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON encoding of an export request
+type (
+	exportRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+	resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	resource struct {
+		Attributes []keyValue `json:"attributes"`
+	}
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	scope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}
+	status struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	anyValue struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+	}
+)
+
+const (
+	spanKindInternal = 1
+	statusCodeError  = 2
+)
+
+func (t *Tracer) encode(spans []*Span) exportRequest {
+	var encoded []otlpSpan
+	for _, s := range spans {
+		s.mutex.Lock()
+		enc := otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parent,
+			Name:              s.name,
+			Kind:              spanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        encodeAttributes(s.attributes),
+		}
+		if "" != s.err {
+			enc.Status = status{Code: statusCodeError, Message: s.err}
+		}
+		s.mutex.Unlock()
+		encoded = append(encoded, enc)
+	}
+	return exportRequest{
+		ResourceSpans: []resourceSpans{{
+			Resource: resource{
+				Attributes: encodeAttributes(map[string]interface{}{
+					"service.name": t.serviceName,
+				}),
+			},
+			ScopeSpans: []scopeSpans{{
+				Scope: scope{Name: scopeName},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func encodeAttributes(attrs map[string]interface{}) []keyValue {
+	var kvs []keyValue
+	for key, val := range attrs {
+		var v anyValue
+		switch val := val.(type) {
+		case int:
+			i := strconv.Itoa(val)
+			v.IntValue = &i
+		case int64:
+			i := strconv.FormatInt(val, 10)
+			v.IntValue = &i
+		case string:
+			v.StringValue = &val
+		default:
+			str := fmt.Sprintf("%v", val)
+			v.StringValue = &str
+		}
+		kvs = append(kvs, keyValue{Key: key, Value: v})
+	}
+	return kvs
+}
+
+// Random ID of n bytes, hex encoded as OTLP/JSON expects
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
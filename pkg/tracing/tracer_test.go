@@ -0,0 +1,122 @@
+/*-
+ * Copyright (c) 2017, F5 Networks, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracer Tests", func() {
+	var server *httptest.Server
+	var mutex sync.Mutex
+	var requests []exportRequest
+
+	BeforeEach(func() {
+		requests = nil
+		server = httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				defer GinkgoRecover()
+				Expect(r.Header.Get("Content-Type")).To(Equal("application/json"))
+				var req exportRequest
+				Expect(json.NewDecoder(r.Body).Decode(&req)).To(Succeed())
+				mutex.Lock()
+				requests = append(requests, req)
+				mutex.Unlock()
+			}))
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	It("does nothing when disabled", func() {
+		var tracer *Tracer
+		span := tracer.Start("sync", nil)
+		Expect(span).To(BeNil())
+		span.SetAttribute("key", "value")
+		span.SetError(fmt.Errorf("failed"))
+		span.End()
+	})
+
+	It("exports the spans of a trace when stopped", func() {
+		tracer := NewTracer(Config{Endpoint: server.URL})
+		root := tracer.Start("pipeline", nil)
+		root.SetAttribute("k8s.namespace", "default")
+		child := tracer.Start("sync", root)
+		child.SetAttribute("vs.updated", 2)
+		child.SetError(fmt.Errorf("failed"))
+		child.End()
+		child.End()
+		root.End()
+		// Spans that are not ended are not exported
+		tracer.Start("open", root)
+
+		stopCh := make(chan struct{})
+		doneCh := make(chan struct{})
+		go func() {
+			tracer.Run(stopCh)
+			close(doneCh)
+		}()
+		close(stopCh)
+		Eventually(doneCh).Should(BeClosed())
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(requests).To(HaveLen(1))
+		rs := requests[0].ResourceSpans
+		Expect(rs).To(HaveLen(1))
+		Expect(rs[0].Resource.Attributes).To(HaveLen(1))
+		Expect(rs[0].Resource.Attributes[0].Key).To(Equal("service.name"))
+		Expect(*rs[0].Resource.Attributes[0].Value.StringValue).To(
+			Equal(DefaultServiceName))
+		spans := rs[0].ScopeSpans[0].Spans
+		Expect(spans).To(HaveLen(2))
+
+		Expect(spans[0].Name).To(Equal("sync"))
+		Expect(spans[0].TraceID).To(HaveLen(32))
+		Expect(spans[0].SpanID).To(HaveLen(16))
+		Expect(spans[0].Status).To(Equal(status{
+			Code: statusCodeError, Message: "failed"}))
+		Expect(spans[0].Attributes).To(HaveLen(1))
+		Expect(*spans[0].Attributes[0].Value.IntValue).To(Equal("2"))
+
+		Expect(spans[1].Name).To(Equal("pipeline"))
+		Expect(spans[1].ParentSpanID).To(BeEmpty())
+		Expect(spans[1].Status).To(Equal(status{}))
+		Expect(spans[0].TraceID).To(Equal(spans[1].TraceID))
+		Expect(spans[0].ParentSpanID).To(Equal(spans[1].SpanID))
+		Expect(spans[1].EndTimeUnixNano >= spans[1].StartTimeUnixNano).To(
+			BeTrue())
+	})
+
+	It("drops spans when the buffer is full", func() {
+		tracer := NewTracer(Config{Endpoint: server.URL, ServiceName: "ctlr"})
+		for i := 0; i < bufferSize+3; i++ {
+			tracer.Start("sync", nil).End()
+		}
+		Expect(tracer.dropped).To(Equal(3))
+		tracer.export(nil)
+		Expect(tracer.dropped).To(Equal(0))
+	})
+})
@@ -17,6 +17,7 @@
 package writer
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -49,6 +50,10 @@ type configWriter struct {
 	stopCh     chan struct{}
 	dataCh     chan configSection
 	sectionMap map[string]interface{}
+	// Indent the written config for readability
+	indent bool
+	// Last config written, identical output is not written again
+	lastOutput []byte
 }
 
 type configSection struct {
@@ -62,6 +67,16 @@ type doneCall func(chan<- struct{})
 type errCall func(chan<- error, error)
 
 func NewConfigWriter() (Writer, error) {
+	return newConfigWriter(false)
+}
+
+// Create a config writer which indents the written config, to ease reading
+// and diffing it. The config is otherwise the same.
+func NewIndentedConfigWriter() (Writer, error) {
+	return newConfigWriter(true)
+}
+
+func newConfigWriter(indent bool) (Writer, error) {
 	dir, err := ioutil.TempDir("", "k8s-bigip-ctlr.config")
 	if nil != err {
 		return nil, fmt.Errorf("could not create unique config directory: %v", err)
@@ -74,6 +89,7 @@ func NewConfigWriter() (Writer, error) {
 		stopCh:     make(chan struct{}),
 		dataCh:     make(chan configSection),
 		sectionMap: make(map[string]interface{}),
+		indent:     indent,
 	}
 
 	go cw.waitData()
@@ -195,6 +211,15 @@ func (cw *configWriter) lockAndWrite(output []byte) (wroteSome bool, err error)
 	return wroteSome, err
 }
 
+// Marshal the sections of the config. The sections, and the keys of the maps
+// they contain, are sorted by the marshaller.
+func (cw *configWriter) marshalSections() ([]byte, error) {
+	if cw.indent {
+		return json.MarshalIndent(cw.sectionMap, "", "  ")
+	}
+	return json.Marshal(cw.sectionMap)
+}
+
 func (cw *configWriter) waitData() {
 	respondDone := func(d chan<- struct{}) {
 		select {
@@ -223,15 +248,24 @@ func (cw *configWriter) waitData() {
 			} else {
 				cw.sectionMap[cs.name] = cs.data
 
-				output, err := json.Marshal(cw.sectionMap)
+				output, err := cw.marshalSections()
 				if nil != err {
 					log.Warningf("ConfigWriter (%p) received marshal error (%s): %v",
 						cw, cs.name, err)
 					go respondErr(cs.errorCh, err)
+					continue
+				}
+				if nil != cw.lastOutput && bytes.Equal(output, cw.lastOutput) {
+					// Rewriting the same config would only touch the file
+					log.Debugf("ConfigWriter (%p) section (%s) unchanged, not "+
+						"rewriting config", cw, cs.name)
+					go respondDone(cs.doneCh)
+					continue
 				}
 
 				wrote, err := cw.lockAndWrite(output)
 				if nil != err {
+					cw.lastOutput = nil
 					if wrote {
 						log.Warningf("ConfigWriter (%p) errored during write of section (%s): %v",
 							cw, cs.name, err)
@@ -241,6 +275,7 @@ func (cw *configWriter) waitData() {
 					}
 					go respondErr(cs.errorCh, err)
 				} else {
+					cw.lastOutput = output
 					log.Debugf("ConfigWriter (%p) successfully wrote section (%s)",
 						cw, cs.name)
 					go respondDone(cs.doneCh)
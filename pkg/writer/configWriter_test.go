@@ -314,6 +314,61 @@ var _ = Describe("Config Writer Tests", func() {
 			Expect(written).To(Equal(expected))
 		})
 
+		It("doesn't rewrite an unchanged config", func() {
+			section := testSection{
+				Field1: "test-field1",
+				Field2: 42,
+			}
+			doneCh, errCh, err := cw.SendSection("unchanged", section)
+			Expect(err).To(BeNil())
+			pollDone(doneCh, errCh)
+
+			// Replace the config so a rewrite can be told apart
+			err = ioutil.WriteFile(f, []byte("untouched"), 0644)
+			Expect(err).To(BeNil())
+
+			doneCh, errCh, err = cw.SendSection("unchanged", section)
+			Expect(err).To(BeNil())
+			pollDone(doneCh, errCh)
+			written, err := ioutil.ReadFile(f)
+			Expect(err).To(BeNil())
+			Expect(string(written)).To(Equal("untouched"))
+
+			section.Field2 = 43
+			doneCh, errCh, err = cw.SendSection("unchanged", section)
+			Expect(err).To(BeNil())
+			pollDone(doneCh, errCh)
+			expected, err := json.Marshal(map[string]testSection{
+				"unchanged": section,
+			})
+			Expect(err).To(BeNil())
+			written, err = ioutil.ReadFile(f)
+			Expect(err).To(BeNil())
+			Expect(written).To(Equal(expected))
+		})
+
+		It("writes an indented config", func() {
+			icw, err := NewIndentedConfigWriter()
+			Expect(err).To(BeNil())
+			defer icw.Stop()
+
+			section := testSection{
+				Field1: "test-field1",
+				Field2: 42,
+			}
+			doneCh, errCh, err := icw.SendSection("indented", section)
+			Expect(err).To(BeNil())
+			pollDone(doneCh, errCh)
+
+			expected, err := json.MarshalIndent(map[string]testSection{
+				"indented": section,
+			}, "", "  ")
+			Expect(err).To(BeNil())
+			written, err := ioutil.ReadFile(icw.GetOutputFilename())
+			Expect(err).To(BeNil())
+			Expect(written).To(Equal(expected))
+		})
+
 		It("can write concurrently", func() {
 			testData := map[string]testSection{
 				"concurrent-1": testSection{
@@ -411,12 +411,19 @@ def _create_client_ssl_profile(mgmt, partition, profile):
                   'cert': '/Common/' + cert_name,
                   'key': '/Common/' + key_name}]
         serverName = profile.get('serverName', None)
+        # Only override the session resumption defaults if requested
+        options = {}
+        if 'sessionTicket' in profile:
+            options['sessionTicket'] = profile['sessionTicket']
+        if 'cacheSize' in profile:
+            options['cacheSize'] = profile['cacheSize']
         ssl_client_profile.create(name=name,
                                   partition=partition,
                                   certKeyChain=chain,
                                   serverName=serverName,
                                   sniDefault=False,
-                                  defaultsFrom=None)
+                                  defaultsFrom=None,
+                                  **options)
     except Exception as err:
         log.error("Error creating client SSL profile: %s" % err.message)
         incomplete = 1
@@ -505,6 +512,534 @@ def _delete_ssl_profiles(config, profiles):
     return incomplete
 
 
+def _preserve_virtual_fields(mgmt, partition, config):
+    """Keep the fields of virtual servers that are manually set on the BIG-IP.
+
+    Virtual servers with the merge policy list these fields in
+    'preserveFields'. Their current values are copied into the config so
+    they are not overwritten when it is applied. The list is always removed,
+    it is not part of the CCCL schema.
+    """
+    incomplete = 0
+
+    for virtual in config.get('virtualServers', []):
+        fields = virtual.pop('preserveFields', None)
+        if not fields:
+            continue
+        name = virtual['name']
+        try:
+            virtuals = mgmt.tm.ltm.virtuals.virtual
+            if not virtuals.exists(name=name, partition=partition):
+                # Nothing to keep until the virtual server is created
+                continue
+            current = virtuals.load(name=name, partition=partition)
+        except Exception as err:
+            log.error("Error reading virtual server %s from BIG-IP: %s" %
+                      (name, err.message))
+            incomplete += 1
+            continue
+        for field in fields:
+            if hasattr(current, field):
+                virtual[field] = getattr(current, field)
+
+    return incomplete
+
+
+# Settings of virtual servers that are not part of the CCCL schema, set in a
+# single pass once CCCL has applied the config
+VIRTUAL_SETTINGS = ['securityLogProfiles', 'bwcPolicy', 'clonePools',
+                    'perRequestPolicy', 'persist', 'sourcePort', 'ipForward']
+
+
+def _pop_virtual_settings(config):
+    """Remove the settings of virtual servers CCCL does not manage.
+
+    Returns a dict of the settings by virtual server name, each a dict by
+    setting name. An empty value removes the current setting, a missing one
+    leaves it as it is.
+    """
+    settings = {}
+    for virtual in config.get('virtualServers', []):
+        values = dict((k, virtual.pop(k)) for k in VIRTUAL_SETTINGS
+                      if k in virtual)
+        # IP forwarding is only ever turned on
+        if not values.get('ipForward', True):
+            del values['ipForward']
+        if values:
+            settings[virtual['name']] = values
+    return settings
+
+
+def _clone_pool_key(pool):
+    """Full path and context of a clone pool, as set or as loaded."""
+    name = pool.get('name', '')
+    if not name.startswith('/'):
+        name = '/%s/%s' % (pool.get('partition', 'Common'), name)
+    return (name, pool.get('context', 'clientside'))
+
+
+def _virtual_setting_changes(virtual, settings):
+    """Return the settings that differ from those of a loaded virtual."""
+    changes = {}
+    for field in sorted(settings):
+        value = settings[field]
+        if field == 'securityLogProfiles':
+            # Names with spaces are returned quoted
+            current = sorted(p.strip('"') for p in
+                             getattr(virtual, field, []))
+            if current != sorted(value):
+                changes[field] = sorted(value)
+        elif field == 'clonePools':
+            wanted = sorted(_clone_pool_key(pool) for pool in value)
+            current = sorted(_clone_pool_key(pool) for pool
+                             in getattr(virtual, field, []))
+            if current != wanted:
+                changes[field] = [{'name': pool, 'context': context}
+                                  for pool, context in wanted]
+        elif field == 'persist':
+            current = ['/%s/%s' % (p.get('partition', 'Common'), p['name'])
+                       for p in getattr(virtual, field, [])]
+            if not value and current:
+                changes[field] = []
+            elif value and current != [value]:
+                profile_partition, profile_name = value.split('/')[1:]
+                changes[field] = [{'name': profile_name,
+                                   'partition': profile_partition,
+                                   'tmDefault': 'yes'}]
+        elif field == 'sourcePort':
+            if getattr(virtual, field, 'preserve') != value:
+                changes[field] = value
+        elif field == 'ipForward':
+            if not getattr(virtual, field, False):
+                changes[field] = True
+        elif getattr(virtual, field, '') != value:
+            # The bandwidth controller and per-request policies
+            changes[field] = value or 'none'
+    return changes
+
+
+def _set_virtual_settings(mgmt, partition, settings, applied,
+                          created=False):
+    """Set the settings of virtual servers that changed since last applied.
+
+    applied holds the settings set by earlier passes, by virtual server
+    name. Only the virtual servers whose settings differ from it are loaded,
+    and each is modified once. It is updated with the settings set, and
+    loses the virtual servers that are gone or failed, so they are set
+    again. With created, the virtual servers that do not exist yet are
+    skipped.
+    """
+    incomplete = 0
+
+    for name in list(applied):
+        if name not in settings:
+            del applied[name]
+    for name in sorted(settings):
+        if applied.get(name) == settings[name]:
+            continue
+        applied.pop(name, None)
+        try:
+            virtuals = mgmt.tm.ltm.virtuals.virtual
+            if created and not virtuals.exists(
+                    name=name, partition=partition):
+                continue
+            virtual = virtuals.load(name=name, partition=partition)
+            changes = _virtual_setting_changes(virtual, settings[name])
+            if changes:
+                virtual.modify(**changes)
+            applied[name] = settings[name]
+        except Exception as err:
+            log.error("Error setting %s of %s: %s" %
+                      (', '.join(sorted(settings[name])), name,
+                       err.message))
+            incomplete += 1
+
+    return incomplete
+
+
+# Options of the OneConnect profiles the controller creates
+ONECONNECT_OPTIONS = ['defaultsFrom', 'maxSize', 'maxReuse', 'maxAge',
+                      'idleTimeoutOverride', 'sourceMask']
+
+
+def _pop_oneconnect_profiles(config):
+    """Remove the OneConnect profiles of virtual servers from config.
+
+    They are not part of the CCCL schema and are created before CCCL
+    applies the config, which attaches them. Returns the list of profiles.
+    """
+    profiles = []
+    for virtual in config.get('virtualServers', []):
+        if 'oneConnect' in virtual:
+            profiles.append(virtual.pop('oneConnect'))
+    return profiles
+
+
+def _create_oneconnect_profiles(mgmt, partition, profiles, applied):
+    """Create the OneConnect profiles of virtual servers, or update them.
+
+    applied holds the options set by earlier passes, by profile name; the
+    profiles whose options did not change are not loaded again. It is
+    updated with the options set.
+    """
+    incomplete = 0
+    oneconnect = mgmt.tm.ltm.profile.one_connects.one_connect
+
+    for profile in sorted(profiles, key=lambda p: p['name']):
+        name = profile['name']
+        options = dict((k, profile[k]) for k in ONECONNECT_OPTIONS
+                       if k in profile)
+        if applied.get(name) == options:
+            continue
+        try:
+            if not oneconnect.exists(name=name, partition=partition):
+                oneconnect.create(name=name, partition=partition, **options)
+            else:
+                current = oneconnect.load(name=name, partition=partition)
+                changed = dict((k, v) for k, v in options.items()
+                               if getattr(current, k, None) != v)
+                if changed:
+                    current.modify(**changed)
+            applied[name] = options
+        except Exception as err:
+            log.error("Error setting OneConnect profile %s: %s" %
+                      (name, err.message))
+            incomplete += 1
+
+    return incomplete
+
+
+def _delete_oneconnect_profiles(mgmt, partition, names):
+    """Delete the OneConnect profiles no virtual server uses anymore."""
+    incomplete = 0
+    oneconnect = mgmt.tm.ltm.profile.one_connects.one_connect
+
+    for name in sorted(names):
+        try:
+            if oneconnect.exists(name=name, partition=partition):
+                oneconnect.load(name=name, partition=partition).delete()
+        except Exception as err:
+            log.error("Error deleting OneConnect profile %s: %s" %
+                      (name, err.message))
+            incomplete += 1
+
+    return incomplete
+
+
+def _pop_fqdn_members(config):
+    """Remove the FQDN members of pools from config.
+
+    A member is added to the pool once CCCL has created it. Returns a dict
+    of the FQDN members by pool name.
+    """
+    members = {}
+    for pool in config.get('pools', []):
+        if 'fqdn' in pool:
+            members[pool['name']] = pool.pop('fqdn')
+    return members
+
+
+def _member_address(name):
+    """Return the address and port of a pool member or destination name."""
+    # IPv4 addresses and host names are 'addr:port', IPv6 are 'addr.port'
+    if name.count(':') == 1:
+        address, port = name.rsplit(':', 1)
+    else:
+        address, port = name.rsplit('.', 1)
+    return address, int(port)
+
+
+def _keep_fqdn_members(mgmt, partition, config, members):
+    """Write the members of FQDN pools as they are on the BIG-IP.
+
+    The controller sends no members for FQDN pools: the BIG-IP creates one
+    for each address of the name. Without them in the config, CCCL would
+    remove these members and the FQDN member itself on every apply.
+    """
+    incomplete = 0
+    pools = dict((p['name'], p) for p in config.get('pools', []))
+
+    for name in sorted(members):
+        try:
+            collection = mgmt.tm.ltm.pools.pool
+            if not collection.exists(name=name, partition=partition):
+                # The FQDN member is added once CCCL creates the pool
+                continue
+            pool = collection.load(name=name, partition=partition)
+            current = pool.members_s.get_collection()
+        except Exception as err:
+            log.error("Error reading members of pool %s from BIG-IP: %s" %
+                      (name, err.message))
+            incomplete += 1
+            continue
+        pools[name]['members'] = []
+        for member in sorted(current, key=lambda m: m.name):
+            address, port = _member_address(member.name)
+            pools[name]['members'].append({'address': address,
+                                           'port': port})
+
+    return incomplete
+
+
+def _set_fqdn_members(mgmt, partition, members, applied):
+    """Add the FQDN members of pools and set their DNS query interval.
+
+    applied holds the FQDN members set by earlier passes, by pool name; the
+    pools whose member did not change are not loaded again. It is updated
+    with the members set, and loses the pools that are gone.
+    """
+    incomplete = 0
+
+    for name in list(applied):
+        if name not in members:
+            del applied[name]
+    for name in sorted(members):
+        fqdn = members[name]
+        if applied.get(name) == fqdn:
+            continue
+        member_name = '%s:%d' % (fqdn['name'], fqdn['port'])
+        autopopulate = 'enabled' if fqdn.get('autoPopulate', True) \
+            else 'disabled'
+        interval = str(fqdn['interval']) if fqdn.get('interval') else 'ttl'
+        try:
+            pool = mgmt.tm.ltm.pools.pool.load(name=name, partition=partition)
+            if not pool.members_s.members.exists(
+                    name=member_name, partition=partition):
+                pool.members_s.members.create(
+                    name=member_name,
+                    partition=partition,
+                    fqdn={'tmName': fqdn['name'],
+                          'autopopulate': autopopulate})
+            # The interval is a property of the node of the name
+            node = mgmt.tm.ltm.nodes.node.load(
+                name=fqdn['name'], partition=partition)
+            current = getattr(node, 'fqdn', {})
+            if current.get('interval') != interval:
+                current = dict(current)
+                current['interval'] = interval
+                node.modify(fqdn=current)
+            applied[name] = fqdn
+        except Exception as err:
+            log.error("Error setting FQDN member of pool %s: %s" %
+                      (name, err.message))
+            incomplete += 1
+
+    return incomplete
+
+
+# Settings of pools that are not part of the CCCL schema, set once CCCL has
+# applied the config, and their BIG-IP defaults
+POOL_SETTINGS = {'serviceDownAction': 'none', 'reselectTries': 0}
+
+
+def _pop_pool_settings(config):
+    """Remove the settings of pools CCCL does not manage.
+
+    Returns a dict of the settings by pool name, each a dict by setting
+    name. The settings missing are set to their BIG-IP default.
+    """
+    settings = {}
+    for pool in config.get('pools', []):
+        values = dict((k, pool.pop(k)) for k in POOL_SETTINGS if k in pool)
+        if values:
+            settings[pool['name']] = values
+    return settings
+
+
+def _set_pool_settings(mgmt, partition, settings, applied):
+    """Set the settings of pools that changed since last applied.
+
+    applied holds the settings set by earlier passes, by pool name; the
+    pools whose settings did not change are not loaded again. Pools that
+    no longer have settings get the BIG-IP defaults back, unless they are
+    gone. It is updated with the settings set, and keeps the pools that
+    failed as they were, so they are set again.
+    """
+    incomplete = 0
+    pools = mgmt.tm.ltm.pools.pool
+
+    wanted = dict((name, {}) for name in applied)
+    wanted.update(settings)
+    for name in sorted(wanted):
+        if applied.get(name) == wanted[name]:
+            continue
+        values = dict(POOL_SETTINGS, **wanted[name])
+        previous = applied.pop(name, None)
+        try:
+            if not wanted[name] and not pools.exists(
+                    name=name, partition=partition):
+                continue
+            pool = pools.load(name=name, partition=partition)
+            changes = dict((k, v) for k, v in values.items()
+                           if getattr(pool, k, POOL_SETTINGS[k]) != v)
+            if changes:
+                pool.modify(**changes)
+            if wanted[name]:
+                applied[name] = wanted[name]
+        except Exception as err:
+            log.error("Error setting %s of pool %s: %s" %
+                      (', '.join(sorted(values)), name, err.message))
+            if not wanted[name]:
+                applied[name] = previous
+            incomplete += 1
+
+    return incomplete
+
+
+def _pop_nodes(config):
+    """Remove the nodes of pool members from config.
+
+    CCCL creates the nodes of pool members, the controller only describes
+    them once CCCL has applied the config. Returns a dict of the node
+    descriptions by node name.
+    """
+    return dict((node['name'], node['description'])
+                for node in config.pop('nodes', []))
+
+
+def _set_node_descriptions(mgmt, partition, descriptions, applied):
+    """Set the descriptions of nodes that changed since last applied.
+
+    applied holds the descriptions set by earlier passes, by node name; the
+    nodes whose description did not change are not loaded again. It is
+    updated with the descriptions set, and loses the nodes that are gone.
+    """
+    incomplete = 0
+
+    for name in list(applied):
+        if name not in descriptions:
+            del applied[name]
+    for name in sorted(descriptions):
+        description = descriptions[name]
+        if applied.get(name) == description:
+            continue
+        applied.pop(name, None)
+        try:
+            node = mgmt.tm.ltm.nodes.node.load(name=name, partition=partition)
+            if getattr(node, 'description', '') != description:
+                node.modify(description=description)
+            applied[name] = description
+        except Exception as err:
+            log.error("Error setting description of node %s: %s" %
+                      (name, err.message))
+            incomplete += 1
+
+    return incomplete
+
+
+def _pop_adoptions(config):
+    """Remove the legacy names of objects from config.
+
+    They are not part of the CCCL schema. Returns the adoptions, each the
+    kind, name and legacy name of an object an earlier controller version
+    named differently.
+    """
+    return config.pop('adoptions', [])
+
+
+def _legacy_collection(mgmt, kind):
+    """Return the BIG-IP collection of the objects of an adoption kind."""
+    if kind == 'clientSsl':
+        return mgmt.tm.ltm.profile.client_ssls.client_ssl
+    if kind == 'serverSsl':
+        return mgmt.tm.ltm.profile.server_ssls.server_ssl
+    return None
+
+
+def _migration_status(mgmt, partition, adoptions, previous):
+    """Return the migration status of the legacy objects.
+
+    An object is 'migrating' until its legacy name is deleted, then
+    'migrated'. The status is by kind and legacy name. Objects migrated in
+    the previous status are not looked up again.
+    """
+    status = {}
+    for adoption in adoptions:
+        kind = adoption['kind']
+        key = (kind, adoption['legacyName'])
+        if previous.get(key) == 'migrated':
+            status[key] = 'migrated'
+            continue
+        collection = _legacy_collection(mgmt, kind)
+        if collection is None:
+            log.warning("Unknown kind %s of legacy object %s" %
+                        (kind, adoption['legacyName']))
+            continue
+        try:
+            exists = collection.exists(name=adoption['legacyName'],
+                                       partition=partition)
+        except Exception as err:
+            log.warning("Error looking up legacy %s %s: %s" %
+                        (kind, adoption['legacyName'], err.message))
+            continue
+        status[key] = 'migrating' if exists else 'migrated'
+    return status
+
+
+def _virtual_address_names(config):
+    """Return the names of the virtual addresses of virtual servers."""
+    addresses = set()
+    for virtual in config.get('virtualServers', []):
+        destination = virtual.get('destination')
+        if not destination:
+            continue
+        addresses.add(_member_address(destination.split('/')[-1])[0])
+    return addresses
+
+
+def _set_traffic_group(mgmt, partition, config, traffic_group, applied):
+    """Move the virtual addresses of virtual servers to the traffic group.
+
+    applied holds the traffic groups set by earlier passes, by virtual
+    address name; the addresses already moved are not loaded again. It is
+    updated with the addresses moved, and loses those that are gone.
+    """
+    incomplete = 0
+
+    if '/' not in traffic_group:
+        traffic_group = '/Common/' + traffic_group
+    names = _virtual_address_names(config)
+    for name in list(applied):
+        if name not in names:
+            del applied[name]
+    for name in sorted(names):
+        if applied.get(name) == traffic_group:
+            continue
+        try:
+            address = mgmt.tm.ltm.virtual_address_s.virtual_address.load(
+                name=name, partition=partition)
+            if getattr(address, 'trafficGroup', None) != traffic_group:
+                log.info("Moving virtual address %s to traffic group %s" %
+                         (name, traffic_group))
+                address.modify(trafficGroup=traffic_group)
+            applied[name] = traffic_group
+        except Exception as err:
+            log.error("Error setting traffic group of virtual address %s: "
+                      "%s" % (name, err.message))
+            incomplete += 1
+
+    return incomplete
+
+
+def _get_failover_state(mgmt):
+    """Return the failover state of the BIG-IP, None if it is unknown.
+
+    The state is 'active' or 'standby' for a unit of an HA pair, a
+    standalone BIG-IP is 'active'.
+    """
+    try:
+        failover = mgmt.tm.sys.failover.load()
+        # For example 'Failover active for 10d 02:15:32'
+        status = failover.apiRawValues['apiAnonymous'].split()
+    except Exception as err:
+        log.warning("Error reading failover state of BIG-IP: %s" %
+                    err.message)
+        return None
+    if len(status) < 2:
+        return None
+    return status[1].lower()
+
+
 def _upload_crypto_file(mgmt, file_data, file_name):
     # bigip object is of type f5.bigip.tm;
     # we need f5.bigip.shared for the uploader
@@ -586,7 +1121,8 @@ def _key_exists(mgmt, key_name):
 
 
 class ConfigHandler():
-    def __init__(self, config_file, managers, verify_interval):
+    def __init__(self, config_file, managers, verify_interval,
+                 failover_interval=0):
         self._config_file = config_file
         self._managers = managers
 
@@ -598,10 +1134,39 @@ class ConfigHandler():
         self._backoff_timer = None
         self._max_backoff_time = 128
 
+        # Options of the OneConnect profiles created, by partition and
+        # profile name; the profiles are deleted once no virtual server uses
+        # them
+        self._oneconnect_profiles = {}
+
+        # Settings of virtual servers and pools CCCL does not manage, FQDN
+        # members of pools, descriptions of nodes and traffic groups of
+        # virtual addresses, by partition, as last applied. They are only
+        # set again when they change, or when the config is verified.
+        self._virtual_settings = {}
+        self._pool_settings = {}
+        self._fqdn_members = {}
+        self._node_descriptions = {}
+        self._traffic_groups = {}
+        self._pending_verify = False
+
+        # Migration status of the objects created under legacy names, by
+        # partition
+        self._migrations = {}
+
         self._interval = None
         self._verify_interval = 0
         self.set_interval_timer(verify_interval)
 
+        # Failover state of the BIG-IP, only checked if failover_interval
+        # is set
+        self._failover_state = None
+        self._failover_timer = None
+        if failover_interval > 0:
+            self._failover_timer = IntervalTimer(failover_interval,
+                                                 self.check_failover)
+            self._failover_timer.start()
+
         self._thread.start()
 
     def set_interval_timer(self, verify_interval):
@@ -613,7 +1178,7 @@ class ConfigHandler():
             self._verify_interval = verify_interval
             if self._verify_interval > 0:
                 self._interval = IntervalTimer(self._verify_interval,
-                                               self.notify_reset)
+                                               self.notify_verify)
 
     def stop(self):
         self._condition.acquire()
@@ -622,6 +1187,38 @@ class ConfigHandler():
         self._condition.release()
         if self._backoff_timer is not None:
             self.cleanup_backoff()
+        if self._failover_timer is not None:
+            self._failover_timer.stop()
+
+    def check_failover(self):
+        """Verify the config when the BIG-IP becomes the active unit."""
+        state = _get_failover_state(self._managers[0].mgmt_root())
+        if state is None or state == self._failover_state:
+            return
+        previous = self._failover_state
+        self._failover_state = state
+        if state == 'active':
+            if previous is not None:
+                log.info('BIG-IP is now active, verifying configuration')
+                self.notify_verify()
+        else:
+            log.warning('BIG-IP is %s, configuration is not applied until '
+                        'it is active' % state)
+
+    def report_migrations(self, partition, status):
+        """Log the changes of the migration status of legacy objects."""
+        previous = self._migrations.get(partition, {})
+        for key in sorted(status):
+            if status[key] != previous.get(key, 'migrated'):
+                log.info('Legacy %s %s in partition %s is %s' %
+                         (key[0], key[1], partition, status[key]))
+        pending = len([s for s in status.values() if s != 'migrated'])
+        previous_pending = len([s for s in previous.values()
+                                if s != 'migrated'])
+        if pending != previous_pending:
+            log.info('%d objects with legacy names left in partition %s' %
+                     (pending, partition))
+        self._migrations[partition] = status
 
     def notify_reset(self):
         self._condition.acquire()
@@ -629,6 +1226,30 @@ class ConfigHandler():
         self._condition.notify()
         self._condition.release()
 
+    def notify_verify(self):
+        """Apply the config, setting again what was applied earlier."""
+        self._condition.acquire()
+        self._pending_verify = True
+        self._pending_reset = True
+        self._condition.notify()
+        self._condition.release()
+
+    def _forget_applied(self):
+        """Forget what was applied, so that it is all verified."""
+        self._virtual_settings = {}
+        self._fqdn_members = {}
+        self._node_descriptions = {}
+        self._traffic_groups = {}
+        # The pools with settings are still tracked to be reset once they
+        # have none
+        for settings in self._pool_settings.values():
+            for name in settings:
+                settings[name] = None
+        # The profiles are still tracked to be deleted once unused
+        for profiles in self._oneconnect_profiles.values():
+            for name in profiles:
+                profiles[name] = None
+
     def _do_reset(self):
         log.debug('config handler thread start')
 
@@ -644,6 +1265,8 @@ class ConfigHandler():
                 log.debug('config handler woken for reset')
 
                 self._pending_reset = False
+                verify = self._pending_verify
+                self._pending_verify = False
                 self._condition.release()
 
                 if self._stop:
@@ -653,6 +1276,8 @@ class ConfigHandler():
                     break
 
                 start_time = time.time()
+                if verify:
+                    self._forget_applied()
 
                 config = _parse_config(self._config_file)
                 # No 'resources' indicates that the controller is not
@@ -663,6 +1288,12 @@ class ConfigHandler():
                 _handle_openshift_sdn_config(config)
                 self.set_interval_timer(verify_interval)
 
+                if (self._failover_state is not None and
+                        self._failover_state != 'active'):
+                    # The config is verified once the BIG-IP is active
+                    continue
+                traffic_group = config.get('bigip', {}).get('traffic-group')
+
                 cfg_network = create_network_config_kubernetes(config)
                 incomplete = 0
 
@@ -670,6 +1301,10 @@ class ConfigHandler():
                     partition = mgr.get_partition()
                     cfg_ltm = create_ltm_config_kubernetes(partition, config)
                     try:
+                        # Objects created under the names of earlier
+                        # controller versions, migrated to their new name
+                        adoptions = _pop_adoptions(cfg_ltm)
+
                         # Manually create custom profiles;
                         # CCCL doesn't yet do this
                         if 'customProfiles' in cfg_ltm:
@@ -680,10 +1315,105 @@ class ConfigHandler():
                                 cfg_ltm['customProfiles'])
                             incomplete += tmp
 
+                        # Keep manually set fields of merged virtual servers
+                        incomplete += _preserve_virtual_fields(
+                            mgr.mgmt_root(),
+                            partition,
+                            cfg_ltm)
+
+                        settings = _pop_virtual_settings(cfg_ltm)
+                        pool_settings = _pop_pool_settings(cfg_ltm)
+                        fqdn_members = _pop_fqdn_members(cfg_ltm)
+                        nodes = _pop_nodes(cfg_ltm)
+                        oneconnect = _pop_oneconnect_profiles(cfg_ltm)
+                        applied = self._virtual_settings.setdefault(
+                            partition, {})
+
+                        # The OneConnect profiles must exist for CCCL to
+                        # attach them
+                        profiles = self._oneconnect_profiles.setdefault(
+                            partition, {})
+                        if oneconnect:
+                            incomplete += _create_oneconnect_profiles(
+                                mgr.mgmt_root(),
+                                partition,
+                                oneconnect,
+                                profiles)
+
+                        if fqdn_members:
+                            incomplete += _keep_fqdn_members(
+                                mgr.mgmt_root(),
+                                partition,
+                                cfg_ltm,
+                                fqdn_members)
+
+                        # Per-request policies must be removed before their
+                        # access profile is, and set once it is attached
+                        removed = dict(
+                            (name, {'perRequestPolicy': ''})
+                            for name, values in settings.items()
+                            if values.get('perRequestPolicy') == '' and
+                            applied.get(name, {}).get(
+                                'perRequestPolicy') != '')
+                        if removed:
+                            incomplete += _set_virtual_settings(
+                                mgr.mgmt_root(),
+                                partition,
+                                removed,
+                                {},
+                                created=True)
+
                         # Apply the BIG-IP config after creating profiles
                         # and before deleting profiles
                         incomplete += mgr._apply_ltm_config(cfg_ltm)
 
+                        incomplete += _set_virtual_settings(
+                            mgr.mgmt_root(),
+                            partition,
+                            settings,
+                            applied)
+
+                        incomplete += _set_pool_settings(
+                            mgr.mgmt_root(),
+                            partition,
+                            pool_settings,
+                            self._pool_settings.setdefault(partition, {}))
+
+                        incomplete += _set_fqdn_members(
+                            mgr.mgmt_root(),
+                            partition,
+                            fqdn_members,
+                            self._fqdn_members.setdefault(partition, {}))
+
+                        incomplete += _set_node_descriptions(
+                            mgr.mgmt_root(),
+                            partition,
+                            nodes,
+                            self._node_descriptions.setdefault(partition, {}))
+
+                        if traffic_group:
+                            incomplete += _set_traffic_group(
+                                mgr.mgmt_root(),
+                                partition,
+                                cfg_ltm,
+                                traffic_group,
+                                self._traffic_groups.setdefault(
+                                    partition, {}))
+
+                        # Delete the OneConnect profiles once CCCL has
+                        # detached them, retrying those that failed
+                        unused = set(profiles) - set(
+                            p['name'] for p in oneconnect)
+                        if unused:
+                            tmp = _delete_oneconnect_profiles(
+                                mgr.mgmt_root(),
+                                partition,
+                                unused)
+                            incomplete += tmp
+                            if not tmp:
+                                for name in unused:
+                                    del profiles[name]
+
                         # Manually delete custom profiles (if needed)
                         if customProfiles:
                             _delete_unused_ssl_profiles(
@@ -691,6 +1421,14 @@ class ConfigHandler():
                                 partition,
                                 cfg_ltm)
 
+                        self.report_migrations(
+                            partition,
+                            _migration_status(mgr.mgmt_root(),
+                                              partition,
+                                              adoptions,
+                                              self._migrations.get(
+                                                  partition, {})))
+
                     except F5CcclError as e:
                         # We created an invalid configuration, raise the
                         # exception and fail
@@ -1055,7 +1793,8 @@ def main():
 
         handler = ConfigHandler(args.config_file,
                                 k8s_managers,
-                                verify_interval)
+                                verify_interval,
+                                config['bigip'].get('failover-interval', 0))
 
         if os.path.exists(args.config_file):
             handler.notify_reset()
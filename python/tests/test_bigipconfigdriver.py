@@ -117,6 +117,7 @@ class MockMgr(bigipconfigdriver.K8sCloudServiceManager):
     def __init__(self, fail=False, notify_event=None, notify_after=0,
                  handle_results=None):
         self._cloud = 'k8s'
+        self._mgmt_root = None
         self._partition = _cloud_config['bigip']['partition']
         self.calls = 0
         self._fail = fail
@@ -1248,6 +1249,7 @@ def test_confighandler_backoff_time(request):
 class MockApplyConfigMgr(bigipconfigdriver.K8sCloudServiceManager):
 
     def __init__(self, returns):
+        self._mgmt_root = None
         self._returns = returns
 
     def _apply_ltm_config(self, cfg):
@@ -1342,3 +1344,552 @@ def test_confighandler_backoff_timer(request):
             handler._thread.join(30)
             assert handler._thread.is_alive() is False
             assert handler._interval.is_running() is False
+
+
+class MockVirtual():
+    def __init__(self, **kwargs):
+        self.__dict__.update(kwargs)
+        self.modified = {}
+
+    def modify(self, **kwargs):
+        self.modified.update(kwargs)
+        self.__dict__.update(kwargs)
+
+
+class MockVirtuals():
+    def __init__(self, virtuals):
+        self._virtuals = virtuals
+
+    def exists(self, name, partition):
+        return name in self._virtuals
+
+    def load(self, name, partition):
+        if name not in self._virtuals:
+            raise Exception('virtual %s not found' % name)
+        return self._virtuals[name]
+
+
+class MockMgmtRoot():
+    def __init__(self, virtuals):
+        self.tm = MockVirtual(ltm=MockVirtual(virtuals=MockVirtual(
+            virtual=MockVirtuals(virtuals))))
+
+
+def test_preserve_virtual_fields():
+    mgmt = MockMgmtRoot({
+        'default_foo': MockVirtual(name='default_foo',
+                                   connectionLimit=500,
+                                   description='tuned by hand')})
+    config = {
+        'virtualServers': [
+            {'name': 'default_foo',
+             'preserveFields': ['connectionLimit', 'description', 'mirror']},
+            {'name': 'default_bar',
+             'preserveFields': ['connectionLimit']},
+            {'name': 'default_baz'}
+        ]
+    }
+
+    incomplete = bigipconfigdriver._preserve_virtual_fields(
+        mgmt, 'test', config)
+    assert incomplete == 0
+    assert config['virtualServers'] == [
+        {'name': 'default_foo',
+         'connectionLimit': 500,
+         'description': 'tuned by hand'},
+        {'name': 'default_bar'},
+        {'name': 'default_baz'}
+    ]
+
+
+def test_virtual_settings():
+    universal = [{'name': 'universal', 'partition': 'Common',
+                  'tmDefault': 'yes'}]
+    ids = {'name': '/Common/ids_pool', 'context': 'clientside'}
+    foo = MockVirtual(name='default_foo',
+                      securityLogProfiles=['"/Common/Log all requests"'],
+                      bwcPolicy='/Common/bwc-10mbps',
+                      clonePools=[{'name': 'ids_pool', 'partition': 'Common',
+                                   'context': 'clientside'}],
+                      perRequestPolicy='/Common/prp',
+                      persist=universal,
+                      sourcePort='preserve-strict',
+                      ipForward=True)
+    bar = MockVirtual(name='default_bar')
+    baz = MockVirtual(name='default_baz',
+                      securityLogProfiles=['/Common/local-dos'],
+                      bwcPolicy='/Common/bwc-10mbps',
+                      clonePools=[ids],
+                      perRequestPolicy='/Common/prp',
+                      persist=universal)
+    mgmt = MockMgmtRoot({
+        'default_foo': foo, 'default_bar': bar, 'default_baz': baz})
+    config = {
+        'virtualServers': [
+            {'name': 'default_foo',
+             'securityLogProfiles': ['/Common/Log all requests'],
+             'bwcPolicy': '/Common/bwc-10mbps',
+             'clonePools': [ids],
+             'perRequestPolicy': '/Common/prp',
+             'persist': '/Common/universal',
+             'sourcePort': 'preserve-strict',
+             'ipForward': True},
+            {'name': 'default_bar',
+             'securityLogProfiles': ['/Common/local-dos'],
+             'bwcPolicy': '/Common/bwc-1gbps',
+             'clonePools': [
+                 {'name': '/Common/ids_pool', 'context': 'serverside'}],
+             'perRequestPolicy': '/Common/prp-mfa',
+             'persist': '/Common/universal',
+             'sourcePort': 'change',
+             'ipForward': True},
+            {'name': 'default_baz',
+             'securityLogProfiles': [],
+             'bwcPolicy': '',
+             'clonePools': [],
+             'perRequestPolicy': '',
+             'persist': ''},
+            {'name': 'default_qux', 'ipForward': False}
+        ]
+    }
+
+    settings = bigipconfigdriver._pop_virtual_settings(config)
+    assert config['virtualServers'] == [
+        {'name': 'default_foo'},
+        {'name': 'default_bar'},
+        {'name': 'default_baz'},
+        {'name': 'default_qux'}
+    ]
+    assert sorted(settings) == ['default_bar', 'default_baz', 'default_foo']
+
+    applied = {'default_gone': {'sourcePort': 'change'}}
+    incomplete = bigipconfigdriver._set_virtual_settings(
+        mgmt, 'test', settings, applied)
+    assert incomplete == 0
+    assert foo.modified == {}
+    assert bar.modified == {
+        'securityLogProfiles': ['/Common/local-dos'],
+        'bwcPolicy': '/Common/bwc-1gbps',
+        'clonePools': [{'name': '/Common/ids_pool', 'context': 'serverside'}],
+        'perRequestPolicy': '/Common/prp-mfa',
+        'persist': universal,
+        'sourcePort': 'change',
+        'ipForward': True}
+    assert baz.modified == {
+        'securityLogProfiles': [],
+        'bwcPolicy': 'none',
+        'clonePools': [],
+        'perRequestPolicy': 'none',
+        'persist': []}
+    assert applied == settings
+
+    # Virtual servers whose settings did not change are not loaded again
+    bar.modified = {}
+    settings['default_bar'] = dict(settings['default_bar'],
+                                   bwcPolicy='/Common/bwc-10mbps')
+    del mgmt.tm.ltm.virtuals.virtual._virtuals['default_foo']
+    incomplete = bigipconfigdriver._set_virtual_settings(
+        mgmt, 'test', settings, applied)
+    assert incomplete == 0
+    assert bar.modified == {'bwcPolicy': '/Common/bwc-10mbps'}
+
+    # Virtual servers that cannot be loaded are retried, removals are
+    # skipped for virtual servers not created yet
+    incomplete = bigipconfigdriver._set_virtual_settings(
+        mgmt, 'test', {'default_foo': {'sourcePort': 'change'}}, applied)
+    assert incomplete == 1
+    assert applied == {}
+    incomplete = bigipconfigdriver._set_virtual_settings(
+        mgmt, 'test', {'default_foo': {'perRequestPolicy': ''}}, {},
+        created=True)
+    assert incomplete == 0
+
+
+def test_adoptions():
+    mgmt = MockMgmtRoot({})
+    client_ssls = MockVirtuals({
+        'legacy_cert': MockVirtual(name='legacy_cert')})
+    mgmt.tm.ltm.profile = MockVirtual(
+        client_ssls=MockVirtual(client_ssl=client_ssls),
+        server_ssls=MockVirtual(server_ssl=MockVirtuals({})))
+    config = {
+        'virtualServers': [{'name': 'default_foo'}],
+        'adoptions': [
+            {'kind': 'clientSsl', 'name': 'default_cert',
+             'legacyName': 'legacy_cert'},
+            {'kind': 'serverSsl', 'name': 'default_ca',
+             'legacyName': 'legacy_ca'}
+        ]
+    }
+
+    adoptions = bigipconfigdriver._pop_adoptions(config)
+    assert 'adoptions' not in config
+    assert len(adoptions) == 2
+
+    status = bigipconfigdriver._migration_status(
+        mgmt, 'test', adoptions, {})
+    assert status == {
+        ('clientSsl', 'legacy_cert'): 'migrating',
+        ('serverSsl', 'legacy_ca'): 'migrated'
+    }
+
+    # Migrated objects are not looked up again, lookups that fail are
+    # retried
+    def fail(name, partition):
+        raise Exception('lookup failed')
+    client_ssls.exists = fail
+    mgmt.tm.ltm.profile.server_ssls.server_ssl.exists = fail
+    status = bigipconfigdriver._migration_status(
+        mgmt, 'test', adoptions, status)
+    assert status == {('serverSsl', 'legacy_ca'): 'migrated'}
+
+
+class MockPoolMembers():
+    def __init__(self, names):
+        self.names = names
+        self.created = []
+
+    def exists(self, name, partition):
+        return name in self.names
+
+    def create(self, **kwargs):
+        self.created.append(kwargs)
+        self.names.append(kwargs['name'])
+
+
+class MockOneConnects(MockVirtuals):
+    def __init__(self, virtuals):
+        MockVirtuals.__init__(self, virtuals)
+        self.created = []
+        self.deleted = []
+
+    def create(self, **kwargs):
+        self.created.append(kwargs)
+        self._virtuals[kwargs['name']] = MockVirtual(**kwargs)
+
+    def load(self, name, partition):
+        profile = MockVirtuals.load(self, name, partition)
+        profile.delete = lambda: self.deleted.append(name)
+        return profile
+
+
+def test_oneconnect_profiles():
+    foo = MockVirtual(name='default_foo_oneconnect',
+                      defaultsFrom='/Common/oneconnect',
+                      maxSize=10000, maxReuse=1000)
+    profiles = MockOneConnects({'default_foo_oneconnect': foo})
+    mgmt = MockVirtual(tm=MockVirtual(ltm=MockVirtual(
+        profile=MockVirtual(one_connects=MockVirtual(
+            one_connect=profiles)))))
+    config = {
+        'virtualServers': [
+            {'name': 'default_foo',
+             'oneConnect': {'name': 'default_foo_oneconnect',
+                            'partition': 'test',
+                            'defaultsFrom': '/Common/oneconnect',
+                            'maxSize': 10000, 'maxReuse': 100}},
+            {'name': 'default_bar',
+             'oneConnect': {'name': 'default_bar_oneconnect',
+                            'partition': 'test',
+                            'defaultsFrom': '/Common/oneconnect',
+                            'sourceMask': '255.255.255.255'}},
+            {'name': 'default_baz'}
+        ]
+    }
+
+    oneconnect = bigipconfigdriver._pop_oneconnect_profiles(config)
+    assert config['virtualServers'] == [
+        {'name': 'default_foo'},
+        {'name': 'default_bar'},
+        {'name': 'default_baz'}
+    ]
+    assert len(oneconnect) == 2
+
+    applied = {}
+    incomplete = bigipconfigdriver._create_oneconnect_profiles(
+        mgmt, 'test', oneconnect, applied)
+    assert incomplete == 0
+    assert foo.modified == {'maxReuse': 100}
+    assert profiles.created == [{
+        'name': 'default_bar_oneconnect',
+        'partition': 'test',
+        'defaultsFrom': '/Common/oneconnect',
+        'sourceMask': '255.255.255.255'
+    }]
+    assert sorted(applied) == ['default_bar_oneconnect',
+                               'default_foo_oneconnect']
+
+    # Profiles whose options did not change are not loaded again
+    foo.modified = {}
+    del profiles._virtuals['default_foo_oneconnect']
+    incomplete = bigipconfigdriver._create_oneconnect_profiles(
+        mgmt, 'test', oneconnect, applied)
+    assert incomplete == 0
+    assert len(profiles.created) == 1
+    profiles._virtuals['default_foo_oneconnect'] = foo
+
+    # Profiles are deleted once unused, missing ones are skipped
+    unused = set(['default_foo_oneconnect', 'default_qux_oneconnect'])
+    incomplete = bigipconfigdriver._delete_oneconnect_profiles(
+        mgmt, 'test', unused)
+    assert incomplete == 0
+    assert profiles.deleted == ['default_foo_oneconnect']
+
+
+def test_fqdn_members():
+    foo = MockVirtual(name='default_foo',
+                      members_s=MockVirtual(members=MockPoolMembers([])))
+    bar = MockVirtual(name='default_bar', members_s=MockVirtual(
+        members=MockPoolMembers(['api.example.net:80'])))
+    foo_node = MockVirtual(name='api.example.com',
+                           fqdn={'tmName': 'api.example.com',
+                                 'interval': '3600'})
+    bar_node = MockVirtual(name='api.example.net',
+                           fqdn={'tmName': 'api.example.net',
+                                 'interval': 'ttl'})
+    mgmt = MockVirtual(tm=MockVirtual(ltm=MockVirtual(
+        pools=MockVirtual(pool=MockVirtuals({
+            'default_foo': foo, 'default_bar': bar})),
+        nodes=MockVirtual(node=MockVirtuals({
+            'api.example.com': foo_node, 'api.example.net': bar_node})))))
+    config = {
+        'pools': [
+            {'name': 'default_foo',
+             'fqdn': {'name': 'api.example.com', 'autoPopulate': False,
+                      'interval': 300, 'port': 443}},
+            {'name': 'default_bar',
+             'fqdn': {'name': 'api.example.net', 'autoPopulate': True,
+                      'port': 80}},
+            {'name': 'default_baz'}
+        ]
+    }
+
+    members = bigipconfigdriver._pop_fqdn_members(config)
+    assert config['pools'] == [
+        {'name': 'default_foo'},
+        {'name': 'default_bar'},
+        {'name': 'default_baz'}
+    ]
+    assert len(members) == 2
+
+    # The members of existing FQDN pools are written as they are
+    foo.members_s.get_collection = lambda: []
+    bar.members_s.get_collection = lambda: [
+        MockVirtual(name='api.example.net:80'),
+        MockVirtual(name='_auto_10.1.2.3:80'),
+        MockVirtual(name='_auto_2001:db8::3.80')]
+    config['pools'].append({'name': 'default_qux'})
+    incomplete = bigipconfigdriver._keep_fqdn_members(
+        mgmt, 'test', config,
+        dict(members, default_qux=members['default_bar']))
+    assert incomplete == 0
+    assert config['pools'] == [
+        {'name': 'default_foo', 'members': []},
+        {'name': 'default_bar', 'members': [
+            {'address': '_auto_10.1.2.3', 'port': 80},
+            {'address': '_auto_2001:db8::3', 'port': 80},
+            {'address': 'api.example.net', 'port': 80}]},
+        {'name': 'default_baz'},
+        {'name': 'default_qux'}
+    ]
+
+    applied = {'default_gone': members['default_foo']}
+    incomplete = bigipconfigdriver._set_fqdn_members(
+        mgmt, 'test', members, applied)
+    assert incomplete == 0
+    assert applied == members
+    assert foo.members_s.members.created == [{
+        'name': 'api.example.com:443',
+        'partition': 'test',
+        'fqdn': {'tmName': 'api.example.com', 'autopopulate': 'disabled'}
+    }]
+    assert foo_node.modified == {
+        'fqdn': {'tmName': 'api.example.com', 'interval': '300'}}
+    assert bar.members_s.members.created == []
+    assert bar_node.modified == {}
+
+    # Pools whose member did not change are not loaded again, those that
+    # cannot be loaded are retried
+    foo_node.modified = {}
+    foo_node.fqdn = {'tmName': 'api.example.com', 'interval': '3600'}
+    incomplete = bigipconfigdriver._set_fqdn_members(
+        mgmt, 'test', members, applied)
+    assert incomplete == 0
+    assert foo_node.modified == {}
+    incomplete = bigipconfigdriver._set_fqdn_members(
+        mgmt, 'test', {'default_missing': members['default_foo']}, applied)
+    assert incomplete == 1
+    assert applied == {}
+
+
+def test_pool_settings():
+    foo = MockVirtual(name='default_foo', serviceDownAction='none',
+                      reselectTries=0)
+    bar = MockVirtual(name='default_bar', serviceDownAction='reselect',
+                      reselectTries=3)
+    baz = MockVirtual(name='default_baz', serviceDownAction='reset',
+                      reselectTries=0)
+    mgmt = MockVirtual(tm=MockVirtual(ltm=MockVirtual(
+        pools=MockVirtual(pool=MockVirtuals({
+            'default_foo': foo, 'default_bar': bar, 'default_baz': baz})))))
+    config = {
+        'pools': [
+            {'name': 'default_foo', 'serviceDownAction': 'reselect',
+             'reselectTries': 2},
+            {'name': 'default_bar', 'serviceDownAction': 'reselect',
+             'reselectTries': 3},
+            {'name': 'default_baz'}
+        ]
+    }
+
+    settings = bigipconfigdriver._pop_pool_settings(config)
+    assert config['pools'] == [
+        {'name': 'default_foo'},
+        {'name': 'default_bar'},
+        {'name': 'default_baz'}
+    ]
+    assert sorted(settings) == ['default_bar', 'default_foo']
+
+    # Pools that lost their settings get the defaults back, unless they
+    # are gone
+    applied = {'default_baz': {'serviceDownAction': 'reset'},
+               'default_gone': {'reselectTries': 1}}
+    incomplete = bigipconfigdriver._set_pool_settings(
+        mgmt, 'test', settings, applied)
+    assert incomplete == 0
+    assert foo.modified == {'serviceDownAction': 'reselect',
+                            'reselectTries': 2}
+    assert bar.modified == {}
+    assert baz.modified == {'serviceDownAction': 'none'}
+    assert applied == settings
+
+    # Pools whose settings did not change are not loaded again, those that
+    # cannot be loaded are retried
+    foo.modified = {}
+    foo.serviceDownAction = 'drop'
+    incomplete = bigipconfigdriver._set_pool_settings(
+        mgmt, 'test', settings, applied)
+    assert incomplete == 0
+    assert foo.modified == {}
+    incomplete = bigipconfigdriver._set_pool_settings(
+        mgmt, 'test', {'default_missing': {'reselectTries': 1}}, {})
+    assert incomplete == 1
+    fail = MockVirtuals({})
+    fail.exists = lambda name, partition: True
+    mgmt.tm.ltm.pools.pool = fail
+    applied = {'default_foo': settings['default_foo']}
+    incomplete = bigipconfigdriver._set_pool_settings(
+        mgmt, 'test', {}, applied)
+    assert incomplete == 1
+    assert applied == {'default_foo': settings['default_foo']}
+
+
+def test_node_descriptions():
+    foo = MockVirtual(name='10.2.96.3', description='Pod default/foo-1')
+    bar = MockVirtual(name='10.2.96.4', description='Pod default/bar-1')
+    mgmt = MockVirtual(tm=MockVirtual(ltm=MockVirtual(
+        nodes=MockVirtual(node=MockVirtuals({
+            '10.2.96.3': foo, '10.2.96.4': bar})))))
+    config = {
+        'pools': [{'name': 'default_foo'}],
+        'nodes': [
+            {'name': '10.2.96.3', 'description': 'Pod default/foo-1'},
+            {'name': '10.2.96.4', 'description': 'Pod default/bar-2'}
+        ]
+    }
+
+    descriptions = bigipconfigdriver._pop_nodes(config)
+    assert config == {'pools': [{'name': 'default_foo'}]}
+    assert len(descriptions) == 2
+
+    applied = {'10.2.96.9': 'Pod default/gone-1'}
+    incomplete = bigipconfigdriver._set_node_descriptions(
+        mgmt, 'test', descriptions, applied)
+    assert incomplete == 0
+    assert applied == descriptions
+    assert foo.modified == {}
+    assert bar.modified == {'description': 'Pod default/bar-2'}
+
+    # Nodes whose description did not change are not loaded again
+    mgmt.tm.ltm.nodes.node = MockVirtuals({})
+    incomplete = bigipconfigdriver._set_node_descriptions(
+        mgmt, 'test', descriptions, applied)
+    assert incomplete == 0
+
+    # Nodes that cannot be loaded are retried
+    incomplete = bigipconfigdriver._set_node_descriptions(
+        mgmt, 'test', {'10.2.96.5': 'Node worker-1'}, applied)
+    assert incomplete == 1
+    assert applied == {}
+
+
+def test_set_traffic_group():
+    foo = MockVirtual(name='10.1.1.1', trafficGroup='/Common/traffic-group-1')
+    bar = MockVirtual(name='2001:db8::1',
+                      trafficGroup='/Common/traffic-group-local-only')
+    mgmt = MockVirtual(tm=MockVirtual(ltm=MockVirtual(
+        virtual_address_s=MockVirtual(virtual_address=MockVirtuals({
+            '10.1.1.1': foo, '2001:db8::1': bar})))))
+    config = {
+        'virtualServers': [
+            {'name': 'default_foo', 'destination': '/test/10.1.1.1:80'},
+            {'name': 'default_foo_443', 'destination': '/test/10.1.1.1:443'},
+            {'name': 'default_bar', 'destination': '/test/2001:db8::1.80'},
+            {'name': 'default_pool_only'}
+        ]
+    }
+
+    assert bigipconfigdriver._virtual_address_names(config) == \
+        set(['10.1.1.1', '2001:db8::1'])
+
+    applied = {'10.1.1.9': '/Common/traffic-group-1'}
+    incomplete = bigipconfigdriver._set_traffic_group(
+        mgmt, 'test', config, 'traffic-group-1', applied)
+    assert incomplete == 0
+    assert foo.modified == {}
+    assert bar.modified == {'trafficGroup': '/Common/traffic-group-1'}
+    assert applied == {'10.1.1.1': '/Common/traffic-group-1',
+                       '2001:db8::1': '/Common/traffic-group-1'}
+
+    # Virtual addresses already moved are not loaded again, those that
+    # cannot be loaded are retried
+    config['virtualServers'].append(
+        {'name': 'default_baz', 'destination': '/test/10.1.1.2:80'})
+    incomplete = bigipconfigdriver._set_traffic_group(
+        mgmt, 'test', config, '/Common/traffic-group-1', applied)
+    assert incomplete == 1
+    assert '10.1.1.2' not in applied
+
+
+def test_confighandler_check_failover():
+    handler = None
+    try:
+        status = {'apiAnonymous': 'Failover standby for 1d 02:15:32'}
+        mgr = MockMgr()
+        mgr._mgmt_root = MockVirtual(tm=MockVirtual(sys=MockVirtual(
+            failover=MockVirtual(
+                load=lambda: MockVirtual(apiRawValues=status)))))
+        handler = bigipconfigdriver.ConfigHandler('/tmp/config', [mgr], 0)
+        assert handler._failover_timer is None
+        resets = []
+        handler.notify_reset = lambda: resets.append(True)
+
+        handler.check_failover()
+        assert handler._failover_state == 'standby'
+        assert resets == []
+
+        # The config is verified when the BIG-IP becomes active
+        status['apiAnonymous'] = 'Failover active for 0d 00:00:05'
+        handler.check_failover()
+        assert handler._failover_state == 'active'
+        assert resets == [True]
+
+        # An unknown state is ignored
+        mgr._mgmt_root.tm.sys.failover.load = lambda: MockVirtual()
+        handler.check_failover()
+        assert handler._failover_state == 'active'
+    finally:
+        assert handler is not None
+
+        handler.stop()
+        handler._thread.join(30)
@@ -23,7 +23,7 @@ const handleError = require('./util').handleError;
 
 handleError();
 
-const CURRENT_VERSION="v0.1.4";
+const CURRENT_VERSION="v0.1.12";
 const testSchema = `f5schemadb://bigip-virtual-server_${CURRENT_VERSION}.json`;
 
 exports.bigipVirtualServer = {
@@ -170,6 +170,203 @@ exports.bigipVirtualServer.validMultiSslProfiles = t => {
   });
 };
 
+exports.bigipVirtualServer.validServerSslProfile = t => {
+  let data = JSON.parse(JSON.stringify(this.baseValidConfig));
+  data.virtualServer.frontend.serverSslProfile = {
+    "f5ProfileName": "Common/serverssl"
+  };
+  this.sUtil.loadSchemas(testSchema, () => {
+    let result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should have a valid result');
+
+    data.virtualServer.frontend.serverSslProfile = {
+      "caSecret": "backend-ca"
+    };
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should have a valid result');
+
+    data.virtualServer.frontend.serverSslProfile = {
+      "f5ProfileName": "Common/serverssl",
+      "caSecret": "backend-ca"
+    };
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should not allow both a profile and a CA Secret');
+
+    t.done();
+  });
+};
+
+exports.bigipVirtualServer.validPolicies = t => {
+  let data = JSON.parse(JSON.stringify(this.baseValidConfig));
+  data.virtualServer.policies = [ {
+    "name": "routing",
+    "strategy": "first-match",
+    "rules": [ {
+      "name": "api",
+      "conditions": [ {
+        "match": "host",
+        "values": [ "api.example.com" ]
+      }, {
+        "match": "header",
+        "name": "X-Version",
+        "operand": "startsWith",
+        "values": [ "2" ]
+      } ],
+      "action": { "type": "forward", "pool": "apimap" }
+    }, {
+      "name": "old",
+      "action": { "type": "redirect", "location": "https://example.com" }
+    } ]
+  } ];
+  this.sUtil.loadSchemas(testSchema, () => {
+    let result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should have a valid result');
+
+    delete data.virtualServer.policies[0].rules[0].conditions[1].name;
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should require a header name');
+
+    data.virtualServer.policies[0].rules[0].conditions.pop();
+    delete data.virtualServer.policies[0].rules[1].action.location;
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should require a redirect location');
+
+    data.virtualServer.policies[0].rules[1].action = { "type": "reject" };
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should not allow unknown actions');
+
+    t.done();
+  });
+};
+
+exports.bigipVirtualServer.validProfiles = t => {
+  let data = JSON.parse(JSON.stringify(this.baseValidConfig));
+  data.virtualServer.frontend.profiles = [ {
+    "name": "http",
+    "partition": "Common",
+    "context": "all"
+  }, {
+    "name": "tcp-wan-optimized",
+    "partition": "Common",
+    "context": "clientside"
+  } ];
+  this.sUtil.loadSchemas(testSchema, () => {
+    let result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should have a valid result');
+
+    data.virtualServer.frontend.profiles[1].context = "both";
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should not allow unknown contexts');
+
+    delete data.virtualServer.frontend.profiles[1].context;
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should require a context');
+
+    t.done();
+  });
+};
+
+exports.bigipVirtualServer.validVirtualType = t => {
+  let data = JSON.parse(JSON.stringify(this.baseValidConfig));
+  data.virtualServer.frontend.virtualType = "performance-l4";
+  this.sUtil.loadSchemas(testSchema, () => {
+    let result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should have a valid result');
+
+    data.virtualServer.frontend.virtualType = "fastl4";
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should not allow unknown virtual types');
+
+    t.done();
+  });
+};
+
+exports.bigipVirtualServer.validFqdnBackend = t => {
+  let data = JSON.parse(JSON.stringify(this.baseValidConfig));
+  delete data.virtualServer.backend.serviceName;
+  data.virtualServer.backend.fqdn = {
+    name: "api.example.com",
+    autoPopulate: true,
+    interval: 300
+  };
+  this.sUtil.loadSchemas(testSchema, () => {
+    let result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should have a valid result');
+
+    data.virtualServer.backend.serviceName = "foo";
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should not allow both serviceName and fqdn');
+
+    delete data.virtualServer.backend.serviceName;
+    delete data.virtualServer.backend.fqdn.name;
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should require the name of the fqdn');
+
+    t.done();
+  });
+};
+
+exports.bigipVirtualServer.validDualStackAddress = t => {
+  let data = JSON.parse(JSON.stringify(this.baseValidConfig));
+  data.virtualServer.frontend.virtualAddress = {
+    bindAddr: "10.128.10.240",
+    bindAddrV6: "2001:db8::10",
+    port: 80
+  };
+  this.sUtil.loadSchemas(testSchema, () => {
+    let result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should have a valid result');
+
+    data.virtualServer.frontend.virtualAddress.bindAddrV6 = "10.128.10.241";
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should require an IPv6 bindAddrV6');
+
+    t.done();
+  });
+};
+
+exports.bigipVirtualServer.validSourcePort = t => {
+  let data = JSON.parse(JSON.stringify(this.baseValidConfig));
+  data.virtualServer.frontend.sourcePort = "preserve-strict";
+  data.virtualServer.frontend.transparent = true;
+  this.sUtil.loadSchemas(testSchema, () => {
+    let result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should have a valid result');
+
+    data.virtualServer.frontend.sourcePort = "keep";
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should not allow unknown source port modes');
+
+    t.done();
+  });
+};
+
+exports.bigipVirtualServer.validStaticMembers = t => {
+  let data = JSON.parse(JSON.stringify(this.baseValidConfig));
+  data.virtualServer.backend.staticMembers = [
+    "10.10.0.5:8080", "[2001:db8::5]:8080"
+  ];
+  this.sUtil.loadSchemas(testSchema, () => {
+    let result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should allow static members with a service');
+
+    delete data.virtualServer.backend.serviceName;
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(result.valid, 'Should allow static members without a service');
+
+    data.virtualServer.backend.fqdn = { name: "api.example.com" };
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should not allow both static members and fqdn');
+
+    delete data.virtualServer.backend.fqdn;
+    data.virtualServer.backend.staticMembers = [];
+    result = this.sUtil.runValidate(data, testSchema);
+    t.ok(!result.valid, 'Should require a static member');
+
+    t.done();
+  });
+};
+
 exports.bigipVirtualServer.mutualExclusiveFrontend = t => {
   let data = Object.assign({}, this.baseIAppConfig);
   data.virtualServer.frontend.virtualAddress = {